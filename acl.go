@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ruleACL 规则解析后的访问控制列表
+type ruleACL struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// ruleACLs 按规则ID缓存解析后的访问控制列表，避免每个连接/数据包都解析一次
+var ruleACLs = struct {
+	sync.RWMutex
+	byRule map[string]*ruleACL
+}{byRule: make(map[string]*ruleACL)}
+
+// parseCIDRList 解析IP/CIDR列表，单个IP视为 /32 或 /128
+func parseCIDRList(entries []string) ([]*net.IPNet, error) {
+	return parseAllowlist(strings.Join(entries, ","))
+}
+
+// parseRuleACL 解析规则的允许与拒绝列表
+func parseRuleACL(rule Rule) (*ruleACL, error) {
+	allow, err := parseCIDRList(rule.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+	deny, err := parseCIDRList(rule.DenyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("deny list: %w", err)
+	}
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	return &ruleACL{allow: allow, deny: deny}, nil
+}
+
+// setRuleACL 更新规则的访问控制缓存
+func setRuleACL(ruleID string, acl *ruleACL) {
+	ruleACLs.Lock()
+	defer ruleACLs.Unlock()
+	if acl == nil {
+		delete(ruleACLs.byRule, ruleID)
+		return
+	}
+	ruleACLs.byRule[ruleID] = acl
+}
+
+// loadRuleACLs 启动时解析所有规则的访问控制列表
+func loadRuleACLs() {
+	for _, rule := range ruleStore.Rules() {
+		acl, err := parseRuleACL(rule)
+		if err != nil {
+			log.Printf("Invalid access control list of rule %s: %v", rule.ID, err)
+			// 解析失败时拒绝所有来源，避免在配置错误时意外放开
+			_, all4, _ := net.ParseCIDR("0.0.0.0/0")
+			_, all6, _ := net.ParseCIDR("::/0")
+			acl = &ruleACL{deny: []*net.IPNet{all4, all6}}
+		}
+		setRuleACL(rule.ID, acl)
+	}
+}
+
+// aclAllows 判断来源IP是否通过规则的访问控制：命中拒绝列表即拒绝，允许列表非空时必须命中
+func aclAllows(ruleID string, ip net.IP) bool {
+	ruleACLs.RLock()
+	acl := ruleACLs.byRule[ruleID]
+	ruleACLs.RUnlock()
+	if acl == nil {
+		return true
+	}
+
+	for _, n := range acl.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(acl.allow) == 0 {
+		return true
+	}
+	for _, n := range acl.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiGetACL 获取规则的访问控制列表
+func apiGetACL(w http.ResponseWriter, r *http.Request) {
+	getRuleOption(w, r, func(rule Rule) map[string]interface{} {
+		allow, deny := rule.AllowCIDRs, rule.DenyCIDRs
+		if allow == nil {
+			allow = []string{}
+		}
+		if deny == nil {
+			deny = []string{}
+		}
+		return map[string]interface{}{"allow": allow, "deny": deny}
+	})
+}
+
+// updateACLRequest apiUpdateACL 的请求体
+type updateACLRequest struct {
+	RuleID string   `json:"ruleId"`
+	Allow  []string `json:"allow"`
+	Deny   []string `json:"deny"`
+}
+
+// apiUpdateACL 设置规则的允许/拒绝 CIDR 列表，立即对新连接生效
+func apiUpdateACL(w http.ResponseWriter, r *http.Request) {
+	var acl *ruleACL
+	rule, ok := updateRuleOption(w, r, "access control", func(req *updateACLRequest, _ Rule) (func(rule *Rule), error) {
+		var err error
+		if acl, err = parseRuleACL(Rule{AllowCIDRs: req.Allow, DenyCIDRs: req.Deny}); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) {
+			rule.AllowCIDRs = trimCIDRs(req.Allow)
+			rule.DenyCIDRs = trimCIDRs(req.Deny)
+		}, nil
+	})
+	if !ok {
+		return
+	}
+
+	setRuleACL(rule.ID, acl)
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// trimCIDRs 去掉空白项
+func trimCIDRs(entries []string) []string {
+	var list []string
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
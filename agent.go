@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 代理模式：本实例定期向中心实例（-agent-controller）报告规则与运行状态，
+// 并执行中心实例下发的开启、停止、新增、修改与删除规则的命令。
+// 双方以中心实例的 -controller-token 认证，中心实例使用 https 时通道加密
+const (
+	agentTokenEnv      = "GOPORTS_AGENT_TOKEN"
+	controllerTokenEnv = "GOPORTS_CONTROLLER_TOKEN"
+
+	agentReportPath  = "/agent/report" // 中心实例接收报告的路径，不在 /api/ 下，以令牌自行认证
+	agentTokenHeader = "X-Agent-Token"
+
+	agentRequestTimeout = 15 * time.Second
+	maxAgentReportSize  = 4 << 20
+	maxAgentResults     = 50 // 代理保留的未送达命令结果，中心实例保留的最近结果
+)
+
+// 代理命令的操作
+const (
+	agentActionStart  = "start"
+	agentActionStop   = "stop"
+	agentActionAdd    = "add"
+	agentActionUpdate = "update"
+	agentActionDelete = "delete"
+)
+
+// sourceAgent 中心实例经代理模式下发的命令，记入规则的事件历史
+const sourceAgent = "agent"
+
+var agentLog = newLogger("agent")
+
+// AgentRuleSpec 新增或修改规则时下发的名称与地址
+type AgentRuleSpec struct {
+	Name       string `json:"name,omitempty"`
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+}
+
+// AgentCommand 中心实例下发给代理的命令
+type AgentCommand struct {
+	ID        string         `json:"id"`
+	Action    string         `json:"action"`              // start/stop/add/update/delete
+	RuleID    string         `json:"ruleId,omitempty"`    // add 以外的操作针对的规则
+	Protocols []string       `json:"protocols,omitempty"` // start/stop 的协议，为空时开启 TCP 与 UDP、停止所有正在运行的协议
+	Rule      *AgentRuleSpec `json:"rule,omitempty"`      // add/update 的名称与地址
+}
+
+// AgentCommandResult 代理执行命令的结果
+type AgentCommandResult struct {
+	ID      string    `json:"id"`
+	Action  string    `json:"action"`
+	RuleID  string    `json:"ruleId,omitempty"` // add 时为新规则的ID
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// AgentReport 代理定期发送给中心实例的报告
+type AgentReport struct {
+	Name    string               `json:"name"`
+	Rules   []RuleStatus         `json:"rules"`
+	Results []AgentCommandResult `json:"results,omitempty"` // 上次报告后执行的命令的结果
+}
+
+// agentReply 中心实例对报告的回复
+type agentReply struct {
+	Commands []AgentCommand `json:"commands"`
+}
+
+// startAgent 按 -agent-controller 以代理模式运行，定期向中心实例报告并执行下发的命令
+func startAgent() {
+	if *agentController == "" {
+		return
+	}
+	token := *agentToken
+	if token == "" {
+		token = os.Getenv(agentTokenEnv)
+	}
+	if token == "" {
+		agentLog.Errorf("Agent mode not started: -agent-token or $%s is required", agentTokenEnv)
+		return
+	}
+	name := *agentName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	url := strings.TrimRight(*agentController, "/") + agentReportPath
+	agentLog.Infof("Agent mode: reporting to %s as %q every %v", *agentController, name, *agentInterval)
+
+	go func() {
+		client := &http.Client{Timeout: agentRequestTimeout}
+		var results []AgentCommandResult
+		connected := false
+		for {
+			commands, err := sendAgentReport(client, url, token, AgentReport{Name: name, Rules: agentRuleStatuses(), Results: results})
+			if err != nil {
+				if connected {
+					agentLog.Warnf("Lost connection to controller %s: %v", *agentController, err)
+				} else {
+					agentLog.Debugf("Failed to report to controller %s: %v", *agentController, err)
+				}
+				connected = false
+				time.Sleep(*agentInterval)
+				continue
+			}
+			if !connected {
+				agentLog.Infof("Connected to controller %s", *agentController)
+				connected = true
+			}
+
+			// 结果已送达；执行新命令后立即再报告一次，中心实例尽快看到新状态
+			results = nil
+			for _, cmd := range commands {
+				results = append(results, runAgentCommand(cmd))
+			}
+			if len(results) > maxAgentResults {
+				results = results[len(results)-maxAgentResults:]
+			}
+			if len(commands) == 0 {
+				time.Sleep(*agentInterval)
+			}
+		}
+	}()
+}
+
+// agentRuleStatuses 报告中的规则及其正在运行的协议
+func agentRuleStatuses() []RuleStatus {
+	list := []RuleStatus{}
+	for _, rule := range ruleStore.Rules() {
+		list = append(list, newRuleStatus(rule))
+	}
+	return list
+}
+
+// sendAgentReport 发送报告，返回中心实例下发的命令
+func sendAgentReport(client *http.Client, url, token string, report AgentReport) ([]AgentCommand, error) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(agentTokenHeader, token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("controller returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var reply agentReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("invalid reply: %v", err)
+	}
+	return reply.Commands, nil
+}
+
+// runAgentCommand 执行中心实例下发的命令
+func runAgentCommand(cmd AgentCommand) AgentCommandResult {
+	result := AgentCommandResult{ID: cmd.ID, Action: cmd.Action, RuleID: cmd.RuleID, Time: time.Now()}
+	var err error
+	switch cmd.Action {
+	case agentActionStart, agentActionStop:
+		err = agentRuleAction(cmd)
+	case agentActionAdd:
+		result.RuleID, err = agentAddRule(cmd.Rule)
+	case agentActionUpdate:
+		err = agentUpdateRule(cmd.RuleID, cmd.Rule)
+	case agentActionDelete:
+		err = agentDeleteRule(cmd.RuleID)
+	default:
+		err = fmt.Errorf("unknown action %q", cmd.Action)
+	}
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+		agentLog.Warnf("Controller command %s %s failed: %v", cmd.Action, cmd.RuleID, err)
+	} else {
+		agentLog.Infof("Controller command %s %s done", cmd.Action, result.RuleID)
+	}
+	return result
+}
+
+// agentRuleAction 开启或停止规则的转发，已在运行（或未运行）的协议跳过
+func agentRuleAction(cmd AgentCommand) error {
+	rule, ok := findRule(cmd.RuleID)
+	if !ok {
+		return errors.New("rule not found")
+	}
+	for _, protocol := range cmd.Protocols {
+		if _, err := bulkProtocols(protocol, nil); err != nil || protocol == "" {
+			return fmt.Errorf("unknown protocol %q", protocol)
+		}
+	}
+	var failed []ruleProtocolError
+	if cmd.Action == agentActionStart {
+		_, failed = startRuleProtocols(rule, cmd.Protocols, sourceAgent)
+	} else {
+		_, failed = stopRuleProtocols(rule, cmd.Protocols, sourceAgent)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	failures := make([]string, 0, len(failed))
+	for _, f := range failed {
+		failures = append(failures, fmt.Sprintf("%s: %v", strings.ToUpper(f.Protocol), f.Err))
+	}
+	return errors.New(strings.Join(failures, "; "))
+}
+
+// agentRuleFields 规范化并校验下发的名称与地址，返回填入这些字段的规则
+func agentRuleFields(rule Rule, spec *AgentRuleSpec) (Rule, error) {
+	if spec == nil {
+		return Rule{}, errors.New("rule is required")
+	}
+	s := *spec
+	normalizeHosts(&s.ListenAddr, &s.TargetAddr)
+	if errs := resolveRulePorts(&s.ListenPort, &s.TargetPort); len(errs) > 0 {
+		return Rule{}, fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message)
+	}
+	name, _, err := normalizeRuleLabel(s.Name, rule.Note)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.Name = name
+	rule.ListenAddr, rule.ListenPort = s.ListenAddr, s.ListenPort
+	rule.TargetAddr, rule.TargetPort = s.TargetAddr, s.TargetPort
+	if errs := validateRuleFields(rule); len(errs) > 0 {
+		return Rule{}, fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message)
+	}
+	return rule, nil
+}
+
+// agentAddRule 新增规则，返回新规则的ID
+func agentAddRule(spec *AgentRuleSpec) (string, error) {
+	rule, err := agentRuleFields(Rule{ID: uuid.New().String()}, spec)
+	if err != nil {
+		return "", err
+	}
+	rule, err = ruleStore.AddRule(rule)
+	if err != nil {
+		return "", err
+	}
+	recordConfigEvent(rule.ID, sourceAgent, "Created")
+	return rule.ID, nil
+}
+
+// agentUpdateRule 修改规则的名称与地址，正在运行的转发会重启以应用新地址
+func agentUpdateRule(id string, spec *AgentRuleSpec) error {
+	old, ok := findRule(id)
+	if !ok {
+		return errors.New("rule not found")
+	}
+	next, err := agentRuleFields(old, spec)
+	if err != nil {
+		return err
+	}
+	updated, err := ruleStore.UpdateRule(id, func(rule *Rule) {
+		if rule.TargetAddr != next.TargetAddr || rule.TargetPort != next.TargetPort {
+			rememberTarget(rule, rule.TargetAddr, rule.TargetPort)
+		}
+		rule.Name = next.Name
+		rule.ListenAddr, rule.ListenPort = next.ListenAddr, next.ListenPort
+		rule.TargetAddr, rule.TargetPort = next.TargetAddr, next.TargetPort
+	})
+	if err != nil {
+		return err
+	}
+	recordConfigEvent(id, sourceAgent, "Updated")
+	return restartRuleForwards(old, updated, sourceAgent)
+}
+
+// agentDeleteRule 停止规则正在运行的转发并删除规则
+func agentDeleteRule(id string) error {
+	rule, ok := findRule(id)
+	if !ok {
+		return errors.New("rule not found")
+	}
+	for _, protocol := range runningProtocols(rule) {
+		if err := stopRuleForward(rule, protocol, sourceAgent); err != nil {
+			return err
+		}
+	}
+	if err := ruleStore.DeleteRules([]string{id}); err != nil {
+		return err
+	}
+	recordConfigEvent(id, sourceAgent, "Deleted")
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// agentOfflineAfter 超过这么久没有报告的代理视为离线
+const agentOfflineAfter = time.Minute
+
+// controllerToken 代理向本实例报告时必须携带的令牌，为空时不接受代理
+var controllerToken struct {
+	once  sync.Once
+	token string
+}
+
+// agentControllerToken 返回 -controller-token 或环境变量中的令牌
+func agentControllerToken() string {
+	controllerToken.once.Do(func() {
+		controllerToken.token = *controllerTokenFlag
+		if controllerToken.token == "" {
+			controllerToken.token = os.Getenv(controllerTokenEnv)
+		}
+	})
+	return controllerToken.token
+}
+
+// agentState 中心实例记录的一个代理
+type agentState struct {
+	addr     string
+	lastSeen time.Time
+	rules    []RuleStatus
+	pending  []AgentCommand       // 尚未下发的命令
+	sent     []AgentCommand       // 已下发、尚未收到结果的命令
+	results  []AgentCommandResult // 最近的命令结果，最新的在后
+}
+
+// agents 按名称记录报告过的代理，只保存在内存中，重启后等代理再次报告
+var agents = struct {
+	sync.Mutex
+	byName map[string]*agentState
+}{byName: make(map[string]*agentState)}
+
+// serveAgentReport 接收代理的报告，返回排队的命令。以 X-Agent-Token 认证，不经过 API 认证与登录
+func serveAgentReport(w http.ResponseWriter, r *http.Request) {
+	token := agentControllerToken()
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !secureEqual(r.Header.Get(agentTokenHeader), token) {
+		log.Printf("Rejected agent report from %s: invalid token", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var report AgentReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentReportSize)).Decode(&report); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	report.Name = strings.TrimSpace(report.Name)
+	if report.Name == "" {
+		http.Error(w, "Agent name is required", http.StatusBadRequest)
+		return
+	}
+
+	agents.Lock()
+	agent := agents.byName[report.Name]
+	if agent == nil {
+		agent = &agentState{}
+		agents.byName[report.Name] = agent
+		log.Printf("Agent %q connected from %s", report.Name, r.RemoteAddr)
+	}
+	agent.addr = r.RemoteAddr
+	agent.lastSeen = time.Now()
+	agent.rules = report.Rules
+	for _, result := range report.Results {
+		agent.results = append(agent.results, result)
+		for i, cmd := range agent.sent {
+			if cmd.ID == result.ID {
+				agent.sent = append(agent.sent[:i], agent.sent[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(agent.results) > maxAgentResults {
+		agent.results = agent.results[len(agent.results)-maxAgentResults:]
+	}
+	commands := agent.pending
+	agent.pending = nil
+	agent.sent = append(agent.sent, commands...)
+	agents.Unlock()
+
+	if commands == nil {
+		commands = []AgentCommand{}
+	}
+	writeJSON(w, http.StatusOK, agentReply{Commands: commands})
+}
+
+// AgentStatus 代理的最近报告与命令
+type AgentStatus struct {
+	Name     string               `json:"name"`
+	Addr     string               `json:"addr"` // 最近一次报告的来源地址
+	LastSeen time.Time            `json:"lastSeen"`
+	Online   bool                 `json:"online"`
+	Rules    []RuleStatus         `json:"rules"`
+	Pending  []AgentCommand       `json:"pending"` // 已排队或已下发、尚未收到结果的命令
+	Results  []AgentCommandResult `json:"results"` // 最近的命令结果，最新的在前
+}
+
+// apiGetAgents 列出报告过的代理及其规则
+func apiGetAgents(w http.ResponseWriter, r *http.Request) {
+	agents.Lock()
+	list := make([]AgentStatus, 0, len(agents.byName))
+	for name, agent := range agents.byName {
+		status := AgentStatus{
+			Name:     name,
+			Addr:     agent.addr,
+			LastSeen: agent.lastSeen,
+			Online:   time.Since(agent.lastSeen) < agentOfflineAfter,
+			Rules:    append([]RuleStatus{}, agent.rules...),
+			Pending:  append(append([]AgentCommand{}, agent.sent...), agent.pending...),
+			Results:  make([]AgentCommandResult, 0, len(agent.results)),
+		}
+		for i := len(agent.results) - 1; i >= 0; i-- {
+			status.Results = append(status.Results, agent.results[i])
+		}
+		list = append(list, status)
+	}
+	agents.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// agentCommandRequest apiAgentCommand 的请求体
+type agentCommandRequest struct {
+	Agent string `json:"agent"`
+	AgentCommand
+}
+
+// apiAgentCommand 为代理排队一条命令，在它下次报告时下发；结果出现在 /api/agents 中
+func apiAgentCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req agentCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cmd := req.AgentCommand
+	switch cmd.Action {
+	case agentActionStart, agentActionStop, agentActionDelete:
+		if cmd.RuleID == "" {
+			writeError(w, http.StatusBadRequest, "ruleId is required")
+			return
+		}
+	case agentActionUpdate:
+		if cmd.RuleID == "" || cmd.Rule == nil {
+			writeError(w, http.StatusBadRequest, "ruleId and rule are required")
+			return
+		}
+	case agentActionAdd:
+		if cmd.Rule == nil {
+			writeError(w, http.StatusBadRequest, "rule is required")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown action %q", cmd.Action))
+		return
+	}
+	for _, protocol := range cmd.Protocols {
+		if _, err := bulkProtocols(protocol, nil); err != nil || protocol == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown protocol %q", protocol))
+			return
+		}
+	}
+	cmd.ID = uuid.New().String()
+
+	agents.Lock()
+	agent := agents.byName[req.Agent]
+	if agent != nil {
+		agent.pending = append(agent.pending, cmd)
+	}
+	agents.Unlock()
+	if agent == nil {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": cmd.ID})
+}
+
+// apiDeleteAgent 移除代理的记录及其排队的命令，代理再次报告时重新出现
+func apiDeleteAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req nameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	agents.Lock()
+	delete(agents.byName, req.Name)
+	agents.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
+	"github.com/google/uuid"
+)
+
+// alertSampleInterval 告警的采样间隔，保留的采样数对应 store.AlertMaxMinutes
+const alertSampleInterval = 15 * time.Second
+
+// AlertState 告警当前状态
+type AlertState struct {
+	AlertRule
+	Firing  bool      `json:"firing"`
+	Since   time.Time `json:"since,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// alertSample 某一时刻规则的累计统计（各协议之和）
+type alertSample struct {
+	at      time.Time
+	running bool
+	stats   forward.StatsSnapshot
+}
+
+// alertEngine 周期性采样并评估告警
+type alertEngine struct {
+	mu      sync.Mutex
+	samples map[string][]alertSample // 规则ID -> 采样
+	firing  map[string]AlertState    // 告警ID -> 状态
+}
+
+var alerts = &alertEngine{
+	samples: make(map[string][]alertSample),
+	firing:  make(map[string]AlertState),
+}
+
+// startAlertEngine 启动告警评估循环
+func startAlertEngine() {
+	go func() {
+		ticker := time.NewTicker(alertSampleInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			alerts.evaluate(time.Now())
+		}
+	}()
+}
+
+// ruleTotals 汇总规则在所有协议下的统计
+func ruleTotals(rule Rule) (forward.StatsSnapshot, bool) {
+	var total forward.StatsSnapshot
+	running := false
+	for _, protocol := range forwardProtocols {
+		if s, ok := ruleForwardStats(rule, protocol); ok {
+			running = true
+			total.BytesIn += s.BytesIn
+			total.BytesOut += s.BytesOut
+			total.ActiveConns += s.ActiveConns
+			total.TotalConns += s.TotalConns
+			total.DialFailures += s.DialFailures
+			total.Blocked += s.Blocked
+			total.Refused += s.Refused
+			total.OverLimit += s.OverLimit
+			total.Oversized += s.Oversized
+			total.Goroutines += s.Goroutines
+			total.OpenFDs += s.OpenFDs
+			total.BufferBytes += s.BufferBytes
+		}
+	}
+	return total, running
+}
+
+// evaluate 采样所有规则并评估告警
+func (e *alertEngine) evaluate(now time.Time) {
+	snapshot := ruleStore.Rules()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, rule := range snapshot {
+		total, running := ruleTotals(rule)
+		history := append(e.samples[rule.ID], alertSample{at: now, running: running, stats: total})
+		if max := store.AlertMaxMinutes*int(time.Minute/alertSampleInterval) + 1; len(history) > max {
+			history = history[len(history)-max:]
+		}
+		e.samples[rule.ID] = history
+
+		for _, def := range rule.Alerts {
+			seen[def.ID] = true
+			if !def.Enabled {
+				delete(e.firing, def.ID)
+				continue
+			}
+			firing, message := checkAlert(def, history)
+			e.transition(rule, def, firing, message, now)
+		}
+	}
+
+	// 清理已删除的规则与告警
+	for id := range e.firing {
+		if !seen[id] {
+			delete(e.firing, id)
+		}
+	}
+	for ruleID := range e.samples {
+		found := false
+		for _, rule := range snapshot {
+			if rule.ID == ruleID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(e.samples, ruleID)
+		}
+	}
+}
+
+// checkAlert 根据采样历史判断告警条件是否成立
+func checkAlert(def AlertRule, history []alertSample) (bool, string) {
+	latest := history[len(history)-1]
+	window := time.Duration(def.Minutes) * time.Minute
+
+	// 找到窗口起点的采样，历史不足一个窗口时不评估
+	var base *alertSample
+	for i := len(history) - 1; i >= 0; i-- {
+		if latest.at.Sub(history[i].at) >= window {
+			base = &history[i]
+			break
+		}
+	}
+	if base == nil || !latest.running || !base.running {
+		return false, ""
+	}
+	// 计数回退说明转发被重启过，跳过本窗口
+	if latest.stats.TotalConns < base.stats.TotalConns {
+		return false, ""
+	}
+
+	conns := latest.stats.TotalConns - base.stats.TotalConns
+	switch def.Type {
+	case store.AlertDialFailureRate:
+		failures := latest.stats.DialFailures - base.stats.DialFailures
+		if conns == 0 {
+			return false, ""
+		}
+		rate := float64(failures) / float64(conns)
+		if rate >= def.Threshold {
+			return true, fmt.Sprintf("dial failure rate %.0f%% (%d/%d) in the last %d minutes", rate*100, failures, conns, def.Minutes)
+		}
+	case store.AlertNoTraffic:
+		if latest.stats.BytesIn == base.stats.BytesIn && latest.stats.BytesOut == base.stats.BytesOut {
+			return true, fmt.Sprintf("no traffic in the last %d minutes", def.Minutes)
+		}
+	case store.AlertConnectionSpike:
+		if float64(conns) >= def.Threshold {
+			return true, fmt.Sprintf("%d new connections in the last %d minutes", conns, def.Minutes)
+		}
+	}
+	return false, ""
+}
+
+// transition 处理告警状态变化并发送通知
+func (e *alertEngine) transition(rule Rule, def AlertRule, firing bool, message string, now time.Time) {
+	prev, wasFiring := e.firing[def.ID]
+	switch {
+	case firing && !wasFiring:
+		e.firing[def.ID] = AlertState{AlertRule: def, Firing: true, Since: now, Message: message}
+		notify(Notification{
+			Event:   "alert.firing",
+			RuleID:  rule.ID,
+			Title:   fmt.Sprintf("Alert %s on %s", def.Type, ruleDisplayName(rule)),
+			Message: message,
+			Time:    now,
+		})
+	case firing && wasFiring:
+		prev.Message = message
+		e.firing[def.ID] = prev
+	case !firing && wasFiring:
+		delete(e.firing, def.ID)
+		notify(Notification{
+			Event:   "alert.resolved",
+			RuleID:  rule.ID,
+			Title:   fmt.Sprintf("Alert %s resolved on %s", def.Type, ruleDisplayName(rule)),
+			Message: fmt.Sprintf("condition cleared after %s", now.Sub(prev.Since).Round(time.Second)),
+			Time:    now,
+		})
+	}
+}
+
+// states 返回规则所有告警的当前状态
+func (e *alertEngine) states(rule Rule) []AlertState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	states := []AlertState{}
+	for _, def := range rule.Alerts {
+		if s, ok := e.firing[def.ID]; ok {
+			s.AlertRule = def
+			states = append(states, s)
+			continue
+		}
+		states = append(states, AlertState{AlertRule: def})
+	}
+	return states
+}
+
+// apiGetAlerts 获取规则的告警定义与状态
+func apiGetAlerts(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.URL.Query().Get("ruleId")
+
+	rule, ok := ruleStore.Rule(ruleID)
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "alerts": alerts.states(rule)})
+}
+
+// updateAlertsRequest apiUpdateAlerts 的请求体
+type updateAlertsRequest struct {
+	RuleID string      `json:"ruleId"`
+	Alerts []AlertRule `json:"alerts"`
+}
+
+// apiUpdateAlerts 替换规则的告警定义
+func apiUpdateAlerts(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "alerts", func(req *updateAlertsRequest, _ Rule) (func(rule *Rule), error) {
+		for i := range req.Alerts {
+			if err := req.Alerts[i].Validate(); err != nil {
+				return nil, err
+			}
+			if req.Alerts[i].ID == "" {
+				req.Alerts[i].ID = uuid.New().String()
+			}
+		}
+		return func(rule *Rule) { rule.Alerts = req.Alerts }, nil
+	})
+	if ok {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "alerts": rule.Alerts})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// ForwardFailure 批量启动/停止中失败的转发
+type ForwardFailure struct {
+	RuleID   string `json:"ruleId"`
+	Protocol string `json:"protocol"`
+	Error    string `json:"error"`
+}
+
+// bulkProtocols 解析协议过滤，为空时使用默认协议
+func bulkProtocols(protocol string, defaults []string) ([]string, error) {
+	switch protocol {
+	case "":
+		return defaults, nil
+	case "tcp", "udp", "sctp", "socks5":
+		return []string{protocol}, nil
+	}
+	return nil, fmt.Errorf("unknown protocol %q", protocol)
+}
+
+// startAllForwards 启动所有规则在指定协议下的转发，跳过未填写完整与已在运行的规则
+func startAllForwards(protocols []string, source string) (int, []ForwardFailure) {
+	started := 0
+	failures := []ForwardFailure{}
+	for _, rule := range ruleStore.Rules() {
+		for _, protocol := range protocols {
+			if rule.ListenPort == "" || (protocol != "socks5" && (rule.TargetAddr == "" || rule.TargetPort == "")) {
+				continue
+			}
+			if isRuleForwardRunning(rule, protocol) {
+				continue
+			}
+			if err := startRuleForward(rule, protocol, source); err != nil {
+				msg := err.Error()
+				if isAddrInUse(err) {
+					if owner := describePortConflict(protocol, rule.ListenAddr, rule.ListenPort); owner != "" {
+						msg += " (" + owner + ")"
+					}
+				}
+				failures = append(failures, ForwardFailure{RuleID: rule.ID, Protocol: protocol, Error: msg})
+				continue
+			}
+			started++
+		}
+	}
+	return started, failures
+}
+
+// stopAllForwards 停止所有规则在指定协议下正在运行的转发
+func stopAllForwards(protocols []string, source string) (int, []ForwardFailure) {
+	wanted := make(map[string]bool)
+	for _, protocol := range protocols {
+		wanted[protocol] = true
+	}
+	stopped := 0
+	failures := []ForwardFailure{}
+	for _, rule := range ruleStore.Rules() {
+		for _, protocol := range runningProtocols(rule) {
+			if !wanted[protocol] {
+				continue
+			}
+			if err := stopRuleForward(rule, protocol, source); err != nil {
+				failures = append(failures, ForwardFailure{RuleID: rule.ID, Protocol: protocol, Error: err.Error()})
+				continue
+			}
+			stopped++
+		}
+	}
+	return stopped, failures
+}
+
+// bulkForwardRequest 批量启停转发的请求体
+type bulkForwardRequest struct {
+	Protocol string `json:"protocol"` // 为空时按默认协议
+}
+
+// decodeBulkRequest 解析批量启停的请求体（可选），返回要处理的协议
+func decodeBulkRequest(w http.ResponseWriter, r *http.Request, defaults []string) ([]string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	var req bulkForwardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	protocols, err := bulkProtocols(req.Protocol, defaults)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return protocols, true
+}
+
+// apiStartAllForwards 启动所有规则的转发，默认 TCP 与 UDP，可用 protocol 只启动一种协议
+func apiStartAllForwards(w http.ResponseWriter, r *http.Request) {
+	protocols, ok := decodeBulkRequest(w, r, []string{"tcp", "udp"})
+	if !ok {
+		return
+	}
+
+	started, failures := startAllForwards(protocols, requestSource(r))
+	log.Printf("Started %d forwards (%d failed)", started, len(failures))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "started": started, "failed": failures})
+}
+
+// apiStopAllForwards 停止所有正在运行的转发，可用 protocol 只停止一种协议
+func apiStopAllForwards(w http.ResponseWriter, r *http.Request) {
+	protocols, ok := decodeBulkRequest(w, r, []string{"tcp", "udp", "sctp", "socks5"})
+	if !ok {
+		return
+	}
+
+	stopped, failures := stopAllForwards(protocols, requestSource(r))
+	log.Printf("Stopped %d forwards (%d failed)", stopped, len(failures))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "stopped": stopped, "failed": failures})
+}
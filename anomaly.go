@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+const (
+	anomalySampleInterval = 30 * time.Second
+	anomalyAlpha          = 0.1 // EWMA 平滑系数
+	anomalyWarmupSamples  = 20  // 建立基线所需的最少采样数
+	anomalySigma          = 4   // 偏离基线多少个标准差视为突增
+	anomalyFlatlineCount  = 3   // 连续多少个零值采样视为断流
+	anomalyMaxEvents      = 200
+)
+
+// 触发检测的最小量，避免低流量规则的噪声
+const (
+	anomalyMinBytesRate = 10 * 1024 // 字节/秒
+	anomalyMinConnRate  = 1.0       // 连接/秒
+)
+
+// AnomalyEvent 流量异常事件
+type AnomalyEvent struct {
+	RuleID   string    `json:"ruleId"`
+	Metric   string    `json:"metric"` // bytesRate / connRate
+	Kind     string    `json:"kind"`   // surge / flatline
+	Value    float64   `json:"value"`
+	Baseline float64   `json:"baseline"`
+	Time     time.Time `json:"time"`
+}
+
+// baseline 单个指标的指数加权均值与方差
+type baseline struct {
+	mean     float64
+	variance float64
+	samples  int
+	zeros    int  // 连续零值采样数
+	anomaly  bool // 当前是否处于异常中
+}
+
+// update 用正常采样更新基线
+func (b *baseline) update(v float64) {
+	if b.samples == 0 {
+		b.mean = v
+	} else {
+		diff := v - b.mean
+		b.mean += anomalyAlpha * diff
+		b.variance = (1 - anomalyAlpha) * (b.variance + anomalyAlpha*diff*diff)
+	}
+	b.samples++
+}
+
+// check 判断采样是否异常，返回异常类型
+func (b *baseline) check(v, min float64) string {
+	if v == 0 {
+		b.zeros++
+	} else {
+		b.zeros = 0
+	}
+	if b.samples < anomalyWarmupSamples {
+		return ""
+	}
+	std := math.Sqrt(b.variance)
+	if v > min && v > 2*b.mean && v > b.mean+anomalySigma*std {
+		return "surge"
+	}
+	if b.mean > min && b.zeros >= anomalyFlatlineCount {
+		return "flatline"
+	}
+	return ""
+}
+
+// ruleBaselines 规则的各指标基线
+type ruleBaselines struct {
+	last      forward.StatsSnapshot
+	lastAt    time.Time
+	bytesRate baseline
+	connRate  baseline
+}
+
+// anomalyDetector 流量异常检测
+var anomalyDetector = struct {
+	sync.Mutex
+	rules  map[string]*ruleBaselines
+	events []AnomalyEvent
+}{
+	rules: make(map[string]*ruleBaselines),
+}
+
+// startAnomalyDetector 启动异常检测循环
+func startAnomalyDetector() {
+	go func() {
+		ticker := time.NewTicker(anomalySampleInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			detectAnomalies(now)
+		}
+	}()
+}
+
+// detectAnomalies 采样所有运行中的规则并与基线比较
+func detectAnomalies(now time.Time) {
+	snapshot := ruleStore.Rules()
+
+	anomalyDetector.Lock()
+	defer anomalyDetector.Unlock()
+
+	seen := make(map[string]bool)
+	for _, rule := range snapshot {
+		total, running := ruleTotals(rule)
+		if !running {
+			continue
+		}
+		seen[rule.ID] = true
+
+		rb, ok := anomalyDetector.rules[rule.ID]
+		// 首次采样或计数回退（转发重启）时只记录起点
+		if !ok || total.TotalConns < rb.last.TotalConns || total.BytesIn < rb.last.BytesIn || total.BytesOut < rb.last.BytesOut {
+			if !ok {
+				rb = &ruleBaselines{}
+				anomalyDetector.rules[rule.ID] = rb
+			}
+			rb.last, rb.lastAt = total, now
+			continue
+		}
+
+		secs := now.Sub(rb.lastAt).Seconds()
+		if secs <= 0 {
+			continue
+		}
+		bytesRate := float64(total.BytesIn+total.BytesOut-rb.last.BytesIn-rb.last.BytesOut) / secs
+		connRate := float64(total.TotalConns-rb.last.TotalConns) / secs
+		rb.last, rb.lastAt = total, now
+
+		observeAnomaly(rule, "bytesRate", &rb.bytesRate, bytesRate, anomalyMinBytesRate, now)
+		observeAnomaly(rule, "connRate", &rb.connRate, connRate, anomalyMinConnRate, now)
+	}
+
+	// 停止的规则重新建立基线
+	for id := range anomalyDetector.rules {
+		if !seen[id] {
+			delete(anomalyDetector.rules, id)
+		}
+	}
+}
+
+// observeAnomaly 检查单个指标，异常开始时记录事件并通知
+func observeAnomaly(rule Rule, metric string, b *baseline, value, min float64, now time.Time) {
+	kind := b.check(value, min)
+	if kind == "" {
+		b.anomaly = false
+		b.update(value)
+		return
+	}
+	// 异常持续期间不更新基线，也不重复告警
+	if b.anomaly {
+		return
+	}
+	b.anomaly = true
+
+	event := AnomalyEvent{
+		RuleID:   rule.ID,
+		Metric:   metric,
+		Kind:     kind,
+		Value:    value,
+		Baseline: b.mean,
+		Time:     now,
+	}
+	anomalyDetector.events = append(anomalyDetector.events, event)
+	if len(anomalyDetector.events) > anomalyMaxEvents {
+		anomalyDetector.events = anomalyDetector.events[len(anomalyDetector.events)-anomalyMaxEvents:]
+	}
+
+	notify(Notification{
+		Event:   "anomaly." + kind,
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("Traffic %s on %s", kind, ruleDisplayName(rule)),
+		Message: fmt.Sprintf("%s is %.1f/s, baseline %.1f/s", metric, value, b.mean),
+		Time:    now,
+	})
+}
+
+// apiGetAnomalies 获取最近的流量异常事件，可按 ruleId 过滤
+func apiGetAnomalies(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.URL.Query().Get("ruleId")
+
+	anomalyDetector.Lock()
+	events := []AnomalyEvent{}
+	for _, e := range anomalyDetector.events {
+		if ruleID == "" || e.RuleID == ruleID {
+			events = append(events, e)
+		}
+	}
+	anomalyDetector.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "events": events})
+}
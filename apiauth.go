@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// API 认证的环境变量，未设置对应命令行参数时使用
+const (
+	apiTokenEnv     = "GOPORTS_API_TOKEN"
+	apiBasicAuthEnv = "GOPORTS_API_BASIC_AUTH"
+)
+
+// apiTokenHeader 携带令牌的请求头，也接受 Authorization: Bearer 与 ?token= 参数
+const apiTokenHeader = "X-API-Token"
+
+// apiAuth 生效的 API 认证配置，全部为空时不校验
+var apiAuth struct {
+	token    string
+	user     string
+	password string
+}
+
+// loadAPIAuth 从参数、环境变量或设置读取 API 认证配置
+func loadAPIAuth() error {
+	apiAuth.token = *apiToken
+	if apiAuth.token == "" {
+		apiAuth.token = os.Getenv(apiTokenEnv)
+	}
+	if apiAuth.token == "" {
+		apiAuth.token = currentSettings().APIToken
+	}
+
+	basic := *apiBasicAuth
+	if basic == "" {
+		basic = os.Getenv(apiBasicAuthEnv)
+	}
+	if basic != "" {
+		user, password, ok := strings.Cut(basic, ":")
+		if !ok || user == "" || password == "" {
+			return fmt.Errorf("basic auth must be user:password")
+		}
+		apiAuth.user, apiAuth.password = user, password
+	}
+	return nil
+}
+
+// apiAuthEnabled 是否启用了 API 认证
+func apiAuthEnabled() bool {
+	return apiAuth.token != "" || apiAuth.user != ""
+}
+
+// secureEqual 常量时间比较字符串
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// validAPIToken 检查请求是否携带正确的令牌
+func validAPIToken(r *http.Request) bool {
+	if apiAuth.token == "" {
+		return false
+	}
+	token := r.Header.Get(apiTokenHeader)
+	if token == "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+	}
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return token != "" && secureEqual(token, apiAuth.token)
+}
+
+// validBasicAuth 检查请求是否携带正确的用户名密码
+func validBasicAuth(r *http.Request) bool {
+	if apiAuth.user == "" {
+		return false
+	}
+	user, password, ok := r.BasicAuth()
+	return ok && secureEqual(user, apiAuth.user) && secureEqual(password, apiAuth.password)
+}
+
+// apiAuthenticated 请求是否携带正确的令牌或用户名密码，这样的请求不需要登录会话
+func apiAuthenticated(r *http.Request) bool {
+	return validAPIToken(r) || validBasicAuth(r)
+}
+
+// publicMetrics 是否为 -metrics-public 允许匿名抓取的 /metrics 请求
+func publicMetrics(r *http.Request) bool {
+	return *metricsPublic && r.URL.Path == metricsPath
+}
+
+// loginPaths 登录页面的请求，以界面密码认证，不需要令牌：登录页面不嵌入令牌
+var loginPaths = map[string]bool{
+	"/api/login":  true,
+	"/api/logout": true,
+}
+
+// requireAPIAuth API 认证中间件：/api/ 与 /metrics（-metrics-public 时除外）需要令牌或用户名密码；
+// 启用 basic 认证时页面也需要，以便浏览器弹出认证框并在后续请求中自动携带。代理的报告以自己的令牌认证
+func requireAPIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !apiAuthEnabled() || r.URL.Path == agentReportPath || loginPaths[r.URL.Path] || publicMetrics(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var ok bool
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == metricsPath {
+			ok = validAPIToken(r) || validBasicAuth(r)
+		} else {
+			ok = apiAuth.user == "" || validBasicAuth(r)
+		}
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		log.Printf("Rejected unauthenticated API request %s from %s", r.URL.Path, r.RemoteAddr)
+		if apiAuth.user != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Port Forwarder", charset="UTF-8"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// uiAuthenticated 请求是否已通过登录或 basic 认证，只有这时才能把令牌交给页面
+func uiAuthenticated(r *http.Request) bool {
+	return (loginEnabled() && validSession(r)) || validBasicAuth(r)
+}
+
+// injectAPIToken 让页面的 fetch 请求自动携带令牌。已通过登录或 basic 认证时嵌入令牌；
+// 否则页面在请求被拒绝时让用户输入令牌，保存在浏览器本地
+func injectAPIToken(html string, r *http.Request) string {
+	if apiAuth.token == "" {
+		return html
+	}
+	token := []byte("null")
+	if uiAuthenticated(r) {
+		token, _ = json.Marshal(apiAuth.token) // 默认转义 < > &，可安全放入 script
+	}
+	script := `<head>
+    <script>
+        window.apiToken = ` + string(token) + ` || localStorage.getItem('apiToken');
+        (function() {
+            const originalFetch = window.fetch;
+            let prompted = false;
+            window.fetch = function(url, options) {
+                options = options || {};
+                const isAPI = typeof url === 'string' && (url.startsWith('api/') || url.startsWith('/api/'));
+                if (isAPI && window.apiToken) {
+                    const headers = new Headers(options.headers || {});
+                    headers.set('` + apiTokenHeader + `', window.apiToken);
+                    options.headers = headers;
+                }
+                return originalFetch(url, options).then(response => {
+                    if (isAPI && response.status === 401 && !prompted) {
+                        prompted = true;
+                        const entered = prompt('请输入 API 令牌：', '');
+                        if (entered) {
+                            localStorage.setItem('apiToken', entered.trim());
+                            location.reload();
+                        }
+                    }
+                    return response;
+                });
+            };
+        })();
+    </script>`
+	return strings.Replace(html, "<head>", script, 1)
+}
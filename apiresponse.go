@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// writeJSON 以指定状态码返回 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 以统一的错误格式 {"success": false, "error": "..."} 返回失败。
+// http.Error 返回的纯文本错误由 localizeErrors 转为同样的格式
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, Result{Success: false, Error: msg})
+}
+
+// startFailureStatus 启动转发失败时的状态码：端口被占用或转发已在运行为 409，其余为 500
+func startFailureStatus(err error) int {
+	if isAddrInUse(err) || errors.Is(err, forward.ErrRunning) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// apiRoute 一个 REST 接口：既用于注册路由，也用于生成 /api/openapi.json
+type apiRoute struct {
+	Method   string
+	Path     string
+	Tag      string
+	Summary  string
+	Handler  http.HandlerFunc
+	Params   []apiParam // 路径参数，对应 Path 中的 {name}
+	Query    []apiParam
+	Request  interface{} // 请求体类型的零值，nil 表示没有请求体
+	Optional bool        // 请求体可以省略
+	Consumes string      // 请求体不是 JSON 时的 Content-Type
+	Response interface{} // 成功时的响应体类型，nil 时为通用的 Result
+	Produces string      // 响应不是 JSON 时的 Content-Type
+}
+
+// apiParam 路径或查询参数
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// 常用的参数
+var (
+	ruleIDParam       = apiParam{Name: "ruleId", Description: "Rule ID", Required: true}
+	ruleIDFilterParam = apiParam{Name: "ruleId", Description: "Rule ID; all rules when empty"}
+	listenAddrParam   = apiParam{Name: "listenAddr", Description: "Listen address", Required: true}
+	listenPortParam   = apiParam{Name: "listenPort", Description: "Listen port or service name", Required: true}
+	targetAddrParam   = apiParam{Name: "targetAddr", Description: "Target address; with targetPort, only a forward to this target counts as running"}
+	targetPortParam   = apiParam{Name: "targetPort", Description: "Target port"}
+	templateParam     = apiParam{Name: "name", Description: "Template name", Required: true}
+	ruleIDPathParam   = apiParam{Name: "id", Description: "Rule ID", Required: true}
+	dryRunParam       = apiParam{Name: "dryRun", Description: "1 to validate and report the changes without applying them"}
+)
+
+// apiRoutes 所有 /api 接口。OpenAPI 文档由这张表生成，新增接口时在这里登记
+var apiRoutes = []apiRoute{
+	// 登录与两步验证
+	{Method: "POST", Path: "/api/login", Tag: "auth", Summary: "Log in with the UI password and TOTP code", Handler: apiLogin, Request: loginRequest{}},
+	{Method: "POST", Path: "/api/logout", Tag: "auth", Summary: "Log out of the current session", Handler: apiLogout},
+	{Method: "GET", Path: "/api/getTOTP", Tag: "auth", Summary: "Get the two-factor authentication status", Handler: apiGetTOTP},
+	{Method: "POST", Path: "/api/setupTOTP", Tag: "auth", Summary: "Generate a pending TOTP secret and its QR code", Handler: apiSetupTOTP},
+	{Method: "POST", Path: "/api/enableTOTP", Tag: "auth", Summary: "Confirm the pending secret with a code and enable two-factor authentication", Handler: apiEnableTOTP, Request: totpCodeRequest{}},
+	{Method: "POST", Path: "/api/disableTOTP", Tag: "auth", Summary: "Disable two-factor authentication with a current code", Handler: apiDisableTOTP, Request: totpCodeRequest{}},
+
+	// 规则
+	{Method: "GET", Path: "/api/getRules", Tag: "rules", Summary: "List rules", Handler: apiGetRules, Query: []apiParam{{Name: "public", Description: "1 to include the public address of each rule"}}, Response: []Rule{}},
+	{Method: "POST", Path: "/api/addRule", Tag: "rules", Summary: "Add a rule, optionally from a preset", Handler: apiAddRule, Request: addRuleRequest{}},
+	{Method: "POST", Path: "/api/duplicateRule", Tag: "rules", Summary: "Copy a rule with a new ID, optionally shifting its ports", Handler: apiDuplicateRule, Request: duplicateRuleRequest{}},
+	{Method: "POST", Path: "/api/updateRule", Tag: "rules", Summary: "Update a rule's addresses, name and options", Handler: apiUpdateRule, Request: updateRuleRequest{}},
+	{Method: "POST", Path: "/api/deleteRules", Tag: "rules", Summary: "Delete rules", Handler: apiDeleteRules, Request: deleteRulesRequest{}},
+	{Method: "POST", Path: "/api/pinRule", Tag: "rules", Summary: "Pin or unpin a rule", Handler: apiPinRule, Request: pinRuleRequest{}},
+	{Method: "GET", Path: "/api/getFavorites", Tag: "rules", Summary: "List pinned rules and their running protocols", Handler: apiGetFavorites, Response: []FavoriteStatus{}},
+	{Method: "GET", Path: "/api/getPresets", Tag: "rules", Summary: "List built-in rule presets", Handler: apiGetPresets, Response: []Preset{}},
+	{Method: "GET", Path: "/api/getRuleHistory", Tag: "rules", Summary: "List start, stop, error and config-change events of rules, oldest first", Handler: apiGetRuleHistory, Query: []apiParam{
+		ruleIDFilterParam,
+		{Name: "type", Description: "Event type: start, stop, error or config; all types when empty"},
+		{Name: "limit", Description: "Number of most recent events to return (default 100)"},
+	}, Response: []RuleEvent{}},
+	{Method: "GET", Path: "/api/getRecentTargets", Tag: "rules", Summary: "List targets a rule has used recently", Handler: apiGetRecentTargets, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateAlerts", Tag: "rules", Summary: "Replace a rule's alert definitions", Handler: apiUpdateAlerts, Request: updateAlertsRequest{}},
+	{Method: "GET", Path: "/api/getAlerts", Tag: "rules", Summary: "Get a rule's alert definitions and state", Handler: apiGetAlerts, Query: []apiParam{ruleIDParam}},
+	{Method: "GET", Path: "/api/getWatchdog", Tag: "rules", Summary: "Get a rule's watchdog configuration and state", Handler: apiGetWatchdog, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateWatchdog", Tag: "rules", Summary: "Set or remove a rule's watchdog", Handler: apiUpdateWatchdog, Request: updateWatchdogRequest{}},
+	{Method: "GET", Path: "/api/getEmulation", Tag: "rules", Summary: "Get a rule's network emulation settings", Handler: apiGetEmulation, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateEmulation", Tag: "rules", Summary: "Set or remove a rule's network emulation", Handler: apiUpdateEmulation, Request: updateEmulationRequest{}},
+	{Method: "GET", Path: "/api/getACL", Tag: "rules", Summary: "Get a rule's allow and deny lists", Handler: apiGetACL, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateACL", Tag: "rules", Summary: "Set a rule's allow and deny CIDR lists", Handler: apiUpdateACL, Request: updateACLRequest{}},
+	{Method: "GET", Path: "/api/getTLSTarget", Tag: "rules", Summary: "Get a rule's TLS target settings", Handler: apiGetTLSTarget, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateTLSTarget", Tag: "rules", Summary: "Set or remove a rule's TLS target settings", Handler: apiUpdateTLSTarget, Request: updateTLSTargetRequest{}},
+	{Method: "GET", Path: "/api/getUDPRelay", Tag: "rules", Summary: "Get a rule's UDP broadcast/multicast relay settings", Handler: apiGetUDPRelay, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateUDPRelay", Tag: "rules", Summary: "Set or remove a rule's UDP broadcast/multicast relay settings", Handler: apiUpdateUDPRelay, Request: updateUDPRelayRequest{}},
+	{Method: "POST", Path: "/api/updateTargets", Tag: "rules", Summary: "Set a rule's extra targets and load balancing (TCP only)", Handler: apiUpdateTargets, Request: updateTargetsRequest{}},
+	{Method: "POST", Path: "/api/updateRoutes", Tag: "rules", Summary: "Set a rule's routing table by TLS SNI, HTTP Host or leading bytes (TCP only)", Handler: apiUpdateRoutes, Request: updateRoutesRequest{}},
+	{Method: "GET", Path: "/api/getHealth", Tag: "rules", Summary: "Get target health of rules with health checks", Handler: apiGetHealth, Query: []apiParam{ruleIDFilterParam}, Response: []RuleHealth{}},
+	{Method: "POST", Path: "/api/updateHealthCheck", Tag: "rules", Summary: "Set or remove a rule's health check", Handler: apiUpdateHealthCheck, Request: updateHealthCheckRequest{}},
+	{Method: "POST", Path: "/api/updateDialRetry", Tag: "rules", Summary: "Set or remove a rule's dial retry", Handler: apiUpdateDialRetry, Request: updateDialRetryRequest{}},
+	{Method: "POST", Path: "/api/updateRuleSSHHost", Tag: "rules", Summary: "Reach a rule's targets through an SSH jump host (empty sshHost to connect directly)", Handler: apiUpdateRuleSSHHost, Request: updateRuleSSHHostRequest{}},
+	{Method: "POST", Path: "/api/updateRuleVia", Tag: "rules", Summary: "Reach a rule's targets through a chain of relay nodes in order (empty via to connect directly)", Handler: apiUpdateRuleVia, Request: updateRuleViaRequest{}},
+	{Method: "POST", Path: "/api/updateOutboundBind", Tag: "rules", Summary: "Set the interface or source IP used to connect to a rule's targets (null bind for the default route)", Handler: apiUpdateOutboundBind, Request: updateOutboundBindRequest{}},
+	{Method: "POST", Path: "/api/updateTCPTuning", Tag: "rules", Summary: "Set a rule's TCP keepalive, TCP_NODELAY and dial timeout", Handler: apiUpdateTCPTuning, Request: updateTCPTuningRequest{}},
+	{Method: "GET", Path: "/api/getTransparentSupport", Tag: "rules", Summary: "Check whether transparent proxying is available", Handler: apiGetTransparentSupport},
+	{Method: "POST", Path: "/api/updateTransparent", Tag: "rules", Summary: "Turn transparent proxying of a rule on or off (TCP only)", Handler: apiUpdateTransparent, Request: ruleToggleRequest{}},
+	{Method: "POST", Path: "/api/updateConnLimits", Tag: "rules", Summary: "Set a rule's idle timeout, maximum connection lifetime and UDP session timeout", Handler: apiUpdateConnLimits, Request: updateConnLimitsRequest{}},
+	{Method: "POST", Path: "/api/updateMaxConns", Tag: "rules", Summary: "Set a rule's concurrent connection limit", Handler: apiUpdateMaxConns, Request: updateMaxConnsRequest{}},
+	{Method: "POST", Path: "/api/updateSchedule", Tag: "rules", Summary: "Set or remove a rule's schedule", Handler: apiUpdateSchedule, Request: updateScheduleRequest{}},
+	{Method: "POST", Path: "/api/updateAutoStop", Tag: "rules", Summary: "Stop a rule automatically after a number of idle minutes", Handler: apiUpdateAutoStop, Request: updateAutoStopRequest{}},
+	{Method: "POST", Path: "/api/updatePortMapping", Tag: "rules", Summary: "Turn router port mapping (UPnP/NAT-PMP) of a rule on or off", Handler: apiUpdatePortMapping, Request: ruleToggleRequest{}},
+	{Method: "GET", Path: "/api/getSOCKS5", Tag: "rules", Summary: "Get a rule's SOCKS5 authentication, without the password", Handler: apiGetSOCKS5, Query: []apiParam{ruleIDParam}},
+	{Method: "POST", Path: "/api/updateSOCKS5", Tag: "rules", Summary: "Set or remove a rule's SOCKS5 authentication", Handler: apiUpdateSOCKS5, Request: updateSOCKS5Request{}},
+	{Method: "POST", Path: "/api/updateShareSchemes", Tag: "rules", Summary: "Set the URL schemes (http, https, rdp, vnc...) getShareInfo lists for a rule", Handler: apiUpdateShareSchemes, Request: updateShareSchemesRequest{}},
+	{Method: "POST", Path: "/api/updateQRCode", Tag: "rules", Summary: "Set the scheme and path of a rule's QR code", Handler: apiUpdateQRCode, Request: updateQRCodeRequest{}},
+
+	// v2：按规则ID操作
+	{Method: "GET", Path: "/api/v2/rules", Tag: "rules", Summary: "List rules with their running protocols", Handler: apiV2Rules, Response: []RuleStatus{}},
+	{Method: "GET", Path: "/api/v2/rules/{id}", Tag: "rules", Summary: "Get a rule with its running protocols", Handler: apiV2Rule, Params: []apiParam{ruleIDPathParam}, Response: RuleStatus{}},
+	{Method: "POST", Path: "/api/v2/rules/{id}/start", Tag: "forwards", Summary: "Start a rule's forwards by rule ID (TCP and UDP by default)", Handler: apiV2StartRule, Params: []apiParam{ruleIDPathParam}, Request: ruleActionRequest{}, Optional: true, Response: RuleActionResult{}},
+	{Method: "POST", Path: "/api/v2/rules/{id}/stop", Tag: "forwards", Summary: "Stop a rule's forwards by rule ID (every running protocol by default)", Handler: apiV2StopRule, Params: []apiParam{ruleIDPathParam}, Request: ruleActionRequest{}, Optional: true, Response: RuleActionResult{}},
+
+	// 转发
+	{Method: "POST", Path: "/api/startTCPForward", Tag: "forwards", Summary: "Start a TCP forward", Handler: apiStartTCPForward, Request: forwardRequest{}},
+	{Method: "POST", Path: "/api/stopTCPForward", Tag: "forwards", Summary: "Stop a TCP forward, optionally draining existing connections", Handler: apiStopTCPForward, Request: stopTCPForwardRequest{}},
+	{Method: "GET", Path: "/api/isTCPRunning", Tag: "forwards", Summary: "Check whether a TCP forward is running", Handler: apiIsTCPRunning, Query: []apiParam{listenAddrParam, listenPortParam, targetAddrParam, targetPortParam}},
+	{Method: "POST", Path: "/api/startUDPForward", Tag: "forwards", Summary: "Start a UDP forward", Handler: apiStartUDPForward, Request: forwardRequest{}},
+	{Method: "POST", Path: "/api/stopUDPForward", Tag: "forwards", Summary: "Stop a UDP forward", Handler: apiStopUDPForward, Request: listenRequest{}},
+	{Method: "GET", Path: "/api/isUDPRunning", Tag: "forwards", Summary: "Check whether a UDP forward is running", Handler: apiIsUDPRunning, Query: []apiParam{listenAddrParam, listenPortParam, targetAddrParam, targetPortParam}},
+	{Method: "POST", Path: "/api/startSCTPForward", Tag: "forwards", Summary: "Start an SCTP forward", Handler: apiStartSCTPForward, Request: forwardRequest{}},
+	{Method: "POST", Path: "/api/stopSCTPForward", Tag: "forwards", Summary: "Stop an SCTP forward", Handler: apiStopSCTPForward, Request: listenRequest{}},
+	{Method: "GET", Path: "/api/isSCTPRunning", Tag: "forwards", Summary: "Check whether an SCTP forward is running and SCTP is supported", Handler: apiIsSCTPRunning, Query: []apiParam{listenAddrParam, listenPortParam, targetAddrParam, targetPortParam}},
+	{Method: "POST", Path: "/api/startSOCKS5Forward", Tag: "forwards", Summary: "Start a SOCKS5 proxy on a rule's listen address", Handler: apiStartSOCKS5Forward, Request: listenRequest{}},
+	{Method: "POST", Path: "/api/stopSOCKS5Forward", Tag: "forwards", Summary: "Stop a SOCKS5 proxy", Handler: apiStopSOCKS5Forward, Request: listenRequest{}},
+	{Method: "GET", Path: "/api/isSOCKS5Running", Tag: "forwards", Summary: "Check whether a SOCKS5 proxy is running", Handler: apiIsSOCKS5Running, Query: []apiParam{listenAddrParam, listenPortParam}},
+	{Method: "POST", Path: "/api/startAllForwards", Tag: "forwards", Summary: "Start forwards of all rules (TCP and UDP by default)", Handler: apiStartAllForwards, Request: bulkForwardRequest{}, Optional: true},
+	{Method: "POST", Path: "/api/stopAllForwards", Tag: "forwards", Summary: "Stop all running forwards", Handler: apiStopAllForwards, Request: bulkForwardRequest{}, Optional: true},
+	{Method: "GET", Path: "/api/getDrains", Tag: "forwards", Summary: "List forwards that are draining", Handler: apiGetDrains, Response: []forward.DrainStatus{}},
+	{Method: "GET", Path: "/api/getConnections", Tag: "forwards", Summary: "List active TCP and SOCKS5 connections", Handler: apiGetConnections, Query: []apiParam{ruleIDFilterParam}, Response: []forward.ConnInfo{}},
+	{Method: "POST", Path: "/api/killConnection", Tag: "forwards", Summary: "Close an active connection", Handler: apiKillConnection, Request: killConnectionRequest{}},
+	{Method: "GET", Path: "/api/getRestoreReport", Tag: "forwards", Summary: "List forwards that failed to restore on startup", Handler: apiGetRestoreReport},
+	{Method: "POST", Path: "/api/dismissRestoreReport", Tag: "forwards", Summary: "Clear the restore failure report", Handler: apiDismissRestoreReport},
+	{Method: "POST", Path: "/api/replay", Tag: "forwards", Summary: "Replay captured traffic through a running forward", Handler: apiReplay, Query: []apiParam{
+		ruleIDParam,
+		{Name: "protocol", Description: "tcp (default) or udp"},
+		{Name: "speed", Description: "Playback speed; 0 replays as fast as possible"},
+		{Name: "port", Description: "Only replay packets to or from this port"},
+		{Name: "source", Description: "capture to replay the rule's own capture file instead of the request body"},
+	}, Request: []byte{}, Consumes: "application/vnd.tcpdump.pcap"},
+	{Method: "GET", Path: "/api/getCapture", Tag: "forwards", Summary: "Get a rule's capture settings and capture file status", Handler: apiGetCapture, Query: []apiParam{ruleIDParam}, Response: CaptureStatus{}},
+	{Method: "POST", Path: "/api/updateCapture", Tag: "forwards", Summary: "Enable or disable capturing a rule's relayed traffic to a pcap or hex dump file", Handler: apiUpdateCapture, Request: updateCaptureRequest{}},
+	{Method: "GET", Path: "/api/downloadCapture", Tag: "forwards", Summary: "Download a rule's capture file", Handler: apiDownloadCapture, Query: []apiParam{ruleIDParam}, Produces: "application/vnd.tcpdump.pcap"},
+	{Method: "GET", Path: "/api/getReplay", Tag: "forwards", Summary: "Get the status of a rule's latest replay", Handler: apiGetReplay, Query: []apiParam{ruleIDParam}, Response: ReplayStatus{}},
+
+	// 模板
+	{Method: "GET", Path: "/api/getTemplates", Tag: "templates", Summary: "List templates", Handler: apiGetTemplates, Response: []Template{}},
+	{Method: "POST", Path: "/api/saveAsTemplate", Tag: "templates", Summary: "Save rules as a new template", Handler: apiSaveAsTemplate, Request: saveAsTemplateRequest{}},
+	{Method: "POST", Path: "/api/applyTemplate", Tag: "templates", Summary: "Get the rules of a template", Handler: apiApplyTemplate, Request: nameRequest{}},
+	{Method: "POST", Path: "/api/updateTemplate", Tag: "templates", Summary: "Rename a template or change its description and rules", Handler: apiUpdateTemplate, Request: updateTemplateRequest{}},
+	{Method: "POST", Path: "/api/deleteTemplate", Tag: "templates", Summary: "Delete a template", Handler: apiDeleteTemplate, Request: nameRequest{}},
+	{Method: "POST", Path: "/api/startTemplateForward", Tag: "templates", Summary: "Start all forwards of a template", Handler: apiStartTemplateForward, Request: startTemplateRequest{}},
+	{Method: "POST", Path: "/api/stopTemplateForward", Tag: "templates", Summary: "Stop all forwards of a template", Handler: apiStopTemplateForward, Request: nameRequest{}},
+	{Method: "GET", Path: "/api/validateTemplate", Tag: "templates", Summary: "Check whether a template's forwards can start", Handler: apiValidateTemplate, Query: []apiParam{templateParam}, Response: TemplateCheck{}},
+	{Method: "POST", Path: "/api/validateTemplate", Tag: "templates", Summary: "Check whether a template's forwards can start", Handler: apiValidateTemplate, Request: nameRequest{}, Response: TemplateCheck{}},
+	{Method: "GET", Path: "/api/getTemplateStartup", Tag: "templates", Summary: "Get a template's startup order and the progress of its latest start", Handler: apiGetTemplateStartup, Query: []apiParam{templateParam}},
+	{Method: "POST", Path: "/api/updateTemplateStartup", Tag: "templates", Summary: "Set a template's startup order, delays and dependencies", Handler: apiUpdateTemplateStartup, Request: updateTemplateStartupRequest{}},
+	{Method: "POST", Path: "/api/updateTemplateRuleScope", Tag: "templates", Summary: "Turn a template rule into a private copy or add it to the global rules", Handler: apiUpdateTemplateRuleScope, Request: updateTemplateRuleScopeRequest{}},
+	{Method: "GET", Path: "/api/exportTemplate", Tag: "templates", Summary: "Download a template and its rules", Handler: apiExportTemplate, Query: []apiParam{templateParam}, Response: TemplateBundle{}},
+	{Method: "POST", Path: "/api/importTemplate", Tag: "templates", Summary: "Import a template exported by exportTemplate", Handler: apiImportTemplate, Query: []apiParam{dryRunParam, {Name: "name", Description: "Name of the imported template"}}, Request: TemplateBundle{}, Response: ConfigImportResult{}},
+	{Method: "GET", Path: "/api/getDefaultTemplate", Tag: "templates", Summary: "Get the template started on launch", Handler: apiGetDefaultTemplate},
+	{Method: "POST", Path: "/api/setDefaultTemplate", Tag: "templates", Summary: "Set or clear the template started on launch", Handler: apiSetDefaultTemplate, Request: nameRequest{}},
+
+	// 统计
+	{Method: "GET", Path: "/api/getStats", Tag: "stats", Summary: "Get traffic counters of rules", Handler: apiGetStats, Query: []apiParam{ruleIDFilterParam}, Response: []RuleStats{}},
+	{Method: "GET", Path: "/api/getStatsHistory", Tag: "stats", Summary: "Get the traffic history of rules", Handler: apiGetStatsHistory, Query: []apiParam{ruleIDFilterParam}, Response: map[string][]StatsPoint{}},
+	{Method: "GET", Path: "/api/getCountryStats", Tag: "stats", Summary: "Get a rule's connections and traffic by country", Handler: apiGetCountryStats, Query: []apiParam{ruleIDParam}},
+	{Method: "GET", Path: "/api/getAnomalies", Tag: "stats", Summary: "List recent traffic anomalies", Handler: apiGetAnomalies, Query: []apiParam{ruleIDFilterParam}},
+	{Method: "GET", Path: "/api/getResourceUsage", Tag: "stats", Summary: "Get process resource usage and limits", Handler: apiGetResourceUsage, Response: ResourceUsage{}},
+	{Method: "GET", Path: "/api/grafanaDashboard", Tag: "stats", Summary: "Download the Grafana dashboard for /metrics", Handler: apiGrafanaDashboard},
+
+	// 网络
+	{Method: "GET", Path: "/api/getLocalIPs", Tag: "network", Summary: "List local interface addresses", Handler: apiGetLocalIPs, Response: []IPInfo{}},
+	{Method: "GET", Path: "/api/resolvePort", Tag: "network", Summary: "Resolve a port or service name to a port number", Handler: apiResolvePort, Query: []apiParam{{Name: "port", Description: "Port or service name", Required: true}}},
+	{Method: "GET", Path: "/api/discoverServices", Tag: "network", Summary: "List local TCP services with forwarding suggestions", Handler: apiDiscoverServices},
+	{Method: "GET", Path: "/api/scanLAN", Tag: "network", Summary: "Scan the local network for devices", Handler: apiScanLAN},
+	{Method: "GET", Path: "/api/getHostname", Tag: "network", Summary: "Look up the host name of a client IP", Handler: apiGetHostname, Query: []apiParam{{Name: "ip", Description: "Client IP", Required: true}}},
+	{Method: "GET", Path: "/api/geoLookup", Tag: "network", Summary: "Look up GeoIP information of an IP", Handler: apiGeoLookup, Query: []apiParam{{Name: "ip", Description: "IP address", Required: true}}, Response: GeoInfo{}},
+	{Method: "GET", Path: "/api/getSystemPorts", Tag: "network", Summary: "List ports used by other processes", Handler: apiGetSystemPorts, Query: []apiParam{{Name: "protocol", Description: "tcp or udp; both when empty"}}},
+	{Method: "GET", Path: "/api/getFreePort", Tag: "network", Summary: "Find a free port in a range", Handler: apiGetFreePort, Query: []apiParam{
+		{Name: "protocol", Description: "tcp (default) or udp"},
+		{Name: "start", Description: "First port of the range (default 1024)"},
+		{Name: "end", Description: "Last port of the range (default 65535)"},
+		{Name: "listenAddr", Description: "Address the port must be free on"},
+	}},
+	{Method: "GET", Path: "/api/getPortMappings", Tag: "network", Summary: "List router port mappings", Handler: apiGetPortMappings, Response: []PortMapping{}},
+	{Method: "GET", Path: "/api/getPublicIP", Tag: "network", Summary: "Get the detected public IP", Handler: apiGetPublicIP, Query: []apiParam{{Name: "refresh", Description: "1 to ignore the cached address"}}},
+	{Method: "GET", Path: "/api/getShareInfo", Tag: "network", Summary: "Get a listen address as ip:port, URLs and the QR code payload", Handler: apiGetShareInfo, Query: []apiParam{
+		{Name: "ruleId", Description: "Rule ID; or give listenAddr and listenPort"},
+		{Name: "listenAddr", Description: "Listen address"},
+		{Name: "listenPort", Description: "Listen port"},
+		{Name: "public", Description: "1 to use the public IP"},
+	}, Response: ShareInfo{}},
+	{Method: "GET", Path: "/api/getQRCode", Tag: "network", Summary: "Render the QR code of a listen address", Handler: apiGetQRCode, Query: []apiParam{
+		listenAddrParam,
+		listenPortParam,
+		{Name: "public", Description: "1 to use the public IP"},
+		{Name: "scheme", Description: "URL scheme prefix"},
+		{Name: "path", Description: "Path and query appended to the address"},
+	}, Produces: "image/png"},
+
+	// 黑名单
+	{Method: "GET", Path: "/api/getBlocklists", Tag: "blocklists", Summary: "List blocklist subscriptions", Handler: apiGetBlocklists, Response: []Blocklist{}},
+	{Method: "POST", Path: "/api/saveBlocklist", Tag: "blocklists", Summary: "Add or update a blocklist subscription", Handler: apiSaveBlocklist, Request: Blocklist{}},
+	{Method: "POST", Path: "/api/deleteBlocklist", Tag: "blocklists", Summary: "Delete a blocklist subscription", Handler: apiDeleteBlocklist, Request: idRequest{}},
+	{Method: "POST", Path: "/api/refreshBlocklist", Tag: "blocklists", Summary: "Download a blocklist now", Handler: apiRefreshBlocklist, Request: idRequest{}},
+
+	// 代理：其他实例以 -agent-controller 向本实例报告
+	{Method: "GET", Path: "/api/agents", Tag: "agents", Summary: "List agents that report to this instance, with their rules and recent command results", Handler: apiGetAgents, Response: []AgentStatus{}},
+	{Method: "POST", Path: "/api/agentCommand", Tag: "agents", Summary: "Queue a start, stop, add, update or delete command for an agent", Handler: apiAgentCommand, Request: agentCommandRequest{}},
+	{Method: "POST", Path: "/api/deleteAgent", Tag: "agents", Summary: "Forget an agent until it reports again", Handler: apiDeleteAgent, Request: nameRequest{}},
+
+	// 配置
+	{Method: "GET", Path: "/api/exportConfig", Tag: "config", Summary: "Download the full configuration", Handler: apiExportConfig, Query: []apiParam{
+		{Name: "format", Description: "json (default) or yaml"},
+		{Name: "includeAuth", Description: "1 to include the login settings and TOTP secret"},
+		{Name: "includeSecrets", Description: "1 to include the API token and SSH host and relay node secrets in plain text"},
+	}, Response: AppData{}},
+	{Method: "POST", Path: "/api/importConfig", Tag: "config", Summary: "Import a configuration exported by exportConfig (JSON or YAML)", Handler: apiImportConfig, Query: []apiParam{
+		{Name: "mode", Description: "merge (default) or replace"},
+		{Name: "onConflict", Description: "rename (default), skip or overwrite"},
+		dryRunParam,
+	}, Request: AppData{}, Response: ConfigImportResult{}},
+	{Method: "POST", Path: "/api/importFrom", Tag: "config", Summary: "Import rules from an frp or gost configuration file", Handler: apiImportFrom, Query: []apiParam{
+		{Name: "format", Description: "frp or gost", Required: true},
+		dryRunParam,
+	}, Request: "", Consumes: "text/plain"},
+	{Method: "GET", Path: "/api/exportTo", Tag: "config", Summary: "Export rules as an frp or gost configuration file", Handler: apiExportTo, Query: []apiParam{
+		{Name: "format", Description: "frp or gost", Required: true},
+		{Name: "ids", Description: "Comma-separated rule IDs; all rules when empty"},
+	}, Response: "", Produces: "text/plain"},
+	{Method: "GET", Path: "/api/getBackups", Tag: "config", Summary: "List backups of the data file", Handler: apiGetBackups, Response: []BackupInfo{}},
+	{Method: "POST", Path: "/api/restoreBackup", Tag: "config", Summary: "Replace the configuration with a backup", Handler: apiRestoreBackup, Request: nameRequest{}},
+	{Method: "GET", Path: "/api/getSettings", Tag: "config", Summary: "Get the settings and which of them are overridden by flags", Handler: apiGetSettings},
+	{Method: "POST", Path: "/api/updateSettings", Tag: "config", Summary: "Update settings; omitted fields are kept", Handler: apiUpdateSettings, Request: Settings{}},
+	{Method: "GET", Path: "/api/sshHosts", Tag: "config", Summary: "List SSH jump hosts without their credentials", Handler: apiGetSSHHosts, Response: []SSHHostStatus{}},
+	{Method: "POST", Path: "/api/updateSSHHost", Tag: "config", Summary: "Add an SSH jump host (empty id) or update one; credentials are stored encrypted", Handler: apiUpdateSSHHost, Request: updateSSHHostRequest{}},
+	{Method: "POST", Path: "/api/deleteSSHHost", Tag: "config", Summary: "Delete an SSH jump host that no rule uses", Handler: apiDeleteSSHHost, Request: idRequest{}},
+	{Method: "GET", Path: "/api/relayNodes", Tag: "config", Summary: "List relay nodes (other go-ports instances) without their tokens", Handler: apiGetRelayNodes, Response: []RelayNodeStatus{}},
+	{Method: "POST", Path: "/api/updateRelayNode", Tag: "config", Summary: "Add a relay node (empty id) or update one; the token is stored encrypted", Handler: apiUpdateRelayNode, Request: updateRelayNodeRequest{}},
+	{Method: "POST", Path: "/api/deleteRelayNode", Tag: "config", Summary: "Delete a relay node that no rule uses", Handler: apiDeleteRelayNode, Request: idRequest{}},
+	{Method: "GET", Path: "/api/profiles", Tag: "config", Summary: "List environment profiles, the active one and the variables rules reference", Handler: apiGetProfiles},
+	{Method: "POST", Path: "/api/updateProfile", Tag: "config", Summary: "Add a profile (empty oldName), or update or rename one", Handler: apiUpdateProfile, Request: updateProfileRequest{}},
+	{Method: "POST", Path: "/api/deleteProfile", Tag: "config", Summary: "Delete a profile that is not active and no template uses", Handler: apiDeleteProfile, Request: nameRequest{}},
+	{Method: "POST", Path: "/api/setActiveProfile", Tag: "config", Summary: "Switch the profile that ${NAME} variables in rule targets resolve from; running forwards are restarted", Handler: apiSetActiveProfile, Request: nameRequest{}},
+
+	// 日志
+	{Method: "GET", Path: "/api/getLog", Tag: "logs", Summary: "Page through log entries", Handler: apiGetLog, Query: append(logFilterParams(),
+		apiParam{Name: "offset", Description: "Number of newest entries to skip"},
+		apiParam{Name: "limit", Description: "Page size"},
+	)},
+	{Method: "GET", Path: "/api/logStream", Tag: "logs", Summary: "Stream log entries as Server-Sent Events", Handler: apiLogStream, Query: append(logFilterParams(),
+		apiParam{Name: "tail", Description: "Number of recent entries to send first"},
+	), Produces: "text/event-stream"},
+	{Method: "GET", Path: "/api/notifyStream", Tag: "logs", Summary: "Stream notifications, such as network address changes and rebound forwards, as Server-Sent Events", Handler: apiNotifyStream, Produces: "text/event-stream"},
+}
+
+// logFilterParams getLog 与 logStream 共用的筛选参数
+func logFilterParams() []apiParam {
+	return []apiParam{
+		{Name: "level", Description: "Minimum level: debug, info, warn or error"},
+		{Name: "rule", Description: "Rule ID"},
+		{Name: "module", Description: "Module name"},
+	}
+}
+
+// apiPathKey 保存路径参数的 context 键
+type apiPathKey struct{}
+
+// pathParam 返回路径中的参数，如 /api/v2/rules/{id}/start 中的 id
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(apiPathKey{}).(map[string]string)
+	return params[name]
+}
+
+// matchPath 按模板匹配路径，模板中 {name} 匹配一个非空的路径段
+func matchPath(pattern, path string) (map[string]string, bool) {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(path, "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if got[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = got[i]
+			continue
+		}
+		if segment != got[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// apiPath 同一路径模板下按方法登记的处理函数
+type apiPath struct {
+	pattern  string
+	handlers map[string]http.HandlerFunc
+	allow    string
+}
+
+// serve 按方法分派请求，未登记的方法返回 405 并在 Allow 中列出支持的方法；GET 接口同时接受 HEAD
+func (p *apiPath) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	handler, ok := p.handlers[method]
+	if !ok {
+		w.Header().Set("Allow", p.allow)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	handler(w, r)
+}
+
+// registerAPIRoutes 注册 apiRoutes 中的接口。同一路径可按方法登记多个处理函数；
+// 带 {参数} 的路径按参数前的前缀注册，请求时逐个匹配模板，参数用 pathParam 读取
+func registerAPIRoutes() {
+	var paths []*apiPath
+	byPattern := make(map[string]*apiPath)
+	for _, route := range apiRoutes {
+		p := byPattern[route.Path]
+		if p == nil {
+			p = &apiPath{pattern: route.Path, handlers: make(map[string]http.HandlerFunc)}
+			byPattern[route.Path] = p
+			paths = append(paths, p)
+		}
+		p.handlers[route.Method] = route.Handler
+	}
+
+	byPrefix := make(map[string][]*apiPath)
+	var prefixes []string
+	for _, p := range paths {
+		var methods []string
+		for method := range p.handlers {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		p.allow = strings.Join(methods, ", ")
+
+		if i := strings.Index(p.pattern, "{"); i >= 0 {
+			prefix := p.pattern[:i]
+			if byPrefix[prefix] == nil {
+				prefixes = append(prefixes, prefix)
+			}
+			byPrefix[prefix] = append(byPrefix[prefix], p)
+			continue
+		}
+		http.HandleFunc(p.pattern, p.serve)
+	}
+
+	for _, prefix := range prefixes {
+		candidates := byPrefix[prefix]
+		http.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range candidates {
+				if params, ok := matchPath(p.pattern, r.URL.Path); ok {
+					p.serve(w, r.WithContext(context.WithValue(r.Context(), apiPathKey{}, params)))
+					return
+				}
+			}
+			http.NotFound(w, r)
+		})
+	}
+	http.HandleFunc("/api/openapi.json", apiOpenAPI)
+}
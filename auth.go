@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookie = "goports_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+// authState 登录状态
+var authState = struct {
+	sync.Mutex
+	settings      AuthSettings
+	pendingSecret string               // 已生成、尚未确认的 TOTP 密钥
+	lastCounter   uint64               // 最近一次通过的 TOTP 时间步，防止重放
+	sessions      map[string]time.Time // 会话令牌 -> 过期时间
+}{
+	sessions: make(map[string]time.Time),
+}
+
+// loadAuth 加载登录设置
+func loadAuth() {
+	settings, err := storage.LoadAuth()
+	if err != nil {
+		log.Printf("Failed to load auth settings: %v", err)
+		return
+	}
+
+	authState.Lock()
+	authState.settings = settings
+	authState.Unlock()
+
+	if loginEnabled() {
+		log.Printf("Login required for management UI (TOTP: %v)", settings.TOTPEnabled)
+	}
+}
+
+// loginEnabled 是否设置了管理界面密码
+func loginEnabled() bool {
+	return *uiPassword != ""
+}
+
+// publicPaths 未登录也可访问的路径
+var publicPaths = map[string]bool{
+	"/login":      true,
+	"/api/login":  true,
+	"/api/logout": true,
+
+	agentReportPath: true, // 代理以令牌自行认证
+
+	"/static/i18n.js": true, // 登录页面的多语言
+}
+
+// requireLogin 登录校验中间件，未启用密码时直接放行。已通过令牌或 basic 认证的请求（如命令行与脚本）
+// 不需要会话
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !loginEnabled() || publicPaths[r.URL.Path] || publicMetrics(r) || validSession(r) || apiAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.URL.Path == "/" {
+			// 使用相对地址，在反向代理的路径前缀下同样有效（http.Redirect 会改写为绝对路径）
+			w.Header().Set("Location", "login")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// validSession 检查请求是否携带有效会话
+func validSession(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+
+	authState.Lock()
+	defer authState.Unlock()
+
+	expires, ok := authState.sessions[cookie.Value]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(authState.sessions, cookie.Value)
+		return false
+	}
+	return true
+}
+
+// newSession 创建会话令牌
+func newSession() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	authState.Lock()
+	defer authState.Unlock()
+
+	now := time.Now()
+	for t, expires := range authState.sessions {
+		if now.After(expires) {
+			delete(authState.sessions, t)
+		}
+	}
+	authState.sessions[token] = now.Add(sessionTTL)
+	return token, nil
+}
+
+// loginRequest apiLogin 的请求体
+type loginRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// apiLogin 校验密码及验证码并创建会话
+func apiLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	type loginResult struct {
+		Success      bool   `json:"success"`
+		Error        string `json:"error,omitempty"`
+		TOTPRequired bool   `json:"totpRequired,omitempty"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if !loginEnabled() {
+		json.NewEncoder(w).Encode(loginResult{Success: true})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.Password), []byte(*uiPassword)) != 1 {
+		log.Printf("Failed login from %s: wrong password", r.RemoteAddr)
+		writeJSON(w, http.StatusUnauthorized, loginResult{Success: false, Error: "密码错误"})
+		return
+	}
+
+	authState.Lock()
+	if authState.settings.TOTPEnabled {
+		if req.Code == "" {
+			authState.Unlock()
+			writeJSON(w, http.StatusUnauthorized, loginResult{Success: false, Error: "请输入验证码", TOTPRequired: true})
+			return
+		}
+		counter, ok := verifyTOTP(authState.settings.TOTPSecret, req.Code, authState.lastCounter)
+		if !ok {
+			authState.Unlock()
+			log.Printf("Failed login from %s: wrong TOTP code", r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, loginResult{Success: false, Error: "验证码错误", TOTPRequired: true})
+			return
+		}
+		authState.lastCounter = counter
+	}
+	authState.Unlock()
+
+	token, err := newSession()
+	if err != nil {
+		log.Printf("Failed to create session: %v", err)
+		writeJSON(w, http.StatusInternalServerError, loginResult{Success: false, Error: err.Error()})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	log.Printf("Login from %s", r.RemoteAddr)
+	json.NewEncoder(w).Encode(loginResult{Success: true})
+}
+
+// apiLogout 注销当前会话
+func apiLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		authState.Lock()
+		delete(authState.sessions, cookie.Value)
+		authState.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// serveLogin 登录页面
+func serveLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(injectLanguage(strings.TrimSpace(loginHTML), requestLanguage(r))))
+}
+
+const loginHTML = `
+<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>登录 - Port Forwarder</title>
+    <style>
+        body { font-family: Arial, sans-serif; background-color: #f5f5f5; }
+        .login { width: 320px; margin: 120px auto; background: white; padding: 24px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0, 0, 0, 0.1); }
+        .login h2 { margin-top: 0; color: #333; }
+        .login input { width: 100%; box-sizing: border-box; padding: 8px; margin: 6px 0 12px; border: 1px solid #ddd; border-radius: 4px; }
+        .login button { width: 100%; padding: 8px; border: none; border-radius: 4px; background-color: #1890ff; color: white; cursor: pointer; }
+        .error { color: #ff4d4f; min-height: 20px; }
+    </style>
+</head>
+<body>
+    <form class="login" onsubmit="login(event)">
+        <h2>端口转发工具</h2>
+        <label>密码</label>
+        <input type="password" id="password" autofocus>
+        <div id="codeRow" style="display: none;">
+            <label>两步验证码</label>
+            <input type="text" id="code" inputmode="numeric" autocomplete="one-time-code" maxlength="6">
+        </div>
+        <div class="error" id="error"></div>
+        <button type="submit">登录</button>
+    </form>
+    <script src="static/i18n.js"></script>
+    <script>
+        function login(e) {
+            e.preventDefault();
+            fetch('api/login', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    password: document.getElementById('password').value,
+                    code: document.getElementById('code').value
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    location.href = './';
+                    return;
+                }
+                if (data.totpRequired) {
+                    document.getElementById('codeRow').style.display = 'block';
+                    document.getElementById('code').focus();
+                }
+                document.getElementById('error').textContent = data.error;
+            });
+        }
+    </script>
+</body>
+</html>
+`
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// autoStopInterval 检查无流量规则的间隔
+const autoStopInterval = 15 * time.Second
+
+// maxAutoStopMinutes 无流量自动停止的最长等待（7天）
+const maxAutoStopMinutes = 7 * 24 * 60
+
+// validateAutoStop 校验无流量自动停止的分钟数，0 为不自动停止
+func validateAutoStop(minutes int) error {
+	if minutes < 0 || minutes > maxAutoStopMinutes {
+		return fmt.Errorf("auto-stop minutes must be between 0 and %d", maxAutoStopMinutes)
+	}
+	return nil
+}
+
+// autoStopActivity 规则上次有流量时的计数
+type autoStopActivity struct {
+	bytes int64
+	conns int64
+	since time.Time // 计数最后一次变化的时间
+}
+
+// autoStopState 各规则的活动记录，规则停止后清除
+var autoStopState = struct {
+	sync.Mutex
+	rules map[string]*autoStopActivity
+}{rules: make(map[string]*autoStopActivity)}
+
+// startAutoStop 启动无流量自动停止循环
+func startAutoStop() {
+	go func() {
+		ticker := time.NewTicker(autoStopInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			checkAutoStop(now)
+		}
+	}()
+}
+
+// checkAutoStop 停止连续 AutoStopMinutes 分钟没有传输数据也没有新连接的规则。
+// 只停止一次，之后手动开启时重新计时
+func checkAutoStop(now time.Time) {
+	for _, rule := range ruleStore.Rules() {
+		total, running := ruleTotals(rule)
+		if rule.AutoStopMinutes <= 0 || !running {
+			autoStopState.Lock()
+			delete(autoStopState.rules, rule.ID)
+			autoStopState.Unlock()
+			continue
+		}
+
+		bytes := total.BytesIn + total.BytesOut
+		autoStopState.Lock()
+		a, ok := autoStopState.rules[rule.ID]
+		if !ok || a.bytes != bytes || a.conns != total.TotalConns {
+			autoStopState.rules[rule.ID] = &autoStopActivity{bytes: bytes, conns: total.TotalConns, since: now}
+			autoStopState.Unlock()
+			continue
+		}
+		idle := now.Sub(a.since)
+		expired := idle >= time.Duration(rule.AutoStopMinutes)*time.Minute
+		if expired {
+			delete(autoStopState.rules, rule.ID)
+		}
+		autoStopState.Unlock()
+
+		if expired {
+			autoStopRule(rule, idle)
+		}
+	}
+}
+
+// autoStopRule 停止规则所有正在运行的转发
+func autoStopRule(rule Rule, idle time.Duration) {
+	lg := newLogger("autostop").WithRule(rule.ID)
+	var stopped []string
+	for _, protocol := range runningProtocols(rule) {
+		if err := stopRuleForward(rule, protocol, sourceAutoStop); err != nil {
+			lg.Errorf("Auto-stop: failed to stop %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+			continue
+		}
+		stopped = append(stopped, strings.ToUpper(protocol))
+	}
+	if len(stopped) == 0 {
+		return
+	}
+
+	lg.Infof("Auto-stop: stopped %s forward of rule %s after %v without traffic", strings.Join(stopped, "/"), ruleDisplayName(rule), idle.Round(time.Second))
+	notify(Notification{
+		Event:   "autostop.stopped",
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("Auto-stopped %s", ruleDisplayName(rule)),
+		Message: fmt.Sprintf("stopped %s forward after %d minutes without traffic", strings.Join(stopped, "/"), rule.AutoStopMinutes),
+	})
+}
+
+// updateAutoStopRequest apiUpdateAutoStop 的请求体
+type updateAutoStopRequest struct {
+	RuleID  string `json:"ruleId"`
+	Minutes int    `json:"minutes"`
+}
+
+// apiUpdateAutoStop 设置规则无流量多少分钟后自动停止，0 为不自动停止。
+// 从设置时开始重新计时
+func apiUpdateAutoStop(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "auto-stop", func(req *updateAutoStopRequest, _ Rule) (func(rule *Rule), error) {
+		if err := validateAutoStop(req.Minutes); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.AutoStopMinutes = req.Minutes }, nil
+	})
+	if !ok {
+		return
+	}
+
+	autoStopState.Lock()
+	delete(autoStopState.rules, rule.ID)
+	autoStopState.Unlock()
+
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
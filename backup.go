@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+const (
+	backupPrefix      = "data-"
+	backupTimeFormat  = "20060102-150405"
+	minBackupInterval = time.Minute // 两次自动备份的最短间隔，避免频繁保存时挤掉较早的备份
+)
+
+// backupDir 保存 data.json 备份的目录
+var backupDir = filepath.Join(".", "db", "backups")
+
+// BackupInfo 一个 data.json 备份
+type BackupInfo struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// listBackups 列出所有备份，最新的在前
+func listBackups() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(backupDir)
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		t, ok := parseBackupName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: entry.Name(), Time: t, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// parseBackupName 从备份文件名解析备份时间，不是备份文件时返回 false
+func parseBackupName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, backupPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, ".json")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+	return t, err == nil
+}
+
+// backupDataFile 把当前的 data.json 复制到 db/backups，并删除超出 -backups 个数的旧备份。
+// force 为 false 时距上次备份不足 minBackupInterval 则跳过
+func backupDataFile(dataFile string, force bool) error {
+	if *maxBackups <= 0 {
+		return nil
+	}
+	data, err := os.ReadFile(dataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if !force && len(backups) > 0 && now.Sub(backups[0].Time) < minBackupInterval {
+		return nil
+	}
+
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+	name := backupPrefix + now.Format(backupTimeFormat) + ".json"
+	if err := store.WriteFileAtomic(filepath.Join(backupDir, name), data, 0644); err != nil {
+		return err
+	}
+
+	// 删除最旧的备份（列表不含刚写入的这一个，同名时已被覆盖）
+	keep := *maxBackups - 1
+	for i, backup := range backups {
+		if i < keep || backup.Name == name {
+			continue
+		}
+		if err := os.Remove(filepath.Join(backupDir, backup.Name)); err != nil {
+			log.Printf("Failed to remove old backup %s: %v", backup.Name, err)
+		}
+	}
+	return nil
+}
+
+// apiGetBackups 列出 data.json 的备份
+func apiGetBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := listBackups()
+	if err != nil {
+		log.Printf("Failed to list backups: %v", err)
+		http.Error(w, "Failed to list backups", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backups)
+}
+
+// apiRestoreBackup 以备份替换当前配置。恢复前会先备份当前配置，并停止所有正在运行的转发
+func apiRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req nameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(status int, err error) {
+		writeError(w, status, err.Error())
+	}
+
+	// 只接受备份目录中的文件名，防止读取任意路径
+	if _, ok := parseBackupName(req.Name); !ok || filepath.Base(req.Name) != req.Name {
+		fail(http.StatusBadRequest, fmt.Errorf("invalid backup name %q", req.Name))
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(backupDir, req.Name))
+	if err != nil {
+		fail(http.StatusNotFound, fmt.Errorf("failed to read backup: %w", err))
+		return
+	}
+	var appData AppData
+	if err := json.Unmarshal(data, &appData); err != nil {
+		fail(http.StatusInternalServerError, fmt.Errorf("backup is not valid: %w", err))
+		return
+	}
+	if appData.Rules == nil {
+		appData.Rules = []Rule{}
+	}
+	if appData.Templates == nil {
+		appData.Templates = []Template{}
+	}
+
+	// 先备份当前配置，恢复错了还能再恢复回来
+	if err := backupDataFile(storage.Path(), true); err != nil {
+		log.Printf("Failed to back up data file: %v", err)
+		fail(http.StatusInternalServerError, fmt.Errorf("failed to back up current configuration"))
+		return
+	}
+
+	stopped := []string{}
+	for _, rule := range ruleStore.Rules() {
+		for _, protocol := range runningProtocols(rule) {
+			if err := stopRuleForward(rule, protocol, requestSource(r)); err != nil {
+				log.Printf("Restore backup: failed to stop %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+				continue
+			}
+			stopped = append(stopped, protocol+" "+ruleDisplayName(rule))
+		}
+	}
+
+	if err := applyConfig(appData); err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("Restored configuration from backup %s", req.Name)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "stopped": stopped})
+}
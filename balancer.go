@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// maxTargets 一条规则最多的额外目标数
+const maxTargets = 32
+
+// validateTargets 检查额外目标与负载均衡方式，返回规范化后的目标列表
+func validateTargets(listenPort string, targets []string, balance string) ([]string, error) {
+	switch balance {
+	case "", forward.BalanceRoundRobin, forward.BalanceLeastConn:
+	default:
+		return nil, fmt.Errorf("unknown balance method %q, use %s or %s", balance, forward.BalanceRoundRobin, forward.BalanceLeastConn)
+	}
+
+	var list []string
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(target)
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("invalid target %q, use addr:port", target)
+		}
+		if port, err = resolvePort(port); err != nil {
+			return nil, fmt.Errorf("target %s: %w", target, err)
+		}
+		if forward.IsPortRange(port) {
+			return nil, fmt.Errorf("target %s: port ranges are not supported", target)
+		}
+		list = append(list, net.JoinHostPort(host, port))
+	}
+	if len(list) > maxTargets {
+		return nil, fmt.Errorf("at most %d additional targets are allowed", maxTargets)
+	}
+	if len(list) > 0 && forward.IsPortRange(listenPort) {
+		return nil, errors.New("additional targets are not supported with port ranges")
+	}
+	return list, nil
+}
+
+// updateTargetsRequest apiUpdateTargets 的请求体
+type updateTargetsRequest struct {
+	RuleID  string   `json:"ruleId"`
+	Targets []string `json:"targets"`
+	Balance string   `json:"balance"`
+}
+
+// apiUpdateTargets 设置规则的额外目标与负载均衡方式（仅TCP），targets 为空时只使用主目标。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateTargets(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "load balancing", func(req *updateTargetsRequest, current Rule) (func(rule *Rule), error) {
+		targets, err := validateTargets(current.ListenPort, req.Targets, req.Balance)
+		if err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) {
+			rule.Targets = targets
+			rule.Balance = req.Balance
+		}, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
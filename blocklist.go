@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// blocklistMaxSize 下载黑名单的大小上限
+const blocklistMaxSize = 32 << 20
+
+// ipRange IPv4 地址区间（含两端）
+type ipRange struct {
+	from, to uint32
+}
+
+// ipSet 一组IP与网段，IPv4 以合并后的有序区间做二分查找
+type ipSet struct {
+	v4 []ipRange
+	v6 []*net.IPNet
+}
+
+// contains 判断IP是否在集合中
+func (s *ipSet) contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		v := binary.BigEndian.Uint32(ip4)
+		i := sort.Search(len(s.v4), func(i int) bool { return s.v4[i].to >= v })
+		return i < len(s.v4) && s.v4[i].from <= v
+	}
+	for _, n := range s.v6 {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPSet 解析黑名单文本，每行一个IP或CIDR，支持 # 和 ; 注释
+func parseIPSet(r io.Reader) (*ipSet, int, error) {
+	set := &ipSet{}
+	count := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		entry := fields[0]
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			continue
+		}
+		count++
+
+		if ip4 := ipnet.IP.To4(); ip4 != nil {
+			from := binary.BigEndian.Uint32(ip4)
+			to := from | ^binary.BigEndian.Uint32(net.IP(ipnet.Mask).To4())
+			set.v4 = append(set.v4, ipRange{from, to})
+			continue
+		}
+		set.v6 = append(set.v6, ipnet)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// 排序并合并重叠区间
+	sort.Slice(set.v4, func(i, j int) bool { return set.v4[i].from < set.v4[j].from })
+	merged := set.v4[:0]
+	for _, r := range set.v4 {
+		if n := len(merged); n > 0 && uint64(r.from) <= uint64(merged[n-1].to)+1 {
+			if r.to > merged[n-1].to {
+				merged[n-1].to = r.to
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	set.v4 = merged
+	return set, count, nil
+}
+
+// blocklistManager 管理黑名单订阅与已下载的地址集合
+var blocklistManager = struct {
+	sync.RWMutex
+	lists []Blocklist
+	sets  map[string]*ipSet // 黑名单ID -> 地址集合
+}{
+	sets: make(map[string]*ipSet),
+}
+
+// loadBlocklists 从存储加载订阅配置
+func loadBlocklists() {
+	lists, err := storage.LoadBlocklists()
+	if err != nil {
+		log.Printf("Failed to load blocklists: %v", err)
+		return
+	}
+	blocklistManager.Lock()
+	blocklistManager.lists = lists
+	blocklistManager.Unlock()
+}
+
+// connectionAllowed 判断来源IP是否允许通过该监听地址转发到 target：先检查规则的访问控制列表，再检查黑名单。
+// 规则按监听地址与目标查找，监听同一地址的多条规则各自使用自己的访问控制列表与黑名单
+func connectionAllowed(listenAddr, listenPort, target string, ip net.IP) bool {
+	ruleID := ""
+	if rule, ok := findRuleByTarget(listenAddr, listenPort, target); ok {
+		ruleID = rule.ID
+	}
+	return aclAllows(ruleID, ip) && !isBlocked(ruleID, ip)
+}
+
+// isBlocked 判断来源IP是否被应用到该规则的黑名单拦截
+func isBlocked(ruleID string, ip net.IP) bool {
+	blocklistManager.RLock()
+	defer blocklistManager.RUnlock()
+
+	for _, list := range blocklistManager.lists {
+		if !list.Enabled || !blocklistAppliesTo(list, ruleID) {
+			continue
+		}
+		if set := blocklistManager.sets[list.ID]; set != nil && set.contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// blocklistAppliesTo 判断黑名单是否应用到规则
+func blocklistAppliesTo(list Blocklist, ruleID string) bool {
+	if len(list.RuleIDs) == 0 {
+		return true
+	}
+	for _, id := range list.RuleIDs {
+		if id == ruleID {
+			return true
+		}
+	}
+	return false
+}
+
+// startBlocklistRefresher 按计划刷新黑名单
+func startBlocklistRefresher() {
+	go func() {
+		for {
+			refreshDueBlocklists(time.Now())
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+// refreshDueBlocklists 刷新到期或尚未下载的黑名单
+func refreshDueBlocklists(now time.Time) {
+	blocklistManager.RLock()
+	var due []Blocklist
+	for _, list := range blocklistManager.lists {
+		if !list.Enabled {
+			continue
+		}
+		interval := time.Duration(list.RefreshMinutes) * time.Minute
+		if interval <= 0 {
+			interval = 24 * time.Hour
+		}
+		last, err := time.ParseInLocation("2006-01-02 15:04:05", list.LastUpdated, time.Local)
+		if blocklistManager.sets[list.ID] == nil || err != nil || now.Sub(last) >= interval {
+			due = append(due, list)
+		}
+	}
+	blocklistManager.RUnlock()
+
+	for _, list := range due {
+		refreshBlocklist(list.ID, list.URL)
+	}
+}
+
+// refreshBlocklist 下载并解析黑名单，更新状态并保存
+func refreshBlocklist(id, url string) error {
+	set, count, err := downloadIPSet(url)
+
+	blocklistManager.Lock()
+	for i := range blocklistManager.lists {
+		if blocklistManager.lists[i].ID != id {
+			continue
+		}
+		list := &blocklistManager.lists[i]
+		list.LastUpdated = time.Now().Format("2006-01-02 15:04:05")
+		if err != nil {
+			list.LastError = err.Error()
+		} else {
+			list.LastError = ""
+			list.Entries = count
+			blocklistManager.sets[id] = set
+		}
+	}
+	lists := append([]Blocklist(nil), blocklistManager.lists...)
+	blocklistManager.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to refresh blocklist %s: %v", url, err)
+	} else {
+		log.Printf("Refreshed blocklist %s: %d entries", url, count)
+	}
+	if saveErr := storage.SaveBlocklists(lists); saveErr != nil {
+		log.Printf("Failed to save blocklists: %v", saveErr)
+	}
+	return err
+}
+
+// downloadIPSet 下载黑名单
+func downloadIPSet(url string) (*ipSet, int, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return parseIPSet(io.LimitReader(resp.Body, blocklistMaxSize))
+}
+
+// apiGetBlocklists 获取黑名单订阅
+func apiGetBlocklists(w http.ResponseWriter, r *http.Request) {
+	blocklistManager.RLock()
+	lists := append([]Blocklist{}, blocklistManager.lists...)
+	blocklistManager.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// apiSaveBlocklist 新增或更新黑名单订阅（ID为空时新增）
+func apiSaveBlocklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Blocklist
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		writeError(w, http.StatusBadRequest, "blocklist URL must be http(s)")
+		return
+	}
+
+	blocklistManager.Lock()
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+		req.LastUpdated, req.Entries, req.LastError = "", 0, ""
+		blocklistManager.lists = append(blocklistManager.lists, req)
+	} else {
+		found := false
+		for i, list := range blocklistManager.lists {
+			if list.ID == req.ID {
+				// 保留下载状态，URL 变化时强制重新下载
+				req.LastUpdated, req.Entries, req.LastError = list.LastUpdated, list.Entries, list.LastError
+				if list.URL != req.URL {
+					req.LastUpdated = ""
+					delete(blocklistManager.sets, req.ID)
+				}
+				blocklistManager.lists[i] = req
+				found = true
+				break
+			}
+		}
+		if !found {
+			blocklistManager.Unlock()
+			http.Error(w, "Blocklist not found", http.StatusNotFound)
+			return
+		}
+	}
+	lists := append([]Blocklist(nil), blocklistManager.lists...)
+	blocklistManager.Unlock()
+
+	if err := storage.SaveBlocklists(lists); err != nil {
+		log.Printf("Failed to save blocklists: %v", err)
+	}
+
+	// 新订阅或地址变化后立即下载
+	if req.Enabled && req.LastUpdated == "" {
+		go refreshBlocklist(req.ID, req.URL)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "blocklist": req})
+}
+
+// idRequest 按ID指定黑名单的请求体
+type idRequest struct {
+	ID string `json:"id"`
+}
+
+// apiDeleteBlocklist 删除黑名单订阅
+func apiDeleteBlocklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req idRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	blocklistManager.Lock()
+	var kept []Blocklist
+	for _, list := range blocklistManager.lists {
+		if list.ID != req.ID {
+			kept = append(kept, list)
+		}
+	}
+	blocklistManager.lists = kept
+	delete(blocklistManager.sets, req.ID)
+	blocklistManager.Unlock()
+
+	if err := storage.SaveBlocklists(kept); err != nil {
+		log.Printf("Failed to save blocklists: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// apiRefreshBlocklist 立即刷新黑名单
+func apiRefreshBlocklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req idRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	blocklistManager.RLock()
+	url := ""
+	for _, list := range blocklistManager.lists {
+		if list.ID == req.ID {
+			url = list.URL
+		}
+	}
+	blocklistManager.RUnlock()
+	if url == "" {
+		http.Error(w, "Blocklist not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := refreshBlocklist(req.ID, url); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
+)
+
+// captureHexFilePath 规则十六进制转储抓包文件路径
+func captureHexFilePath(ruleID string) string {
+	return filepath.Join(".", "db", "captures", ruleID+".txt")
+}
+
+// captureFile 规则抓包文件路径与下载时的 Content-Type
+func captureFile(ruleID, format string) (path, contentType string) {
+	if format == store.CaptureFormatHex {
+		return captureHexFilePath(ruleID), "text/plain; charset=utf-8"
+	}
+	return captureFilePath(ruleID), "application/vnd.tcpdump.pcap"
+}
+
+// pcap 记录的 TCP 数据段上限：IPv4 总长度不超过 65535
+const pcapMaxSegment = 65535 - 20 - 20
+
+// captureTap 正在写入的抓包文件，实现 forward.Tap
+type captureTap struct {
+	ruleID string
+	format string
+	limit  int64
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+	full    bool              // 已达到大小上限，不再写入
+	seq     map[string]uint32 // pcap 中每个 TCP 方向的下一个序号
+}
+
+// captures 规则ID -> 正在写入的抓包文件
+var captures = struct {
+	sync.Mutex
+	taps map[string]*captureTap
+}{
+	taps: make(map[string]*captureTap),
+}
+
+// ruleCaptureTap 规则开启了抓包时返回其抓包文件，第一次调用时创建（覆盖之前的文件）
+func ruleCaptureTap(rule Rule) forward.Tap {
+	if rule.Capture == nil || !rule.Capture.Enabled {
+		return nil
+	}
+
+	captures.Lock()
+	defer captures.Unlock()
+	if tap, ok := captures.taps[rule.ID]; ok {
+		return tap
+	}
+	tap, err := openCapture(rule.ID, *rule.Capture)
+	if err != nil {
+		log.Printf("Failed to open capture file for rule %s: %v", rule.ID, err)
+		return nil
+	}
+	captures.taps[rule.ID] = tap
+	return tap
+}
+
+// stopCapture 关闭规则正在写入的抓包文件，文件保留以供下载
+func stopCapture(ruleID string) {
+	captures.Lock()
+	tap, ok := captures.taps[ruleID]
+	delete(captures.taps, ruleID)
+	captures.Unlock()
+	if ok {
+		tap.close()
+	}
+}
+
+// openCapture 创建抓包文件，pcap 格式写入文件头（链路层类型为原始 IP）
+func openCapture(ruleID string, config CaptureConfig) (*captureTap, error) {
+	format := config.FileFormat()
+	path, _ := captureFile(ruleID, format)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tap := &captureTap{ruleID: ruleID, format: format, limit: config.MaxBytes(), file: file, seq: make(map[string]uint32)}
+	if format == store.CaptureFormatPcap {
+		header := make([]byte, 24)
+		binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+		binary.LittleEndian.PutUint16(header[4:6], 2)
+		binary.LittleEndian.PutUint16(header[6:8], 4)
+		binary.LittleEndian.PutUint32(header[16:20], 262144)
+		binary.LittleEndian.PutUint32(header[20:24], linkTypeRaw)
+		if _, err := file.Write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+		tap.written = int64(len(header))
+	}
+	return tap, nil
+}
+
+// Packet 把一段数据写入抓包文件，达到大小上限后丢弃
+func (t *captureTap) Packet(protocol string, src, dst net.Addr, payload []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil || t.full {
+		return
+	}
+
+	var record []byte
+	if t.format == store.CaptureFormatHex {
+		record = []byte(fmt.Sprintf("%s %s %s -> %s (%d bytes)\n%s\n",
+			time.Now().Format("2006-01-02T15:04:05.000000"), protocol, src, dst, len(payload), hex.Dump(payload)))
+	} else {
+		record = t.pcapRecords(protocol, src, dst, payload)
+	}
+
+	if t.written+int64(len(record)) > t.limit {
+		t.full = true
+		log.Printf("Capture for rule %s reached its %d MB limit, no longer writing", t.ruleID, t.limit>>20)
+		return
+	}
+	if _, err := t.file.Write(record); err != nil {
+		log.Printf("Failed to write capture for rule %s: %v", t.ruleID, err)
+		t.full = true
+		return
+	}
+	t.written += int64(len(record))
+}
+
+// pcapRecords 把数据构造成带 IP 与 TCP/UDP 头的 pcap 记录，TCP 数据按 IP 包长度上限分段
+func (t *captureTap) pcapRecords(protocol string, src, dst net.Addr, payload []byte) []byte {
+	srcIP, srcPort := addrIPPort(src)
+	dstIP, dstPort := addrIPPort(dst)
+	now := time.Now()
+
+	var out []byte
+	for len(payload) > 0 {
+		chunk := payload
+		var transport []byte
+		if protocol == "udp" {
+			if len(payload) > 65535-20-8 {
+				return out
+			}
+			transport = make([]byte, 8)
+			binary.BigEndian.PutUint16(transport[4:6], uint16(8+len(chunk)))
+		} else {
+			if len(chunk) > pcapMaxSegment {
+				chunk = chunk[:pcapMaxSegment]
+			}
+			forwardKey, reverseKey := src.String()+">"+dst.String(), dst.String()+">"+src.String()
+			seq, ok := t.seq[forwardKey]
+			if !ok {
+				seq = 1
+			}
+			t.seq[forwardKey] = seq + uint32(len(chunk))
+			transport = make([]byte, 20)
+			binary.BigEndian.PutUint32(transport[4:8], seq)
+			binary.BigEndian.PutUint32(transport[8:12], t.seq[reverseKey])
+			transport[12] = 5 << 4
+			transport[13] = 0x18 // PSH|ACK
+			binary.BigEndian.PutUint16(transport[14:16], 65535)
+		}
+		binary.BigEndian.PutUint16(transport[0:2], uint16(srcPort))
+		binary.BigEndian.PutUint16(transport[2:4], uint16(dstPort))
+
+		packet := append(ipHeader(protocol, srcIP, dstIP, len(transport)+len(chunk)), transport...)
+		packet = append(packet, chunk...)
+
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:4], uint32(now.Unix()))
+		binary.LittleEndian.PutUint32(record[4:8], uint32(now.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:12], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(record[12:16], uint32(len(packet)))
+		out = append(append(out, record...), packet...)
+		payload = payload[len(chunk):]
+	}
+	return out
+}
+
+// ipHeader 构造 IPv4 头，任一端不是 IPv4 地址时构造 IPv6 头
+func ipHeader(protocol string, src, dst net.IP, length int) []byte {
+	proto := byte(6)
+	if protocol == "udp" {
+		proto = 17
+	}
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		h := make([]byte, 20)
+		h[0] = 0x45
+		binary.BigEndian.PutUint16(h[2:4], uint16(20+length))
+		binary.BigEndian.PutUint16(h[6:8], 0x4000) // DF
+		h[8] = 64
+		h[9] = proto
+		copy(h[12:16], src4)
+		copy(h[16:20], dst4)
+		var sum uint32
+		for i := 0; i < 20; i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(h[i : i+2]))
+		}
+		for sum > 0xffff {
+			sum = sum&0xffff + sum>>16
+		}
+		binary.BigEndian.PutUint16(h[10:12], ^uint16(sum))
+		return h
+	}
+	h := make([]byte, 40)
+	h[0] = 0x60
+	binary.BigEndian.PutUint16(h[4:6], uint16(length))
+	h[6] = proto
+	h[7] = 64
+	copy(h[8:24], src.To16())
+	copy(h[24:40], dst.To16())
+	return h
+}
+
+// addrIPPort 地址的IP与端口，未知时IP为未指定地址
+func addrIPPort(addr net.Addr) (net.IP, int) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port
+	case *net.UDPAddr:
+		return a.IP, a.Port
+	}
+	return net.IPv4zero, 0
+}
+
+// status 抓包文件已写入的字节数与是否已达到上限
+func (t *captureTap) status() (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.written, t.full
+}
+
+// close 关闭抓包文件，之后的数据被丢弃
+func (t *captureTap) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// CaptureStatus 规则的抓包状态
+type CaptureStatus struct {
+	Enabled bool   `json:"enabled"`
+	Format  string `json:"format"`
+	MaxMB   int    `json:"maxMB"`
+	Active  bool   `json:"active"`  // 抓包文件已打开，转发的数据会写入
+	Size    int64  `json:"size"`    // 文件大小（字节），没有文件时为 0
+	Full    bool   `json:"full"`    // 已达到大小上限，不再写入
+	HasFile bool   `json:"hasFile"` // 是否有可下载的抓包文件
+}
+
+// apiGetCapture 获取规则的抓包设置与抓包文件状态
+func apiGetCapture(w http.ResponseWriter, r *http.Request) {
+	rule, ok := findRule(r.URL.Query().Get("ruleId"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	config := CaptureConfig{}
+	if rule.Capture != nil {
+		config = *rule.Capture
+	}
+	status := CaptureStatus{Enabled: config.Enabled, Format: config.FileFormat(), MaxMB: int(config.MaxBytes() >> 20)}
+
+	captures.Lock()
+	tap, active := captures.taps[rule.ID]
+	captures.Unlock()
+	if active {
+		status.Active = true
+		status.Size, status.Full = tap.status()
+		status.HasFile = true
+	} else {
+		path, _ := captureFile(rule.ID, status.Format)
+		if info, err := os.Stat(path); err == nil {
+			status.Size, status.HasFile = info.Size(), true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// updateCaptureRequest apiUpdateCapture 的请求体
+type updateCaptureRequest struct {
+	RuleID  string         `json:"ruleId"`
+	Capture *CaptureConfig `json:"capture"`
+}
+
+// apiUpdateCapture 开启或关闭规则的抓包，capture 为 null 时关闭。
+// 每次修改都会结束当前的抓包文件，开启时重新创建（覆盖之前的文件）；正在运行的转发会重启以应用新配置
+func apiUpdateCapture(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "capture", func(req *updateCaptureRequest, _ Rule) (func(rule *Rule), error) {
+		if req.Capture != nil {
+			if err := req.Capture.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.Capture = req.Capture }, nil
+	})
+	if ok {
+		stopCapture(rule.ID)
+		restartUpdatedRule(w, r, rule)
+	}
+}
+
+// apiDownloadCapture 下载规则的抓包文件，正在抓包时返回已写入的部分
+func apiDownloadCapture(w http.ResponseWriter, r *http.Request) {
+	rule, ok := findRule(r.URL.Query().Get("ruleId"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	format := store.CaptureFormatPcap
+	if rule.Capture != nil {
+		format = rule.Capture.FileFormat()
+	}
+
+	path, contentType := captureFile(rule.ID, format)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "no capture file for this rule")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "goports-capture-"+filepath.Base(path)))
+	w.Write(data)
+}
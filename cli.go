@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cliUsage 命令行子命令说明
+const cliUsage = `Usage: port-forwarder [flags] <command> [args]
+
+Commands talk to a running instance at -api (default http://127.0.0.1:8080).
+If the instance requires a password, pass the same -ui-password (and -totp with the
+current code when two-factor login is enabled); API credentials are read from
+-api-token / -api-basic-auth or their environment variables and replace the login.
+
+  list                          List rules and the protocols they are forwarding
+  add <listen> <target> [name]  Add a rule, e.g. add 0.0.0.0:3306 192.168.1.10:3306 "Dev MySQL"
+  delete <rule>                 Stop and delete a rule
+  start <rule> [protocol...]    Start forwarding (tcp, udp, sctp, socks5; default tcp)
+  stop <rule> [protocol...]     Stop forwarding (default: every running protocol)
+  stats [rule]                  Show traffic counters
+
+  install-service               Install as a Windows service or systemd unit that runs headless
+                                in the current directory; flags given before it are kept,
+                                passwords and tokens in db/service.env readable only by its owner
+  start-service                 Start the installed service
+  stop-service                  Stop the installed service
+  uninstall-service             Stop and remove the installed service
+
+<rule> is a rule's sequence number, ID or unique ID prefix.
+`
+
+// apiClient 访问正在运行的实例的 REST API
+type apiClient struct {
+	base   string
+	client *http.Client
+}
+
+// runCLI 执行子命令，返回进程退出码
+func runCLI(args []string) int {
+	if args[0] == "help" || args[0] == "-h" {
+		fmt.Print(cliUsage)
+		return 0
+	}
+
+	err := loadAPIAuth()
+	var c *apiClient
+	if err == nil {
+		c, err = newAPIClient(*apiAddr)
+	}
+	if err == nil {
+		err = c.run(args)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// newAPIClient 创建客户端。设置了密码且没有令牌或用户名密码时先登录，开启了两步验证时需要 -totp
+func newAPIClient(base string) (*apiClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &apiClient{
+		base:   strings.TrimRight(base, "/"),
+		client: &http.Client{Jar: jar, Timeout: 30 * time.Second},
+	}
+
+	if *uiPassword != "" && !apiAuthEnabled() {
+		err := c.call(http.MethodPost, "/api/login", loginRequest{Password: *uiPassword, Code: *cliTOTP}, nil)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			if *cliTOTP == "" {
+				return nil, fmt.Errorf("login failed: %s (pass -totp if two-factor login is enabled)", apiErr.Message)
+			}
+			return nil, fmt.Errorf("login failed: %s", apiErr.Message)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// apiError 接口返回的失败，Message 取自 {"success": false, "error": "..."}
+type apiError struct {
+	Method        string
+	Path          string
+	Status        int
+	Message       string
+	SuggestedPort string // 端口被占用时建议的可用端口
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Message)
+}
+
+// newAPIError 从失败的响应中读出错误信息，响应不是 JSON 时使用状态与原文
+func newAPIError(method, path string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &apiError{Method: method, Path: path, Status: resp.StatusCode}
+	var result Result
+	if json.Unmarshal(body, &result) == nil && result.Error != "" {
+		e.Message = result.Error
+		e.SuggestedPort = result.SuggestedPort
+	} else {
+		e.Message = resp.Status + ": " + strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// call 发送请求并把 JSON 响应解码到 out
+func (c *apiClient) call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiAuth.token != "" {
+		req.Header.Set(apiTokenHeader, apiAuth.token)
+	}
+	if apiAuth.user != "" {
+		req.SetBasicAuth(apiAuth.user, apiAuth.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(method, path, resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// run 分派子命令
+func (c *apiClient) run(args []string) error {
+	switch args[0] {
+	case "list":
+		return c.list()
+	case "add":
+		if len(args) != 3 && len(args) != 4 {
+			return errors.New("usage: add <listen> <target> [name]")
+		}
+		name := ""
+		if len(args) == 4 {
+			name = args[3]
+		}
+		return c.add(args[1], args[2], name)
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("usage: delete <rule>")
+		}
+		return c.delete(args[1])
+	case "start", "stop":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s <rule> [protocol...]", args[0])
+		}
+		return c.toggle(args[0] == "start", args[1], args[2:])
+	case "stats":
+		ref := ""
+		if len(args) > 1 {
+			ref = args[1]
+		}
+		return c.stats(ref)
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], cliUsage)
+}
+
+// rules 获取规则，按序号升序
+func (c *apiClient) rules() ([]Rule, error) {
+	var list []Rule
+	if err := c.call(http.MethodGet, "/api/getRules", nil, &list); err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Seq < list[j].Seq })
+	return list, nil
+}
+
+// findRule 按序号、ID 或唯一ID前缀查找规则
+func (c *apiClient) findRule(ref string) (Rule, error) {
+	list, err := c.rules()
+	if err != nil {
+		return Rule{}, err
+	}
+	if seq, err := strconv.Atoi(ref); err == nil {
+		for _, rule := range list {
+			if rule.Seq == seq {
+				return rule, nil
+			}
+		}
+	}
+	var matches []Rule
+	for _, rule := range list {
+		if rule.ID == ref {
+			return rule, nil
+		}
+		if strings.HasPrefix(rule.ID, ref) {
+			matches = append(matches, rule)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Rule{}, fmt.Errorf("rule %q not found", ref)
+	case 1:
+		return matches[0], nil
+	}
+	return Rule{}, fmt.Errorf("rule prefix %q is ambiguous", ref)
+}
+
+// ruleStats 获取所有规则的统计，按规则ID索引
+func (c *apiClient) ruleStats() (map[string]RuleStats, error) {
+	var list []RuleStats
+	if err := c.call(http.MethodGet, "/api/getStats", nil, &list); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]RuleStats, len(list))
+	for _, s := range list {
+		byID[s.RuleID] = s
+	}
+	return byID, nil
+}
+
+// running 返回统计中正在运行的协议，按固定顺序排列
+func (s RuleStats) running() []string {
+	var protocols []string
+	for _, protocol := range forwardProtocols {
+		if _, ok := s.Protocols[protocol]; ok {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+// list 列出规则
+func (c *apiClient) list() error {
+	list, err := c.rules()
+	if err != nil {
+		return err
+	}
+	stats, err := c.ruleStats()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEQ\tID\tNAME\tLISTEN\tTARGET\tRUNNING")
+	for _, rule := range list {
+		running := strings.Join(stats[rule.ID].running(), ",")
+		if running == "" {
+			running = "-"
+		}
+		name := rule.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", rule.Seq, rule.ID[:8], name,
+			net.JoinHostPort(rule.ListenAddr, rule.ListenPort), net.JoinHostPort(rule.TargetAddr, rule.TargetPort), running)
+	}
+	return tw.Flush()
+}
+
+// add 新增规则，监听地址只写端口时监听所有地址
+func (c *apiClient) add(listen, target, name string) error {
+	if !strings.Contains(listen, ":") {
+		listen = "0.0.0.0:" + listen
+	}
+	listenAddr, listenPort, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+	if listenAddr == "" {
+		listenAddr = "0.0.0.0"
+	}
+	targetAddr, targetPort, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("invalid target address %q: %w", target, err)
+	}
+
+	var result struct {
+		Rule Rule `json:"rule"`
+	}
+	err = c.call(http.MethodPost, "/api/addRule", addRuleRequest{
+		Name:       name,
+		ListenAddr: listenAddr,
+		ListenPort: listenPort,
+		TargetAddr: targetAddr,
+		TargetPort: targetPort,
+	}, &result)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return errors.New(apiErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added rule %d (%s)\n", result.Rule.Seq, result.Rule.ID)
+	return nil
+}
+
+// delete 停止并删除规则
+func (c *apiClient) delete(ref string) error {
+	rule, err := c.findRule(ref)
+	if err != nil {
+		return err
+	}
+	if err := c.toggle(false, rule.ID, nil); err != nil {
+		return err
+	}
+	if err := c.call(http.MethodPost, "/api/deleteRules", map[string][]string{"ids": {rule.ID}}, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted rule %d\n", rule.Seq)
+	return nil
+}
+
+// toggle 按规则ID开启或停止转发
+func (c *apiClient) toggle(start bool, ref string, protocols []string) error {
+	rule, err := c.findRule(ref)
+	if err != nil {
+		return err
+	}
+
+	action := "stop"
+	if start {
+		action = "start"
+		if len(protocols) == 0 {
+			protocols = []string{"tcp"}
+		}
+	}
+	for i, protocol := range protocols {
+		protocols[i] = strings.ToLower(protocol)
+	}
+
+	var result RuleActionResult
+	err = c.call(http.MethodPost, "/api/v2/rules/"+url.PathEscape(rule.ID)+"/"+action, ruleActionRequest{Protocols: protocols}, &result)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		if apiErr.SuggestedPort != "" {
+			return fmt.Errorf("%s rule %d: %s (port %s is free)", action, rule.Seq, apiErr.Message, apiErr.SuggestedPort)
+		}
+		return fmt.Errorf("%s rule %d: %s", action, rule.Seq, apiErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	done := result.Started
+	if !start {
+		done = result.Stopped
+	}
+	for _, protocol := range done {
+		fmt.Printf("%s %s forward of rule %d: ok\n", action, protocol, rule.Seq)
+	}
+	if len(done) == 0 {
+		state := "not running"
+		if start {
+			state = "already running"
+		}
+		fmt.Printf("rule %d: %s\n", rule.Seq, state)
+	}
+	return nil
+}
+
+// stats 显示流量统计
+func (c *apiClient) stats(ref string) error {
+	list, err := c.rules()
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		rule, err := c.findRule(ref)
+		if err != nil {
+			return err
+		}
+		list = []Rule{rule}
+	}
+	stats, err := c.ruleStats()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEQ\tLISTEN\tIN\tOUT\tACTIVE\tTOTAL\tFAILED")
+	for _, rule := range list {
+		s := stats[rule.ID]
+		if !s.Running {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%d\t%d\n", rule.Seq, net.JoinHostPort(rule.ListenAddr, rule.ListenPort),
+			s.Total.BytesIn, s.Total.BytesOut, s.Total.ActiveConns, s.Total.TotalConns, s.Total.DialFailures)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule 转发规则。这里只列出常用字段，完整定义见 /api/openapi.json 中的 Rule
+type Rule struct {
+	ID         string `json:"id"`
+	Seq        int    `json:"seq"`
+	Name       string `json:"name,omitempty"`
+	Note       string `json:"note,omitempty"`
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+	Pinned     bool   `json:"pinned,omitempty"`
+	AutoStart  bool   `json:"autoStart,omitempty"`
+}
+
+// NewRule 新增规则的参数，Preset 为内置预设名称（可选）
+type NewRule struct {
+	Preset     string `json:"preset,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Note       string `json:"note,omitempty"`
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+}
+
+// RuleUpdate 修改规则的参数。地址与端口必须全部给出，值为 nil 的可选项保持不变
+type RuleUpdate struct {
+	ID         string  `json:"id"`
+	Name       *string `json:"name,omitempty"`
+	Note       *string `json:"note,omitempty"`
+	ListenAddr string  `json:"listenAddr"`
+	ListenPort string  `json:"listenPort"`
+	TargetAddr string  `json:"targetAddr"`
+	TargetPort string  `json:"targetPort"`
+	AutoStart  *bool   `json:"autoStart,omitempty"`
+}
+
+// Template 规则模板
+type Template struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Rules       []string `json:"rules"`
+	CreatedAt   string   `json:"createdAt"`
+}
+
+// Traffic 流量与连接计数
+type Traffic struct {
+	BytesIn     int64 `json:"bytesIn"`
+	BytesOut    int64 `json:"bytesOut"`
+	ActiveConns int64 `json:"activeConns"`
+	TotalConns  int64 `json:"totalConns"`
+}
+
+// RuleStats 规则的流量统计，Protocols 只包含正在运行的协议
+type RuleStats struct {
+	RuleID    string             `json:"ruleId"`
+	Name      string             `json:"name"`
+	Running   bool               `json:"running"`
+	Protocols map[string]Traffic `json:"protocols"`
+	Total     Traffic            `json:"total"`
+}
+
+// ForwardFailure 批量启动/停止中失败的转发
+type ForwardFailure struct {
+	RuleID   string `json:"ruleId"`
+	Protocol string `json:"protocol"`
+	Error    string `json:"error"`
+}
+
+// BulkResult 批量启动/停止的结果
+type BulkResult struct {
+	Started int              `json:"started"`
+	Stopped int              `json:"stopped"`
+	Failed  []ForwardFailure `json:"failed"`
+}
+
+// Settings 实例的设置，修改时值为零的字段保持不变
+type Settings struct {
+	UIListen        string `json:"uiListen,omitempty"`
+	UIPort          int    `json:"uiPort,omitempty"`
+	LogLevel        string `json:"logLevel,omitempty"`
+	TCPBufferSize   int    `json:"tcpBufferSize,omitempty"`
+	UDPBufferSize   int    `json:"udpBufferSize,omitempty"`
+	UDPSocketBuffer int    `json:"udpSocketBuffer,omitempty"`
+	Language        string `json:"language,omitempty"`
+	APIToken        string `json:"apiToken,omitempty"`
+	AutoStartRules  *bool  `json:"autoStartRules,omitempty"`
+	RestoreRunning  *bool  `json:"restoreRunning,omitempty"`
+	DefaultTemplate string `json:"defaultTemplate,omitempty"`
+}
+
+// protocolEndpoints 协议在接口名称中的写法
+var protocolEndpoints = map[string]string{
+	"tcp":    "TCP",
+	"udp":    "UDP",
+	"sctp":   "SCTP",
+	"socks5": "SOCKS5",
+}
+
+// Login 用 -ui-password 设置的密码登录，开启了两步验证时需要 code
+func (c *Client) Login(ctx context.Context, password, code string) error {
+	return c.Do(ctx, http.MethodPost, "/api/login", map[string]string{"password": password, "code": code}, nil)
+}
+
+// Rules 列出所有规则
+func (c *Client) Rules(ctx context.Context) ([]Rule, error) {
+	var rules []Rule
+	err := c.Do(ctx, http.MethodGet, "/api/getRules", nil, &rules)
+	return rules, err
+}
+
+// AddRule 新增规则，返回保存后的规则（含分配的ID与序号）
+func (c *Client) AddRule(ctx context.Context, rule NewRule) (Rule, error) {
+	var result struct {
+		Rule Rule `json:"rule"`
+	}
+	err := c.Do(ctx, http.MethodPost, "/api/addRule", rule, &result)
+	return result.Rule, err
+}
+
+// UpdateRule 修改规则
+func (c *Client) UpdateRule(ctx context.Context, update RuleUpdate) error {
+	return c.Do(ctx, http.MethodPost, "/api/updateRule", update, nil)
+}
+
+// DeleteRules 删除规则，正在运行的转发不会停止，需要先调用 StopForward
+func (c *Client) DeleteRules(ctx context.Context, ids ...string) error {
+	return c.Do(ctx, http.MethodPost, "/api/deleteRules", map[string][]string{"ids": ids}, nil)
+}
+
+// StartForward 按规则的地址开启转发，protocol 为 tcp、udp、sctp 或 socks5
+func (c *Client) StartForward(ctx context.Context, protocol string, rule Rule) error {
+	return c.toggleForward(ctx, "start", protocol, rule)
+}
+
+// StopForward 停止规则在指定协议下的转发
+func (c *Client) StopForward(ctx context.Context, protocol string, rule Rule) error {
+	return c.toggleForward(ctx, "stop", protocol, rule)
+}
+
+func (c *Client) toggleForward(ctx context.Context, action, protocol string, rule Rule) error {
+	name, ok := protocolEndpoints[strings.ToLower(protocol)]
+	if !ok {
+		return fmt.Errorf("unknown protocol %q", protocol)
+	}
+	return c.Do(ctx, http.MethodPost, "/api/"+action+name+"Forward", map[string]string{
+		"listenAddr": rule.ListenAddr,
+		"listenPort": rule.ListenPort,
+		"targetAddr": rule.TargetAddr,
+		"targetPort": rule.TargetPort,
+	}, nil)
+}
+
+// StartAll 开启所有规则的转发，protocol 为空时开启 TCP 与 UDP
+func (c *Client) StartAll(ctx context.Context, protocol string) (BulkResult, error) {
+	var result BulkResult
+	err := c.Do(ctx, http.MethodPost, "/api/startAllForwards", map[string]string{"protocol": protocol}, &result)
+	return result, err
+}
+
+// StopAll 停止所有正在运行的转发，protocol 为空时停止所有协议
+func (c *Client) StopAll(ctx context.Context, protocol string) (BulkResult, error) {
+	var result BulkResult
+	err := c.Do(ctx, http.MethodPost, "/api/stopAllForwards", map[string]string{"protocol": protocol}, &result)
+	return result, err
+}
+
+// Stats 获取所有规则的流量统计
+func (c *Client) Stats(ctx context.Context) ([]RuleStats, error) {
+	var stats []RuleStats
+	err := c.Do(ctx, http.MethodGet, "/api/getStats", nil, &stats)
+	return stats, err
+}
+
+// Templates 列出所有模板
+func (c *Client) Templates(ctx context.Context) ([]Template, error) {
+	var templates []Template
+	err := c.Do(ctx, http.MethodGet, "/api/getTemplates", nil, &templates)
+	return templates, err
+}
+
+// StartTemplate 开启模板中所有规则的转发
+func (c *Client) StartTemplate(ctx context.Context, name string) error {
+	return c.Do(ctx, http.MethodPost, "/api/startTemplateForward", map[string]string{"name": name}, nil)
+}
+
+// StopTemplate 停止模板中所有规则的转发
+func (c *Client) StopTemplate(ctx context.Context, name string) error {
+	return c.Do(ctx, http.MethodPost, "/api/stopTemplateForward", map[string]string{"name": name}, nil)
+}
+
+// Settings 获取保存的设置
+func (c *Client) Settings(ctx context.Context) (Settings, error) {
+	var result struct {
+		Settings Settings `json:"settings"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/api/getSettings", nil, &result)
+	return result.Settings, err
+}
+
+// UpdateSettings 修改设置，返回保存后的设置；restartRequired 为 true 时部分修改在重启后生效
+func (c *Client) UpdateSettings(ctx context.Context, settings Settings) (saved Settings, restartRequired bool, err error) {
+	var result struct {
+		Settings        Settings `json:"settings"`
+		RestartRequired bool     `json:"restartRequired"`
+	}
+	err = c.Do(ctx, http.MethodPost, "/api/updateSettings", settings, &result)
+	return result.Settings, result.RestartRequired, err
+}
+
+// RuleStatus 规则及其正在转发的协议
+type RuleStatus struct {
+	Rule       Rule                        `json:"rule"`
+	Active     []string                    `json:"active"`
+	Recovering map[string]ListenerRecovery `json:"recovering,omitempty"` // 按协议，正在重新监听的转发
+}
+
+// ListenerRecovery 监听意外退出、正在等待重新监听的转发的状态
+type ListenerRecovery struct {
+	Since     time.Time `json:"since"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError"`
+	NextRetry time.Time `json:"nextRetry"`
+}
+
+// RuleActionResult 按ID开启或停止规则的结果，已在运行（或未运行）的协议不计入
+type RuleActionResult struct {
+	RuleID  string           `json:"ruleId"`
+	Started []string         `json:"started"`
+	Stopped []string         `json:"stopped"`
+	Failed  []ForwardFailure `json:"failed"`
+}
+
+// RuleStatuses 列出所有规则及其正在转发的协议
+func (c *Client) RuleStatuses(ctx context.Context) ([]RuleStatus, error) {
+	var list []RuleStatus
+	err := c.Do(ctx, http.MethodGet, "/api/v2/rules", nil, &list)
+	return list, err
+}
+
+// RuleStatus 获取单条规则及其正在转发的协议
+func (c *Client) RuleStatus(ctx context.Context, id string) (RuleStatus, error) {
+	var status RuleStatus
+	err := c.Do(ctx, http.MethodGet, "/api/v2/rules/"+url.PathEscape(id), nil, &status)
+	return status, err
+}
+
+// StartRule 按规则ID开启转发，不指定协议时开启 TCP 与 UDP
+func (c *Client) StartRule(ctx context.Context, id string, protocols ...string) (RuleActionResult, error) {
+	return c.ruleAction(ctx, id, "start", protocols)
+}
+
+// StopRule 按规则ID停止转发，不指定协议时停止所有正在运行的协议
+func (c *Client) StopRule(ctx context.Context, id string, protocols ...string) (RuleActionResult, error) {
+	return c.ruleAction(ctx, id, "stop", protocols)
+}
+
+// ruleAction 调用 /api/v2/rules/{id}/start 或 /stop，有协议失败时返回 *Error
+func (c *Client) ruleAction(ctx context.Context, id, action string, protocols []string) (RuleActionResult, error) {
+	var result RuleActionResult
+	err := c.Do(ctx, http.MethodPost, "/api/v2/rules/"+url.PathEscape(id)+"/"+action, map[string][]string{"protocols": protocols}, &result)
+	return result, err
+}
+
+// RuleEvent 规则的一次启动、停止、出错或配置修改
+type RuleEvent struct {
+	Time     time.Time `json:"time"`
+	RuleID   string    `json:"ruleId"`
+	Type     string    `json:"type"` // start、stop、error 或 config
+	Protocol string    `json:"protocol,omitempty"`
+	Source   string    `json:"source"` // ui、api、scheduler 等
+	Message  string    `json:"message,omitempty"`
+}
+
+// RuleHistory 获取规则最近的 limit 条事件（按时间顺序），id 为空时返回所有规则的事件，limit 为 0 时使用服务端默认值
+func (c *Client) RuleHistory(ctx context.Context, id string, limit int) ([]RuleEvent, error) {
+	query := url.Values{}
+	if id != "" {
+		query.Set("ruleId", id)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/api/getRuleHistory"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var events []RuleEvent
+	err := c.Do(ctx, http.MethodGet, path, nil, &events)
+	return events, err
+}
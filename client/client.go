@@ -0,0 +1,124 @@
+// Package client 是 port-forwarder REST API 的 Go 客户端，用于在脚本中管理转发。
+// 接口的完整定义见运行中实例的 /api/openapi.json；这里未封装的接口可以直接用 Client.Do 调用。
+//
+//	c := client.New("http://127.0.0.1:8080")
+//	c.Token = os.Getenv("GOPORTS_API_TOKEN")
+//	rule, err := c.AddRule(ctx, client.NewRule{ListenAddr: "0.0.0.0", ListenPort: "3306", TargetAddr: "192.168.1.10", TargetPort: "3306"})
+//	if err == nil {
+//		err = c.StartForward(ctx, "tcp", rule)
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+// TokenHeader 携带 API 令牌的请求头
+const TokenHeader = "X-API-Token"
+
+// Client 访问一个 port-forwarder 实例。Token 与 Username/Password 对应实例的
+// -api-token 与 -api-basic-auth；实例只设置了 -ui-password 时先调用 Login
+type Client struct {
+	BaseURL    string // 如 http://127.0.0.1:8080
+	Token      string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// New 创建客户端，使用带 Cookie 的 http.Client 以便 Login 后保持会话
+func New(baseURL string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Jar: jar},
+	}
+}
+
+// FieldError 校验失败的字段
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error 接口返回的失败：非 2xx 状态码及 {"success": false, "error": "..."} 中的信息
+type Error struct {
+	StatusCode    int
+	Message       string
+	Fields        []FieldError // 规则或设置校验失败时的各字段错误
+	SuggestedPort string       // 开启转发时端口被占用，建议改用的可用端口
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Do 调用任意接口：body 不为 nil 时以 JSON 发送，成功的 JSON 响应解码到 out（可为 nil）
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set(TokenHeader, c.Token)
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// readError 从失败的响应中读出错误，响应不是 JSON 时使用响应原文
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var envelope struct {
+		Error         string       `json:"error"`
+		Fields        []FieldError `json:"fields"`
+		SuggestedPort string       `json:"suggestedPort"`
+	}
+	e := &Error{StatusCode: resp.StatusCode}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Error != "" {
+		e.Message = envelope.Error
+		e.Fields = envelope.Fields
+		e.SuggestedPort = envelope.SuggestedPort
+	} else {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return e
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/google/uuid"
+)
+
+// 导入配置的方式
+const (
+	ImportMerge   = "merge"   // 合并到现有配置
+	ImportReplace = "replace" // 替换现有配置
+)
+
+// 合并时 ID（模板为名称）冲突的处理方式
+const (
+	ConflictRename    = "rename"    // 分配新的 ID/名称后导入
+	ConflictSkip      = "skip"      // 保留现有的，跳过导入的
+	ConflictOverwrite = "overwrite" // 以导入的覆盖现有的
+)
+
+// maxConfigSize 导入配置的最大字节数
+const maxConfigSize = 16 << 20
+
+// ImportCounts 某类数据的导入结果
+type ImportCounts struct {
+	Added       int `json:"added"`
+	Overwritten int `json:"overwritten"`
+	Renamed     int `json:"renamed"`
+	Skipped     int `json:"skipped"`
+}
+
+// ConfigImportResult 导入配置的结果
+type ConfigImportResult struct {
+	Success    bool         `json:"success"`
+	Error      string       `json:"error,omitempty"`
+	DryRun     bool         `json:"dryRun,omitempty"`
+	Mode       string       `json:"mode"`
+	Rules      ImportCounts `json:"rules"`
+	Templates  ImportCounts `json:"templates"`
+	Blocklists ImportCounts `json:"blocklists"`
+	Stopped    []string     `json:"stopped"`  // 因被覆盖或替换而停止的转发
+	Warnings   []string     `json:"warnings"` // 已自动修正的问题
+}
+
+// apiExportConfig 导出完整配置：规则、模板、黑名单与设置。参数 format=json（默认）或 yaml。
+// 登录设置含 TOTP 密钥，仅在 includeAuth=1 时导出；API 令牌、跳板机密码与私钥、中继节点令牌
+// 仅在 includeSecrets=1 时以明文导出（本机的密文在其他机器上无法解密），导入时按导入方的密钥加密
+func apiExportConfig(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "yaml" {
+		writeError(w, http.StatusBadRequest, "unsupported format, use json or yaml")
+		return
+	}
+
+	appData, err := storage.Load()
+	if err != nil {
+		log.Printf("Failed to load app data: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load configuration")
+		return
+	}
+	if r.URL.Query().Get("includeAuth") != "1" {
+		appData.Auth = nil
+	}
+	if appData.Settings != nil {
+		settings, err := exportSettings(*appData.Settings, r.URL.Query().Get("includeSecrets") == "1")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		appData.Settings = &settings
+	}
+	// 运行状态只对本机有意义
+	for i := range appData.Rules {
+		appData.Rules[i].Running = nil
+	}
+
+	var data []byte
+	contentType := "application/json"
+	if format == "yaml" {
+		data, err = marshalYAML(appData)
+		contentType = "application/yaml"
+	} else {
+		data, err = json.MarshalIndent(appData, "", "  ")
+	}
+	if err != nil {
+		log.Printf("Failed to encode configuration: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to encode configuration")
+		return
+	}
+
+	filename := fmt.Sprintf("goports-config-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
+}
+
+// apiImportConfig 导入 apiExportConfig 导出的配置（JSON 或 YAML，自动识别）。
+// 参数 mode=merge（默认）或 replace；合并时 onConflict=rename（默认）、skip 或 overwrite；
+// dryRun=1 只校验并返回将要进行的变更
+func apiImportConfig(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = ImportMerge
+	}
+	onConflict := query.Get("onConflict")
+	if onConflict == "" {
+		onConflict = ConflictRename
+	}
+	result := ConfigImportResult{Mode: mode, DryRun: query.Get("dryRun") == "1", Stopped: []string{}, Warnings: []string{}}
+
+	fail := func(status int, err error) {
+		result.Error = err.Error()
+		writeJSON(w, status, result)
+	}
+	if r.Method != http.MethodPost {
+		fail(http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		fail(http.StatusBadRequest, fmt.Errorf("unknown mode %q, use merge or replace", mode))
+		return
+	}
+	if onConflict != ConflictRename && onConflict != ConflictSkip && onConflict != ConflictOverwrite {
+		fail(http.StatusBadRequest, fmt.Errorf("unknown onConflict %q, use rename, skip or overwrite", onConflict))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize+1))
+	if err != nil {
+		fail(http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if len(body) > maxConfigSize {
+		fail(http.StatusRequestEntityTooLarge, fmt.Errorf("configuration larger than %d bytes", maxConfigSize))
+		return
+	}
+
+	imported, err := decodeConfig(body)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	if err := normalizeImportedConfig(&imported, &result); err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+
+	current, err := storage.Load()
+	if err != nil {
+		log.Printf("Failed to load app data: %v", err)
+		fail(http.StatusInternalServerError, fmt.Errorf("failed to load current configuration"))
+		return
+	}
+
+	var next AppData
+	var stop []Rule
+	if mode == ImportReplace {
+		next, stop = replaceConfig(current, imported, &result)
+	} else {
+		next, stop = mergeConfig(current, imported, onConflict, &result)
+	}
+	if next.Settings != nil {
+		if err := validateMergedSettings(next.Settings, next.Templates, &result); err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if !result.DryRun {
+		for _, rule := range stop {
+			for _, protocol := range runningProtocols(rule) {
+				if err := stopRuleForward(rule, protocol, requestSource(r)); err != nil {
+					log.Printf("Import: failed to stop %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+					continue
+				}
+				result.Stopped = append(result.Stopped, protocol+" "+ruleDisplayName(rule))
+			}
+		}
+		if err := applyConfig(next); err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		log.Printf("Imported configuration (%s): %d rules, %d templates, %d blocklists added",
+			mode, result.Rules.Added, result.Templates.Added, result.Blocklists.Added)
+	} else {
+		for _, rule := range stop {
+			for _, protocol := range runningProtocols(rule) {
+				result.Stopped = append(result.Stopped, protocol+" "+ruleDisplayName(rule))
+			}
+		}
+	}
+
+	result.Success = true
+	writeJSON(w, http.StatusOK, result)
+}
+
+// decodeConfig 按内容识别 JSON 或 YAML 并解码
+func decodeConfig(data []byte) (AppData, error) {
+	var appData AppData
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return appData, fmt.Errorf("empty configuration")
+	}
+	if trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &appData); err != nil {
+			return appData, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return appData, nil
+	}
+	if err := unmarshalYAML(trimmed, &appData); err != nil {
+		return appData, fmt.Errorf("invalid YAML: %w", err)
+	}
+	return appData, nil
+}
+
+// normalizeImportedConfig 校验导入的配置：规则 ID 不能重复，端口与各项子配置必须有效；
+// 缺失的 ID 会自动生成，模板与黑名单中引用不存在规则的条目会被移除
+func normalizeImportedConfig(appData *AppData, result *ConfigImportResult) error {
+	ids := make(map[string]bool)
+	for i := range appData.Rules {
+		rule := &appData.Rules[i]
+		label := fmt.Sprintf("rule %d", i+1)
+		if rule.ID == "" {
+			rule.ID = uuid.New().String()
+			result.Warnings = append(result.Warnings, label+": missing id, generated a new one")
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("%s: duplicate id %s", label, rule.ID)
+		}
+		ids[rule.ID] = true
+		rule.Running = nil
+
+		if err := resolvePorts(&rule.ListenPort, &rule.TargetPort); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		if err := forward.CheckPortRange(rule.ListenPort, rule.TargetPort); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		name, note, err := normalizeRuleLabel(rule.Name, rule.Note)
+		if err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		rule.Name, rule.Note = name, note
+		if _, err := parseRuleACL(*rule); err != nil {
+			return fmt.Errorf("%s: access control: %w", label, err)
+		}
+		if err := validateImportedRuleOptions(*rule); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range appData.Templates {
+		template := &appData.Templates[i]
+		if template.Name == "" {
+			return fmt.Errorf("template %d: missing name", i+1)
+		}
+		if names[template.Name] {
+			return fmt.Errorf("template %d: duplicate name %s", i+1, template.Name)
+		}
+		names[template.Name] = true
+		// 模板私有的规则副本也是有效的引用
+		known := ids
+		if len(template.Snapshots) > 0 {
+			known = make(map[string]bool, len(ids)+len(template.Snapshots))
+			for id := range ids {
+				known[id] = true
+			}
+			for j := range template.Snapshots {
+				snapshot := &template.Snapshots[j]
+				if snapshot.ID == "" {
+					snapshot.ID = uuid.New().String()
+					template.Rules = append(template.Rules, snapshot.ID)
+				}
+				snapshot.Running = nil
+				known[snapshot.ID] = true
+			}
+		}
+		template.Rules = knownRuleIDs(template.Rules, known, "template "+template.Name, result)
+		if len(template.Startup) > 0 {
+			if err := validateStartup(*template, template.Startup); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("template %s: startup order dropped: %v", template.Name, err))
+				template.Startup = nil
+			}
+		}
+	}
+
+	listIDs := make(map[string]bool)
+	for i := range appData.Blocklists {
+		list := &appData.Blocklists[i]
+		if list.ID == "" {
+			list.ID = uuid.New().String()
+		}
+		if listIDs[list.ID] {
+			return fmt.Errorf("blocklist %d: duplicate id %s", i+1, list.ID)
+		}
+		listIDs[list.ID] = true
+		if list.URL == "" {
+			return fmt.Errorf("blocklist %d: missing url", i+1)
+		}
+		if len(list.RuleIDs) > 0 {
+			list.RuleIDs = knownRuleIDs(list.RuleIDs, ids, "blocklist "+list.Name, result)
+			if len(list.RuleIDs) == 0 {
+				// 引用的规则都不存在，避免变成应用到全部规则
+				list.Enabled = false
+				result.Warnings = append(result.Warnings, fmt.Sprintf("blocklist %s: no remaining rules, disabled", list.Name))
+			}
+		}
+		// 下载状态只对本机有意义，导入后重新下载
+		list.LastUpdated, list.Entries, list.LastError = "", 0, ""
+	}
+
+	if appData.Settings != nil {
+		return normalizeImportedSettings(appData.Settings, result)
+	}
+	return nil
+}
+
+// validateImportedRuleOptions 校验规则的子配置
+func validateImportedRuleOptions(rule Rule) error {
+	for _, alert := range rule.Alerts {
+		if err := alert.Validate(); err != nil {
+			return fmt.Errorf("alert: %w", err)
+		}
+	}
+	if rule.Watchdog != nil {
+		if err := rule.Watchdog.Validate(); err != nil {
+			return fmt.Errorf("watchdog: %w", err)
+		}
+	}
+	if rule.Emulation != nil {
+		if err := rule.Emulation.Validate(); err != nil {
+			return fmt.Errorf("emulation: %w", err)
+		}
+	}
+	if rule.TLSTarget != nil {
+		if err := rule.TLSTarget.Validate(); err != nil {
+			return fmt.Errorf("tlsTarget: %w", err)
+		}
+	}
+	if rule.UDPRelay != nil {
+		if err := rule.UDPRelay.Validate(); err != nil {
+			return fmt.Errorf("udpRelay: %w", err)
+		}
+	}
+	if _, err := validateTargets(rule.ListenPort, rule.Targets, rule.Balance); err != nil {
+		return fmt.Errorf("targets: %w", err)
+	}
+	if _, err := validateRoutes(rule.ListenPort, rule.Routes); err != nil {
+		return fmt.Errorf("routes: %w", err)
+	}
+	if err := validateRuleSSHHost(rule); err != nil {
+		return fmt.Errorf("sshHost: %w", err)
+	}
+	if err := validateOutboundBind(rule); err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+	if err := validateRuleVia(rule); err != nil {
+		return fmt.Errorf("via: %w", err)
+	}
+	if rule.Health != nil {
+		if err := rule.Health.Validate(); err != nil {
+			return fmt.Errorf("health: %w", err)
+		}
+	}
+	if err := validateConnLimits(rule.IdleTimeout, rule.MaxLifetime, rule.UDPTimeout); err != nil {
+		return err
+	}
+	if err := validateMaxConns(rule.MaxConns); err != nil {
+		return err
+	}
+	if err := validateAutoStop(rule.AutoStopMinutes); err != nil {
+		return err
+	}
+	if err := validatePortMapping(rule); err != nil {
+		return err
+	}
+	if rule.QRCode != nil {
+		if err := rule.QRCode.Validate(); err != nil {
+			return fmt.Errorf("qrCode: %w", err)
+		}
+	}
+	if rule.Capture != nil {
+		if err := rule.Capture.Validate(); err != nil {
+			return fmt.Errorf("capture: %w", err)
+		}
+	}
+	if rule.Retry != nil {
+		if err := rule.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+	if rule.TCPTuning != nil {
+		if err := rule.TCPTuning.Validate(); err != nil {
+			return fmt.Errorf("tcpTuning: %w", err)
+		}
+	}
+	if rule.Schedule != nil {
+		if err := rule.Schedule.Validate(); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// knownRuleIDs 去掉导入配置中不存在的规则引用
+func knownRuleIDs(refs []string, ids map[string]bool, owner string, result *ConfigImportResult) []string {
+	kept := make([]string, 0, len(refs))
+	for _, id := range refs {
+		if ids[id] {
+			kept = append(kept, id)
+		} else {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: removed reference to unknown rule %s", owner, id))
+		}
+	}
+	return kept
+}
+
+// replaceConfig 以导入的配置替换现有配置，返回新配置与需要停止转发的现有规则。
+// 导入的配置中没有登录设置、界面设置或程序设置时保留现有的；导出时去掉了 API 令牌，
+// 导入的设置中没有令牌时保留现有的
+func replaceConfig(current, imported AppData, result *ConfigImportResult) (AppData, []Rule) {
+	next := imported
+	if next.Auth == nil {
+		next.Auth = current.Auth
+	}
+	if next.UI == nil {
+		next.UI = current.UI
+	}
+	if next.Settings == nil {
+		next.Settings = current.Settings
+	} else if next.Settings.APIToken == "" && current.Settings != nil {
+		next.Settings.APIToken = current.Settings.APIToken
+	}
+	if next.Rules == nil {
+		next.Rules = []Rule{}
+	}
+	if next.Templates == nil {
+		next.Templates = []Template{}
+	}
+
+	// 序号重复时按原顺序重新编号
+	seqs := make(map[int]bool)
+	for _, rule := range next.Rules {
+		seqs[rule.Seq] = true
+	}
+	if len(seqs) != len(next.Rules) || seqs[0] {
+		sort.SliceStable(next.Rules, func(i, j int) bool { return next.Rules[i].Seq < next.Rules[j].Seq })
+		for i := range next.Rules {
+			next.Rules[i].Seq = i + 1
+		}
+		result.Warnings = append(result.Warnings, "rule sequence numbers were renumbered")
+	}
+
+	result.Rules.Added = len(next.Rules)
+	result.Templates.Added = len(next.Templates)
+	result.Blocklists.Added = len(next.Blocklists)
+	return next, current.Rules
+}
+
+// mergeConfig 把导入的配置合并到现有配置，返回新配置与因被覆盖需要停止转发的规则。
+// 新增规则的序号接在现有规则之后，设置逐项合并
+func mergeConfig(current, imported AppData, onConflict string, result *ConfigImportResult) (AppData, []Rule) {
+	next := current
+	next.Rules = append([]Rule{}, current.Rules...)
+	next.Templates = append([]Template{}, current.Templates...)
+	next.Blocklists = append([]Blocklist{}, current.Blocklists...)
+	if imported.Auth != nil {
+		next.Auth = imported.Auth
+	}
+	if imported.UI != nil {
+		next.UI = imported.UI
+	}
+	var renamed map[string]string // 重命名的跳板机与中继节点
+	if imported.Settings != nil {
+		var settings Settings
+		settings, renamed = mergeSettings(current.EffectiveSettings(), *imported.Settings, onConflict, result)
+		next.Settings = &settings
+		next.UI = nil // 已并入 settings
+	}
+
+	var stop []Rule
+	idMap := make(map[string]string) // 导入的规则ID -> 合并后的规则ID
+	ruleIndex := make(map[string]int)
+	maxSeq := 0
+	for i, rule := range next.Rules {
+		ruleIndex[rule.ID] = i
+		if rule.Seq > maxSeq {
+			maxSeq = rule.Seq
+		}
+	}
+
+	importedRules := append([]Rule{}, imported.Rules...)
+	sort.SliceStable(importedRules, func(i, j int) bool { return importedRules[i].Seq < importedRules[j].Seq })
+	for _, rule := range importedRules {
+		if id, ok := renamed[rule.SSHHost]; ok {
+			rule.SSHHost = id
+		}
+		if len(rule.Via) > 0 {
+			via := make([]string, len(rule.Via))
+			for j, id := range rule.Via {
+				if mapped, ok := renamed[id]; ok {
+					id = mapped
+				}
+				via[j] = id
+			}
+			rule.Via = via
+		}
+		i, exists := ruleIndex[rule.ID]
+		if exists {
+			switch onConflict {
+			case ConflictSkip:
+				idMap[rule.ID] = rule.ID
+				result.Rules.Skipped++
+				continue
+			case ConflictOverwrite:
+				if live, ok := findRule(rule.ID); ok {
+					stop = append(stop, live)
+				}
+				rule.Seq = next.Rules[i].Seq
+				next.Rules[i] = rule
+				idMap[rule.ID] = rule.ID
+				result.Rules.Overwritten++
+				continue
+			}
+			newID := uuid.New().String()
+			idMap[rule.ID] = newID
+			rule.ID = newID
+			result.Rules.Renamed++
+		} else {
+			idMap[rule.ID] = rule.ID
+		}
+		maxSeq++
+		rule.Seq = maxSeq
+		ruleIndex[rule.ID] = len(next.Rules)
+		next.Rules = append(next.Rules, rule)
+		result.Rules.Added++
+	}
+
+	// 不在 idMap 中的是模板私有副本的ID，保持不变
+	remapID := func(id string) string {
+		if mapped, ok := idMap[id]; ok {
+			return mapped
+		}
+		return id
+	}
+	remap := func(ids []string) []string {
+		out := make([]string, 0, len(ids))
+		for _, id := range ids {
+			out = append(out, remapID(id))
+		}
+		return out
+	}
+
+	templateIndex := make(map[string]int)
+	for i, template := range next.Templates {
+		templateIndex[template.Name] = i
+	}
+	for _, template := range imported.Templates {
+		template.Rules = remap(template.Rules)
+		for j := range template.Startup {
+			template.Startup[j].RuleID = remapID(template.Startup[j].RuleID)
+			if template.Startup[j].After != "" {
+				template.Startup[j].After = remapID(template.Startup[j].After)
+			}
+		}
+		if i, exists := templateIndex[template.Name]; exists {
+			switch onConflict {
+			case ConflictSkip:
+				result.Templates.Skipped++
+				continue
+			case ConflictOverwrite:
+				next.Templates[i] = template
+				result.Templates.Overwritten++
+				continue
+			}
+			base := template.Name
+			for n := 2; ; n++ {
+				template.Name = fmt.Sprintf("%s (%d)", base, n)
+				if _, taken := templateIndex[template.Name]; !taken {
+					break
+				}
+			}
+			result.Templates.Renamed++
+		}
+		templateIndex[template.Name] = len(next.Templates)
+		next.Templates = append(next.Templates, template)
+		result.Templates.Added++
+	}
+
+	listIndex := make(map[string]int)
+	for i, list := range next.Blocklists {
+		listIndex[list.ID] = i
+	}
+	for _, list := range imported.Blocklists {
+		list.RuleIDs = remap(list.RuleIDs)
+		if i, exists := listIndex[list.ID]; exists {
+			switch onConflict {
+			case ConflictSkip:
+				result.Blocklists.Skipped++
+				continue
+			case ConflictOverwrite:
+				next.Blocklists[i] = list
+				result.Blocklists.Overwritten++
+				continue
+			}
+			list.ID = uuid.New().String()
+			result.Blocklists.Renamed++
+		}
+		listIndex[list.ID] = len(next.Blocklists)
+		next.Blocklists = append(next.Blocklists, list)
+		result.Blocklists.Added++
+	}
+	return next, stop
+}
+
+// applyConfig 保存新配置并刷新内存中的规则、模板、黑名单、访问控制、设置（含管理端来源白名单）与登录设置。
+// 跳板机可能已被替换，关闭现有的 SSH 连接，下次使用时按新设置重新连接
+func applyConfig(next AppData) error {
+	previous := currentSettings()
+	if err := ruleStore.ReplaceAll(next); err != nil {
+		log.Printf("Failed to save app data: %v", err)
+		return fmt.Errorf("failed to save configuration")
+	}
+	loadSettings()
+	if err := loadManagementAllowlist(); err != nil {
+		log.Printf("Invalid management allowlist: %v", err)
+	}
+	for _, host := range previous.SSHHosts {
+		closeSSHTunnel(host.ID)
+	}
+	loadRuleACLs()
+	loadBlocklists()
+	loadAuth()
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// exportSettings 导出的设置：默认去掉 API 令牌与跳板机、中继节点的密钥；
+// includeSecrets 时把它们解密为明文，以便在其他机器上导入
+func exportSettings(settings Settings, includeSecrets bool) (Settings, error) {
+	if !includeSecrets {
+		settings.APIToken = ""
+	}
+	settings.SSHHosts = append([]SSHHost(nil), settings.SSHHosts...)
+	for i := range settings.SSHHosts {
+		host := &settings.SSHHosts[i]
+		if !includeSecrets {
+			host.Password, host.PrivateKey = "", ""
+			continue
+		}
+		var err error
+		if host.Password, err = decryptSecret(host.Password); err != nil {
+			return settings, fmt.Errorf("SSH host %s password: %w", sshHostLabel(*host), err)
+		}
+		if host.PrivateKey, err = decryptSecret(host.PrivateKey); err != nil {
+			return settings, fmt.Errorf("SSH host %s private key: %w", sshHostLabel(*host), err)
+		}
+	}
+	settings.RelayNodes = append([]RelayNode(nil), settings.RelayNodes...)
+	for i := range settings.RelayNodes {
+		node := &settings.RelayNodes[i]
+		if !includeSecrets {
+			node.Token = ""
+			continue
+		}
+		var err error
+		if node.Token, err = decryptSecret(node.Token); err != nil {
+			return settings, fmt.Errorf("relay node %s token: %w", node.Addr, err)
+		}
+	}
+	return settings, nil
+}
+
+// importSecret 处理导入的密码、私钥或令牌：明文按本机密钥加密；已加密的只有本机能解密时保留，
+// 其他机器加密的无法使用，丢弃并提示重新设置
+func importSecret(value, owner string, result *ConfigImportResult) string {
+	if value == "" {
+		return ""
+	}
+	if strings.HasPrefix(value, secretPrefix) {
+		if _, err := decryptSecret(value); err == nil {
+			return value
+		}
+		result.Warnings = append(result.Warnings, owner+" was encrypted on another machine and was dropped, set it again")
+		return ""
+	}
+	encrypted, err := encryptSecret(value)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s could not be encrypted and was dropped: %v", owner, err))
+		return ""
+	}
+	return encrypted
+}
+
+// normalizeImportedSettings 校验导入设置中的跳板机、中继节点与环境，并按本机密钥处理其中的密钥
+func normalizeImportedSettings(settings *Settings, result *ConfigImportResult) error {
+	hostIDs := make(map[string]bool)
+	for i := range settings.SSHHosts {
+		host := &settings.SSHHosts[i]
+		label := fmt.Sprintf("SSH host %d", i+1)
+		if host.ID == "" {
+			host.ID = uuid.New().String()
+		}
+		if hostIDs[host.ID] {
+			return fmt.Errorf("%s: duplicate id %s", label, host.ID)
+		}
+		hostIDs[host.ID] = true
+		if _, _, err := net.SplitHostPort(host.Addr); err != nil {
+			return fmt.Errorf("%s: invalid address %q, use host:port", label, host.Addr)
+		}
+		if host.User == "" {
+			return fmt.Errorf("%s: missing user", label)
+		}
+		if host.HostKey != "" && !strings.HasPrefix(host.HostKey, "SHA256:") {
+			return fmt.Errorf("%s: hostKey must be a SHA256 fingerprint (SHA256:...)", label)
+		}
+		host.Password = importSecret(host.Password, label+" password", result)
+		host.PrivateKey = importSecret(host.PrivateKey, label+" private key", result)
+	}
+
+	nodeIDs := make(map[string]bool)
+	for i := range settings.RelayNodes {
+		node := &settings.RelayNodes[i]
+		label := fmt.Sprintf("relay node %d", i+1)
+		if node.ID == "" {
+			node.ID = uuid.New().String()
+		}
+		if nodeIDs[node.ID] {
+			return fmt.Errorf("%s: duplicate id %s", label, node.ID)
+		}
+		nodeIDs[node.ID] = true
+		if _, _, err := net.SplitHostPort(node.Addr); err != nil {
+			return fmt.Errorf("%s: invalid address %q, use host:port", label, node.Addr)
+		}
+		node.Token = importSecret(node.Token, label+" token", result)
+	}
+
+	profileNames := make(map[string]bool)
+	for i, profile := range settings.Profiles {
+		if err := validateProfile(profile); err != nil {
+			return fmt.Errorf("profile %d: %w", i+1, err)
+		}
+		if profileNames[profile.Name] {
+			return fmt.Errorf("profile %d: duplicate name %s", i+1, profile.Name)
+		}
+		profileNames[profile.Name] = true
+	}
+	return nil
+}
+
+// mergeSettings 把导入的设置逐项合并到现有设置：导入中设置了的选项覆盖现有的，API 令牌保留本机的；
+// 跳板机、中继节点按 ID、环境按名称合并，冲突时按 onConflict 处理。覆盖时导入中为空的密钥保留现有的。
+// 返回重命名的跳板机与中继节点的 ID（导入的 ID -> 新 ID），供导入的规则改用
+func mergeSettings(current, imported Settings, onConflict string, result *ConfigImportResult) (Settings, map[string]string) {
+	next := current
+	renamed := make(map[string]string)
+	if imported.UIListen != "" {
+		next.UIListen = imported.UIListen
+	}
+	if imported.UIPort != 0 {
+		next.UIPort = imported.UIPort
+	}
+	if imported.UIAllow != "" {
+		next.UIAllow = imported.UIAllow
+	}
+	if imported.LogLevel != "" {
+		next.LogLevel = imported.LogLevel
+	}
+	if imported.TCPBufferSize != 0 {
+		next.TCPBufferSize = imported.TCPBufferSize
+	}
+	if imported.UDPBufferSize != 0 {
+		next.UDPBufferSize = imported.UDPBufferSize
+	}
+	if imported.UDPSocketBuffer != 0 {
+		next.UDPSocketBuffer = imported.UDPSocketBuffer
+	}
+	if imported.Language != "" {
+		next.Language = imported.Language
+	}
+	if imported.AutoStartRules != nil {
+		next.AutoStartRules = imported.AutoStartRules
+	}
+	if imported.RestoreRunning != nil {
+		next.RestoreRunning = imported.RestoreRunning
+	}
+	if imported.DefaultTemplate != "" {
+		next.DefaultTemplate = imported.DefaultTemplate
+	}
+	if imported.RebindForwards {
+		next.RebindForwards = true
+	}
+	if imported.APIToken != "" && imported.APIToken != current.APIToken {
+		result.Warnings = append(result.Warnings, "settings: apiToken is not merged, the current token is kept")
+	}
+	if next.ActiveProfile == "" {
+		next.ActiveProfile = imported.ActiveProfile
+	}
+
+	next.SSHHosts = append([]SSHHost{}, current.SSHHosts...)
+	hostIndex := make(map[string]int)
+	for i, host := range next.SSHHosts {
+		hostIndex[host.ID] = i
+	}
+	for _, host := range imported.SSHHosts {
+		if i, exists := hostIndex[host.ID]; exists {
+			switch onConflict {
+			case ConflictSkip:
+				continue
+			case ConflictOverwrite:
+				if host.Password == "" && host.PrivateKey == "" {
+					host.Password, host.PrivateKey = next.SSHHosts[i].Password, next.SSHHosts[i].PrivateKey
+				}
+				next.SSHHosts[i] = host
+				continue
+			}
+			renamed[host.ID] = uuid.New().String()
+			host.ID = renamed[host.ID]
+		}
+		hostIndex[host.ID] = len(next.SSHHosts)
+		next.SSHHosts = append(next.SSHHosts, host)
+	}
+
+	next.RelayNodes = append([]RelayNode{}, current.RelayNodes...)
+	nodeIndex := make(map[string]int)
+	for i, node := range next.RelayNodes {
+		nodeIndex[node.ID] = i
+	}
+	for _, node := range imported.RelayNodes {
+		if i, exists := nodeIndex[node.ID]; exists {
+			switch onConflict {
+			case ConflictSkip:
+				continue
+			case ConflictOverwrite:
+				if node.Token == "" {
+					node.Token = next.RelayNodes[i].Token
+				}
+				next.RelayNodes[i] = node
+				continue
+			}
+			renamed[node.ID] = uuid.New().String()
+			node.ID = renamed[node.ID]
+		}
+		nodeIndex[node.ID] = len(next.RelayNodes)
+		next.RelayNodes = append(next.RelayNodes, node)
+	}
+
+	next.Profiles = append([]Profile{}, current.Profiles...)
+	profileIndex := make(map[string]int)
+	for i, profile := range next.Profiles {
+		profileIndex[profile.Name] = i
+	}
+	for _, profile := range imported.Profiles {
+		if i, exists := profileIndex[profile.Name]; exists {
+			switch onConflict {
+			case ConflictSkip:
+				continue
+			case ConflictOverwrite:
+				next.Profiles[i] = profile
+				continue
+			}
+			base := profile.Name
+			for n := 2; ; n++ {
+				profile.Name = fmt.Sprintf("%s (%d)", base, n)
+				if _, taken := profileIndex[profile.Name]; !taken {
+					break
+				}
+			}
+		}
+		profileIndex[profile.Name] = len(next.Profiles)
+		next.Profiles = append(next.Profiles, profile)
+	}
+	return next, renamed
+}
+
+// validateMergedSettings 校验导入后的设置。默认模板与当前环境按导入后的模板与环境检查，
+// 不存在时清除并提示
+func validateMergedSettings(settings *Settings, templates []Template, result *ConfigImportResult) error {
+	if settings.DefaultTemplate != "" {
+		found := false
+		for _, template := range templates {
+			found = found || template.Name == settings.DefaultTemplate
+		}
+		if !found {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("settings: default template %s not found, cleared", settings.DefaultTemplate))
+			settings.DefaultTemplate = ""
+		}
+	}
+	if _, ok := settings.FindProfile(settings.ActiveProfile); !ok && settings.ActiveProfile != "" {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("settings: active profile %s not found, cleared", settings.ActiveProfile))
+		settings.ActiveProfile = ""
+	}
+
+	// 默认模板已按导入后的模板检查，validateSettings 只会按现有模板检查
+	check := *settings
+	check.DefaultTemplate = ""
+	if errs := validateSettings(check); len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, e := range errs {
+			messages = append(messages, e.Field+": "+e.Message)
+		}
+		return errors.New("settings: " + strings.Join(messages, "; "))
+	}
+	return nil
+}
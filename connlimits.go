@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// maxConnLimitSeconds 空闲超时与最长存活时间的上限（7天）
+const maxConnLimitSeconds = 7 * 24 * 3600
+
+// ruleConnLimits 规则的连接超时设置
+func ruleConnLimits(rule Rule) forward.ConnLimits {
+	return forward.ConnLimits{
+		Idle:     time.Duration(rule.IdleTimeout) * time.Second,
+		Lifetime: time.Duration(rule.MaxLifetime) * time.Second,
+
+		UDPSession: time.Duration(rule.UDPTimeout) * time.Second,
+	}
+}
+
+// updateConnLimitsRequest apiUpdateConnLimits 的请求体
+type updateConnLimitsRequest struct {
+	RuleID      string `json:"ruleId"`
+	IdleTimeout int    `json:"idleTimeout"`
+	MaxLifetime int    `json:"maxLifetime"`
+	UDPTimeout  int    `json:"udpTimeout"`
+}
+
+// apiUpdateConnLimits 设置规则的连接空闲超时与最长存活时间（秒，0 为不限制）以及UDP会话的空闲超时（秒，0 为默认值）。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateConnLimits(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "connection limits", func(req *updateConnLimitsRequest, _ Rule) (func(rule *Rule), error) {
+		if err := validateConnLimits(req.IdleTimeout, req.MaxLifetime, req.UDPTimeout); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) {
+			rule.IdleTimeout = req.IdleTimeout
+			rule.MaxLifetime = req.MaxLifetime
+			rule.UDPTimeout = req.UDPTimeout
+		}, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
+
+// validateConnLimits 校验空闲超时、最长存活时间与UDP会话超时
+func validateConnLimits(idleTimeout, maxLifetime, udpTimeout int) error {
+	if idleTimeout < 0 || maxLifetime < 0 || udpTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if idleTimeout > maxConnLimitSeconds || maxLifetime > maxConnLimitSeconds || udpTimeout > maxConnLimitSeconds {
+		return errors.New("timeouts must be at most 7 days")
+	}
+	return nil
+}
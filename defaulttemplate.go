@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// startDefaultTemplate 开启设置中的默认模板。模板已被删除时只记录日志
+func startDefaultTemplate() {
+	settings := currentSettings()
+	if settings.DefaultTemplate == "" {
+		return
+	}
+
+	lg := newLogger("autostart")
+	template, ok := ruleStore.Template(settings.DefaultTemplate)
+	if !ok {
+		lg.Errorf("Auto-start: default template %s not found", settings.DefaultTemplate)
+		return
+	}
+	if _, err := startTemplateForwards(template, sourceAutoStart); err != nil {
+		lg.Errorf("Auto-start: failed to start template %s: %v", template.Name, err)
+		return
+	}
+	lg.Infof("Auto-start: started template %s", template.Name)
+}
+
+// renameDefaultTemplate 模板改名或删除（newName 为空）时同步默认模板设置
+func renameDefaultTemplate(oldName, newName string) {
+	if currentSettings().DefaultTemplate != oldName {
+		return
+	}
+	_, err := updateSettings(func(settings *Settings) {
+		settings.DefaultTemplate = newName
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+	}
+}
+
+// apiGetDefaultTemplate 获取启动时自动开启的模板名称，未设置时为空
+func apiGetDefaultTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"name": currentSettings().DefaultTemplate})
+}
+
+// apiSetDefaultTemplate 设置启动时自动开启的模板，name 为空时取消
+func apiSetDefaultTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析请求体
+	var req nameRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name != "" {
+		if _, ok := ruleStore.Template(req.Name); !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("template %s not found", req.Name))
+			return
+		}
+	}
+
+	_, err := updateSettings(func(settings *Settings) {
+		settings.DefaultTemplate = req.Name
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// updateDialRetryRequest apiUpdateDialRetry 的请求体
+type updateDialRetryRequest struct {
+	RuleID string             `json:"ruleId"`
+	Retry  *forward.DialRetry `json:"retry"`
+}
+
+// apiUpdateDialRetry 设置规则连接目标失败时的重试，retry 为 null 时不重试。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateDialRetry(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "dial retry", func(req *updateDialRetryRequest, _ Rule) (func(rule *Rule), error) {
+		if req.Retry != nil {
+			if err := req.Retry.Validate(); err != nil {
+				return nil, err
+			}
+			if !req.Retry.Enabled() {
+				req.Retry = nil
+			}
+		}
+		return func(rule *Rule) { rule.Retry = req.Retry }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// apiGetEmulation 获取规则的网络状况模拟配置
+func apiGetEmulation(w http.ResponseWriter, r *http.Request) {
+	getRuleOption(w, r, func(rule Rule) map[string]interface{} {
+		return map[string]interface{}{"emulation": rule.Emulation}
+	})
+}
+
+// updateEmulationRequest apiUpdateEmulation 的请求体
+type updateEmulationRequest struct {
+	RuleID    string                `json:"ruleId"`
+	Emulation *forward.NetEmulation `json:"emulation"`
+}
+
+// apiUpdateEmulation 设置规则的网络状况模拟，emulation 为 null 时移除
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateEmulation(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "network emulation", func(req *updateEmulationRequest, _ Rule) (func(rule *Rule), error) {
+		if req.Emulation != nil {
+			if err := req.Emulation.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.Emulation = req.Emulation }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
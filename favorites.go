@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// FavoriteStatus 收藏规则的精简状态
+type FavoriteStatus struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Listen  string   `json:"listen"`
+	Target  string   `json:"target"`
+	Running []string `json:"running"` // 正在转发的协议
+}
+
+// pinRuleRequest apiPinRule 的请求体
+type pinRuleRequest struct {
+	ID     string `json:"id"`
+	Pinned bool   `json:"pinned"`
+}
+
+// apiPinRule 设置或取消规则置顶
+func apiPinRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req pinRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := ruleStore.UpdateRule(req.ID, func(rule *Rule) {
+		rule.Pinned = req.Pinned
+	})
+	if errors.Is(err, store.ErrRuleNotFound) {
+		writeError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save rules: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// apiGetFavorites 获取置顶规则及其运行状态
+func apiGetFavorites(w http.ResponseWriter, r *http.Request) {
+	favorites := []FavoriteStatus{}
+	for _, rule := range ruleStore.Rules() {
+		if !rule.Pinned {
+			continue
+		}
+		running := runningProtocols(rule)
+		if running == nil {
+			running = []string{}
+		}
+		favorites = append(favorites, FavoriteStatus{
+			ID:      rule.ID,
+			Name:    ruleDisplayName(rule),
+			Listen:  net.JoinHostPort(rule.ListenAddr, rule.ListenPort),
+			Target:  net.JoinHostPort(rule.TargetAddr, rule.TargetPort),
+			Running: running,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(favorites)
+}
@@ -0,0 +1,205 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// RestartPolicy 监听意外退出后重新监听的指数退避：第一次等待 MinDelay，之后每次翻倍，最多 MaxDelay
+type RestartPolicy struct {
+	MinDelay    time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts int // 连续失败这么多次后停止转发，0 表示一直重试
+}
+
+// 未设置 MinDelay/MaxDelay 时的退避
+const (
+	DefaultRestartMinDelay = time.Second
+	DefaultRestartMaxDelay = time.Minute
+)
+
+// ListenerRecovery 监听意外退出、正在等待重新监听的转发的状态
+type ListenerRecovery struct {
+	Since     time.Time `json:"since"`     // 监听退出的时间
+	Attempts  int       `json:"attempts"`  // 已经失败的重新监听次数
+	LastError string    `json:"lastError"` // 监听退出或最近一次重新监听失败的原因
+	NextRetry time.Time `json:"nextRetry"`
+}
+
+// Recovery 返回监听地址上正在等待重新监听的转发的状态，没有时返回 false。
+// 端口范围返回第一个正在恢复的端口的状态
+func (f *Forwarder) Recovery(protocol, listenAddr, listenPort string) (ListenerRecovery, bool) {
+	if IsPortRange(listenPort) {
+		pairs, err := ExpandPortRange(listenPort, "")
+		if err != nil {
+			return ListenerRecovery{}, false
+		}
+		for _, pair := range pairs {
+			if status, ok := f.Recovery(protocol, listenAddr, pair.Listen); ok {
+				return status, true
+			}
+		}
+		return ListenerRecovery{}, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status, ok := f.recovering[forwardKey(protocol, listenAddr, listenPort)]
+	if !ok {
+		return ListenerRecovery{}, false
+	}
+	return *status, true
+}
+
+// delay 第 attempt 次（从 1 开始）重新监听前的等待时间
+func (p *RestartPolicy) delay(attempt int) time.Duration {
+	delay, maxDelay := p.MinDelay, p.MaxDelay
+	if delay <= 0 {
+		delay = DefaultRestartMinDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultRestartMaxDelay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// recover 关闭出错的监听器 old，按 AutoRestart 的退避重新监听，成功后返回新的监听器。status 为 serve 登记的恢复状态。
+// 转发被停止、排空或重新启动（监听器已不是 old）时返回 nil；超过最大次数时停止转发并返回 nil
+func (f *Forwarder) recover(ctx context.Context, protocol, listenAddr, listenPort string, old io.Closer, status *ListenerRecovery, relisten func() (io.Closer, error)) io.Closer {
+	// 出错的监听器仍然占用端口，先关闭才能重新监听；停止转发时会忽略它已关闭
+	old.Close()
+
+	key := forwardKey(protocol, listenAddr, listenPort)
+	f.mu.Lock()
+	lg := f.listenLog(listenAddr, listenPort, f.targets[key])
+	f.mu.Unlock()
+	addr := net.JoinHostPort(listenAddr, listenPort)
+
+	// owned 转发是否仍在使用 old，不再使用时清除恢复状态
+	owned := func() bool {
+		if f.ownsListenerLocked(protocol, key, old) {
+			return true
+		}
+		if f.recovering[key] == status {
+			delete(f.recovering, key)
+		}
+		return false
+	}
+
+	for attempt := 1; ; attempt++ {
+		delay := f.AutoRestart.delay(attempt)
+		f.mu.Lock()
+		if !owned() {
+			f.mu.Unlock()
+			return nil
+		}
+		status.NextRetry = time.Now().Add(delay)
+		f.recovering[key] = status
+		f.mu.Unlock()
+
+		lg.Warnf("Re-binding %s listener %s in %s (attempt %d)", protocol, addr, delay, attempt)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			f.mu.Lock()
+			owned()
+			f.mu.Unlock()
+			return nil
+		case <-timer.C:
+		}
+
+		listener, err := relisten()
+		if err == nil {
+			f.mu.Lock()
+			replaced := owned() && f.replaceListenerLocked(protocol, key, listener)
+			if replaced {
+				delete(f.recovering, key)
+			}
+			f.mu.Unlock()
+			if !replaced {
+				listener.Close()
+				return nil
+			}
+			lg.Infof("Re-bound %s listener %s after %d attempts", protocol, addr, attempt)
+			if f.OnListenerRecovered != nil {
+				f.OnListenerRecovered(protocol, listenAddr, listenPort, f.target(key), attempt)
+			}
+			return listener
+		}
+
+		f.mu.Lock()
+		status.Attempts = attempt
+		status.LastError = err.Error()
+		stillOwned := owned()
+		f.mu.Unlock()
+		if !stillOwned {
+			return nil
+		}
+		lg.Errorf("Failed to re-bind %s listener %s: %v", protocol, addr, err)
+		if f.AutoRestart.MaxAttempts > 0 && attempt >= f.AutoRestart.MaxAttempts {
+			target := f.target(key)
+			f.stopPort(protocol, listenAddr, listenPort)
+			if f.OnListenerFailed != nil {
+				f.OnListenerFailed(protocol, listenAddr, listenPort, target, fmt.Errorf("gave up re-binding after %d attempts: %w", attempt, err))
+			}
+			return nil
+		}
+	}
+}
+
+// target 转发的目标 addr:port
+func (f *Forwarder) target(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.targets[key]
+}
+
+// ownsListenerLocked 监听地址上的转发是否仍在使用监听器 l，且没有在重新启动。调用方需持有 f.mu
+func (f *Forwarder) ownsListenerLocked(protocol, key string, l io.Closer) bool {
+	if f.restarting[key] {
+		return false
+	}
+	switch protocol {
+	case "tcp":
+		current, ok := f.tcpListeners[key]
+		return ok && io.Closer(*current) == l
+	case "udp":
+		current, ok := f.udpListeners[key]
+		return ok && io.Closer(current) == l
+	case "sctp":
+		current, ok := f.sctpListeners[key]
+		return ok && io.Closer(current) == l
+	case "socks5":
+		current, ok := f.socksListeners[key]
+		return ok && io.Closer(current) == l
+	}
+	return false
+}
+
+// replaceListenerLocked 把转发的监听器换成 l，调用方需持有 f.mu 并已确认转发仍在使用原来的监听器
+func (f *Forwarder) replaceListenerLocked(protocol, key string, l io.Closer) bool {
+	switch protocol {
+	case "tcp":
+		listener := l.(net.Listener)
+		f.tcpListeners[key] = &listener
+	case "udp":
+		f.udpListeners[key] = l.(*net.UDPConn)
+	case "sctp":
+		f.sctpListeners[key] = l.(net.Listener)
+	case "socks5":
+		f.socksListeners[key] = l.(net.Listener)
+	default:
+		return false
+	}
+	return true
+}
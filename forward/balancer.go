@@ -0,0 +1,65 @@
+package forward
+
+import (
+	"sync/atomic"
+)
+
+// 负载均衡方式
+const (
+	BalanceRoundRobin = "roundrobin" // 轮询（默认）
+	BalanceLeastConn  = "leastconn"  // 活动连接最少的目标
+)
+
+// targetPool 一个 TCP 转发的目标池：主目标加上规则的额外目标
+type targetPool struct {
+	targets []string // addr:port
+	method  string
+	next    atomic.Uint64
+	active  []atomic.Int64 // 每个目标的活动连接数
+
+	healthy func(target string) bool // 为 nil 时所有目标都视为健康
+	backup  string                   // 所有目标都不健康时使用，为空时仍在所有目标中选择
+}
+
+// newTargetPool 创建目标池，extra 为空时只有主目标
+func newTargetPool(primary string, extra []string, method string) *targetPool {
+	targets := append([]string{primary}, extra...)
+	return &targetPool{
+		targets: targets,
+		method:  method,
+		active:  make([]atomic.Int64, len(targets)),
+	}
+}
+
+// acquire 为新连接选择一个目标，跳过不健康的目标，返回的函数在连接结束时调用
+func (p *targetPool) acquire() (string, func()) {
+	candidates := make([]int, 0, len(p.targets))
+	for j, target := range p.targets {
+		if p.healthy == nil || p.healthy(target) {
+			candidates = append(candidates, j)
+		}
+	}
+	if len(candidates) == 0 {
+		if p.backup != "" {
+			return p.backup, func() {}
+		}
+		for j := range p.targets {
+			candidates = append(candidates, j)
+		}
+	}
+
+	i := candidates[0]
+	if len(candidates) > 1 {
+		if p.method == BalanceLeastConn {
+			for _, j := range candidates {
+				if p.active[j].Load() < p.active[i].Load() {
+					i = j
+				}
+			}
+		} else {
+			i = candidates[(p.next.Add(1)-1)%uint64(len(candidates))]
+		}
+	}
+	p.active[i].Add(1)
+	return p.targets[i], func() { p.active[i].Add(-1) }
+}
@@ -0,0 +1,110 @@
+package forward
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ConnLimits 单个连接的空闲超时与最长存活时间，为0时不限制
+type ConnLimits struct {
+	Idle     time.Duration // 两个方向都没有数据超过该时间时关闭连接
+	Lifetime time.Duration // 连接建立超过该时间后关闭
+
+	// UDPSession UDP 会话没有数据包后保留客户端映射的时间，为0时使用 DefaultUDPSessionTimeout（仅UDP）。
+	// QUIC 等长连接协议应不小于其空闲保活间隔，否则映射过期后客户端的路径会被打断
+	UDPSession time.Duration
+}
+
+// DefaultUDPSessionTimeout 未设置 UDPSession 时UDP会话的空闲超时
+const DefaultUDPSessionTimeout = 2 * time.Minute
+
+// active 是否有任一限制
+func (l ConnLimits) active() bool {
+	return l.Idle > 0 || l.Lifetime > 0
+}
+
+// udpSession UDP 会话的空闲超时
+func (l ConnLimits) udpSession() time.Duration {
+	if l.UDPSession > 0 {
+		return l.UDPSession
+	}
+	return DefaultUDPSessionTimeout
+}
+
+// connClock 一个连接的计时：建立时间与两个方向上最近一次传输数据的时间
+type connClock struct {
+	limits     ConnLimits
+	started    time.Time
+	lastActive atomic.Int64 // UnixNano
+}
+
+func newConnClock(limits ConnLimits) *connClock {
+	c := &connClock{limits: limits, started: time.Now()}
+	c.touch()
+	return c
+}
+
+// touch 记录一次数据传输
+func (c *connClock) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// deadline 当前的读超时：最近活动时间加空闲超时与存活截止时间中较早的一个，没有限制时为零值
+func (c *connClock) deadline() time.Time {
+	var d time.Time
+	if c.limits.Idle > 0 {
+		d = time.Unix(0, c.lastActive.Load()).Add(c.limits.Idle)
+	}
+	if c.limits.Lifetime > 0 {
+		if end := c.started.Add(c.limits.Lifetime); d.IsZero() || end.Before(d) {
+			d = end
+		}
+	}
+	return d
+}
+
+// expired 读超时后判断连接是否真的到期。另一方向仍有数据时空闲计时被刷新，应继续读取
+func (c *connClock) expired() bool {
+	return !time.Now().Before(c.deadline())
+}
+
+// isTimeout 是否为读写超时错误
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ConnSlots 同时连接数上限，共用 active 计数的多个转发合计不超过 max
+type ConnSlots struct {
+	max    int64
+	active *atomic.Int64
+}
+
+// NewConnSlots 创建连接数上限，max 不大于 0 时返回 nil（不限制）
+func NewConnSlots(max int64, active *atomic.Int64) *ConnSlots {
+	if max <= 0 {
+		return nil
+	}
+	return &ConnSlots{max: max, active: active}
+}
+
+// acquire 占用一个连接名额，已达上限时返回 false。s 为 nil 时不限制
+func (s *ConnSlots) acquire() bool {
+	if s == nil {
+		return true
+	}
+	if s.active.Add(1) > s.max {
+		s.active.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release 释放 acquire 占用的名额
+func (s *ConnSlots) release() {
+	if s != nil {
+		s.active.Add(-1)
+	}
+}
@@ -0,0 +1,297 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// trackedConn 一个正在转发的连接
+type trackedConn struct {
+	id         uint64
+	client     net.Conn
+	target     net.Conn // 连接目标成功前为 nil
+	targetAddr string
+	started    time.Time
+	bytesIn    atomic.Int64 // 客户端 -> 目标
+	bytesOut   atomic.Int64 // 目标 -> 客户端
+}
+
+// nextConnID 连接ID，进程内唯一
+var nextConnID atomic.Uint64
+
+// ConnInfo 一个活动连接的信息
+type ConnInfo struct {
+	ID         uint64    `json:"id"`
+	Protocol   string    `json:"protocol"`
+	ListenAddr string    `json:"listenAddr"`
+	ListenPort string    `json:"listenPort"`
+	RuleID     string    `json:"ruleId,omitempty"`
+	Client     string    `json:"client"`
+	Target     string    `json:"target,omitempty"` // 连接目标成功前为空
+	Started    time.Time `json:"started"`
+	BytesIn    int64     `json:"bytesIn"`
+	BytesOut   int64     `json:"bytesOut"`
+	Draining   bool      `json:"draining,omitempty"`
+}
+
+// connTracker 记录单个转发的活动连接，用于排空与强制关闭
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+// add 登记新连接
+func (t *connTracker) add(client net.Conn) *trackedConn {
+	c := &trackedConn{id: nextConnID.Add(1), client: client, started: time.Now()}
+	t.mu.Lock()
+	t.conns[c] = struct{}{}
+	t.mu.Unlock()
+	return c
+}
+
+// setTarget 记录连接对应的目标连接
+func (t *connTracker) setTarget(c *trackedConn, target net.Conn) {
+	t.mu.Lock()
+	c.target = target
+	c.targetAddr = target.RemoteAddr().String()
+	t.mu.Unlock()
+}
+
+// remove 连接结束时注销
+func (t *connTracker) remove(c *trackedConn) {
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+}
+
+// count 当前活动连接数
+func (t *connTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// list 列出所有连接，监听地址由 key 拆出
+func (t *connTracker) list(key string, draining bool) []ConnInfo {
+	protocol, _, _ := strings.Cut(key, ":")
+	listen := splitForwardKey(key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]ConnInfo, 0, len(t.conns))
+	for c := range t.conns {
+		list = append(list, ConnInfo{
+			ID:         c.id,
+			Protocol:   protocol,
+			ListenAddr: listen[0],
+			ListenPort: listen[1],
+			Client:     c.client.RemoteAddr().String(),
+			Target:     c.targetAddr,
+			Started:    c.started,
+			BytesIn:    c.bytesIn.Load(),
+			BytesOut:   c.bytesOut.Load(),
+			Draining:   draining,
+		})
+	}
+	return list
+}
+
+// kill 强制关闭指定ID的连接，连接不在本转发中时返回 false
+func (t *connTracker) kill(id uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.conns {
+		if c.id != id {
+			continue
+		}
+		c.client.Close()
+		if c.target != nil {
+			c.target.Close()
+		}
+		return true
+	}
+	return false
+}
+
+// closeAll 强制关闭所有连接，返回关闭的数量
+func (t *connTracker) closeAll() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.conns {
+		c.client.Close()
+		if c.target != nil {
+			c.target.Close()
+		}
+	}
+	return len(t.conns)
+}
+
+// DrainStatus 排空中的转发进度
+type DrainStatus struct {
+	Protocol   string    `json:"protocol"`
+	ListenAddr string    `json:"listenAddr"`
+	ListenPort string    `json:"listenPort"`
+	Target     string    `json:"target,omitempty"` // 转发的目标 addr:port
+	StartedAt  time.Time `json:"startedAt"`
+	Deadline   time.Time `json:"deadline"`
+	Initial    int       `json:"initial"`   // 开始排空时的连接数
+	Remaining  int       `json:"remaining"` // 尚未结束的连接数
+}
+
+// drainState 一个排空过程
+type drainState struct {
+	key     string
+	status  DrainStatus
+	tracker *connTracker
+	cancel  context.CancelFunc // 排空结束后取消转发的 context
+}
+
+// DrainTCPForward 立即停止接受新连接，已有连接最多保留 grace 后强制关闭
+func (f *Forwarder) DrainTCPForward(listenAddr, listenPort string, grace time.Duration) error {
+	if IsPortRange(listenPort) {
+		return f.drainPortRange(listenAddr, listenPort, grace)
+	}
+	key := forwardKey("tcp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否在运行
+	listener, exists := f.tcpListeners[key]
+	if !exists {
+		return fmt.Errorf("TCP forward not running on %s", net.JoinHostPort(listenAddr, listenPort))
+	}
+
+	// 关闭监听器，不再接受新连接
+	if err := (*listener).Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to close listener: %w", err)
+	}
+
+	tracker := f.conns[key]
+	fc := f.contexts[key]
+	delete(f.tcpListeners, key)
+	target := f.targets[key]
+	delete(f.targets, key)
+	f.changed()
+	delete(f.stats, key)
+	delete(f.conns, key)
+	delete(f.contexts, key)
+	delete(f.recovering, key)
+
+	now := time.Now()
+	drain := &drainState{
+		key: key,
+		status: DrainStatus{
+			Protocol:   "tcp",
+			ListenAddr: listenAddr,
+			ListenPort: listenPort,
+			Target:     target,
+			StartedAt:  now,
+			Deadline:   now.Add(grace),
+			Initial:    tracker.count(),
+		},
+		tracker: tracker,
+		cancel:  fc.cancel,
+	}
+	f.drains = append(f.drains, drain)
+	go f.waitDrain(drain)
+
+	f.listenLog(listenAddr, listenPort, target).Infof("Draining TCP forward: %s (%d connections, grace %s)", net.JoinHostPort(listenAddr, listenPort), drain.status.Initial, grace)
+	return nil
+}
+
+// waitDrain 等待连接自然结束，超时后强制关闭剩余连接
+func (f *Forwarder) waitDrain(drain *drainState) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for drain.tracker.count() > 0 && time.Now().Before(drain.status.Deadline) {
+		<-ticker.C
+	}
+	lg := f.listenLog(drain.status.ListenAddr, drain.status.ListenPort, drain.status.Target)
+	n := drain.tracker.closeAll()
+	drain.cancel()
+	if n > 0 {
+		lg.Warnf("Drain of %s timed out, force-closed %d connections", net.JoinHostPort(drain.status.ListenAddr, drain.status.ListenPort), n)
+	} else {
+		lg.Infof("Drain of %s completed", net.JoinHostPort(drain.status.ListenAddr, drain.status.ListenPort))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, d := range f.drains {
+		if d == drain {
+			f.drains = append(f.drains[:i], f.drains[i+1:]...)
+			break
+		}
+	}
+}
+
+// Drains 返回正在排空的转发及进度
+func (f *Forwarder) Drains() []DrainStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := make([]DrainStatus, 0, len(f.drains))
+	for _, d := range f.drains {
+		status := d.status
+		status.Remaining = d.tracker.count()
+		list = append(list, status)
+	}
+	return list
+}
+
+// DrainStatus 查找指定监听地址正在进行的排空
+func (f *Forwarder) DrainStatus(protocol, listenAddr, listenPort string) (DrainStatus, bool) {
+	for _, d := range f.Drains() {
+		if d.Protocol == protocol && d.ListenAddr == listenAddr && d.ListenPort == listenPort {
+			return d, true
+		}
+	}
+	return DrainStatus{}, false
+}
+
+// Connections 列出所有 TCP 与 SOCKS5 转发的活动连接（含排空中的），最早建立的在前
+func (f *Forwarder) Connections() []ConnInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []ConnInfo{}
+	for key, tracker := range f.conns {
+		list = append(list, tracker.list(key, false)...)
+	}
+	for _, d := range f.drains {
+		list = append(list, d.tracker.list(d.key, true)...)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// KillConnection 强制关闭指定ID的连接，找不到时返回 false
+func (f *Forwarder) KillConnection(id uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, tracker := range f.conns {
+		if tracker.kill(id) {
+			return true
+		}
+	}
+	for _, d := range f.drains {
+		if d.tracker.kill(id) {
+			return true
+		}
+	}
+	return false
+}
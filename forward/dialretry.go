@@ -0,0 +1,101 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// maxHoldSeconds 保持客户端连接等待目标恢复的最长时间
+const maxHoldSeconds = 300
+
+// DialRetry 连接目标失败时的重试配置（仅TCP）。重试期间客户端连接保持打开，
+// 适用于频繁重启的后端
+type DialRetry struct {
+	Attempts     int `json:"attempts,omitempty"`     // 首次失败后的重试次数
+	BackoffMs    int `json:"backoffMs,omitempty"`    // 首次重试前的等待时间，之后每次翻倍，默认200毫秒
+	MaxBackoffMs int `json:"maxBackoffMs,omitempty"` // 两次重试间的最长等待，默认5000毫秒
+	HoldSeconds  int `json:"holdSeconds,omitempty"`  // 大于0时不限重试次数，保持连接直到目标可用或超时
+}
+
+// WithDefaults 填充默认值
+func (c DialRetry) WithDefaults() DialRetry {
+	if c.BackoffMs <= 0 {
+		c.BackoffMs = 200
+	}
+	if c.MaxBackoffMs <= 0 {
+		c.MaxBackoffMs = 5000
+	}
+	if c.MaxBackoffMs < c.BackoffMs {
+		c.MaxBackoffMs = c.BackoffMs
+	}
+	return c
+}
+
+// Validate 校验重试配置
+func (c DialRetry) Validate() error {
+	if c.Attempts < 0 || c.BackoffMs < 0 || c.MaxBackoffMs < 0 || c.HoldSeconds < 0 {
+		return errors.New("retry values must not be negative")
+	}
+	if c.Attempts > 100 {
+		return errors.New("at most 100 retry attempts are allowed")
+	}
+	if c.HoldSeconds > maxHoldSeconds {
+		return fmt.Errorf("hold time must be at most %d seconds", maxHoldSeconds)
+	}
+	return nil
+}
+
+// Enabled 是否需要重试，nil 安全
+func (c *DialRetry) Enabled() bool {
+	return c != nil && (c.Attempts > 0 || c.HoldSeconds > 0)
+}
+
+// dialWithRetry 以 dial 连接目标，失败时按配置退避重试。配置了 HoldSeconds 时一直重试到超时，
+// 否则最多重试 Attempts 次，ctx 取消时不再重试。返回最后一次的错误
+func dialWithRetry(ctx context.Context, target string, dial func() (net.Conn, error), retry *DialRetry, lg Logger) (net.Conn, error) {
+	conn, err := dial()
+	if err == nil || !retry.Enabled() {
+		return conn, err
+	}
+
+	cfg := retry.WithDefaults()
+	var deadline time.Time
+	if cfg.HoldSeconds > 0 {
+		deadline = time.Now().Add(time.Duration(cfg.HoldSeconds) * time.Second)
+	}
+	backoff := time.Duration(cfg.BackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(cfg.MaxBackoffMs) * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		if deadline.IsZero() && attempt > cfg.Attempts {
+			return nil, err
+		}
+		wait := backoff
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return nil, fmt.Errorf("target not available after %ds: %w", cfg.HoldSeconds, err)
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+		lg.Debugf("Dial to %s failed (%v), retry %d in %v", target, err, attempt, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if conn, err = dial(); err == nil {
+			lg.Infof("Connected to target %s after %d retries", target, attempt)
+			return conn, nil
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
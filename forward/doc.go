@@ -0,0 +1,18 @@
+// Package forward 是 go-ports 的端口转发引擎，支持 TCP、UDP、SCTP 与 SOCKS5，
+// 不依赖管理界面，可以单独嵌入其他程序：
+//
+//	f := forward.New()
+//	f.Options = func(listenAddr, listenPort string) forward.Options {
+//		return forward.Options{Limits: forward.ConnLimits{Idle: 5 * time.Minute}}
+//	}
+//	if err := f.StartTCPForward("0.0.0.0", "8080", "10.0.0.2", "80"); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer f.Shutdown(10 * time.Second)
+//
+// 监听端口可以是 "8000-8100" 形式的范围，目标端口逐个对应。
+// Forwarder 的导出字段都是可选的钩子，应在启动第一个转发之前设置：
+// Allow 过滤来源，Options 提供每个监听地址的转发选项，Log/ListenLog 接管日志，
+// Observe 接收每个连接的拨号与关闭事件（访问日志、链路追踪），Country 开启按国家统计，
+// AutoRestart 让意外退出的监听按退避自动重新监听。
+package forward
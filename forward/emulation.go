@@ -0,0 +1,222 @@
+package forward
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// NetEmulation 网络状况模拟配置，用于测试应用在弱网下的表现
+type NetEmulation struct {
+	Enabled     bool    `json:"enabled"`
+	LatencyMs   int     `json:"latencyMs"`   // 单向附加延迟
+	JitterMs    int     `json:"jitterMs"`    // 延迟随机浮动范围（±）
+	LossPercent float64 `json:"lossPercent"` // 丢包率 0-100
+}
+
+// tcpLossPenalty 流式连接无法真正丢包，按一次重传超时计算额外延迟
+const tcpLossPenalty = 200 * time.Millisecond
+
+// impairedFlushTimeout 半关闭连接时等待排队数据发送的最长时间
+const impairedFlushTimeout = 5 * time.Second
+
+// Validate 校验模拟配置
+func (e *NetEmulation) Validate() error {
+	if e.LatencyMs < 0 || e.JitterMs < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	if e.LossPercent < 0 || e.LossPercent > 100 {
+		return errors.New("loss percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// Active 是否需要模拟，nil 安全
+func (e *NetEmulation) Active() bool {
+	return e != nil && e.Enabled && (e.LatencyMs > 0 || e.JitterMs > 0 || e.LossPercent > 0)
+}
+
+// delay 本次发送的延迟：延迟 ± 抖动
+func (e *NetEmulation) delay() time.Duration {
+	if !e.Active() {
+		return 0
+	}
+	ms := e.LatencyMs
+	if e.JitterMs > 0 {
+		ms += rand.Intn(2*e.JitterMs+1) - e.JitterMs
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// drop 本次发送是否丢包
+func (e *NetEmulation) drop() bool {
+	return e.Active() && e.LossPercent > 0 && rand.Float64()*100 < e.LossPercent
+}
+
+// delayedChunk 等待发送的数据块
+type delayedChunk struct {
+	data []byte
+	due  time.Time
+}
+
+// impairedConn 对写入方向施加延迟、抖动与丢包（重传延迟），保持数据顺序
+type impairedConn struct {
+	net.Conn
+	emu   *NetEmulation
+	queue chan delayedChunk
+	stop  chan struct{} // 停止接受写入时关闭，queue 始终不关闭，避免向已关闭的通道发送
+	abort chan struct{} // Close 时关闭，丢弃还在排队的数据
+	done  chan struct{}
+
+	mu      sync.Mutex
+	last    time.Time // 上一块的发送时间，抖动不会导致乱序
+	err     error
+	closed  bool
+	aborted bool
+}
+
+// newImpairedConn 包装连接，写入的数据经模拟后由后台协程发送
+func newImpairedConn(conn net.Conn, emu *NetEmulation) *impairedConn {
+	c := &impairedConn{
+		Conn:  conn,
+		emu:   emu,
+		queue: make(chan delayedChunk, 256),
+		stop:  make(chan struct{}),
+		abort: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+func (c *impairedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.err != nil || c.closed {
+		err := c.err
+		c.mu.Unlock()
+		if err == nil {
+			err = net.ErrClosed
+		}
+		return 0, err
+	}
+	due := time.Now().Add(c.emu.delay())
+	if c.emu.drop() {
+		due = due.Add(tcpLossPenalty)
+	}
+	if due.Before(c.last) {
+		due = c.last
+	}
+	c.last = due
+	c.mu.Unlock()
+
+	// 另一方向出错时会并发关闭本连接，此时不再排队
+	select {
+	case c.queue <- delayedChunk{data: append([]byte(nil), p...), due: due}:
+		return len(p), nil
+	case <-c.stop:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *impairedConn) writeLoop() {
+	defer close(c.done)
+	for {
+		select {
+		case chunk := <-c.queue:
+			if !c.send(chunk) {
+				c.discard()
+				return
+			}
+		case <-c.stop:
+			// 发送完已排队的数据，Close 时不再发送
+			for {
+				select {
+				case <-c.abort:
+					return
+				case chunk := <-c.queue:
+					if !c.send(chunk) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-c.abort:
+			return
+		}
+	}
+}
+
+// send 到期后发送一块数据，失败或 Close 时返回 false；失败时记下错误，之后的写入直接返回该错误
+func (c *impairedConn) send(chunk delayedChunk) bool {
+	if d := time.Until(chunk.due); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.abort:
+			return false
+		}
+	}
+	if _, err := c.Conn.Write(chunk.data); err != nil {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// discard 出错后丢弃排队的数据，直到连接关闭，避免写入方阻塞在已满的队列上
+func (c *impairedConn) discard() {
+	for {
+		select {
+		case <-c.queue:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Close 立即关闭连接，丢弃还在延迟中的数据，不等待发送：停止转发或强制断开连接时不会被拖住。
+// 正常结束时转发先以 CloseWrite 发送完数据
+func (c *impairedConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.stop)
+	}
+	if !c.aborted {
+		c.aborted = true
+		close(c.abort)
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// CloseWrite 发送完已排队的数据后半关闭连接，之后不能再写入
+func (c *impairedConn) CloseWrite() error {
+	c.flush()
+	return closeWrite(c.Conn)
+}
+
+// flush 停止接受写入并等待已排队的数据发送完，最多等待 impairedFlushTimeout
+func (c *impairedConn) flush() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.stop)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-c.abort:
+	case <-time.After(impairedFlushTimeout):
+	}
+}
@@ -0,0 +1,1065 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Forwarder 端口转发器
+type Forwarder struct {
+	tcpListeners   map[string]*net.Listener
+	udpListeners   map[string]*net.UDPConn
+	sctpListeners  map[string]net.Listener
+	socksListeners map[string]net.Listener
+	stats          map[string]*Stats
+	conns          map[string]*connTracker      // 活动连接（TCP）
+	targets        map[string]string            // 每个转发当前连接的目标 addr:port，SOCKS5 为空
+	contexts       map[string]forwardContext    // 每个转发的 context，停止时取消以结束其所有连接
+	restarting     map[string]bool              // 正在 Restart 的转发，停止时保留 context
+	recovering     map[string]*ListenerRecovery // 监听意外退出、等待重新监听的转发
+	drains         []*drainState                // 正在排空的转发
+	mu             sync.Mutex
+
+	// Allow 判断来源IP是否允许通过某个监听地址转发，target 为转发的目标 addr:port（SOCKS5 为空），
+	// 多条规则监听同一地址时用于区分。为 nil 时全部允许
+	Allow func(listenAddr, listenPort, target string, ip net.IP) bool
+	// Options 启动转发时获取该监听地址的转发选项，target 为转发的目标 addr:port（SOCKS5 为空），
+	// 多条规则监听同一地址时用于区分。为 nil 时使用默认值
+	Options func(listenAddr, listenPort, target string) Options
+	// Limiter 所有转发共享的带宽限制器，为 nil 时不限速
+	Limiter *BandwidthLimiter
+	// Guard 进程级资源保护，为 nil 时不限制
+	Guard *ResourceGuard
+	// OnChange 转发启动或停止后调用（持有内部锁，不能阻塞或回调 Forwarder），为 nil 时忽略
+	OnChange func()
+	// AutoRestart 监听器意外出错后按退避重新监听，期间转发保持运行状态，可通过 Recovery 查询进度。
+	// 为 nil 时直接停止转发
+	AutoRestart *RestartPolicy
+	// OnListenerFailed 监听器意外出错（不是停止转发导致）时调用；未设置 AutoRestart 或放弃重新监听时
+	// 转发已停止。target 为该转发的目标 addr:port（SOCKS5 为空）。为 nil 时忽略
+	OnListenerFailed func(protocol, listenAddr, listenPort, target string, err error)
+	// OnListenerRecovered 自动重新监听成功后调用，attempts 为尝试的次数。为 nil 时忽略
+	OnListenerRecovered func(protocol, listenAddr, listenPort, target string, attempts int)
+
+	// Log 未关联规则时的日志记录器，为 nil 时写入标准库 log
+	Log Logger
+	// ListenLog 返回监听地址与目标对应的日志记录器，用于停止与排空转发的日志，为 nil 时使用 Log
+	ListenLog func(listenAddr, listenPort, target string) Logger
+	// ClientLabel 日志中客户端的显示名称，为 nil 时使用 addr.String()
+	ClientLabel func(addr net.Addr) string
+	// Observe 在连接（TCP/SCTP/SOCKS5）开始时调用，返回的观察者接收拨号与关闭事件，
+	// 可用于访问日志与链路追踪。为 nil 或返回 nil 时忽略
+	Observe func(protocol string, conn net.Conn, target string, lg Logger) ConnObserver
+	// Country 返回来源IP的国家代码，用于按国家统计流量。为 nil 或返回空字符串时不统计
+	Country func(ip net.IP) string
+	// BufferSize 返回 TCP 转发的缓冲区大小与 UDP 数据报的读取缓冲区大小，为 nil 或返回值不大于 0 时使用默认值。
+	// 超过 UDP 缓冲区的数据报会被丢弃
+	BufferSize func() (tcp, udp int)
+	// SocketBuffer 返回 UDP 套接字的收发缓冲区（SO_RCVBUF/SO_SNDBUF）大小，为 nil 或返回值不大于 0 时使用系统默认值
+	SocketBuffer func() int
+}
+
+// ConnObserver 接收单个连接的生命周期事件
+type ConnObserver interface {
+	// DialStarted 开始连接目标
+	DialStarted()
+	// DialDone 连接目标完成，err 为 nil 表示成功
+	DialDone(err error)
+	// Closed 连接结束，bytesIn/bytesOut 为客户端到目标与目标到客户端的字节数
+	Closed(bytesIn, bytesOut int64)
+}
+
+// nopObserver 未设置 Observe 时使用的观察者
+type nopObserver struct{}
+
+func (nopObserver) DialStarted()        {}
+func (nopObserver) DialDone(error)      {}
+func (nopObserver) Closed(int64, int64) {}
+
+// Protocols 支持的转发协议
+var Protocols = []string{"tcp", "udp", "sctp", "socks5"}
+
+// 缓冲区的默认大小
+const (
+	DefaultTCPBufferSize = 32 * 1024
+	DefaultUDPBufferSize = 65535
+)
+
+// Options 单个转发的可选行为
+type Options struct {
+	LogJA3    bool          // 记录客户端 TLS ClientHello 的 JA3 指纹（仅TCP）
+	Emulation *NetEmulation // 弱网模拟，为 nil 时不启用
+	Priority  int           // 共享带宽饱和时的优先级，见 PriorityHigh 等，零值为普通优先级
+	TLS       *tls.Config   // 非 nil 时以 TLS 连接目标（仅TCP）
+	SOCKS5    *SOCKS5Config // SOCKS5 模式的认证
+	Log       Logger        // 带规则ID的日志记录器，为 nil 时使用 Forwarder.Log
+	Targets   []string      // 额外的目标 addr:port，与主目标一起分配新连接（仅TCP）
+	Balance   string        // 多个目标时的负载均衡方式，见 BalanceRoundRobin 等
+	Routes    []Route       // 路由表：按 TLS SNI、HTTP Host 或开头的字节选择目标，没有匹配时使用上面的目标（仅TCP）
+
+	Healthy func(target string) bool // 目标是否健康，为 nil 时不检查（仅TCP）
+	Backup  string                   // 所有目标都不健康时使用的备用目标 addr:port（仅TCP）
+	Retry   *DialRetry               // 连接目标失败时的重试，为 nil 时不重试（仅TCP）
+	TCP     *TCPTuning               // 两侧连接的保活、TCP_NODELAY 与连接目标的超时（TCP/SOCKS5）
+	Dialer  Dialer                   // 连接目标使用的拨号器，如 SSH 跳板机，为 nil 时直接连接（TCP/SOCKS5）
+	Bind    *OutboundBind            // 连接目标的出接口与源地址，为 nil 时按系统路由（TCP/UDP/SOCKS5）
+
+	Transparent bool      // 以客户端IP作为源地址连接目标（仅Linux TCP）
+	Relay       *UDPRelay // 组播/广播中继模式，为 nil 或未启用时按普通UDP转发（仅UDP）
+
+	Limits ConnLimits // 连接空闲超时与最长存活时间（TCP/SCTP/SOCKS5），UDP 会话的空闲超时
+	Slots  *ConnSlots // 规则的同时连接数上限，为 nil 时不限制（TCP/SCTP/SOCKS5）
+
+	Tap Tap // 抓包，为 nil 时不记录（TCP/UDP/SOCKS5）
+}
+
+// ErrRunning 监听地址上已有同一协议的转发
+var ErrRunning = errors.New("already running")
+
+// New 创建新的端口转发器，启动转发前可设置各个可选字段
+func New() *Forwarder {
+	return &Forwarder{
+		tcpListeners:   make(map[string]*net.Listener),
+		udpListeners:   make(map[string]*net.UDPConn),
+		sctpListeners:  make(map[string]net.Listener),
+		socksListeners: make(map[string]net.Listener),
+		stats:          make(map[string]*Stats),
+		conns:          make(map[string]*connTracker),
+		targets:        make(map[string]string),
+		contexts:       make(map[string]forwardContext),
+		restarting:     make(map[string]bool),
+		recovering:     make(map[string]*ListenerRecovery),
+	}
+}
+
+// StartTCPForward 启动TCP端口转发
+func (f *Forwarder) StartTCPForward(listenAddr, listenPort, targetAddr, targetPort string) error {
+	if IsPortRange(listenPort) {
+		return f.startPortRange("tcp", listenAddr, listenPort, targetAddr, targetPort)
+	}
+	key := forwardKey("tcp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否已经在运行
+	if _, exists := f.tcpListeners[key]; exists {
+		return fmt.Errorf("TCP forward %w on %s (target %s)", ErrRunning, net.JoinHostPort(listenAddr, listenPort), f.targets[key])
+	}
+
+	// 监听本地端口
+	addr := net.JoinHostPort(listenAddr, listenPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	// 保存监听器
+	f.tcpListeners[key] = &listener
+	f.targets[key] = net.JoinHostPort(targetAddr, targetPort)
+	f.changed()
+	stats := &Stats{}
+	f.stats[key] = stats
+	conns := newConnTracker()
+	f.conns[key] = conns
+
+	// 启动转发协程
+	opts := f.options(listenAddr, listenPort, f.targets[key])
+	ctx := f.begin(key)
+	go f.serve(ctx, "tcp", listenAddr, listenPort, listener, func(l io.Closer) error {
+		return f.handleTCPForward(ctx, l.(net.Listener), targetAddr, targetPort, stats, conns, f.allowFunc(listenAddr, listenPort, f.targets[key]), opts)
+	}, func() (io.Closer, error) {
+		return net.Listen("tcp", addr)
+	})
+
+	opts.Log.Infof("Started TCP forward: %s -> %s", net.JoinHostPort(listenAddr, listenPort), net.JoinHostPort(targetAddr, targetPort))
+	return nil
+}
+
+// StopTCPForward 停止TCP端口转发
+func (f *Forwarder) StopTCPForward(listenAddr, listenPort string) error {
+	if IsPortRange(listenPort) {
+		return f.stopPortRange("tcp", listenAddr, listenPort)
+	}
+	key := forwardKey("tcp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否在运行
+	listener, exists := f.tcpListeners[key]
+	if !exists {
+		return fmt.Errorf("TCP forward not running on %s", net.JoinHostPort(listenAddr, listenPort))
+	}
+
+	// 关闭监听器
+	if err := (*listener).Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to close listener: %w", err)
+	}
+
+	// 删除监听器
+	delete(f.tcpListeners, key)
+	target := f.targets[key]
+	delete(f.targets, key)
+	f.changed()
+	delete(f.stats, key)
+	f.end(key)
+	delete(f.conns, key)
+
+	f.listenLog(listenAddr, listenPort, target).Infof("Stopped TCP forward: %s", net.JoinHostPort(listenAddr, listenPort))
+	return nil
+}
+
+// StartUDPForward 启动UDP端口转发
+func (f *Forwarder) StartUDPForward(listenAddr, listenPort, targetAddr, targetPort string) error {
+	if IsPortRange(listenPort) {
+		return f.startPortRange("udp", listenAddr, listenPort, targetAddr, targetPort)
+	}
+	key := forwardKey("udp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否已经在运行
+	if _, exists := f.udpListeners[key]; exists {
+		return fmt.Errorf("UDP forward %w on %s (target %s)", ErrRunning, net.JoinHostPort(listenAddr, listenPort), f.targets[key])
+	}
+
+	// 解析监听地址
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(listenAddr, listenPort))
+	if err != nil {
+		return fmt.Errorf("failed to resolve listen address: %w", err)
+	}
+
+	// 中继模式需要在监听前知道组播组所在的网卡
+	target := net.JoinHostPort(targetAddr, targetPort)
+	opts := f.options(listenAddr, listenPort, target)
+	listen := func() (*net.UDPConn, error) {
+		if opts.Relay.active() {
+			return listenUDPRelay(addr, opts.Relay)
+		}
+		return net.ListenUDP("udp", addr)
+	}
+	handle := f.handleUDPForward
+	if opts.Relay.active() {
+		handle = f.handleUDPRelay
+	}
+
+	// 监听UDP端口
+	conn, err := listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", net.JoinHostPort(listenAddr, listenPort), err)
+	}
+
+	// 保存连接
+	f.udpListeners[key] = conn
+	f.targets[key] = target
+	f.changed()
+	stats := &Stats{}
+	f.stats[key] = stats
+
+	// 启动转发协程
+	ctx := f.begin(key)
+	go f.serve(ctx, "udp", listenAddr, listenPort, conn, func(l io.Closer) error {
+		return handle(ctx, l.(*net.UDPConn), targetAddr, targetPort, stats, f.allowFunc(listenAddr, listenPort, target), opts)
+	}, func() (io.Closer, error) {
+		conn, err := listen()
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+
+	mode := "forward"
+	if opts.Relay.active() {
+		mode = "relay"
+	}
+	opts.Log.Infof("Started UDP %s: %s -> %s", mode, net.JoinHostPort(listenAddr, listenPort), target)
+	return nil
+}
+
+// StopUDPForward 停止UDP端口转发
+func (f *Forwarder) StopUDPForward(listenAddr, listenPort string) error {
+	if IsPortRange(listenPort) {
+		return f.stopPortRange("udp", listenAddr, listenPort)
+	}
+	key := forwardKey("udp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否在运行
+	conn, exists := f.udpListeners[key]
+	if !exists {
+		return fmt.Errorf("UDP forward not running on %s", net.JoinHostPort(listenAddr, listenPort))
+	}
+
+	// 关闭连接
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to close UDP connection: %w", err)
+	}
+
+	// 删除连接
+	delete(f.udpListeners, key)
+	target := f.targets[key]
+	delete(f.targets, key)
+	f.changed()
+	delete(f.stats, key)
+	f.end(key)
+
+	f.listenLog(listenAddr, listenPort, target).Infof("Stopped UDP forward: %s", net.JoinHostPort(listenAddr, listenPort))
+	return nil
+}
+
+// StartSCTPForward 启动SCTP端口转发（仅在支持SCTP的平台上可用）
+func (f *Forwarder) StartSCTPForward(listenAddr, listenPort, targetAddr, targetPort string) error {
+	if IsPortRange(listenPort) {
+		return f.startPortRange("sctp", listenAddr, listenPort, targetAddr, targetPort)
+	}
+	key := forwardKey("sctp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否已经在运行
+	if _, exists := f.sctpListeners[key]; exists {
+		return fmt.Errorf("SCTP forward %w on %s (target %s)", ErrRunning, net.JoinHostPort(listenAddr, listenPort), f.targets[key])
+	}
+
+	// 监听本地端口
+	addr := net.JoinHostPort(listenAddr, listenPort)
+	listener, err := ListenSCTP(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	// 保存监听器
+	f.sctpListeners[key] = listener
+	f.targets[key] = net.JoinHostPort(targetAddr, targetPort)
+	f.changed()
+	stats := &Stats{}
+	f.stats[key] = stats
+
+	// 启动转发协程
+	opts := f.options(listenAddr, listenPort, f.targets[key])
+	ctx := f.begin(key)
+	go f.serve(ctx, "sctp", listenAddr, listenPort, listener, func(l io.Closer) error {
+		return f.handleSCTPForward(ctx, l.(net.Listener), targetAddr, targetPort, stats, f.allowFunc(listenAddr, listenPort, f.targets[key]), opts)
+	}, func() (io.Closer, error) {
+		return ListenSCTP(addr)
+	})
+
+	opts.Log.Infof("Started SCTP forward: %s -> %s", net.JoinHostPort(listenAddr, listenPort), net.JoinHostPort(targetAddr, targetPort))
+	return nil
+}
+
+// StopSCTPForward 停止SCTP端口转发
+func (f *Forwarder) StopSCTPForward(listenAddr, listenPort string) error {
+	if IsPortRange(listenPort) {
+		return f.stopPortRange("sctp", listenAddr, listenPort)
+	}
+	key := forwardKey("sctp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否在运行
+	listener, exists := f.sctpListeners[key]
+	if !exists {
+		return fmt.Errorf("SCTP forward not running on %s", net.JoinHostPort(listenAddr, listenPort))
+	}
+
+	// 关闭监听器
+	if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to close listener: %w", err)
+	}
+
+	// 删除监听器
+	delete(f.sctpListeners, key)
+	target := f.targets[key]
+	delete(f.targets, key)
+	f.changed()
+	delete(f.stats, key)
+	f.end(key)
+
+	f.listenLog(listenAddr, listenPort, target).Infof("Stopped SCTP forward: %s", net.JoinHostPort(listenAddr, listenPort))
+	return nil
+}
+
+// forwardContext 一个转发的 context 及其取消函数
+type forwardContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// forwardKey 转发的内部键 "protocol:addr:port"。同一协议的一个监听地址同时只能有一个转发，
+// 多条规则监听同一地址时以 f.targets 中记录的目标区分正在运行的是哪一条
+func forwardKey(protocol, listenAddr, listenPort string) string {
+	return protocol + ":" + listenAddr + ":" + listenPort
+}
+
+// Target 返回监听地址上正在运行的转发的目标 addr:port（SOCKS5 为空），未运行时返回 false。
+// 端口范围返回第一个正在运行的端口的目标
+func (f *Forwarder) Target(protocol, listenAddr, listenPort string) (string, bool) {
+	if IsPortRange(listenPort) {
+		pairs, err := ExpandPortRange(listenPort, "")
+		if err != nil {
+			return "", false
+		}
+		for _, pair := range pairs {
+			if target, ok := f.Target(protocol, listenAddr, pair.Listen); ok {
+				return target, true
+			}
+		}
+		return "", false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, ok := f.targets[forwardKey(protocol, listenAddr, listenPort)]
+	return target, ok
+}
+
+// Restart 停止监听地址上的转发并以当前的 Options 重新启动，用于应用修改后的配置。
+// 已建立的连接继续转发，之后停止转发时与新连接一起关闭；重新启动失败时立即关闭
+func (f *Forwarder) Restart(protocol, listenAddr, listenPort, targetAddr, targetPort string) error {
+	ports := []string{listenPort}
+	if IsPortRange(listenPort) {
+		pairs, err := ExpandPortRange(listenPort, "")
+		if err != nil {
+			return err
+		}
+		ports = ports[:0]
+		for _, pair := range pairs {
+			ports = append(ports, pair.Listen)
+		}
+	}
+
+	keys := make([]string, len(ports))
+	f.mu.Lock()
+	for i, port := range ports {
+		keys[i] = forwardKey(protocol, listenAddr, port)
+		f.restarting[keys[i]] = true
+	}
+	f.mu.Unlock()
+
+	f.stopPort(protocol, listenAddr, listenPort)
+	err := f.startPort(protocol, listenAddr, listenPort, targetAddr, targetPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		delete(f.restarting, key)
+		if !f.listening(key) {
+			f.end(key)
+		}
+	}
+	return err
+}
+
+// listening 监听地址上是否有转发，调用方需持有 f.mu
+func (f *Forwarder) listening(key string) bool {
+	_, tcp := f.tcpListeners[key]
+	_, udp := f.udpListeners[key]
+	_, sctp := f.sctpListeners[key]
+	_, socks := f.socksListeners[key]
+	return tcp || udp || sctp || socks
+}
+
+// begin 为新启动的转发创建 context，重启时沿用原来的 context。调用方需持有 f.mu
+func (f *Forwarder) begin(key string) context.Context {
+	delete(f.recovering, key)
+	if fc, ok := f.contexts[key]; ok {
+		return fc.ctx
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.contexts[key] = forwardContext{ctx: ctx, cancel: cancel}
+	return ctx
+}
+
+// end 取消转发的 context，关闭其所有仍在转发的连接；正在重启的转发保留 context。调用方需持有 f.mu
+func (f *Forwarder) end(key string) {
+	delete(f.recovering, key)
+	if f.restarting[key] {
+		return
+	}
+	if fc, ok := f.contexts[key]; ok {
+		fc.cancel()
+		delete(f.contexts, key)
+	}
+}
+
+// closeOnCancel 在转发停止（ctx 取消）时关闭 c，使阻塞在读写上的协程退出。
+// 返回的函数在连接结束时调用，停止等待
+func closeOnCancel(ctx context.Context, stats *Stats, c io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		defer stats.track(1, 0, 0)()
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// serve 运行转发的处理循环，run 使用传入的监听器。循环因监听器出错而结束时调用 OnListenerFailed，
+// 设置了 AutoRestart 时用 relisten 重新监听并继续循环，否则停止该转发；转发已被停止或重新启动时不处理
+func (f *Forwarder) serve(ctx context.Context, protocol, listenAddr, listenPort string, listener io.Closer, run func(io.Closer) error, relisten func() (io.Closer, error)) {
+	key := forwardKey(protocol, listenAddr, listenPort)
+	for {
+		err := run(listener)
+		if err == nil {
+			return
+		}
+
+		f.mu.Lock()
+		current := f.contexts[key].ctx == ctx && f.ownsListenerLocked(protocol, key, listener)
+		target := f.targets[key]
+		var status *ListenerRecovery
+		if current && f.AutoRestart != nil {
+			// 先登记恢复状态，Reconcile 不会把等待重新监听的转发当作失效移除
+			status = &ListenerRecovery{Since: time.Now(), LastError: err.Error()}
+			f.recovering[key] = status
+		}
+		f.mu.Unlock()
+		if !current {
+			return
+		}
+
+		if f.OnListenerFailed != nil {
+			f.OnListenerFailed(protocol, listenAddr, listenPort, target, err)
+		}
+		if f.AutoRestart == nil {
+			f.stopPort(protocol, listenAddr, listenPort)
+			return
+		}
+		if listener = f.recover(ctx, protocol, listenAddr, listenPort, listener, status, relisten); listener == nil {
+			return
+		}
+	}
+}
+
+// allowFunc 生成某个监听地址上转发到 target 的来源过滤函数
+func (f *Forwarder) allowFunc(listenAddr, listenPort, target string) func(net.IP) bool {
+	return func(ip net.IP) bool {
+		if f.Allow == nil || ip == nil {
+			return true
+		}
+		return f.Allow(listenAddr, listenPort, target, ip)
+	}
+}
+
+// changed 通知转发的启停
+func (f *Forwarder) changed() {
+	if f.OnChange != nil {
+		f.OnChange()
+	}
+}
+
+// options 获取监听地址的转发选项
+func (f *Forwarder) options(listenAddr, listenPort, target string) Options {
+	var opts Options
+	if f.Options != nil {
+		opts = f.Options(listenAddr, listenPort, target)
+	}
+	if opts.Log == nil {
+		opts.Log = f.logger()
+	}
+	return opts
+}
+
+// logger 未关联规则时的日志记录器
+func (f *Forwarder) logger() Logger {
+	if f.Log == nil {
+		return stdLogger{}
+	}
+	return f.Log
+}
+
+// listenLog 监听地址对应的日志记录器
+func (f *Forwarder) listenLog(listenAddr, listenPort, target string) Logger {
+	if f.ListenLog != nil {
+		if lg := f.ListenLog(listenAddr, listenPort, target); lg != nil {
+			return lg
+		}
+	}
+	return f.logger()
+}
+
+// clientLabel 日志中客户端的显示名称
+func (f *Forwarder) clientLabel(addr net.Addr) string {
+	if f.ClientLabel != nil {
+		return f.ClientLabel(addr)
+	}
+	return addr.String()
+}
+
+// observe 为新连接创建观察者
+func (f *Forwarder) observe(protocol string, conn net.Conn, target string, lg Logger) ConnObserver {
+	if f.Observe != nil {
+		if obs := f.Observe(protocol, conn, target, lg); obs != nil {
+			return obs
+		}
+	}
+	return nopObserver{}
+}
+
+// recordCountry 按来源国家累计流量
+func (f *Forwarder) recordCountry(stats *Stats, ip net.IP, bytesIn, bytesOut int64) {
+	if f.Country == nil || ip == nil {
+		return
+	}
+	if country := f.Country(ip); country != "" {
+		stats.recordCountry(country, bytesIn, bytesOut)
+	}
+}
+
+// bufferSizes 当前的 TCP 与 UDP 缓冲区大小
+func (f *Forwarder) bufferSizes() (tcp, udp int) {
+	if f.BufferSize != nil {
+		tcp, udp = f.BufferSize()
+	}
+	if tcp <= 0 {
+		tcp = DefaultTCPBufferSize
+	}
+	if udp <= 0 {
+		udp = DefaultUDPBufferSize
+	}
+	return tcp, udp
+}
+
+func (f *Forwarder) tcpBufferSize() int {
+	tcp, _ := f.bufferSizes()
+	return tcp
+}
+
+func (f *Forwarder) udpBufferSize() int {
+	_, udp := f.bufferSizes()
+	return udp
+}
+
+// RemoteIP 提取连接来源IP，不是 TCP 或 UDP 地址时返回 nil
+func RemoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// IsTCPRunning 检查TCP转发是否运行
+func (f *Forwarder) IsTCPRunning(listenAddr, listenPort string) bool {
+	if IsPortRange(listenPort) {
+		return f.portRangeRunning("tcp", listenAddr, listenPort)
+	}
+	key := forwardKey("tcp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, exists := f.tcpListeners[key]
+	return exists
+}
+
+// IsUDPRunning 检查UDP转发是否运行
+func (f *Forwarder) IsUDPRunning(listenAddr, listenPort string) bool {
+	if IsPortRange(listenPort) {
+		return f.portRangeRunning("udp", listenAddr, listenPort)
+	}
+	key := forwardKey("udp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, exists := f.udpListeners[key]
+	return exists
+}
+
+// IsSCTPRunning 检查SCTP转发是否运行
+func (f *Forwarder) IsSCTPRunning(listenAddr, listenPort string) bool {
+	if IsPortRange(listenPort) {
+		return f.portRangeRunning("sctp", listenAddr, listenPort)
+	}
+	key := forwardKey("sctp", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, exists := f.sctpListeners[key]
+	return exists
+}
+
+// handleTCPForward 处理TCP转发，监听器关闭时返回 nil，意外出错时返回错误
+func (f *Forwarder) handleTCPForward(ctx context.Context, listener net.Listener, targetAddr, targetPort string, stats *Stats, conns *connTracker, allow func(net.IP) bool, opts Options) error {
+	pool := newTargetPool(net.JoinHostPort(targetAddr, targetPort), opts.Targets, opts.Balance)
+	pool.healthy, pool.backup = opts.Healthy, opts.Backup
+	routes := newRouter(opts.Routes)
+	defer stats.track(1, 1, 0)()
+
+	for {
+		// 接受新连接
+		conn, err := listener.Accept()
+		if err != nil {
+			// 检查是否是因为关闭监听器导致的错误
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				opts.Log.Warnf("Temporary error accepting connection: %v", err)
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				// 停止转发时关闭了监听器
+				opts.Log.Debugf("Listener closed: %v", err)
+				return nil
+			}
+			opts.Log.Errorf("Error accepting connection: %v", err)
+			return err
+		}
+
+		// 拒绝被拦截的来源
+		if !allow(RemoteIP(conn.RemoteAddr())) {
+			stats.Blocked.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 资源保护：超过进程级上限时拒绝新连接
+		if !f.Guard.admit() {
+			stats.Refused.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 规则的同时连接数上限
+		if !opts.Slots.acquire() {
+			f.Guard.release()
+			stats.OverLimit.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 处理连接
+		go func(conn net.Conn) {
+			defer conn.Close()
+			defer f.Guard.release()
+			defer opts.Slots.release()
+			defer stats.track(1, 1, 0)()
+			defer closeOnCancel(ctx, stats, conn)()
+
+			stats.TotalConns.Add(1)
+			stats.ActiveConns.Add(1)
+			defer stats.ActiveConns.Add(-1)
+
+			tracked := conns.add(conn)
+			defer conns.remove(tracked)
+			opts.TCP.apply(conn, opts.Log)
+
+			// 有路由表时按连接开头的数据选择目标，没有匹配的路由项时按负载均衡方式选择
+			var target string
+			if routes != nil {
+				sniffed := routes.sniff(conn)
+				conn = &prefixConn{Conn: conn, prefix: sniffed.data}
+				if routed, ok := routes.match(sniffed); ok {
+					opts.Log.Debugf("Routed %s (%s %q) to %s", f.clientLabel(conn.RemoteAddr()), sniffed.protocol, sniffed.host, routed)
+					target = routed
+				}
+			}
+			if target == "" {
+				picked, done := pool.acquire()
+				defer done()
+				target = picked
+			}
+
+			var bytesIn, bytesOut int64
+			obs := f.observe("tcp", conn, target, opts.Log)
+			defer func() { obs.Closed(bytesIn, bytesOut) }()
+
+			// 预读 ClientHello 计算 JA3，读到的数据随后原样转发
+			if opts.LogJA3 {
+				hello, err := readClientHello(conn, 5*time.Second)
+				if err == nil {
+					opts.Log.Infof("TLS client %s -> %s: JA3=%s SNI=%q", f.clientLabel(conn.RemoteAddr()), conn.LocalAddr(), hello.JA3Hash, hello.SNI)
+				} else {
+					opts.Log.Infof("TLS client %s -> %s: no JA3 (%v)", f.clientLabel(conn.RemoteAddr()), conn.LocalAddr(), err)
+				}
+				conn = &prefixConn{Conn: conn, prefix: hello.TLSRecord}
+			}
+
+			// 连接到目标服务器
+			obs.DialStarted()
+			d := net.Dialer{Timeout: opts.TCP.dialTimeout(0)}
+			dial := func() (net.Conn, error) { return opts.Bind.dial(ctx, d, "tcp", target) }
+			if opts.Dialer != nil {
+				dial = func() (net.Conn, error) { return dialVia(ctx, opts.Dialer, d.Timeout, target) }
+			} else if opts.Transparent {
+				client := conn.RemoteAddr()
+				dial = func() (net.Conn, error) { return dialTransparent(d, target, client) }
+			}
+			targetConn, err := dialWithRetry(ctx, target, dial, opts.Retry, opts.Log)
+			obs.DialDone(err)
+			if err != nil {
+				stats.DialFailures.Add(1)
+				opts.Log.Errorf("Error connecting to target %s: %v", target, err)
+				return
+			}
+			defer targetConn.Close()
+			defer stats.track(0, 1, 0)()
+			conns.setTarget(tracked, targetConn)
+			opts.TCP.apply(targetConn, opts.Log)
+
+			// 以 TLS 连接目标
+			if opts.TLS != nil {
+				tlsConn, err := dialTLSTarget(targetConn, opts.TLS)
+				if err != nil {
+					stats.DialFailures.Add(1)
+					opts.Log.Errorf("TLS handshake with target %s failed: %v", target, err)
+					return
+				}
+				targetConn = tlsConn
+			}
+
+			// 抓包：记录客户端一侧收发的数据
+			if opts.Tap != nil {
+				conn = &tapConn{Conn: conn, tap: opts.Tap, protocol: "tcp"}
+			}
+
+			// 弱网模拟：对两个方向的写入施加延迟与丢包
+			if opts.Emulation.Active() {
+				conn = newImpairedConn(conn, opts.Emulation)
+				targetConn = newImpairedConn(targetConn, opts.Emulation)
+				defer conn.Close()
+				defer targetConn.Close()
+			}
+
+			// 全局限速：按规则优先级共享带宽
+			if f.Limiter != nil {
+				conn = &limitedConn{Conn: conn, limiter: f.Limiter, priority: opts.Priority}
+				targetConn = &limitedConn{Conn: targetConn, limiter: f.Limiter, priority: opts.Priority}
+			}
+
+			// 双向转发数据
+			bytesIn, bytesOut = f.forwardData(conn, targetConn, stats, opts.Limits, tracked)
+			f.recordCountry(stats, RemoteIP(conn.RemoteAddr()), bytesIn, bytesOut)
+		}(conn)
+	}
+}
+
+// handleSCTPForward 处理SCTP转发，与TCP相同按连接双向转发
+func (f *Forwarder) handleSCTPForward(ctx context.Context, listener net.Listener, targetAddr, targetPort string, stats *Stats, allow func(net.IP) bool, opts Options) error {
+	target := net.JoinHostPort(targetAddr, targetPort)
+	defer stats.track(1, 1, 0)()
+
+	for {
+		// 接受新连接
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// 停止转发时关闭了监听器
+				opts.Log.Debugf("Listener closed: %v", err)
+				return nil
+			}
+			opts.Log.Errorf("Error accepting SCTP association: %v", err)
+			return err
+		}
+
+		// 拒绝被拦截的来源
+		if !allow(RemoteIP(conn.RemoteAddr())) {
+			stats.Blocked.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 资源保护：超过进程级上限时拒绝新连接
+		if !f.Guard.admit() {
+			stats.Refused.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 规则的同时连接数上限
+		if !opts.Slots.acquire() {
+			f.Guard.release()
+			stats.OverLimit.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 处理连接
+		go func(conn net.Conn) {
+			defer conn.Close()
+			defer f.Guard.release()
+			defer opts.Slots.release()
+			defer stats.track(1, 1, 0)()
+			defer closeOnCancel(ctx, stats, conn)()
+
+			stats.TotalConns.Add(1)
+			stats.ActiveConns.Add(1)
+			defer stats.ActiveConns.Add(-1)
+
+			var bytesIn, bytesOut int64
+			obs := f.observe("sctp", conn, target, opts.Log)
+			defer func() { obs.Closed(bytesIn, bytesOut) }()
+
+			// 连接到目标服务器
+			obs.DialStarted()
+			targetConn, err := dialSCTP(target)
+			obs.DialDone(err)
+			if err != nil {
+				stats.DialFailures.Add(1)
+				opts.Log.Errorf("Error connecting to SCTP target %s: %v", target, err)
+				return
+			}
+			defer targetConn.Close()
+			defer stats.track(0, 1, 0)()
+
+			// 弱网模拟：对两个方向的写入施加延迟与丢包
+			if opts.Emulation.Active() {
+				conn = newImpairedConn(conn, opts.Emulation)
+				targetConn = newImpairedConn(targetConn, opts.Emulation)
+				defer conn.Close()
+				defer targetConn.Close()
+			}
+
+			// 全局限速：按规则优先级共享带宽
+			if f.Limiter != nil {
+				conn = &limitedConn{Conn: conn, limiter: f.Limiter, priority: opts.Priority}
+				targetConn = &limitedConn{Conn: targetConn, limiter: f.Limiter, priority: opts.Priority}
+			}
+
+			// 双向转发数据
+			bytesIn, bytesOut = f.forwardData(conn, targetConn, stats, opts.Limits, nil)
+			f.recordCountry(stats, RemoteIP(conn.RemoteAddr()), bytesIn, bytesOut)
+		}(conn)
+	}
+}
+
+// handleUDPForward 处理UDP转发，每个客户端使用单独连接到目标的套接字，回复发回对应的客户端。
+// 监听器关闭时返回 nil，意外出错时返回错误
+func (f *Forwarder) handleUDPForward(ctx context.Context, conn *net.UDPConn, targetAddr, targetPort string, stats *Stats, allow func(net.IP) bool, opts Options) error {
+	// 解析目标地址
+	target, err := net.ResolveUDPAddr("udp", net.JoinHostPort(targetAddr, targetPort))
+	if err != nil {
+		opts.Log.Errorf("Error resolving target address: %v", err)
+		return err
+	}
+
+	return f.serveUDPSessions(ctx, conn, stats, allow, opts, udpSessionConfig{
+		dial: func() (*net.UDPConn, error) { return opts.Bind.dialUDP(target) },
+		send: func(out *net.UDPConn, p []byte) error {
+			_, err := out.Write(p)
+			return err
+		},
+	})
+}
+
+// forwardBufPool 转发缓冲区池，连接结束后缓冲区归还复用。
+// 设置中的缓冲区大小改变后，旧大小的缓冲区不再放回池中
+var forwardBufPool sync.Pool
+
+// forwardData 双向转发数据，并把字节数计入 stats 与 tracked（可为 nil），返回本连接的上行/下行字节数。
+// 一个方向读到 EOF 时半关闭另一端的写方向，另一方向继续传输直到对端也关闭；
+// 任一方向出错时关闭两端。limits 非零时通过读超时关闭空闲或存活过久的连接
+func (f *Forwarder) forwardData(src, dst net.Conn, stats *Stats, limits ConnLimits, tracked *trackedConn) (int64, int64) {
+	var wg sync.WaitGroup
+	var bytesIn, bytesOut int64
+	bufSize := f.tcpBufferSize()
+	defer stats.track(2, 0, int64(2*bufSize))()
+
+	var clock *connClock
+	if limits.active() {
+		clock = newConnClock(limits)
+	}
+
+	// 从 from 复制到 to
+	pipe := func(from, to net.Conn, counter, connCounter *atomic.Int64, total *int64) {
+		defer wg.Done()
+		buf, _ := forwardBufPool.Get().(*[]byte)
+		if buf == nil || len(*buf) != bufSize {
+			b := make([]byte, bufSize)
+			buf = &b
+		}
+		defer func() {
+			if len(*buf) == f.tcpBufferSize() {
+				forwardBufPool.Put(buf)
+			}
+		}()
+
+		w := &meteredWriter{w: to, counter: counter, connCounter: connCounter, clock: clock}
+		n, err := io.CopyBuffer(w, &deadlineReader{conn: from, clock: clock}, *buf)
+		*total = n
+		if err != nil {
+			from.Close()
+			to.Close()
+			return
+		}
+		closeWrite(to)
+	}
+
+	var connIn, connOut *atomic.Int64
+	if tracked != nil {
+		connIn, connOut = &tracked.bytesIn, &tracked.bytesOut
+	}
+
+	wg.Add(2)
+	go pipe(src, dst, &stats.BytesIn, connIn, &bytesIn)    // 从src读取数据并写入dst
+	go pipe(dst, src, &stats.BytesOut, connOut, &bytesOut) // 从dst读取数据并写入src
+	wg.Wait()
+	return bytesIn, bytesOut
+}
+
+// deadlineReader 按连接计时设置读超时。只实现 Read，使 io.CopyBuffer 使用池中的缓冲区
+type deadlineReader struct {
+	conn  net.Conn
+	clock *connClock // 为 nil 时不设置超时
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	for {
+		if r.clock != nil {
+			r.conn.SetReadDeadline(r.clock.deadline())
+		}
+		n, err := r.conn.Read(p)
+		// 另一方向仍在传输时空闲计时已刷新，继续读取
+		if n == 0 && r.clock != nil && isTimeout(err) && !r.clock.expired() {
+			continue
+		}
+		return n, err
+	}
+}
+
+// meteredWriter 统计写入的字节数并刷新连接的空闲计时
+type meteredWriter struct {
+	w           io.Writer
+	counter     *atomic.Int64
+	connCounter *atomic.Int64 // 可为 nil
+	clock       *connClock    // 可为 nil
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	n, err := m.w.Write(p)
+	m.counter.Add(int64(n))
+	if m.connCounter != nil {
+		m.connCounter.Add(int64(n))
+	}
+	if m.clock != nil {
+		m.clock.touch()
+	}
+	return n, err
+}
+
+// closeWrite 半关闭连接的写方向，对端读到 EOF 后仍可继续发送。不支持半关闭的连接直接关闭
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return conn.Close()
+}
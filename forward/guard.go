@@ -0,0 +1,146 @@
+package forward
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResourceGuard 进程级资源保护：超过上限时拒绝新连接，而不是让主机换页或 OOM
+type ResourceGuard struct {
+	MaxGoroutines  int64  // 0 表示不限制
+	MaxConnections int64  // 所有转发的活动连接总数
+	MaxMemory      uint64 // 字节，按运行时从系统申请的内存估算
+
+	active     atomic.Int64
+	refused    atomic.Int64
+	goroutines atomic.Int64
+	memory     atomic.Uint64
+
+	mu     sync.Mutex
+	reason string // 当前拒绝连接的原因，空表示正常
+}
+
+// ResourceUsage 资源使用情况
+type ResourceUsage struct {
+	Goroutines     int64  `json:"goroutines"`
+	MaxGoroutines  int64  `json:"maxGoroutines"`
+	Connections    int64  `json:"connections"`
+	MaxConnections int64  `json:"maxConnections"`
+	MemoryBytes    uint64 `json:"memoryBytes"`
+	MaxMemoryBytes uint64 `json:"maxMemoryBytes"`
+	Refused        int64  `json:"refused"` // 因超限被拒绝的连接总数
+	Limited        bool   `json:"limited"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// guardSampleInterval 采样协程数与内存的间隔，避免每个连接都读取 MemStats
+const guardSampleInterval = time.Second
+
+// NewResourceGuard 创建资源保护并开始采样
+func NewResourceGuard(maxGoroutines, maxConnections int64, maxMemory uint64) *ResourceGuard {
+	g := &ResourceGuard{
+		MaxGoroutines:  maxGoroutines,
+		MaxConnections: maxConnections,
+		MaxMemory:      maxMemory,
+	}
+	g.sample()
+	go func() {
+		ticker := time.NewTicker(guardSampleInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			g.sample()
+		}
+	}()
+	return g
+}
+
+// sample 刷新协程数与内存估算，恢复正常时记录日志
+func (g *ResourceGuard) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	g.goroutines.Store(int64(runtime.NumGoroutine()))
+	g.memory.Store(m.Sys - m.HeapReleased)
+
+	if g.exceeded() == "" {
+		g.mu.Lock()
+		if g.reason != "" {
+			log.Printf("Resource guard: usage back under limits, accepting connections again")
+			g.reason = ""
+		}
+		g.mu.Unlock()
+	}
+}
+
+// exceeded 返回超出的限制说明，未超限时为空
+func (g *ResourceGuard) exceeded() string {
+	if g.MaxGoroutines > 0 {
+		if n := g.goroutines.Load(); n >= g.MaxGoroutines {
+			return fmt.Sprintf("goroutines %d >= %d", n, g.MaxGoroutines)
+		}
+	}
+	if g.MaxConnections > 0 {
+		if n := g.active.Load(); n >= g.MaxConnections {
+			return fmt.Sprintf("connections %d >= %d", n, g.MaxConnections)
+		}
+	}
+	if g.MaxMemory > 0 {
+		if n := g.memory.Load(); n >= g.MaxMemory {
+			return fmt.Sprintf("memory %d MB >= %d MB", n>>20, g.MaxMemory>>20)
+		}
+	}
+	return ""
+}
+
+// admit 判断是否可以接受新连接，接受后需调用 release；nil 时总是接受
+func (g *ResourceGuard) admit() bool {
+	if g == nil {
+		return true
+	}
+	if reason := g.exceeded(); reason != "" {
+		g.refused.Add(1)
+		g.mu.Lock()
+		if g.reason == "" {
+			log.Printf("Resource guard: refusing new connections (%s)", reason)
+		}
+		g.reason = reason
+		g.mu.Unlock()
+		return false
+	}
+	g.active.Add(1)
+	return true
+}
+
+// release 连接结束
+func (g *ResourceGuard) release() {
+	if g != nil {
+		g.active.Add(-1)
+	}
+}
+
+// Usage 当前资源使用情况，g 为 nil 时只报告使用量
+func (g *ResourceGuard) Usage() ResourceUsage {
+	if g == nil {
+		// 未配置上限时也报告当前使用情况
+		g = &ResourceGuard{}
+		g.sample()
+	}
+	g.mu.Lock()
+	reason := g.reason
+	g.mu.Unlock()
+
+	return ResourceUsage{
+		Goroutines:     g.goroutines.Load(),
+		MaxGoroutines:  g.MaxGoroutines,
+		Connections:    g.active.Load(),
+		MaxConnections: g.MaxConnections,
+		MemoryBytes:    g.memory.Load(),
+		MaxMemoryBytes: g.MaxMemory,
+		Refused:        g.refused.Load(),
+		Limited:        reason != "",
+		Reason:         reason,
+	}
+}
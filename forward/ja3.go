@@ -0,0 +1,180 @@
+package forward
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientHelloInfo 从 TLS ClientHello 中提取的信息
+type ClientHelloInfo struct {
+	JA3       string // JA3 原始字符串
+	JA3Hash   string // JA3 指纹（MD5）
+	SNI       string
+	TLSRecord []byte // 已读取的原始记录，需要原样转发给目标
+}
+
+var errNotClientHello = errors.New("not a TLS ClientHello")
+
+// readClientHello 从连接读取第一个 TLS 记录并解析 ClientHello
+// 无论解析是否成功，已读取的字节都通过 TLSRecord 返回
+func readClientHello(conn net.Conn, timeout time.Duration) (*ClientHelloInfo, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	header := make([]byte, 5)
+	n, err := io.ReadFull(conn, header)
+	if err != nil {
+		return &ClientHelloInfo{TLSRecord: header[:n]}, err
+	}
+	info := &ClientHelloInfo{TLSRecord: header}
+	if header[0] != 0x16 {
+		return info, errNotClientHello
+	}
+
+	length := int(binary.BigEndian.Uint16(header[3:5]))
+	body := make([]byte, length)
+	n, err = io.ReadFull(conn, body)
+	info.TLSRecord = append(info.TLSRecord, body[:n]...)
+	if err != nil {
+		return info, err
+	}
+
+	if err := parseClientHello(body, info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// parseClientHello 解析握手消息并计算 JA3
+func parseClientHello(b []byte, info *ClientHelloInfo) error {
+	if len(b) < 4 || b[0] != 0x01 {
+		return errNotClientHello
+	}
+	b = b[4:]
+
+	// client_version + random
+	if len(b) < 34 {
+		return errNotClientHello
+	}
+	version := binary.BigEndian.Uint16(b[0:2])
+	b = b[34:]
+
+	// session_id
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return errNotClientHello
+	}
+	b = b[1+int(b[0]):]
+
+	// cipher_suites
+	if len(b) < 2 {
+		return errNotClientHello
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return errNotClientHello
+	}
+	var ciphers []string
+	for i := 2; i+1 < 2+n; i += 2 {
+		if v := binary.BigEndian.Uint16(b[i:]); !isGREASE(v) {
+			ciphers = append(ciphers, strconv.Itoa(int(v)))
+		}
+	}
+	b = b[2+n:]
+
+	// compression_methods
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return errNotClientHello
+	}
+	b = b[1+int(b[0]):]
+
+	// extensions（可选）
+	var extensions, curves, pointFormats []string
+	if len(b) >= 2 {
+		n = int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) > n {
+			b = b[:n]
+		}
+		for len(b) >= 4 {
+			typ := binary.BigEndian.Uint16(b)
+			l := int(binary.BigEndian.Uint16(b[2:]))
+			if len(b) < 4+l {
+				break
+			}
+			data := b[4 : 4+l]
+			b = b[4+l:]
+
+			if isGREASE(typ) {
+				continue
+			}
+			extensions = append(extensions, strconv.Itoa(int(typ)))
+
+			switch typ {
+			case 0: // server_name
+				if len(data) >= 5 && data[2] == 0 {
+					nameLen := int(binary.BigEndian.Uint16(data[3:]))
+					if len(data) >= 5+nameLen {
+						info.SNI = string(data[5 : 5+nameLen])
+					}
+				}
+			case 10: // supported_groups
+				if len(data) >= 2 {
+					for i := 2; i+1 < len(data); i += 2 {
+						if v := binary.BigEndian.Uint16(data[i:]); !isGREASE(v) {
+							curves = append(curves, strconv.Itoa(int(v)))
+						}
+					}
+				}
+			case 11: // ec_point_formats
+				if len(data) >= 1 {
+					for _, f := range data[1:] {
+						pointFormats = append(pointFormats, strconv.Itoa(int(f)))
+					}
+				}
+			}
+		}
+	}
+
+	info.JA3 = strings.Join([]string{
+		strconv.Itoa(int(version)),
+		strings.Join(ciphers, "-"),
+		strings.Join(extensions, "-"),
+		strings.Join(curves, "-"),
+		strings.Join(pointFormats, "-"),
+	}, ",")
+	sum := md5.Sum([]byte(info.JA3))
+	info.JA3Hash = hex.EncodeToString(sum[:])
+	return nil
+}
+
+// isGREASE 判断是否为 RFC 8701 GREASE 值（JA3 计算时忽略）
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// prefixConn 先返回已预读的数据，再从底层连接读取
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// CloseWrite 半关闭被包装的连接
+func (c *prefixConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
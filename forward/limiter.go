@@ -0,0 +1,163 @@
+package forward
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// 转发优先级，零值为普通优先级
+const (
+	PriorityNormal = iota
+	PriorityHigh
+	PriorityLow
+	NumPriorities
+)
+
+// priorityOrder 各优先级获得带宽的先后顺序，也是等待队列的顺序
+var priorityOrder = [NumPriorities]int{PriorityHigh, PriorityNormal, PriorityLow}
+
+// queueIndex 优先级对应的等待队列，未知的优先级按普通处理
+func queueIndex(priority int) int {
+	for i, p := range priorityOrder {
+		if p == priority {
+			return i
+		}
+	}
+	return queueIndex(PriorityNormal)
+}
+
+// ParsePriority 将规则中的优先级名称转换为等级，未知值按普通处理
+func ParsePriority(s string) int {
+	switch s {
+	case "high":
+		return PriorityHigh
+	case "low":
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// limiterTick 令牌补充间隔
+const limiterTick = 10 * time.Millisecond
+
+// BandwidthLimiter 所有转发共享的全局带宽限制器
+// 令牌不足时按严格优先级排队：高优先级的等待者先于低优先级获得带宽
+type BandwidthLimiter struct {
+	mu      sync.Mutex
+	rate    int64 // 字节/秒
+	burst   int64
+	tokens  int64
+	waiters [NumPriorities][]*limiterWaiter // 按 priorityOrder 排列
+}
+
+type limiterWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewBandwidthLimiter 创建限速为 rate 字节/秒的限制器
+func NewBandwidthLimiter(rate int64) *BandwidthLimiter {
+	burst := rate / 10
+	if burst < 64*1024 {
+		burst = 64 * 1024
+	}
+	l := &BandwidthLimiter{rate: rate, burst: burst, tokens: burst}
+	go l.refill()
+	return l
+}
+
+// Wait 阻塞直到可以发送 n 字节
+func (l *BandwidthLimiter) Wait(priority, n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	queue := queueIndex(priority)
+
+	l.mu.Lock()
+	// 没有同级或更高优先级在排队且令牌充足时直接取用
+	if l.enough(int64(n)) && !l.queuedAtOrBefore(queue) {
+		l.tokens -= int64(n)
+		l.mu.Unlock()
+		return
+	}
+	w := &limiterWaiter{n: int64(n), ready: make(chan struct{})}
+	l.waiters[queue] = append(l.waiters[queue], w)
+	l.mu.Unlock()
+
+	<-w.ready
+}
+
+// enough 令牌是否足够发送 n 字节，超过桶容量的请求在桶满时放行（之后透支）
+func (l *BandwidthLimiter) enough(n int64) bool {
+	return l.tokens >= n || l.tokens >= l.burst
+}
+
+// queuedAtOrBefore 该队列及排在它之前的队列中是否有等待者
+func (l *BandwidthLimiter) queuedAtOrBefore(queue int) bool {
+	for q := 0; q <= queue; q++ {
+		if len(l.waiters[q]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// refill 定期补充令牌并按优先级唤醒等待者
+func (l *BandwidthLimiter) refill() {
+	ticker := time.NewTicker(limiterTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.mu.Lock()
+		l.tokens += l.rate * int64(limiterTick) / int64(time.Second)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		// 严格优先级：高优先级的队首未满足前，低优先级不能获得令牌
+	serve:
+		for q := range l.waiters {
+			for len(l.waiters[q]) > 0 {
+				w := l.waiters[q][0]
+				if !l.enough(w.n) {
+					break serve
+				}
+				l.waiters[q] = l.waiters[q][1:]
+				l.tokens -= w.n
+				close(w.ready)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Waiting 各优先级当前排队的等待者数量，按优先级取值索引
+func (l *BandwidthLimiter) Waiting() [NumPriorities]int {
+	var counts [NumPriorities]int
+	if l == nil {
+		return counts
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for q, p := range priorityOrder {
+		counts[p] = len(l.waiters[q])
+	}
+	return counts
+}
+
+// limitedConn 写入前向共享限制器申请带宽
+type limitedConn struct {
+	net.Conn
+	limiter  *BandwidthLimiter
+	priority int
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	c.limiter.Wait(c.priority, len(p))
+	return c.Conn.Write(p)
+}
+
+// CloseWrite 半关闭被包装的连接
+func (c *limitedConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
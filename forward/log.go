@@ -0,0 +1,21 @@
+package forward
+
+import (
+	"log"
+)
+
+// Logger 转发日志的输出接口
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// stdLogger 写入标准库 log 的默认日志记录器，不输出调试日志
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) {}
+func (stdLogger) Infof(format string, args ...interface{})  { log.Printf("[INFO] "+format, args...) }
+func (stdLogger) Warnf(format string, args ...interface{})  { log.Printf("[WARN] "+format, args...) }
+func (stdLogger) Errorf(format string, args ...interface{}) { log.Printf("[ERROR] "+format, args...) }
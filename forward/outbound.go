@@ -0,0 +1,98 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// OutboundBind 连接目标时使用的出接口与源地址（TCP/UDP/SOCKS5），使到后端的流量经指定的
+// VPN 网卡（如 WireGuard 的 wg0）发出而不走默认路由。Linux 上以 SO_BINDTODEVICE 绑定出接口，
+// 其他平台以出接口上的地址作为源地址，需要系统按源地址选择路由
+type OutboundBind struct {
+	Interface string `json:"interface,omitempty"` // 出接口名，如 wg0
+	SourceIP  string `json:"sourceIp,omitempty"`  // 源地址，为空时由系统选择（非 Linux 平台使用出接口的地址）
+}
+
+// Validate 校验配置，出接口必须存在
+func (b OutboundBind) Validate() error {
+	if b.SourceIP != "" && net.ParseIP(b.SourceIP) == nil {
+		return fmt.Errorf("invalid sourceIp %q", b.SourceIP)
+	}
+	if b.Interface != "" {
+		if _, err := net.InterfaceByName(b.Interface); err != nil {
+			return fmt.Errorf("interface %q: %w", b.Interface, err)
+		}
+	}
+	return nil
+}
+
+// Enabled 是否设置了出接口或源地址，nil 安全
+func (b *OutboundBind) Enabled() bool {
+	return b != nil && (b.Interface != "" || b.SourceIP != "")
+}
+
+// dial 按配置绑定出接口与源地址后连接目标，未设置时直接使用 d 连接。
+// 每次连接时重新查找出接口，VPN 网卡重建后无需重启转发
+func (b *OutboundBind) dial(ctx context.Context, d net.Dialer, network, address string) (net.Conn, error) {
+	if !b.Enabled() {
+		return d.DialContext(ctx, network, address)
+	}
+	ip := net.ParseIP(b.SourceIP)
+	if b.Interface != "" {
+		if bindToDeviceSupported {
+			d.Control = bindToDevice(b.Interface)
+		} else if ip == nil {
+			ifi, err := net.InterfaceByName(b.Interface)
+			if err != nil {
+				return nil, fmt.Errorf("interface %s: %w", b.Interface, err)
+			}
+			if ip, err = interfaceAddr(ifi); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ip != nil {
+		if network == "udp" {
+			d.LocalAddr = &net.UDPAddr{IP: ip}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+	return d.DialContext(ctx, network, address)
+}
+
+// dialUDP 按配置连接 UDP 目标
+func (b *OutboundBind) dialUDP(target *net.UDPAddr) (*net.UDPConn, error) {
+	if !b.Enabled() {
+		return net.DialUDP("udp", nil, target)
+	}
+	conn, err := b.dial(context.Background(), net.Dialer{}, "udp", target.String())
+	if err != nil {
+		return nil, err
+	}
+	udp, ok := conn.(*net.UDPConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("unexpected UDP connection type")
+	}
+	return udp, nil
+}
+
+// interfaceAddr 网卡的第一个 IPv4 地址，没有时使用第一个非链路本地的 IPv6 地址
+func interfaceAddr(ifi *net.Interface) (net.IP, error) {
+	if ip, err := interfaceIPv4(ifi); err == nil {
+		return ip, nil
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no usable address", ifi.Name)
+}
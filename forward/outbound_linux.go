@@ -0,0 +1,27 @@
+//go:build linux
+
+package forward
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDeviceSupported 当前平台能否以 SO_BINDTODEVICE 绑定出接口
+const bindToDeviceSupported = true
+
+// bindToDevice 创建套接字后以 SO_BINDTODEVICE 绑定出接口，连接只经该网卡发出
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = syscall.BindToDevice(int(fd), name)
+		}); err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("bind to interface %s: %w", name, sockErr)
+		}
+		return nil
+	}
+}
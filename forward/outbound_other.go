@@ -0,0 +1,13 @@
+//go:build !linux
+
+package forward
+
+import "syscall"
+
+// bindToDeviceSupported 当前平台能否以 SO_BINDTODEVICE 绑定出接口
+const bindToDeviceSupported = false
+
+// bindToDevice 当前平台不支持绑定出接口，改用出接口的地址作为源地址
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,302 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPortRange 一条规则的端口范围最多包含的端口数
+const maxPortRange = 1000
+
+// IsPortRange 判断端口是否为 "8000-8100" 形式的范围（服务名如 ftp-data 不算）
+func IsPortRange(port string) bool {
+	start, end, ok := strings.Cut(port, "-")
+	if !ok {
+		return false
+	}
+	_, err1 := strconv.Atoi(strings.TrimSpace(start))
+	_, err2 := strconv.Atoi(strings.TrimSpace(end))
+	return err1 == nil && err2 == nil
+}
+
+// ParsePortRange 解析端口或端口范围，单个端口时 start == end
+func ParsePortRange(port string) (start, end int, err error) {
+	startStr, endStr, ok := strings.Cut(port, "-")
+	if !ok {
+		endStr = startStr
+	}
+	start, err = strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", port)
+	}
+	end, err = strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q", port)
+	}
+	if start < 1 || end > 65535 {
+		return 0, 0, fmt.Errorf("port range %q out of range (1-65535)", port)
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid port range %q: start is greater than end", port)
+	}
+	if end-start+1 > maxPortRange {
+		return 0, 0, fmt.Errorf("port range %q has more than %d ports", port, maxPortRange)
+	}
+	return start, end, nil
+}
+
+// PortPair 端口范围展开后一一对应的监听端口与目标端口
+type PortPair struct {
+	Listen string
+	Target string
+}
+
+// ExpandPortRange 把监听端口范围展开为逐个端口。目标端口可以是等长的范围，
+// 也可以是单个端口（作为目标范围的起始端口），为空时目标端口也为空（SOCKS5）
+func ExpandPortRange(listenPort, targetPort string) ([]PortPair, error) {
+	start, end, err := ParsePortRange(listenPort)
+	if err != nil {
+		return nil, err
+	}
+
+	targetStart := 0
+	if targetPort != "" {
+		tStart, tEnd, err := ParsePortRange(targetPort)
+		if err != nil {
+			return nil, err
+		}
+		if IsPortRange(targetPort) && tEnd-tStart != end-start {
+			return nil, fmt.Errorf("target port range %s does not match listen port range %s", targetPort, listenPort)
+		}
+		if tStart+end-start > 65535 {
+			return nil, fmt.Errorf("target port range starting at %d exceeds 65535", tStart)
+		}
+		targetStart = tStart
+	}
+
+	pairs := make([]PortPair, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		pair := PortPair{Listen: strconv.Itoa(port)}
+		if targetStart > 0 {
+			pair.Target = strconv.Itoa(targetStart + port - start)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// ShiftPort 把端口或端口范围整体平移 offset，结果超出 1-65535 时返回错误
+func ShiftPort(port string, offset int) (string, error) {
+	if offset == 0 || port == "" {
+		return port, nil
+	}
+	start, end, err := ParsePortRange(port)
+	if err != nil {
+		return "", err
+	}
+	if start+offset < 1 || end+offset > 65535 {
+		return "", fmt.Errorf("port %s shifted by %d is out of range (1-65535)", port, offset)
+	}
+	if IsPortRange(port) {
+		return fmt.Sprintf("%d-%d", start+offset, end+offset), nil
+	}
+	return strconv.Itoa(start + offset), nil
+}
+
+// CheckPortRange 检查规则的监听端口与目标端口能否一一对应，单个端口时不检查
+func CheckPortRange(listenPort, targetPort string) error {
+	if !IsPortRange(listenPort) {
+		if IsPortRange(targetPort) {
+			return fmt.Errorf("target port range %s requires a listen port range", targetPort)
+		}
+		return nil
+	}
+	_, err := ExpandPortRange(listenPort, targetPort)
+	return err
+}
+
+// PortInRange 判断 port 是否为 portRange 本身或在其范围内
+func PortInRange(portRange, port string) bool {
+	if portRange == port {
+		return true
+	}
+	if !IsPortRange(portRange) {
+		return false
+	}
+	start, end, err := ParsePortRange(portRange)
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= start && n <= end
+}
+
+// startPort 启动单个端口的转发
+func (f *Forwarder) startPort(protocol, listenAddr, listenPort, targetAddr, targetPort string) error {
+	switch protocol {
+	case "tcp":
+		return f.StartTCPForward(listenAddr, listenPort, targetAddr, targetPort)
+	case "udp":
+		return f.StartUDPForward(listenAddr, listenPort, targetAddr, targetPort)
+	case "sctp":
+		return f.StartSCTPForward(listenAddr, listenPort, targetAddr, targetPort)
+	case "socks5":
+		return f.StartSOCKS5Forward(listenAddr, listenPort)
+	}
+	return fmt.Errorf("unknown protocol %s", protocol)
+}
+
+// stopPort 停止单个端口的转发
+func (f *Forwarder) stopPort(protocol, listenAddr, listenPort string) error {
+	switch protocol {
+	case "tcp":
+		return f.StopTCPForward(listenAddr, listenPort)
+	case "udp":
+		return f.StopUDPForward(listenAddr, listenPort)
+	case "sctp":
+		return f.StopSCTPForward(listenAddr, listenPort)
+	case "socks5":
+		return f.StopSOCKS5Forward(listenAddr, listenPort)
+	}
+	return fmt.Errorf("unknown protocol %s", protocol)
+}
+
+// isPortRunning 检查单个端口的转发是否在运行
+func (f *Forwarder) isPortRunning(protocol, listenAddr, listenPort string) bool {
+	key := forwardKey(protocol, listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch protocol {
+	case "tcp":
+		_, ok := f.tcpListeners[key]
+		return ok
+	case "udp":
+		_, ok := f.udpListeners[key]
+		return ok
+	case "sctp":
+		_, ok := f.sctpListeners[key]
+		return ok
+	case "socks5":
+		_, ok := f.socksListeners[key]
+		return ok
+	}
+	return false
+}
+
+// startPortRange 逐个端口启动端口范围的转发，任一端口失败时停止已启动的端口，
+// 使端口范围作为一个整体启动或失败
+func (f *Forwarder) startPortRange(protocol, listenAddr, listenPort, targetAddr, targetPort string) error {
+	pairs, err := ExpandPortRange(listenPort, targetPort)
+	if err != nil {
+		return err
+	}
+	for i, pair := range pairs {
+		if err := f.startPort(protocol, listenAddr, pair.Listen, targetAddr, pair.Target); err != nil {
+			for _, started := range pairs[:i] {
+				f.stopPort(protocol, listenAddr, started.Listen)
+			}
+			return fmt.Errorf("port %s: %w", pair.Listen, err)
+		}
+	}
+	return nil
+}
+
+// stopPortRange 停止端口范围中所有正在运行的端口
+func (f *Forwarder) stopPortRange(protocol, listenAddr, listenPort string) error {
+	pairs, err := ExpandPortRange(listenPort, "")
+	if err != nil {
+		return err
+	}
+	stopped := 0
+	var firstErr error
+	for _, pair := range pairs {
+		if !f.isPortRunning(protocol, listenAddr, pair.Listen) {
+			continue
+		}
+		if err := f.stopPort(protocol, listenAddr, pair.Listen); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("port %s: %w", pair.Listen, err)
+			}
+			continue
+		}
+		stopped++
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if stopped == 0 {
+		return fmt.Errorf("%s forward not running on %s", strings.ToUpper(protocol), net.JoinHostPort(listenAddr, listenPort))
+	}
+	return nil
+}
+
+// portRangeRunning 端口范围中有端口在运行时返回 true
+func (f *Forwarder) portRangeRunning(protocol, listenAddr, listenPort string) bool {
+	pairs, err := ExpandPortRange(listenPort, "")
+	if err != nil {
+		return false
+	}
+	for _, pair := range pairs {
+		if f.isPortRunning(protocol, listenAddr, pair.Listen) {
+			return true
+		}
+	}
+	return false
+}
+
+// drainPortRange 排空端口范围中所有正在运行的 TCP 端口
+func (f *Forwarder) drainPortRange(listenAddr, listenPort string, grace time.Duration) error {
+	pairs, err := ExpandPortRange(listenPort, "")
+	if err != nil {
+		return err
+	}
+	drained := 0
+	for _, pair := range pairs {
+		if !f.isPortRunning("tcp", listenAddr, pair.Listen) {
+			continue
+		}
+		if err := f.DrainTCPForward(listenAddr, pair.Listen, grace); err != nil {
+			return fmt.Errorf("port %s: %w", pair.Listen, err)
+		}
+		drained++
+	}
+	if drained == 0 {
+		return fmt.Errorf("TCP forward not running on %s", net.JoinHostPort(listenAddr, listenPort))
+	}
+	return nil
+}
+
+// portRangeStats 合计端口范围中各端口转发到对应目标的统计，没有这样的端口在运行时返回 false
+func (f *Forwarder) portRangeStats(protocol, listenAddr, listenPort, targetAddr, targetPort string) (StatsSnapshot, bool) {
+	pairs, err := ExpandPortRange(listenPort, targetPort)
+	if err != nil {
+		return StatsSnapshot{}, false
+	}
+	var total StatsSnapshot
+	running := false
+	for _, pair := range pairs {
+		s, ok := f.Stats(protocol, listenAddr, pair.Listen, targetAddr, pair.Target)
+		if !ok {
+			continue
+		}
+		running = true
+		total.BytesIn += s.BytesIn
+		total.BytesOut += s.BytesOut
+		total.ActiveConns += s.ActiveConns
+		total.TotalConns += s.TotalConns
+		total.DialFailures += s.DialFailures
+		total.Blocked += s.Blocked
+		total.Refused += s.Refused
+		total.OverLimit += s.OverLimit
+		total.Oversized += s.Oversized
+		total.Goroutines += s.Goroutines
+		total.OpenFDs += s.OpenFDs
+		total.BufferBytes += s.BufferBytes
+	}
+	return total, running
+}
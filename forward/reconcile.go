@@ -0,0 +1,97 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// StaleForward Reconcile 移除的转发：映射表中仍有记录，但监听套接字已关闭或不再监听
+type StaleForward struct {
+	Protocol   string `json:"protocol"`
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	Target     string `json:"target,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// Reconcile 检查每个转发的监听套接字是否仍然绑定并在监听，停止已失效的转发并返回它们，
+// 使 IsTCPRunning 等反映实际状态。正在重新监听（见 AutoRestart）或重新启动的转发不检查
+func (f *Forwarder) Reconcile() []StaleForward {
+	type candidate struct {
+		StaleForward
+		key      string
+		listener io.Closer
+	}
+
+	f.mu.Lock()
+	var stale []candidate
+	check := func(protocol, key string, l io.Closer, stream bool) {
+		if _, ok := f.recovering[key]; ok || f.restarting[key] {
+			return
+		}
+		if err := listenerBound(l, stream); err != nil {
+			addr := splitForwardKey(key)
+			stale = append(stale, candidate{
+				StaleForward: StaleForward{Protocol: protocol, ListenAddr: addr[0], ListenPort: addr[1], Target: f.targets[key], Reason: err.Error()},
+				key:          key,
+				listener:     l,
+			})
+		}
+	}
+	for key, l := range f.tcpListeners {
+		check("tcp", key, *l, true)
+	}
+	for key, conn := range f.udpListeners {
+		check("udp", key, conn, false)
+	}
+	for key, l := range f.sctpListeners {
+		check("sctp", key, l, true)
+	}
+	for key, l := range f.socksListeners {
+		check("socks5", key, l, true)
+	}
+	f.mu.Unlock()
+
+	var removed []StaleForward
+	for _, c := range stale {
+		// 检查期间可能已被停止或重新监听
+		f.mu.Lock()
+		owned := f.ownsListenerLocked(c.Protocol, c.key, c.listener)
+		if _, ok := f.recovering[c.key]; ok {
+			owned = false
+		}
+		f.mu.Unlock()
+		if !owned {
+			continue
+		}
+		f.listenLog(c.ListenAddr, c.ListenPort, c.Target).Warnf("Removing stale %s forward %s: %s", c.Protocol, net.JoinHostPort(c.ListenAddr, c.ListenPort), c.Reason)
+		f.stopPort(c.Protocol, c.ListenAddr, c.ListenPort)
+		removed = append(removed, c.StaleForward)
+	}
+	return removed
+}
+
+// listenerBound 检查监听器的套接字是否仍然打开，stream 为 true 时还检查是否仍处于监听状态。
+// 不提供底层套接字的监听器视为正常
+func listenerBound(l io.Closer, stream bool) error {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if stream {
+			sockErr = checkAcceptConn(fd)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("socket closed: %w", err)
+	}
+	return sockErr
+}
@@ -0,0 +1,247 @@
+package forward
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 中继节点协议：节点接受连接后发送 relayMagic 与随机 nonce，客户端回复
+// HMAC-SHA256(令牌, nonce+目标) 与 2 字节长度前缀的目标 addr:port，
+// 节点校验后连接目标并回复 1 字节状态与 1 字节长度前缀的错误信息，之后原样双向转发。
+// 目标可以是下一个节点，客户端经已建立的连接再与它握手，形成链路。令牌不在网络上传输，
+// 中间节点也不知道后续节点的令牌，但转发的数据本身不加密
+const (
+	relayMagic          = "GPR1"
+	relayNonceSize      = 32
+	relayHandshakeLimit = 10 * time.Second
+	relayDialTimeout    = 10 * time.Second
+)
+
+// 中继节点的应答状态
+const (
+	relayOK byte = iota
+	relayAuthFailed
+	relayBadRequest
+	relayDialFailed
+)
+
+// ErrRelayAuth 中继节点拒绝了令牌
+var ErrRelayAuth = errors.New("relay node rejected the token")
+
+// RelayHop 链路中的一个中继节点
+type RelayHop struct {
+	Addr  string // 节点的中继监听地址 host:port
+	Token string // 节点的令牌
+}
+
+// RelayChain 依次经过各中继节点连接目标的拨号器：客户端 -> 节点 A -> 节点 B -> 目标
+type RelayChain []RelayHop
+
+// DialContext 连接第一个节点，逐个节点握手，最后一个节点连接目标（仅 TCP）
+func (c RelayChain) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(c) == 0 {
+		return nil, errors.New("relay chain is empty")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c[0].Addr)
+	if err != nil {
+		return nil, fmt.Errorf("relay node %s: %v", c[0].Addr, err)
+	}
+	deadline := time.Now().Add(relayHandshakeLimit)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+	for i, hop := range c {
+		next := addr
+		if i+1 < len(c) {
+			next = c[i+1].Addr
+		}
+		if err := relayHandshake(conn, hop.Token, next); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("relay node %s: %w", hop.Addr, err)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return &relayConn{Conn: conn, remote: dialAddr(addr)}, nil
+}
+
+// relayHandshake 与节点握手，请求它连接 target
+func relayHandshake(conn net.Conn, token, target string) error {
+	hello := make([]byte, len(relayMagic)+relayNonceSize)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		return fmt.Errorf("handshake: %v", err)
+	}
+	if string(hello[:len(relayMagic)]) != relayMagic {
+		return errors.New("not a go-ports relay node")
+	}
+	nonce := hello[len(relayMagic):]
+
+	req := relayMAC(token, nonce, target)
+	req = binary.BigEndian.AppendUint16(req, uint16(len(target)))
+	req = append(req, target...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("handshake: %v", err)
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("handshake: %v", err)
+	}
+	msg := make([]byte, reply[1])
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return fmt.Errorf("handshake: %v", err)
+	}
+	switch reply[0] {
+	case relayOK:
+		return nil
+	case relayAuthFailed:
+		return ErrRelayAuth
+	default:
+		return fmt.Errorf("cannot reach %s: %s", target, msg)
+	}
+}
+
+// relayMAC 以令牌计算 nonce 与目标的 HMAC
+func relayMAC(token string, nonce []byte, target string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(nonce)
+	mac.Write([]byte(target))
+	return mac.Sum(nil)
+}
+
+// relayConn 经中继节点建立的连接，以目标地址作为远端地址
+type relayConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *relayConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// CloseWrite 半关闭到第一个节点的连接，节点再半关闭到下一跳的连接
+func (c *relayConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+// RelayServer 中继节点：校验客户端的令牌后替它连接目标或下一个节点
+type RelayServer struct {
+	Token string // 客户端必须持有的令牌，不能为空
+	Log   Logger // 为 nil 时使用标准库 log
+
+	wg sync.WaitGroup
+}
+
+// Serve 在 listener 上接受中继连接，listener 关闭后等待已有连接结束并返回
+func (s *RelayServer) Serve(listener net.Listener) error {
+	if s.Token == "" {
+		return errors.New("relay token is required")
+	}
+	defer s.wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// logger 返回日志记录器
+func (s *RelayServer) logger() Logger {
+	if s.Log != nil {
+		return s.Log
+	}
+	return stdLogger{}
+}
+
+// handle 处理一个中继连接
+func (s *RelayServer) handle(conn net.Conn) {
+	defer conn.Close()
+	lg := s.logger()
+	conn.SetDeadline(time.Now().Add(relayHandshakeLimit))
+
+	nonce := make([]byte, relayNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		lg.Errorf("Relay: failed to generate nonce: %v", err)
+		return
+	}
+	if _, err := conn.Write(append([]byte(relayMagic), nonce...)); err != nil {
+		return
+	}
+
+	req := make([]byte, sha256.Size+2)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		lg.Debugf("Relay: handshake with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	target := make([]byte, binary.BigEndian.Uint16(req[sha256.Size:]))
+	if _, err := io.ReadFull(conn, target); err != nil {
+		lg.Debugf("Relay: handshake with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if !hmac.Equal(req[:sha256.Size], relayMAC(s.Token, nonce, string(target))) {
+		lg.Warnf("Relay: rejected %s, invalid token", conn.RemoteAddr())
+		relayReply(conn, relayAuthFailed, "")
+		return
+	}
+	if _, _, err := net.SplitHostPort(string(target)); err != nil {
+		relayReply(conn, relayBadRequest, "invalid target")
+		return
+	}
+
+	targetConn, err := net.DialTimeout("tcp", string(target), relayDialTimeout)
+	if err != nil {
+		lg.Warnf("Relay: %s -> %s failed: %v", conn.RemoteAddr(), target, err)
+		relayReply(conn, relayDialFailed, err.Error())
+		return
+	}
+	defer targetConn.Close()
+	if err := relayReply(conn, relayOK, ""); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	lg.Debugf("Relay: %s -> %s", conn.RemoteAddr(), target)
+
+	// 双向转发，一个方向结束时半关闭另一端
+	var wg sync.WaitGroup
+	pipe := func(from, to net.Conn) {
+		defer wg.Done()
+		if _, err := io.Copy(to, from); err != nil {
+			from.Close()
+			to.Close()
+			return
+		}
+		closeWrite(to)
+	}
+	wg.Add(2)
+	go pipe(conn, targetConn)
+	go pipe(targetConn, conn)
+	wg.Wait()
+}
+
+// relayReply 发送握手应答，错误信息超过 255 字节时截断
+func relayReply(conn net.Conn, status byte, msg string) error {
+	if len(msg) > 255 {
+		msg = msg[:255]
+	}
+	_, err := conn.Write(append([]byte{status, byte(len(msg))}, msg...))
+	return err
+}
@@ -0,0 +1,196 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 嗅探连接开头数据的限制
+const (
+	routeSniffTimeout = 3 * time.Second // 客户端迟迟不发送数据时（如服务端先发言的协议）使用默认目标
+	routeSniffBytes   = 16 * 1024       // 最多预读的字节数
+	maxRoutePrefix    = 64              // 字节匹配的最大长度
+)
+
+// Route 路由表的一项：按连接开头的数据选择目标（仅TCP）。Host 与 Prefix 只能设置一个
+type Route struct {
+	Host   string `json:"host,omitempty"`   // TLS SNI 或 HTTP Host 头（不含端口），支持 *.example.com，* 匹配任意主机名
+	Prefix string `json:"prefix,omitempty"` // 连接开头的字节（十六进制），如 5353482d 匹配 SSH
+	Target string `json:"target"`           // 匹配时连接的目标 addr:port
+}
+
+// Validate 校验路由项，不检查目标地址
+func (r Route) Validate() error {
+	if (r.Host == "") == (r.Prefix == "") {
+		return errors.New("route must set exactly one of host and prefix")
+	}
+	if r.Host != "" {
+		host := strings.TrimPrefix(r.Host, "*.")
+		if host != "*" && (host == "" || strings.ContainsAny(host, "*:/ \t")) {
+			return fmt.Errorf("invalid route host %q", r.Host)
+		}
+	}
+	if r.Prefix != "" {
+		prefix, err := hex.DecodeString(r.Prefix)
+		if err != nil {
+			return fmt.Errorf("route prefix %q is not valid hex", r.Prefix)
+		}
+		if len(prefix) > maxRoutePrefix {
+			return fmt.Errorf("route prefix must be at most %d bytes", maxRoutePrefix)
+		}
+	}
+	if _, _, err := net.SplitHostPort(r.Target); err != nil {
+		return fmt.Errorf("invalid route target %q, use addr:port", r.Target)
+	}
+	return nil
+}
+
+// matchHost 主机名是否匹配路由的 Host，不区分大小写
+func (r Route) matchHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	pattern := strings.ToLower(r.Host)
+	host = strings.ToLower(host)
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(pattern, "*")
+	return ok && strings.HasSuffix(host, suffix)
+}
+
+// router 编译后的路由表
+type router struct {
+	routes   []Route
+	prefixes [][]byte // 与 routes 对应的字节匹配
+	minBytes int      // 判断字节匹配至少需要预读的字节数
+}
+
+// newRouter 编译路由表，没有有效的路由项时返回 nil
+func newRouter(routes []Route) *router {
+	r := &router{minBytes: 1}
+	for _, route := range routes {
+		if route.Validate() != nil {
+			continue
+		}
+		prefix, _ := hex.DecodeString(route.Prefix)
+		if len(prefix) > r.minBytes {
+			r.minBytes = len(prefix)
+		}
+		r.routes = append(r.routes, route)
+		r.prefixes = append(r.prefixes, prefix)
+	}
+	if len(r.routes) == 0 {
+		return nil
+	}
+	return r
+}
+
+// sniffResult 嗅探连接开头数据的结果
+type sniffResult struct {
+	protocol string // tls、http，无法识别时为空
+	host     string // TLS SNI 或 HTTP Host 头（不含端口）
+	data     []byte // 已读取的字节，需要原样转发给目标
+}
+
+// match 按顺序返回第一个匹配的路由项的目标
+func (r *router) match(s sniffResult) (string, bool) {
+	for i, route := range r.routes {
+		if route.Prefix != "" {
+			if bytes.HasPrefix(s.data, r.prefixes[i]) {
+				return route.Target, true
+			}
+		} else if route.matchHost(s.host) {
+			return route.Target, true
+		}
+	}
+	return "", false
+}
+
+// sniff 预读连接开头的数据直到能判断协议与主机名：TLS 读完第一个记录，HTTP 读完请求头，
+// 其他数据读到足够字节匹配的长度。超时、连接关闭或超过 routeSniffBytes 时按已读到的数据判断
+func (r *router) sniff(conn net.Conn) sniffResult {
+	conn.SetReadDeadline(time.Now().Add(routeSniffTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var s sniffResult
+	buf := make([]byte, 4096)
+	for len(s.data) < routeSniffBytes && !r.sniffDone(s.data) {
+		n, err := conn.Read(buf)
+		s.data = append(s.data, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	switch {
+	case len(s.data) > 0 && s.data[0] == 0x16:
+		s.protocol = "tls"
+		if len(s.data) >= 5 {
+			info := &ClientHelloInfo{}
+			length := int(binary.BigEndian.Uint16(s.data[3:5]))
+			if len(s.data) >= 5+length && parseClientHello(s.data[5:5+length], info) == nil {
+				s.host = info.SNI
+			}
+		}
+	case httpMethodPrefix(s.data) == 1:
+		s.protocol = "http"
+		s.host = httpHost(s.data)
+	}
+	return s
+}
+
+// sniffDone 已读取的数据是否足够判断
+func (r *router) sniffDone(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	if data[0] == 0x16 {
+		return len(data) >= 5 && len(data) >= 5+int(binary.BigEndian.Uint16(data[3:5]))
+	}
+	switch httpMethodPrefix(data) {
+	case 1:
+		return bytes.Contains(data, []byte("\r\n\r\n"))
+	case 0:
+		return false
+	}
+	return len(data) >= r.minBytes
+}
+
+// httpMethodPrefix 数据是否以 HTTP 请求方法开头：1 是，-1 不是，0 数据太短还不能判断
+func httpMethodPrefix(data []byte) int {
+	for i, c := range data {
+		if c == ' ' && i > 0 {
+			return 1
+		}
+		if c < 'A' || c > 'Z' || i >= 8 {
+			return -1
+		}
+	}
+	return 0
+}
+
+// httpHost 从 HTTP 请求头中取 Host 头的主机名
+func httpHost(data []byte) string {
+	if end := bytes.Index(data, []byte("\r\n\r\n")); end >= 0 {
+		data = data[:end]
+	}
+	for _, line := range strings.Split(string(data), "\r\n")[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "host") {
+			continue
+		}
+		host := strings.TrimSpace(value)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			return h
+		}
+		return strings.Trim(host, "[]")
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package forward
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// SCTPSupported 当前平台是否支持SCTP
+const SCTPSupported = true
+
+// ListenSCTP 创建一对一(SOCK_STREAM)风格的SCTP监听套接字
+func ListenSCTP(address string) (net.Listener, error) {
+	family, sa, err := sctpSockaddr(address)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SCTP socket: %w", err)
+	}
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to set SO_REUSEADDR: %w", err)
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	// 交给 net 包管理，之后可以像TCP监听器一样 Accept
+	file := os.NewFile(uintptr(fd), "sctp:"+address)
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// dialSCTP 连接到SCTP目标
+func dialSCTP(address string) (net.Conn, error) {
+	family, sa, err := sctpSockaddr(address)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SCTP socket: %w", err)
+	}
+	if err := syscall.Connect(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	file := os.NewFile(uintptr(fd), "sctp:"+address)
+	defer file.Close()
+	return net.FileConn(file)
+}
+
+// sctpSockaddr 解析地址为 syscall 使用的 Sockaddr
+func sctpSockaddr(address string) (int, syscall.Sockaddr, error) {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to resolve %s: %w", address, err)
+	}
+
+	if ip4 := addr.IP.To4(); ip4 != nil || addr.IP == nil {
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		return syscall.AF_INET, sa, nil
+	}
+
+	sa := &syscall.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To16())
+	return syscall.AF_INET6, sa, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package forward
+
+import (
+	"errors"
+	"net"
+)
+
+// SCTPSupported 当前平台是否支持SCTP
+const SCTPSupported = false
+
+var errSCTPUnsupported = errors.New("SCTP is not supported on this platform")
+
+// ListenSCTP 当前平台不支持SCTP
+func ListenSCTP(address string) (net.Listener, error) {
+	return nil, errSCTPUnsupported
+}
+
+// dialSCTP 当前平台不支持SCTP
+func dialSCTP(address string) (net.Conn, error) {
+	return nil, errSCTPUnsupported
+}
@@ -0,0 +1,55 @@
+package forward
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Shutdown 停止所有转发：TCP 转发进入排空，最多等待 timeout 后强制关闭剩余连接
+func (f *Forwarder) Shutdown(timeout time.Duration) {
+	f.mu.Lock()
+	var tcp, udp, sctp, socks [][2]string
+	for key := range f.tcpListeners {
+		tcp = append(tcp, splitForwardKey(key))
+	}
+	for key := range f.udpListeners {
+		udp = append(udp, splitForwardKey(key))
+	}
+	for key := range f.sctpListeners {
+		sctp = append(sctp, splitForwardKey(key))
+	}
+	for key := range f.socksListeners {
+		socks = append(socks, splitForwardKey(key))
+	}
+	f.mu.Unlock()
+
+	for _, l := range udp {
+		f.StopUDPForward(l[0], l[1])
+	}
+	for _, l := range sctp {
+		f.StopSCTPForward(l[0], l[1])
+	}
+	for _, l := range socks {
+		f.StopSOCKS5Forward(l[0], l[1])
+	}
+	for _, l := range tcp {
+		if err := f.DrainTCPForward(l[0], l[1], timeout); err != nil {
+			log.Printf("Failed to drain TCP forward %s: %v", net.JoinHostPort(l[0], l[1]), err)
+		}
+	}
+
+	// 排空在 timeout 到期时强制关闭连接，这里多留一点时间让其完成
+	deadline := time.Now().Add(timeout + time.Second)
+	for len(f.Drains()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// splitForwardKey 把 "protocol:addr:port" 拆成监听地址与端口（地址可能是含冒号的 IPv6）
+func splitForwardKey(key string) [2]string {
+	rest := key[strings.Index(key, ":")+1:]
+	i := strings.LastIndex(rest, ":")
+	return [2]string{rest[:i], rest[i+1:]}
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !windows
+
+package forward
+
+import (
+	"errors"
+	"net"
+)
+
+// checkAcceptConn 当前平台无法查询监听状态，只检查套接字是否关闭
+func checkAcceptConn(fd uintptr) error {
+	return nil
+}
+
+// setMulticastOptions 当前平台不支持设置组播选项
+func setMulticastOptions(fd uintptr, ifaddr net.IP, ttl int) error {
+	return errors.New("multicast relay is not supported on this platform")
+}
+
+// datagramTruncated 当前平台无法判断数据报是否被截断
+func datagramTruncated(flags int, err error) bool {
+	return false
+}
@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package forward
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// checkAcceptConn 通过 SO_ACCEPTCONN 检查套接字是否处于监听状态
+func checkAcceptConn(fd uintptr) error {
+	v, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+	if err != nil {
+		return err
+	}
+	if v == 0 {
+		return errors.New("socket is no longer listening")
+	}
+	return nil
+}
+
+// setMulticastOptions 设置发送组播的出接口（ifaddr 为 nil 时按系统路由）与 TTL，并关闭本机回环
+func setMulticastOptions(fd uintptr, ifaddr net.IP, ttl int) error {
+	if ifaddr != nil {
+		var addr [4]byte
+		copy(addr[:], ifaddr.To4())
+		if err := syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, addr); err != nil {
+			return err
+		}
+	}
+	if err := syscall.SetsockoptByte(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, byte(ttl)); err != nil {
+		return err
+	}
+	return syscall.SetsockoptByte(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 0)
+}
+
+// datagramTruncated 读取的数据报是否因超过缓冲区而被截断（MSG_TRUNC）
+func datagramTruncated(flags int, err error) bool {
+	return flags&syscall.MSG_TRUNC != 0
+}
@@ -0,0 +1,50 @@
+//go:build windows
+
+package forward
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// soAcceptConn Winsock 的 SO_ACCEPTCONN，syscall 包中没有定义
+const soAcceptConn = 0x0002
+
+// checkAcceptConn 通过 SO_ACCEPTCONN 检查套接字是否处于监听状态
+func checkAcceptConn(fd uintptr) error {
+	var v int32
+	size := int32(unsafe.Sizeof(v))
+	if err := syscall.Getsockopt(syscall.Handle(fd), syscall.SOL_SOCKET, soAcceptConn, (*byte)(unsafe.Pointer(&v)), &size); err != nil {
+		return err
+	}
+	if v == 0 {
+		return errors.New("socket is no longer listening")
+	}
+	return nil
+}
+
+// setMulticastOptions 设置发送组播的出接口（ifaddr 为 nil 时按系统路由）与 TTL，并关闭本机回环
+func setMulticastOptions(fd uintptr, ifaddr net.IP, ttl int) error {
+	h := syscall.Handle(fd)
+	if ifaddr != nil {
+		var addr [4]byte
+		copy(addr[:], ifaddr.To4())
+		if err := syscall.SetsockoptInet4Addr(h, syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, addr); err != nil {
+			return err
+		}
+	}
+	if err := syscall.SetsockoptInt(h, syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, ttl); err != nil {
+		return err
+	}
+	return syscall.SetsockoptInt(h, syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 0)
+}
+
+// wsaEMSGSIZE 数据报超过接收缓冲区时 WSARecvFrom 返回的错误，syscall 包没有定义
+const wsaEMSGSIZE = syscall.Errno(10040)
+
+// datagramTruncated 读取的数据报是否因超过缓冲区而被截断，Windows 上以 WSAEMSGSIZE 错误返回
+func datagramTruncated(flags int, err error) bool {
+	return errors.Is(err, wsaEMSGSIZE)
+}
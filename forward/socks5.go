@@ -0,0 +1,433 @@
+package forward
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// SOCKS5 协议常量（RFC 1928 / RFC 1929）
+const (
+	socks5Version = 0x05
+
+	socks5MethodNoAuth       = 0x00
+	socks5MethodUserPass     = 0x02
+	socks5MethodNoAcceptable = 0xff
+
+	socks5CmdConnect = 0x01
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSuccess             = 0x00
+	socks5RepFailure             = 0x01
+	socks5RepNotAllowed          = 0x02
+	socks5RepNetworkUnreachable  = 0x03
+	socks5RepHostUnreachable     = 0x04
+	socks5RepConnectionRefused   = 0x05
+	socks5RepCommandNotSupported = 0x07
+	socks5RepAtypNotSupported    = 0x08
+)
+
+// socks5HandshakeTimeout 完成握手与请求的最长时间
+const socks5HandshakeTimeout = 10 * time.Second
+
+// socks5DialTimeout 连接客户端请求的目标的超时
+const socks5DialTimeout = 10 * time.Second
+
+// SOCKS5Config SOCKS5 模式的认证配置，用户名为空时不需要认证
+type SOCKS5Config struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// RequiresAuth 是否需要用户名密码认证，nil 安全
+func (c *SOCKS5Config) RequiresAuth() bool {
+	return c != nil && c.Username != ""
+}
+
+// StartSOCKS5Forward 在监听地址上启动 SOCKS5 代理，目标由客户端指定
+func (f *Forwarder) StartSOCKS5Forward(listenAddr, listenPort string) error {
+	if IsPortRange(listenPort) {
+		return f.startPortRange("socks5", listenAddr, listenPort, "", "")
+	}
+	key := forwardKey("socks5", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否已经在运行
+	if _, exists := f.socksListeners[key]; exists {
+		return fmt.Errorf("SOCKS5 proxy %w on %s", ErrRunning, net.JoinHostPort(listenAddr, listenPort))
+	}
+
+	// 监听本地端口
+	addr := net.JoinHostPort(listenAddr, listenPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	// 保存监听器
+	f.socksListeners[key] = listener
+	f.targets[key] = ""
+	f.changed()
+	stats := &Stats{}
+	f.stats[key] = stats
+	conns := newConnTracker()
+	f.conns[key] = conns
+
+	// 启动代理协程
+	opts := f.options(listenAddr, listenPort, f.targets[key])
+	ctx := f.begin(key)
+	go f.serve(ctx, "socks5", listenAddr, listenPort, listener, func(l io.Closer) error {
+		return f.handleSOCKS5Forward(ctx, l.(net.Listener), stats, conns, f.allowFunc(listenAddr, listenPort, ""), opts)
+	}, func() (io.Closer, error) {
+		return net.Listen("tcp", addr)
+	})
+
+	opts.Log.Infof("Started SOCKS5 proxy: %s", net.JoinHostPort(listenAddr, listenPort))
+	return nil
+}
+
+// StopSOCKS5Forward 停止 SOCKS5 代理
+func (f *Forwarder) StopSOCKS5Forward(listenAddr, listenPort string) error {
+	if IsPortRange(listenPort) {
+		return f.stopPortRange("socks5", listenAddr, listenPort)
+	}
+	key := forwardKey("socks5", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 检查是否在运行
+	listener, exists := f.socksListeners[key]
+	if !exists {
+		return fmt.Errorf("SOCKS5 proxy not running on %s", net.JoinHostPort(listenAddr, listenPort))
+	}
+
+	// 关闭监听器
+	if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to close listener: %w", err)
+	}
+
+	// 删除监听器
+	delete(f.socksListeners, key)
+	target := f.targets[key]
+	delete(f.targets, key)
+	f.changed()
+	delete(f.stats, key)
+	f.end(key)
+	delete(f.conns, key)
+
+	f.listenLog(listenAddr, listenPort, target).Infof("Stopped SOCKS5 proxy: %s", net.JoinHostPort(listenAddr, listenPort))
+	return nil
+}
+
+// IsSOCKS5Running 检查 SOCKS5 代理是否在运行
+func (f *Forwarder) IsSOCKS5Running(listenAddr, listenPort string) bool {
+	if IsPortRange(listenPort) {
+		return f.portRangeRunning("socks5", listenAddr, listenPort)
+	}
+	key := forwardKey("socks5", listenAddr, listenPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, exists := f.socksListeners[key]
+	return exists
+}
+
+// handleSOCKS5Forward 接受 SOCKS5 客户端，握手后连接其请求的目标并双向转发
+func (f *Forwarder) handleSOCKS5Forward(ctx context.Context, listener net.Listener, stats *Stats, conns *connTracker, allow func(net.IP) bool, opts Options) error {
+	defer stats.track(1, 1, 0)()
+
+	for {
+		// 接受新连接
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				opts.Log.Warnf("Temporary error accepting connection: %v", err)
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				// 停止转发时关闭了监听器
+				opts.Log.Debugf("Listener closed: %v", err)
+				return nil
+			}
+			opts.Log.Errorf("Error accepting connection: %v", err)
+			return err
+		}
+
+		// 拒绝被拦截的来源
+		if !allow(RemoteIP(conn.RemoteAddr())) {
+			stats.Blocked.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 资源保护：超过进程级上限时拒绝新连接
+		if !f.Guard.admit() {
+			stats.Refused.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 规则的同时连接数上限
+		if !opts.Slots.acquire() {
+			f.Guard.release()
+			stats.OverLimit.Add(1)
+			conn.Close()
+			continue
+		}
+
+		// 处理连接
+		go func(conn net.Conn) {
+			defer conn.Close()
+			defer f.Guard.release()
+			defer opts.Slots.release()
+			defer stats.track(1, 1, 0)()
+			defer closeOnCancel(ctx, stats, conn)()
+
+			stats.TotalConns.Add(1)
+			stats.ActiveConns.Add(1)
+			defer stats.ActiveConns.Add(-1)
+
+			tracked := conns.add(conn)
+			defer conns.remove(tracked)
+			opts.TCP.apply(conn, opts.Log)
+
+			// 握手并读取请求的目标
+			conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+			target, err := socks5Handshake(conn, opts.SOCKS5)
+			if err != nil {
+				opts.Log.Warnf("SOCKS5 handshake with %s failed: %v", f.clientLabel(conn.RemoteAddr()), err)
+				return
+			}
+
+			// 目标由客户端指定，握手之后才开始观察
+			var bytesIn, bytesOut int64
+			obs := f.observe("socks5", conn, target, opts.Log)
+			defer func() { obs.Closed(bytesIn, bytesOut) }()
+
+			// 连接到客户端请求的目标
+			obs.DialStarted()
+			d := net.Dialer{Timeout: opts.TCP.dialTimeout(socks5DialTimeout)}
+			var targetConn net.Conn
+			if opts.Dialer != nil {
+				targetConn, err = dialVia(ctx, opts.Dialer, d.Timeout, target)
+			} else {
+				targetConn, err = opts.Bind.dial(ctx, d, "tcp", target)
+			}
+			obs.DialDone(err)
+			if err != nil {
+				stats.DialFailures.Add(1)
+				socks5Reply(conn, socks5DialReply(err), nil)
+				opts.Log.Errorf("SOCKS5 error connecting to target %s: %v", target, err)
+				return
+			}
+			defer targetConn.Close()
+			defer stats.track(0, 1, 0)()
+			conns.setTarget(tracked, targetConn)
+			opts.TCP.apply(targetConn, opts.Log)
+
+			if err := socks5Reply(conn, socks5RepSuccess, targetConn.LocalAddr()); err != nil {
+				return
+			}
+			conn.SetDeadline(time.Time{})
+
+			// 抓包：记录客户端一侧收发的数据
+			if opts.Tap != nil {
+				conn = &tapConn{Conn: conn, tap: opts.Tap, protocol: "tcp"}
+			}
+
+			// 弱网模拟：对两个方向的写入施加延迟与丢包
+			if opts.Emulation.Active() {
+				conn = newImpairedConn(conn, opts.Emulation)
+				targetConn = newImpairedConn(targetConn, opts.Emulation)
+				defer conn.Close()
+				defer targetConn.Close()
+			}
+
+			// 全局限速：按规则优先级共享带宽
+			if f.Limiter != nil {
+				conn = &limitedConn{Conn: conn, limiter: f.Limiter, priority: opts.Priority}
+				targetConn = &limitedConn{Conn: targetConn, limiter: f.Limiter, priority: opts.Priority}
+			}
+
+			// 双向转发数据
+			bytesIn, bytesOut = f.forwardData(conn, targetConn, stats, opts.Limits, tracked)
+			f.recordCountry(stats, RemoteIP(conn.RemoteAddr()), bytesIn, bytesOut)
+		}(conn)
+	}
+}
+
+// socks5Handshake 完成方法协商、认证与请求解析，返回 host:port 形式的目标
+// 失败时已向客户端发送对应的错误应答
+func socks5Handshake(conn net.Conn, auth *SOCKS5Config) (string, error) {
+	// 方法协商：VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socks5MethodNoAuth)
+	if auth.RequiresAuth() {
+		method = socks5MethodUserPass
+	}
+	offered := false
+	for _, m := range methods {
+		if m == method {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socks5Version, socks5MethodNoAcceptable})
+		return "", errors.New("no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+
+	if method == socks5MethodUserPass {
+		if err := socks5Authenticate(conn, auth); err != nil {
+			return "", err
+		}
+	}
+
+	// 请求：VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version %d in request", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		size := net.IPv4len
+		if request[3] == socks5AtypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5AtypDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		socks5Reply(conn, socks5RepAtypNotSupported, nil)
+		return "", fmt.Errorf("unsupported address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	// 仅支持 CONNECT
+	if request[1] != socks5CmdConnect {
+		socks5Reply(conn, socks5RepCommandNotSupported, nil)
+		return "", fmt.Errorf("unsupported command %d for %s", request[1], target)
+	}
+	return target, nil
+}
+
+// socks5Authenticate 用户名密码认证（RFC 1929）
+func socks5Authenticate(conn net.Conn, auth *SOCKS5Config) error {
+	// VER ULEN UNAME PLEN PASSWD
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return err
+	}
+	plen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, plen); err != nil {
+		return err
+	}
+	password := make([]byte, plen[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return err
+	}
+
+	userOK := subtle.ConstantTimeCompare(username, []byte(auth.Username)) == 1
+	passOK := subtle.ConstantTimeCompare(password, []byte(auth.Password)) == 1
+	if header[0] != 0x01 || !userOK || !passOK {
+		conn.Write([]byte{0x01, 0x01})
+		return fmt.Errorf("authentication failed for user %q", username)
+	}
+	_, err := conn.Write([]byte{0x01, 0x00})
+	return err
+}
+
+// socks5Reply 发送应答，bound 为 nil 时地址填 0.0.0.0:0
+func socks5Reply(conn net.Conn, rep byte, bound net.Addr) error {
+	reply := []byte{socks5Version, rep, 0x00}
+	ip := net.IPv4zero.To4()
+	port := 0
+	if addr, ok := bound.(*net.TCPAddr); ok {
+		ip, port = addr.IP, addr.Port
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		reply = append(reply, socks5AtypIPv4)
+		reply = append(reply, ip4...)
+	} else {
+		reply = append(reply, socks5AtypIPv6)
+		reply = append(reply, ip.To16()...)
+	}
+	reply = binary.BigEndian.AppendUint16(reply, uint16(port))
+	_, err := conn.Write(reply)
+	return err
+}
+
+// socks5DialReply 把连接目标的错误映射为 SOCKS5 应答码
+func socks5DialReply(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socks5RepConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return socks5RepNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return socks5RepHostUnreachable
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return socks5RepHostUnreachable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return socks5RepHostUnreachable
+	}
+	return socks5RepFailure
+}
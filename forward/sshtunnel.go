@@ -0,0 +1,263 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH 跳板机连接的超时与保活间隔
+const (
+	sshConnectTimeout    = 15 * time.Second
+	sshKeepAliveInterval = 30 * time.Second
+)
+
+// Dialer 连接目标使用的拨号器，如经 SSH 跳板机连接
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// dialVia 以拨号器连接 TCP 目标，timeout 大于 0 时限制连接用时
+func dialVia(ctx context.Context, dialer Dialer, timeout time.Duration, target string) (net.Conn, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return dialer.DialContext(ctx, "tcp", target)
+}
+
+// SSHJump SSH 跳板机的连接参数，Password 与 PrivateKey 至少设置一个
+type SSHJump struct {
+	Addr       string // 跳板机 host:port
+	User       string
+	Password   string
+	PrivateKey []byte // PEM 格式的私钥
+	HostKey    string // 跳板机主机密钥的 SHA256 指纹（SHA256:...）
+
+	// TrustHostKey HostKey 为空时，首次连接由它记下跳板机的指纹（TOFU），之后不一致时拒绝连接。
+	// 两者都未设置时不能连接，不会跳过主机密钥校验
+	TrustHostKey func(fingerprint string) error
+}
+
+// Validate 校验连接参数并解析私钥
+func (j SSHJump) Validate() error {
+	_, err := j.clientConfig()
+	return err
+}
+
+// clientConfig 生成 SSH 客户端配置
+func (j SSHJump) clientConfig() (*ssh.ClientConfig, error) {
+	if _, _, err := net.SplitHostPort(j.Addr); err != nil {
+		return nil, fmt.Errorf("invalid SSH host %q, use host:port", j.Addr)
+	}
+	if j.User == "" {
+		return nil, errors.New("SSH user is required")
+	}
+	var auth []ssh.AuthMethod
+	if len(j.PrivateKey) > 0 {
+		signer, err := ssh.ParsePrivateKey(j.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if j.Password != "" {
+		auth = append(auth, ssh.Password(j.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("SSH password or private key is required")
+	}
+	if j.HostKey == "" && j.TrustHostKey == nil {
+		return nil, errors.New("SSH host key fingerprint is required")
+	}
+	return &ssh.ClientConfig{
+		User:    j.User,
+		Auth:    auth,
+		Timeout: sshConnectTimeout,
+	}, nil
+}
+
+// SSHTunnel 维持到跳板机的一个 SSH 连接，经它连接目标的转发连接作为通道复用该连接。
+// 连接在首次使用时建立，断开后下次使用时重新建立
+type SSHTunnel struct {
+	Log Logger // 为 nil 时不记录
+
+	jump   SSHJump
+	config *ssh.ClientConfig
+
+	mu      sync.Mutex
+	client  *ssh.Client
+	closed  bool
+	hostKey string // 校验时要求的指纹，首次连接信任后记下
+}
+
+// NewSSHTunnel 创建经跳板机连接目标的拨号器，参数无效时返回错误
+func NewSSHTunnel(jump SSHJump) (*SSHTunnel, error) {
+	config, err := jump.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	t := &SSHTunnel{jump: jump, config: config, hostKey: jump.HostKey}
+	config.HostKeyCallback = t.checkHostKey
+	return t, nil
+}
+
+// checkHostKey 校验跳板机的主机密钥。未设置指纹时信任首次连接的密钥并记下，
+// 之后不一致时拒绝连接。在 connect 中握手时调用，已持有 t.mu
+func (t *SSHTunnel) checkHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	got := ssh.FingerprintSHA256(key)
+	if t.hostKey == "" {
+		if err := t.jump.TrustHostKey(got); err != nil {
+			return fmt.Errorf("failed to record SSH host key %s: %v", got, err)
+		}
+		t.hostKey = got
+		if t.Log != nil {
+			t.Log.Warnf("SSH host %s: trusting host key %s on first connect", t.jump.Addr, got)
+		}
+		return nil
+	}
+	if got != t.hostKey {
+		return fmt.Errorf("SSH host key mismatch: got %s, want %s", got, t.hostKey)
+	}
+	return nil
+}
+
+// DialContext 经跳板机连接目标（仅 TCP）。SSH 连接已断开时重新连接后再试一次
+func (t *SSHTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, reused, err := t.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := client.DialContext(ctx, network, addr)
+		if err == nil {
+			return &sshConn{Conn: conn, remote: dialAddr(addr)}, nil
+		}
+		// 通道被拒绝说明 SSH 连接正常，是目标不可达
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) || ctx.Err() != nil || !reused || attempt > 0 {
+			return nil, err
+		}
+		t.drop(client)
+	}
+}
+
+// Connected SSH 连接当前是否已建立
+func (t *SSHTunnel) Connected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client != nil
+}
+
+// Close 关闭 SSH 连接，经它建立的转发连接随之断开，之后不能再使用
+func (t *SSHTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
+
+// connect 返回已建立的 SSH 连接，没有时建立新连接。reused 表示连接是之前建立的
+func (t *SSHTunnel) connect(ctx context.Context) (client *ssh.Client, reused bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, false, errors.New("SSH tunnel closed")
+	}
+	if t.client != nil {
+		return t.client, true, nil
+	}
+
+	d := net.Dialer{Timeout: sshConnectTimeout}
+	conn, err := d.DialContext(ctx, "tcp", t.jump.Addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("SSH host %s: %v", t.jump.Addr, err)
+	}
+	// 握手阶段的超时，建立后清除
+	conn.SetDeadline(time.Now().Add(sshConnectTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.jump.Addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("SSH host %s: %v", t.jump.Addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	client = ssh.NewClient(c, chans, reqs)
+	t.client = client
+	if t.Log != nil {
+		t.Log.Infof("SSH connected to %s@%s", t.jump.User, t.jump.Addr)
+	}
+	go t.keepAlive(client)
+	go func() {
+		err := client.Wait()
+		if t.drop(client) && t.Log != nil {
+			t.Log.Warnf("SSH connection to %s closed: %v", t.jump.Addr, err)
+		}
+	}()
+	return client, false, nil
+}
+
+// drop 关闭并丢弃断开的连接，下次使用时重新连接。返回连接是否仍是当前连接
+func (t *SSHTunnel) drop(client *ssh.Client) bool {
+	t.mu.Lock()
+	current := t.client == client
+	if current {
+		t.client = nil
+	}
+	t.mu.Unlock()
+	client.Close()
+	return current
+}
+
+// keepAlive 定期发送保活请求，跳板机无响应时关闭连接
+func (t *SSHTunnel) keepAlive(client *ssh.Client) {
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				continue
+			}
+		case <-time.After(sshConnectTimeout):
+		}
+		t.drop(client)
+		return
+	}
+}
+
+// sshConn 经 SSH 通道建立的连接。通道本身的地址为零值，这里以目标地址作为远端地址
+type sshConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *sshConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// CloseWrite 半关闭 SSH 通道
+func (c *sshConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+// dialAddr 经跳板机或中继节点连接的目标地址
+type dialAddr string
+
+func (a dialAddr) Network() string { return "tcp" }
+func (a dialAddr) String() string  { return string(a) }
@@ -0,0 +1,156 @@
+package forward
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats 单个转发的流量统计
+type Stats struct {
+	BytesIn      atomic.Int64 // 客户端 -> 目标
+	BytesOut     atomic.Int64 // 目标 -> 客户端
+	ActiveConns  atomic.Int64
+	TotalConns   atomic.Int64
+	DialFailures atomic.Int64 // 连接目标失败次数
+	Blocked      atomic.Int64 // 被拦截的连接/数据包数
+	Refused      atomic.Int64 // 资源保护拒绝的连接/数据包数
+	OverLimit    atomic.Int64 // 超过规则连接数上限被拒绝的连接数
+	Oversized    atomic.Int64 // 超过缓冲区被丢弃的UDP数据报数
+
+	// 资源占用
+	Goroutines  atomic.Int64
+	OpenFDs     atomic.Int64 // 监听器与连接占用的文件描述符/句柄
+	BufferBytes atomic.Int64 // 转发缓冲区占用的内存
+
+	geo geoCounters // 按客户端国家的统计（需加载 GeoIP 数据库）
+}
+
+// StatsSnapshot 流量统计快照
+type StatsSnapshot struct {
+	BytesIn      int64 `json:"bytesIn"`
+	BytesOut     int64 `json:"bytesOut"`
+	ActiveConns  int64 `json:"activeConns"`
+	TotalConns   int64 `json:"totalConns"`
+	DialFailures int64 `json:"dialFailures"`
+	Blocked      int64 `json:"blocked"`
+	Refused      int64 `json:"refused"`
+	OverLimit    int64 `json:"overLimit"`
+	Oversized    int64 `json:"oversized"`
+	Goroutines   int64 `json:"goroutines"`
+	OpenFDs      int64 `json:"openFds"`
+	BufferBytes  int64 `json:"bufferBytes"`
+}
+
+// Snapshot 读取当前统计值
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		BytesIn:      s.BytesIn.Load(),
+		BytesOut:     s.BytesOut.Load(),
+		ActiveConns:  s.ActiveConns.Load(),
+		TotalConns:   s.TotalConns.Load(),
+		DialFailures: s.DialFailures.Load(),
+		Blocked:      s.Blocked.Load(),
+		Refused:      s.Refused.Load(),
+		OverLimit:    s.OverLimit.Load(),
+		Oversized:    s.Oversized.Load(),
+		Goroutines:   s.Goroutines.Load(),
+		OpenFDs:      s.OpenFDs.Load(),
+		BufferBytes:  s.BufferBytes.Load(),
+	}
+}
+
+// track 登记资源占用，返回的函数用于释放，通常配合 defer 使用
+func (s *Stats) track(goroutines, fds, bufferBytes int64) func() {
+	s.Goroutines.Add(goroutines)
+	s.OpenFDs.Add(fds)
+	s.BufferBytes.Add(bufferBytes)
+	return func() {
+		s.Goroutines.Add(-goroutines)
+		s.OpenFDs.Add(-fds)
+		s.BufferBytes.Add(-bufferBytes)
+	}
+}
+
+// Stats 获取监听地址上转发到 targetAddr:targetPort 的转发的统计快照（SOCKS5 的目标为空），
+// 端口范围时为各端口的合计，目标端口按偏移对应。监听地址上正在运行的是其他目标的转发
+// （监听同一地址的另一条规则）或未运行时返回 false
+func (f *Forwarder) Stats(protocol, listenAddr, listenPort, targetAddr, targetPort string) (StatsSnapshot, bool) {
+	if IsPortRange(listenPort) {
+		return f.portRangeStats(protocol, listenAddr, listenPort, targetAddr, targetPort)
+	}
+	key := forwardKey(protocol, listenAddr, listenPort)
+	target := ""
+	if targetAddr != "" && targetPort != "" {
+		target = net.JoinHostPort(targetAddr, targetPort)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats, exists := f.stats[key]
+	if !exists || f.targets[key] != target {
+		return StatsSnapshot{}, false
+	}
+	return stats.Snapshot(), true
+}
+
+// CountryStats 单个国家的聚合统计
+type CountryStats struct {
+	Country     string `json:"country"`
+	Connections int64  `json:"connections"`
+	BytesIn     int64  `json:"bytesIn"`
+	BytesOut    int64  `json:"bytesOut"`
+}
+
+// geoCounters 单个转发按国家的计数
+type geoCounters struct {
+	mu        sync.Mutex
+	countries map[string]*CountryStats
+}
+
+// record 累加一次连接（或UDP数据包）的计数
+func (g *geoCounters) record(country string, bytesIn, bytesOut int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.countries == nil {
+		g.countries = make(map[string]*CountryStats)
+	}
+	c, ok := g.countries[country]
+	if !ok {
+		c = &CountryStats{Country: country}
+		g.countries[country] = c
+	}
+	c.Connections++
+	c.BytesIn += bytesIn
+	c.BytesOut += bytesOut
+}
+
+// snapshot 复制当前计数
+func (g *geoCounters) snapshot() []CountryStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]CountryStats, 0, len(g.countries))
+	for _, c := range g.countries {
+		list = append(list, *c)
+	}
+	return list
+}
+
+// recordCountry 累加来源国家的计数
+func (s *Stats) recordCountry(country string, bytesIn, bytesOut int64) {
+	s.geo.record(country, bytesIn, bytesOut)
+}
+
+// CountryStats 获取指定转发按国家的统计
+func (f *Forwarder) CountryStats(protocol, listenAddr, listenPort string) []CountryStats {
+	key := forwardKey(protocol, listenAddr, listenPort)
+
+	f.mu.Lock()
+	stats, exists := f.stats[key]
+	f.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	return stats.geo.snapshot()
+}
@@ -0,0 +1,37 @@
+package forward
+
+import "net"
+
+// Tap 接收转发经过客户端一侧的数据，用于抓包调试。实现需要并发安全，且不能保留 payload
+type Tap interface {
+	// Packet 记录 src 发往 dst 的一段数据：TCP 为一次读写的数据，UDP 为一个数据报
+	Packet(protocol string, src, dst net.Addr, payload []byte)
+}
+
+// tapConn 把读写的数据交给 Tap 的连接：读到的是客户端发来的数据，写入的是发回客户端的数据
+type tapConn struct {
+	net.Conn
+	tap      Tap
+	protocol string
+}
+
+func (c *tapConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.tap.Packet(c.protocol, c.RemoteAddr(), c.LocalAddr(), p[:n])
+	}
+	return n, err
+}
+
+func (c *tapConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.tap.Packet(c.protocol, c.LocalAddr(), c.RemoteAddr(), p[:n])
+	}
+	return n, err
+}
+
+// CloseWrite 半关闭被包装的连接
+func (c *tapConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
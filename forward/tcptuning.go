@@ -0,0 +1,67 @@
+package forward
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// 保活间隔与连接超时的上限（秒）
+const (
+	maxKeepAliveSeconds   = 7200
+	maxDialTimeoutSeconds = 300
+)
+
+// TCPTuning TCP 连接的保活、TCP_NODELAY 与连接目标的超时，同时作用于客户端与目标两侧的连接（TCP/SOCKS5）
+type TCPTuning struct {
+	KeepAlive   int   `json:"keepAlive,omitempty"`   // SO_KEEPALIVE 探测间隔秒数，0 使用系统默认，-1 关闭保活
+	NoDelay     *bool `json:"noDelay,omitempty"`     // TCP_NODELAY，为 nil 时保持默认（开启）
+	DialTimeout int   `json:"dialTimeout,omitempty"` // 连接目标的超时秒数，0 使用默认值
+}
+
+// Validate 校验配置
+func (t TCPTuning) Validate() error {
+	if t.KeepAlive < -1 || t.KeepAlive > maxKeepAliveSeconds {
+		return errors.New("keepAlive must be -1 (off), 0 (system default) or at most 7200 seconds")
+	}
+	if t.DialTimeout < 0 || t.DialTimeout > maxDialTimeoutSeconds {
+		return errors.New("dialTimeout must be between 0 and 300 seconds")
+	}
+	return nil
+}
+
+// Enabled 是否设置了任一项，nil 安全
+func (t *TCPTuning) Enabled() bool {
+	return t != nil && (t.KeepAlive != 0 || t.NoDelay != nil || t.DialTimeout != 0)
+}
+
+// dialTimeout 连接目标的超时，未设置时返回 def
+func (t *TCPTuning) dialTimeout(def time.Duration) time.Duration {
+	if t == nil || t.DialTimeout <= 0 {
+		return def
+	}
+	return time.Duration(t.DialTimeout) * time.Second
+}
+
+// apply 按配置设置连接的保活与 TCP_NODELAY，conn 不是 TCP 连接时不做处理
+func (t *TCPTuning) apply(conn net.Conn, lg Logger) {
+	tcp, ok := conn.(*net.TCPConn)
+	if !t.Enabled() || !ok {
+		return
+	}
+	var err error
+	switch {
+	case t.KeepAlive < 0:
+		err = tcp.SetKeepAlive(false)
+	case t.KeepAlive > 0:
+		if err = tcp.SetKeepAlive(true); err == nil {
+			err = tcp.SetKeepAlivePeriod(time.Duration(t.KeepAlive) * time.Second)
+		}
+	}
+	if err == nil && t.NoDelay != nil {
+		err = tcp.SetNoDelay(*t.NoDelay)
+	}
+	if err != nil {
+		lg.Warnf("Failed to set TCP options on %s: %v", conn.RemoteAddr(), err)
+	}
+}
@@ -0,0 +1,80 @@
+package forward
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// tlsHandshakeTimeout 与目标进行 TLS 握手的超时
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TLSTarget 以 TLS 连接目标的配置（客户端明文进入，转发器加密后发往目标）
+type TLSTarget struct {
+	Enabled            bool   `json:"enabled"`
+	ServerName         string `json:"serverName,omitempty"` // SNI 与证书校验使用的名称，为空时使用目标地址
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	CAFile             string `json:"caFile,omitempty"` // PEM 格式的 CA 证书，为空时使用系统根证书
+}
+
+// loadCAPool 读取 PEM 格式的 CA 证书
+func loadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// Validate 校验配置
+func (t *TLSTarget) Validate() error {
+	if t.CAFile != "" {
+		if _, err := loadCAPool(t.CAFile); err != nil {
+			return fmt.Errorf("invalid CA file: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClientConfig 生成连接目标使用的 TLS 配置，未启用时返回 nil
+// CA 文件读取失败时使用空的证书池，使握手失败而不是退回到不校验
+func (t *TLSTarget) ClientConfig(targetAddr string) *tls.Config {
+	if t == nil || !t.Enabled {
+		return nil
+	}
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if config.ServerName == "" {
+		config.ServerName = targetAddr
+	}
+	if t.CAFile != "" {
+		pool, err := loadCAPool(t.CAFile)
+		if err != nil {
+			log.Printf("Failed to load CA file for TLS target %s: %v", targetAddr, err)
+			pool = x509.NewCertPool()
+		}
+		config.RootCAs = pool
+	}
+	return config
+}
+
+// dialTLSTarget 在已建立的连接上与目标完成 TLS 握手
+func dialTLSTarget(conn net.Conn, config *tls.Config) (net.Conn, error) {
+	tlsConn := tls.Client(conn, config)
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// TransparentSupported 当前平台是否支持透明代理
+const TransparentSupported = true
+
+// ipv6Transparent IPV6_TRANSPARENT，syscall 包中没有定义
+const ipv6Transparent = 75
+
+// CheckTransparentSupport 检查当前进程能否设置 IP_TRANSPARENT（需要 CAP_NET_ADMIN）
+func CheckTransparentSupport() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_IP, syscall.IP_TRANSPARENT, 1); err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			return errors.New("transparent mode requires CAP_NET_ADMIN (run as root or grant the capability)")
+		}
+		return fmt.Errorf("IP_TRANSPARENT not available: %w", err)
+	}
+	return nil
+}
+
+// dialTransparent 以客户端的IP作为源地址连接目标，目标看到的是客户端地址。
+// 目标的回程流量必须经过本机并由策略路由交给本机，例如：
+//
+//	iptables -t mangle -A PREROUTING -p tcp -s <目标> --sport <目标端口> -j MARK --set-mark 1
+//	ip rule add fwmark 1 lookup 100
+//	ip route add local 0.0.0.0/0 dev lo table 100
+//
+// dialer 提供超时等设置，其源地址与 Control 会被覆盖
+func dialTransparent(dialer net.Dialer, target string, client net.Addr) (net.Conn, error) {
+	ip := RemoteIP(client)
+	if ip == nil {
+		return nil, fmt.Errorf("transparent mode: unknown client address %v", client)
+	}
+	network, level, opt := "tcp6", syscall.SOL_IPV6, ipv6Transparent
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, network, level, opt = ip4, "tcp4", syscall.SOL_IP, syscall.IP_TRANSPARENT
+	}
+
+	dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptInt(int(fd), level, opt, 1)
+		}); err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("transparent mode: %w", sockErr)
+		}
+		return nil
+	}
+	return dialer.Dial(network, target)
+}
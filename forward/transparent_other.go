@@ -0,0 +1,23 @@
+//go:build !linux
+
+package forward
+
+import (
+	"errors"
+	"net"
+)
+
+// TransparentSupported 当前平台是否支持透明代理
+const TransparentSupported = false
+
+var errTransparentUnsupported = errors.New("transparent mode is only supported on Linux")
+
+// CheckTransparentSupport 当前平台不支持透明代理
+func CheckTransparentSupport() error {
+	return errTransparentUnsupported
+}
+
+// dialTransparent 当前平台不支持透明代理
+func dialTransparent(dialer net.Dialer, target string, client net.Addr) (net.Conn, error) {
+	return nil, errTransparentUnsupported
+}
@@ -0,0 +1,162 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// UDPRelay 组播/广播中继模式（仅UDP，仅IPv4）：监听地址为组播组或广播地址时在入接口上接收，
+// 从出接口发往目标地址（组播组、广播地址或单播地址）；目标的单播回复原路发回发送方。
+// 用于跨网段转发游戏发现、SSDP 等依赖广播或组播的协议
+type UDPRelay struct {
+	Enabled      bool   `json:"enabled"`
+	InInterface  string `json:"inInterface,omitempty"`  // 接收组播的网卡名，为空时由系统选择
+	OutInterface string `json:"outInterface,omitempty"` // 发送的网卡名，为空时按系统路由
+	TTL          int    `json:"ttl,omitempty"`          // 发往组播组的 TTL，0 为 1
+}
+
+// Validate 校验配置
+func (r *UDPRelay) Validate() error {
+	if r.TTL < 0 || r.TTL > 255 {
+		return fmt.Errorf("ttl must be between 0 and 255")
+	}
+	for _, name := range []string{r.InInterface, r.OutInterface} {
+		if name == "" {
+			continue
+		}
+		if _, err := net.InterfaceByName(name); err != nil {
+			return fmt.Errorf("interface %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// active 是否启用中继模式
+func (r *UDPRelay) active() bool {
+	return r != nil && r.Enabled
+}
+
+// ttl 发往组播组的 TTL
+func (r *UDPRelay) ttl() int {
+	if r.TTL <= 0 {
+		return 1
+	}
+	return r.TTL
+}
+
+// listenUDPRelay 中继模式的监听套接字：组播组在入接口上加入该组，广播地址监听通配地址
+func listenUDPRelay(addr *net.UDPAddr, relay *UDPRelay) (*net.UDPConn, error) {
+	if addr.IP.To4() == nil && addr.IP != nil {
+		return nil, errors.New("UDP relay supports IPv4 only")
+	}
+	if addr.IP.IsMulticast() {
+		var ifi *net.Interface
+		if relay.InInterface != "" {
+			var err error
+			if ifi, err = net.InterfaceByName(relay.InInterface); err != nil {
+				return nil, err
+			}
+		}
+		return net.ListenMulticastUDP("udp4", ifi, addr)
+	}
+	if isBroadcastAddr(addr.IP) {
+		// 广播包只投递给绑定通配地址的套接字
+		addr = &net.UDPAddr{Port: addr.Port}
+	}
+	return net.ListenUDP("udp4", addr)
+}
+
+// isBroadcastAddr 是否为受限广播地址或本机某个 IPv4 网段的广播地址
+func isBroadcastAddr(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return false
+	}
+	if ip4.Equal(net.IPv4bcast) {
+		return true
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil || len(ipNet.Mask) != net.IPv4len {
+			continue
+		}
+		bcast := make(net.IP, net.IPv4len)
+		for i := range bcast {
+			bcast[i] = ipNet.IP.To4()[i] | ^ipNet.Mask[i]
+		}
+		if bcast.Equal(ip4) {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceIPv4 网卡的第一个 IPv4 地址
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+}
+
+// relayOutConn 为一个发送方创建出接口上的套接字，目标为组播组时设置出接口与 TTL 并关闭回环
+func relayOutConn(relay *UDPRelay, target *net.UDPAddr) (*net.UDPConn, error) {
+	laddr := &net.UDPAddr{}
+	var ifaddr net.IP
+	if relay.OutInterface != "" {
+		ifi, err := net.InterfaceByName(relay.OutInterface)
+		if err != nil {
+			return nil, err
+		}
+		if ifaddr, err = interfaceIPv4(ifi); err != nil {
+			return nil, err
+		}
+		laddr.IP = ifaddr
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, err
+	}
+	if target.IP.IsMulticast() {
+		raw, err := conn.SyscallConn()
+		if err == nil {
+			var sockErr error
+			err = raw.Control(func(fd uintptr) { sockErr = setMulticastOptions(fd, ifaddr, relay.ttl()) })
+			if err == nil {
+				err = sockErr
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set multicast options: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// handleUDPRelay 处理中继模式的UDP转发，每个发送方使用单独的出接口套接字。
+// 监听器关闭时返回 nil，意外出错时返回错误
+func (f *Forwarder) handleUDPRelay(ctx context.Context, conn *net.UDPConn, targetAddr, targetPort string, stats *Stats, allow func(net.IP) bool, opts Options) error {
+	target, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(targetAddr, targetPort))
+	if err != nil {
+		opts.Log.Errorf("Error resolving target address: %v", err)
+		return err
+	}
+
+	return f.serveUDPSessions(ctx, conn, stats, allow, opts, udpSessionConfig{
+		dial: func() (*net.UDPConn, error) { return relayOutConn(opts.Relay, target) },
+		send: func(out *net.UDPConn, p []byte) error {
+			_, err := out.WriteToUDP(p, target)
+			return err
+		},
+	})
+}
@@ -0,0 +1,250 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxDatagramSize UDP 数据报的最大长度，读取缓冲区至少这么大才不会截断 DTLS、QUIC 等大数据报
+const MaxDatagramSize = 65535
+
+// udpSession 一个客户端的UDP会话：客户端的数据报经 out 发往目标，目标的回复经监听套接字发回客户端。
+// 每个数据报原样收发，不合并也不拆分
+type udpSession struct {
+	out        *net.UDPConn
+	idle       time.Duration // 没有数据报后保留会话的时间，期间目标的回复发回客户端
+	lastActive atomic.Int64  // 最近一次收发数据报的时间（UnixNano）
+}
+
+// touch 记录会话的活动时间
+func (s *udpSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// idleDeadline 会话空闲到期的时间
+func (s *udpSession) idleDeadline() time.Time {
+	return time.Unix(0, s.lastActive.Load()).Add(s.idle)
+}
+
+// udpSessionConfig 会话式UDP转发的出口：dial 为新客户端创建发往目标的套接字，send 经该套接字发送一个数据报
+type udpSessionConfig struct {
+	dial func() (*net.UDPConn, error)
+	send func(out *net.UDPConn, p []byte) error
+}
+
+// serveUDPSessions 按客户端地址维护会话转发UDP数据报，监听器关闭时返回 nil，意外出错时返回错误。
+// 超过读取缓冲区的数据报整个丢弃并计入 Oversized，不会截断后转发
+func (f *Forwarder) serveUDPSessions(ctx context.Context, conn *net.UDPConn, stats *Stats, allow func(net.IP) bool, opts Options, cfg udpSessionConfig) error {
+	f.setSocketBuffer(conn)
+
+	var mu sync.Mutex
+	sessions := make(map[string]*udpSession)
+	ownPorts := make(map[int]bool) // 各会话套接字的本地端口，用于丢弃转发器自己发出又被收到的数据报
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range sessions {
+			s.out.Close()
+		}
+	}()
+
+	buf := make([]byte, f.udpBufferSize())
+	defer stats.track(1, 1, int64(len(buf)))()
+
+	for {
+		n, addr, truncated, err := readDatagram(conn, buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// 停止转发时关闭了监听器
+				opts.Log.Debugf("Listener closed: %v", err)
+				return nil
+			}
+			opts.Log.Errorf("Error reading UDP data: %v", err)
+			return err
+		}
+		if truncated {
+			stats.Oversized.Add(1)
+			opts.Log.Warnf("Dropped UDP datagram from %s larger than the %d byte buffer", addr, len(buf))
+			continue
+		}
+
+		// 查找会话与刷新活动时间在同一把锁内，空闲回收在锁内确认到期后才移除会话，
+		// 查到的会话不会在使用前被关闭；已被回收的会话不在表中，下面创建新的会话
+		mu.Lock()
+		own := ownPorts[addr.Port] && isLocalIP(addr.IP)
+		s, ok := sessions[addr.String()]
+		if ok {
+			s.touch()
+		}
+		mu.Unlock()
+		if own {
+			continue
+		}
+
+		// 丢弃被拦截来源的数据报
+		if !allow(addr.IP) {
+			stats.Blocked.Add(1)
+			continue
+		}
+
+		// 弱网模拟：按丢包率丢弃
+		if opts.Emulation.drop() {
+			continue
+		}
+
+		// 全局限速
+		f.Limiter.Wait(opts.Priority, n)
+
+		if !ok {
+			// 资源保护：超限时不再创建会话
+			if !f.Guard.admit() {
+				stats.Refused.Add(1)
+				continue
+			}
+			out, err := cfg.dial()
+			if err != nil {
+				f.Guard.release()
+				stats.DialFailures.Add(1)
+				opts.Log.Errorf("Error connecting to UDP target: %v", err)
+				continue
+			}
+			f.setSocketBuffer(out)
+			s = &udpSession{out: out, idle: opts.Limits.udpSession()}
+			s.touch()
+			port := out.LocalAddr().(*net.UDPAddr).Port
+			mu.Lock()
+			sessions[addr.String()] = s
+			ownPorts[port] = true
+			mu.Unlock()
+			stats.TotalConns.Add(1)
+			stats.ActiveConns.Add(1)
+
+			go func(clientAddr *net.UDPAddr, s *udpSession, port int) {
+				key := clientAddr.String()
+				defer func() {
+					mu.Lock()
+					if sessions[key] == s {
+						delete(sessions, key)
+					}
+					delete(ownPorts, port)
+					mu.Unlock()
+					s.out.Close()
+				}()
+				defer f.Guard.release()
+				defer stats.ActiveConns.Add(-1)
+				// 空闲到期时在锁内再确认一次：客户端刚发来数据报时会话继续保留
+				expire := func() bool {
+					mu.Lock()
+					defer mu.Unlock()
+					if time.Now().Before(s.idleDeadline()) {
+						return false
+					}
+					delete(sessions, key)
+					return true
+				}
+				f.relayUDPResponses(ctx, conn, clientAddr, s, stats, opts, expire)
+			}(addr, s, port)
+		}
+
+		// 转发数据报到目标，模拟延迟时推迟发送
+		if d := opts.Emulation.delay(); d > 0 {
+			packet := append([]byte(nil), buf[:n]...)
+			time.AfterFunc(d, func() {
+				if err := cfg.send(s.out, packet); err != nil {
+					opts.Log.Errorf("Error forwarding UDP data: %v", err)
+				}
+			})
+		} else if err := cfg.send(s.out, buf[:n]); err != nil {
+			opts.Log.Errorf("Error forwarding UDP data: %v", err)
+			continue
+		}
+		if opts.Tap != nil {
+			opts.Tap.Packet("udp", addr, conn.LocalAddr(), buf[:n])
+		}
+		stats.BytesIn.Add(int64(n))
+		f.recordCountry(stats, addr.IP, int64(n), 0)
+	}
+}
+
+// relayUDPResponses 把目标经会话套接字发来的回复发回客户端，会话空闲超时或转发停止时返回。
+// 空闲超时时由 expire 确认并移除会话，返回 false 表示期间会话又有活动
+func (f *Forwarder) relayUDPResponses(ctx context.Context, conn *net.UDPConn, clientAddr *net.UDPAddr, s *udpSession, stats *Stats, opts Options, expire func() bool) {
+	buf := make([]byte, f.udpBufferSize())
+	defer stats.track(1, 1, int64(len(buf)))()
+	defer closeOnCancel(ctx, stats, s.out)()
+
+	for {
+		s.out.SetReadDeadline(s.idleDeadline())
+		n, _, truncated, err := readDatagram(s.out, buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !expire() {
+				// 等待期间客户端又发送了数据，按新的时间继续等待
+				continue
+			}
+			return
+		}
+		if truncated {
+			stats.Oversized.Add(1)
+			opts.Log.Warnf("Dropped UDP response for %s larger than the %d byte buffer", clientAddr, len(buf))
+			continue
+		}
+		s.touch()
+
+		// 弱网模拟
+		if opts.Emulation.drop() {
+			continue
+		}
+		time.Sleep(opts.Emulation.delay())
+
+		f.Limiter.Wait(opts.Priority, n)
+
+		// 转发回复到客户端
+		if _, err := conn.WriteToUDP(buf[:n], clientAddr); err != nil {
+			opts.Log.Errorf("Error forwarding UDP response: %v", err)
+			continue
+		}
+		if opts.Tap != nil {
+			opts.Tap.Packet("udp", conn.LocalAddr(), clientAddr, buf[:n])
+		}
+		stats.BytesOut.Add(int64(n))
+	}
+}
+
+// readDatagram 读取一个数据报，truncated 表示数据报比 buf 长、已被截断
+func readDatagram(conn *net.UDPConn, buf []byte) (n int, addr *net.UDPAddr, truncated bool, err error) {
+	n, _, flags, addr, err := conn.ReadMsgUDP(buf, nil)
+	if err != nil && datagramTruncated(0, err) {
+		return n, addr, true, nil
+	}
+	return n, addr, err == nil && datagramTruncated(flags, nil), err
+}
+
+// setSocketBuffer 按 SocketBuffer 设置UDP套接字的收发缓冲区
+func (f *Forwarder) setSocketBuffer(conn *net.UDPConn) {
+	if f.SocketBuffer == nil {
+		return
+	}
+	if size := f.SocketBuffer(); size > 0 {
+		conn.SetReadBuffer(size)
+		conn.SetWriteBuffer(size)
+	}
+}
+
+// isLocalIP 是否为本机的地址
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
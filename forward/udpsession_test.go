@@ -0,0 +1,200 @@
+package forward
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startUDPTarget 启动回环地址上的UDP目标，handle 处理每个收到的数据报并返回要回复的数据报
+func startUDPTarget(t *testing.T, handle func(from *net.UDPAddr, p []byte) [][]byte) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen target: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			for _, reply := range handle(from, append([]byte(nil), buf[:n]...)) {
+				conn.WriteToUDP(reply, from)
+			}
+		}
+	}()
+	return conn
+}
+
+// startUDPForward 以 opts 启动到 target 的UDP转发，返回监听地址
+func startUDPForward(t *testing.T, target *net.UDPConn, opts Options) (*Forwarder, *net.UDPAddr) {
+	t.Helper()
+	f := New()
+	f.Options = func(listenAddr, listenPort, target string) Options { return opts }
+	targetAddr := target.LocalAddr().(*net.UDPAddr)
+	if err := f.StartUDPForward("127.0.0.1", "0", "127.0.0.1", strconv.Itoa(targetAddr.Port)); err != nil {
+		t.Fatalf("start forward: %v", err)
+	}
+	t.Cleanup(func() { f.StopUDPForward("127.0.0.1", "0") })
+
+	f.mu.Lock()
+	listen := f.udpListeners[forwardKey("udp", "127.0.0.1", "0")].LocalAddr().(*net.UDPAddr)
+	f.mu.Unlock()
+	return f, listen
+}
+
+// dialClient 创建连接到转发监听地址的客户端
+func dialClient(t *testing.T, listen *net.UDPAddr) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, listen)
+	if err != nil {
+		t.Fatalf("dial forward: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// roundTrip 发送一个数据报并读取 replies 个回复
+func roundTrip(t *testing.T, conn *net.UDPConn, p []byte, replies int) [][]byte {
+	t.Helper()
+	if _, err := conn.Write(p); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got [][]byte
+	buf := make([]byte, MaxDatagramSize)
+	for len(got) < replies {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read reply %d of %d: %v", len(got)+1, replies, err)
+		}
+		got = append(got, append([]byte(nil), buf[:n]...))
+	}
+	return got
+}
+
+// udpStats 读取转发的统计
+func udpStats(t *testing.T, f *Forwarder) StatsSnapshot {
+	t.Helper()
+	f.mu.Lock()
+	host, port, _ := net.SplitHostPort(f.targets[forwardKey("udp", "127.0.0.1", "0")])
+	f.mu.Unlock()
+	stats, ok := f.Stats("udp", "127.0.0.1", "0", host, port)
+	if !ok {
+		t.Fatal("forward is not running")
+	}
+	return stats
+}
+
+// 目标回复它看到的来源地址：同一客户端的数据报经同一个会话发出，不同客户端使用不同的会话
+func TestUDPSessionPerClient(t *testing.T) {
+	target := startUDPTarget(t, func(from *net.UDPAddr, p []byte) [][]byte {
+		return [][]byte{[]byte(from.String())}
+	})
+	f, listen := startUDPForward(t, target, Options{})
+
+	sources := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		client := dialClient(t, listen)
+		var first string
+		for j := 0; j < 3; j++ {
+			source := string(roundTrip(t, client, []byte("ping"), 1)[0])
+			if j == 0 {
+				first = source
+			} else if source != first {
+				t.Fatalf("client %d datagram %d came from %s, want the session address %s", i, j, source, first)
+			}
+		}
+		if sources[first] {
+			t.Fatalf("client %d reused session address %s of another client", i, first)
+		}
+		sources[first] = true
+	}
+
+	if stats := udpStats(t, f); stats.TotalConns != 2 || stats.ActiveConns != 2 {
+		t.Fatalf("got %d sessions (%d active), want 2 (2 active)", stats.TotalConns, stats.ActiveConns)
+	}
+}
+
+// 会话空闲超过 UDPSession 后关闭，客户端再发送时创建新的会话
+func TestUDPSessionIdleExpiry(t *testing.T) {
+	target := startUDPTarget(t, func(from *net.UDPAddr, p []byte) [][]byte {
+		return [][]byte{p}
+	})
+	f, listen := startUDPForward(t, target, Options{Limits: ConnLimits{UDPSession: 100 * time.Millisecond}})
+	client := dialClient(t, listen)
+
+	roundTrip(t, client, []byte("one"), 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for udpStats(t, f).ActiveConns != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle session was not closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if got := roundTrip(t, client, []byte("two"), 1)[0]; string(got) != "two" {
+		t.Fatalf("got reply %q after expiry, want %q", got, "two")
+	}
+	if stats := udpStats(t, f); stats.TotalConns != 2 || stats.ActiveConns != 1 {
+		t.Fatalf("got %d sessions (%d active), want 2 (1 active)", stats.TotalConns, stats.ActiveConns)
+	}
+}
+
+// 多个数据报的握手：目标对一个请求回复多个数据报（含接近上限的大数据报），
+// 客户端的后续数据报须从同一来源到达，每个数据报原样转发、不合并也不拆分
+func TestUDPSessionMultiDatagramHandshake(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 60000)
+	var hello *net.UDPAddr
+	target := startUDPTarget(t, func(from *net.UDPAddr, p []byte) [][]byte {
+		switch {
+		case string(p) == "client hello":
+			hello = from
+			return [][]byte{[]byte("server hello"), large, []byte("hello done")}
+		case strings.HasPrefix(string(p), "finished"):
+			if hello == nil || hello.String() != from.String() {
+				return [][]byte{[]byte("unexpected source")}
+			}
+			return [][]byte{[]byte("ack " + strconv.Itoa(len(p)))}
+		}
+		return nil
+	})
+	_, listen := startUDPForward(t, target, Options{})
+	client := dialClient(t, listen)
+
+	got := roundTrip(t, client, []byte("client hello"), 3)
+	if string(got[0]) != "server hello" || !bytes.Equal(got[1], large) || string(got[2]) != "hello done" {
+		t.Fatalf("handshake replies were merged, split or reordered: lengths %d, %d, %d", len(got[0]), len(got[1]), len(got[2]))
+	}
+
+	finished := append([]byte("finished"), large[:40000]...)
+	want := "ack " + strconv.Itoa(len(finished))
+	if reply := roundTrip(t, client, finished, 1)[0]; string(reply) != want {
+		t.Fatalf("got %q, want %q", reply, want)
+	}
+}
+
+// 客户端恰好在会话空闲到期时发送：数据报不能写入正被回收的会话而丢失，
+// 要么沿用刚刷新的会话，要么创建新的会话
+func TestUDPSessionExpiryRace(t *testing.T) {
+	target := startUDPTarget(t, func(from *net.UDPAddr, p []byte) [][]byte {
+		return [][]byte{p}
+	})
+	idle := 20 * time.Millisecond
+	_, listen := startUDPForward(t, target, Options{Limits: ConnLimits{UDPSession: idle}})
+	client := dialClient(t, listen)
+
+	for i := 0; i < 50; i++ {
+		want := "ping " + strconv.Itoa(i)
+		if got := roundTrip(t, client, []byte(want), 1)[0]; string(got) != want {
+			t.Fatalf("got reply %q, want %q", got, want)
+		}
+		time.Sleep(idle + time.Duration(i%5-2)*time.Millisecond)
+	}
+}
@@ -2,290 +2,171 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"net"
-	"sync"
+	"strings"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
 )
 
-// Forwarder 端口转发器
-type Forwarder struct {
-	tcpListeners map[string]*net.Listener
-	udpListeners map[string]*net.UDPConn
-	mu           sync.Mutex
-}
+// forwardLog 转发日志，未关联规则时使用
+var forwardLog = newLogger("forwarder")
 
-// NewForwarder 创建新的端口转发器
-func NewForwarder() *Forwarder {
-	return &Forwarder{
-		tcpListeners: make(map[string]*net.Listener),
-		udpListeners: make(map[string]*net.UDPConn),
+// newForwarder 创建转发器，接入规则选项、来源过滤、日志、按国家统计与链路追踪
+func newForwarder() *forward.Forwarder {
+	f := forward.New()
+	f.Log = forwardLog
+	f.ListenLog = func(listenAddr, listenPort, target string) forward.Logger {
+		return listenLogger(forwardLog, listenAddr, listenPort, target)
 	}
-}
-
-// StartTCPForward 启动TCP端口转发
-func (f *Forwarder) StartTCPForward(listenAddr, listenPort, targetAddr, targetPort string) error {
-	key := fmt.Sprintf("tcp:%s:%s", listenAddr, listenPort)
-
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	// 检查是否已经在运行
-	if _, exists := f.tcpListeners[key]; exists {
-		return fmt.Errorf("TCP forward already running on %s:%s", listenAddr, listenPort)
+	f.ClientLabel = clientLabel
+	f.Observe = observeConn
+	f.Country = func(ip net.IP) string {
+		if !geoEnabled() {
+			return ""
+		}
+		return geoLookup(ip).countryKey()
 	}
-
-	// 监听本地端口
-	addr := fmt.Sprintf("%s:%s", listenAddr, listenPort)
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	f.BufferSize = func() (int, int) { return tcpBufferSize(), udpBufferSize() }
+	f.SocketBuffer = udpSocketBuffer
+	f.Allow = connectionAllowed
+	f.Options = ruleForwardOptions
+	f.OnListenerFailed = forwardListenerFailed
+	f.OnListenerRecovered = forwardListenerRecovered
+	if *listenerRestart {
+		f.AutoRestart = &forward.RestartPolicy{MaxDelay: *listenerRestartMaxDelay, MaxAttempts: *listenerRestartAttempts}
 	}
-
-	// 保存监听器
-	f.tcpListeners[key] = &listener
-
-	// 启动转发协程
-	go f.handleTCPForward(listener, targetAddr, targetPort)
-
-	log.Printf("Started TCP forward: %s:%s -> %s:%s", listenAddr, listenPort, targetAddr, targetPort)
-	return nil
-}
-
-// StopTCPForward 停止TCP端口转发
-func (f *Forwarder) StopTCPForward(listenAddr, listenPort string) error {
-	key := fmt.Sprintf("tcp:%s:%s", listenAddr, listenPort)
-
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	// 检查是否在运行
-	listener, exists := f.tcpListeners[key]
-	if !exists {
-		return fmt.Errorf("TCP forward not running on %s:%s", listenAddr, listenPort)
+	f.OnChange = func() {
+		markRunningChanged()
+		triggerPortMapping()
 	}
-
-	// 关闭监听器
-	if err := (*listener).Close(); err != nil {
-		return fmt.Errorf("failed to close listener: %w", err)
+	if *maxGoroutines > 0 || *maxConnections > 0 || *maxMemoryMB > 0 {
+		f.Guard = forward.NewResourceGuard(*maxGoroutines, *maxConnections, *maxMemoryMB<<20)
 	}
-
-	// 删除监听器
-	delete(f.tcpListeners, key)
-
-	log.Printf("Stopped TCP forward: %s:%s", listenAddr, listenPort)
-	return nil
-}
-
-// StartUDPForward 启动UDP端口转发
-func (f *Forwarder) StartUDPForward(listenAddr, listenPort, targetAddr, targetPort string) error {
-	key := fmt.Sprintf("udp:%s:%s", listenAddr, listenPort)
-
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	// 检查是否已经在运行
-	if _, exists := f.udpListeners[key]; exists {
-		return fmt.Errorf("UDP forward already running on %s:%s", listenAddr, listenPort)
+	if *bandwidthLimit > 0 {
+		f.Limiter = forward.NewBandwidthLimiter(*bandwidthLimit * 1024)
 	}
-
-	// 解析监听地址
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%s", listenAddr, listenPort))
-	if err != nil {
-		return fmt.Errorf("failed to resolve listen address: %w", err)
-	}
-
-	// 监听UDP端口
-	conn, err := net.ListenUDP("udp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s:%s: %w", listenAddr, listenPort, err)
-	}
-
-	// 保存连接
-	f.udpListeners[key] = conn
-
-	// 启动转发协程
-	go f.handleUDPForward(conn, targetAddr, targetPort)
-
-	log.Printf("Started UDP forward: %s:%s -> %s:%s", listenAddr, listenPort, targetAddr, targetPort)
-	return nil
+	return f
 }
 
-// StopUDPForward 停止UDP端口转发
-func (f *Forwarder) StopUDPForward(listenAddr, listenPort string) error {
-	key := fmt.Sprintf("udp:%s:%s", listenAddr, listenPort)
-
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	// 检查是否在运行
-	conn, exists := f.udpListeners[key]
-	if !exists {
-		return fmt.Errorf("UDP forward not running on %s:%s", listenAddr, listenPort)
-	}
+// forwardListenerFailed 监听意外退出（非停止转发导致）时记入事件历史并发送通知
+func forwardListenerFailed(protocol, listenAddr, listenPort, target string, err error) {
+	lg := listenLogger(forwardLog, listenAddr, listenPort, target)
+	lg.Errorf("%s listener on %s stopped unexpectedly: %v", strings.ToUpper(protocol), net.JoinHostPort(listenAddr, listenPort), err)
 
-	// 关闭连接
-	if err := conn.Close(); err != nil {
-		return fmt.Errorf("failed to close UDP connection: %w", err)
+	rule, ok := findRuleByTarget(listenAddr, listenPort, target)
+	if !ok {
+		return
 	}
-
-	// 删除连接
-	delete(f.udpListeners, key)
-
-	log.Printf("Stopped UDP forward: %s:%s", listenAddr, listenPort)
-	return nil
+	recordRuleEvent(RuleEvent{
+		RuleID:   rule.ID,
+		Type:     RuleEventError,
+		Protocol: protocol,
+		Source:   sourceSystem,
+		Message:  "Listener stopped unexpectedly: " + err.Error(),
+	})
+	notify(Notification{
+		Event:   "forward.listener_failed",
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("%s listener failed on %s", strings.ToUpper(protocol), ruleDisplayName(rule)),
+		Message: fmt.Sprintf("listener %s stopped unexpectedly: %v", net.JoinHostPort(listenAddr, listenPort), err),
+	})
 }
 
-// IsTCPRunning 检查TCP转发是否运行
-func (f *Forwarder) IsTCPRunning(listenAddr, listenPort string) bool {
-	key := fmt.Sprintf("tcp:%s:%s", listenAddr, listenPort)
-
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	_, exists := f.tcpListeners[key]
-	return exists
-}
-
-// IsUDPRunning 检查UDP转发是否运行
-func (f *Forwarder) IsUDPRunning(listenAddr, listenPort string) bool {
-	key := fmt.Sprintf("udp:%s:%s", listenAddr, listenPort)
-
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	_, exists := f.udpListeners[key]
-	return exists
-}
-
-// handleTCPForward 处理TCP转发
-func (f *Forwarder) handleTCPForward(listener net.Listener, targetAddr, targetPort string) {
-	target := fmt.Sprintf("%s:%s", targetAddr, targetPort)
-
-	for {
-		// 接受新连接
-		conn, err := listener.Accept()
-		if err != nil {
-			// 检查是否是因为关闭监听器导致的错误
-			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
-				log.Printf("Temporary error accepting connection: %v", err)
-				continue
-			}
-			log.Printf("Error accepting connection: %v", err)
-			break
-		}
-
-		// 处理连接
-		go func(conn net.Conn) {
-			defer conn.Close()
-
-			// 连接到目标服务器
-			targetConn, err := net.Dial("tcp", target)
-			if err != nil {
-				log.Printf("Error connecting to target %s: %v", target, err)
-				return
-			}
-			defer targetConn.Close()
-
-			// 双向转发数据
-			forwardData(conn, targetConn)
-		}(conn)
+// forwardListenerRecovered 自动重新监听成功后记入事件历史并发送通知
+func forwardListenerRecovered(protocol, listenAddr, listenPort, target string, attempts int) {
+	rule, ok := findRuleByTarget(listenAddr, listenPort, target)
+	if !ok {
+		return
 	}
+	message := fmt.Sprintf("Listener re-bound after %d attempts", attempts)
+	recordRuleEvent(RuleEvent{RuleID: rule.ID, Type: RuleEventStart, Protocol: protocol, Source: sourceSystem, Message: message})
+	notify(Notification{
+		Event:   "forward.restarted",
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("%s forward restarted on %s", strings.ToUpper(protocol), ruleDisplayName(rule)),
+		Message: fmt.Sprintf("listener %s re-bound after %d attempts", net.JoinHostPort(listenAddr, listenPort), attempts),
+	})
 }
 
-// handleUDPForward 处理UDP转发
-func (f *Forwarder) handleUDPForward(conn *net.UDPConn, targetAddr, targetPort string) {
-	// 解析目标地址
-	target, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%s", targetAddr, targetPort))
-	if err != nil {
-		log.Printf("Error resolving target address: %v", err)
+// startForwardReconciler 按 -reconcile-interval 定期移除监听套接字已失效的转发
+func startForwardReconciler() {
+	if *reconcileInterval <= 0 {
 		return
 	}
-
-	// 缓冲区
-	buf := make([]byte, 65535)
-
-	for {
-		// 读取UDP数据
-		n, addr, err := conn.ReadFromUDP(buf)
-		if err != nil {
-			log.Printf("Error reading UDP data: %v", err)
-			break
+	go func() {
+		ticker := time.NewTicker(*reconcileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reconcileForwards()
 		}
+	}()
+}
 
-		// 转发数据到目标
-		_, err = conn.WriteToUDP(buf[:n], target)
-		if err != nil {
-			log.Printf("Error forwarding UDP data: %v", err)
+// reconcileForwards 移除失效的转发，记入事件历史并发送通知
+func reconcileForwards() {
+	for _, stale := range forwarder.Reconcile() {
+		rule, ok := findRuleByTarget(stale.ListenAddr, stale.ListenPort, stale.Target)
+		if !ok {
 			continue
 		}
+		recordRuleEvent(RuleEvent{
+			RuleID:   rule.ID,
+			Type:     RuleEventError,
+			Protocol: stale.Protocol,
+			Source:   sourceSystem,
+			Message:  "Removed stale forward: " + stale.Reason,
+		})
+		notify(Notification{
+			Event:   "forward.stale",
+			RuleID:  rule.ID,
+			Title:   fmt.Sprintf("%s forward removed on %s", strings.ToUpper(stale.Protocol), ruleDisplayName(rule)),
+			Message: fmt.Sprintf("listener %s is no longer bound: %s", net.JoinHostPort(stale.ListenAddr, stale.ListenPort), stale.Reason),
+		})
+	}
+}
 
-		// 从目标读取响应并转发回客户端
-		go func(clientAddr *net.UDPAddr) {
-			responseBuf := make([]byte, 65535)
-			targetConn, err := net.DialUDP("udp", nil, target)
-			if err != nil {
-				log.Printf("Error connecting to target for response: %v", err)
-				return
-			}
-			defer targetConn.Close()
-
-			// 设置读取超时
-			// targetConn.SetReadDeadline(time.Now().Add(5 * time.Second))
-
-			n, err := targetConn.Read(responseBuf)
-			if err != nil {
-				// 忽略超时错误
-				return
-			}
+// connObserver 记录一个连接的访问日志（-access-log）与追踪（-otlp-endpoint）
+type connObserver struct {
+	lg       forward.Logger
+	protocol string
+	conn     net.Conn
+	target   string
+	started  time.Time
+	span     *connSpan // 未启用追踪时为 nil
+}
 
-			// 转发响应回客户端
-			_, err = conn.WriteToUDP(responseBuf[:n], clientAddr)
-			if err != nil {
-				log.Printf("Error forwarding UDP response: %v", err)
-			}
-		}(addr)
+// observeConn 两者都未启用时返回 nil
+func observeConn(protocol string, conn net.Conn, target string, lg forward.Logger) forward.ConnObserver {
+	span := startConnSpan(protocol, conn, target)
+	if !*accessLog && span == nil {
+		return nil
 	}
+	if *accessLog {
+		// 连接开始时即在后台解析客户端主机名
+		clientHostname(forward.RemoteIP(conn.RemoteAddr()))
+	}
+	return &connObserver{lg: lg, protocol: protocol, conn: conn, target: target, started: time.Now(), span: span}
 }
 
-// forwardData 双向转发数据
-func forwardData(src, dst net.Conn) {
-	var wg sync.WaitGroup
+func (o *connObserver) DialStarted()       { o.span.dialStarted() }
+func (o *connObserver) DialDone(err error) { o.span.dialDone(err) }
 
-	// 从src读取数据并写入dst
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		buf := make([]byte, 4096)
-		for {
-			n, err := src.Read(buf)
-			if err != nil {
-				break
-			}
-			if n > 0 {
-				if _, err := dst.Write(buf[:n]); err != nil {
-					break
-				}
-			}
-		}
-	}()
+func (o *connObserver) Closed(bytesIn, bytesOut int64) {
+	o.span.end(bytesIn, bytesOut)
+	if *accessLog {
+		o.logAccess(bytesIn, bytesOut)
+	}
+}
 
-	// 从dst读取数据并写入src
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		buf := make([]byte, 4096)
-		for {
-			n, err := dst.Read(buf)
-			if err != nil {
-				break
-			}
-			if n > 0 {
-				if _, err := src.Write(buf[:n]); err != nil {
-					break
-				}
-			}
+// logAccess 记录一条连接访问日志
+func (o *connObserver) logAccess(bytesIn, bytesOut int64) {
+	client := clientLabel(o.conn.RemoteAddr())
+	if geoEnabled() {
+		if geo := geoLookup(forward.RemoteIP(o.conn.RemoteAddr())).String(); geo != "" {
+			client += " [" + geo + "]"
 		}
-	}()
-
-	wg.Wait()
+	}
+	o.lg.Infof("%s %s -> %s -> %s closed after %s (in %d, out %d bytes)",
+		strings.ToUpper(o.protocol), client, o.conn.LocalAddr(), o.target, time.Since(o.started).Round(time.Millisecond), bytesIn, bytesOut)
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// errnoWSAEADDRINUSE Windows 上端口被占用时 winsock 返回的错误码
+const errnoWSAEADDRINUSE = syscall.Errno(10048)
+
+// isAddrInUse 判断错误是否为端口被占用
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, errnoWSAEADDRINUSE)
+}
+
+// isPortFree 尝试绑定端口以确认其可用
+func isPortFree(protocol, addr string, port int) bool {
+	address := net.JoinHostPort(addr, strconv.Itoa(port))
+	switch protocol {
+	case "udp":
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+	case "sctp":
+		l, err := forward.ListenSCTP(address)
+		if err != nil {
+			return false
+		}
+		l.Close()
+	default:
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return false
+		}
+		l.Close()
+	}
+	return true
+}
+
+// findFreePort 在 [start, end] 范围内查找第一个可用端口
+func findFreePort(protocol, addr string, start, end int) (int, error) {
+	if start < 1 || end > 65535 || start > end {
+		return 0, fmt.Errorf("invalid port range %d-%d", start, end)
+	}
+	for port := start; port <= end; port++ {
+		if isPortFree(protocol, addr, port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free %s port in range %d-%d on %s", protocol, start, end, addr)
+}
+
+// suggestFreePort 在冲突端口附近查找可用端口，先向上再向下
+func suggestFreePort(protocol, addr string, port int) (int, bool) {
+	const window = 100
+	for offset := 1; offset <= window; offset++ {
+		if p := port + offset; p <= 65535 && isPortFree(protocol, addr, p) {
+			return p, true
+		}
+		if p := port - offset; p >= 1024 && isPortFree(protocol, addr, p) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// describePortConflict 端口被占用时在错误中注明占用端口的进程，端口范围逐个端口查找
+func describePortConflict(protocol, listenAddr, listenPort string) string {
+	pairs, err := forward.ExpandPortRange(listenPort, "")
+	if err != nil {
+		return ""
+	}
+	for _, pair := range pairs {
+		port, _ := strconv.Atoi(pair.Listen)
+		if owner, ok := portOwner(protocol, listenAddr, port); ok {
+			return fmt.Sprintf("%s port %d is held by %s", protocol, port, portOwnerText(owner))
+		}
+	}
+	return ""
+}
+
+// startFailureResult 构造启动失败的结果，端口冲突时注明占用端口的进程并附带建议端口
+func startFailureResult(err error, protocol, listenAddr, listenPort string) Result {
+	result := Result{Success: false, Error: err.Error()}
+	if !isAddrInUse(err) {
+		return result
+	}
+	if owner := describePortConflict(protocol, listenAddr, listenPort); owner != "" {
+		result.Error += " (" + owner + ")"
+	}
+	if port, convErr := strconv.Atoi(listenPort); convErr == nil {
+		if suggested, ok := suggestFreePort(protocol, listenAddr, port); ok {
+			result.SuggestedPort = strconv.Itoa(suggested)
+		}
+	}
+	return result
+}
+
+// apiGetFreePort 在指定范围内申请一个可用端口
+func apiGetFreePort(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	protocol := query.Get("protocol")
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	start, end := 1024, 65535
+	if v := query.Get("start"); v != "" {
+		start, _ = strconv.Atoi(v)
+	}
+	if v := query.Get("end"); v != "" {
+		end, _ = strconv.Atoi(v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	port, err := findFreePort(protocol, query.Get("listenAddr"), start, end)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true, ListenPort: strconv.Itoa(port)})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// GeoInfo 客户端IP的地理与网络归属信息
+type GeoInfo struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 国家代码
+	ASN     uint64 `json:"asn,omitempty"`
+	ASOrg   string `json:"asOrg,omitempty"`
+}
+
+// geoDB 已加载的 GeoIP 数据库（国家/城市库与 ASN 库），供连接日志、按国家统计与 IP 查询使用
+var geoDB struct {
+	country *mmdbReader
+	asn     *mmdbReader
+}
+
+// loadGeoIP 加载 -geoip-db / -geoip-asn-db 指定的 MaxMind 数据库
+func loadGeoIP() {
+	if *geoipDB != "" {
+		r, err := openMMDB(*geoipDB)
+		if err != nil {
+			log.Printf("Failed to load GeoIP database %s: %v", *geoipDB, err)
+		} else {
+			geoDB.country = r
+			log.Printf("Loaded GeoIP database %s (%s)", *geoipDB, r.DBType)
+		}
+	}
+	if *geoipASNDB != "" {
+		r, err := openMMDB(*geoipASNDB)
+		if err != nil {
+			log.Printf("Failed to load GeoIP ASN database %s: %v", *geoipASNDB, err)
+		} else {
+			geoDB.asn = r
+			log.Printf("Loaded GeoIP ASN database %s (%s)", *geoipASNDB, r.DBType)
+		}
+	}
+}
+
+// geoEnabled 是否加载了任一 GeoIP 数据库
+func geoEnabled() bool {
+	return geoDB.country != nil || geoDB.asn != nil
+}
+
+// geoLookup 查询IP的国家与ASN
+func geoLookup(ip net.IP) GeoInfo {
+	var info GeoInfo
+	if ip == nil {
+		return info
+	}
+	if geoDB.country != nil {
+		if record, err := geoDB.country.Lookup(ip); err == nil && record != nil {
+			// 优先使用 country，匿名代理等条目只有 registered_country
+			for _, field := range []string{"country", "registered_country"} {
+				if c, ok := record[field].(map[string]interface{}); ok {
+					if code, ok := c["iso_code"].(string); ok {
+						info.Country = code
+						break
+					}
+				}
+			}
+		}
+	}
+	if geoDB.asn != nil {
+		if record, err := geoDB.asn.Lookup(ip); err == nil && record != nil {
+			info.ASN = mmdbUint(record["autonomous_system_number"])
+			info.ASOrg, _ = record["autonomous_system_organization"].(string)
+		}
+	}
+	return info
+}
+
+// String 日志中使用的简短描述，如 "CN AS4134 CHINANET"
+func (g GeoInfo) String() string {
+	s := g.Country
+	if g.ASN != 0 {
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("AS%d", g.ASN)
+		if g.ASOrg != "" {
+			s += " " + g.ASOrg
+		}
+	}
+	return s
+}
+
+// countryKey 统计使用的国家代码，未知时为 "??"
+func (g GeoInfo) countryKey() string {
+	if g.Country == "" {
+		return "??"
+	}
+	return g.Country
+}
+
+// apiGetCountryStats 获取规则（所有协议合计）按国家的连接与流量统计
+func apiGetCountryStats(w http.ResponseWriter, r *http.Request) {
+	rule, ok := findRule(r.URL.Query().Get("ruleId"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	merged := make(map[string]*forward.CountryStats)
+	for _, protocol := range forwardProtocols {
+		for _, c := range forwarder.CountryStats(protocol, rule.ListenAddr, rule.ListenPort) {
+			m, ok := merged[c.Country]
+			if !ok {
+				m = &forward.CountryStats{Country: c.Country}
+				merged[c.Country] = m
+			}
+			m.Connections += c.Connections
+			m.BytesIn += c.BytesIn
+			m.BytesOut += c.BytesOut
+		}
+	}
+
+	list := make([]forward.CountryStats, 0, len(merged))
+	for _, c := range merged {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Connections > list[j].Connections })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":   geoEnabled(),
+		"countries": list,
+	})
+}
+
+// apiGeoLookup 查询单个IP的 GeoIP 信息
+func apiGeoLookup(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.URL.Query().Get("ip"))
+	if ip == nil {
+		http.Error(w, "Invalid ip", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(geoLookup(ip))
+}
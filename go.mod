@@ -1,8 +1,11 @@
-module port-forwarder
+module github.com/byXewl/go-ports
 
 go 1.20
 
 require (
 	github.com/google/uuid v1.3.1
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.33.0
 )
+
+require golang.org/x/sys v0.30.0 // indirect
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// RuleResourceUsage 单条规则（所有协议合计）的资源占用
+type RuleResourceUsage struct {
+	RuleID      string `json:"ruleId"`
+	Name        string `json:"name"`
+	Connections int64  `json:"connections"`
+	Goroutines  int64  `json:"goroutines"`
+	OpenFDs     int64  `json:"openFds"`
+	BufferBytes int64  `json:"bufferBytes"`
+}
+
+// ResourceUsage 进程资源使用情况及按规则的占用
+type ResourceUsage struct {
+	forward.ResourceUsage
+	Rules []RuleResourceUsage `json:"rules"` // 按规则的资源占用，占用最多的在前
+}
+
+// apiGetResourceUsage 获取进程资源使用情况及保护上限
+func apiGetResourceUsage(w http.ResponseWriter, r *http.Request) {
+	usage := ResourceUsage{
+		ResourceUsage: forwarder.Guard.Usage(),
+		Rules:         ruleResourceUsage(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// ruleResourceUsage 统计正在运行的规则的资源占用
+func ruleResourceUsage() []RuleResourceUsage {
+	list := []RuleResourceUsage{}
+	for _, rule := range ruleStore.Rules() {
+		total, running := ruleTotals(rule)
+		if !running {
+			continue
+		}
+		list = append(list, RuleResourceUsage{
+			RuleID:      rule.ID,
+			Name:        ruleDisplayName(rule),
+			Connections: total.ActiveConns,
+			Goroutines:  total.Goroutines,
+			OpenFDs:     total.OpenFDs,
+			BufferBytes: total.BufferBytes,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Goroutines != list[j].Goroutines {
+			return list[i].Goroutines > list[j].Goroutines
+		}
+		return list[i].BufferBytes > list[j].BufferBytes
+	})
+	return list
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
+)
+
+// TargetHealth 一个目标的健康状态
+type TargetHealth struct {
+	Target    string    `json:"target"`
+	Backup    bool      `json:"backup,omitempty"`
+	Up        bool      `json:"up"`
+	Checked   bool      `json:"checked"` // 还未检查过时按健康处理
+	Since     time.Time `json:"since"`
+	LastCheck time.Time `json:"lastCheck"`
+	LatencyMs int64     `json:"latencyMs"`
+	LastError string    `json:"lastError,omitempty"`
+
+	successes int
+	failures  int
+}
+
+// RuleHealth 规则所有目标的健康状态
+type RuleHealth struct {
+	RuleID  string         `json:"ruleId"`
+	Name    string         `json:"name"`
+	Active  string         `json:"active"` // 新连接当前使用的目标，多个健康目标时为空
+	Targets []TargetHealth `json:"targets"`
+}
+
+// healthState 所有规则的目标健康状态，按规则ID与目标 addr:port 索引
+var healthState = struct {
+	sync.Mutex
+	targets map[string]map[string]*TargetHealth
+	next    map[string]time.Time
+}{
+	targets: make(map[string]map[string]*TargetHealth),
+	next:    make(map[string]time.Time),
+}
+
+// healthTargets 规则需要检查的目标：主目标（按当前环境展开）、额外目标与备用目标
+func healthTargets(rule Rule) []string {
+	rule = resolvedRule(rule)
+	targets := []string{net.JoinHostPort(rule.TargetAddr, rule.TargetPort)}
+	if !forward.IsPortRange(rule.ListenPort) {
+		targets = append(targets, rule.Targets...)
+	}
+	if backup := rule.Health.BackupTarget(); backup != "" {
+		targets = append(targets, backup)
+	}
+	return targets
+}
+
+// targetHealthy 目标是否健康，未检查过的目标按健康处理
+func targetHealthy(ruleID, target string) bool {
+	healthState.Lock()
+	defer healthState.Unlock()
+	if h, ok := healthState.targets[ruleID][target]; ok {
+		return h.Up
+	}
+	return true
+}
+
+// startHealthChecks 启动健康检查循环
+func startHealthChecks() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runHealthChecks(now)
+		}
+	}()
+}
+
+// runHealthChecks 检查到期的规则，并清除已停止或关闭健康检查的规则的状态
+func runHealthChecks(now time.Time) {
+	active := make(map[string]bool)
+	for _, rule := range ruleStore.Rules() {
+		if rule.Health == nil || !rule.Health.Enabled || rule.TargetAddr == "" || rule.TargetPort == "" || len(runningProtocols(rule)) == 0 {
+			continue
+		}
+		active[rule.ID] = true
+		cfg := rule.Health.WithDefaults()
+
+		healthState.Lock()
+		due := !now.Before(healthState.next[rule.ID])
+		if due {
+			healthState.next[rule.ID] = now.Add(time.Duration(cfg.IntervalSeconds) * time.Second)
+		}
+		healthState.Unlock()
+
+		if due {
+			for _, target := range healthTargets(rule) {
+				go checkTargetHealth(rule, cfg, target)
+			}
+		}
+	}
+
+	healthState.Lock()
+	for id := range healthState.next {
+		if !active[id] {
+			delete(healthState.next, id)
+			delete(healthState.targets, id)
+		}
+	}
+	healthState.Unlock()
+}
+
+// checkTargetHealth 探测一个目标并更新健康状态，状态变化时记录日志并发送通知
+func checkTargetHealth(rule Rule, cfg HealthCheck, target string) {
+	started := time.Now()
+	err := probeTarget(cfg, target)
+	latency := time.Since(started)
+
+	healthState.Lock()
+	if healthState.next[rule.ID].IsZero() {
+		// 检查期间规则已停止
+		healthState.Unlock()
+		return
+	}
+	targets, ok := healthState.targets[rule.ID]
+	if !ok {
+		targets = make(map[string]*TargetHealth)
+		healthState.targets[rule.ID] = targets
+	}
+	h, ok := targets[target]
+	if !ok {
+		h = &TargetHealth{Target: target, Up: true, Since: started}
+		targets[target] = h
+	}
+	h.Backup = target == rule.Health.BackupTarget()
+	h.Checked = true
+	h.LastCheck = time.Now()
+	h.LatencyMs = latency.Milliseconds()
+
+	changed := false
+	if err == nil {
+		h.LastError = ""
+		h.failures = 0
+		h.successes++
+		if !h.Up && h.successes >= cfg.Rise {
+			h.Up, h.Since, changed = true, h.LastCheck, true
+		}
+	} else {
+		h.LastError = err.Error()
+		h.successes = 0
+		h.failures++
+		if h.Up && h.failures >= cfg.Fall {
+			h.Up, h.Since, changed = false, h.LastCheck, true
+		}
+	}
+	up := h.Up
+	healthState.Unlock()
+
+	if !changed {
+		return
+	}
+	lg := newLogger("health").WithRule(rule.ID)
+	if up {
+		lg.Infof("Health check: target %s of rule %s is up", target, ruleDisplayName(rule))
+		notify(Notification{
+			Event:   "health.up",
+			RuleID:  rule.ID,
+			Title:   fmt.Sprintf("Target up on %s", ruleDisplayName(rule)),
+			Message: fmt.Sprintf("target %s passed %d health checks", target, cfg.Rise),
+		})
+		return
+	}
+	lg.Warnf("Health check: target %s of rule %s is down: %v", target, ruleDisplayName(rule), err)
+	notify(Notification{
+		Event:   "health.down",
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("Target down on %s", ruleDisplayName(rule)),
+		Message: fmt.Sprintf("target %s failed %d health checks: %v", target, cfg.Fall, err),
+	})
+}
+
+// probeTarget 按配置探测目标一次
+func probeTarget(cfg HealthCheck, target string) error {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if cfg.Type == store.HealthCheckTCP {
+		conn, err := net.DialTimeout("tcp", target, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// 只检查存活，不校验目标证书
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(cfg.Type + "://" + target + cfg.HTTPPath)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if cfg.ExpectStatus != 0 {
+		if resp.StatusCode != cfg.ExpectStatus {
+			return fmt.Errorf("status %d, expected %d", resp.StatusCode, cfg.ExpectStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ruleHealth 汇总规则的目标健康状态，按主目标、额外目标、备用目标的顺序
+func ruleHealth(rule Rule) RuleHealth {
+	report := RuleHealth{RuleID: rule.ID, Name: ruleDisplayName(rule), Targets: []TargetHealth{}}
+	backup := rule.Health.BackupTarget()
+
+	healthState.Lock()
+	defer healthState.Unlock()
+	var healthy []string
+	for _, target := range healthTargets(rule) {
+		h := TargetHealth{Target: target, Backup: target == backup, Up: true}
+		if state, ok := healthState.targets[rule.ID][target]; ok {
+			h = *state
+		}
+		report.Targets = append(report.Targets, h)
+		if h.Up && !h.Backup {
+			healthy = append(healthy, target)
+		}
+	}
+	switch {
+	case len(healthy) == 1:
+		report.Active = healthy[0]
+	case len(healthy) == 0 && backup != "":
+		report.Active = backup
+	}
+	return report
+}
+
+// apiGetHealth 获取启用了健康检查的规则的目标健康状态，ruleId 为空时返回所有规则
+func apiGetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if id := r.URL.Query().Get("ruleId"); id != "" {
+		rule, ok := findRule(id)
+		if !ok {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(ruleHealth(rule))
+		return
+	}
+
+	list := []RuleHealth{}
+	for _, rule := range ruleStore.Rules() {
+		if rule.Health != nil && rule.Health.Enabled {
+			list = append(list, ruleHealth(rule))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	json.NewEncoder(w).Encode(list)
+}
+
+// updateHealthCheckRequest apiUpdateHealthCheck 的请求体
+type updateHealthCheckRequest struct {
+	RuleID string       `json:"ruleId"`
+	Health *HealthCheck `json:"health"`
+}
+
+// apiUpdateHealthCheck 设置规则的健康检查，health 为 null 时移除。
+// 正在运行的转发会重启以应用新的备用目标，已建立的连接不受影响
+func apiUpdateHealthCheck(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "health check", func(req *updateHealthCheckRequest, _ Rule) (func(rule *Rule), error) {
+		if req.Health != nil {
+			req.Health.BackupAddr = strings.Trim(req.Health.BackupAddr, "[]")
+			if req.Health.BackupPort != "" {
+				if err := resolvePorts(&req.Health.BackupPort); err != nil {
+					return nil, err
+				}
+			}
+			if err := req.Health.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.Health = req.Health }, nil
+	})
+	if !ok {
+		return
+	}
+
+	// 配置变化后重新开始检查
+	healthState.Lock()
+	delete(healthState.next, rule.ID)
+	delete(healthState.targets, rule.ID)
+	healthState.Unlock()
+
+	restartUpdatedRule(w, r, rule)
+}
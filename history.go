@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// 规则事件类型
+const (
+	RuleEventStart  = "start"
+	RuleEventStop   = "stop"
+	RuleEventError  = "error"
+	RuleEventConfig = "config"
+)
+
+// 事件来源：界面与 API 按请求区分，其余为程序内部的触发者
+const (
+	sourceUI        = "ui"
+	sourceAPI       = "api"
+	sourceScheduler = "scheduler"
+	sourceAutoStart = "autostart" // 启动时开启标记为自动开启的规则与默认模板
+	sourceRestore   = "restore"   // 启动时恢复上次退出时正在运行的转发
+	sourceAutoStop  = "autostop"
+	sourceWatchdog  = "watchdog"
+	sourceTray      = "tray"
+	sourceSystem    = "system"  // 转发引擎自身，如监听意外退出
+	sourceNetwork   = "network" // 监听地址消失后恢复时重新监听
+)
+
+// uiClientHeader 管理界面的请求携带的请求头，用于区分事件来源是界面还是 API
+const uiClientHeader = "X-Go-Ports-Client"
+
+// maxRuleEvents 保留的事件总数，超出后丢弃最旧的
+const maxRuleEvents = 5000
+
+// defaultRuleEventLimit /api/getRuleHistory 默认返回的事件数
+const defaultRuleEventLimit = 100
+
+// RuleEvent 规则的一次启动、停止、出错或配置修改
+type RuleEvent struct {
+	Time     time.Time `json:"time"`
+	RuleID   string    `json:"ruleId"`
+	Type     string    `json:"type"`               // start、stop、error 或 config
+	Protocol string    `json:"protocol,omitempty"` // 配置修改时为空
+	Source   string    `json:"source"`             // ui、api、scheduler 等
+	Message  string    `json:"message,omitempty"`
+}
+
+// historyFilePath 规则事件文件，每行一条 JSON
+var historyFilePath = filepath.Join(".", "db", "history.jsonl")
+
+// ruleEvents 内存中的事件（按时间顺序），lines 为事件文件的行数，过多时压缩文件
+var ruleEvents = struct {
+	sync.Mutex
+	events []RuleEvent
+	lines  int
+}{}
+
+// loadRuleEvents 读取事件文件中最近的事件
+func loadRuleEvents() {
+	data, err := os.ReadFile(historyFilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read rule history: %v", err)
+		}
+		return
+	}
+
+	var events []RuleEvent
+	lines := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lines++
+		var event RuleEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(events) > maxRuleEvents {
+		events = events[len(events)-maxRuleEvents:]
+	}
+
+	ruleEvents.Lock()
+	defer ruleEvents.Unlock()
+	ruleEvents.events = events
+	ruleEvents.lines = lines
+}
+
+// recordRuleEvent 记录规则事件并追加到事件文件，ruleID 为空时忽略
+func recordRuleEvent(event RuleEvent) {
+	if event.RuleID == "" {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	ruleEvents.Lock()
+	defer ruleEvents.Unlock()
+	ruleEvents.events = append(ruleEvents.events, event)
+	if len(ruleEvents.events) > maxRuleEvents {
+		ruleEvents.events = append([]RuleEvent(nil), ruleEvents.events[len(ruleEvents.events)-maxRuleEvents:]...)
+	}
+
+	// 文件只追加，行数达到保留数的两倍时用内存中的事件重写
+	if ruleEvents.lines >= 2*maxRuleEvents {
+		if err := compactRuleEventsLocked(); err != nil {
+			log.Printf("Failed to compact rule history: %v", err)
+		}
+		return
+	}
+	f, err := os.OpenFile(historyFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to write rule history: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write rule history: %v", err)
+		return
+	}
+	ruleEvents.lines++
+}
+
+// compactRuleEventsLocked 用内存中的事件重写事件文件，调用方需持有锁
+func compactRuleEventsLocked() error {
+	var buf bytes.Buffer
+	for _, event := range ruleEvents.events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if err := store.WriteFileAtomic(historyFilePath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	ruleEvents.lines = len(ruleEvents.events)
+	return nil
+}
+
+// recordForwardEvent 记录转发的启动或停止，err 不为空时记为出错
+func recordForwardEvent(rule Rule, eventType, protocol, source string, err error) {
+	event := RuleEvent{RuleID: rule.ID, Type: eventType, Protocol: protocol, Source: source}
+	if err != nil {
+		event.Type = RuleEventError
+		event.Message = "Failed to " + eventType + ": " + err.Error()
+	}
+	recordRuleEvent(event)
+}
+
+// recordListenEvent 记录按监听地址启停转发的事件，规则按监听地址与目标 addr:port 查找
+func recordListenEvent(r *http.Request, eventType, protocol, listenAddr, listenPort, target string, err error) {
+	if rule, ok := findRuleByTarget(listenAddr, listenPort, target); ok {
+		recordForwardEvent(rule, eventType, protocol, requestSource(r), err)
+	}
+}
+
+// recordConfigEvent 记录规则的配置修改
+func recordConfigEvent(ruleID, source, message string) {
+	recordRuleEvent(RuleEvent{RuleID: ruleID, Type: RuleEventConfig, Source: source, Message: message})
+}
+
+// requestSource 请求的事件来源：管理界面的请求为 ui，其余为 api
+func requestSource(r *http.Request) string {
+	if r.Header.Get(uiClientHeader) == sourceUI {
+		return sourceUI
+	}
+	return sourceAPI
+}
+
+// updateRuleConfig 修改规则的某项设置并记录配置修改事件，setting 为设置的名称
+func updateRuleConfig(r *http.Request, id, setting string, fn func(rule *Rule)) (Rule, error) {
+	rule, err := ruleStore.UpdateRule(id, fn)
+	if err == nil {
+		recordConfigEvent(id, requestSource(r), "Changed "+setting)
+	}
+	return rule, err
+}
+
+// apiGetRuleHistory 获取规则的事件历史（按时间顺序的最近 limit 条），
+// ruleId 为空时返回所有规则的事件，type 不为空时只返回该类型的事件
+func apiGetRuleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ruleID := query.Get("ruleId")
+	eventType := query.Get("type")
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = defaultRuleEventLimit
+	}
+
+	ruleEvents.Lock()
+	var events []RuleEvent
+	for i := len(ruleEvents.events) - 1; i >= 0 && len(events) < limit; i-- {
+		event := ruleEvents.events[i]
+		if (ruleID == "" || event.RuleID == ruleID) && (eventType == "" || event.Type == eventType) {
+			events = append(events, event)
+		}
+	}
+	ruleEvents.Unlock()
+
+	// 从新到旧收集，返回时按时间顺序
+	list := make([]RuleEvent, len(events))
+	for i, event := range events {
+		list[len(events)-1-i] = event
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+const (
+	hostnameTTL         = 10 * time.Minute
+	hostnameNegativeTTL = 2 * time.Minute
+	hostnameTimeout     = time.Second
+)
+
+// hostnameCache 客户端IP -> 主机名缓存
+var hostnameCache = struct {
+	sync.Mutex
+	entries map[string]hostnameEntry
+}{
+	entries: make(map[string]hostnameEntry),
+}
+
+type hostnameEntry struct {
+	name    string
+	expires time.Time
+	pending bool
+}
+
+// clientHostname 返回已缓存的主机名；未知时在后台解析并返回空字符串，不阻塞转发
+func clientHostname(ip net.IP) string {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return ""
+	}
+	key := ip.String()
+
+	hostnameCache.Lock()
+	entry, ok := hostnameCache.entries[key]
+	if ok && (entry.pending || time.Now().Before(entry.expires)) {
+		hostnameCache.Unlock()
+		return entry.name
+	}
+	hostnameCache.entries[key] = hostnameEntry{name: entry.name, pending: true}
+	hostnameCache.Unlock()
+
+	go func() {
+		name := resolveHostname(ip)
+		ttl := hostnameTTL
+		if name == "" {
+			ttl = hostnameNegativeTTL
+		}
+		hostnameCache.Lock()
+		hostnameCache.entries[key] = hostnameEntry{name: name, expires: time.Now().Add(ttl)}
+		hostnameCache.Unlock()
+	}()
+	return entry.name
+}
+
+// clientLabel 用于日志的客户端描述，已解析主机名时附在地址后
+func clientLabel(addr net.Addr) string {
+	if name := clientHostname(forward.RemoteIP(addr)); name != "" {
+		return fmt.Sprintf("%s (%s)", addr, name)
+	}
+	return addr.String()
+}
+
+// apiGetHostname 查询客户端IP的主机名，未缓存时同步解析
+func apiGetHostname(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.URL.Query().Get("ip"))
+	if ip == nil {
+		http.Error(w, "Invalid ip", http.StatusBadRequest)
+		return
+	}
+
+	name := clientHostname(ip)
+	if name == "" {
+		hostnameCache.Lock()
+		entry := hostnameCache.entries[ip.String()]
+		hostnameCache.Unlock()
+		if entry.pending {
+			name = resolveHostname(ip)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"ip": ip.String(), "hostname": name})
+}
+
+// resolveHostname 依次尝试反向DNS、NetBIOS 和 mDNS
+func resolveHostname(ip net.IP) string {
+	ctx, cancel := context.WithTimeout(context.Background(), hostnameTimeout)
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	cancel()
+	if err == nil && len(names) > 0 {
+		return strings.TrimSuffix(names[0], ".")
+	}
+
+	// 局域网设备通常没有 PTR 记录
+	if !ip.IsPrivate() && !ip.IsLinkLocalUnicast() {
+		return ""
+	}
+	if ip.To4() != nil {
+		if name, err := lookupNetBIOS(ip); err == nil && name != "" {
+			return name
+		}
+	}
+	if name, err := lookupMDNS(ip); err == nil && name != "" {
+		return name
+	}
+	return ""
+}
+
+// lookupNetBIOS 发送 NetBIOS 节点状态查询（UDP 137）获取计算机名
+func lookupNetBIOS(ip net.IP) (string, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(ip.String(), "137"))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(hostnameTimeout))
+
+	// 查询名称 "*"，NBSTAT 类型
+	query := []byte{0x13, 0x37, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0x20}
+	name := make([]byte, 16)
+	name[0] = '*'
+	for _, b := range name {
+		query = append(query, 'A'+b>>4, 'A'+b&0x0f)
+	}
+	query = append(query, 0, 0, 0x21, 0, 1)
+	if _, err := conn.Write(query); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	resp := buf[:n]
+	if len(resp) < 12 {
+		return "", errors.New("short NetBIOS response")
+	}
+
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(resp[4:6])); i++ {
+		if off, err = skipDNSName(resp, off); err != nil {
+			return "", err
+		}
+		off += 4
+	}
+	if off, err = skipDNSName(resp, off); err != nil {
+		return "", err
+	}
+	off += 10 // type, class, TTL, rdlength
+	if off >= len(resp) {
+		return "", errors.New("short NetBIOS response")
+	}
+
+	count := int(resp[off])
+	off++
+	for i := 0; i < count && off+18 <= len(resp); i++ {
+		entry := resp[off : off+18]
+		off += 18
+		// 后缀 0x00 为工作站名，跳过组名
+		if entry[15] == 0x00 && binary.BigEndian.Uint16(entry[16:18])&0x8000 == 0 {
+			return strings.TrimSpace(string(entry[:15])), nil
+		}
+	}
+	return "", nil
+}
+
+// lookupMDNS 直接向设备的 5353 端口发送单播 PTR 查询
+func lookupMDNS(ip net.IP) (string, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(ip.String(), "5353"))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(hostnameTimeout))
+
+	query := []byte{0x13, 0x38, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(reverseName(ip), ".") {
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0, 0, 12, 0, 1) // PTR, IN
+	if _, err := conn.Write(query); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	resp := buf[:n]
+	if len(resp) < 12 {
+		return "", errors.New("short mDNS response")
+	}
+
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(resp[4:6])); i++ {
+		if off, err = skipDNSName(resp, off); err != nil {
+			return "", err
+		}
+		off += 4
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(resp[6:8])); i++ {
+		if off, err = skipDNSName(resp, off); err != nil {
+			return "", err
+		}
+		if off+10 > len(resp) {
+			break
+		}
+		typ := binary.BigEndian.Uint16(resp[off:])
+		rdlen := int(binary.BigEndian.Uint16(resp[off+8:]))
+		off += 10
+		if typ == 12 {
+			name, err := readDNSName(resp, off)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(name, ".local"), nil
+		}
+		off += rdlen
+	}
+	return "", nil
+}
+
+// reverseName 生成 in-addr.arpa / ip6.arpa 反向域名
+func reverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip[i]&0x0f, ip[i]>>4)
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// skipDNSName 跳过报文中的域名（支持压缩指针），返回其后的偏移
+func skipDNSName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			return off + 2, nil
+		}
+		off += 1 + l
+	}
+	return 0, errors.New("malformed DNS name")
+}
+
+// readDNSName 读取报文中的域名（支持压缩指针）
+func readDNSName(msg []byte, off int) (string, error) {
+	var labels []string
+	for jumps := 0; off < len(msg) && jumps < 16; {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return strings.Join(labels, "."), nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", errors.New("malformed DNS name")
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+			continue
+		}
+		if off+1+l > len(msg) {
+			break
+		}
+		labels = append(labels, string(msg[off+1:off+1+l]))
+		off += 1 + l
+	}
+	return "", errors.New("malformed DNS name")
+}
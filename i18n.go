@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// langCookie 界面上切换语言时保存选择的 Cookie
+const langCookie = "lang"
+
+// zhErrors 纯文本错误响应的中文翻译。接口的原始错误信息为英文，未收录的信息保持原样
+var zhErrors = map[string]string{
+	"Method not allowed":                   "不支持的请求方法",
+	"Invalid request body":                 "请求体无效",
+	"Failed to read request body":          "读取请求体失败",
+	"Rule not found":                       "规则不存在",
+	"Rule not found in template":           "模板中没有该规则",
+	"Template not found":                   "模板不存在",
+	"Template name is required":            "请填写模板名称",
+	"Preset not found":                     "预设不存在",
+	"Blocklist not found":                  "黑名单不存在",
+	"Invalid ip":                           "IP 地址无效",
+	"Missing required parameters":          "缺少必需的参数",
+	"Unauthorized":                         "未登录或令牌无效",
+	"Forbidden":                            "禁止访问",
+	"Web UI not found":                     "找不到管理界面文件",
+	"Streaming not supported":              "不支持流式响应",
+	"Unsupported format, use json or yaml": "不支持的格式，请使用 json 或 yaml",
+	"Failed to read log file":              "读取日志文件失败",
+	"Failed to load configuration":         "加载配置失败",
+	"Failed to encode configuration":       "导出配置失败",
+	"Failed to encode template":            "导出模板失败",
+	"Failed to list backups":               "获取备份列表失败",
+	"Failed to generate QR code":           "生成二维码失败",
+	"Failed to detect public IP":           "检测公网IP失败",
+}
+
+// requestLanguage 请求使用的语言：?lang= 参数、界面上选择的语言（Cookie）、设置中的语言，
+// 都没有时按 Accept-Language。返回空字符串表示不翻译（界面为中文，接口错误为英文）
+func requestLanguage(r *http.Request) string {
+	if lang := r.URL.Query().Get("lang"); supportedLanguages[lang] {
+		return lang
+	}
+	if cookie, err := r.Cookie(langCookie); err == nil && supportedLanguages[cookie.Value] {
+		return cookie.Value
+	}
+	if lang := currentSettings().Language; lang != "" {
+		return lang
+	}
+	return acceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// acceptLanguage 按权重从 Accept-Language 中选出第一个支持的语言，如 "en-US,en;q=0.9,zh;q=0.8" 返回 en
+func acceptLanguage(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if supportedLanguages[base] && q > 0 {
+			candidates = append(candidates, candidate{base, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].lang
+}
+
+// injectLanguage 在页面中写入界面语言，供 i18n.js 翻译界面
+func injectLanguage(html, lang string) string {
+	if lang == "" {
+		return html
+	}
+	script := "<head>\n    <script>window.uiLanguage = " + strconv.Quote(lang) + ";</script>"
+	return strings.Replace(html, "<head>", script, 1)
+}
+
+// localizeError 翻译错误信息，带 ": 详情" 后缀时只翻译前半部分
+func localizeError(lang, msg string) string {
+	if lang != "zh" {
+		return msg
+	}
+	if translated, ok := zhErrors[msg]; ok {
+		return translated
+	}
+	if head, detail, ok := strings.Cut(msg, ": "); ok {
+		if translated, ok := zhErrors[head]; ok {
+			return translated + "：" + detail
+		}
+	}
+	return msg
+}
+
+// localizeErrors 按请求的语言翻译 http.Error 返回的纯文本错误。/api/ 下的纯文本错误转为
+// 与 writeError 相同的 JSON 格式，其他响应原样输出
+func localizeErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := requestLanguage(r)
+		api := strings.HasPrefix(r.URL.Path, "/api/")
+		if lang != "zh" && !api {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lw := &localizedWriter{ResponseWriter: w, lang: lang, api: api}
+		next.ServeHTTP(lw, r)
+		lw.finish()
+	})
+}
+
+// localizedWriter 拦截状态码不低于 400 的纯文本响应，结束时写出翻译后的内容
+type localizedWriter struct {
+	http.ResponseWriter
+	lang   string
+	api    bool // 以 JSON 格式写出错误
+	status int
+	buf    *bytes.Buffer // 非 nil 时正在拦截错误响应
+}
+
+func (w *localizedWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.buf = &bytes.Buffer{}
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *localizedWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush 支持日志流等流式响应
+func (w *localizedWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && w.buf == nil {
+		flusher.Flush()
+	}
+}
+
+// finish 写出拦截的错误响应
+func (w *localizedWriter) finish() {
+	if w.buf == nil {
+		return
+	}
+	msg := localizeError(w.lang, strings.TrimSuffix(w.buf.String(), "\n"))
+	w.Header().Del("Content-Length")
+	if w.api {
+		writeError(w.ResponseWriter, w.status, msg)
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write([]byte(msg + "\n"))
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// 支持互转的第三方配置格式
+const (
+	FormatFrpINI  = "frpc-ini"  // frp 旧版 frpc.ini
+	FormatFrpTOML = "frpc-toml" // frp 0.52+ 的 frpc.toml
+	FormatGostV2  = "gost-v2"   // gost v2 的 gost.json（ServeNodes）
+	FormatGostV3  = "gost-v3"   // gost v3 的 gost.yaml（services）
+)
+
+// maxImportSize 导入配置文件的大小上限
+const maxImportSize = 1 << 20
+
+// interopEntry 第三方配置中的一条端口转发
+// frp 的 remotePort 对应本程序的监听端口，localIP:localPort 对应转发目标
+type interopEntry struct {
+	Name       string
+	Protocol   string
+	ListenAddr string
+	ListenPort string
+	TargetAddr string
+	TargetPort string
+}
+
+// detectImportFormat 根据内容猜测配置格式
+func detectImportFormat(data []byte) string {
+	text := string(data)
+	trimmed := strings.TrimSpace(text)
+	switch {
+	case strings.Contains(text, "[[proxies]]"):
+		return FormatFrpTOML
+	case strings.HasPrefix(trimmed, "{"):
+		if strings.Contains(text, `"proxies"`) {
+			return FormatFrpTOML
+		}
+		if strings.Contains(text, `"services"`) {
+			return FormatGostV3
+		}
+		return FormatGostV2
+	case strings.Contains(text, "services:"):
+		return FormatGostV3
+	case strings.Contains(text, "proxies:"):
+		return FormatFrpTOML
+	case strings.HasPrefix(trimmed, "["):
+		return FormatFrpINI
+	}
+	return FormatGostV2
+}
+
+// parseInterop 解析第三方配置，返回转发条目与跳过的条目说明
+func parseInterop(format string, data []byte) ([]interopEntry, []string, error) {
+	switch format {
+	case FormatFrpINI:
+		entries, skipped := parseFrpINI(data)
+		return entries, skipped, nil
+	case FormatFrpTOML:
+		doc, err := parseFrpStructured(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries, skipped := frpProxies(doc)
+		return entries, skipped, nil
+	case FormatGostV2, FormatGostV3:
+		return parseGost(data)
+	}
+	return nil, nil, fmt.Errorf("unknown format %q", format)
+}
+
+// parseFrpINI 解析 frpc.ini，每个非 common 段是一个代理
+func parseFrpINI(data []byte) ([]interopEntry, []string) {
+	var entries []interopEntry
+	var skipped []string
+	var section string
+	values := map[string]string{}
+
+	flush := func() {
+		if section == "" || section == "common" {
+			return
+		}
+		entry, err := frpEntry(section, values["type"], values["local_ip"], values["local_port"], values["remote_port"])
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			flush()
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			values = map[string]string{}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	return entries, skipped
+}
+
+// parseFrpStructured 解析 frpc.toml，同时兼容 frp 的 YAML 与 JSON 配置
+func parseFrpStructured(data []byte) (map[string]interface{}, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("invalid frp JSON: %w", err)
+		}
+		return doc, nil
+	}
+	if !bytes.Contains(data, []byte("[[proxies]]")) {
+		doc, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("frp config must be a mapping")
+		}
+		return m, nil
+	}
+	return parseFrpTOML(data), nil
+}
+
+// parseFrpTOML 解析 frpc.toml 中的 [[proxies]] 数组表，其余表被忽略
+func parseFrpTOML(data []byte) map[string]interface{} {
+	var proxies []interface{}
+	var current map[string]interface{}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(stripYAMLComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			current = nil
+			if line == "[[proxies]]" {
+				current = map[string]interface{}{}
+				proxies = append(proxies, current)
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			current[strings.TrimSpace(key)] = parseYAMLScalar(value)
+		}
+	}
+	return map[string]interface{}{"proxies": proxies}
+}
+
+// frpProxies 从 frp 新版配置中取出代理
+func frpProxies(doc map[string]interface{}) ([]interopEntry, []string) {
+	var entries []interopEntry
+	var skipped []string
+	list, _ := doc["proxies"].([]interface{})
+	for i, item := range list {
+		proxy, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := configString(proxy, "name")
+		if name == "" {
+			name = fmt.Sprintf("proxy-%d", i+1)
+		}
+		entry, err := frpEntry(name, configString(proxy, "type"), configString(proxy, "localIP"),
+			configString(proxy, "localPort"), configString(proxy, "remotePort"))
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped
+}
+
+// frpEntry 把 frp 代理转换为转发条目，仅支持 tcp/udp 单端口代理
+func frpEntry(name, proxyType, localIP, localPort, remotePort string) (interopEntry, error) {
+	if proxyType == "" {
+		proxyType = "tcp"
+	}
+	if proxyType != "tcp" && proxyType != "udp" {
+		return interopEntry{}, fmt.Errorf("%s: proxy type %s is not supported", name, proxyType)
+	}
+	if strings.HasPrefix(name, "range:") || strings.ContainsAny(localPort+remotePort, ",-") {
+		return interopEntry{}, fmt.Errorf("%s: port ranges are not supported", name)
+	}
+	if localIP == "" {
+		localIP = "127.0.0.1"
+	}
+	if localPort == "" || remotePort == "" {
+		return interopEntry{}, fmt.Errorf("%s: localPort and remotePort are required", name)
+	}
+	return interopEntry{
+		Name:       name,
+		Protocol:   proxyType,
+		ListenAddr: "0.0.0.0",
+		ListenPort: remotePort,
+		TargetAddr: localIP,
+		TargetPort: localPort,
+	}, nil
+}
+
+// parseGost 解析 gost 配置：v2 JSON、v3 YAML/JSON，或包含 -L 参数的命令行
+func parseGost(data []byte) ([]interopEntry, []string, error) {
+	trimmed := bytes.TrimSpace(data)
+
+	var doc map[string]interface{}
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, nil, fmt.Errorf("invalid gost JSON: %w", err)
+		}
+	case bytes.Contains(data, []byte("services:")):
+		parsed, err := parseYAML(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc, _ = parsed.(map[string]interface{})
+	default:
+		return gostNodes(gostCommandNodes(string(data)))
+	}
+
+	if services, ok := doc["services"].([]interface{}); ok {
+		entries, skipped := gostServices(services)
+		return entries, skipped, nil
+	}
+
+	// gost v2：顶层 ServeNodes 以及 Routes[].ServeNodes
+	var nodes []string
+	nodes = append(nodes, configStrings(doc, "ServeNodes")...)
+	if routes, ok := doc["Routes"].([]interface{}); ok {
+		for _, route := range routes {
+			if m, ok := route.(map[string]interface{}); ok {
+				nodes = append(nodes, configStrings(m, "ServeNodes")...)
+			}
+		}
+	}
+	return gostNodes(nodes)
+}
+
+// gostCommandNodes 从命令行中取出 -L 参数
+func gostCommandNodes(text string) []string {
+	var nodes []string
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		switch {
+		case field == "-L" && i+1 < len(fields):
+			nodes = append(nodes, strings.Trim(fields[i+1], `"'`))
+		case strings.HasPrefix(field, "-L="):
+			nodes = append(nodes, strings.Trim(strings.TrimPrefix(field, "-L="), `"'`))
+		}
+	}
+	return nodes
+}
+
+// gostNodes 解析 gost v2 的端口转发节点，如 tcp://:8080/192.168.1.1:80
+func gostNodes(nodes []string) ([]interopEntry, []string, error) {
+	if len(nodes) == 0 {
+		return nil, nil, fmt.Errorf("no gost ServeNodes or -L arguments found")
+	}
+	var entries []interopEntry
+	var skipped []string
+	for _, node := range nodes {
+		scheme, rest, ok := strings.Cut(node, "://")
+		if !ok || (scheme != "tcp" && scheme != "udp") {
+			skipped = append(skipped, fmt.Sprintf("%s: only tcp:// and udp:// port forwarding is supported", node))
+			continue
+		}
+		rest, _, _ = strings.Cut(rest, "?")
+		listen, target, ok := strings.Cut(rest, "/")
+		if !ok || target == "" {
+			skipped = append(skipped, fmt.Sprintf("%s: missing forward target", node))
+			continue
+		}
+		if first, _, multiple := strings.Cut(target, ","); multiple {
+			skipped = append(skipped, fmt.Sprintf("%s: only the first target %s was imported", node, first))
+			target = first
+		}
+		entry, err := gostEntry(node, scheme, listen, target)
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, nil
+}
+
+// gostServices 解析 gost v3 的 services
+func gostServices(services []interface{}) ([]interopEntry, []string) {
+	var entries []interopEntry
+	var skipped []string
+	for i, item := range services {
+		service, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := configString(service, "name")
+		if name == "" {
+			name = fmt.Sprintf("service-%d", i)
+		}
+		handler, _ := service["handler"].(map[string]interface{})
+		protocol := configString(handler, "type")
+		if protocol != "tcp" && protocol != "udp" {
+			skipped = append(skipped, fmt.Sprintf("%s: handler type %s is not supported", name, protocol))
+			continue
+		}
+		forwarder, _ := service["forwarder"].(map[string]interface{})
+		nodes, _ := forwarder["nodes"].([]interface{})
+		if len(nodes) == 0 {
+			skipped = append(skipped, fmt.Sprintf("%s: missing forwarder nodes", name))
+			continue
+		}
+		if len(nodes) > 1 {
+			skipped = append(skipped, fmt.Sprintf("%s: only the first forwarder node was imported", name))
+		}
+		node, _ := nodes[0].(map[string]interface{})
+		entry, err := gostEntry(name, protocol, configString(service, "addr"), configString(node, "addr"))
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped
+}
+
+// gostEntry 由监听地址与目标地址构造转发条目
+func gostEntry(name, protocol, listen, target string) (interopEntry, error) {
+	listenHost, listenPort, err := net.SplitHostPort(listen)
+	if err != nil {
+		return interopEntry{}, fmt.Errorf("%s: invalid listen address %q", name, listen)
+	}
+	targetHost, targetPort, err := net.SplitHostPort(target)
+	if err != nil {
+		return interopEntry{}, fmt.Errorf("%s: invalid target address %q", name, target)
+	}
+	if listenHost == "" {
+		listenHost = "0.0.0.0"
+	}
+	return interopEntry{
+		Name:       name,
+		Protocol:   protocol,
+		ListenAddr: listenHost,
+		ListenPort: listenPort,
+		TargetAddr: targetHost,
+		TargetPort: targetPort,
+	}, nil
+}
+
+// configString 读取配置中的字符串或数字字段
+func configString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// configStrings 读取配置中的字符串列表
+func configStrings(m map[string]interface{}, key string) []string {
+	list, _ := m[key].([]interface{})
+	var values []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// ImportedRule 导入生成的规则及其协议
+type ImportedRule struct {
+	Rule      Rule     `json:"rule"`
+	Protocols []string `json:"protocols"`
+}
+
+// importInteropEntries 把转发条目合并为规则（同一监听与目标的 tcp/udp 合为一条），跳过已存在的规则
+func importInteropEntries(entries []interopEntry) ([]ImportedRule, []string) {
+	var imported []ImportedRule
+	var skipped []string
+	index := make(map[string]int)
+
+	// 序号仅用于预览，保存时由 RuleStore 重新分配
+	maxSeq := 0
+	for _, rule := range ruleStore.Rules() {
+		if rule.Seq > maxSeq {
+			maxSeq = rule.Seq
+		}
+	}
+
+	for _, entry := range entries {
+		listenPort, targetPort := entry.ListenPort, entry.TargetPort
+		if err := resolvePorts(&listenPort, &targetPort); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", entry.Name, err))
+			continue
+		}
+		key := strings.Join([]string{entry.ListenAddr, listenPort, entry.TargetAddr, targetPort}, "|")
+		if i, ok := index[key]; ok {
+			imported[i].Protocols = append(imported[i].Protocols, entry.Protocol)
+			continue
+		}
+		if ruleExists(entry.ListenAddr, listenPort, entry.TargetAddr, targetPort) {
+			skipped = append(skipped, fmt.Sprintf("%s: an identical rule already exists", entry.Name))
+			continue
+		}
+
+		maxSeq++
+		name, _, _ := normalizeRuleLabel(entry.Name, "")
+		rule := Rule{
+			ID:         uuid.New().String(),
+			Seq:        maxSeq,
+			Name:       name,
+			ListenAddr: entry.ListenAddr,
+			ListenPort: listenPort,
+			TargetAddr: entry.TargetAddr,
+			TargetPort: targetPort,
+		}
+		index[key] = len(imported)
+		imported = append(imported, ImportedRule{Rule: rule, Protocols: []string{entry.Protocol}})
+	}
+	return imported, skipped
+}
+
+// ruleExists 检查是否已有相同监听与目标的规则
+func ruleExists(listenAddr, listenPort, targetAddr, targetPort string) bool {
+	for _, rule := range ruleStore.Rules() {
+		if rule.ListenAddr == listenAddr && rule.ListenPort == listenPort &&
+			rule.TargetAddr == targetAddr && rule.TargetPort == targetPort {
+			return true
+		}
+	}
+	return false
+}
+
+// exportProtocols 导出时规则使用的协议：正在运行的协议，未运行时为 tcp
+func exportProtocols(rule Rule) []string {
+	var protocols []string
+	for _, protocol := range runningProtocols(rule) {
+		if protocol == "tcp" || protocol == "udp" {
+			protocols = append(protocols, protocol)
+		}
+	}
+	if len(protocols) == 0 {
+		protocols = []string{"tcp"}
+	}
+	return protocols
+}
+
+// exportName 导出条目的名称：规则名称中的字母数字，为空时为 rule-序号
+func exportName(rule Rule) string {
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, rule.Name), "-")
+	if name == "" {
+		return fmt.Sprintf("rule-%d", rule.Seq)
+	}
+	return name
+}
+
+// exportEntries 把规则转换为转发条目，目标中的变量按当前环境展开，跳过端口未填写的规则；名称重复时附加序号
+func exportEntries(list []Rule) []interopEntry {
+	var entries []interopEntry
+	used := make(map[string]bool)
+	for _, rule := range list {
+		rule = resolvedRule(rule)
+		if rule.ListenPort == "" || rule.TargetAddr == "" || rule.TargetPort == "" {
+			continue
+		}
+		base := exportName(rule)
+		if used[base] {
+			base = fmt.Sprintf("%s-%d", base, rule.Seq)
+		}
+		used[base] = true
+		for _, protocol := range exportProtocols(rule) {
+			name := base
+			if protocol != "tcp" {
+				name += "-" + protocol
+			}
+			entries = append(entries, interopEntry{
+				Name:       name,
+				Protocol:   protocol,
+				ListenAddr: rule.ListenAddr,
+				ListenPort: rule.ListenPort,
+				TargetAddr: rule.TargetAddr,
+				TargetPort: rule.TargetPort,
+			})
+		}
+	}
+	return entries
+}
+
+// formatInterop 生成第三方配置文件内容
+func formatInterop(format string, entries []interopEntry) (string, error) {
+	var b strings.Builder
+	switch format {
+	case FormatFrpINI:
+		b.WriteString("# Generated by port-forwarder. Set server_addr/server_port to your frps server.\n")
+		b.WriteString("[common]\nserver_addr = 127.0.0.1\nserver_port = 7000\n")
+		for _, e := range entries {
+			fmt.Fprintf(&b, "\n[%s]\ntype = %s\nlocal_ip = %s\nlocal_port = %s\nremote_port = %s\n",
+				e.Name, e.Protocol, e.TargetAddr, e.TargetPort, e.ListenPort)
+		}
+	case FormatFrpTOML:
+		b.WriteString("# Generated by port-forwarder. Set serverAddr/serverPort to your frps server.\n")
+		b.WriteString("serverAddr = \"127.0.0.1\"\nserverPort = 7000\n")
+		for _, e := range entries {
+			fmt.Fprintf(&b, "\n[[proxies]]\nname = %q\ntype = %q\nlocalIP = %q\nlocalPort = %s\nremotePort = %s\n",
+				e.Name, e.Protocol, e.TargetAddr, e.TargetPort, e.ListenPort)
+		}
+	case FormatGostV2:
+		nodes := []string{}
+		for _, e := range entries {
+			nodes = append(nodes, fmt.Sprintf("%s://%s/%s", e.Protocol,
+				net.JoinHostPort(e.ListenAddr, e.ListenPort), net.JoinHostPort(e.TargetAddr, e.TargetPort)))
+		}
+		data, err := json.MarshalIndent(map[string]interface{}{"ServeNodes": nodes}, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		b.Write(data)
+		b.WriteString("\n")
+	case FormatGostV3:
+		b.WriteString("# Generated by port-forwarder\nservices:\n")
+		for _, e := range entries {
+			fmt.Fprintf(&b, "- name: %s\n  addr: %q\n  handler:\n    type: %s\n  listener:\n    type: %s\n  forwarder:\n    nodes:\n    - name: target-0\n      addr: %q\n",
+				e.Name, net.JoinHostPort(e.ListenAddr, e.ListenPort), e.Protocol, e.Protocol, net.JoinHostPort(e.TargetAddr, e.TargetPort))
+		}
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	return b.String(), nil
+}
+
+// apiImportFrom 从 frp/gost 配置导入规则，请求体为配置文件原文
+// 查询参数 format 为空时自动识别，dryRun=1 时只返回解析结果不保存
+func apiImportFrom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = detectImportFormat(data)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	entries, skipped, err := parseInterop(format, data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imported, duplicates := importInteropEntries(entries)
+	skipped = append(skipped, duplicates...)
+
+	dryRun := r.URL.Query().Get("dryRun") == "1"
+	if !dryRun && len(imported) > 0 {
+		list := make([]Rule, len(imported))
+		for i, item := range imported {
+			list[i] = item.Rule
+		}
+		added, err := ruleStore.AddRules(list)
+		if err != nil {
+			log.Printf("Failed to save rules: %v", err)
+		}
+		for i := range added {
+			imported[i].Rule = added[i]
+			recordConfigEvent(added[i].ID, requestSource(r), "Imported from "+format+" config")
+		}
+		log.Printf("Imported %d rules from %s config", len(imported), format)
+	}
+
+	if imported == nil {
+		imported = []ImportedRule{}
+	}
+	if skipped == nil {
+		skipped = []string{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"format":   format,
+		"dryRun":   dryRun,
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
+
+// apiExportTo 把规则导出为 frp/gost 配置，ids 为逗号分隔的规则ID，为空时导出全部
+func apiExportTo(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+
+	list := ruleStore.Rules()
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		list = nil
+		for _, id := range strings.Split(ids, ",") {
+			if rule, ok := findRule(strings.TrimSpace(id)); ok {
+				list = append(list, rule)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Seq < list[j].Seq })
+
+	content, err := formatInterop(format, exportEntries(list))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filenames := map[string]string{
+		FormatFrpINI:  "frpc.ini",
+		FormatFrpTOML: "frpc.toml",
+		FormatGostV2:  "gost.json",
+		FormatGostV3:  "gost.yaml",
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename="+url.PathEscape(filenames[format]))
+	io.WriteString(w, content)
+}
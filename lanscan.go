@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// LANHost 局域网中发现的设备
+type LANHost struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac,omitempty"`
+	Vendor    string `json:"vendor,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	Interface string `json:"interface"`
+}
+
+// arpEntry 系统 ARP 表中的一项
+type arpEntry struct {
+	IP  string
+	MAC string
+}
+
+const (
+	lanScanMaxHosts = 1024 // 单个网段最多扫描的地址数，更大的网段只扫描本机所在的 /24
+	lanScanWorkers  = 128
+	lanProbeTimeout = 400 * time.Millisecond
+)
+
+// lanProbePorts 探测主机存活时尝试的常见端口，连接被拒绝同样说明主机在线
+var lanProbePorts = []string{"80", "443", "22", "445", "139", "62078"}
+
+// errnoWSAECONNREFUSED Windows 上连接被拒绝时 winsock 返回的错误码
+const errnoWSAECONNREFUSED = syscall.Errno(10061)
+
+// ouiVendors 常见网卡厂商 OUI 前缀
+var ouiVendors = map[string]string{
+	"b8:27:eb": "Raspberry Pi",
+	"dc:a6:32": "Raspberry Pi",
+	"e4:5f:01": "Raspberry Pi",
+	"d8:3a:dd": "Raspberry Pi",
+	"00:1c:42": "Parallels",
+	"00:50:56": "VMware",
+	"00:0c:29": "VMware",
+	"08:00:27": "VirtualBox",
+	"52:54:00": "QEMU/KVM",
+	"00:15:5d": "Hyper-V",
+	"00:11:32": "Synology",
+	"24:5e:be": "QNAP",
+	"00:08:9b": "QNAP",
+	"f0:9f:c2": "Ubiquiti",
+	"24:a4:3c": "Ubiquiti",
+	"18:e8:29": "Ubiquiti",
+	"b4:fb:e4": "Ubiquiti",
+	"74:ac:b9": "Ubiquiti",
+	"50:c7:bf": "TP-Link",
+	"98:da:c4": "TP-Link",
+	"c0:06:c3": "TP-Link",
+	"14:cc:20": "TP-Link",
+	"ec:08:6b": "TP-Link",
+	"00:1d:0f": "TP-Link",
+	"20:4e:7f": "Netgear",
+	"a0:40:a0": "Netgear",
+	"c8:3a:35": "Tenda",
+	"48:8f:5a": "MikroTik",
+	"4c:5e:0c": "MikroTik",
+	"e4:8d:8c": "MikroTik",
+	"00:e0:4c": "Realtek",
+	"28:6c:07": "Xiaomi",
+	"64:09:80": "Xiaomi",
+	"78:11:dc": "Xiaomi",
+	"50:64:2b": "Xiaomi",
+	"04:cf:8c": "Xiaomi",
+	"e8:4e:06": "Huawei",
+	"00:e0:fc": "Huawei",
+	"48:46:fb": "Huawei",
+	"ac:85:3d": "Huawei",
+	"00:17:88": "Philips Hue",
+	"18:b4:30": "Nest",
+	"f4:f5:d8": "Google",
+	"3c:5a:b4": "Google",
+	"44:07:0b": "Google",
+	"fc:a6:67": "Amazon",
+	"68:37:e9": "Amazon",
+	"a4:77:33": "Google",
+	"3c:22:fb": "Apple",
+	"a4:83:e7": "Apple",
+	"f0:18:98": "Apple",
+	"ac:bc:32": "Apple",
+	"dc:a9:04": "Apple",
+	"f4:5c:89": "Apple",
+	"8c:85:90": "Apple",
+	"00:1b:63": "Apple",
+	"5c:f9:38": "Apple",
+	"34:02:86": "Intel",
+	"8c:8d:28": "Intel",
+	"3c:97:0e": "Intel",
+	"a4:4c:c8": "Dell",
+	"f8:bc:12": "Dell",
+	"00:14:22": "Dell",
+	"3c:52:82": "HP",
+	"00:1e:0b": "HP",
+	"30:e1:71": "HP",
+	"00:80:77": "Brother",
+	"00:26:ab": "Epson",
+	"f8:0d:ac": "Espressif",
+	"24:0a:c4": "Espressif",
+	"84:f3:eb": "Espressif",
+	"ec:fa:bc": "Espressif",
+	"cc:50:e3": "Espressif",
+	"8c:aa:b5": "Espressif",
+	"a4:cf:12": "Espressif",
+	"00:24:e4": "Withings",
+	"00:04:4b": "NVIDIA",
+	"48:b0:2d": "NVIDIA",
+	"00:d8:61": "Micro-Star",
+	"2c:f0:5d": "Micro-Star",
+	"04:d9:f5": "ASUSTek",
+	"2c:fd:a1": "ASUSTek",
+	"1c:87:2c": "ASUSTek",
+	"b0:6e:bf": "ASUSTek",
+	"00:1a:11": "Google",
+	"d8:eb:46": "Google",
+	"cc:2d:e0": "Routerboard",
+	"70:85:c2": "ASRock",
+	"00:25:90": "Super Micro",
+	"ac:1f:6b": "Super Micro",
+	"00:9e:c8": "Xiaomi",
+	"7c:49:eb": "Xiaomi",
+	"00:1a:79": "Xiaomi",
+	"00:16:3e": "Xen",
+	"02:42:ac": "Docker",
+}
+
+// macVendor 根据 MAC 前缀查询厂商，本地管理地址标记为随机地址
+func macVendor(mac string) string {
+	mac = strings.ToLower(mac)
+	if len(mac) < 8 {
+		return ""
+	}
+	if v, ok := ouiVendors[mac[:8]]; ok {
+		return v
+	}
+	// 第一个字节的第二位表示本地管理地址（手机等的随机 MAC）
+	if b, err := net.ParseMAC(mac); err == nil && b[0]&0x02 != 0 {
+		return "Randomized"
+	}
+	return ""
+}
+
+// lanSubnet 本机 IPv4 网段
+type lanSubnet struct {
+	iface string
+	local net.IP
+	net   *net.IPNet
+}
+
+// localSubnets 列出可扫描的本地 IPv4 网段
+func localSubnets() []lanSubnet {
+	var subnets []lanSubnet
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ones, _ := ipnet.Mask.Size()
+			if ones >= 31 {
+				continue
+			}
+			// 过大的网段只扫描本机所在的 /24
+			mask := ipnet.Mask
+			if 1<<(32-ones) > lanScanMaxHosts {
+				mask = net.CIDRMask(24, 32)
+			}
+			subnets = append(subnets, lanSubnet{
+				iface: iface.Name,
+				local: ipnet.IP.To4(),
+				net:   &net.IPNet{IP: ipnet.IP.To4().Mask(mask), Mask: mask},
+			})
+		}
+	}
+	return subnets
+}
+
+// subnetHosts 网段内除网络地址、广播地址之外的所有地址
+func subnetHosts(n *net.IPNet) []net.IP {
+	ones, bits := n.Mask.Size()
+	start := binary.BigEndian.Uint32(n.IP.To4())
+	size := uint32(1) << uint(bits-ones)
+
+	var hosts []net.IP
+	for i := uint32(1); i < size-1; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+i)
+		hosts = append(hosts, ip)
+	}
+	return hosts
+}
+
+// probeHost 探测主机是否在线：任一端口连接成功或被拒绝即视为在线
+// 同时发送一个 UDP 包以触发 ARP 解析，使其出现在系统 ARP 表中
+func probeHost(ip net.IP) bool {
+	if conn, err := net.Dial("udp", net.JoinHostPort(ip.String(), "9")); err == nil {
+		conn.Write([]byte{0})
+		conn.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lanProbeTimeout)
+	defer cancel()
+
+	alive := make(chan bool, len(lanProbePorts))
+	var dialer net.Dialer
+	for _, port := range lanProbePorts {
+		go func(port string) {
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				conn.Close()
+			}
+			alive <- err == nil || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, errnoWSAECONNREFUSED)
+		}(port)
+	}
+
+	found := false
+	for range lanProbePorts {
+		if <-alive {
+			found = true
+			cancel()
+		}
+	}
+	return found
+}
+
+// lookupHostname 反向解析主机名
+func lookupHostname(ip string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// scanLAN 扫描所有本地网段，结合探测结果与 ARP 表
+func scanLAN() []LANHost {
+	found := make(map[string]*LANHost)
+	var mu sync.Mutex
+
+	subnets := localSubnets()
+	jobs := make(chan struct {
+		ip    net.IP
+		iface string
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < lanScanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if probeHost(job.ip) {
+					mu.Lock()
+					found[job.ip.String()] = &LANHost{IP: job.ip.String(), Interface: job.iface}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, subnet := range subnets {
+		for _, ip := range subnetHosts(subnet.net) {
+			if ip.Equal(subnet.local) {
+				continue
+			}
+			jobs <- struct {
+				ip    net.IP
+				iface string
+			}{ip, subnet.iface}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// 只响应 ARP、不开放端口的设备也会出现在 ARP 表中
+	entries, err := readARPTable()
+	if err != nil {
+		log.Printf("Failed to read ARP table: %v", err)
+	}
+	for _, e := range entries {
+		ip := net.ParseIP(e.IP)
+		for _, subnet := range subnets {
+			if ip == nil || !subnet.net.Contains(ip) || ip.Equal(subnet.local) {
+				continue
+			}
+			host, ok := found[e.IP]
+			if !ok {
+				host = &LANHost{IP: e.IP, Interface: subnet.iface}
+				found[e.IP] = host
+			}
+			host.MAC = e.MAC
+			host.Vendor = macVendor(e.MAC)
+		}
+	}
+
+	// 并发反向解析主机名
+	hosts := make([]LANHost, 0, len(found))
+	var resolveWG sync.WaitGroup
+	for _, host := range found {
+		resolveWG.Add(1)
+		go func(host *LANHost) {
+			defer resolveWG.Done()
+			host.Hostname = lookupHostname(host.IP)
+		}(host)
+	}
+	resolveWG.Wait()
+
+	for _, host := range found {
+		hosts = append(hosts, *host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return binary.BigEndian.Uint32(net.ParseIP(hosts[i].IP).To4()) < binary.BigEndian.Uint32(net.ParseIP(hosts[j].IP).To4())
+	})
+	return hosts
+}
+
+// apiScanLAN 扫描局域网设备，供选择目标地址
+func apiScanLAN(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	hosts := scanLAN()
+	log.Printf("LAN scan found %d hosts in %s", len(hosts), time.Since(start).Round(time.Millisecond))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hosts)
+}
@@ -0,0 +1,57 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// readARPTable 解析 BSD/macOS 的 arp -an 输出
+func readARPTable() ([]arpEntry, error) {
+	out, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []arpEntry
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// ? (192.168.1.1) at aa:bb:cc:dd:ee:ff on en0 ifscope [ethernet]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] != "at" {
+			continue
+		}
+		ip := strings.Trim(fields[1], "()")
+		mac, err := net.ParseMAC(fields[3])
+		if net.ParseIP(ip) == nil || err != nil {
+			continue
+		}
+		entries = append(entries, arpEntry{IP: ip, MAC: mac.String()})
+	}
+	return entries, scanner.Err()
+}
+
+// defaultGateway 解析 BSD/macOS 的 route -n get default 输出
+func defaultGateway() (net.IP, error) {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		//     gateway: 192.168.1.1
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || key != "gateway" {
+			continue
+		}
+		if ip := net.ParseIP(strings.TrimSpace(value)).To4(); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, errors.New("no default gateway")
+}
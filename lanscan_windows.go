@@ -0,0 +1,55 @@
+//go:build windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+)
+
+// readARPTable 解析 arp -a 的输出
+func readARPTable() ([]arpEntry, error) {
+	out, err := hiddenCommand("arp", "-a").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []arpEntry
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// 192.168.1.1          aa-bb-cc-dd-ee-ff     dynamic
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		mac := strings.ReplaceAll(strings.ToLower(fields[1]), "-", ":")
+		if mac == "ff:ff:ff:ff:ff:ff" || strings.HasPrefix(mac, "01:00:5e") {
+			continue
+		}
+		entries = append(entries, arpEntry{IP: fields[0], MAC: mac})
+	}
+	return entries, scanner.Err()
+}
+
+// defaultGateway 解析 route print 输出中的 IPv4 默认路由
+func defaultGateway() (net.IP, error) {
+	out, err := hiddenCommand("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// 0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.20     25
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		if ip := net.ParseIP(fields[2]).To4(); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, errors.New("no default gateway")
+}
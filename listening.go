@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// ListeningSocket 系统中正在监听（或已绑定）的套接字
+type ListeningSocket struct {
+	Protocol string `json:"protocol"` // tcp / udp
+	Addr     string `json:"addr"`
+	Port     int    `json:"port"`
+	PID      int    `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+// DiscoveredService 本机发现的服务及推荐的转发配置
+type DiscoveredService struct {
+	ListeningSocket
+	Service    string `json:"service,omitempty"` // 按端口推断的服务名
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+}
+
+// serviceNameForPort 按端口反查服务名
+func serviceNameForPort(port int) string {
+	name := ""
+	for n, p := range serviceTable {
+		// 同一端口有多个别名时取字典序最小的，保证结果稳定
+		if p == port && (name == "" || n < name) {
+			name = n
+		}
+	}
+	return name
+}
+
+// apiDiscoverServices 列出本机正在监听的TCP服务，并给出转发建议
+func apiDiscoverServices(w http.ResponseWriter, r *http.Request) {
+	sockets, err := listListeningSockets()
+	if err != nil {
+		log.Printf("Failed to list listening sockets: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	self := os.Getpid()
+	seen := make(map[int]bool)
+	services := []DiscoveredService{}
+	for _, s := range sockets {
+		// 只关注TCP服务，跳过本程序自身的监听
+		if s.Protocol != "tcp" || s.PID == self || seen[s.Port] {
+			continue
+		}
+		seen[s.Port] = true
+
+		// 监听在通配地址上的服务通过回环地址访问
+		target := s.Addr
+		if ip := net.ParseIP(s.Addr); ip == nil || ip.IsUnspecified() {
+			target = "127.0.0.1"
+		}
+
+		services = append(services, DiscoveredService{
+			ListeningSocket: s,
+			Service:         serviceNameForPort(s.Port),
+			TargetAddr:      target,
+			TargetPort:      strconv.Itoa(s.Port),
+		})
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Port < services[j].Port
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "services": services})
+}
+
+// systemPorts 返回被其他进程占用的端口（排除本程序自身的监听）
+func systemPorts() ([]ListeningSocket, error) {
+	sockets, err := listListeningSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	self := os.Getpid()
+	ports := []ListeningSocket{}
+	for _, s := range sockets {
+		if s.PID == self {
+			continue
+		}
+		ports = append(ports, s)
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		return ports[i].Protocol < ports[j].Protocol
+	})
+	return ports, nil
+}
+
+// apiGetSystemPorts 获取系统中已被其他进程占用的端口，可按 protocol 过滤
+func apiGetSystemPorts(w http.ResponseWriter, r *http.Request) {
+	protocol := r.URL.Query().Get("protocol")
+
+	ports, err := systemPorts()
+	if err != nil {
+		log.Printf("Failed to list system ports: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if protocol != "" {
+		filtered := []ListeningSocket{}
+		for _, p := range ports {
+			if p.Protocol == protocol {
+				filtered = append(filtered, p)
+			}
+		}
+		ports = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "ports": ports})
+}
+
+// portOwner 查找占用监听端口的套接字。SCTP 不在列表中，无法查找
+func portOwner(protocol, listenAddr string, port int) (ListeningSocket, bool) {
+	if protocol == "socks5" {
+		protocol = "tcp"
+	}
+	sockets, err := listListeningSockets()
+	if err != nil {
+		return ListeningSocket{}, false
+	}
+	for _, s := range sockets {
+		if s.Protocol == protocol && s.Port == port && (listenAddr == "" || listenAddrsOverlap(listenAddr, s.Addr)) {
+			return s, true
+		}
+	}
+	return ListeningSocket{}, false
+}
+
+// portOwnerText 描述占用端口的进程，如 "nginx (PID 1234)"。
+// 没有权限读取其他用户的进程时只能看到端口被占用
+func portOwnerText(s ListeningSocket) string {
+	switch {
+	case s.PID == os.Getpid():
+		return "this program (another forward)"
+	case s.PID == 0:
+		return "another process (run as root/administrator to see which)"
+	case s.Process == "":
+		return fmt.Sprintf("PID %d", s.PID)
+	}
+	return fmt.Sprintf("%s (PID %d)", s.Process, s.PID)
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listListeningSockets 通过 /proc/net 读取监听中的套接字
+func listListeningSockets() ([]ListeningSocket, error) {
+	owners := socketOwners()
+
+	var sockets []ListeningSocket
+	sources := []struct {
+		file     string
+		protocol string
+		state    string
+	}{
+		{"/proc/net/tcp", "tcp", "0A"}, // TCP_LISTEN
+		{"/proc/net/tcp6", "tcp", "0A"},
+		{"/proc/net/udp", "udp", "07"}, // TCP_CLOSE，即未连接的UDP套接字
+		{"/proc/net/udp6", "udp", "07"},
+	}
+	for _, src := range sources {
+		entries, err := readProcNet(src.file, src.protocol, src.state, owners)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		sockets = append(sockets, entries...)
+	}
+	return sockets, nil
+}
+
+// readProcNet 解析 /proc/net/{tcp,udp}[6] 文件
+func readProcNet(file, protocol, state string, owners map[string]int) ([]ListeningSocket, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sockets []ListeningSocket
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+
+		ip, port, err := parseProcAddr(fields[1])
+		if err != nil {
+			continue
+		}
+
+		s := ListeningSocket{Protocol: protocol, Addr: ip.String(), Port: port}
+		if pid, ok := owners[fields[9]]; ok {
+			s.PID = pid
+			s.Process = processName(pid)
+		}
+		sockets = append(sockets, s)
+	}
+	return sockets, scanner.Err()
+}
+
+// parseProcAddr 解析形如 0100007F:1F90 的地址
+func parseProcAddr(s string) (net.IP, int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	// 内核按32位字的主机字节序输出，逐字翻转
+	for i := 0; i+4 <= len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+	return net.IP(raw), int(port), nil
+}
+
+// socketOwners 扫描 /proc/*/fd 建立 socket inode 到 PID 的映射
+func socketOwners() map[string]int {
+	owners := make(map[string]int)
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+		pid, err := strconv.Atoi(strings.Split(fd, "/")[2])
+		if err != nil {
+			continue
+		}
+		owners[inode] = pid
+	}
+	return owners
+}
+
+// processName 读取进程名
+func processName(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
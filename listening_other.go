@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+)
+
+// listListeningSockets 当前平台暂不支持枚举监听端口
+func listListeningSockets() ([]ListeningSocket, error) {
+	return nil, errors.New("listing listening sockets is not supported on this platform")
+}
@@ -0,0 +1,84 @@
+//go:build windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listListeningSockets 通过 netstat -ano 读取监听中的套接字
+func listListeningSockets() ([]ListeningSocket, error) {
+	out, err := hiddenCommand("netstat", "-ano").Output()
+	if err != nil {
+		return nil, err
+	}
+	names := processNames()
+
+	var sockets []ListeningSocket
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		var protocol, pidField string
+		switch {
+		case fields[0] == "TCP" && len(fields) == 5 && fields[3] == "LISTENING":
+			protocol, pidField = "tcp", fields[4]
+		case fields[0] == "UDP" && len(fields) == 4:
+			protocol, pidField = "udp", fields[3]
+		default:
+			continue
+		}
+
+		host, portStr, err := net.SplitHostPort(fields[1])
+		if err != nil {
+			continue
+		}
+		port, _ := strconv.Atoi(portStr)
+		pid, _ := strconv.Atoi(pidField)
+
+		sockets = append(sockets, ListeningSocket{
+			Protocol: protocol,
+			Addr:     strings.Trim(host, "[]"),
+			Port:     port,
+			PID:      pid,
+			Process:  names[pid],
+		})
+	}
+	return sockets, scanner.Err()
+}
+
+// processNames 通过 tasklist 获取 PID 到进程名的映射
+func processNames() map[int]string {
+	names := make(map[int]string)
+	out, err := hiddenCommand("tasklist", "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return names
+	}
+	records, _ := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	for _, rec := range records {
+		if len(rec) < 2 {
+			continue
+		}
+		if pid, err := strconv.Atoi(rec[1]); err == nil {
+			names[pid] = rec[0]
+		}
+	}
+	return names
+}
+
+// hiddenCommand 创建不弹出控制台窗口的命令
+func hiddenCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd
+}
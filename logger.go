@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志级别
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// logLevelRank 级别由低到高的顺序
+var logLevelRank = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+}
+
+// LogEntry 一条结构化日志，以 JSON 行写入 db/log.jsonl
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Level  string    `json:"level"`
+	Module string    `json:"module"`
+	RuleID string    `json:"ruleId,omitempty"`
+	Msg    string    `json:"msg"`
+}
+
+// logFilePath 结构化日志文件
+var logFilePath = filepath.Join(".", "db", "log.jsonl")
+
+// logOutput 日志文件，写入时加锁保证每行完整
+var logOutput = struct {
+	sync.Mutex
+	w io.Writer
+}{w: os.Stderr}
+
+// Logger 带模块与规则ID的日志记录器
+type Logger struct {
+	module string
+	ruleID string
+}
+
+// newLogger 创建模块的日志记录器
+func newLogger(module string) *Logger {
+	return &Logger{module: module}
+}
+
+// WithRule 返回附带规则ID的记录器，ruleID 为空时返回自身
+func (l *Logger) WithRule(ruleID string) *Logger {
+	if ruleID == "" {
+		return l
+	}
+	return &Logger{module: l.module, ruleID: ruleID}
+}
+
+// Debugf、Infof、Warnf、Errorf 按对应级别记录日志
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(LevelDebug, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf(LevelInfo, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.logf(LevelWarn, format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(LevelError, format, args...) }
+
+func (l *Logger) logf(level, format string, args ...interface{}) {
+	writeLogEntry(LogEntry{
+		Time:   time.Now(),
+		Level:  level,
+		Module: l.module,
+		RuleID: l.ruleID,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+// minLogLevel 当前最低记录级别：-debug 时为 debug，其次为 -log-level、设置中的级别
+func minLogLevel() string {
+	if *debugMode {
+		return LevelDebug
+	}
+	if level := currentSettings().LogLevel; level != "" && !flagGiven("log-level") {
+		return level
+	}
+	if _, ok := logLevelRank[*logLevel]; ok {
+		return *logLevel
+	}
+	return LevelInfo
+}
+
+// levelAtLeast 判断 level 是否不低于 min
+func levelAtLeast(level, min string) bool {
+	return logLevelRank[level] >= logLevelRank[min]
+}
+
+// writeLogEntry 写入日志文件并推送给实时日志订阅者
+func writeLogEntry(entry LogEntry) {
+	if !levelAtLeast(entry.Level, minLogLevel()) {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	logOutput.Lock()
+	logOutput.w.Write(append(data, '\n'))
+	logOutput.Unlock()
+
+	logHub.publish(entry)
+}
+
+// stdLogWriter 接收标准库 log 的输出（需开启 log.Lshortfile），
+// 把 "file.go:12: message" 转换为结构化日志，模块取源文件名，级别按消息推断
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		module, msg := "main", line
+		if file, rest, ok := strings.Cut(line, ": "); ok && strings.Contains(file, ".go:") {
+			module = file[:strings.Index(file, ".go:")]
+			msg = rest
+		}
+		writeLogEntry(LogEntry{
+			Time:   time.Now(),
+			Level:  inferLogLevel(msg),
+			Module: module,
+			Msg:    msg,
+		})
+	}
+	return len(p), nil
+}
+
+// inferLogLevel 按消息开头推断未显式指定级别的日志
+func inferLogLevel(msg string) string {
+	lower := strings.ToLower(msg)
+	for _, prefix := range []string{"failed", "error", "invalid", "cannot"} {
+		if strings.HasPrefix(lower, prefix) {
+			return LevelError
+		}
+	}
+	for _, prefix := range []string{"warning", "temporary", "rejected", "refused", "blocked"} {
+		if strings.HasPrefix(lower, prefix) {
+			return LevelWarn
+		}
+	}
+	if strings.Contains(lower, " failed") || strings.Contains(lower, "timed out") {
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// LogFilter 日志筛选条件
+type LogFilter struct {
+	Level  string // 最低级别，为空时不限
+	RuleID string
+	Module string
+}
+
+// match 判断日志是否满足筛选条件
+func (f LogFilter) match(entry LogEntry) bool {
+	if f.Level != "" && !levelAtLeast(entry.Level, f.Level) {
+		return false
+	}
+	if f.RuleID != "" && entry.RuleID != f.RuleID {
+		return false
+	}
+	return f.Module == "" || entry.Module == f.Module
+}
+
+// readLogEntries 读取日志文件中满足条件的日志，按时间顺序
+func readLogEntries(r io.Reader, filter LogFilter) ([]LogEntry, error) {
+	var entries []LogEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if filter.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
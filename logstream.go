@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	logStreamTail      = 200              // 连接时先发送的历史条数
+	logStreamTailBytes = 256 << 10        // 读取历史日志时最多读取文件末尾的字节数
+	logStreamBuffer    = 256              // 每个订阅者缓存的条数，满了丢弃
+	logStreamHeartbeat = 15 * time.Second // 保活间隔，避免代理断开空闲连接
+)
+
+// logHub 把每条日志分发给 /api/logStream 的订阅者
+var logHub = &logBroadcaster{subscribers: make(map[chan LogEntry]LogFilter)}
+
+// logBroadcaster 日志广播
+type logBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan LogEntry]LogFilter
+}
+
+// publish 分发一条日志；订阅者跟不上时丢弃，不阻塞日志写入
+func (b *logBroadcaster) publish(entry LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch, filter := range b.subscribers {
+		if !filter.match(entry) {
+			continue
+		}
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// subscribe 订阅满足条件的新日志，返回的函数取消订阅
+func (b *logBroadcaster) subscribe(filter LogFilter) (chan LogEntry, func()) {
+	ch := make(chan LogEntry, logStreamBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = filter
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// tailLogEntries 读取日志文件末尾满足条件的最后 n 条，只读取文件末尾部分
+func tailLogEntries(n int, filter LogFilter) ([]LogEntry, error) {
+	f, err := os.Open(logFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - logStreamTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	// 从中间开始读取时第一行可能不完整，解析失败会被跳过
+	entries, err := readLogEntries(io.NewSectionReader(f, offset, info.Size()-offset), filter)
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, err
+}
+
+// logFilterFromQuery 从请求参数读取筛选条件：level（最低级别）、rule、module
+func logFilterFromQuery(r *http.Request) LogFilter {
+	q := r.URL.Query()
+	filter := LogFilter{RuleID: q.Get("rule"), Module: q.Get("module")}
+	if _, ok := logLevelRank[q.Get("level")]; ok {
+		filter.Level = q.Get("level")
+	}
+	return filter
+}
+
+// writeSSEEntry 以一个 SSE 事件发送一条日志
+func writeSSEEntry(w io.Writer, entry LogEntry) {
+	data, _ := json.Marshal(entry)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// apiLogStream 以 Server-Sent Events 推送日志：先发送最近的日志，再实时推送新日志。
+// 支持与 /api/getLog 相同的 level、rule、module 筛选，?tail= 指定历史条数
+func apiLogStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := logFilterFromQuery(r)
+	tail := logStreamTail
+	if v := r.URL.Query().Get("tail"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			tail = n
+		}
+	}
+
+	// 先订阅再读取历史，避免两者之间写入的日志丢失（可能重复一条，可以接受）
+	entries, unsubscribe := logHub.subscribe(filter)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if tail > 0 {
+		history, err := tailLogEntries(tail, filter)
+		if err != nil {
+			log.Printf("Failed to read log file: %v", err)
+		}
+		for _, entry := range history {
+			writeSSEEntry(w, entry)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case entry := <-entries:
+			writeSSEEntry(w, entry)
+			// 把已经到达的日志一起发送
+			for more := true; more; {
+				select {
+				case entry = <-entries:
+					writeSSEEntry(w, entry)
+				default:
+					more = false
+				}
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+const (
+	defaultLogPageSize = 200
+	maxLogPageSize     = 1000
+)
+
+// apiGetLog 分页查询日志。参数：level（最低级别）、rule（规则ID）、module，
+// offset 为跳过的最新条数，limit 为每页条数；返回的 entries 按时间顺序
+func apiGetLog(w http.ResponseWriter, r *http.Request) {
+	filter := logFilterFromQuery(r)
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultLogPageSize
+	}
+	if limit > maxLogPageSize {
+		limit = maxLogPageSize
+	}
+
+	f, err := os.Open(logFilePath)
+	if err != nil {
+		log.Printf("Failed to read log file: %v", err)
+		http.Error(w, "Failed to read log file", http.StatusInternalServerError)
+		return
+	}
+	entries, err := readLogEntries(f, filter)
+	f.Close()
+	if err != nil {
+		log.Printf("Failed to read log file: %v", err)
+	}
+
+	// 从最新的一条往前分页
+	total := len(entries)
+	end := total - offset
+	if end < 0 {
+		end = 0
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	page := entries[start:end]
+	if page == nil {
+		page = []LogEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": page,
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"hasMore": start > 0,
+	})
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"image/png"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -12,39 +14,153 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
 	"github.com/google/uuid"
 	"github.com/skip2/go-qrcode"
 )
 
 var (
-	debugMode = flag.Bool("debug", false, "Enable debug mode")
-	forwarder *Forwarder
+	debugMode = flag.Bool("debug", false, "Enable debug mode (same as -log-level debug)")
+	logLevel  = flag.String("log-level", LevelInfo, "Minimum level written to db/log.jsonl: debug, info, warn or error")
+	accessLog = flag.Bool("access-log", false, "Log every forwarded connection with the client's resolved hostname")
+
+	// MQTT 状态发布
+	mqttBroker   = flag.String("mqtt-broker", "", "MQTT broker address (host:port), empty to disable")
+	mqttTopic    = flag.String("mqtt-topic", "goports", "MQTT topic prefix")
+	mqttUsername = flag.String("mqtt-username", "", "MQTT username")
+	mqttPassword = flag.String("mqtt-password", "", "MQTT password")
+	mqttInterval = flag.Duration("mqtt-interval", 10*time.Second, "MQTT publish interval")
+
+	// SNMP 代理
+	snmpListen    = flag.String("snmp-listen", "", "SNMP agent listen address (e.g. :161), empty to disable")
+	snmpCommunity = flag.String("snmp-community", "", "SNMP read community, required with -snmp-listen")
+	snmpBaseOID   = flag.String("snmp-oid", snmpDefaultBaseOID, "OID the SNMP rule table is published under, e.g. your own enterprise OID (1.3.6.1.4.1.<PEN>)")
+
+	// 中继节点（链式转发）
+	relayListen = flag.String("relay-listen", "", "Accept chained forwards from other go-ports instances on this address (e.g. :7000), empty to disable")
+	relayToken  = flag.String("relay-token", "", "Token other instances must present to relay through this node, defaults to $GOPORTS_RELAY_TOKEN")
+
+	// 代理模式与中心实例
+	agentController     = flag.String("agent-controller", "", "Base URL of a central instance to report to and take rule commands from (e.g. https://central:8080), empty to disable agent mode")
+	agentToken          = flag.String("agent-token", "", "Token of the central instance (its -controller-token), defaults to $GOPORTS_AGENT_TOKEN")
+	agentName           = flag.String("agent-name", "", "Name this agent reports under (default the hostname)")
+	agentInterval       = flag.Duration("agent-interval", 10*time.Second, "How often the agent reports to the central instance")
+	controllerTokenFlag = flag.String("controller-token", "", "Token agents must present to report to this instance, defaults to $GOPORTS_CONTROLLER_TOKEN; empty disables agent management")
+
+	// Prometheus 指标
+	metricsPublic = flag.Bool("metrics-public", false, "Serve /metrics without the API token, basic auth or login so Prometheus can scrape it unauthenticated (it exposes rule names, listen addresses and targets)")
+
+	// StatsD 指标
+	statsdAddr     = flag.String("statsd-addr", "", "StatsD server address (host:port), empty to disable")
+	statsdPrefix   = flag.String("statsd-prefix", "goports", "StatsD metric name prefix")
+	statsdTags     = flag.Bool("statsd-tags", false, "Emit DogStatsD-style tags instead of encoding them in metric names")
+	statsdInterval = flag.Duration("statsd-interval", 10*time.Second, "StatsD flush interval")
+
+	// OpenTelemetry 连接追踪
+	otlpEndpoint    = flag.String("otlp-endpoint", "", "OTLP/HTTP collector endpoint (e.g. http://localhost:4318), empty to disable")
+	otlpServiceName = flag.String("otlp-service-name", "go-ports", "service.name reported in exported traces")
+
+	// 公网地址检测（二维码）
+	publicIPURL = flag.String("public-ip-url", "", "Echo service that returns this machine's public IP as plain text (e.g. https://api.ipify.org), empty to use STUN")
+	stunServer  = flag.String("stun-server", "stun.l.google.com:19302", "STUN server used to detect the public IP when -public-ip-url is empty")
+
+	// 通知渠道
+	notifyWebhook      = flag.String("notify-webhook", "", "Webhook URL that receives notifications as JSON")
+	notifyEvents       = flag.String("notify-events", "", "Comma-separated notification events to send (e.g. forward.*,health.down), empty for all")
+	notifySMTP         = flag.String("notify-smtp", "", "SMTP server (host:port) used to send notification emails, empty to disable email")
+	notifySMTPUser     = flag.String("notify-smtp-user", "", "SMTP username (PLAIN auth), empty to send without authentication")
+	notifySMTPPassword = flag.String("notify-smtp-password", "", "SMTP password")
+	notifyEmailFrom    = flag.String("notify-email-from", "", "Sender address of notification emails, defaults to -notify-smtp-user")
+	notifyEmailTo      = flag.String("notify-email-to", "", "Comma-separated recipients of notification emails")
+
+	// GeoIP 数据库（MaxMind .mmdb）
+	geoipDB    = flag.String("geoip-db", "", "MaxMind country/city database (.mmdb) used to annotate clients with their country")
+	geoipASNDB = flag.String("geoip-asn-db", "", "MaxMind ASN database (.mmdb) used to annotate clients with their ASN")
+
+	// data.json 保留的备份个数
+	maxBackups = flag.Int("backups", 10, "Number of timestamped data.json backups kept in db/backups (0 disables backups)")
+
+	// 启动时恢复上次运行的转发
+	restoreRunning = flag.Bool("restore", true, "Restart the forwards that were running when the program last exited")
+
+	// 监听意外退出后自动重新监听
+	listenerRestart         = flag.Bool("listener-restart", true, "Re-bind listeners that fail unexpectedly, with exponential backoff")
+	listenerRestartMaxDelay = flag.Duration("listener-restart-max-delay", time.Minute, "Maximum backoff between attempts to re-bind a failed listener")
+	listenerRestartAttempts = flag.Int("listener-restart-attempts", 0, "Stop a forward after this many failed attempts to re-bind its listener, 0 to keep retrying")
+
+	// 定期检查转发的监听套接字是否仍然有效
+	reconcileInterval = flag.Duration("reconcile-interval", 30*time.Second, "How often to verify that every running forward's socket is still bound, removing stale forwards (0 to disable)")
+
+	// 检测网卡地址的变化
+	netWatchInterval = flag.Duration("net-watch-interval", 5*time.Second, "How often to check network interfaces for added or removed addresses (0 to disable)")
+
+	// 停止转发时的排空宽限期
+	drainGrace = flag.Duration("drain-grace", 30*time.Second, "Default grace period for draining TCP forwards before force-closing connections")
+
+	// 收到 SIGINT/SIGTERM 后等待连接结束的时间
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight TCP sessions on SIGINT/SIGTERM before force-closing them")
+
+	// 进程级资源保护
+	maxGoroutines  = flag.Int64("max-goroutines", 0, "Refuse new connections while the process has at least this many goroutines, 0 for no limit")
+	maxConnections = flag.Int64("max-connections", 0, "Maximum concurrent connections across all forwards, 0 for no limit")
+	maxMemoryMB    = flag.Uint64("max-memory-mb", 0, "Refuse new connections while estimated process memory exceeds this many MB, 0 for no limit")
+
+	// 全局带宽限制
+	bandwidthLimit = flag.Int64("bandwidth-limit", 0, "Global bandwidth limit shared by all forwards in KB/s, 0 for unlimited")
+
+	// 管理界面登录
+	uiPassword = flag.String("ui-password", "", "Password required to sign in to the management UI, empty to disable login")
+	uiAllow    = flag.String("ui-allow", "", "Comma-separated IPs/CIDRs allowed to reach the management UI/API (loopback always allowed), empty to allow all (default \"settings.uiAllow\" in db/data.json)")
+
+	// REST API 认证
+	apiToken     = flag.String("api-token", "", "Token required on every /api/ request (X-API-Token or Authorization: Bearer), defaults to $GOPORTS_API_TOKEN")
+	apiBasicAuth = flag.String("api-basic-auth", "", "user:password required via HTTP basic auth on the UI and API, defaults to $GOPORTS_API_BASIC_AUTH")
+
+	// 管理界面监听地址
+	uiListen = flag.String("listen", "", "Address the web UI/API listens on, e.g. 127.0.0.1 (default all interfaces, or \"settings.uiListen\" in db/data.json)")
+	uiPort   = flag.Int("port", 0, "Port the web UI/API listens on (default \"settings.uiPort\" in db/data.json, else the first free port from 8080)")
+
+	// 无界面模式与命令行子命令
+	headless = flag.Bool("headless", false, "Run only the forwarder and REST API, without the web UI or WebView2 check")
+	uiDir    = flag.String("ui-dir", "", "Serve the web UI from this directory instead of the built-in files (index.html and static/)")
+	apiAddr  = flag.String("api", "http://127.0.0.1:8080", "Base URL of the running instance used by command-line subcommands")
+	cliTOTP  = flag.String("totp", "", "Current TOTP code used by command-line subcommands to sign in when the instance has two-factor login enabled")
+
+	// 反向代理与跨域访问
+	basePathFlag    = flag.String("base-path", "", "Path prefix the UI is mounted under by a reverse proxy that does not strip it, e.g. /goports")
+	corsOriginsFlag = flag.String("cors-origins", "", "Comma-separated origins allowed to call the API from other sites (e.g. https://dash.example.com), * for any origin without credentials (token only), empty to disable CORS")
+
+	// 系统托盘图标
+	showTray = flag.Bool("tray", false, "Show a system tray icon with quick actions: open UI, start/stop all forwards, switch template, quit. Windows only: on macOS and Linux the flag is ignored with a warning, use the web UI instead")
+
+	// 系统服务
+	workDir     = flag.String("workdir", "", "Directory holding db/ (default the current directory; set by install-service)")
+	serviceMode = flag.Bool("service", false, "Report status to the Windows service manager (set by install-service)")
+
+	forwarder *forward.Forwarder
 	storage   *Storage
-	rules     []Rule
-	templates []Template
+	ruleStore *RuleStore
 )
 
-func init() {
-	// 初始化日志
-	initLogger()
-
-	// 创建必要的目录
-	createDirs()
-}
-
 func initLogger() {
-	// 设置日志文件路径为db目录下的log.txt
-	logFile, err := os.OpenFile(filepath.Join(".", "db", "log.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// 标准库 log 的输出转换为结构化日志，模块取自源文件名
+	log.SetOutput(stdLogWriter{})
+	log.SetFlags(log.Lshortfile)
+
+	// 设置日志文件路径为db目录下的log.jsonl，每行一条 JSON
+	logFile, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Printf("Failed to open log file: %v", err)
 		return
 	}
-
-	// 设置日志输出
-	log.SetOutput(logFile)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	logOutput.Lock()
+	logOutput.w = logFile
+	logOutput.Unlock()
 }
 
 func createDirs() {
@@ -56,24 +172,181 @@ func createDirs() {
 }
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), cliUsage, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	// 服务的工作目录不是安装目录，先切换到数据目录
+	if *workDir != "" {
+		if err := os.Chdir(*workDir); err != nil {
+			fmt.Println("Error: invalid -workdir:", err)
+			os.Exit(1)
+		}
+	}
+
+	// 创建必要的目录
+	createDirs()
+
+	// 初始化日志
+	initLogger()
+
+	// 安装、启动、停止或卸载系统服务
+	if flag.NArg() > 0 {
+		if code, ok := runServiceCommand(flag.Args()); ok {
+			os.Exit(code)
+		}
+	}
+
+	// 带子命令时作为客户端操作正在运行的实例
+	if flag.NArg() > 0 {
+		os.Exit(runCLI(flag.Args()))
+	}
+
+	// 作为 Windows 服务运行时向服务管理器报告状态
+	if *serviceMode {
+		if err := loadServiceEnv(); err != nil {
+			log.Printf("Failed to load %s: %v", serviceEnvFile, err)
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if err := runAsService(); err != nil {
+			log.Printf("Failed to run as service: %v", err)
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
 	log.Println("Starting port forwarder...")
 
 	// 初始化 forwarder 和 storage
-	forwarder = NewForwarder()
-	storage = NewStorage()
+	forwarder = newForwarder()
+	storage = newStorage()
+	ruleStore = store.NewRuleStore(storage)
+	ruleStore.Resolve = resolvedRule // 按当前环境展开目标中的变量后比较
+
+	// 加载程序设置（界面端口、日志级别、缓冲区大小等）
+	loadSettings()
+
+	// 管理端来源IP白名单，-ui-allow 优先于设置
+	if err := loadManagementAllowlist(); err != nil {
+		log.Printf("Invalid management allowlist: %v", err)
+		fmt.Println("Error: invalid management allowlist (-ui-allow or settings.uiAllow):", err)
+		os.Exit(1)
+	}
 
-	// 检查 WebView2 运行时
-	if err := checkWebView2(); err != nil {
+	// 反向代理路径前缀与 CORS
+	if err := loadProxySettings(); err != nil {
+		log.Printf("Invalid proxy settings: %v", err)
+		fmt.Println("Error: invalid proxy settings:", err)
+		os.Exit(1)
+	}
+
+	// 通知渠道
+	if err := loadNotifySettings(); err != nil {
+		log.Printf("Invalid notification settings: %v", err)
+		fmt.Println("Error: invalid notification settings:", err)
+		os.Exit(1)
+	}
+
+	// REST API 认证
+	if err := loadAPIAuth(); err != nil {
+		log.Printf("Invalid API auth settings: %v", err)
+		fmt.Println("Error: invalid API auth settings:", err)
+		os.Exit(1)
+	}
+	if apiAuthEnabled() {
+		log.Printf("API authentication enabled (token: %v, basic: %v)", apiAuth.token != "", apiAuth.user != "")
+	}
+
+	// 检查 WebView2 运行时（无界面模式不需要）
+	if *headless {
+		log.Println("Running headless: web UI disabled")
+	} else if err := checkWebView2(); err != nil {
 		log.Printf("WebView2 check failed: %v", err)
 		fmt.Println("Error: WebView2 runtime not found. Please install WebView2 runtime.")
 		os.Exit(1)
 	}
 
+	// 加载规则的事件历史
+	loadRuleEvents()
+
 	// 加载配置
 	loadConfig()
 
+	// 启动 MQTT 状态发布
+	startMQTTPublisher()
+
+	// 启动 SNMP 代理
+	startSNMPAgent()
+
+	// 作为中继节点接受链式转发
+	startRelayNode()
+
+	// 代理模式：向中心实例报告并执行下发的命令
+	startAgent()
+
+	// 启动 StatsD 指标发送
+	startStatsDEmitter()
+
+	// 启动连接追踪导出
+	startTraceExporter()
+
+	// 启动告警评估
+	startAlertEngine()
+
+	// 启动目标看门狗
+	startWatchdog()
+	startHealthChecks()
+
+	// 启动流量异常检测
+	startAnomalyDetector()
+	startStatsHistory()
+
+	// 无流量自动停止
+	startAutoStop()
+
+	// 移除监听套接字已失效的转发
+	startForwardReconciler()
+
+	// 检测网卡地址的变化，地址恢复后重新监听
+	startNetWatch()
+
+	// 路由器端口映射（UPnP/NAT-PMP）
+	startPortMapper()
+
+	// 加载 GeoIP 数据库
+	loadGeoIP()
+
+	// 加载登录设置
+	loadAuth()
+
+	// 解析规则的访问控制列表
+	loadRuleACLs()
+
+	// 加载并定期刷新IP黑名单
+	loadBlocklists()
+	startBlocklistRefresher()
+
+	// 优雅退出
+	handleShutdownSignals()
+
+	// 自动开启标记了 autoStart 的规则与默认模板（放在黑名单加载之后，避免启动初期放行被拦截的来源）
+	if autoStartRulesEnabled() {
+		startAutoStartRules()
+	}
+	startDefaultTemplate()
+
+	// 恢复上次退出时正在运行的转发，之后持续记录运行状态
+	if restoreRunningEnabled() {
+		restoreRunningState()
+	}
+	startRunningStatePersister()
+
+	// 按时间窗口开关定时规则（放在自动开启与恢复之后，窗口外的定时协议会被停止）
+	startSchedules()
+
 	// 初始化 GUI
 	initGUI()
 }
@@ -93,2016 +366,56 @@ func loadConfig() {
 	// 加载配置逻辑
 	log.Println("Loading configuration...")
 
-	// 加载规则
-	var err error
-	rules, err = storage.LoadRules()
-	if err != nil {
+	// 加载规则与模板
+	if err := ruleStore.Load(); err != nil {
 		log.Printf("Failed to load rules: %v", err)
-		rules = []Rule{}
-	}
-
-	// 加载模板
-	templates, err = storage.LoadTemplates()
-	if err != nil {
-		log.Printf("Failed to load templates: %v", err)
-		templates = []Template{}
 	}
 }
 
 func initGUI() {
 	// 注册HTTP处理函数
-	http.HandleFunc("/", serveHTML)
-	http.HandleFunc("/api/getLocalIPs", apiGetLocalIPs)
-	http.HandleFunc("/api/getRules", apiGetRules)
-	http.HandleFunc("/api/getTemplates", apiGetTemplates)
-	http.HandleFunc("/api/addRule", apiAddRule)
-	http.HandleFunc("/api/deleteRules", apiDeleteRules)
-	http.HandleFunc("/api/updateRule", apiUpdateRule)
-	http.HandleFunc("/api/saveAsTemplate", apiSaveAsTemplate)
-	http.HandleFunc("/api/applyTemplate", apiApplyTemplate)
-	http.HandleFunc("/api/startTCPForward", apiStartTCPForward)
-	http.HandleFunc("/api/stopTCPForward", apiStopTCPForward)
-	http.HandleFunc("/api/startUDPForward", apiStartUDPForward)
-	http.HandleFunc("/api/stopUDPForward", apiStopUDPForward)
-	http.HandleFunc("/api/isTCPRunning", apiIsTCPRunning)
-	http.HandleFunc("/api/isUDPRunning", apiIsUDPRunning)
-	http.HandleFunc("/api/startTemplateForward", apiStartTemplateForward)
-	http.HandleFunc("/api/stopTemplateForward", apiStopTemplateForward)
-	http.HandleFunc("/api/getQRCode", apiGetQRCode)
-	http.HandleFunc("/api/deleteTemplate", apiDeleteTemplate)
-	http.HandleFunc("/api/updateTemplate", apiUpdateTemplate)
-	http.HandleFunc("/api/getLog", apiGetLog)
+	if !*headless {
+		if *uiDir != "" {
+			log.Printf("Serving web UI from %s", *uiDir)
+		}
+		http.HandleFunc("/", serveHTML)
+		http.HandleFunc("/login", serveLogin)
+	}
+	registerAPIRoutes()
+	http.HandleFunc(metricsPath, apiMetrics)
+	http.HandleFunc(agentReportPath, serveAgentReport)
 
 	// 启动HTTP服务器
-	port := 8080
-	for {
-		log.Printf("Starting HTTP server on port %d...", port)
-		log.Printf("Please open http://localhost:%d in your browser", port)
-
-		// 在终端中显示端口信息
-		fmt.Printf("Starting HTTP server on port %d...\n", port)
-		fmt.Printf("Please open http://localhost:%d in your browser\n", port)
-
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
-			log.Printf("Failed to start HTTP server on port %d: %v", port, err)
-			fmt.Printf("Failed to start HTTP server on port %d: %v\n", port, err)
-			// 端口被占用，尝试下一个端口
-			port++
-			continue
-		}
-		break
+	listener, err := listenUI()
+	if err != nil {
+		log.Printf("Failed to start HTTP server: %v", err)
+		fmt.Println("Error: failed to start HTTP server:", err)
+		os.Exit(1)
 	}
-}
+	url := uiURL(listener.Addr())
+	log.Printf("HTTP server listening on %s", listener.Addr())
+	fmt.Printf("HTTP server listening on %s\n", listener.Addr())
 
-func getHTMLContent() string {
-	return `
-<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Port Forwarder</title>
-    <style>
-        * {
-            margin: 0;
-            padding: 0;
-            box-sizing: border-box;
-        }
-
-        body {
-            font-family: Arial, sans-serif;
-            background-color: #f5f5f5;
-            color: #333;
-        }
-
-        .container {
-            max-width: 1200px;
-            margin: 20px auto;
-            padding: 20px;
-            background-color: white;
-            border-radius: 8px;
-            box-shadow: 0 0 10px rgba(0, 0, 0, 0.1);
-        }
-
-        h1 {
-            text-align: center;
-            margin-bottom: 20px;
-            color: #2c3e50;
-        }
-
-        .header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 20px;
-            padding-bottom: 10px;
-            border-bottom: 1px solid #e0e0e0;
-            flex-wrap: wrap;
-            gap: 10px;
-        }
-
-        .header > div {
-            display: flex;
-            gap: 10px;
-            flex-wrap: wrap;
-            align-items: center;
-        }
-
-        .btn {
-            padding: 8px 16px;
-            border: none;
-            border-radius: 4px;
-            cursor: pointer;
-            font-size: 14px;
-            transition: background-color 0.3s;
-        }
-
-        .btn-primary {
-            background-color: #3498db;
-            color: white;
-        }
-
-        .btn-primary:hover {
-            background-color: #2980b9;
-        }
-
-        .btn-danger {
-            background-color: #e74c3c;
-            color: white;
-        }
-
-        .btn-danger:hover {
-            background-color: #c0392b;
-        }
-
-        .btn-success {
-            background-color: #27ae60;
-            color: white;
-        }
-
-        .btn-success:hover {
-            background-color: #219a52;
-        }
-
-        .btn-warning {
-            background-color: #f39c12;
-            color: white;
-        }
-
-        .btn-warning:hover {
-            background-color: #e67e22;
-        }
-
-        .rules-list {
-            margin-bottom: 20px;
-        }
-
-        .rule-item {
-            display: flex;
-            align-items: center;
-            padding: 15px;
-            margin-bottom: 10px;
-            background-color: #f9f9f9;
-            border-radius: 4px;
-            border: 1px solid #e0e0e0;
-        }
-
-        .rule-item:hover {
-            background-color: #f0f0f0;
-        }
-
-        .rule-checkbox {
-            margin-right: 15px;
-        }
-
-        .rule-config {
-            flex: 1;
-            display: grid;
-            grid-template-columns: 200px 100px 200px 100px;
-            gap: 10px;
-        }
-
-        .rule-config select,
-        .rule-config input {
-            padding: 6px 10px;
-            border: 1px solid #ddd;
-            border-radius: 4px;
-            font-size: 14px;
-        }
-
-        .rule-actions {
-            margin-left: 15px;
-            display: flex;
-            gap: 10px;
-        }
-
-        .rules-header {
-            padding: 10px 15px;
-            margin-bottom: 10px;
-            background-color: #f0f0f0;
-            border-radius: 4px;
-            border: 1px solid #e0e0e0;
-        }
-
-        .rules-header .rule-config {
-            font-weight: bold;
-        }
-
-        .rule-seq {
-            width: 50px;
-            text-align: center;
-            font-weight: bold;
-            margin-right: 10px;
-        }
-
-        .template-section {
-            margin-top: 0px;
-            padding-top: 0px;
-            border-bottom: 0px solid #e0e0e0;
-        }
-
-        .template-header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 15px;
-        }
-
-        .template-actions {
-            display: flex;
-            gap: 10px;
-            flex-wrap: wrap;
-            align-items: center;
-        }
-
-        @media (max-width: 800px) {
-            .template-actions {
-                flex-direction: column;
-            }
-            .template-actions .btn {
-                width: 100%;
-            }
-        }
-
-        .template-select {
-            padding: 6px 10px;
-            border: 1px solid #ddd;
-            border-radius: 4px;
-            font-size: 14px;
-        }
-
-        .template-list {
-            margin-top: 20px;
-            padding: 15px;
-            background-color: #f9f9f9;
-            border-radius: 8px;
-            border: 1px solid #e0e0e0;
-        }
-
-        .template-item {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            padding: 10px;
-            margin-bottom: 8px;
-            background-color: white;
-            border-radius: 4px;
-            border: 1px solid #e0e0e0;
-        }
-
-        .template-item:hover {
-            background-color: #f0f0f0;
-        }
-
-        .template-info {
-            flex: 1;
-        }
-
-        .template-name {
-            font-weight: bold;
-            margin-bottom: 5px;
-        }
-
-        .template-rules-count {
-            color: #666;
-            font-size: 14px;
-        }
-
-        .template-actions {
-            display: flex;
-            gap: 10px;
-        }
-
-        .status-message {
-            position: fixed;
-            top: 20px;
-            right: 20px;
-            padding: 12px 20px;
-            border-radius: 4px;
-            font-size: 14px;
-            box-shadow: 0 2px 10px rgba(0, 0, 0, 0.2);
-            z-index: 10000;
-            animation: slideInRight 0.3s ease-out;
-        }
-
-        @keyframes slideInRight {
-            from {
-                transform: translateX(100%);
-                opacity: 0;
-            }
-            to {
-                transform: translateX(0);
-                opacity: 1;
-            }
-        }
-
-        .status-success {
-            background-color: #d4edda;
-            color: #155724;
-            border: 1px solid #c3e6cb;
-        }
-
-        .status-error {
-            background-color: #f8d7da;
-            color: #721c24;
-            border: 1px solid #f5c6cb;
-        }
-
-        .status-info {
-            background-color: #d1ecf1;
-            color: #0c5460;
-            border: 1px solid #bee5eb;
-        }
-
-        .log-section {
-            margin-top: 30px;
-            padding-top: 20px;
-            border-top: 1px solid #e0e0e0;
-        }
-
-        .log-section h3 {
-            margin-bottom: 10px;
-            color: #2c3e50;
-        }
-
-        .log-content {
-            background-color: #f9f9f9;
-            border: 1px solid #e0e0e0;
-            border-radius: 4px;
-            padding: 15px;
-            height: 200px;
-            overflow-y: auto;
-            font-family: monospace;
-            font-size: 12px;
-            line-height: 1.4;
-            white-space: pre-wrap;
-        }
-
-        .log-content p {
-            margin: 0 0 5px 0;
-            color: #333;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>端口转发工具</h1>
-
-        <div class="header">
-            <div>
-                <button class="btn btn-primary" onclick="loadRules()">首页</button>
-                <button class="btn btn-primary" onclick="addRule()">新增规则</button>
-                <button class="btn btn-danger" onclick="deleteSelectedRules()">删除选中规则</button>
-                <button class="btn btn-success" onclick="saveAsTemplate()">保存为模板</button>
-                <button class="btn btn-warning" onclick="addToExistingTemplate()">加入已有模板</button>
-                <button class="btn btn-warning" onclick="createNewTemplate()">新建模板</button>
-            </div>
-        </div>
-
-        <div class="template-section">
-            <div class="template-header">
-          
-                    <select class="template-select" id="templateSelect">
-                        <option value="">选择模板</option>
-                    </select>
-                    <button class="btn btn-primary" onclick="applyTemplate()">切换到模板</button>
-                    <button class="btn btn-success" onclick="startTemplateForward()">一键开启此模板所有转发</button>
-                    <button class="btn btn-danger" onclick="stopTemplateForward()">一键关闭此模板所有转发</button>
-                    <button class="btn btn-danger" onclick="deleteTemplate()">删除此模板</button>
-                    <button class="btn btn-info" onclick="editTemplate()">编辑模板</button>
-           
-            </div>
-           
-        </div>
-   
-
-        <div class="rules-header">
-            <div style="display: flex; align-items: center;">
-                <div class="rule-seq"><strong>序号</strong></div>
-                <div class="rule-config">
-                    <div><strong>监听IP</strong></div>
-                    <div><strong>监听端口</strong></div>
-                    <div><strong>目标IP</strong></div>
-                    <div><strong>目标端口</strong></div>
-                </div>
-            </div>
-        </div>
-
-
-        <div class="rules-list" id="rulesList">
-            <!-- 规则列表将通过 JavaScript 动态生成 -->
-        </div>
-      
-
-        
-
-        <div class="status-message" id="statusMessage" style="display: none;"></div>
-
-        <div class="log-section">
-            <h3>运行日志</h3>
-            <div class="log-content" id="logContent">
-                <p>加载日志中...</p>
-            </div>
-        </div>
-    </div>
-
-    <script>
-        // 初始化数据
-        let rules = [];
-        let templates = [];
-
-        // 页面加载完成后初始化
-        // window.onload = function() {
-        //     initApp();
-        // };
-
-        // 初始化应用
-        function initApp() {
-            // 获取本地网卡IP地址
-            getLocalIPs();
-            
-            // 加载规则
-            loadRules();
-            
-            // 加载模板
-            loadTemplates();
-        }
-
-        // 获取本地网卡IP地址
-        function getLocalIPs() {
-            fetch('/api/getLocalIPs')
-                .then(response => response.json())
-                .then(ips => {
-                    console.log('Local IPs:', ips);
-                    // 存储IP地址供后续使用
-                    window.localIPs = ips;
-                })
-                .catch(error => {
-                    console.error('Failed to get local IPs:', error);
-                });
-        }
-
-        // 加载规则
-        function loadRules() {
-            fetch('/api/getRules')
-                .then(response => response.json())
-        .then(data => {
-                    // 倒序显示规则列表
-                    rules = data.slice().reverse();
-                    renderRules();
-                })
-                .catch(error => {
-                    console.error('Failed to load rules:', error);
-                });
-        }
-
-        // 加载模板
-        function loadTemplates() {
-            fetch('/api/getTemplates')
-                .then(response => response.json())
-                .then(data => {
-                    templates = data;
-                    renderTemplates();
-                })
-                .catch(error => {
-                    console.error('Failed to load templates:', error);
-                });
-        }
-
-       // 渲染规则列表（倒序）
-function renderRules(){
-    const list = document.getElementById('rulesList');
-    list.innerHTML = '';
-
-    if(rules.length === 0){
-        list.innerHTML = '<p style="text-align:center;color:#999;padding:20px">暂无规则，请点击“新增规则”按钮添加</p>';
-        return;
-    }
-
-    /* 倒序遍历，同步插壳保证顺序 */
-    for(let i = rules.length - 1; i >= 0; i--){
-        const r = rules[i];
-
-        const item = document.createElement('div');
-        item.className = 'rule-item';
-        item.dataset.id = r.id;
-
-        /* 用字符串拼接代替 ${}，避开 Go 模板冲突 */
-        item.innerHTML =
-            '<input type="checkbox" class="rule-checkbox" data-id="'+ r.id +'">'+
-            '<div style="display:flex;align-items:center">'+
-              '<div class="rule-seq">'+ r.seq +'</div>'+
-              '<div class="rule-config">'+
-                '<select class="listen-addr" data-id="'+ r.id +'">'+ renderIPOptions(r.listenAddr) +'</select>'+
-                '<input type="number" class="listen-port" data-id="'+ r.id +'" value="'+ r.listenPort +'" min="1" max="65535">'+
-                '<select class="target-addr" data-id="'+ r.id +'">'+ renderTargetIPOptions(r.targetAddr) +'</select>'+
-                '<input type="number" class="target-port" data-id="'+ r.id +'" value="'+ r.targetPort +'" min="1" max="65535">'+
-              '</div>'+
-            '</div>'+
-            '<div class="rule-actions">'+
-              '<button class="btn btn-default" data-role="tcpBtn">检测中…</button>'+
-              '<button class="btn btn-default" data-role="udpBtn">检测中…</button>'+
-              '<button class="btn btn-danger"  onclick="deleteRule(\''+ r.id +'\')">删除</button>'+
-              '<button class="btn btn-primary" onclick="copyRule('+ i +')">复制</button>'+
-              '<button class="btn btn-warning" onclick="showQRCode(\''+ r.listenAddr +'\','+ r.listenPort +')">二维码</button>'+
-            '</div>';
-
-        list.appendChild(item);          // 顺序固定
-        addRuleEventListeners(item, r.id); // 你原来的绑定函数
-
-        /* 异步只改按钮 */
-        Promise.all([
-            fetch('/api/isTCPRunning?listenAddr='+ r.listenAddr +'&listenPort='+ r.listenPort).then(res=>res.json()),
-            fetch('/api/isUDPRunning?listenAddr='+ r.listenAddr +'&listenPort='+ r.listenPort).then(res=>res.json())
-        ]).then(function(res){
-            const tcpBtn = item.querySelector('[data-role=tcpBtn]');
-            const udpBtn = item.querySelector('[data-role=udpBtn]');
-
-            tcpBtn.className   = res[0].running ? 'btn btn-danger' : 'btn btn-success';
-            tcpBtn.textContent = res[0].running ? '停止TCP转发' : '开启TCP转发';
-            tcpBtn.onclick     = function(){ toggleTCPForward(i); };
-
-            udpBtn.className   = res[1].running ? 'btn btn-danger' : 'btn btn-success';
-            udpBtn.textContent = res[1].running ? '停止UDP转发' : '开启UDP转发';
-            udpBtn.onclick     = function(){ toggleUDPForward(i); };
-        });
-    }
-}
-        // 渲染IP选项
-        function renderIPOptions(selectedAddr) {
-            let options = '<option value="">选择监听地址</option>';
-            if (window.localIPs) {
-                window.localIPs.forEach(function(ipInfo) {
-                    const selected = ipInfo.ip === selectedAddr ? 'selected' : '';
-                    options += '<option value="' + ipInfo.ip + '" ' + selected + '>' + ipInfo.ip + ' (' + ipInfo.name + ')</option>';
-                });
-            } else {
-                options += '<option value="">正在加载网卡信息...</option>';
-                // 尝试获取本地网卡IP地址
-                if (!window.isGettingIPs) {
-                    window.isGettingIPs = true;
-                    fetch('/api/getLocalIPs')
-                        .then(response => response.json())
-                        .then(ips => {
-                            console.log('Local IPs:', ips);
-                            // 存储IP地址供后续使用
-                            window.localIPs = ips;
-                            // 重新渲染规则
-                            loadRules();
-                        })
-                        .catch(error => {
-                            console.error('Failed to get local IPs:', error);
-                        })
-                        .finally(() => {
-                            window.isGettingIPs = false;
-                        });
-                }
-            }
-            // 检查是否是自定义IP
-            const isCustom = selectedAddr && (!window.localIPs || !window.localIPs.some(function(ipInfo) { return ipInfo.ip === selectedAddr; }));
-            if (isCustom) {
-                options += '<option value="' + selectedAddr + '" selected>' + selectedAddr + '</option>';
-            }
-            return options;
-        }
-
-        // 添加规则事件监听器
-        function addRuleEventListeners(ruleItem, ruleId) {
-            // 监听地址变化
-            const listenAddrSelect = ruleItem.querySelector('.listen-addr[data-id="' + ruleId + '"]');
-            if (listenAddrSelect) {
-                listenAddrSelect.addEventListener('change', function() {
-                    updateRule(ruleId);
-                });
-            }
-
-            // 监听端口变化
-            const listenPortInput = ruleItem.querySelector('.listen-port[data-id="' + ruleId + '"]');
-            if (listenPortInput) {
-                listenPortInput.addEventListener('change', function() {
-                    updateRule(ruleId);
-                });
-            }
-
-            // 目标地址变化
-            const targetAddrSelect = ruleItem.querySelector('.target-addr[data-id="' + ruleId + '"]');
-            if (targetAddrSelect) {
-                targetAddrSelect.addEventListener('change', function() {
-                    if (this.value === 'custom') {
-                        // 创建自定义输入框
-                        const customInput = document.createElement('input');
-                        customInput.type = 'text';
-                        customInput.className = 'target-addr-custom';
-                        customInput.placeholder = '请输入自定义IP地址';
-                        customInput.style.padding = '6px 10px';
-                        customInput.style.border = '1px solid #ddd';
-                        customInput.style.borderRadius = '4px';
-                        customInput.style.fontSize = '14px';
-
-                        // 替换选择框为输入框
-                        const parent = this.parentElement;
-                        parent.replaceChild(customInput, this);
-
-                        // 聚焦到输入框
-                        customInput.focus();
-
-                        // 监听输入框变化
-                        customInput.addEventListener('change', function() {
-                            if (this.value) {
-                                // 更新规则
-                                const ruleItem = this.closest('.rule-item');
-                                const listenAddr = ruleItem.querySelector('.listen-addr').value;
-                                const listenPort = ruleItem.querySelector('.listen-port').value;
-                                const targetPort = ruleItem.querySelector('.target-port').value;
-
-                                fetch('/api/updateRule', {
-                                    method: 'POST',
-                                    headers: {
-                                        'Content-Type': 'application/json'
-                                    },
-                                    body: JSON.stringify({
-                                        id: ruleId,
-                                        listenAddr: listenAddr,
-                                        listenPort: listenPort,
-                                        targetAddr: this.value,
-                                        targetPort: targetPort
-                                    })
-                                })
-                                .then(response => response.json())
-                                .then(data => {
-                                    if (data.success) {
-                                        loadRules();
-                                    }
-                                });
-                            } else {
-                                // 如果输入框为空，恢复选择框
-                                parent.replaceChild(targetAddrSelect, this);
-                            }
-                        });
-                    } else {
-                        updateRule(ruleId);
-                    }
-                });
-            }
-
-            // 目标端口变化
-            const targetPortInput = ruleItem.querySelector('.target-port[data-id="' + ruleId + '"]');
-            if (targetPortInput) {
-                targetPortInput.addEventListener('change', function() {
-                    updateRule(ruleId);
-                });
-            }
-        }
-
-        // 更新规则
-        function updateRule(ruleId) {
-            const ruleItem = document.querySelector('.rule-item[data-id="' + ruleId + '"]');
-            if (!ruleItem) {
-                console.error('Rule item not found for id:', ruleId);
-                return;
-            }
-            const listenAddr = ruleItem.querySelector('.listen-addr').value;
-            const listenPort = ruleItem.querySelector('.listen-port').value;
-            const targetAddr = ruleItem.querySelector('.target-addr') ? ruleItem.querySelector('.target-addr').value : ruleItem.querySelector('.target-addr-custom').value;
-            const targetPort = ruleItem.querySelector('.target-port').value;
-
-            fetch('/api/updateRule', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({
-                    id: ruleId,
-                    listenAddr: listenAddr,
-                    listenPort: listenPort,
-                    targetAddr: targetAddr,
-                    targetPort: targetPort
-                })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    loadRules();
-                }
-            })
-            .catch(error => {
-                console.error('Failed to update rule:', error);
-            });
-        }
-
-        // 渲染模板列表
-        function renderTemplates() {
-            const templateSelect = document.getElementById('templateSelect');
-            templateSelect.innerHTML = '';
-
-            // 添加默认选择项
-            const defaultOption = document.createElement('option');
-            defaultOption.value = '';
-            defaultOption.textContent = '选择模板';
-            templateSelect.appendChild(defaultOption);
-
-            // 添加模板选项
-            templates.forEach(template => {
-                const option = document.createElement('option');
-                option.value = template.name;
-                option.textContent = template.name;
-                templateSelect.appendChild(option);
-            });
-
-            // 渲染模板列表
-            renderTemplatesList();
-        }
-
-        // 渲染模板列表
-        function renderTemplatesList() {
-            const templateList = document.getElementById('templateList');
-            templateList.innerHTML = '';
-
-            if (templates.length === 0) {
-                templateList.innerHTML = '<p style="text-align: center; color: #999; padding: 20px;">暂无模板，请点击"保存为模板"按钮创建</p>';
-                return;
-            }
-
-            templates.forEach(template => {
-                const templateItem = document.createElement('div');
-                templateItem.className = 'template-item';
-                templateItem.innerHTML = '<div class="template-info">' +
-                    '<div class="template-name">' + template.name + '</div>' +
-                    '<div class="template-rules-count">规则数量: ' + template.rules.length + '</div>' +
-                    '<div class="template-sign" style="font-size:12px; color:#666; margin-top:4px;">创建时间: ' + (template.CreatedAt || '') + '</div>' +
-                    '</div>' +
-                    '<div class="template-actions">' +
-                    '<button class="btn btn-primary" onclick="applyTemplateByName(\'' + template.name + '\')">切到模板</button>' +
-                    '<button class="btn btn-success" onclick="startTemplateForwardByName(\'' + template.name + '\')">开启转发</button>' +
-                    '<button class="btn btn-danger" onclick="stopTemplateForwardByName(\'' + template.name + '\')">关闭转发</button>' +
-                    '<button class="btn btn-info" onclick="editTemplateByName(\'' + template.name + '\')">编辑</button>' +
-                    '<button class="btn btn-danger" onclick="deleteTemplateByName(\'' + template.name + '\')">删除</button>' +
-                    '</div>';
-                templateList.appendChild(templateItem);
-            });
-        }
-
-        // 按名称应用模板
-        function applyTemplateByName(templateName) {
-            const templateSelect = document.getElementById('templateSelect');
-            templateSelect.value = templateName;
-            applyTemplate();
-        }
-
-        // 按名称开启模板转发
-        function startTemplateForwardByName(templateName) {
-            const templateSelect = document.getElementById('templateSelect');
-            templateSelect.value = templateName;
-            startTemplateForward();
-        }
-
-        // 按名称关闭模板转发
-        function stopTemplateForwardByName(templateName) {
-            const templateSelect = document.getElementById('templateSelect');
-            templateSelect.value = templateName;
-            stopTemplateForward();
-        }
-
-        // 按名称编辑模板
-        function editTemplateByName(templateName) {
-            const templateSelect = document.getElementById('templateSelect');
-            templateSelect.value = templateName;
-            editTemplate();
-        }
-
-        // 按名称删除模板
-        function deleteTemplateByName(templateName) {
-            const templateSelect = document.getElementById('templateSelect');
-            templateSelect.value = templateName;
-            deleteTemplate();
-        }
-
-        // 编辑模板
-        function editTemplate() {
-            const templateSelect = document.getElementById('templateSelect');
-            const templateName = templateSelect.value;
-            if (!templateName) {
-                showMessage('请先选择要编辑的模板', 'info');
-                return;
-            }
-
-            // 创建编辑模板的对话框
-            const overlay = document.createElement('div');
-            overlay.style.position = 'fixed';
-            overlay.style.top = '0';
-            overlay.style.left = '0';
-            overlay.style.width = '100%';
-            overlay.style.height = '100%';
-            overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
-            overlay.style.zIndex = '999';
-
-            const dialog = document.createElement('div');
-            dialog.style.position = 'fixed';
-            dialog.style.top = '50%';
-            dialog.style.left = '50%';
-            dialog.style.transform = 'translate(-50%, -50%)';
-            dialog.style.backgroundColor = 'white';
-            dialog.style.padding = '20px';
-            dialog.style.borderRadius = '8px';
-            dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
-            dialog.style.zIndex = '1000';
-            dialog.style.minWidth = '300px';
-
-            dialog.innerHTML = '<h3 style="margin-top: 0;">编辑模板</h3>' +
-                '<p>请输入新的模板名称：</p>' +
-                '<div style="padding: 10px; margin: 15px 0;">' +
-                '<input type="text" id="newTemplateName" value="' + templateName + '" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
-                '</div>' +
-                '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
-                '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
-                '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
-                '</div>';
-
-            document.body.appendChild(overlay);
-            document.body.appendChild(dialog);
-
-            document.getElementById('cancelBtn').addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            document.getElementById('confirmBtn').addEventListener('click', function() {
-                const newTemplateName = document.getElementById('newTemplateName').value.trim();
-                if (newTemplateName !== '') {
-                    // 调用API更新模板名称
-                    fetch('/api/updateTemplate', {
-                        method: 'POST',
-                        headers: {
-                            'Content-Type': 'application/json'
-                        },
-                        body: JSON.stringify({
-                            oldName: templateName,
-                            newName: newTemplateName
-                        })
-                    })
-                    .then(response => response.json())
-                    .then(data => {
-                        if (data.success) {
-                            loadTemplates();
-                            showMessage('模板编辑成功', 'success');
-                        }
-                    })
-                    .catch(error => {
-                        console.error('Failed to edit template:', error);
-                        showMessage('模板编辑失败', 'error');
-                    });
-                }
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            overlay.addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-        }
-
-        // 加入已有模板
-        function addToExistingTemplate() {
-            const selectedCheckboxes = document.querySelectorAll('.rule-checkbox:checked');
-            if (selectedCheckboxes.length === 0) {
-                showMessage('请先选择要加入模板的规则', 'info');
-                return;
-            }
-
-            if (templates.length === 0) {
-                showMessage('暂无模板，请先创建模板', 'info');
-                return;
-            }
-
-            // 生成模板选择选项
-            let templateList = '';
-            templates.forEach((template, index) => {
-                templateList += (index + 1) + '. ' + template.name + '\n';
-            });
-
-            // 让用户输入模板编号
-            const templateIndex = prompt('请选择要加入的模板编号：\n' + templateList);
-            if (templateIndex) {
-                const index = parseInt(templateIndex) - 1;
-                if (index >= 0 && index < templates.length) {
-                    const templateName = templates[index].name;
-                    const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
-                    
-                    // 调用API将规则加入已有模板
-                    fetch('/api/saveAsTemplate', {
-                        method: 'POST',
-                        headers: {
-                            'Content-Type': 'application/json'
-                        },
-                        body: JSON.stringify({
-                            name: templateName,
-                            ids: selectedIds
-                        })
-                    })
-                    .then(response => response.json())
-                    .then(data => {
-                        if (data.success) {
-                            loadTemplates();
-                            showMessage('规则已成功加入模板', 'success');
-                        }
-                    })
-                    .catch(error => {
-                        console.error('Failed to add to existing template:', error);
-                        showMessage('加入模板失败', 'error');
-                    });
-                } else {
-                    showMessage('无效的模板编号', 'error');
-                }
-            }
-        }
-
-        // 创建模板选择对话框
-        function createTemplateSelectDialog(selectedCheckboxes) {
-            // 创建遮罩层
-            const overlay = document.createElement('div');
-            overlay.style.position = 'fixed';
-            overlay.style.top = '0';
-            overlay.style.left = '0';
-            overlay.style.width = '100%';
-            overlay.style.height = '100%';
-            overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
-            overlay.style.zIndex = '999';
-
-            // 创建对话框
-            const dialog = document.createElement('div');
-            dialog.style.position = 'fixed';
-            dialog.style.top = '50%';
-            dialog.style.left = '50%';
-            dialog.style.transform = 'translate(-50%, -50%)';
-            dialog.style.backgroundColor = 'white';
-            dialog.style.padding = '20px';
-            dialog.style.borderRadius = '8px';
-            dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
-            dialog.style.zIndex = '1000';
-            dialog.style.minWidth = '300px';
-
-            // 创建对话框内容
-            let templateOptions = '';
-            templates.forEach(template => {
-                templateOptions += '<option value="' + template.name + '">' + template.name + '</option>';
-            });
-
-            dialog.innerHTML = '<h3 style="margin-top: 0;">加入已有模板</h3>' +
-                '<p>确定要将选中的规则加入模板吗？</p>' +
-                '<div style="padding: 10px; margin: 15px 0;">' +
-                '<label style="display: block; margin-bottom: 5px;">选择模板：</label>' +
-                '<select id="existingTemplateSelect" style="width: 100%; padding: 8px;">' +
-                templateOptions +
-                '</select>' +
-                '</div>' +
-                '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
-                '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
-                '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
-                '</div>';
-
-            // 添加到页面
-            document.body.appendChild(overlay);
-            document.body.appendChild(dialog);
-
-            // 绑定事件
-            document.getElementById('cancelBtn').addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            document.getElementById('confirmBtn').addEventListener('click', function() {
-                const templateSelect = document.getElementById('existingTemplateSelect');
-                if (templateSelect) {
-                    const templateName = templateSelect.value;
-                    if (templateName) {
-                        const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
-                        // 调用API将规则加入已有模板
-                        fetch('/api/saveAsTemplate', {
-                            method: 'POST',
-                            headers: {
-                                'Content-Type': 'application/json'
-                            },
-                            body: JSON.stringify({
-                                name: templateName,
-                                ids: selectedIds
-                            })
-                        })
-                        .then(response => response.json())
-                        .then(data => {
-                            if (data.success) {
-                                loadTemplates();
-                                showMessage('规则已成功加入模板', 'success');
-                            }
-                        })
-                        .catch(error => {
-                            console.error('Failed to add to existing template:', error);
-                            showMessage('加入模板失败', 'error');
-                        });
-                    }
-                }
-                // 关闭对话框
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            // 点击遮罩层关闭对话框
-            overlay.addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-        }
-
-        // 新建模板
-        function createNewTemplate() {
-
-            // 创建新建模板的对话框
-            const overlay = document.createElement('div');
-            overlay.style.position = 'fixed';
-            overlay.style.top = '0';
-            overlay.style.left = '0';
-            overlay.style.width = '100%';
-            overlay.style.height = '100%';
-            overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
-            overlay.style.zIndex = '999';
-
-            const dialog = document.createElement('div');
-            dialog.style.position = 'fixed';
-            dialog.style.top = '50%';
-            dialog.style.left = '50%';
-            dialog.style.transform = 'translate(-50%, -50%)';
-            dialog.style.backgroundColor = 'white';
-            dialog.style.padding = '20px';
-            dialog.style.borderRadius = '8px';
-            dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
-            dialog.style.zIndex = '1000';
-            dialog.style.minWidth = '300px';
-
-            dialog.innerHTML = '<h3 style="margin-top: 0;">新建模板</h3>' +
-                '<p>请输入模板名称：</p>' +
-                '<div style="padding: 10px; margin: 15px 0;">' +
-                '<input type="text" id="templateName" placeholder="请输入模板名称" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
-                '</div>' +
-                '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
-                '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
-                '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
-                '</div>';
-
-            document.body.appendChild(overlay);
-            document.body.appendChild(dialog);
-
-            document.getElementById('cancelBtn').addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            document.getElementById('confirmBtn').addEventListener('click', function() {
-                const templateName = document.getElementById('templateName').value.trim();
-                if (templateName !== '') {
-                    // 直接创建模板，不强制要求必须选择规则
-                    const selectedIds = Array.from(document.querySelectorAll('.rule-checkbox:checked')).map(cb => cb.dataset.id);
-                    fetch('/api/saveAsTemplate', {
-                        method: 'POST',
-                        headers: {
-                            'Content-Type': 'application/json'
-                        },
-                        body: JSON.stringify({
-                            name: templateName,
-                            ids: selectedIds
-                        })
-                    })
-                    .then(response => response.json())
-                    .then(data => {
-                        if (data.success) {
-                            loadTemplates();
-                            showMessage('模板创建成功', 'success');
-                        }
-                    })
-                    .catch(error => {
-                        console.error('Failed to create template:', error);
-                        showMessage('模板创建失败', 'error');
-                    });
-                }
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            overlay.addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-        }
-
-        // 新增规则
-        function addRule() {
-            fetch('/api/addRule', {
-                method: 'POST'
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    loadRules();
-                    showMessage('规则添加成功', 'success');
-                }
-            })
-            .catch(error => {
-                console.error('Failed to add rule:', error);
-            });
-        }
-
-        // 删除选中规则
-        function deleteSelectedRules() {
-            const selectedCheckboxes = document.querySelectorAll('.rule-checkbox:checked');
-            if (selectedCheckboxes.length === 0) {
-                showMessage('请先选择要删除的规则', 'info');
-                return;
-            }
-
-            const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
-            fetch('/api/deleteRules', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({ ids: selectedIds })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    loadRules();
-                    showMessage('规则删除成功', 'success');
-                }
-            })
-            .catch(error => {
-                console.error('Failed to delete rules:', error);
-            });
-        }
-
-        // 删除单个规则
-        function deleteRule(id) {
-            if (confirm('确定要删除此规则吗？')) {
-                fetch('/api/deleteRules', {
-                    method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json'
-                    },
-                    body: JSON.stringify({ ids: [id] })
-                })
-                .then(response => response.json())
-                .then(data => {
-                    if (data.success) {
-                        const templateSelect = document.getElementById('templateSelect');
-                        const templateName = templateSelect.value;
-                        if (templateName && templateName !== 'default') {
-                            // 当前在模板视图中，重新加载模板规则
-                            fetch('/api/getTemplates')
-                                .then(response => response.json())
-                                .then(data => {
-                                    const template = data.find(t => t.name === templateName);
-                                    if (template) {
-                                        renderTemplateRules(template);
-                                    }
-                                });
-                        } else {
-                            // 当前在所有记录视图中，加载所有规则
-                            loadRules();
-                        }
-                        showMessage('规则删除成功', 'success');
-                    }
-                })
-                .catch(error => {
-                    console.error('Failed to delete rule:', error);
-                });
-            }
-        }
-
-        // 复制规则信息
-        function copyRule(index) {
-            const rule = rules[index];
-            const info = rule.listenAddr + ':' + rule.listenPort;
-            navigator.clipboard.writeText(info)
-                .then(() => {
-                    showMessage('已复制: ' + info, 'success');
-                })
-                .catch(err => {
-                    console.error('复制失败:', err);
-                    showMessage('复制失败', 'error');
-                });
-        }
-
-        // 从模板复制规则信息
-        function copyRuleFromTemplate(index, templateName) {
-            fetch('/api/getTemplates')
-                .then(response => response.json())
-                .then(data => {
-                    const template = data.find(t => t.name === templateName);
-                    if (template) {
-                        const rule = template.rules[index];
-                        const info = rule.listenAddr + ':' + rule.listenPort;
-                        navigator.clipboard.writeText(info)
-                            .then(() => {
-                                showMessage('已复制: ' + info, 'success');
-                            })
-                            .catch(err => {
-                                console.error('复制失败:', err);
-                                showMessage('复制失败', 'error');
-                            });
-                    }
-                });
-        }
-
-        // 显示二维码
-        function showQRCode(listenAddr, listenPort) {
-            const info = listenAddr + ':' + listenPort;
-            const qrCodeUrl = '/api/getQRCode?listenAddr=' + encodeURIComponent(listenAddr) + '&listenPort=' + encodeURIComponent(listenPort);
-            
-            // 创建弹窗
-            const popupDiv = document.createElement('div');
-            popupDiv.style.position = 'fixed';
-            popupDiv.style.top = '50%';
-            popupDiv.style.left = '50%';
-            popupDiv.style.transform = 'translate(-50%, -50%)';
-            popupDiv.style.backgroundColor = 'white';
-            popupDiv.style.padding = '20px';
-            popupDiv.style.borderRadius = '8px';
-            popupDiv.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
-            popupDiv.style.zIndex = '1000';
-            popupDiv.style.textAlign = 'center';
-            
-            // 创建关闭按钮
-            const closeBtn = document.createElement('button');
-            closeBtn.textContent = '关闭';
-            closeBtn.style.position = 'absolute';
-            closeBtn.style.top = '10px';
-            closeBtn.style.right = '10px';
-            closeBtn.style.padding = '5px 10px';
-            closeBtn.style.border = 'none';
-            closeBtn.style.borderRadius = '4px';
-            closeBtn.style.backgroundColor = '#666';
-            closeBtn.style.color = 'white';
-            closeBtn.style.cursor = 'pointer';
-            closeBtn.onclick = function() {
-                document.body.removeChild(popupDiv);
-                document.body.removeChild(overlay);
-            };
-            
-            // 创建内容
-            const content = document.createElement('div');
-            content.innerHTML = '<h3>访问地址</h3><p>' + info + '</p><img src="' + qrCodeUrl + '" alt="二维码"><p style="margin-top: 10px; font-size: 12px; color: #666;">扫码访问源IP:源端口</p>';
-            
-            // 组装弹窗
-            popupDiv.appendChild(closeBtn);
-            popupDiv.appendChild(content);
-            
-            // 创建遮罩层
-            const overlay = document.createElement('div');
-            overlay.style.position = 'fixed';
-            overlay.style.top = '0';
-            overlay.style.left = '0';
-            overlay.style.width = '100%';
-            overlay.style.height = '100%';
-            overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
-            overlay.style.zIndex = '999';
-            overlay.onclick = function() {
-                document.body.removeChild(popupDiv);
-                document.body.removeChild(overlay);
-            };
-            
-            // 添加到页面
-            document.body.appendChild(overlay);
-            document.body.appendChild(popupDiv);
-        }
-
-        // 保存为模板
-        function saveAsTemplate() {
-            const selectedCheckboxes = document.querySelectorAll('.rule-checkbox:checked');
-            if (selectedCheckboxes.length === 0) {
-                showMessage('请先选择要保存为模板的规则', 'info');
-                return;
-            }
-
-            // 创建保存模板的对话框
-            const overlay = document.createElement('div');
-            overlay.style.position = 'fixed';
-            overlay.style.top = '0';
-            overlay.style.left = '0';
-            overlay.style.width = '100%';
-            overlay.style.height = '100%';
-            overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
-            overlay.style.zIndex = '999';
-
-            const dialog = document.createElement('div');
-            dialog.style.position = 'fixed';
-            dialog.style.top = '50%';
-            dialog.style.left = '50%';
-            dialog.style.transform = 'translate(-50%, -50%)';
-            dialog.style.backgroundColor = 'white';
-            dialog.style.padding = '20px';
-            dialog.style.borderRadius = '8px';
-            dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
-            dialog.style.zIndex = '1000';
-            dialog.style.minWidth = '300px';
-
-            dialog.innerHTML = '<h3 style="margin-top: 0;">保存为模板</h3>' +
-                '<p>请输入模板名称：</p>' +
-                '<div style="padding: 10px; margin: 15px 0;">' +
-                '<input type="text" id="templateName" placeholder="请输入模板名称" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
-                '</div>' +
-                '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
-                '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
-                '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
-                '</div>';
-
-            document.body.appendChild(overlay);
-            document.body.appendChild(dialog);
-
-            document.getElementById('cancelBtn').addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            document.getElementById('confirmBtn').addEventListener('click', function() {
-                const templateName = document.getElementById('templateName').value.trim();
-                if (templateName !== '') {
-                    const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
-                    fetch('/api/saveAsTemplate', {
-                        method: 'POST',
-                        headers: {
-                            'Content-Type': 'application/json'
-                        },
-                        body: JSON.stringify({
-                            name: templateName,
-                            ids: selectedIds
-                        })
-                    })
-                    .then(response => response.json())
-                    .then(data => {
-                        if (data.success) {
-                            loadTemplates();
-                            showMessage('模板保存成功', 'success');
-                        }
-                    })
-                    .catch(error => {
-                        console.error('Failed to save template:', error);
-                        showMessage('模板保存失败', 'error');
-                    });
-                }
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-
-            overlay.addEventListener('click', function() {
-                document.body.removeChild(overlay);
-                document.body.removeChild(dialog);
-            });
-        }
-
-        // 应用模板
-        function applyTemplate() {
-            const templateSelect = document.getElementById('templateSelect');
-            const templateName = templateSelect.value;
-            if (!templateName) {
-                showMessage('请先选择要应用的模板', 'info');
-                return;
-            }
-
-            // 切换到模板记录
-            fetch('/api/applyTemplate', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({ name: templateName })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    // 显示模板中的规则
-                    renderTemplateRules({ name: templateName, rules: data.rules });
-                    showMessage('已切换到模板：' + templateName, 'success');
-                }
-            })
-            .catch(error => {
-                console.error('Failed to get template:', error);
-            });
-        }
-
-        // 渲染模板规则
-        function renderTemplateRules(template) {
-            const rulesList = document.getElementById('rulesList');
-            rulesList.innerHTML = '';
-
-            if (template.rules.length === 0) {
-                rulesList.innerHTML = '<p style="text-align: center; color: #999; padding: 20px;">模板中暂无规则</p>';
-                return;
-            }
-
-            // 按照规则的seq字段倒序排序
-            const sortedRules = template.rules.sort((a, b) => {
-                return (b.seq || 0) - (a.seq || 0);
-            });
-
-            sortedRules.forEach((rule, index) => {
-                const ruleItem = document.createElement('div');
-                ruleItem.className = 'rule-item';
-                ruleItem.dataset.id = rule.id;
-
-                // 检查TCP和UDP状态
-                Promise.all([
-                    fetch('/api/isTCPRunning?listenAddr=' + rule.listenAddr + '&listenPort=' + rule.listenPort).then(r => r.json()),
-                    fetch('/api/isUDPRunning?listenAddr=' + rule.listenAddr + '&listenPort=' + rule.listenPort).then(r => r.json())
-                ]).then(function(results) {
-                    const tcpResult = results[0];
-                    const udpResult = results[1];
-                    const tcpRunning = tcpResult.running;
-                    const udpRunning = udpResult.running;
-
-                    // 确保seq字段存在
-                    const seq = rule.seq || 0;
-                    ruleItem.innerHTML = '<input type="checkbox" class="rule-checkbox" data-id="' + rule.id + '"><div style="display: flex; align-items: center;"><div class="rule-seq">' + seq + '</div><div class="rule-config"><select class="listen-addr" data-id="' + rule.id + '">' + renderIPOptions(rule.listenAddr) + '</select><input type="number" class="listen-port" data-id="' + rule.id + '" value="' + rule.listenPort + '" min="1" max="65535"><select class="target-addr" data-id="' + rule.id + '">' + renderTargetIPOptions(rule.targetAddr) + '</select><input type="number" class="target-port" data-id="' + rule.id + '" value="' + rule.targetPort + '" min="1" max="65535"></div></div><div class="rule-actions"><button class="btn ' + (tcpRunning ? 'btn-danger' : 'btn-success') + '" onclick="toggleTCPForwardFromTemplate(' + index + ', \'' + template.name + '\')">' + (tcpRunning ? '停止TCP转发' : '开启TCP转发') + '</button><button class="btn ' + (udpRunning ? 'btn-danger' : 'btn-success') + '" onclick="toggleUDPForwardFromTemplate(' + index + ', \'' + template.name + '\')">' + (udpRunning ? '停止UDP转发' : '开启UDP转发') + '</button><button class="btn btn-danger" onclick="deleteRule(\'' + rule.id + '\')">删除</button><button class="btn btn-primary" onclick="copyRuleFromTemplate(' + index + ', \'' + template.name + '\')">复制</button><button class="btn btn-warning" onclick="showQRCode(\'' + rule.listenAddr + '\', \'' + rule.listenPort + '\')">二维码</button></div>';
-
-
-                    rulesList.appendChild(ruleItem);
-
-                    // 添加事件监听器
-                    addTemplateRuleEventListeners(ruleItem, rule.id);
-                });
-            });
-        }
-
-        // 添加模板规则事件监听器
-        function addTemplateRuleEventListeners(ruleItem, ruleId) {
-            // 监听地址变化
-            const listenAddrSelect = ruleItem.querySelector('.listen-addr[data-id="' + ruleId + '"]');
-            if (listenAddrSelect) {
-                listenAddrSelect.addEventListener('change', function() {
-                    // 监听地址没有自定义选项
-                });
-            }
-
-            // 目标地址变化
-            const targetAddrSelect = ruleItem.querySelector('.target-addr[data-id="' + ruleId + '"]');
-            if (targetAddrSelect) {
-                targetAddrSelect.addEventListener('change', function() {
-                    if (this.value === 'custom') {
-                        // 创建自定义输入框
-                        const customInput = document.createElement('input');
-                        customInput.type = 'text';
-                        customInput.className = 'target-addr-custom';
-                        customInput.placeholder = '请输入自定义IP地址';
-                        customInput.style.marginLeft = '10px';
-                        customInput.style.padding = '6px 10px';
-                        customInput.style.border = '1px solid #ddd';
-                        customInput.style.borderRadius = '4px';
-                        customInput.style.fontSize = '14px';
-
-                        // 替换选择框为输入框
-                        const parent = this.parentElement;
-                        parent.replaceChild(customInput, this);
-
-                        // 聚焦到输入框
-                        customInput.focus();
-
-                        // 监听输入框变化
-                        customInput.addEventListener('change', function() {
-                            if (this.value) {
-                                // 更新规则
-                                const ruleItem = this.closest('.rule-item');
-                                const listenAddr = ruleItem.querySelector('.listen-addr').value;
-                                const listenPort = ruleItem.querySelector('.listen-port').value;
-                                const targetPort = ruleItem.querySelector('.target-port').value;
-
-                                fetch('/api/updateRule', {
-                                    method: 'POST',
-                                    headers: {
-                                        'Content-Type': 'application/json'
-                                    },
-                                    body: JSON.stringify({
-                                        id: ruleId,
-                                        listenAddr: listenAddr,
-                                        listenPort: listenPort,
-                                        targetAddr: this.value,
-                                        targetPort: targetPort
-                                    })
-                                })
-                                .then(response => response.json())
-                                .then(data => {
-                                    if (data.success) {
-                                        // 重新加载模板规则
-                                        const templateSelect = document.getElementById('templateSelect');
-                                        const templateName = templateSelect.value;
-                                        if (templateName !== 'default') {
-                                            fetch('/api/getTemplates')
-                                                .then(response => response.json())
-                                                .then(data => {
-                                                    const template = data.find(t => t.name === templateName);
-                                                    if (template) {
-                                                        renderTemplateRules(template);
-                                                    }
-                                                });
-                                        }
-                                    }
-                                });
-                            } else {
-                                // 如果输入框为空，恢复选择框
-                                parent.replaceChild(targetAddrSelect, this);
-                            }
-                        });
-                    }
-                });
-            }
-        }
-
-        // 从模板切换TCP转发
-        function toggleTCPForwardFromTemplate(index, templateName) {
-            // 通过模板名称获取模板对象
-            fetch('/api/getTemplates')
-                .then(response => response.json())
-                .then(data => {
-                    const template = data.find(t => t.name === templateName);
-                    if (template) {
-                        const rule = template.rules[index];
-
-                        // 检查当前状态
-                        fetch('/api/isTCPRunning?listenAddr=' + rule.listenAddr + '&listenPort=' + rule.listenPort)
-                            .then(function(response) { return response.json(); })
-                            .then(function(data) {
-                                if (data.running) {
-                                    // 停止TCP转发
-                                    fetch('/api/stopTCPForward', {
-                                        method: 'POST',
-                                        headers: {
-                                            'Content-Type': 'application/json'
-                                        },
-                                        body: JSON.stringify({
-                                            listenAddr: rule.listenAddr,
-                                            listenPort: rule.listenPort
-                                        })
-                                    })
-                                    .then(function(response) { return response.json(); })
-                                    .then(function(result) {
-                                        if (result.success) {
-                                            showMessage('TCP转发已停止', 'success');
-                                            const templateSelect = document.getElementById('templateSelect');
-                                            const templateName = templateSelect.value;
-                                            if (templateName !== 'default') {
-                                                fetch('/api/getTemplates')
-                                                    .then(response => response.json())
-                                                    .then(data => {
-                                                        const template = data.find(t => t.name === templateName);
-                                                        if (template) {
-                                                            renderTemplateRules(template);
-                                                        }
-                                                    });
-                                            }
-                                        } else {
-                                            showMessage('停止TCP转发失败: ' + result.error, 'error');
-                                        }
-                                    });
-                                } else {
-                                    // 启动TCP转发
-                                    fetch('/api/startTCPForward', {
-                                        method: 'POST',
-                                        headers: {
-                                            'Content-Type': 'application/json'
-                                        },
-                                        body: JSON.stringify({
-                                            listenAddr: rule.listenAddr,
-                                            listenPort: rule.listenPort,
-                                            targetAddr: rule.targetAddr,
-                                            targetPort: rule.targetPort
-                                        })
-                                    })
-                                    .then(function(response) { return response.json(); })
-                                    .then(function(result) {
-                                        if (result.success) {
-                                            showMessage('TCP转发已启动', 'success');
-                                            const templateSelect = document.getElementById('templateSelect');
-                                            const templateName = templateSelect.value;
-                                            if (templateName !== 'default') {
-                                                fetch('/api/getTemplates')
-                                                    .then(response => response.json())
-                                                    .then(data => {
-                                                        const template = data.find(t => t.name === templateName);
-                                                        if (template) {
-                                                            renderTemplateRules(template);
-                                                        }
-                                                    });
-                                            }
-                                        } else {
-                                            showMessage('启动TCP转发失败: ' + result.error, 'error');
-                                        }
-                                    });
-                                }
-                            });
-                    }
-                });
-        }
-
-        // 从模板切换UDP转发
-        function toggleUDPForwardFromTemplate(index, templateName) {
-            // 通过模板名称获取模板对象
-            fetch('/api/getTemplates')
-                .then(response => response.json())
-                .then(data => {
-                    const template = data.find(t => t.name === templateName);
-                    if (template) {
-                        const rule = template.rules[index];
-
-                        // 检查当前状态
-                        fetch('/api/isUDPRunning?listenAddr=' + rule.listenAddr + '&listenPort=' + rule.listenPort)
-                            .then(function(response) { return response.json(); })
-                            .then(function(data) {
-                                if (data.running) {
-                                    // 停止UDP转发
-                                    fetch('/api/stopUDPForward', {
-                                        method: 'POST',
-                                        headers: {
-                                            'Content-Type': 'application/json'
-                                        },
-                                        body: JSON.stringify({
-                                            listenAddr: rule.listenAddr,
-                                            listenPort: rule.listenPort
-                                        })
-                                    })
-                                    .then(function(response) { return response.json(); })
-                                    .then(function(result) {
-                                        if (result.success) {
-                                            showMessage('UDP转发已停止', 'success');
-                                            const templateSelect = document.getElementById('templateSelect');
-                                            const templateName = templateSelect.value;
-                                            if (templateName !== 'default') {
-                                                fetch('/api/getTemplates')
-                                                    .then(response => response.json())
-                                                    .then(data => {
-                                                        const template = data.find(t => t.name === templateName);
-                                                        if (template) {
-                                                            renderTemplateRules(template);
-                                                        }
-                                                    });
-                                            }
-                                        } else {
-                                            showMessage('停止UDP转发失败: ' + result.error, 'error');
-                                        }
-                                    });
-                                } else {
-                                    // 启动UDP转发
-                                    fetch('/api/startUDPForward', {
-                                        method: 'POST',
-                                        headers: {
-                                            'Content-Type': 'application/json'
-                                        },
-                                        body: JSON.stringify({
-                                            listenAddr: rule.listenAddr,
-                                            listenPort: rule.listenPort,
-                                            targetAddr: rule.targetAddr,
-                                            targetPort: rule.targetPort
-                                        })
-                                    })
-                                    .then(function(response) { return response.json(); })
-                                    .then(function(result) {
-                                        if (result.success) {
-                                            showMessage('UDP转发已启动', 'success');
-                                            const templateSelect = document.getElementById('templateSelect');
-                                            const templateName = templateSelect.value;
-                                            if (templateName !== 'default') {
-                                                fetch('/api/getTemplates')
-                                                    .then(response => response.json())
-                                                    .then(data => {
-                                                        const template = data.find(t => t.name === templateName);
-                                                        if (template) {
-                                                            renderTemplateRules(template);
-                                                        }
-                                                    });
-                                            }
-                                        } else {
-                                            showMessage('启动UDP转发失败: ' + result.error, 'error');
-                                        }
-                                    });
-                                }
-                            });
-                    }
-                });
-        }
-
-        // 渲染目标IP选项
-        function renderTargetIPOptions(selectedAddr) {
-            let options = '<option value="">选择目标IP</option>';
-            if (window.localIPs) {
-                window.localIPs.forEach(function(ipInfo) {
-                    const selected = ipInfo.ip === selectedAddr ? 'selected' : '';
-                    options += '<option value="' + ipInfo.ip + '" ' + selected + '>' + ipInfo.ip + ' (' + ipInfo.name + ')</option>';
-                });
-            }
-            // 检查是否是自定义IP
-            const isCustom = selectedAddr && (!window.localIPs || !window.localIPs.some(function(ipInfo) { return ipInfo.ip === selectedAddr; }));
-            if (isCustom) {
-                options += '<option value="' + selectedAddr + '" selected>' + selectedAddr + '</option>';
-            } else {
-                options += '<option value="custom">自定义</option>';
-            }
-            return options;
-        }
-
-        // 一键开启此模板所有转发
-        function startTemplateForward() {
-            const templateSelect = document.getElementById('templateSelect');
-            const templateName = templateSelect.value;
-            if (!templateName) {
-                showMessage('请先选择要开启的模板', 'info');
-                return;
-            }
-
-            fetch('/api/startTemplateForward', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({ name: templateName })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    if (templateName && templateName !== 'default') {
-                        // 当前在模板视图中，重新渲染模板规则以更新状态
-                        fetch('/api/getTemplates')
-                            .then(response => response.json())
-                            .then(data => {
-                                const template = data.find(t => t.name === templateName);
-                                if (template) {
-                                    renderTemplateRules(template);
-                                }
-                            });
-                    } else {
-                        // 当前在所有记录视图中，加载所有规则
-                        loadRules();
-                    }
-                    showMessage('模板转发已开启', 'success');
-                }
-            })
-            .catch(error => {
-                console.error('Failed to start template forward:', error);
-            });
-        }
-
-        // 一键关闭此模板所有转发
-        function stopTemplateForward() {
-            const templateSelect = document.getElementById('templateSelect');
-            const templateName = templateSelect.value;
-            if (!templateName) {
-                showMessage('请先选择要关闭的模板', 'info');
-                return;
-            }
-
-            fetch('/api/stopTemplateForward', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({ name: templateName })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    if (templateName && templateName !== 'default') {
-                        // 当前在模板视图中，重新渲染模板规则以更新状态
-                        fetch('/api/getTemplates')
-                            .then(response => response.json())
-                            .then(data => {
-                                const template = data.find(t => t.name === templateName);
-                                if (template) {
-                                    renderTemplateRules(template);
-                                }
-                            });
-                    } else {
-                        // 当前在所有记录视图中，加载所有规则
-                        loadRules();
-                    }
-                    showMessage('模板转发已关闭', 'success');
-                }
-            })
-            .catch(error => {
-                console.error('Failed to stop template forward:', error);
-            });
-        }
-
-        // 删除此模板
-        function deleteTemplate() {
-            const templateSelect = document.getElementById('templateSelect');
-            const templateName = templateSelect.value;
-            if (!templateName) {
-                showMessage('请先选择要删除的模板', 'info');
-                return;
-            }
-
-            if (confirm('确定要删除此模板吗？删除后将无法恢复。')) {
-                fetch('/api/deleteTemplate', {
-                    method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json'
-                    },
-                    body: JSON.stringify({ name: templateName })
-                })
-                .then(response => response.json())
-                .then(data => {
-                    if (data.success) {
-                        // 重新加载模板列表
-                        loadTemplates();
-                        // 显示所有规则
-                        loadRules();
-                        showMessage('模板删除成功', 'success');
-                    }
-                })
-                .catch(error => {
-                    console.error('Failed to delete template:', error);
-                    showMessage('模板删除失败', 'error');
-                });
-            }
-        }
-
-        // 切换TCP转发
-        function toggleTCPForward(index) {
-            const rule = rules[index];
-            
-            // 检查当前状态
-            fetch('/api/isTCPRunning?listenAddr=' + rule.listenAddr + '&listenPort=' + rule.listenPort)
-                .then(function(response) { return response.json(); })
-                .then(function(data) {
-                    if (data.running) {
-                        // 停止TCP转发
-                        fetch('/api/stopTCPForward', {
-                            method: 'POST',
-                            headers: {
-                                'Content-Type': 'application/json'
-                            },
-                            body: JSON.stringify({
-                                listenAddr: rule.listenAddr,
-                                listenPort: rule.listenPort
-                            })
-                        })
-                        .then(function(response) { return response.json(); })
-                        .then(function(result) {
-                            if (result.success) {
-                                showMessage('TCP转发已停止', 'success');
-                                loadRules();
-                            } else {
-                                showMessage('停止TCP转发失败: ' + result.error, 'error');
-                            }
-                        });
-                    } else {
-                        // 启动TCP转发
-                        fetch('/api/startTCPForward', {
-                            method: 'POST',
-                            headers: {
-                                'Content-Type': 'application/json'
-                            },
-                            body: JSON.stringify({
-                                listenAddr: rule.listenAddr,
-                                listenPort: rule.listenPort,
-                                targetAddr: rule.targetAddr,
-                                targetPort: rule.targetPort
-                            })
-                        })
-                        .then(function(response) { return response.json(); })
-                        .then(function(result) {
-                            if (result.success) {
-                                showMessage('TCP转发已启动', 'success');
-                                loadRules();
-                            } else {
-                                showMessage('启动TCP转发失败: ' + result.error, 'error');
-                            }
-                        });
-                    }
-                });
-        }
-
-        // 切换UDP转发
-        function toggleUDPForward(index) {
-            const rule = rules[index];
-            
-            // 检查当前状态
-            fetch('/api/isUDPRunning?listenAddr=' + rule.listenAddr + '&listenPort=' + rule.listenPort)
-                .then(function(response) { return response.json(); })
-                .then(function(data) {
-                    if (data.running) {
-                        // 停止UDP转发
-                        fetch('/api/stopUDPForward', {
-                            method: 'POST',
-                            headers: {
-                                'Content-Type': 'application/json'
-                            },
-                            body: JSON.stringify({
-                                listenAddr: rule.listenAddr,
-                                listenPort: rule.listenPort
-                            })
-                        })
-                        .then(function(response) { return response.json(); })
-                        .then(function(result) {
-                            if (result.success) {
-                                showMessage('UDP转发已停止', 'success');
-                                loadRules();
-                            } else {
-                                showMessage('停止UDP转发失败: ' + result.error, 'error');
-                            }
-                        });
-                    } else {
-                        // 启动UDP转发
-                        fetch('/api/startUDPForward', {
-                            method: 'POST',
-                            headers: {
-                                'Content-Type': 'application/json'
-                            },
-                            body: JSON.stringify({
-                                listenAddr: rule.listenAddr,
-                                listenPort: rule.listenPort,
-                                targetAddr: rule.targetAddr,
-                                targetPort: rule.targetPort
-                            })
-                        })
-                        .then(function(response) { return response.json(); })
-                        .then(function(result) {
-                            if (result.success) {
-                                showMessage('UDP转发已启动', 'success');
-                                loadRules();
-                            } else {
-                                showMessage('启动UDP转发失败: ' + result.error, 'error');
-                            }
-                        });
-                    }
-                });
-        }
-
-        // 显示消息
-        function showMessage(message, type) {
-            const statusMessage = document.getElementById('statusMessage');
-            statusMessage.textContent = message;
-            statusMessage.className = 'status-message status-' + type;
-            statusMessage.style.display = 'block';
-
-            // 3秒后自动隐藏
-            setTimeout(() => {
-                statusMessage.style.display = 'none';
-            }, 3000);
-        }
-
-        // 加载日志
-        function loadLog() {
-            fetch('/api/getLog')
-                .then(response => response.text())
-                .then(data => {
-                    const logContent = document.getElementById('logContent');
-                    logContent.innerHTML = '';
-                    
-                    // 按行分割日志
-                    const lines = data.split('\n');
-                    lines.forEach(line => {
-                        if (line.trim() !== '') {
-                            const p = document.createElement('p');
-                            p.textContent = line;
-                            logContent.appendChild(p);
-                        }
-                    });
-                    
-                    // 滚动到底部
-                    logContent.scrollTop = logContent.scrollHeight;
-                })
-                .catch(error => {
-                    console.error('Failed to load log:', error);
-                });
-        }
-
-        // 定期加载日志
-        setInterval(loadLog, 3000);
-
-        // 页面加载时加载日志
-        window.onload = function() {
-            initApp();
-            loadLog();
-        };
-    </script>
-</body>
-</html>
-`
+	// 在终端中显示访问地址
+	if *headless {
+		log.Printf("REST API available at %s/api/", url)
+		fmt.Printf("REST API available at %s/api/\n", url)
+	} else {
+		log.Printf("Please open %s in your browser", url)
+		fmt.Printf("Please open %s in your browser\n", url)
+	}
+
+	// 系统托盘图标，方便在关闭浏览器后找回管理界面
+	if *showTray {
+		trayURL = url
+		startTray()
+	}
+
+	if err := http.Serve(listener, stripBasePath(localizeErrors(restrictClients(allowCORS(requireAPIAuth(requireLogin(http.DefaultServeMux))))))); err != nil {
+		log.Printf("HTTP server stopped: %v", err)
+		fmt.Printf("HTTP server stopped: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 // IPInfo IP地址信息
@@ -2111,58 +424,22 @@ type IPInfo struct {
 	IP   string `json:"ip"`
 }
 
-// serveHTML 提供HTML页面
-func serveHTML(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(getHTMLContent()))
-}
-
-// apiGetLocalIPs 获取本地网卡IP地址
+// apiGetLocalIPs 获取本地网卡IP地址，开启地址变化检测时返回最近一次检测的结果
 func apiGetLocalIPs(w http.ResponseWriter, r *http.Request) {
-	var ipInfos []IPInfo
-
-	// 获取所有网络接口
-	interfaces, err := net.Interfaces()
+	ipInfos, err := localIPs()
 	if err != nil {
 		log.Printf("Failed to get network interfaces: %v", err)
 		json.NewEncoder(w).Encode([]IPInfo{})
 		return
 	}
 
-	// 遍历所有网络接口
-	for _, iface := range interfaces {
-		// 跳过禁用的接口
-		if iface.Flags&net.FlagUp == 0 {
-			continue
-		}
-
-		// 获取接口的IP地址
-		addrs, err := iface.Addrs()
-		if err != nil {
-			log.Printf("Failed to get addresses for interface %s: %v", iface.Name, err)
-			continue
-		}
-
-		// 遍历所有IP地址
-		for _, addr := range addrs {
-			// 检查是否是IPv4地址
-			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-				if ipnet.IP.To4() != nil {
-					ipInfos = append(ipInfos, IPInfo{
-						Name: iface.Name,
-						IP:   ipnet.IP.String(),
-					})
-				}
-			}
-		}
-	}
-
-	// 添加本地回环地址
-	ipInfos = append(ipInfos, IPInfo{
-		Name: "本地回环",
-		IP:   "127.0.0.1",
-	})
+	// 添加本地回环地址与所有地址
+	ipInfos = append(ipInfos,
+		IPInfo{Name: "本地回环", IP: "127.0.0.1"},
+		IPInfo{Name: "IPv6 本地回环", IP: "::1"},
+		IPInfo{Name: "所有IPv4地址", IP: "0.0.0.0"},
+		IPInfo{Name: "所有地址 IPv4+IPv6", IP: "::"},
+	)
 
 	// 返回JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -2172,23 +449,44 @@ func apiGetLocalIPs(w http.ResponseWriter, r *http.Request) {
 // apiGetRules 获取规则
 func apiGetRules(w http.ResponseWriter, r *http.Request) {
 	// 创建规则副本
-	rulesCopy := make([]Rule, len(rules))
-	copy(rulesCopy, rules)
+	rulesCopy := ruleStore.Rules()
 
-	// 按 Seq 字段降序排序副本，确保最新的在前
+	// 置顶规则在前，其余按 Seq 字段降序排序，确保最新的在前
 	sort.Slice(rulesCopy, func(i, j int) bool {
+		if rulesCopy[i].Pinned != rulesCopy[j].Pinned {
+			return rulesCopy[i].Pinned
+		}
 		return rulesCopy[i].Seq > rulesCopy[j].Seq
 	})
 
 	w.Header().Set("Content-Type", "application/json")
+
+	// public=1 时附带每条规则的公网访问地址（路由器端口映射或公网IP加监听端口）
+	if r.URL.Query().Get("public") == "1" {
+		type ruleWithPublic struct {
+			Rule
+			PublicAddr  string `json:"publicAddr,omitempty"`
+			PublicError string `json:"publicError,omitempty"`
+		}
+		list := make([]ruleWithPublic, len(rulesCopy))
+		for i, rule := range rulesCopy {
+			list[i].Rule = rule
+			if addr, err := publicAddr(rule); err != nil {
+				list[i].PublicError = err.Error()
+			} else {
+				list[i].PublicAddr = addr
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
 	json.NewEncoder(w).Encode(rulesCopy)
 }
 
 // apiGetTemplates 获取模板
 func apiGetTemplates(w http.ResponseWriter, r *http.Request) {
 	// 按创建时间降序排序，最新的模板在前
-	sorted := make([]Template, len(templates))
-	copy(sorted, templates)
+	sorted := ruleStore.Templates()
 	sort.Slice(sorted, func(i, j int) bool {
 		ti := parseCreatedAt(sorted[i].CreatedAt)
 		tj := parseCreatedAt(sorted[j].CreatedAt)
@@ -2211,6 +509,38 @@ func parseCreatedAt(s string) time.Time {
 	return t
 }
 
+// 规则名称与备注的最大长度（字符数）
+const (
+	maxRuleNameLen = 64
+	maxRuleNoteLen = 500
+)
+
+// normalizeRuleLabel 去掉名称与备注首尾空白并检查长度
+func normalizeRuleLabel(name, note string) (string, string, error) {
+	name, note = strings.TrimSpace(name), strings.TrimSpace(note)
+	if utf8.RuneCountInString(name) > maxRuleNameLen {
+		return "", "", fmt.Errorf("name must be at most %d characters", maxRuleNameLen)
+	}
+	if strings.ContainsAny(name, "\r\n") {
+		return "", "", fmt.Errorf("name must be a single line")
+	}
+	if utf8.RuneCountInString(note) > maxRuleNoteLen {
+		return "", "", fmt.Errorf("note must be at most %d characters", maxRuleNoteLen)
+	}
+	return name, note, nil
+}
+
+// addRuleRequest apiAddRule 的请求体
+type addRuleRequest struct {
+	Preset     string `json:"preset"`
+	Name       string `json:"name"`
+	Note       string `json:"note"`
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+}
+
 // apiAddRule 添加规则
 func apiAddRule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2218,52 +548,101 @@ func apiAddRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 生成唯一ID
-	id := uuid.New().String()
+	// 解析请求体（可选），支持从预设或指定地址创建规则
+	var req addRuleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
-	// 计算新规则的序号（当前最大序号+1）
-	maxSeq := 0
-	for _, rule := range rules {
-		if rule.Seq > maxSeq {
-			maxSeq = rule.Seq
+	// 查找预设
+	var preset Preset
+	if req.Preset != "" {
+		var ok bool
+		preset, ok = findPreset(req.Preset)
+		if !ok {
+			http.Error(w, "Preset not found", http.StatusNotFound)
+			return
 		}
 	}
-	seq := maxSeq + 1
 
-	// 创建新规则
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr, &req.TargetAddr)
+
+	// 解析端口（支持服务名）
+	if errs := resolveRulePorts(&req.ListenPort, &req.TargetPort); len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrorsResult(errs))
+		return
+	}
+
+	// 校验名称与备注，使用预设时默认以预设名称命名
+	name, note, err := normalizeRuleLabel(req.Name, req.Note)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if name == "" {
+		name = preset.Name
+	}
+
+	// 生成唯一ID
+	id := uuid.New().String()
+
+	// 创建新规则，序号（当前最大序号+1）由 RuleStore 分配
 	newRule := Rule{
 		ID:         id,
-		Seq:        seq,
-		ListenAddr: "",
-		ListenPort: "",
-		TargetAddr: "",
-		TargetPort: "",
+		Name:       name,
+		Note:       note,
+		ListenAddr: req.ListenAddr,
+		ListenPort: preset.Port,
+		TargetAddr: req.TargetAddr,
+		TargetPort: preset.Port,
+	}
+	if req.ListenPort != "" {
+		newRule.ListenPort = req.ListenPort
+	}
+	if req.TargetPort != "" {
+		newRule.TargetPort = req.TargetPort
 	}
 
-	// 添加到规则列表
-	rules = append(rules, newRule)
+	// 校验地址、端口、重复监听与环路
+	if errs := validateRuleFields(newRule); len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrorsResult(errs))
+		return
+	}
 
-	// 保存规则
-	if err := storage.SaveRules(rules); err != nil {
+	// 添加到规则列表并保存
+	newRule, err = ruleStore.AddRule(newRule)
+	if err != nil {
 		log.Printf("Failed to save rules: %v", err)
 	}
+	recordConfigEvent(newRule.ID, requestSource(r), "Created")
 
-	// 返回成功
+	// 返回成功，附带新规则和预设协议供前端使用
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "rule": newRule, "protocol": preset.Protocol})
 }
 
-// apiDeleteRules 删除规则
-func apiDeleteRules(w http.ResponseWriter, r *http.Request) {
+// duplicateRuleRequest apiDuplicateRule 的请求体
+type duplicateRuleRequest struct {
+	RuleID           string  `json:"ruleId"`
+	Name             *string `json:"name"`
+	PortOffset       int     `json:"portOffset"`
+	TargetPortOffset int     `json:"targetPortOffset"`
+}
+
+// apiDuplicateRule 在服务端复制规则：新ID、新序号，其余设置相同。
+// portOffset 平移监听端口，targetPortOffset 平移目标端口，name 为空时沿用原名称
+func apiDuplicateRule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// 解析请求体
-	var req struct {
-		IDs []string `json:"ids"`
-	}
+	var req duplicateRuleRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2271,50 +650,79 @@ func apiDeleteRules(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 过滤规则
-	var newRules []Rule
-	for _, rule := range rules {
-		keep := true
-		for _, id := range req.IDs {
-			if rule.ID == id {
-				keep = false
-				break
-			}
-		}
-		if keep {
-			newRules = append(newRules, rule)
+	w.Header().Set("Content-Type", "application/json")
+
+	source, ok := findRule(req.RuleID)
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	// 复制规则，运行状态不随之复制
+	newRule := store.CloneRule(source)
+	newRule.ID = uuid.New().String()
+	newRule.Running = nil
+
+	if req.Name != nil {
+		name, _, err := normalizeRuleLabel(*req.Name, "")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
 		}
+		newRule.Name = name
 	}
 
-	// 更新规则列表（不再重新计算序号）
-	rules = newRules
+	var err error
+	if newRule.ListenPort, err = forward.ShiftPort(newRule.ListenPort, req.PortOffset); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if newRule.TargetPort, err = forward.ShiftPort(newRule.TargetPort, req.TargetPortOffset); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := validateRuleFields(newRule); len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrorsResult(errs))
+		return
+	}
 
-	// 保存规则
-	if err := storage.SaveRules(rules); err != nil {
+	// 添加到规则列表并保存，序号由 RuleStore 分配
+	newRule, err = ruleStore.AddRule(newRule)
+	if err != nil {
 		log.Printf("Failed to save rules: %v", err)
 	}
+	recordConfigEvent(newRule.ID, requestSource(r), "Duplicated from rule "+req.RuleID)
 
-	// 更新所有模板，过滤掉被删除的规则ID
-	for i, template := range templates {
-		var newTemplateRules []string
-		for _, ruleID := range template.Rules {
-			keep := true
-			for _, id := range req.IDs {
-				if ruleID == id {
-					keep = false
-					break
-				}
-			}
-			if keep {
-				newTemplateRules = append(newTemplateRules, ruleID)
-			}
-		}
-		templates[i].Rules = newTemplateRules
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "rule": newRule})
+}
+
+// deleteRulesRequest apiDeleteRules 的请求体
+type deleteRulesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// apiDeleteRules 删除规则
+func apiDeleteRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	// 保存模板
-	if err := storage.SaveTemplates(templates); err != nil {
-		log.Printf("Failed to save templates: %v", err)
+	// 解析请求体
+	var req deleteRulesRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// 删除规则并从所有模板中移除（不再重新计算序号）
+	if err := ruleStore.DeleteRules(req.IDs); err != nil {
+		log.Printf("Failed to save rules: %v", err)
+	}
+	for _, id := range req.IDs {
+		recordConfigEvent(id, requestSource(r), "Deleted")
 	}
 
 	// 返回成功
@@ -2322,6 +730,20 @@ func apiDeleteRules(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
+// updateRuleRequest apiUpdateRule 的请求体
+type updateRuleRequest struct {
+	ID         string  `json:"id"`
+	Name       *string `json:"name"` // 未提供时保持不变
+	Note       *string `json:"note"` // 未提供时保持不变
+	ListenAddr string  `json:"listenAddr"`
+	ListenPort string  `json:"listenPort"`
+	TargetAddr string  `json:"targetAddr"`
+	TargetPort string  `json:"targetPort"`
+	LogJA3     *bool   `json:"logJA3"`    // 未提供时保持不变
+	Priority   *string `json:"priority"`  // 未提供时保持不变
+	AutoStart  *bool   `json:"autoStart"` // 未提供时保持不变
+}
+
 // apiUpdateRule 更新规则
 func apiUpdateRule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2330,13 +752,7 @@ func apiUpdateRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		ID         string `json:"id"`
-		ListenAddr string `json:"listenAddr"`
-		ListenPort string `json:"listenPort"`
-		TargetAddr string `json:"targetAddr"`
-		TargetPort string `json:"targetPort"`
-	}
+	var req updateRuleRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2344,26 +760,104 @@ func apiUpdateRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查找规则
-	for i, rule := range rules {
-		if rule.ID == req.ID {
-			// 更新规则
-			rules[i].ListenAddr = req.ListenAddr
-			rules[i].ListenPort = req.ListenPort
-			rules[i].TargetAddr = req.TargetAddr
-			rules[i].TargetPort = req.TargetPort
-			break
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr, &req.TargetAddr)
+
+	// 解析端口（支持服务名），回显解析后的数字端口
+	if errs := resolveRulePorts(&req.ListenPort, &req.TargetPort); len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrorsResult(errs))
+		return
+	}
+
+	// 校验名称与备注
+	if req.Name != nil || req.Note != nil {
+		var name, note string
+		if req.Name != nil {
+			name = *req.Name
+		}
+		if req.Note != nil {
+			note = *req.Note
+		}
+		name, note, err := normalizeRuleLabel(name, note)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Name, req.Note = &name, &note
+	}
+
+	// 校验共享带宽优先级
+	if req.Priority != nil {
+		switch *req.Priority {
+		case "", "high", "normal", "low":
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown priority %q, use high, normal or low", *req.Priority))
+			return
 		}
 	}
 
-	// 保存规则
-	if err := storage.SaveRules(rules); err != nil {
+	// 校验地址、端口、重复监听与环路
+	candidate := Rule{ID: req.ID, ListenAddr: req.ListenAddr, ListenPort: req.ListenPort, TargetAddr: req.TargetAddr, TargetPort: req.TargetPort}
+	if errs := validateRuleFields(candidate); len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrorsResult(errs))
+		return
+	}
+
+	// 更新并保存规则，记下变化的地址用于事件历史
+	var changes []string
+	_, err := ruleStore.UpdateRule(req.ID, func(rule *Rule) {
+		if rule.ListenAddr != req.ListenAddr || rule.ListenPort != req.ListenPort {
+			changes = append(changes, fmt.Sprintf("listen %s -> %s", net.JoinHostPort(rule.ListenAddr, rule.ListenPort), net.JoinHostPort(req.ListenAddr, req.ListenPort)))
+		}
+		// 目标变化时记住之前的目标
+		if rule.TargetAddr != req.TargetAddr || rule.TargetPort != req.TargetPort {
+			changes = append(changes, fmt.Sprintf("target %s -> %s", net.JoinHostPort(rule.TargetAddr, rule.TargetPort), net.JoinHostPort(req.TargetAddr, req.TargetPort)))
+			rememberTarget(rule, rule.TargetAddr, rule.TargetPort)
+		}
+
+		rule.ListenAddr = req.ListenAddr
+		rule.ListenPort = req.ListenPort
+		rule.TargetAddr = req.TargetAddr
+		rule.TargetPort = req.TargetPort
+		if req.LogJA3 != nil {
+			rule.LogJA3 = *req.LogJA3
+		}
+		if req.Priority != nil {
+			rule.Priority = *req.Priority
+		}
+		if req.AutoStart != nil {
+			rule.AutoStart = *req.AutoStart
+		}
+		if req.Name != nil {
+			rule.Name = *req.Name
+		}
+		if req.Note != nil {
+			rule.Note = *req.Note
+		}
+	})
+	if err != nil && !errors.Is(err, store.ErrRuleNotFound) {
 		log.Printf("Failed to save rules: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save rules")
+		return
+	}
+	if !errors.Is(err, store.ErrRuleNotFound) {
+		message := "Updated"
+		if len(changes) > 0 {
+			message += ": " + strings.Join(changes, ", ")
+		}
+		recordConfigEvent(req.ID, requestSource(r), message)
 	}
 
 	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	json.NewEncoder(w).Encode(Result{Success: true, ListenPort: req.ListenPort, TargetPort: req.TargetPort})
+}
+
+// saveAsTemplateRequest apiSaveAsTemplate 的请求体
+type saveAsTemplateRequest struct {
+	Name     string   `json:"name"`
+	IDs      []string `json:"ids"`
+	Snapshot bool     `json:"snapshot"` // 保存规则的私有副本，而不是引用全局规则
 }
 
 // apiSaveAsTemplate 保存为模板
@@ -2374,10 +868,7 @@ func apiSaveAsTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		Name string   `json:"name"`
-		IDs  []string `json:"ids"`
-	}
+	var req saveAsTemplateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2385,44 +876,47 @@ func apiSaveAsTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 检查是否已存在同名模板
-	exists := false
-	for i, template := range templates {
-		if template.Name == req.Name {
-			// 模板已存在，将新规则ID添加到模板中，避免重复
-			for _, newID := range req.IDs {
-				// 检查规则ID是否已存在于模板中
-				existsInTemplate := false
-				for _, existingID := range template.Rules {
-					if existingID == newID {
-						existsInTemplate = true
-						break
+	err := ruleStore.UpdateTemplates(func(templates []Template) ([]Template, bool) {
+		// 检查是否已存在同名模板
+		for i, template := range templates {
+			if template.Name == req.Name {
+				// 模板已存在，将新规则ID添加到模板中，避免重复
+				for _, newID := range req.IDs {
+					// 检查规则ID是否已存在于模板中
+					existsInTemplate := false
+					for _, existingID := range template.Rules {
+						if existingID == newID {
+							existsInTemplate = true
+							break
+						}
+					}
+					// 如果规则ID不存在于模板中，添加它
+					if !existsInTemplate {
+						templates[i].Rules = append(templates[i].Rules, newID)
 					}
 				}
-				// 如果规则ID不存在于模板中，添加它
-				if !existsInTemplate {
-					templates[i].Rules = append(templates[i].Rules, newID)
-				}
+				return templates, true
 			}
-			exists = true
-			break
 		}
-	}
 
-	// 如果不存在，添加新模板
-	if !exists {
+		// 如果不存在，添加新模板
 		newTemplate := Template{
 			Name:      req.Name,
 			Rules:     req.IDs,
 			CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
 		}
-		templates = append(templates, newTemplate)
-	}
-
-	// 保存模板
-	if err := storage.SaveTemplates(templates); err != nil {
+		return append(templates, newTemplate), true
+	})
+	if err != nil {
 		log.Printf("Failed to save templates: %v", err)
 	}
+	if req.Snapshot {
+		for _, id := range req.IDs {
+			if _, err := ruleStore.DetachTemplateRule(req.Name, id); err != nil && !errors.Is(err, store.ErrRuleNotFound) {
+				log.Printf("Failed to save templates: %v", err)
+			}
+		}
+	}
 
 	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
@@ -2437,9 +931,7 @@ func apiApplyTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req nameRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2447,41 +939,60 @@ func apiApplyTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查找模板
-	var template *Template
-	for i, t := range templates {
-		if t.Name == req.Name {
-			template = &templates[i]
-			break
-		}
-	}
-
-	if template == nil {
+	// 查找模板，根据模板中的规则ID列表获取对应的规则详情
+	template, ok := ruleStore.Template(req.Name)
+	if !ok {
 		log.Printf("Template %s not found", req.Name)
 		http.Error(w, "Template not found", http.StatusNotFound)
 		return
 	}
+	templateRules, _ := ruleStore.TemplateRules(req.Name)
 
-	// 根据模板中的规则ID列表获取对应的规则详情
-	var templateRules []Rule
-	for _, ruleID := range template.Rules {
-		for _, rule := range rules {
-			if rule.ID == ruleID {
-				templateRules = append(templateRules, rule)
-				break
-			}
-		}
-	}
-
-	// 返回模板规则，不添加到主规则列表
+	// 返回模板规则，不添加到主规则列表；private 为模板私有副本的ID
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "rules": templateRules})
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "rules": templateRules, "private": privateRuleIDs(template)})
+}
+
+// nameRequest 按名称指定模板或备份的请求体
+type nameRequest struct {
+	Name string `json:"name"`
+}
+
+// startTemplateRequest apiStartTemplateForward 的请求体
+type startTemplateRequest struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile,omitempty"` // 本次开启使用的环境，为空时按模板的设置
+}
+
+// forwardRequest 开启转发的请求体
+type forwardRequest struct {
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+}
+
+// listenRequest 按监听地址指定转发的请求体
+type listenRequest struct {
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+}
+
+// ruleToggleRequest 开启或关闭规则某项功能的请求体
+type ruleToggleRequest struct {
+	RuleID  string `json:"ruleId"`
+	Enabled bool   `json:"enabled"`
 }
 
 // Result 操作结果
 type Result struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success       bool   `json:"success"`
+	Error         string `json:"error,omitempty"`
+	ListenPort    string `json:"listenPort,omitempty"` // 解析后的数字端口
+	TargetPort    string `json:"targetPort,omitempty"`
+	SuggestedPort string `json:"suggestedPort,omitempty"` // 端口被占用时建议的可用端口
+
+	Fields []FieldError `json:"fields,omitempty"` // 规则校验失败的字段
 }
 
 // apiStartTCPForward 启动TCP转发
@@ -2492,12 +1003,7 @@ func apiStartTCPForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		ListenAddr string `json:"listenAddr"`
-		ListenPort string `json:"listenPort"`
-		TargetAddr string `json:"targetAddr"`
-		TargetPort string `json:"targetPort"`
-	}
+	var req forwardRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2505,18 +1011,41 @@ func apiStartTCPForward(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr, &req.TargetAddr)
+
+	// 目标中的变量按当前环境展开
+	if err := expandTargetVars(&req.TargetAddr, &req.TargetPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort, &req.TargetPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// 启动TCP转发
 	err := forwarder.StartTCPForward(req.ListenAddr, req.ListenPort, req.TargetAddr, req.TargetPort)
+	recordListenEvent(r, RuleEventStart, "tcp", req.ListenAddr, req.ListenPort, net.JoinHostPort(req.TargetAddr, req.TargetPort), err)
 	if err != nil {
 		log.Printf("Failed to start TCP forward: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Result{Success: false, Error: err.Error()})
+		writeJSON(w, startFailureStatus(err), startFailureResult(err, "tcp", req.ListenAddr, req.ListenPort))
 		return
 	}
 
 	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Result{Success: true})
+	json.NewEncoder(w).Encode(Result{Success: true, ListenPort: req.ListenPort, TargetPort: req.TargetPort})
+}
+
+// stopTCPForwardRequest apiStopTCPForward 的请求体
+type stopTCPForwardRequest struct {
+	ListenAddr   string `json:"listenAddr"`
+	ListenPort   string `json:"listenPort"`
+	Drain        bool   `json:"drain"`        // 排空模式：已有连接在宽限期内继续
+	GraceSeconds int    `json:"graceSeconds"` // 宽限期，0 使用 -drain-grace
 }
 
 // apiStopTCPForward 停止TCP转发
@@ -2527,10 +1056,7 @@ func apiStopTCPForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		ListenAddr string `json:"listenAddr"`
-		ListenPort string `json:"listenPort"`
-	}
+	var req stopTCPForwardRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2538,12 +1064,31 @@ func apiStopTCPForward(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr)
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// 停止TCP转发
-	err := forwarder.StopTCPForward(req.ListenAddr, req.ListenPort)
+	target, _ := forwarder.Target("tcp", req.ListenAddr, req.ListenPort)
+	var err error
+	if req.Drain {
+		grace := *drainGrace
+		if req.GraceSeconds > 0 {
+			grace = time.Duration(req.GraceSeconds) * time.Second
+		}
+		err = forwarder.DrainTCPForward(req.ListenAddr, req.ListenPort, grace)
+	} else {
+		err = forwarder.StopTCPForward(req.ListenAddr, req.ListenPort)
+	}
+	recordListenEvent(r, RuleEventStop, "tcp", req.ListenAddr, req.ListenPort, target, err)
 	if err != nil {
 		log.Printf("Failed to stop TCP forward: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Result{Success: false, Error: err.Error()})
+		writeError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -2560,12 +1105,7 @@ func apiStartUDPForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		ListenAddr string `json:"listenAddr"`
-		ListenPort string `json:"listenPort"`
-		TargetAddr string `json:"targetAddr"`
-		TargetPort string `json:"targetPort"`
-	}
+	var req forwardRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2573,18 +1113,33 @@ func apiStartUDPForward(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr, &req.TargetAddr)
+
+	// 目标中的变量按当前环境展开
+	if err := expandTargetVars(&req.TargetAddr, &req.TargetPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort, &req.TargetPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// 启动UDP转发
 	err := forwarder.StartUDPForward(req.ListenAddr, req.ListenPort, req.TargetAddr, req.TargetPort)
+	recordListenEvent(r, RuleEventStart, "udp", req.ListenAddr, req.ListenPort, net.JoinHostPort(req.TargetAddr, req.TargetPort), err)
 	if err != nil {
 		log.Printf("Failed to start UDP forward: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Result{Success: false, Error: err.Error()})
+		writeJSON(w, startFailureStatus(err), startFailureResult(err, "udp", req.ListenAddr, req.ListenPort))
 		return
 	}
 
 	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Result{Success: true})
+	json.NewEncoder(w).Encode(Result{Success: true, ListenPort: req.ListenPort, TargetPort: req.TargetPort})
 }
 
 // apiStopUDPForward 停止UDP转发
@@ -2595,10 +1150,7 @@ func apiStopUDPForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		ListenAddr string `json:"listenAddr"`
-		ListenPort string `json:"listenPort"`
-	}
+	var req listenRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2606,12 +1158,22 @@ func apiStopUDPForward(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr)
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// 停止UDP转发
+	target, _ := forwarder.Target("udp", req.ListenAddr, req.ListenPort)
 	err := forwarder.StopUDPForward(req.ListenAddr, req.ListenPort)
+	recordListenEvent(r, RuleEventStop, "udp", req.ListenAddr, req.ListenPort, target, err)
 	if err != nil {
 		log.Printf("Failed to stop UDP forward: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Result{Success: false, Error: err.Error()})
+		writeError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -2620,32 +1182,228 @@ func apiStopUDPForward(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Result{Success: true})
 }
 
+// runningQuery 解析查询转发状态的参数：listenAddr、listenPort 与可选的 targetAddr、targetPort，
+// 端口可以是服务名，与启动、停止转发时一样解析
+func runningQuery(r *http.Request) (Rule, error) {
+	query := r.URL.Query()
+	rule := Rule{
+		ListenAddr: query.Get("listenAddr"),
+		ListenPort: query.Get("listenPort"),
+		TargetAddr: query.Get("targetAddr"),
+		TargetPort: query.Get("targetPort"),
+	}
+	normalizeHosts(&rule.ListenAddr, &rule.TargetAddr)
+	err := resolvePorts(&rule.ListenPort, &rule.TargetPort)
+	return rule, err
+}
+
+// forwardRunningResult 查询监听地址上的转发是否运行，并返回当前绑定的目标 target。
+// 查询参数给出 targetAddr 与 targetPort 时，只有正在运行的转发目标与之一致才算运行，
+// 用于区分监听同一地址、目标不同的多条规则
+func forwardRunningResult(rule Rule, protocol string) map[string]interface{} {
+	target, running := forwarder.Target(protocol, rule.ListenAddr, rule.ListenPort)
+	if running && rule.TargetAddr != "" && rule.TargetPort != "" {
+		running = ruleOwnsForward(rule, protocol)
+	}
+	result := map[string]interface{}{"running": running}
+	if target != "" {
+		result["target"] = target
+	}
+	// 监听意外退出、正在重新监听时附带重试状态
+	if recovery, ok := forwarder.Recovery(protocol, rule.ListenAddr, rule.ListenPort); ok && running {
+		result["recovering"] = recovery
+	}
+	return result
+}
+
 // apiIsTCPRunning 检查TCP转发是否运行
 func apiIsTCPRunning(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
 	// 解析查询参数
-	listenAddr := r.URL.Query().Get("listenAddr")
-	listenPort := r.URL.Query().Get("listenPort")
+	rule, err := runningQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// 检查TCP转发是否运行
-	running := forwarder.IsTCPRunning(listenAddr, listenPort)
+	result := forwardRunningResult(rule, "tcp")
+
+	// 排空中的转发附带进度
+	if drain, ok := forwarder.DrainStatus("tcp", rule.ListenAddr, rule.ListenPort); ok {
+		result["drain"] = drain
+	}
 
 	// 返回结果
+	json.NewEncoder(w).Encode(result)
+}
+
+// apiGetDrains 获取正在排空的转发及进度
+func apiGetDrains(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forwarder.Drains())
+}
+
+// apiGetConnections 列出 TCP 与 SOCKS5 转发的活动连接，ruleId 不为空时只返回该规则的连接
+func apiGetConnections(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.URL.Query().Get("ruleId")
+
+	list := []forward.ConnInfo{}
+	for _, c := range forwarder.Connections() {
+		if rule, ok := forwardRule(c.Protocol, c.ListenAddr, c.ListenPort); ok {
+			c.RuleID = rule.ID
+		}
+		if ruleID == "" || c.RuleID == ruleID {
+			list = append(list, c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// killConnectionRequest apiKillConnection 的请求体
+type killConnectionRequest struct {
+	ID uint64 `json:"id"`
+}
+
+// apiKillConnection 强制关闭一个活动连接
+func apiKillConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req killConnectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"running": running})
+	if !forwarder.KillConnection(req.ID) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("connection %d not found", req.ID))
+		return
+	}
+	log.Printf("Killed connection %d", req.ID)
+	json.NewEncoder(w).Encode(Result{Success: true})
 }
 
 // apiIsUDPRunning 检查UDP转发是否运行
 func apiIsUDPRunning(w http.ResponseWriter, r *http.Request) {
-	// 解析查询参数
-	listenAddr := r.URL.Query().Get("listenAddr")
-	listenPort := r.URL.Query().Get("listenPort")
+	w.Header().Set("Content-Type", "application/json")
+
+	rule, err := runningQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// 检查UDP转发是否运行
-	running := forwarder.IsUDPRunning(listenAddr, listenPort)
+	json.NewEncoder(w).Encode(forwardRunningResult(rule, "udp"))
+}
 
-	// 返回结果
+// apiStartSCTPForward 启动SCTP转发
+func apiStartSCTPForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析请求体
+	var req forwardRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr, &req.TargetAddr)
+
+	// 目标中的变量按当前环境展开
+	if err := expandTargetVars(&req.TargetAddr, &req.TargetPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort, &req.TargetPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 启动SCTP转发
+	err := forwarder.StartSCTPForward(req.ListenAddr, req.ListenPort, req.TargetAddr, req.TargetPort)
+	recordListenEvent(r, RuleEventStart, "sctp", req.ListenAddr, req.ListenPort, net.JoinHostPort(req.TargetAddr, req.TargetPort), err)
+	if err != nil {
+		log.Printf("Failed to start SCTP forward: %v", err)
+		writeJSON(w, startFailureStatus(err), startFailureResult(err, "sctp", req.ListenAddr, req.ListenPort))
+		return
+	}
+
+	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"running": running})
+	json.NewEncoder(w).Encode(Result{Success: true, ListenPort: req.ListenPort, TargetPort: req.TargetPort})
+}
+
+// apiStopSCTPForward 停止SCTP转发
+func apiStopSCTPForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析请求体
+	var req listenRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// 去掉 IPv6 地址的方括号
+	normalizeHosts(&req.ListenAddr)
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 停止SCTP转发
+	target, _ := forwarder.Target("sctp", req.ListenAddr, req.ListenPort)
+	err := forwarder.StopSCTPForward(req.ListenAddr, req.ListenPort)
+	recordListenEvent(r, RuleEventStop, "sctp", req.ListenAddr, req.ListenPort, target, err)
+	if err != nil {
+		log.Printf("Failed to stop SCTP forward: %v", err)
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 返回成功
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// apiIsSCTPRunning 检查SCTP转发是否运行，同时返回当前平台是否支持SCTP
+func apiIsSCTPRunning(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rule, err := runningQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 检查SCTP转发是否运行
+	result := forwardRunningResult(rule, "sctp")
+	result["supported"] = forward.SCTPSupported
+	json.NewEncoder(w).Encode(result)
 }
 
 // apiStartTemplateForward 启动模板所有转发
@@ -2656,9 +1414,7 @@ func apiStartTemplateForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req startTemplateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2667,35 +1423,29 @@ func apiStartTemplateForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 查找模板
-	var template *Template
-	for i, t := range templates {
-		if t.Name == req.Name {
-			template = &templates[i]
-			break
-		}
-	}
-
-	if template == nil {
+	template, ok := ruleStore.Template(req.Name)
+	if !ok {
 		log.Printf("Template %s not found", req.Name)
 		http.Error(w, "Template not found", http.StatusNotFound)
 		return
 	}
+	if req.Profile != "" {
+		template.Profile = req.Profile
+	}
 
-	// 根据模板中的规则ID列表获取对应的规则详情并启动转发
-	for _, ruleID := range template.Rules {
-		for _, rule := range rules {
-			if rule.ID == ruleID {
-				// 启动TCP转发
-				forwarder.StartTCPForward(rule.ListenAddr, rule.ListenPort, rule.TargetAddr, rule.TargetPort)
-				// 启动UDP转发
-				forwarder.StartUDPForward(rule.ListenAddr, rule.ListenPort, rule.TargetAddr, rule.TargetPort)
-				break
-			}
-		}
+	// 配置了启动顺序时在后台按顺序启动，进度通过 /api/getTemplateStartup 查询
+	w.Header().Set("Content-Type", "application/json")
+	sequenced, err := startTemplateForwards(template, requestSource(r))
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if sequenced {
+		json.NewEncoder(w).Encode(map[string]bool{"success": true, "sequenced": true})
+		return
 	}
 
 	// 返回成功
-	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
@@ -2707,9 +1457,7 @@ func apiStopTemplateForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req nameRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2718,32 +1466,14 @@ func apiStopTemplateForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 查找模板
-	var template *Template
-	for i, t := range templates {
-		if t.Name == req.Name {
-			template = &templates[i]
-			break
-		}
-	}
-
-	if template == nil {
+	template, ok := ruleStore.Template(req.Name)
+	if !ok {
 		log.Printf("Template %s not found", req.Name)
 		http.Error(w, "Template not found", http.StatusNotFound)
 		return
 	}
 
-	// 根据模板中的规则ID列表获取对应的规则详情并停止转发
-	for _, ruleID := range template.Rules {
-		for _, rule := range rules {
-			if rule.ID == ruleID {
-				// 停止TCP转发
-				forwarder.StopTCPForward(rule.ListenAddr, rule.ListenPort)
-				// 停止UDP转发
-				forwarder.StopUDPForward(rule.ListenAddr, rule.ListenPort)
-				break
-			}
-		}
-	}
+	stopTemplateForwards(template, requestSource(r))
 
 	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
@@ -2761,8 +1491,32 @@ func apiGetQRCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 生成二维码数据
-	data := listenAddr + ":" + listenPort
+	// 生成二维码数据，与 /api/getShareInfo 的地址一致：规则在路由器上有端口映射时使用公网地址，
+	// 监听所有地址时使用局域网地址。public=1 时使用检测到的公网IP，方便外网用户扫码
+	rule, ok := findRuleByListen(listenAddr, listenPort)
+	if !ok {
+		rule = Rule{ListenAddr: listenAddr, ListenPort: listenPort}
+	}
+	data, err := shareEndpoint(rule, r.URL.Query().Get("public") == "1")
+	if err != nil {
+		log.Printf("Failed to detect public IP: %v", err)
+		http.Error(w, "Failed to detect public IP: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// 按规则的配置（或 scheme/path 参数）生成完整的 URL
+	var qrConfig QRCodeConfig
+	if rule.QRCode != nil {
+		qrConfig = *rule.QRCode
+	}
+	if query := r.URL.Query(); query.Has("scheme") || query.Has("path") {
+		qrConfig = QRCodeConfig{Scheme: strings.TrimSuffix(query.Get("scheme"), "://"), Path: query.Get("path")}
+	}
+	if err := qrConfig.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data = qrConfig.Content(data)
 
 	// 生成二维码
 	qr, err := qrcode.New(data, qrcode.Medium)
@@ -2785,9 +1539,7 @@ func apiDeleteTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req nameRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2800,28 +1552,39 @@ func apiDeleteTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 过滤模板
-	var newTemplates []Template
-	for _, template := range templates {
-		if template.Name != req.Name {
-			newTemplates = append(newTemplates, template)
+	// 过滤模板并保存
+	err := ruleStore.UpdateTemplates(func(templates []Template) ([]Template, bool) {
+		var newTemplates []Template
+		for _, template := range templates {
+			if template.Name != req.Name {
+				newTemplates = append(newTemplates, template)
+			}
 		}
-	}
-
-	// 更新模板列表
-	templates = newTemplates
-
-	// 保存模板
-	if err := storage.SaveTemplates(templates); err != nil {
+		return newTemplates, true
+	})
+	if err != nil {
 		log.Printf("Failed to save templates: %v", err)
 	}
+	renameDefaultTemplate(req.Name, "")
 
 	// 返回成功
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
-// apiUpdateTemplate 更新模板
+// updateTemplateRequest apiUpdateTemplate 的请求体
+type updateTemplateRequest struct {
+	OldName     string    `json:"oldName"`
+	NewName     string    `json:"newName"`     // 为空时不改名
+	Description *string   `json:"description"` // 未提供时保持不变
+	Rules       *[]string `json:"rules"`       // 未提供时保持不变
+	Add         []string  `json:"add"`
+	Remove      []string  `json:"remove"`
+	Profile     *string   `json:"profile"` // 开启前切换到的环境，未提供时保持不变，为空时使用当前环境
+}
+
+// apiUpdateTemplate 更新模板：名称、描述与规则。rules 为完整的有序规则ID列表，
+// 也可用 add/remove 增删规则；未提供的字段保持不变
 func apiUpdateTemplate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -2829,10 +1592,7 @@ func apiUpdateTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析请求体
-	var req struct {
-		OldName string `json:"oldName"`
-		NewName string `json:"newName"`
-	}
+	var req updateTemplateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode request body: %v", err)
@@ -2840,51 +1600,118 @@ func apiUpdateTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.OldName == "" || req.NewName == "" {
-		http.Error(w, "Both old and new template names are required", http.StatusBadRequest)
+	req.NewName = strings.TrimSpace(req.NewName)
+	if req.OldName == "" {
+		http.Error(w, "Template name is required", http.StatusBadRequest)
 		return
 	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if err := validateTemplateDescription(description); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Description = &description
+	}
+	if req.Profile != nil && *req.Profile != "" {
+		if _, ok := currentSettings().FindProfile(*req.Profile); !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("profile %s not found", *req.Profile))
+			return
+		}
+	}
+
+	// 全局规则ID，在 UpdateTemplates 持有锁之前读取
+	global := make(map[string]bool)
+	for _, rule := range ruleStore.Rules() {
+		global[rule.ID] = true
+	}
 
 	// 查找并更新模板
-	updated := false
-	for i, template := range templates {
-		if template.Name == req.OldName {
-			// 更新模板名称
-			templates[i].Name = req.NewName
-			updated = true
-			break
+	found := false
+	var updateErr error
+	err := ruleStore.UpdateTemplates(func(templates []Template) ([]Template, bool) {
+		index := -1
+		for i, template := range templates {
+			if template.Name == req.OldName {
+				index = i
+			}
+		}
+		if index < 0 {
+			return templates, false
+		}
+		found = true
+
+		updated := store.CloneTemplate(templates[index])
+		if req.NewName != "" && req.NewName != req.OldName {
+			for _, template := range templates {
+				if template.Name == req.NewName {
+					updateErr = fmt.Errorf("template %s already exists", req.NewName)
+					return templates, false
+				}
+			}
+			updated.Name = req.NewName
+		}
+		if req.Description != nil {
+			updated.Description = *req.Description
+		}
+		if req.Profile != nil {
+			updated.Profile = *req.Profile
 		}
-	}
 
-	if !updated {
+		if req.Rules != nil || len(req.Add) > 0 || len(req.Remove) > 0 {
+			// 未提供完整列表时在现有规则上增删，顺带去掉已不存在的规则
+			var ids []string
+			if req.Rules != nil {
+				ids = *req.Rules
+			} else {
+				private := make(map[string]bool)
+				for _, id := range privateRuleIDs(updated) {
+					private[id] = true
+				}
+				for _, id := range updated.Rules {
+					if global[id] || private[id] {
+						ids = append(ids, id)
+					}
+				}
+			}
+			remove := make(map[string]bool, len(req.Remove))
+			for _, id := range req.Remove {
+				remove[id] = true
+			}
+			members := make(map[string]bool)
+			var next []string
+			for _, id := range append(append([]string{}, ids...), req.Add...) {
+				if remove[id] || members[id] {
+					continue
+				}
+				members[id] = true
+				next = append(next, id)
+			}
+			if updateErr = setTemplateRules(&updated, next, global); updateErr != nil {
+				return templates, false
+			}
+		}
+
+		templates[index] = updated
+		return templates, true
+	})
+	if !found {
 		log.Printf("Template %s not found", req.OldName)
 		http.Error(w, "Template not found", http.StatusNotFound)
 		return
 	}
-
-	// 保存模板
-	if err := storage.SaveTemplates(templates); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	if updateErr != nil {
+		writeError(w, http.StatusBadRequest, updateErr.Error())
+		return
+	}
+	if err != nil {
 		log.Printf("Failed to save templates: %v", err)
 	}
+	if req.NewName != "" && req.NewName != req.OldName {
+		renameDefaultTemplate(req.OldName, req.NewName)
+	}
 
 	// 返回成功
-	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
-
-// apiGetLog 获取日志
-func apiGetLog(w http.ResponseWriter, r *http.Request) {
-	// 读取日志文件
-	logData, err := os.ReadFile(filepath.Join(".", "db", "log.txt"))
-	if err != nil {
-		log.Printf("Failed to read log file: %v", err)
-		http.Error(w, "Failed to read log file", http.StatusInternalServerError)
-		return
-	}
-
-	// 设置响应头
-	w.Header().Set("Content-Type", "text/plain")
-
-	// 返回日志内容
-	w.Write(logData)
-}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// maxConnsLimit 规则连接数上限的最大值
+const maxConnsLimit = 1000000
+
+// ruleConnCounters 每条规则当前的连接数。重启转发后仍在进行的旧连接继续计数
+var ruleConnCounters = struct {
+	sync.Mutex
+	m map[string]*atomic.Int64
+}{m: make(map[string]*atomic.Int64)}
+
+// ruleConnSlots 规则的连接数上限，未设置时返回 nil
+func ruleConnSlots(rule Rule) *forward.ConnSlots {
+	if rule.MaxConns <= 0 {
+		return nil
+	}
+	ruleConnCounters.Lock()
+	defer ruleConnCounters.Unlock()
+	active, ok := ruleConnCounters.m[rule.ID]
+	if !ok {
+		active = new(atomic.Int64)
+		ruleConnCounters.m[rule.ID] = active
+	}
+	return forward.NewConnSlots(int64(rule.MaxConns), active)
+}
+
+// validateMaxConns 校验连接数上限
+func validateMaxConns(maxConns int) error {
+	if maxConns < 0 || maxConns > maxConnsLimit {
+		return errors.New("max connections must be between 0 and 1000000")
+	}
+	return nil
+}
+
+// updateMaxConnsRequest apiUpdateMaxConns 的请求体
+type updateMaxConnsRequest struct {
+	RuleID   string `json:"ruleId"`
+	MaxConns int    `json:"maxConns"`
+}
+
+// apiUpdateMaxConns 设置规则的同时连接数上限（0 为不限制），超过上限的新连接在接受后立即关闭。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateMaxConns(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "max connections", func(req *updateMaxConnsRequest, _ Rule) (func(rule *Rule), error) {
+		if err := validateMaxConns(req.MaxConns); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.MaxConns = req.MaxConns }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// metricLabels 导出指标时附带的规则标签
+type metricLabels struct {
+	RuleID   string
+	RuleName string
+	Protocol string
+	Listen   string
+	Target   string
+}
+
+// ruleMetricLabels 生成规则在某协议下的指标标签
+func ruleMetricLabels(rule Rule, protocol string) metricLabels {
+	return metricLabels{
+		RuleID:   rule.ID,
+		RuleName: ruleDisplayName(rule),
+		Protocol: protocol,
+		Listen:   net.JoinHostPort(rule.ListenAddr, rule.ListenPort),
+		Target:   net.JoinHostPort(rule.TargetAddr, rule.TargetPort),
+	}
+}
+
+// ruleDisplayName 规则在监控中显示的名称
+func ruleDisplayName(rule Rule) string {
+	if rule.Name != "" {
+		return fmt.Sprintf("#%d %s", rule.Seq, rule.Name)
+	}
+	return fmt.Sprintf("#%d %s", rule.Seq, net.JoinHostPort(rule.ListenAddr, rule.ListenPort))
+}
+
+// prometheus 以 Prometheus 文本格式编码标签
+func (l metricLabels) prometheus() string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+	return fmt.Sprintf(`{rule_id="%s",rule_name="%s",protocol="%s",listen="%s",target="%s"}`,
+		escape(l.RuleID), escape(l.RuleName), escape(l.Protocol), escape(l.Listen), escape(l.Target))
+}
+
+// tags 以 key:value 形式输出标签，用于 StatsD
+func (l metricLabels) tags() []string {
+	return []string{
+		"rule:" + l.RuleID,
+		"rule_name:" + l.RuleName,
+		"protocol:" + l.Protocol,
+		"listen:" + l.Listen,
+		"target:" + l.Target,
+	}
+}
+
+// metricsPath Prometheus 抓取的路径。与 /api/ 一样需要令牌或用户名密码，-metrics-public 时公开
+const metricsPath = "/metrics"
+
+// apiMetrics 以 Prometheus 文本格式导出每条规则的指标
+func apiMetrics(w http.ResponseWriter, r *http.Request) {
+	snapshot := ruleStore.Rules()
+
+	type sample struct {
+		labels metricLabels
+		value  int64
+	}
+	families := []struct {
+		name, kind, help string
+		samples          []sample
+	}{
+		{"goports_forward_up", "gauge", "Whether the forward is running (1) or stopped (0).", nil},
+		{"goports_bytes_in_total", "counter", "Bytes relayed from clients to the target.", nil},
+		{"goports_bytes_out_total", "counter", "Bytes relayed from the target back to clients.", nil},
+		{"goports_connections_total", "counter", "Connections (or UDP datagrams) accepted.", nil},
+		{"goports_active_connections", "gauge", "Currently open connections.", nil},
+	}
+
+	for _, rule := range snapshot {
+		if rule.ListenPort == "" {
+			continue
+		}
+		for _, protocol := range []string{"tcp", "udp", "sctp"} {
+			labels := ruleMetricLabels(rule, protocol)
+			s, running := ruleForwardStats(rule, protocol)
+			up := int64(0)
+			if running {
+				up = 1
+			}
+			families[0].samples = append(families[0].samples, sample{labels, up})
+			if !running {
+				continue
+			}
+			families[1].samples = append(families[1].samples, sample{labels, s.BytesIn})
+			families[2].samples = append(families[2].samples, sample{labels, s.BytesOut})
+			families[3].samples = append(families[3].samples, sample{labels, s.TotalConns})
+			families[4].samples = append(families[4].samples, sample{labels, s.ActiveConns})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, s := range f.samples {
+			fmt.Fprintf(w, "%s%s %d\n", f.name, s.labels.prometheus(), s.value)
+		}
+	}
+}
+
+// apiGrafanaDashboard 下载配套的 Grafana 仪表盘 JSON
+func apiGrafanaDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="go-ports-dashboard.json"`)
+	w.Write([]byte(grafanaDashboard))
+}
+
+// grafanaDashboard 基于 /metrics 指标的 Grafana 仪表盘，导入时选择 Prometheus 数据源
+const grafanaDashboard = `{
+  "__inputs": [
+    {
+      "name": "DS_PROMETHEUS",
+      "label": "Prometheus",
+      "type": "datasource",
+      "pluginId": "prometheus",
+      "pluginName": "Prometheus"
+    }
+  ],
+  "title": "go-ports",
+  "uid": "go-ports",
+  "schemaVersion": 38,
+  "version": 1,
+  "refresh": "30s",
+  "time": { "from": "now-6h", "to": "now" },
+  "templating": {
+    "list": [
+      {
+        "name": "rule",
+        "label": "Rule",
+        "type": "query",
+        "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+        "query": "label_values(goports_forward_up, rule_name)",
+        "multi": true,
+        "includeAll": true,
+        "refresh": 2
+      },
+      {
+        "name": "protocol",
+        "label": "Protocol",
+        "type": "query",
+        "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+        "query": "label_values(goports_forward_up, protocol)",
+        "multi": true,
+        "includeAll": true,
+        "refresh": 2
+      }
+    ]
+  },
+  "panels": [
+    {
+      "id": 1,
+      "type": "stat",
+      "title": "Running forwards",
+      "gridPos": { "h": 4, "w": 6, "x": 0, "y": 0 },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "sum(goports_forward_up{rule_name=~\"$rule\",protocol=~\"$protocol\"})" }
+      ]
+    },
+    {
+      "id": 2,
+      "type": "stat",
+      "title": "Active connections",
+      "gridPos": { "h": 4, "w": 6, "x": 6, "y": 0 },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "sum(goports_active_connections{rule_name=~\"$rule\",protocol=~\"$protocol\"})" }
+      ]
+    },
+    {
+      "id": 3,
+      "type": "table",
+      "title": "Forward status",
+      "gridPos": { "h": 4, "w": 12, "x": 12, "y": 0 },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "goports_forward_up{rule_name=~\"$rule\",protocol=~\"$protocol\"}", "format": "table", "instant": true }
+      ]
+    },
+    {
+      "id": 4,
+      "type": "timeseries",
+      "title": "Throughput in (client -> target)",
+      "gridPos": { "h": 8, "w": 12, "x": 0, "y": 4 },
+      "fieldConfig": { "defaults": { "unit": "Bps" } },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "sum by (rule_name, protocol) (rate(goports_bytes_in_total{rule_name=~\"$rule\",protocol=~\"$protocol\"}[$__rate_interval]))", "legendFormat": "{{rule_name}} {{protocol}}" }
+      ]
+    },
+    {
+      "id": 5,
+      "type": "timeseries",
+      "title": "Throughput out (target -> client)",
+      "gridPos": { "h": 8, "w": 12, "x": 12, "y": 4 },
+      "fieldConfig": { "defaults": { "unit": "Bps" } },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "sum by (rule_name, protocol) (rate(goports_bytes_out_total{rule_name=~\"$rule\",protocol=~\"$protocol\"}[$__rate_interval]))", "legendFormat": "{{rule_name}} {{protocol}}" }
+      ]
+    },
+    {
+      "id": 6,
+      "type": "timeseries",
+      "title": "New connections / s",
+      "gridPos": { "h": 8, "w": 12, "x": 0, "y": 12 },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "sum by (rule_name, protocol) (rate(goports_connections_total{rule_name=~\"$rule\",protocol=~\"$protocol\"}[$__rate_interval]))", "legendFormat": "{{rule_name}} {{protocol}}" }
+      ]
+    },
+    {
+      "id": 7,
+      "type": "timeseries",
+      "title": "Active connections by rule",
+      "gridPos": { "h": 8, "w": 12, "x": 12, "y": 12 },
+      "datasource": { "type": "prometheus", "uid": "${DS_PROMETHEUS}" },
+      "targets": [
+        { "refId": "A", "expr": "sum by (rule_name, target) (goports_active_connections{rule_name=~\"$rule\",protocol=~\"$protocol\"})", "legendFormat": "{{rule_name}} -> {{target}}" }
+      ]
+    }
+  ]
+}
+`
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// managementAllowlist 允许访问管理界面/API的来源网段，为空时不限制
+var managementAllowlist atomic.Pointer[[]*net.IPNet]
+
+// parseAllowlist 解析逗号分隔的 IP/CIDR 列表
+func parseAllowlist(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// managementAllowSpec 生效的白名单：-ui-allow 显式指定时优先，否则使用设置中的 uiAllow
+func managementAllowSpec() string {
+	if flagGiven("ui-allow") {
+		return *uiAllow
+	}
+	return currentSettings().UIAllow
+}
+
+// loadManagementAllowlist 加载白名单，启动时与设置修改后调用
+func loadManagementAllowlist() error {
+	spec := managementAllowSpec()
+	nets, err := parseAllowlist(spec)
+	if err != nil {
+		return err
+	}
+	managementAllowlist.Store(&nets)
+	if len(nets) > 0 {
+		log.Printf("Management access restricted to %s (and loopback)", spec)
+	}
+	return nil
+}
+
+// allowlistContains 判断来源IP是否在白名单内，本机回环地址始终允许
+func allowlistContains(nets []*net.IPNet, ip net.IP) bool {
+	if len(nets) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP 请求的来源IP
+func requestIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// managementClientAllowed 判断来源IP是否允许访问管理界面，本机回环地址始终允许
+func managementClientAllowed(ip net.IP) bool {
+	nets := managementAllowlist.Load()
+	return nets == nil || allowlistContains(*nets, ip)
+}
+
+// restrictClients 管理端来源IP白名单中间件，与监听地址无关
+func restrictClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !managementClientAllowed(requestIP(r)) {
+			log.Printf("Rejected management request from %s: not in allowlist", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
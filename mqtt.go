@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// mqttClient 极简 MQTT 3.1.1 客户端，只支持 QoS 0 发布
+type mqttClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+// mqttConnectOptions MQTT 连接参数
+type mqttConnectOptions struct {
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	WillTopic string // 断线时由 broker 发布 "offline"
+	KeepAlive time.Duration
+}
+
+// dialMQTT 连接到 MQTT broker 并完成 CONNECT/CONNACK 握手
+func dialMQTT(opts mqttConnectOptions) (*mqttClient, error) {
+	conn, err := net.DialTimeout("tcp", opts.Broker, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// 可变报头：协议名、协议级别、连接标志、保活时间
+	flags := byte(0x02) // clean session
+	if opts.WillTopic != "" {
+		flags |= 0x04 | 0x20 // will flag + will retain
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	keepAlive := int(opts.KeepAlive / time.Second)
+
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 0x04, flags, byte(keepAlive>>8), byte(keepAlive))
+
+	// 有效载荷
+	body = appendMQTTString(body, opts.ClientID)
+	if opts.WillTopic != "" {
+		body = appendMQTTString(body, opts.WillTopic)
+		body = appendMQTTString(body, "offline")
+	}
+	if opts.Username != "" {
+		body = appendMQTTString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendMQTTString(body, opts.Password)
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// 读取 CONNACK
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(bufio.NewReader(conn), ack); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if ack[0] != 0x20 || ack[3] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT connection refused, return code %d", ack[3])
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &mqttClient{conn: conn}, nil
+}
+
+// Publish 以 QoS 0 发布消息
+func (c *mqttClient) Publish(topic string, payload []byte, retain bool) error {
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	body = append(body, payload...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(mqttPacket(header, body))
+	return err
+}
+
+// Close 发送 DISCONNECT 并关闭连接
+func (c *mqttClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.Write([]byte{0xE0, 0x00})
+	return c.conn.Close()
+}
+
+// mqttPacket 组装固定报头（含剩余长度变长编码）与报文体
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// appendMQTTString 追加带两字节长度前缀的 UTF-8 字符串
+func appendMQTTString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// ruleStatus 发布到 MQTT 的规则状态
+type ruleStatus struct {
+	ID     string `json:"id"`
+	Listen string `json:"listen"`
+	Target string `json:"target"`
+	TCP    bool   `json:"tcp"`
+	UDP    bool   `json:"udp"`
+	SCTP   bool   `json:"sctp"`
+}
+
+// ruleTraffic 发布到 MQTT 的规则流量统计
+type ruleTraffic struct {
+	TCP  *forward.StatsSnapshot `json:"tcp,omitempty"`
+	UDP  *forward.StatsSnapshot `json:"udp,omitempty"`
+	SCTP *forward.StatsSnapshot `json:"sctp,omitempty"`
+}
+
+// startMQTTPublisher 周期性把每条规则的状态与流量发布到 MQTT
+func startMQTTPublisher() {
+	if *mqttBroker == "" {
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	opts := mqttConnectOptions{
+		Broker:    *mqttBroker,
+		ClientID:  fmt.Sprintf("goports-%s-%d", hostname, os.Getpid()),
+		Username:  *mqttUsername,
+		Password:  *mqttPassword,
+		WillTopic: *mqttTopic + "/status",
+		KeepAlive: 2 * *mqttInterval,
+	}
+
+	go func() {
+		var client *mqttClient
+		ticker := time.NewTicker(*mqttInterval)
+		defer ticker.Stop()
+
+		for ; ; <-ticker.C {
+			if client == nil {
+				c, err := dialMQTT(opts)
+				if err != nil {
+					log.Printf("Failed to connect to MQTT broker %s: %v", opts.Broker, err)
+					continue
+				}
+				log.Printf("Connected to MQTT broker %s", opts.Broker)
+				client = c
+				client.Publish(opts.WillTopic, []byte("online"), true)
+			}
+
+			if err := publishRuleStates(client); err != nil {
+				log.Printf("Failed to publish to MQTT broker: %v", err)
+				client.conn.Close()
+				client = nil
+			}
+		}
+	}()
+}
+
+// publishRuleStates 发布所有规则的状态与流量
+func publishRuleStates(client *mqttClient) error {
+	snapshot := ruleStore.Rules()
+
+	var errs []error
+	for _, rule := range snapshot {
+		if rule.ListenPort == "" {
+			continue
+		}
+
+		status := ruleStatus{
+			ID:     rule.ID,
+			Listen: net.JoinHostPort(rule.ListenAddr, rule.ListenPort),
+			Target: net.JoinHostPort(rule.TargetAddr, rule.TargetPort),
+			TCP:    isRuleForwardRunning(rule, "tcp"),
+			UDP:    isRuleForwardRunning(rule, "udp"),
+			SCTP:   isRuleForwardRunning(rule, "sctp"),
+		}
+
+		var traffic ruleTraffic
+		if s, ok := ruleForwardStats(rule, "tcp"); ok {
+			traffic.TCP = &s
+		}
+		if s, ok := ruleForwardStats(rule, "udp"); ok {
+			traffic.UDP = &s
+		}
+		if s, ok := ruleForwardStats(rule, "sctp"); ok {
+			traffic.SCTP = &s
+		}
+
+		base := fmt.Sprintf("%s/rules/%s", *mqttTopic, rule.ID)
+		statusJSON, _ := json.Marshal(status)
+		trafficJSON, _ := json.Marshal(traffic)
+		errs = append(errs,
+			client.Publish(base+"/state", statusJSON, true),
+			client.Publish(base+"/stats", trafficJSON, false),
+		)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// natpmpPort 网关上 NAT-PMP 服务的端口
+const natpmpPort = 5351
+
+// natpmpResultMessages NAT-PMP 响应中的错误码（RFC 6886）
+var natpmpResultMessages = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized/refused",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// natpmpRequest 向网关发送请求，按 RFC 6886 从 250 毫秒开始加倍重发，返回结果码为成功的响应
+func natpmpRequest(gateway net.IP, req []byte, respLen int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: gateway, Port: natpmpPort})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 16)
+	timeout := 250 * time.Millisecond
+	for i := 0; i < 4; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if n < respLen || buf[0] != 0 || buf[1] != req[1]|0x80 {
+				continue
+			}
+			if code := binary.BigEndian.Uint16(buf[2:4]); code != 0 {
+				if msg, ok := natpmpResultMessages[code]; ok {
+					return nil, fmt.Errorf("NAT-PMP: %s", msg)
+				}
+				return nil, fmt.Errorf("NAT-PMP: result code %d", code)
+			}
+			return buf[:n], nil
+		}
+		timeout *= 2
+	}
+	return nil, fmt.Errorf("no NAT-PMP response from gateway %s", gateway)
+}
+
+// natpmpExternalIP 查询网关的公网地址
+func natpmpExternalIP(gateway net.IP) (net.IP, error) {
+	resp, err := natpmpRequest(gateway, []byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IP(append([]byte(nil), resp[8:12]...)), nil
+}
+
+// natpmpMap 请求端口映射，lifetime 为 0 时删除映射。返回网关实际分配的外部端口与有效期
+func natpmpMap(gateway net.IP, protocol string, internalPort, externalPort int, lifetime time.Duration) (int, time.Duration, error) {
+	req := make([]byte, 12)
+	switch protocol {
+	case "udp":
+		req[1] = 1
+	case "tcp":
+		req[1] = 2
+	default:
+		return 0, 0, errors.New("NAT-PMP only maps TCP and UDP")
+	}
+	binary.BigEndian.PutUint16(req[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime/time.Second))
+
+	resp, err := natpmpRequest(gateway, req, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	mapped := int(binary.BigEndian.Uint16(resp[10:12]))
+	granted := time.Duration(binary.BigEndian.Uint32(resp[12:16])) * time.Second
+	return mapped, granted, nil
+}
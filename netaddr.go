@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+)
+
+// normalizeHost 去掉地址两侧的空白与 IPv6 字面量的方括号，"[::1]" 保存为 "::1"，
+// 需要 host:port 时再由 net.JoinHostPort 加回方括号
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return host
+}
+
+// normalizeHosts 依次规范化多个地址
+func normalizeHosts(hosts ...*string) {
+	for _, h := range hosts {
+		*h = normalizeHost(*h)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 网络接口变化检测：定期枚举本机地址（Wi-Fi 重连、DHCP 续租、VPN 连接与断开都会改变它们），
+// 结果供 /api/getLocalIPs 使用。监听地址消失时记下其上正在运行的转发，地址恢复后按设置
+// rebindForwards 重新监听。变化通过通知推送给界面
+
+// maxRebindAttempts 地址恢复后重新监听失败时的尝试次数，每次检测尝试一次
+const maxRebindAttempts = 3
+
+var netWatchLog = newLogger("netwatch")
+
+// lostForward 监听地址消失时正在运行的转发
+type lostForward struct {
+	ruleID   string
+	protocol string
+	attempts int
+}
+
+// netWatch 最近一次枚举的地址与等待地址恢复的转发
+var netWatch = struct {
+	sync.Mutex
+	ips  []IPInfo                 // nil 表示未开启检测或尚未枚举成功
+	lost map[string][]lostForward // 按消失的监听地址
+}{lost: make(map[string][]lostForward)}
+
+// startNetWatch 按 -net-watch-interval 定期检测网卡地址的变化
+func startNetWatch() {
+	if *netWatchInterval <= 0 {
+		return
+	}
+	if ips, err := scanLocalIPs(); err != nil {
+		netWatchLog.Warnf("Failed to get network interfaces: %v", err)
+	} else {
+		netWatch.Lock()
+		netWatch.ips = ips
+		netWatch.Unlock()
+	}
+	go func() {
+		ticker := time.NewTicker(*netWatchInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkInterfaces()
+		}
+	}()
+}
+
+// scanLocalIPs 枚举启用的网卡上的地址，跳过回环地址与需要带接口名才能使用的 IPv6 链路本地地址
+func scanLocalIPs() ([]IPInfo, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	ipInfos := []IPInfo{}
+	for _, iface := range interfaces {
+		// 跳过禁用的接口
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			netWatchLog.Debugf("Failed to get addresses for interface %s: %v", iface.Name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				ipInfos = append(ipInfos, IPInfo{Name: iface.Name, IP: ipnet.IP.String()})
+			}
+		}
+	}
+	return ipInfos, nil
+}
+
+// localIPs 本机网卡地址：开启检测时使用最近一次检测的结果，否则即时枚举
+func localIPs() ([]IPInfo, error) {
+	netWatch.Lock()
+	ips := netWatch.ips
+	netWatch.Unlock()
+	if ips != nil {
+		return append([]IPInfo(nil), ips...), nil
+	}
+	return scanLocalIPs()
+}
+
+// checkInterfaces 重新枚举地址，与上次比较；记下失去监听地址的转发，并重新监听地址已恢复的转发
+func checkInterfaces() {
+	ips, err := scanLocalIPs()
+	if err != nil {
+		netWatchLog.Debugf("Failed to get network interfaces: %v", err)
+		return
+	}
+	netWatch.Lock()
+	previous := netWatch.ips
+	netWatch.ips = ips
+	netWatch.Unlock()
+	if previous == nil {
+		// 启动时枚举失败，这是第一次成功的结果，没有可比较的
+		return
+	}
+
+	added, removed := diffIPs(previous, ips)
+	if len(added) > 0 || len(removed) > 0 {
+		var lost []string
+		for _, ip := range removed {
+			lost = append(lost, rememberLostForwards(ip)...)
+		}
+		netWatchLog.Infof("Network addresses changed: added [%s], removed [%s]", strings.Join(added, ", "), strings.Join(removed, ", "))
+		message := fmt.Sprintf("added: %s; removed: %s", ipListText(added), ipListText(removed))
+		if len(lost) > 0 {
+			message += "; forwards on removed addresses: " + strings.Join(lost, ", ")
+		}
+		notify(Notification{
+			Event:   "network.changed",
+			Title:   "Network addresses changed",
+			Message: message,
+		})
+	}
+	rebindLostForwards(ips)
+}
+
+// diffIPs 比较两次枚举的地址，返回新增与消失的地址
+func diffIPs(previous, current []IPInfo) (added, removed []string) {
+	before := make(map[string]bool, len(previous))
+	for _, info := range previous {
+		before[info.IP] = true
+	}
+	after := make(map[string]bool, len(current))
+	for _, info := range current {
+		if !after[info.IP] && !before[info.IP] {
+			added = append(added, info.IP)
+		}
+		after[info.IP] = true
+	}
+	for ip := range before {
+		if !after[ip] {
+			removed = append(removed, ip)
+		}
+	}
+	sort.Strings(removed)
+	return added, removed
+}
+
+// ipListText 通知中的地址列表
+func ipListText(ips []string) string {
+	if len(ips) == 0 {
+		return "none"
+	}
+	return strings.Join(ips, ", ")
+}
+
+// sameIP 判断监听地址是否就是 ip，忽略写法差异
+func sameIP(listenAddr, ip string) bool {
+	addr := net.ParseIP(listenAddr)
+	return addr != nil && addr.Equal(net.ParseIP(ip))
+}
+
+// rememberLostForwards 记下监听在已消失的 ip 上、正在运行的转发，返回它们的描述
+func rememberLostForwards(ip string) []string {
+	var names []string
+	for _, rule := range ruleStore.Rules() {
+		if !sameIP(rule.ListenAddr, ip) {
+			continue
+		}
+		for _, protocol := range runningProtocols(rule) {
+			netWatch.Lock()
+			known := false
+			for _, lf := range netWatch.lost[ip] {
+				known = known || (lf.ruleID == rule.ID && lf.protocol == protocol)
+			}
+			if !known {
+				netWatch.lost[ip] = append(netWatch.lost[ip], lostForward{ruleID: rule.ID, protocol: protocol})
+			}
+			netWatch.Unlock()
+
+			names = append(names, fmt.Sprintf("%s %s", strings.ToUpper(protocol), ruleDisplayName(rule)))
+			recordRuleEvent(RuleEvent{
+				RuleID:   rule.ID,
+				Type:     RuleEventError,
+				Protocol: protocol,
+				Source:   sourceNetwork,
+				Message:  fmt.Sprintf("Listen address %s disappeared", ip),
+			})
+		}
+	}
+	return names
+}
+
+// forgetLostForward 转发被手动停止后不再在地址恢复时重新监听
+func forgetLostForward(ruleID, protocol string) {
+	netWatch.Lock()
+	defer netWatch.Unlock()
+	for ip, list := range netWatch.lost {
+		var kept []lostForward
+		for _, lf := range list {
+			if lf.ruleID != ruleID || lf.protocol != protocol {
+				kept = append(kept, lf)
+			}
+		}
+		if len(kept) == 0 {
+			delete(netWatch.lost, ip)
+		} else {
+			netWatch.lost[ip] = kept
+		}
+	}
+}
+
+// rebindLostForwards 监听地址已恢复时重新监听记下的转发；未开启 rebindForwards 时只清除记录。
+// 地址刚恢复时可能还不能绑定（如 IPv6 重复地址检测），失败的在之后的检测中重试
+func rebindLostForwards(ips []IPInfo) {
+	present := make(map[string]bool, len(ips))
+	for _, info := range ips {
+		present[info.IP] = true
+	}
+	due := make(map[string][]lostForward)
+	netWatch.Lock()
+	for ip, list := range netWatch.lost {
+		if present[ip] {
+			due[ip] = list
+			delete(netWatch.lost, ip)
+		}
+	}
+	netWatch.Unlock()
+
+	rebind := currentSettings().RebindForwards
+	for ip, list := range due {
+		if !rebind {
+			netWatchLog.Infof("Listen address %s is back; rebinding forwards is disabled", ip)
+			continue
+		}
+		var retry []lostForward
+		for _, lf := range list {
+			rule, ok := findRule(lf.ruleID)
+			if !ok || !sameIP(rule.ListenAddr, ip) {
+				// 规则已删除或改了监听地址
+				continue
+			}
+			err := rebindForward(rule, lf.protocol)
+			if err == nil {
+				netWatchLog.WithRule(rule.ID).Infof("Rebound %s forward of rule %s on %s", lf.protocol, ruleDisplayName(rule), ip)
+				notify(Notification{
+					Event:   "forward.rebound",
+					RuleID:  rule.ID,
+					Title:   fmt.Sprintf("%s forward rebound on %s", strings.ToUpper(lf.protocol), ruleDisplayName(rule)),
+					Message: fmt.Sprintf("listen address %s is back", net.JoinHostPort(ip, rule.ListenPort)),
+				})
+				continue
+			}
+			lf.attempts++
+			if lf.attempts < maxRebindAttempts {
+				netWatchLog.WithRule(rule.ID).Debugf("Failed to rebind %s forward of rule %s, will retry: %v", lf.protocol, ruleDisplayName(rule), err)
+				retry = append(retry, lf)
+				continue
+			}
+			netWatchLog.WithRule(rule.ID).Errorf("Failed to rebind %s forward of rule %s: %v", lf.protocol, ruleDisplayName(rule), err)
+			notify(Notification{
+				Event:   "forward.rebind_failed",
+				RuleID:  rule.ID,
+				Title:   fmt.Sprintf("%s forward could not be rebound on %s", strings.ToUpper(lf.protocol), ruleDisplayName(rule)),
+				Message: fmt.Sprintf("listen address %s is back but binding failed after %d attempts: %v", net.JoinHostPort(ip, rule.ListenPort), lf.attempts, err),
+			})
+		}
+		if len(retry) > 0 {
+			netWatch.Lock()
+			netWatch.lost[ip] = append(netWatch.lost[ip], retry...)
+			netWatch.Unlock()
+		}
+	}
+}
+
+// rebindForward 重新监听规则的转发。旧的监听仍在时先停止，它的套接字在地址消失后可能已经失效
+func rebindForward(rule Rule, protocol string) error {
+	if isRuleForwardRunning(rule, protocol) {
+		if err := stopRuleForward(rule, protocol, sourceNetwork); err != nil {
+			return err
+		}
+	}
+	return startRuleForward(rule, protocol, sourceNetwork)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notification 发送到通知渠道的事件
+type Notification struct {
+	Event   string    `json:"event"` // 事件类型，如 alert.firing / alert.resolved
+	RuleID  string    `json:"ruleId,omitempty"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// notifySettings 由 -notify-* 参数解析出的通知配置
+var notifySettings struct {
+	events []string // 要发送的事件，以 .* 结尾的按前缀匹配；为空时发送全部
+	to     []string // 邮件收件人，为空时不发邮件
+	from   string
+}
+
+// loadNotifySettings 解析 -notify-events 与邮件通知参数
+func loadNotifySettings() error {
+	notifySettings.events = nil
+	for _, event := range strings.Split(*notifyEvents, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			notifySettings.events = append(notifySettings.events, event)
+		}
+	}
+
+	notifySettings.to, notifySettings.from = nil, ""
+	if *notifySMTP == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(*notifySMTP); err != nil {
+		return fmt.Errorf("invalid -notify-smtp %q, expected host:port", *notifySMTP)
+	}
+	for _, to := range strings.Split(*notifyEmailTo, ",") {
+		if to = strings.TrimSpace(to); to == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid -notify-email-to address %q: %v", to, err)
+		}
+		notifySettings.to = append(notifySettings.to, addr.Address)
+	}
+	if len(notifySettings.to) == 0 {
+		return fmt.Errorf("-notify-smtp requires -notify-email-to")
+	}
+	from := *notifyEmailFrom
+	if from == "" {
+		from = *notifySMTPUser
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid -notify-email-from address %q: %v", from, err)
+	}
+	notifySettings.from = addr.Address
+	log.Printf("Email notifications enabled via %s to %s", *notifySMTP, strings.Join(notifySettings.to, ", "))
+	return nil
+}
+
+// notifyEventEnabled 判断事件是否在 -notify-events 中
+func notifyEventEnabled(event string) bool {
+	if len(notifySettings.events) == 0 {
+		return true
+	}
+	for _, pattern := range notifySettings.events {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(event, prefix) {
+			return true
+		}
+		if pattern == event {
+			return true
+		}
+	}
+	return false
+}
+
+// notify 把事件发送到已配置的通知渠道（日志与管理界面总会收到）
+func notify(n Notification) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	log.Printf("[notify] %s: %s", n.Title, n.Message)
+	notifyHub.publish(n)
+
+	if !notifyEventEnabled(n.Event) {
+		return
+	}
+	if *notifyWebhook != "" {
+		go func() {
+			if err := postWebhook(*notifyWebhook, n); err != nil {
+				log.Printf("Failed to send webhook notification: %v", err)
+			}
+		}()
+	}
+	if len(notifySettings.to) > 0 {
+		go func() {
+			if err := sendEmail(n); err != nil {
+				log.Printf("Failed to send email notification: %v", err)
+			}
+		}()
+	}
+}
+
+// postWebhook 以 JSON POST 发送通知
+func postWebhook(url string, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendEmail 通过 -notify-smtp 发送通知邮件，服务器支持时使用 STARTTLS；
+// 设置了 -notify-smtp-user 时使用 PLAIN 认证
+func sendEmail(n Notification) error {
+	var body strings.Builder
+	body.WriteString(n.Message + "\r\n\r\n")
+	fmt.Fprintf(&body, "Event: %s\r\n", n.Event)
+	if n.RuleID != "" {
+		fmt.Fprintf(&body, "Rule: %s\r\n", n.RuleID)
+	}
+	fmt.Fprintf(&body, "Time: %s\r\n", n.Time.Format(time.RFC3339))
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", notifySettings.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(notifySettings.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[go-ports] "+n.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(body.String())
+
+	var auth smtp.Auth
+	if *notifySMTPUser != "" {
+		host, _, _ := net.SplitHostPort(*notifySMTP)
+		auth = smtp.PlainAuth("", *notifySMTPUser, *notifySMTPPassword, host)
+	}
+	return smtp.SendMail(*notifySMTP, auth, notifySettings.from, notifySettings.to, msg.Bytes())
+}
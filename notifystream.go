@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// notifyStreamBuffer 每个订阅者缓存的通知条数，满了丢弃
+const notifyStreamBuffer = 64
+
+// notifyHub 把每条通知推送给 /api/notifyStream 的订阅者（管理界面）
+var notifyHub = &notifyBroadcaster{subscribers: make(map[chan Notification]struct{})}
+
+// notifyBroadcaster 通知广播
+type notifyBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Notification]struct{}
+}
+
+// publish 分发一条通知；订阅者跟不上时丢弃，不阻塞发送通知的一方
+func (b *notifyBroadcaster) publish(n Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- n:
+		default:
+		}
+	}
+}
+
+// subscribe 订阅新通知，返回的函数取消订阅
+func (b *notifyBroadcaster) subscribe() (chan Notification, func()) {
+	ch := make(chan Notification, notifyStreamBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// apiNotifyStream 以 Server-Sent Events 实时推送通知，如网卡地址变化与转发重新监听。
+// 不受 -notify-events 限制，只推送连接之后的通知
+func apiNotifyStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	notifications, unsubscribe := notifyHub.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case n := <-notifications:
+			data, _ := json.Marshal(n)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openAPIDoc 生成的文档在进程内不变，第一次请求时生成
+var openAPIDoc struct {
+	once sync.Once
+	data []byte
+}
+
+// apiOpenAPI 返回描述 /api 接口的 OpenAPI 3 文档
+func apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIDoc.once.Do(func() {
+		openAPIDoc.data, _ = json.MarshalIndent(buildOpenAPI(apiRoutes), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc.data)
+}
+
+// buildOpenAPI 根据接口表生成 OpenAPI 文档，请求与响应的结构由 Go 类型反射得到
+func buildOpenAPI(routes []apiRoute) map[string]interface{} {
+	schemas := &openAPISchemas{components: map[string]interface{}{}}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemas.of(reflect.TypeOf(Result{}))},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for _, route := range routes {
+		op := map[string]interface{}{
+			"operationId": operationID(route),
+			"summary":     route.Summary,
+			"tags":        []string{route.Tag},
+		}
+
+		var params []interface{}
+		for _, p := range route.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          "path",
+				"description": p.Description,
+				"required":    true,
+				"schema":      map[string]string{"type": "string"},
+			})
+		}
+		for _, p := range route.Query {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"required":    p.Required,
+				"schema":      map[string]string{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if route.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": !route.Optional,
+				"content":  schemas.content(route.Request, route.Consumes),
+			}
+		}
+
+		success := map[string]interface{}{"description": "OK"}
+		response := route.Response
+		if response == nil && route.Produces == "" {
+			response = Result{}
+		}
+		if response != nil || route.Produces != "" {
+			success["content"] = schemas.content(response, route.Produces)
+		}
+		op["responses"] = map[string]interface{}{
+			"200":     success,
+			"default": errorResponse,
+		}
+
+		item, _ := paths[route.Path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Port Forwarder API",
+			"version":     "1",
+			"description": "Failed requests return a non-2xx status with {\"success\": false, \"error\": \"...\"}.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"apiToken":   map[string]string{"type": "apiKey", "in": "header", "name": apiTokenHeader},
+				"bearer":     map[string]string{"type": "http", "scheme": "bearer"},
+				"basic":      map[string]string{"type": "http", "scheme": "basic"},
+				"uiPassword": map[string]string{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+			},
+		},
+		"security": []map[string][]string{{"apiToken": {}}, {"bearer": {}}, {"basic": {}}, {"uiPassword": {}}},
+	}
+	if basePath != "" {
+		doc["servers"] = []map[string]string{{"url": basePath}}
+	}
+	return doc
+}
+
+// operationID 接口的 operationId，由路径中参数以外的各段拼接，如 /api/v2/rules/{id}/start
+// 为 v2RulesStart；同一路径有多个方法时加上方法名
+func operationID(route apiRoute) string {
+	id := ""
+	for _, segment := range strings.Split(strings.TrimPrefix(route.Path, "/api/"), "/") {
+		if segment == "" || strings.HasPrefix(segment, "{") {
+			continue
+		}
+		if id != "" {
+			segment = strings.ToUpper(segment[:1]) + segment[1:]
+		}
+		id += segment
+	}
+	count := 0
+	for _, other := range apiRoutes {
+		if other.Path == route.Path {
+			count++
+		}
+	}
+	if count > 1 {
+		id += strings.ToUpper(route.Method[:1]) + strings.ToLower(route.Method[1:])
+	}
+	return id
+}
+
+// openAPISchemas 收集具名结构体的 schema，文档中以 $ref 引用
+type openAPISchemas struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// content 请求体或响应体的 content 对象。contentType 为空时为 JSON，否则按原始数据描述
+func (s *openAPISchemas) content(v interface{}, contentType string) map[string]interface{} {
+	if contentType == "" {
+		return map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": s.of(reflect.TypeOf(v))},
+		}
+	}
+	schema := map[string]interface{}{"type": "string"}
+	if _, ok := v.([]byte); ok || v == nil {
+		schema["format"] = "binary"
+	}
+	return map[string]interface{}{contentType: map[string]interface{}{"schema": schema}}
+}
+
+// of 返回类型的 JSON schema
+func (s *openAPISchemas) of(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Nanoseconds"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	case t.Kind() != reflect.Ptr && t.Implements(textMarshalerType),
+		t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.of(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			// 3.0 中 $ref 不能与其他关键字并列
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s.components[t.Name()]; !ok {
+			// 先占位，结构体引用自身时不会无限递归
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.object(t)
+		}
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// object 结构体的 schema，字段名与是否省略按 json 标签，匿名嵌入的结构体展开到外层
+func (s *openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	s.fields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *openAPISchemas) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.fields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+	}
+}
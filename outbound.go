@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// validateOutboundBind 校验规则连接目标的出接口与源地址：不能与透明代理、SSH 跳板机或中继节点同时使用
+func validateOutboundBind(rule Rule) error {
+	if !rule.Bind.Enabled() {
+		return nil
+	}
+	if err := rule.Bind.Validate(); err != nil {
+		return err
+	}
+	if rule.Transparent {
+		return errors.New("outbound interface cannot be used with transparent proxy")
+	}
+	if rule.SSHHost != "" {
+		return errors.New("outbound interface cannot be used with an SSH host, targets are reached from the SSH host")
+	}
+	if len(rule.Via) > 0 {
+		return errors.New("outbound interface cannot be used with relay nodes, targets are reached from the last node")
+	}
+	return nil
+}
+
+// updateOutboundBindRequest apiUpdateOutboundBind 的请求体
+type updateOutboundBindRequest struct {
+	RuleID string                `json:"ruleId"`
+	Bind   *forward.OutboundBind `json:"bind"`
+}
+
+// apiUpdateOutboundBind 设置规则连接目标时使用的出接口与源地址，bind 为 null 时按系统路由。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateOutboundBind(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "outbound interface", func(req *updateOutboundBindRequest, current Rule) (func(rule *Rule), error) {
+		if req.Bind != nil {
+			req.Bind.Interface = strings.TrimSpace(req.Bind.Interface)
+			req.Bind.SourceIP = strings.TrimSpace(req.Bind.SourceIP)
+			if !req.Bind.Enabled() {
+				req.Bind = nil
+			}
+		}
+		current.Bind = req.Bind
+		if err := validateOutboundBind(current); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.Bind = req.Bind }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// 支持的 pcap 链路层类型
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeSLL2     = 276
+)
+
+// pcapPacket 从抓包文件中解析出的传输层数据包
+type pcapPacket struct {
+	Time     time.Time
+	Protocol string // tcp 或 udp
+	Src      net.IP
+	Dst      net.IP
+	SrcPort  int
+	DstPort  int
+	Seq      uint32 // 仅TCP
+	SYN      bool   // 仅TCP
+	FIN      bool   // 仅TCP
+	Payload  []byte
+}
+
+// maxPcapSnapLen 单个记录允许的最大长度，与 tcpdump 的默认抓包长度一致；
+// 文件头中的 snaplen 更小时以它为准
+const maxPcapSnapLen = 262144
+
+var errPcapFormat = errors.New("unsupported capture format (only classic libpcap files are supported)")
+
+// readPcap 读取经典 libpcap 格式文件中的所有 TCP/UDP 数据包
+func readPcap(r io.Reader) ([]pcapPacket, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read pcap header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	nano := false
+	switch {
+	case binary.LittleEndian.Uint32(header) == 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == 0xa1b2c3d4:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header) == 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == 0xa1b23c4d:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, errPcapFormat
+	}
+	linkType := order.Uint32(header[20:24]) & 0x0fffffff
+	snapLen := order.Uint32(header[16:20])
+	if snapLen == 0 || snapLen > maxPcapSnapLen {
+		snapLen = maxPcapSnapLen
+	}
+
+	var packets []pcapPacket
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return packets, fmt.Errorf("read pcap record: %w", err)
+		}
+		sec := int64(order.Uint32(record[0:4]))
+		frac := int64(order.Uint32(record[4:8]))
+		if !nano {
+			frac *= 1000
+		}
+		// 记录长度来自文件，先检查再分配
+		length := order.Uint32(record[8:12])
+		if length > snapLen {
+			return packets, fmt.Errorf("pcap record of %d bytes exceeds snapshot length %d", length, snapLen)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return packets, fmt.Errorf("read pcap packet: %w", err)
+		}
+
+		if p, ok := decodePacket(linkType, data); ok {
+			p.Time = time.Unix(sec, frac)
+			packets = append(packets, p)
+		}
+	}
+	return packets, nil
+}
+
+// decodePacket 剥离链路层并解析 IP/TCP/UDP 头
+func decodePacket(linkType uint32, data []byte) (pcapPacket, bool) {
+	var etherType uint16
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return pcapPacket{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		// 802.1Q VLAN 标签
+		for etherType == 0x8100 && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return pcapPacket{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return pcapPacket{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case linkTypeNull:
+		if len(data) < 4 {
+			return pcapPacket{}, false
+		}
+		data = data[4:]
+	case linkTypeRaw:
+	default:
+		return pcapPacket{}, false
+	}
+
+	// 无以太网类型时根据 IP 版本号判断
+	if etherType == 0 && len(data) > 0 {
+		switch data[0] >> 4 {
+		case 4:
+			etherType = 0x0800
+		case 6:
+			etherType = 0x86dd
+		}
+	}
+
+	var p pcapPacket
+	var proto byte
+	switch etherType {
+	case 0x0800:
+		if len(data) < 20 {
+			return p, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:4]))
+		// 忽略分片
+		if binary.BigEndian.Uint16(data[6:8])&0x1fff != 0 || ihl < 20 || total < ihl || len(data) < total {
+			return p, false
+		}
+		proto = data[9]
+		p.Src, p.Dst = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:total]
+	case 0x86dd:
+		if len(data) < 40 {
+			return p, false
+		}
+		length := int(binary.BigEndian.Uint16(data[4:6]))
+		if len(data) < 40+length {
+			return p, false
+		}
+		proto = data[6]
+		p.Src, p.Dst = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40 : 40+length]
+	default:
+		return p, false
+	}
+
+	switch proto {
+	case 6:
+		if len(data) < 20 {
+			return p, false
+		}
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || len(data) < offset {
+			return p, false
+		}
+		p.Protocol = "tcp"
+		p.Seq = binary.BigEndian.Uint32(data[4:8])
+		p.SYN = data[13]&0x02 != 0
+		p.FIN = data[13]&0x01 != 0
+		p.Payload = data[offset:]
+	case 17:
+		if len(data) < 8 {
+			return p, false
+		}
+		p.Protocol = "udp"
+		p.Payload = data[8:]
+	default:
+		return p, false
+	}
+	p.SrcPort = int(binary.BigEndian.Uint16(data[0:2]))
+	p.DstPort = int(binary.BigEndian.Uint16(data[2:4]))
+	return p, true
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+const (
+	portMapLease    = time.Hour       // 请求的映射有效期，过半时续期
+	portMapInterval = time.Minute     // 检查映射的间隔
+	portMapRetry    = 5 * time.Minute // 映射失败后重试的间隔
+	igdCacheTTL     = 10 * time.Minute
+	igdSearchWait   = 2 * time.Second
+)
+
+// 端口映射方式
+const (
+	PortMapUPnP   = "upnp"
+	PortMapNATPMP = "natpmp"
+)
+
+// PortMapping 规则在路由器上的端口映射
+type PortMapping struct {
+	RuleID       string    `json:"ruleId"`
+	Protocol     string    `json:"protocol"` // tcp/udp
+	InternalPort int       `json:"internalPort"`
+	ExternalIP   string    `json:"externalIp,omitempty"`
+	ExternalPort int       `json:"externalPort,omitempty"`
+	Method       string    `json:"method,omitempty"`    // upnp/natpmp
+	ExpiresAt    time.Time `json:"expiresAt,omitempty"` // 为零时是永久映射
+	Error        string    `json:"error,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// portMaps 当前的端口映射（按 规则ID/协议 索引）与缓存的 UPnP 网关
+var portMaps = struct {
+	sync.Mutex
+	byKey map[string]*PortMapping
+	igd   *igdClient
+	igdAt time.Time
+}{byKey: make(map[string]*PortMapping)}
+
+// portMapRun 保证同一时间只有一次映射更新在访问路由器
+var portMapRun sync.Mutex
+
+// portMapTrigger 转发启停后通知映射循环立即检查
+var portMapTrigger = make(chan struct{}, 1)
+
+// triggerPortMapping 请求立即检查端口映射，不阻塞
+func triggerPortMapping() {
+	select {
+	case portMapTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// startPortMapper 启动端口映射循环：转发启动时请求映射、停止时删除，并在有效期过半时续期
+func startPortMapper() {
+	go func() {
+		ticker := time.NewTicker(portMapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-portMapTrigger:
+			}
+			reconcilePortMappings(time.Now())
+		}
+	}()
+}
+
+// wantedPortMappings 开启了端口映射且正在运行的规则需要的映射。TCP 与 SOCKS5 映射 TCP 端口，UDP 映射 UDP 端口
+func wantedPortMappings() map[string]PortMapping {
+	wanted := make(map[string]PortMapping)
+	for _, rule := range ruleStore.Rules() {
+		if !rule.PortMapping {
+			continue
+		}
+		port, err := strconv.Atoi(rule.ListenPort)
+		if err != nil {
+			continue
+		}
+		running := runningProtocols(rule)
+		for _, protocol := range running {
+			if protocol == "socks5" {
+				protocol = "tcp"
+			}
+			if protocol != "tcp" && protocol != "udp" {
+				continue
+			}
+			wanted[rule.ID+"/"+protocol] = PortMapping{RuleID: rule.ID, Protocol: protocol, InternalPort: port}
+		}
+	}
+	return wanted
+}
+
+// reconcilePortMappings 请求缺少或即将过期的映射，删除不再需要的映射
+func reconcilePortMappings(now time.Time) {
+	portMapRun.Lock()
+	defer portMapRun.Unlock()
+
+	wanted := wantedPortMappings()
+	portMaps.Lock()
+	current := make(map[string]PortMapping, len(portMaps.byKey))
+	for key, m := range portMaps.byKey {
+		current[key] = *m
+	}
+	portMaps.Unlock()
+
+	for key, m := range wanted {
+		m := m
+		cur, existed := current[key]
+		if existed && cur.InternalPort != m.InternalPort {
+			// 监听端口改变后删除旧映射
+			releasePortMapping(cur)
+			cur, existed = PortMapping{}, false
+		}
+		if existed {
+			if cur.Error != "" && now.Sub(cur.UpdatedAt) < portMapRetry {
+				continue
+			}
+			if cur.Error == "" && (cur.ExpiresAt.IsZero() || cur.ExpiresAt.Sub(now) > portMapLease/2) {
+				continue
+			}
+			m.ExternalPort = cur.ExternalPort
+		}
+		lg := newLogger("portmap").WithRule(m.RuleID)
+		err := mapPort(&m, now)
+		if err != nil {
+			m.Error = err.Error()
+			if cur.Error != m.Error {
+				lg.Warnf("Port mapping: failed to map %s port %d: %v", m.Protocol, m.InternalPort, err)
+			}
+		} else if !existed || cur.Error != "" {
+			lg.Infof("Port mapping: %s %s -> local port %d via %s", m.Protocol, net.JoinHostPort(m.ExternalIP, strconv.Itoa(m.ExternalPort)), m.InternalPort, m.Method)
+		}
+		portMaps.Lock()
+		portMaps.byKey[key] = &m
+		portMaps.Unlock()
+	}
+
+	for key, cur := range current {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		releasePortMapping(cur)
+		portMaps.Lock()
+		delete(portMaps.byKey, key)
+		portMaps.Unlock()
+	}
+}
+
+// currentIGD 返回缓存的 UPnP 网关，过期后重新搜索
+func currentIGD(now time.Time) (*igdClient, error) {
+	portMaps.Lock()
+	igd, at := portMaps.igd, portMaps.igdAt
+	portMaps.Unlock()
+	if igd != nil && now.Sub(at) < igdCacheTTL {
+		return igd, nil
+	}
+
+	igd, err := discoverIGD(igdSearchWait)
+	portMaps.Lock()
+	portMaps.igd, portMaps.igdAt = igd, now
+	portMaps.Unlock()
+	return igd, err
+}
+
+// mapPort 先通过 UPnP、再通过 NAT-PMP 请求映射，外部端口默认与本地端口相同
+func mapPort(m *PortMapping, now time.Time) error {
+	m.UpdatedAt = now
+	m.Error = ""
+	if m.ExternalPort == 0 {
+		m.ExternalPort = m.InternalPort
+	}
+
+	igd, upnpErr := currentIGD(now)
+	if upnpErr == nil {
+		var lease time.Duration
+		lease, upnpErr = igd.addPortMapping(m.Protocol, m.ExternalPort, m.InternalPort, "go-ports "+m.RuleID, portMapLease)
+		if upnpErr == nil {
+			m.Method = PortMapUPnP
+			m.ExpiresAt = time.Time{}
+			if lease > 0 {
+				m.ExpiresAt = now.Add(lease)
+			}
+			if m.ExternalIP, upnpErr = igd.externalIP(); upnpErr != nil {
+				log.Printf("Failed to get external address from UPnP gateway: %v", upnpErr)
+			}
+			return nil
+		}
+	}
+
+	gateway, natpmpErr := defaultGateway()
+	if natpmpErr == nil {
+		var mapped int
+		var lease time.Duration
+		if mapped, lease, natpmpErr = natpmpMap(gateway, m.Protocol, m.InternalPort, m.ExternalPort, portMapLease); natpmpErr == nil {
+			m.Method = PortMapNATPMP
+			m.ExternalPort = mapped
+			m.ExpiresAt = now.Add(lease)
+			if ip, err := natpmpExternalIP(gateway); err == nil {
+				m.ExternalIP = ip.String()
+			} else {
+				log.Printf("Failed to get external address via NAT-PMP: %v", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("UPnP: %v; NAT-PMP: %v", upnpErr, natpmpErr)
+}
+
+// releasePortMapping 删除路由器上的映射，失败时只记录日志（映射到期后也会失效）
+func releasePortMapping(m PortMapping) {
+	if m.Error != "" || m.Method == "" {
+		return
+	}
+	var err error
+	switch m.Method {
+	case PortMapUPnP:
+		portMaps.Lock()
+		igd := portMaps.igd
+		portMaps.Unlock()
+		if igd == nil {
+			err = errors.New("UPnP gateway not available")
+		} else {
+			err = igd.deletePortMapping(m.Protocol, m.ExternalPort)
+		}
+	case PortMapNATPMP:
+		var gateway net.IP
+		if gateway, err = defaultGateway(); err == nil {
+			_, _, err = natpmpMap(gateway, m.Protocol, m.InternalPort, 0, 0)
+		}
+	}
+	lg := newLogger("portmap").WithRule(m.RuleID)
+	if err != nil {
+		lg.Warnf("Port mapping: failed to remove %s mapping of external port %d: %v", m.Protocol, m.ExternalPort, err)
+		return
+	}
+	lg.Infof("Port mapping: removed %s mapping of external port %d", m.Protocol, m.ExternalPort)
+}
+
+// releasePortMappings 删除所有映射（退出时调用）
+func releasePortMappings() {
+	portMapRun.Lock()
+	defer portMapRun.Unlock()
+
+	portMaps.Lock()
+	list := make([]PortMapping, 0, len(portMaps.byKey))
+	for _, m := range portMaps.byKey {
+		list = append(list, *m)
+	}
+	portMaps.byKey = make(map[string]*PortMapping)
+	portMaps.Unlock()
+
+	for _, m := range list {
+		releasePortMapping(m)
+	}
+}
+
+// portMappingAddr 规则的公网地址 ip:port，优先 TCP 映射，没有成功的映射时返回 false
+func portMappingAddr(ruleID string) (string, bool) {
+	portMaps.Lock()
+	defer portMaps.Unlock()
+	for _, protocol := range []string{"tcp", "udp"} {
+		if m, ok := portMaps.byKey[ruleID+"/"+protocol]; ok && m.Error == "" && m.ExternalIP != "" {
+			return net.JoinHostPort(m.ExternalIP, strconv.Itoa(m.ExternalPort)), true
+		}
+	}
+	return "", false
+}
+
+// validatePortMapping 端口映射只支持单个端口，且监听地址不能是回环地址
+func validatePortMapping(rule Rule) error {
+	if !rule.PortMapping {
+		return nil
+	}
+	if forward.IsPortRange(rule.ListenPort) {
+		return errors.New("port mapping is not supported with port ranges")
+	}
+	if ip := net.ParseIP(rule.ListenAddr); (ip != nil && ip.IsLoopback()) || rule.ListenAddr == "localhost" {
+		return errors.New("port mapping requires listening on a LAN address, not loopback")
+	}
+	return nil
+}
+
+// apiGetPortMappings 获取当前的端口映射
+func apiGetPortMappings(w http.ResponseWriter, r *http.Request) {
+	portMaps.Lock()
+	list := make([]PortMapping, 0, len(portMaps.byKey))
+	for _, m := range portMaps.byKey {
+		list = append(list, *m)
+	}
+	portMaps.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].RuleID != list[j].RuleID {
+			return list[i].RuleID < list[j].RuleID
+		}
+		return list[i].Protocol < list[j].Protocol
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// apiUpdatePortMapping 开启或关闭规则的路由器端口映射（UPnP/NAT-PMP），正在运行的转发立即生效
+func apiUpdatePortMapping(w http.ResponseWriter, r *http.Request) {
+	_, ok := updateRuleOption(w, r, "port mapping", func(req *ruleToggleRequest, current Rule) (func(rule *Rule), error) {
+		current.PortMapping = req.Enabled
+		if err := validatePortMapping(current); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.PortMapping = req.Enabled }, nil
+	})
+	if !ok {
+		return
+	}
+
+	triggerPortMapping()
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
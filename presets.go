@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Preset 常用服务的规则预设
+type Preset struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Port     string `json:"port"`
+	Protocol string `json:"protocol"` // tcp / udp / tcp+udp
+}
+
+// builtinPresets 内置的常用服务预设
+var builtinPresets = []Preset{
+	{Key: "ssh", Name: "SSH", Port: "22", Protocol: "tcp"},
+	{Key: "http", Name: "HTTP", Port: "80", Protocol: "tcp"},
+	{Key: "https", Name: "HTTPS", Port: "443", Protocol: "tcp"},
+	{Key: "rdp", Name: "远程桌面 (RDP)", Port: "3389", Protocol: "tcp+udp"},
+	{Key: "vnc", Name: "VNC", Port: "5900", Protocol: "tcp"},
+	{Key: "ftp", Name: "FTP", Port: "21", Protocol: "tcp"},
+	{Key: "smb", Name: "SMB 文件共享", Port: "445", Protocol: "tcp"},
+	{Key: "dns", Name: "DNS", Port: "53", Protocol: "tcp+udp"},
+	{Key: "mysql", Name: "MySQL", Port: "3306", Protocol: "tcp"},
+	{Key: "postgres", Name: "PostgreSQL", Port: "5432", Protocol: "tcp"},
+	{Key: "redis", Name: "Redis", Port: "6379", Protocol: "tcp"},
+	{Key: "mongodb", Name: "MongoDB", Port: "27017", Protocol: "tcp"},
+	{Key: "minecraft", Name: "Minecraft", Port: "25565", Protocol: "tcp+udp"},
+	{Key: "openvpn", Name: "OpenVPN", Port: "1194", Protocol: "udp"},
+	{Key: "wireguard", Name: "WireGuard", Port: "51820", Protocol: "udp"},
+}
+
+// findPreset 按 key 查找预设
+func findPreset(key string) (Preset, bool) {
+	for _, p := range builtinPresets {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// apiGetPresets 获取内置规则预设
+func apiGetPresets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(builtinPresets)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+var profileLog = newLogger("profile")
+
+// resolveRule 按当前环境展开规则目标中的变量 ${NAME}
+func resolveRule(rule Rule) (Rule, error) {
+	settings := currentSettings()
+	resolved, err := store.ExpandRule(rule, settings.ProfileVars())
+	if err != nil && settings.ActiveProfile == "" {
+		return rule, fmt.Errorf("%v (no profile selected)", err)
+	}
+	if err != nil {
+		return rule, fmt.Errorf("%v in profile %s", err, settings.ActiveProfile)
+	}
+	return resolved, nil
+}
+
+// expandTargetVars 按当前环境展开请求中目标地址与端口的变量
+func expandTargetVars(addr, port *string) error {
+	rule, err := resolveRule(Rule{TargetAddr: *addr, TargetPort: *port})
+	if err != nil {
+		return err
+	}
+	*addr, *port = rule.TargetAddr, rule.TargetPort
+	return nil
+}
+
+// resolvedRule 按当前环境展开规则目标中的变量，无法展开时原样返回，用于比较正在运行的转发
+func resolvedRule(rule Rule) Rule {
+	resolved, _ := resolveRule(rule)
+	return resolved
+}
+
+// ruleHasVars 规则目标中是否引用了变量
+func ruleHasVars(rule Rule) bool {
+	return store.HasVars(rule.TargetAddr) || store.HasVars(rule.TargetPort)
+}
+
+// varRules 目标引用了变量的规则，包括模板私有的规则副本
+func varRules() []Rule {
+	var rules []Rule
+	for _, rule := range ruleStore.Rules() {
+		if ruleHasVars(rule) {
+			rules = append(rules, rule)
+		}
+	}
+	for _, template := range ruleStore.Templates() {
+		for _, rule := range template.Snapshots {
+			if ruleHasVars(rule) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// ruleVarNames 规则目标中引用的变量名，排序去重
+func ruleVarNames() []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, rule := range varRules() {
+		for _, value := range []string{rule.TargetAddr, rule.TargetPort} {
+			for _, name := range store.VarNames(value) {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// changeProfiles 修改环境设置。正在运行且引用了变量的规则在新设置下必须都能展开，否则不修改；
+// 修改后目标变化的转发以 source 为来源重启，监听地址不变，已建立的连接不受影响
+func changeProfiles(source string, fn func(settings *Settings) error) error {
+	next := currentSettings()
+	next.Profiles = append([]Profile(nil), next.Profiles...)
+	if err := fn(&next); err != nil {
+		return err
+	}
+	vars := next.ProfileVars()
+
+	type restart struct {
+		rule      Rule
+		protocols []string
+	}
+	var restarts []restart
+	for _, rule := range varRules() {
+		protocols := runningProtocols(rule)
+		if len(protocols) == 0 {
+			continue
+		}
+		updated, err := store.ExpandRule(rule, vars)
+		if err != nil {
+			return fmt.Errorf("rule %s is running: %v", ruleDisplayName(rule), err)
+		}
+		current := resolvedRule(rule)
+		if updated.TargetAddr != current.TargetAddr || updated.TargetPort != current.TargetPort {
+			restarts = append(restarts, restart{rule, protocols})
+		}
+	}
+
+	if _, err := updateSettings(func(settings *Settings) {
+		settings.Profiles = next.Profiles
+		settings.ActiveProfile = next.ActiveProfile
+	}); err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		return errors.New("failed to save settings")
+	}
+
+	var failures []string
+	for _, r := range restarts {
+		if err := restartForwards(r.rule, r.rule, r.protocols, source); err != nil {
+			profileLog.Errorf("Failed to restart rule %s after profile change: %v", ruleDisplayName(r.rule), err)
+			failures = append(failures, fmt.Sprintf("%s: %v", ruleDisplayName(r.rule), err))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// switchProfile 切换当前环境，name 为空时不使用环境。引用了变量的正在运行的转发按新环境重启
+func switchProfile(name, source string) error {
+	if currentSettings().ActiveProfile == name {
+		return nil
+	}
+	err := changeProfiles(source, func(settings *Settings) error {
+		if _, ok := settings.FindProfile(name); !ok && name != "" {
+			return fmt.Errorf("profile %s not found", name)
+		}
+		settings.ActiveProfile = name
+		return nil
+	})
+	if err == nil {
+		profileLog.Infof("Switched to profile %q", name)
+	}
+	return err
+}
+
+// validateProfile 校验环境的名称与变量，变量值不能再引用变量
+func validateProfile(profile Profile) error {
+	if profile.Name == "" {
+		return errors.New("profile name is required")
+	}
+	for name, value := range profile.Vars {
+		if !store.ValidVarName(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		if store.HasVars(value) {
+			return fmt.Errorf("variable %s: values cannot reference other variables", name)
+		}
+	}
+	return nil
+}
+
+// profileTemplates 开启前切换到该环境的模板
+func profileTemplates(name string) []string {
+	var names []string
+	for _, template := range ruleStore.Templates() {
+		if template.Profile == name {
+			names = append(names, template.Name)
+		}
+	}
+	return names
+}
+
+// apiGetProfiles 获取环境列表、当前环境与规则目标中引用的变量
+func apiGetProfiles(w http.ResponseWriter, r *http.Request) {
+	settings := currentSettings()
+	profiles := settings.Profiles
+	if profiles == nil {
+		profiles = []Profile{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles":  profiles,
+		"active":    settings.ActiveProfile,
+		"variables": ruleVarNames(),
+	})
+}
+
+// updateProfileRequest apiUpdateProfile 的请求体
+type updateProfileRequest struct {
+	OldName string            `json:"oldName"` // 为空时新增
+	Name    string            `json:"name"`
+	Vars    map[string]string `json:"vars"`
+}
+
+// apiUpdateProfile 新增、修改或重命名环境。修改当前环境的变量时，目标变化的转发会重启
+func apiUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req updateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	profile := Profile{Name: strings.TrimSpace(req.Name), Vars: make(map[string]string, len(req.Vars))}
+	for name, value := range req.Vars {
+		profile.Vars[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if err := validateProfile(profile); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notFound := false
+	err := changeProfiles(requestSource(r), func(settings *Settings) error {
+		index := -1
+		for i, p := range settings.Profiles {
+			if p.Name == req.OldName && req.OldName != "" {
+				index = i
+			} else if p.Name == profile.Name {
+				return fmt.Errorf("profile %s already exists", profile.Name)
+			}
+		}
+		switch {
+		case req.OldName == "":
+			settings.Profiles = append(settings.Profiles, profile)
+		case index < 0:
+			notFound = true
+			return errors.New("profile not found")
+		default:
+			settings.Profiles[index] = profile
+			if settings.ActiveProfile == req.OldName {
+				settings.ActiveProfile = profile.Name
+			}
+		}
+		return nil
+	})
+	if notFound {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 重命名时同步更新引用它的模板
+	if req.OldName != "" && req.OldName != profile.Name {
+		err := ruleStore.UpdateTemplates(func(templates []Template) ([]Template, bool) {
+			changed := false
+			for i := range templates {
+				if templates[i].Profile == req.OldName {
+					templates[i].Profile = profile.Name
+					changed = true
+				}
+			}
+			return templates, changed
+		})
+		if err != nil {
+			log.Printf("Failed to save templates: %v", err)
+		}
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// apiDeleteProfile 删除环境，当前环境或仍被模板引用时拒绝
+func apiDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req nameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if currentSettings().ActiveProfile == req.Name {
+		writeError(w, http.StatusConflict, "cannot delete the active profile")
+		return
+	}
+	if templates := profileTemplates(req.Name); len(templates) > 0 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("profile is used by template(s) %s", strings.Join(templates, ", ")))
+		return
+	}
+	_, err := updateSettings(func(settings *Settings) {
+		var kept []Profile
+		for _, profile := range settings.Profiles {
+			if profile.Name != req.Name {
+				kept = append(kept, profile)
+			}
+		}
+		settings.Profiles = kept
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// apiSetActiveProfile 切换当前环境，name 为空时不使用环境。引用了变量的正在运行的转发按新环境重启
+func apiSetActiveProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req nameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := switchProfile(strings.TrimSpace(req.Name), requestSource(r)); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// validateTargetHost 校验目标地址，引用变量时只检查变量语法
+func validateTargetHost(host string) string {
+	if store.HasVars(host) {
+		if err := store.CheckVars(host); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+	return validateHost(host)
+}
+
+// validateTargetPort 校验目标端口，引用变量时只检查变量语法
+func validateTargetPort(port string) string {
+	if store.HasVars(port) {
+		if err := store.CheckVars(port); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+	return validatePort(port)
+}
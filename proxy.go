@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// corsOrigins 允许跨域访问 API 的来源，"*" 表示任意来源；为空时不返回 CORS 头
+var corsOrigins map[string]bool
+
+// basePath 反向代理挂载管理界面的路径前缀，如 /goports，为空时不使用前缀
+var basePath string
+
+// corsAllowHeaders 跨域请求允许携带的请求头
+const corsAllowHeaders = "Content-Type, Authorization, " + apiTokenHeader + ", " + uiClientHeader
+
+// loadProxySettings 解析 -cors-origins 与 -base-path 参数
+func loadProxySettings() error {
+	origins := map[string]bool{}
+	for _, origin := range strings.Split(*corsOriginsFlag, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+				return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+			}
+			origin = strings.ToLower(origin)
+		}
+		origins[origin] = true
+	}
+	if len(origins) > 0 {
+		corsOrigins = origins
+		log.Printf("CORS enabled for %s", *corsOriginsFlag)
+	}
+
+	prefix := strings.Trim(*basePathFlag, "/")
+	if prefix != "" {
+		basePath = "/" + prefix
+		log.Printf("Serving management UI under path prefix %s/", basePath)
+	}
+	return nil
+}
+
+// corsOriginAllowed 判断请求来源是否允许跨域访问
+func corsOriginAllowed(origin string) bool {
+	return corsOrigins["*"] || corsOrigins[strings.ToLower(origin)]
+}
+
+// allowCORS 为允许的来源返回 CORS 响应头并应答预检请求。
+// 预检请求不带认证信息，需要在 API 认证之前处理。只有明确列出的来源可以携带 Cookie 与
+// basic 认证；"*" 只返回字面的 *，任意网站都不能借用浏览器保存的凭据，只能以令牌访问
+func allowCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(corsOrigins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !corsOriginAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if corsOrigins[strings.ToLower(origin)] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stripBasePath 去掉请求路径中的 -base-path 前缀，供不改写路径的反向代理使用。
+// 不带前缀的请求按原路径处理，因此直接访问与已去掉前缀的代理同样可用
+func stripBasePath(next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			// 界面使用相对地址，必须以 / 结尾才能解析到前缀之下
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, basePath+"/"); ok {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + rest
+			r2.URL.RawPath = ""
+			next.ServeHTTP(w, r2)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 公网地址的缓存时间，失败结果缓存较短时间
+const (
+	publicIPCacheTTL = 10 * time.Minute
+	publicIPErrorTTL = 30 * time.Second
+)
+
+// STUN 消息类型与属性（RFC 5389）
+const (
+	stunMagicCookie   = 0x2112A442
+	stunBindingReq    = 0x0001
+	stunBindingResp   = 0x0101
+	stunMappedAddr    = 0x0001
+	stunXorMappedAddr = 0x0020
+)
+
+// publicIPCache 最近一次检测到的公网地址
+var publicIPCache = struct {
+	sync.Mutex
+	ip     string
+	source string
+	err    error
+	at     time.Time
+}{}
+
+// detectPublicIP 检测本机的公网地址：配置了 -public-ip-url 时使用回显服务，否则通过 STUN 查询。
+// 结果会缓存，返回地址与来源
+func detectPublicIP() (string, string, error) {
+	publicIPCache.Lock()
+	defer publicIPCache.Unlock()
+
+	ttl := publicIPCacheTTL
+	if publicIPCache.err != nil {
+		ttl = publicIPErrorTTL
+	}
+	if !publicIPCache.at.IsZero() && time.Since(publicIPCache.at) < ttl {
+		return publicIPCache.ip, publicIPCache.source, publicIPCache.err
+	}
+
+	var ip net.IP
+	var source string
+	var err error
+	if *publicIPURL != "" {
+		source = *publicIPURL
+		ip, err = echoPublicIP(*publicIPURL)
+	} else {
+		source = "stun:" + *stunServer
+		ip, err = stunPublicIP(*stunServer)
+	}
+	publicIPCache.ip, publicIPCache.source, publicIPCache.err, publicIPCache.at = "", source, err, time.Now()
+	if err == nil {
+		publicIPCache.ip = ip.String()
+	}
+	return publicIPCache.ip, source, err
+}
+
+// echoPublicIP 从回显服务读取公网地址，响应正文应只包含IP地址
+func echoPublicIP(url string) (net.IP, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("%s returned %q, expected an IP address", url, strings.TrimSpace(string(body)))
+	}
+	return ip, nil
+}
+
+// stunPublicIP 向 STUN 服务器发送绑定请求（RFC 5389），返回服务器看到的来源地址
+func stunPublicIP(server string) (net.IP, error) {
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingReq)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1024)
+	timeout := 500 * time.Millisecond
+	for i := 0; i < 4; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			timeout *= 2
+			continue
+		}
+		if n < 20 || binary.BigEndian.Uint16(buf[0:2]) != stunBindingResp || string(buf[8:20]) != string(req[8:20]) {
+			continue
+		}
+		return parseSTUNAddress(buf[20:n], req[8:20])
+	}
+	return nil, fmt.Errorf("no response from STUN server %s", server)
+}
+
+// parseSTUNAddress 从绑定响应的属性中取出 XOR-MAPPED-ADDRESS（或旧的 MAPPED-ADDRESS）
+func parseSTUNAddress(attrs, txID []byte) (net.IP, error) {
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		length := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+length {
+			break
+		}
+		value := attrs[4 : 4+length]
+		// 属性按4字节对齐
+		attrs = attrs[4+(length+3)&^3:]
+
+		if len(value) < 8 || (typ != stunXorMappedAddr && typ != stunMappedAddr) {
+			continue
+		}
+		var ip net.IP
+		switch value[1] {
+		case 0x01:
+			ip = append(net.IP(nil), value[4:8]...)
+		case 0x02:
+			if len(value) < 20 {
+				continue
+			}
+			ip = append(net.IP(nil), value[4:20]...)
+		default:
+			continue
+		}
+		if typ == stunXorMappedAddr {
+			// 地址与魔数及事务ID异或（IPv4 只用到魔数）
+			key := make([]byte, 16)
+			binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+			copy(key[4:], txID)
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+			return ip, nil
+		}
+		mapped = ip
+	}
+	if mapped != nil {
+		return mapped, nil
+	}
+	return nil, errors.New("STUN response has no mapped address")
+}
+
+// publicAddr 规则的公网访问地址：有路由器端口映射时使用映射，否则为公网IP加监听端口
+func publicAddr(rule Rule) (string, error) {
+	if external, ok := portMappingAddr(rule.ID); ok {
+		return external, nil
+	}
+	ip, _, err := detectPublicIP()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, rule.ListenPort), nil
+}
+
+// apiGetPublicIP 获取检测到的公网地址，refresh=1 时忽略缓存
+func apiGetPublicIP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("refresh") == "1" {
+		publicIPCache.Lock()
+		publicIPCache.at = time.Time{}
+		publicIPCache.Unlock()
+	}
+
+	ip, source, err := detectPublicIP()
+	result := struct {
+		IP     string `json:"ip,omitempty"`
+		Source string `json:"source"`
+		Error  string `json:"error,omitempty"`
+	}{IP: ip, Source: source}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// updateQRCodeRequest apiUpdateQRCode 的请求体
+type updateQRCodeRequest struct {
+	RuleID string        `json:"ruleId"`
+	QR     *QRCodeConfig `json:"qr"`
+}
+
+// apiUpdateQRCode 设置规则二维码的 scheme 与路径，qr 为 null 时恢复为 "ip:port"
+func apiUpdateQRCode(w http.ResponseWriter, r *http.Request) {
+	_, ok := updateRuleOption(w, r, "QR code", func(req *updateQRCodeRequest, _ Rule) (func(rule *Rule), error) {
+		if req.QR != nil {
+			req.QR.Scheme = strings.TrimSuffix(strings.TrimSpace(req.QR.Scheme), "://")
+			req.QR.Path = strings.TrimSpace(req.QR.Path)
+			if err := req.QR.Validate(); err != nil {
+				return nil, err
+			}
+			if *req.QR == (QRCodeConfig{}) {
+				req.QR = nil
+			}
+		}
+		return func(rule *Rule) { rule.QRCode = req.QR }, nil
+	})
+	if ok {
+		json.NewEncoder(w).Encode(Result{Success: true})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// maxRecentTargets 每条规则保留的历史目标数量
+const maxRecentTargets = 5
+
+// rememberTarget 将目标地址记入规则的最近使用列表（最新的在前）
+func rememberTarget(rule *Rule, targetAddr, targetPort string) {
+	if targetAddr == "" || targetPort == "" {
+		return
+	}
+	target := net.JoinHostPort(targetAddr, targetPort)
+
+	recent := []string{target}
+	for _, t := range rule.RecentTargets {
+		if t != target && len(recent) < maxRecentTargets {
+			recent = append(recent, t)
+		}
+	}
+	rule.RecentTargets = recent
+}
+
+// apiGetRecentTargets 获取规则最近使用过的目标
+func apiGetRecentTargets(w http.ResponseWriter, r *http.Request) {
+	rule, ok := findRule(r.URL.Query().Get("ruleId"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	type recentTarget struct {
+		Addr string `json:"addr"`
+		Port string `json:"port"`
+	}
+	targets := []recentTarget{}
+	for _, t := range rule.RecentTargets {
+		host, port, err := net.SplitHostPort(t)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, recentTarget{Addr: host, Port: port})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(targets)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/google/uuid"
+)
+
+// relayTokenEnv 中继节点令牌的环境变量，未设置 -relay-token 时使用
+const relayTokenEnv = "GOPORTS_RELAY_TOKEN"
+
+// maxRelayHops 一条规则最多经过的中继节点数
+const maxRelayHops = 8
+
+var relayLog = newLogger("relay")
+
+// relayNode 本机作为中继节点时的监听器，退出时关闭
+var relayNode struct {
+	sync.Mutex
+	listener net.Listener
+}
+
+// startRelayNode 按 -relay-listen 作为中继节点接受其他 go-ports 实例的链路连接
+func startRelayNode() {
+	if *relayListen == "" {
+		return
+	}
+	token := *relayToken
+	if token == "" {
+		token = os.Getenv(relayTokenEnv)
+	}
+	if token == "" {
+		relayLog.Errorf("Relay node not started: -relay-token or $%s is required", relayTokenEnv)
+		return
+	}
+
+	listener, err := net.Listen("tcp", *relayListen)
+	if err != nil {
+		relayLog.Errorf("Failed to start relay node on %s: %v", *relayListen, err)
+		return
+	}
+	relayNode.Lock()
+	relayNode.listener = listener
+	relayNode.Unlock()
+	relayLog.Infof("Relay node listening on %s", listener.Addr())
+
+	server := &forward.RelayServer{Token: token, Log: relayLog}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			relayLog.Errorf("Relay node stopped: %v", err)
+		}
+	}()
+}
+
+// stopRelayNode 停止接受新的中继连接，已建立的连接不受影响
+func stopRelayNode() {
+	relayNode.Lock()
+	defer relayNode.Unlock()
+	if relayNode.listener != nil {
+		relayNode.listener.Close()
+		relayNode.listener = nil
+	}
+}
+
+// ruleRelayChain 规则经过的中继节点链路，解密各节点的令牌
+func ruleRelayChain(rule Rule) (forward.RelayChain, error) {
+	settings := currentSettings()
+	chain := make(forward.RelayChain, 0, len(rule.Via))
+	for _, id := range rule.Via {
+		node, ok := settings.FindRelayNode(id)
+		if !ok {
+			return nil, fmt.Errorf("relay node %s not found", id)
+		}
+		token, err := decryptSecret(node.Token)
+		if err != nil {
+			return nil, fmt.Errorf("relay node %s: token: %w", relayNodeLabel(node), err)
+		}
+		chain = append(chain, forward.RelayHop{Addr: node.Addr, Token: token})
+	}
+	return chain, nil
+}
+
+// ruleDialer 规则连接目标使用的拨号器：中继节点链路或 SSH 跳板机，都未设置时为 nil
+func ruleDialer(rule Rule) forward.Dialer {
+	if len(rule.Via) == 0 {
+		return ruleSSHDialer(rule)
+	}
+	chain, err := ruleRelayChain(rule)
+	if err != nil {
+		return failedDialer{err}
+	}
+	return chain
+}
+
+// relayNodeLabel 日志与错误中显示的节点名称
+func relayNodeLabel(node RelayNode) string {
+	if node.Name != "" {
+		return node.Name
+	}
+	return node.Addr
+}
+
+// relayNodeRules 经过中继节点的规则
+func relayNodeRules(id string) []Rule {
+	var rules []Rule
+	for _, rule := range ruleStore.Rules() {
+		for _, via := range rule.Via {
+			if via == id {
+				rules = append(rules, rule)
+				break
+			}
+		}
+	}
+	return rules
+}
+
+// RelayNodeStatus 中继节点的信息，不含令牌
+type RelayNodeStatus struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Addr     string   `json:"addr"`
+	HasToken bool     `json:"hasToken"`
+	Rules    []string `json:"rules"` // 经过此节点的规则ID
+}
+
+// relayNodeStatus 生成中继节点的信息
+func relayNodeStatus(node RelayNode) RelayNodeStatus {
+	status := RelayNodeStatus{
+		ID:       node.ID,
+		Name:     node.Name,
+		Addr:     node.Addr,
+		HasToken: node.Token != "",
+		Rules:    []string{},
+	}
+	for _, rule := range relayNodeRules(node.ID) {
+		status.Rules = append(status.Rules, rule.ID)
+	}
+	return status
+}
+
+// apiGetRelayNodes 获取中继节点列表
+func apiGetRelayNodes(w http.ResponseWriter, r *http.Request) {
+	nodes := []RelayNodeStatus{}
+	for _, node := range currentSettings().RelayNodes {
+		nodes = append(nodes, relayNodeStatus(node))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// updateRelayNodeRequest apiUpdateRelayNode 的请求体。Token 为明文，为 null 时保持原值
+type updateRelayNodeRequest struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Addr  string  `json:"addr"`
+	Token *string `json:"token"`
+}
+
+// apiUpdateRelayNode 新增或修改中继节点（ID为空时新增），令牌加密后保存在设置中。
+// 经过它的规则正在运行的转发会重启
+func apiUpdateRelayNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req updateRelayNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	node := RelayNode{ID: req.ID}
+	if req.ID != "" {
+		existing, ok := currentSettings().FindRelayNode(req.ID)
+		if !ok {
+			http.Error(w, "Relay node not found", http.StatusNotFound)
+			return
+		}
+		node = existing
+	} else {
+		node.ID = uuid.New().String()
+	}
+	node.Name = strings.TrimSpace(req.Name)
+	node.Addr = strings.TrimSpace(req.Addr)
+
+	if _, _, err := net.SplitHostPort(node.Addr); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid relay node address %q, use host:port", node.Addr))
+		return
+	}
+	if req.Token != nil {
+		token := strings.TrimSpace(*req.Token)
+		if token == "" {
+			writeError(w, http.StatusBadRequest, "relay node token is required")
+			return
+		}
+		var err error
+		if node.Token, err = encryptSecret(token); err != nil {
+			log.Printf("Failed to encrypt relay node token: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to encrypt token")
+			return
+		}
+	}
+	if node.Token == "" {
+		writeError(w, http.StatusBadRequest, "relay node token is required")
+		return
+	}
+
+	_, err := updateSettings(func(settings *Settings) {
+		nodes := make([]RelayNode, 0, len(settings.RelayNodes)+1)
+		replaced := false
+		for _, n := range settings.RelayNodes {
+			if n.ID == node.ID {
+				n, replaced = node, true
+			}
+			nodes = append(nodes, n)
+		}
+		if !replaced {
+			nodes = append(nodes, node)
+		}
+		settings.RelayNodes = nodes
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+
+	for _, rule := range relayNodeRules(node.ID) {
+		if err := restartRuleForwards(rule, rule, requestSource(r)); err != nil {
+			relayLog.Errorf("Failed to restart rule %s after relay node change: %v", ruleDisplayName(rule), err)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "relayNode": relayNodeStatus(node)})
+}
+
+// apiDeleteRelayNode 删除中继节点，仍有规则经过时拒绝
+func apiDeleteRelayNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req idRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if rules := relayNodeRules(req.ID); len(rules) > 0 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("relay node is used by %d rule(s)", len(rules)))
+		return
+	}
+	_, err := updateSettings(func(settings *Settings) {
+		var kept []RelayNode
+		for _, node := range settings.RelayNodes {
+			if node.ID != req.ID {
+				kept = append(kept, node)
+			}
+		}
+		settings.RelayNodes = kept
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// validateRuleVia 校验规则经过的中继节点：必须存在且不重复，不能与 SSH 跳板机、出接口或透明代理同时使用
+func validateRuleVia(rule Rule) error {
+	if len(rule.Via) == 0 {
+		return nil
+	}
+	if len(rule.Via) > maxRelayHops {
+		return fmt.Errorf("at most %d relay nodes", maxRelayHops)
+	}
+	settings := currentSettings()
+	seen := make(map[string]bool, len(rule.Via))
+	for _, id := range rule.Via {
+		if _, ok := settings.FindRelayNode(id); !ok {
+			return fmt.Errorf("relay node %s not found", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("relay node %s appears more than once", id)
+		}
+		seen[id] = true
+	}
+	switch {
+	case rule.SSHHost != "":
+		return errors.New("relay nodes cannot be used with an SSH host")
+	case rule.Bind.Enabled():
+		return errors.New("relay nodes cannot be used with an outbound interface")
+	case rule.Transparent:
+		return errors.New("relay nodes cannot be used with transparent proxy")
+	}
+	return nil
+}
+
+// updateRuleViaRequest apiUpdateRuleVia 的请求体
+type updateRuleViaRequest struct {
+	RuleID string   `json:"ruleId"`
+	Via    []string `json:"via"`
+}
+
+// apiUpdateRuleVia 设置规则依次经过哪些中继节点连接目标，via 为空时直接连接。
+// 正在运行的转发会重启以应用新配置
+func apiUpdateRuleVia(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "relay nodes", func(req *updateRuleViaRequest, current Rule) (func(rule *Rule), error) {
+		if len(req.Via) == 0 {
+			req.Via = nil
+		}
+		current.Via = req.Via
+		if err := validateRuleVia(current); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.Via = req.Via }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
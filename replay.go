@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ReplayStatus 规则最近一次流量回放的状态
+type ReplayStatus struct {
+	Running       bool       `json:"running"`
+	Protocol      string     `json:"protocol"`
+	Speed         float64    `json:"speed"`
+	Flows         int        `json:"flows"`
+	Packets       int        `json:"packets"`
+	BytesSent     int64      `json:"bytesSent"`
+	BytesReceived int64      `json:"bytesReceived"`
+	StartedAt     time.Time  `json:"startedAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	Errors        []string   `json:"errors,omitempty"`
+}
+
+// replayFlow 同一客户端发往服务端口的一组数据包
+type replayFlow struct {
+	client  string
+	packets []pcapPacket
+}
+
+var replayState = struct {
+	sync.Mutex
+	status map[string]*ReplayStatus // 规则ID -> 回放状态
+}{
+	status: make(map[string]*ReplayStatus),
+}
+
+// captureFilePath 规则抓包文件路径
+func captureFilePath(ruleID string) string {
+	return filepath.Join(".", "db", "captures", ruleID+".pcap")
+}
+
+// buildReplayFlows 按客户端分组发往指定端口的数据包，TCP 去除重传
+func buildReplayFlows(packets []pcapPacket, protocol string, ports map[int]bool) []*replayFlow {
+	var flows []*replayFlow
+	byClient := make(map[string]*replayFlow)
+	nextSeq := make(map[string]uint32)
+
+	for _, p := range packets {
+		if p.Protocol != protocol || !ports[p.DstPort] {
+			continue
+		}
+		client := net.JoinHostPort(p.Src.String(), strconv.Itoa(p.SrcPort))
+
+		if protocol == "tcp" {
+			if p.SYN {
+				nextSeq[client] = p.Seq + 1
+				continue
+			}
+			if len(p.Payload) == 0 {
+				continue
+			}
+			// 跳过重传数据，裁剪部分重叠的段
+			if expected, ok := nextSeq[client]; ok {
+				behind := int32(expected - p.Seq)
+				if behind >= int32(len(p.Payload)) {
+					continue
+				}
+				if behind > 0 {
+					p.Payload = p.Payload[behind:]
+					p.Seq = expected
+				}
+			}
+			nextSeq[client] = p.Seq + uint32(len(p.Payload))
+		} else if len(p.Payload) == 0 {
+			continue
+		}
+
+		flow := byClient[client]
+		if flow == nil {
+			flow = &replayFlow{client: client}
+			byClient[client] = flow
+			flows = append(flows, flow)
+		}
+		flow.packets = append(flow.packets, p)
+	}
+	return flows
+}
+
+// replayDialAddr 回放连接的目标：规则的监听地址，通配地址改为本机回环
+func replayDialAddr(rule Rule) string {
+	addr := rule.ListenAddr
+	if ip := net.ParseIP(addr); addr == "" || (ip != nil && ip.IsUnspecified()) {
+		if ip != nil && ip.To4() == nil {
+			addr = "::1"
+		} else {
+			addr = "127.0.0.1"
+		}
+	}
+	return net.JoinHostPort(addr, rule.ListenPort)
+}
+
+// runReplay 通过规则的监听端口回放所有流，speed 为 0 时不等待原始时间间隔
+func runReplay(rule Rule, protocol string, flows []*replayFlow, speed float64, status *ReplayStatus) {
+	var base time.Time
+	for _, flow := range flows {
+		if t := flow.packets[0].Time; base.IsZero() || t.Before(base) {
+			base = t
+		}
+	}
+	start := time.Now()
+	addr := replayDialAddr(rule)
+
+	var wg sync.WaitGroup
+	for _, flow := range flows {
+		wg.Add(1)
+		go func(flow *replayFlow) {
+			defer wg.Done()
+			if err := replayOneFlow(protocol, addr, flow, base, start, speed, status); err != nil {
+				replayState.Lock()
+				status.Errors = append(status.Errors, fmt.Sprintf("%s: %v", flow.client, err))
+				replayState.Unlock()
+			}
+		}(flow)
+	}
+	wg.Wait()
+
+	replayState.Lock()
+	finished := time.Now()
+	status.Running = false
+	status.FinishedAt = &finished
+	replayState.Unlock()
+
+	log.Printf("Replay finished for rule %s: %d flows, %d bytes sent, %d bytes received, %d errors",
+		ruleDisplayName(rule), status.Flows, status.BytesSent, status.BytesReceived, len(status.Errors))
+}
+
+// replayOneFlow 建立一个连接并按时间顺序发送该流的数据
+func replayOneFlow(protocol, addr string, flow *replayFlow, base, start time.Time, speed float64, status *ReplayStatus) error {
+	wait := func(p pcapPacket) {
+		if speed <= 0 {
+			return
+		}
+		at := start.Add(time.Duration(float64(p.Time.Sub(base)) / speed))
+		if d := time.Until(at); d > 0 {
+			time.Sleep(d)
+		}
+	}
+
+	// 首个数据包之前不建立连接，保留原始的连接先后顺序
+	wait(flow.packets[0])
+	conn, err := net.DialTimeout(protocol, addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// 读取并丢弃响应，只统计字节数
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				replayState.Lock()
+				status.BytesReceived += int64(n)
+				replayState.Unlock()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, p := range flow.packets {
+		wait(p)
+		if _, err := conn.Write(p.Payload); err != nil {
+			return err
+		}
+		replayState.Lock()
+		status.BytesSent += int64(len(p.Payload))
+		replayState.Unlock()
+	}
+
+	// 发送完毕后等待目标响应
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	<-done
+	return nil
+}
+
+// maxReplayUploadSize 上传回放的抓包文件的最大大小
+const maxReplayUploadSize = 64 << 20
+
+// apiReplay 回放抓包流量
+// 请求体为 pcap 文件内容；source=capture 时使用规则自身的抓包文件
+func apiReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(status int, err error) {
+		writeError(w, status, err.Error())
+	}
+
+	rule, ok := findRule(query.Get("ruleId"))
+	if !ok {
+		fail(http.StatusNotFound, errors.New("rule not found"))
+		return
+	}
+
+	protocol := query.Get("protocol")
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		fail(http.StatusBadRequest, errors.New("replay supports tcp and udp only"))
+		return
+	}
+	if !isRuleForwardRunning(rule, protocol) {
+		fail(http.StatusConflict, fmt.Errorf("%s forward of this rule is not running", protocol))
+		return
+	}
+
+	speed := 1.0
+	if s := query.Get("speed"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			fail(http.StatusBadRequest, errors.New("invalid speed"))
+			return
+		}
+		speed = v
+	}
+
+	// 默认匹配发往监听端口或目标端口的数据包（抓包可能位于任一侧）
+	ports := make(map[int]bool)
+	if p := query.Get("port"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			fail(http.StatusBadRequest, errors.New("invalid port"))
+			return
+		}
+		ports[n] = true
+	} else {
+		for _, p := range []string{rule.ListenPort, rule.TargetPort} {
+			if n, err := strconv.Atoi(p); err == nil {
+				ports[n] = true
+			}
+		}
+	}
+
+	var src io.Reader = http.MaxBytesReader(w, r.Body, maxReplayUploadSize)
+	if query.Get("source") == "capture" {
+		file, err := os.Open(captureFilePath(rule.ID))
+		if err != nil {
+			fail(http.StatusNotFound, err)
+			return
+		}
+		defer file.Close()
+		src = file
+	}
+
+	packets, err := readPcap(src)
+	if err != nil && len(packets) == 0 {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	flows := buildReplayFlows(packets, protocol, ports)
+	if len(flows) == 0 {
+		fail(http.StatusBadRequest, errors.New("no matching packets in capture"))
+		return
+	}
+
+	replayState.Lock()
+	if st := replayState.status[rule.ID]; st != nil && st.Running {
+		replayState.Unlock()
+		fail(http.StatusConflict, errors.New("a replay is already running for this rule"))
+		return
+	}
+	status := &ReplayStatus{Running: true, Protocol: protocol, Speed: speed, Flows: len(flows), StartedAt: time.Now()}
+	for _, flow := range flows {
+		status.Packets += len(flow.packets)
+	}
+	replayState.status[rule.ID] = status
+	replayState.Unlock()
+
+	log.Printf("Replaying %d %s flows (%d packets) through rule %s at %gx", status.Flows, protocol, status.Packets, ruleDisplayName(rule), speed)
+	go runReplay(rule, protocol, flows, speed, status)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"flows":   status.Flows,
+		"packets": status.Packets,
+	})
+}
+
+// apiGetReplay 获取规则最近一次回放的状态
+func apiGetReplay(w http.ResponseWriter, r *http.Request) {
+	ruleID := r.URL.Query().Get("ruleId")
+
+	replayState.Lock()
+	var status ReplayStatus
+	st, ok := replayState.status[ruleID]
+	if ok {
+		status = *st
+		status.Errors = append([]string(nil), st.Errors...)
+	}
+	replayState.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		json.NewEncoder(w).Encode(nil)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
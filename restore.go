@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// runningStateDelay 转发启停后延迟保存运行状态，合并短时间内的多次变化
+const runningStateDelay = 500 * time.Millisecond
+
+// RestoreResult 启动时恢复一个转发失败的记录
+type RestoreResult struct {
+	RuleID        string `json:"ruleId"`
+	Name          string `json:"name"`
+	Protocol      string `json:"protocol"`
+	Error         string `json:"error"`
+	SuggestedPort string `json:"suggestedPort,omitempty"` // 端口被占用时建议的可用端口
+}
+
+// runningState 规则运行状态的持久化
+var runningState = struct {
+	sync.Mutex
+	changed  chan struct{}
+	frozen   bool            // 退出时冻结，保留退出前记录的状态
+	failures []RestoreResult // 启动时恢复失败的转发
+}{changed: make(chan struct{}, 1)}
+
+// markRunningChanged 通知运行状态有变化，由 Forwarder.OnChange 调用，不阻塞
+func markRunningChanged() {
+	select {
+	case runningState.changed <- struct{}{}:
+	default:
+	}
+}
+
+// startRunningStatePersister 在后台把每条规则正在运行的协议保存到 Rule.Running
+func startRunningStatePersister() {
+	go func() {
+		for range runningState.changed {
+			time.Sleep(runningStateDelay)
+			saveRunningState()
+		}
+	}()
+}
+
+// saveRunningState 记录当前运行的协议，有变化时保存
+func saveRunningState() {
+	runningState.Lock()
+	defer runningState.Unlock()
+	if runningState.frozen {
+		return
+	}
+
+	// 在 RuleStore 锁外查询转发状态，避免与 Forwarder 的锁互相等待
+	running := make(map[string][]string)
+	for _, rule := range ruleStore.Rules() {
+		running[rule.ID] = runningProtocols(rule)
+	}
+
+	err := ruleStore.UpdateRules(func(rules []Rule) bool {
+		changed := false
+		for i := range rules {
+			protocols, ok := running[rules[i].ID]
+			if ok && !reflect.DeepEqual(protocols, rules[i].Running) {
+				rules[i].Running = protocols
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		log.Printf("Failed to save running state: %v", err)
+	}
+}
+
+// freezeRunningState 保存当前运行状态并停止后续更新，退出时停止转发前调用
+func freezeRunningState() {
+	saveRunningState()
+	runningState.Lock()
+	runningState.frozen = true
+	runningState.Unlock()
+}
+
+// restoreRunningState 恢复上次退出时正在运行的转发。
+// 端口已无法绑定的转发会被记录并从运行状态中移除，使保存的状态与实际一致
+func restoreRunningState() {
+	lg := newLogger("restore")
+	var failures []RestoreResult
+	for _, rule := range ruleStore.Rules() {
+		for _, protocol := range rule.Running {
+			if isRuleForwardRunning(rule, protocol) {
+				continue // 已由 autoStart 开启
+			}
+			if err := startRuleForward(rule, protocol, sourceRestore); err != nil {
+				result := startFailureResult(err, protocol, rule.ListenAddr, rule.ListenPort)
+				failures = append(failures, RestoreResult{
+					RuleID:        rule.ID,
+					Name:          ruleDisplayName(rule),
+					Protocol:      protocol,
+					Error:         result.Error,
+					SuggestedPort: result.SuggestedPort,
+				})
+				lg.WithRule(rule.ID).Warnf("Failed to restore %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+				continue
+			}
+			lg.WithRule(rule.ID).Infof("Restored %s forward of rule %s", protocol, ruleDisplayName(rule))
+		}
+	}
+
+	runningState.Lock()
+	runningState.failures = failures
+	runningState.Unlock()
+
+	// 按实际结果重新记录运行状态
+	markRunningChanged()
+}
+
+// apiGetRestoreReport 获取启动时恢复失败的转发
+func apiGetRestoreReport(w http.ResponseWriter, r *http.Request) {
+	runningState.Lock()
+	failures := append([]RestoreResult{}, runningState.failures...)
+	runningState.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"failures": failures})
+}
+
+// apiDismissRestoreReport 清除恢复失败的记录
+func apiDismissRestoreReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runningState.Lock()
+	runningState.failures = nil
+	runningState.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// maxRoutes 一条规则路由表的最大项数
+const maxRoutes = 64
+
+// validateRoutes 检查路由表，返回规范化后的路由表（目标端口支持服务名）
+func validateRoutes(listenPort string, routes []forward.Route) ([]forward.Route, error) {
+	if len(routes) > maxRoutes {
+		return nil, fmt.Errorf("at most %d routes are allowed", maxRoutes)
+	}
+	if len(routes) > 0 && forward.IsPortRange(listenPort) {
+		return nil, errors.New("routes are not supported with port ranges")
+	}
+
+	list := make([]forward.Route, 0, len(routes))
+	for _, route := range routes {
+		route.Host = strings.TrimSpace(route.Host)
+		route.Prefix = strings.ToLower(strings.TrimSpace(route.Prefix))
+		route.Target = strings.TrimSpace(route.Target)
+		if err := route.Validate(); err != nil {
+			return nil, err
+		}
+		host, port, _ := net.SplitHostPort(route.Target)
+		port, err := resolvePort(port)
+		if err != nil {
+			return nil, fmt.Errorf("route target %s: %w", route.Target, err)
+		}
+		if host == "" || forward.IsPortRange(port) {
+			return nil, fmt.Errorf("invalid route target %q, use addr:port", route.Target)
+		}
+		route.Target = net.JoinHostPort(host, port)
+		list = append(list, route)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list, nil
+}
+
+// updateRoutesRequest apiUpdateRoutes 的请求体
+type updateRoutesRequest struct {
+	RuleID string          `json:"ruleId"`
+	Routes []forward.Route `json:"routes"`
+}
+
+// apiUpdateRoutes 设置规则的路由表（仅TCP）：按 TLS SNI、HTTP Host 或连接开头的字节把连接转发到不同目标，
+// 没有匹配的路由项时使用规则的目标；routes 为空时不嗅探。正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateRoutes(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "routes", func(req *updateRoutesRequest, current Rule) (func(rule *Rule), error) {
+		routes, err := validateRoutes(current.ListenPort, req.Routes)
+		if err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.Routes = routes }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
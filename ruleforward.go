@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
+)
+
+// forwardProtocols 规则支持的转发协议
+var forwardProtocols = forward.Protocols
+
+// startRuleForward 按协议启动规则的转发，并以 source 为来源记入规则的事件历史
+func startRuleForward(rule Rule, protocol, source string) error {
+	err := startForward(rule, protocol)
+	recordForwardEvent(rule, RuleEventStart, protocol, source, err)
+	return err
+}
+
+// startForward 按协议启动规则的转发，目标中的变量按当前环境展开
+func startForward(rule Rule, protocol string) error {
+	if protocol != "socks5" {
+		var err error
+		if rule, err = resolveRule(rule); err != nil {
+			return err
+		}
+	}
+	switch protocol {
+	case "tcp":
+		return forwarder.StartTCPForward(rule.ListenAddr, rule.ListenPort, rule.TargetAddr, rule.TargetPort)
+	case "udp":
+		return forwarder.StartUDPForward(rule.ListenAddr, rule.ListenPort, rule.TargetAddr, rule.TargetPort)
+	case "sctp":
+		return forwarder.StartSCTPForward(rule.ListenAddr, rule.ListenPort, rule.TargetAddr, rule.TargetPort)
+	case "socks5":
+		return forwarder.StartSOCKS5Forward(rule.ListenAddr, rule.ListenPort)
+	}
+	return errors.New("unknown protocol " + protocol)
+}
+
+// stopRuleForward 按协议停止规则的转发，并以 source 为来源记入规则的事件历史
+func stopRuleForward(rule Rule, protocol, source string) error {
+	err := stopForward(rule, protocol)
+	recordForwardEvent(rule, RuleEventStop, protocol, source, err)
+	if err == nil && source != sourceNetwork {
+		forgetLostForward(rule.ID, protocol)
+	}
+	return err
+}
+
+// ruleProtocolError 规则单个协议启停失败的原因
+type ruleProtocolError struct {
+	Protocol string
+	Err      error
+}
+
+// startRuleProtocols 开启规则的指定协议，未指定时开启 TCP/UDP，已在运行的协议跳过
+func startRuleProtocols(rule Rule, protocols []string, source string) (started []string, failed []ruleProtocolError) {
+	if len(protocols) == 0 {
+		protocols = []string{"tcp", "udp"}
+	}
+	for _, protocol := range protocols {
+		if isRuleForwardRunning(rule, protocol) {
+			continue
+		}
+		var err error
+		if protocol != "socks5" && (rule.TargetAddr == "" || rule.TargetPort == "") {
+			err = errors.New("rule has no target")
+		} else {
+			err = startRuleForward(rule, protocol, source)
+		}
+		if err != nil {
+			failed = append(failed, ruleProtocolError{Protocol: protocol, Err: err})
+			continue
+		}
+		started = append(started, protocol)
+	}
+	return started, failed
+}
+
+// stopRuleProtocols 停止规则的指定协议，未指定时停止所有正在运行的协议，未运行的协议跳过
+func stopRuleProtocols(rule Rule, protocols []string, source string) (stopped []string, failed []ruleProtocolError) {
+	if len(protocols) == 0 {
+		protocols = runningProtocols(rule)
+	}
+	for _, protocol := range protocols {
+		if !isRuleForwardRunning(rule, protocol) {
+			continue
+		}
+		if err := stopRuleForward(rule, protocol, source); err != nil {
+			failed = append(failed, ruleProtocolError{Protocol: protocol, Err: err})
+			continue
+		}
+		stopped = append(stopped, protocol)
+	}
+	return stopped, failed
+}
+
+// stopForward 按协议停止规则的转发。监听地址上运行的是目标不同的另一条规则时不停止
+func stopForward(rule Rule, protocol string) error {
+	if target, ok := forwarder.Target(protocol, rule.ListenAddr, rule.ListenPort); ok && protocol != "socks5" && !ruleOwnsForward(rule, protocol) {
+		return fmt.Errorf("%s forward on %s belongs to another rule (target %s)", strings.ToUpper(protocol), net.JoinHostPort(rule.ListenAddr, rule.ListenPort), target)
+	}
+	switch protocol {
+	case "tcp":
+		return forwarder.StopTCPForward(rule.ListenAddr, rule.ListenPort)
+	case "udp":
+		return forwarder.StopUDPForward(rule.ListenAddr, rule.ListenPort)
+	case "sctp":
+		return forwarder.StopSCTPForward(rule.ListenAddr, rule.ListenPort)
+	case "socks5":
+		return forwarder.StopSOCKS5Forward(rule.ListenAddr, rule.ListenPort)
+	}
+	return errors.New("unknown protocol " + protocol)
+}
+
+// startAutoStartRules 开启所有标记为自动开启的规则的 TCP/UDP 转发
+func startAutoStartRules() {
+	for _, rule := range ruleStore.Rules() {
+		if !rule.AutoStart || rule.ListenPort == "" || rule.TargetAddr == "" || rule.TargetPort == "" {
+			continue
+		}
+		lg := newLogger("autostart").WithRule(rule.ID)
+		for _, protocol := range []string{"tcp", "udp"} {
+			if err := startRuleForward(rule, protocol, sourceAutoStart); err != nil {
+				lg.Errorf("Auto-start: failed to start %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+				continue
+			}
+			lg.Infof("Auto-start: started %s forward of rule %s", protocol, ruleDisplayName(rule))
+		}
+	}
+}
+
+// isRuleForwardRunning 检查规则在某协议下是否在转发。多条规则监听同一地址时，
+// 只有目标与正在运行的转发一致的规则算在运行
+func isRuleForwardRunning(rule Rule, protocol string) bool {
+	switch protocol {
+	case "tcp", "udp", "sctp":
+		return ruleOwnsForward(rule, protocol)
+	case "socks5":
+		return forwarder.IsSOCKS5Running(rule.ListenAddr, rule.ListenPort)
+	}
+	return false
+}
+
+// ruleOwnsForward 判断规则监听地址上正在运行的转发是否就是该规则的：
+// 端口范围中任一端口的目标与规则按当前环境展开后对应的目标一致即可
+func ruleOwnsForward(rule Rule, protocol string) bool {
+	rule = resolvedRule(rule)
+	ports := []string{rule.ListenPort}
+	if forward.IsPortRange(rule.ListenPort) {
+		pairs, err := forward.ExpandPortRange(rule.ListenPort, "")
+		if err != nil {
+			return false
+		}
+		ports = ports[:0]
+		for _, pair := range pairs {
+			ports = append(ports, pair.Listen)
+		}
+	}
+	for _, port := range ports {
+		target, ok := forwarder.Target(protocol, rule.ListenAddr, port)
+		if ok && target == store.ForwardTarget(rule, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleForwardStats 规则在 protocol 下正在运行的转发的统计。只统计目标与规则一致的转发，
+// 监听同一地址的其他规则正在运行时返回 false
+func ruleForwardStats(rule Rule, protocol string) (forward.StatsSnapshot, bool) {
+	rule = resolvedRule(rule)
+	return forwarder.Stats(protocol, rule.ListenAddr, rule.ListenPort, rule.TargetAddr, rule.TargetPort)
+}
+
+// runningProtocols 返回规则当前正在转发的协议
+func runningProtocols(rule Rule) []string {
+	var running []string
+	for _, protocol := range forwardProtocols {
+		if isRuleForwardRunning(rule, protocol) {
+			running = append(running, protocol)
+		}
+	}
+	return running
+}
+
+// findRule 按ID查找规则
+func findRule(id string) (Rule, bool) {
+	return ruleStore.Rule(id)
+}
+
+// findRuleByListen 按监听地址查找规则
+func findRuleByListen(listenAddr, listenPort string) (Rule, bool) {
+	return ruleStore.RuleByListen(listenAddr, listenPort)
+}
+
+// findRuleByTarget 按监听地址与转发目标查找规则，目标用于区分监听同一地址的多条规则
+func findRuleByTarget(listenAddr, listenPort, target string) (Rule, bool) {
+	return ruleStore.RuleByTarget(listenAddr, listenPort, target)
+}
+
+// forwardRule 返回监听地址上正在运行的转发所属的规则
+func forwardRule(protocol, listenAddr, listenPort string) (Rule, bool) {
+	if target, ok := forwarder.Target(protocol, listenAddr, listenPort); ok {
+		return findRuleByTarget(listenAddr, listenPort, target)
+	}
+	return findRuleByListen(listenAddr, listenPort)
+}
+
+// listenLogger 返回附带监听地址与目标对应规则ID的日志记录器
+func listenLogger(lg *Logger, listenAddr, listenPort, target string) *Logger {
+	if rule, ok := findRuleByTarget(listenAddr, listenPort, target); ok {
+		return lg.WithRule(rule.ID)
+	}
+	return lg
+}
+
+// ruleForwardOptions 根据监听地址与目标对应的规则生成转发选项
+func ruleForwardOptions(listenAddr, listenPort, target string) forward.Options {
+	rule, ok := findRuleByTarget(listenAddr, listenPort, target)
+	if !ok {
+		return forward.Options{}
+	}
+	rule = resolvedRule(rule)
+	opts := forward.Options{
+		Log:       forwardLog.WithRule(rule.ID),
+		LogJA3:    rule.LogJA3,
+		Emulation: rule.Emulation,
+		Priority:  forward.ParsePriority(rule.Priority),
+		TLS:       rule.TLSTarget.ClientConfig(rule.TargetAddr),
+		SOCKS5:    rule.SOCKS5,
+		Balance:   rule.Balance,
+		Retry:     rule.Retry,
+		TCP:       rule.TCPTuning,
+		Dialer:    ruleDialer(rule),
+		Bind:      rule.Bind,
+
+		Transparent: rule.Transparent,
+		Relay:       rule.UDPRelay,
+		Limits:      ruleConnLimits(rule),
+		Slots:       ruleConnSlots(rule),
+		Tap:         ruleCaptureTap(rule),
+	}
+	// 端口范围的目标端口逐个对应，不使用额外目标与路由表
+	if !forward.IsPortRange(rule.ListenPort) {
+		opts.Targets = rule.Targets
+		opts.Routes = rule.Routes
+	}
+	if rule.Health != nil && rule.Health.Enabled {
+		opts.Healthy = func(target string) bool { return targetHealthy(rule.ID, target) }
+		opts.Backup = rule.Health.BackupTarget()
+	}
+	return opts
+}
+
+// restartRuleForwards 停止 old 正在运行的转发，并以 updated 的配置重新启动，失败时以 source 为来源记入事件历史。
+// 监听地址不变时已建立的连接不受影响，否则随旧的转发一起关闭。非界面或 API 触发的重启会发送通知
+func restartRuleForwards(old, updated Rule, source string) error {
+	return restartForwards(old, updated, runningProtocols(old), source)
+}
+
+// restartForwards 以 updated 的配置重启 old 在 protocols 下正在运行的转发，目标中的变量按当前环境展开
+func restartForwards(old, updated Rule, protocols []string, source string) error {
+	sameListen := old.ListenAddr == updated.ListenAddr && old.ListenPort == updated.ListenPort
+	for _, protocol := range protocols {
+		var err error
+		if sameListen {
+			var target Rule
+			if target, err = resolveRule(updated); err == nil {
+				err = forwarder.Restart(protocol, updated.ListenAddr, updated.ListenPort, target.TargetAddr, target.TargetPort)
+			}
+		} else {
+			stopForward(old, protocol)
+			err = startForward(updated, protocol)
+		}
+		if err != nil {
+			recordForwardEvent(updated, "restart", protocol, source, err)
+			return err
+		}
+		if source != sourceUI && source != sourceAPI {
+			notify(Notification{
+				Event:   "forward.restarted",
+				RuleID:  updated.ID,
+				Title:   fmt.Sprintf("%s forward restarted on %s", strings.ToUpper(protocol), ruleDisplayName(updated)),
+				Message: fmt.Sprintf("forward was restarted automatically by %s", source),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// 规则各项设置的读取与修改接口共用的流程：按 ruleId 查找规则，修改时解析请求体、校验、保存并记录配置修改事件
+
+// getRuleOption 返回规则的一项设置，fields 从规则中取出响应的字段
+func getRuleOption(w http.ResponseWriter, r *http.Request, fields func(rule Rule) map[string]interface{}) {
+	rule, ok := findRule(r.URL.Query().Get("ruleId"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	resp := fields(rule)
+	resp["success"] = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// updateRuleOption 修改规则的一项设置：解析请求体（T 需有 ruleId 字段）并查找规则，
+// apply 按规则当前的配置校验、规范化请求，返回修改规则的函数。setting 为设置的名称，用于事件历史。
+// 失败时（包括保存失败，此时规则保持原样）已写入错误响应并返回 false，成功时返回修改后的规则，由调用方写入响应
+func updateRuleOption[T any](w http.ResponseWriter, r *http.Request, setting string, apply func(req *T, current Rule) (func(rule *Rule), error)) (Rule, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return Rule{}, false
+	}
+
+	var body json.RawMessage
+	var target struct {
+		RuleID string `json:"ruleId"`
+	}
+	var req T
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err == nil {
+		err = json.Unmarshal(body, &target)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return Rule{}, false
+	}
+
+	current, ok := ruleStore.EditableRule(target.RuleID)
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return Rule{}, false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	change, err := apply(&req, current)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return Rule{}, false
+	}
+
+	rule, err := updateRuleConfig(r, target.RuleID, setting, change)
+	if errors.Is(err, store.ErrRuleNotFound) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return Rule{}, false
+	}
+	if err != nil {
+		log.Printf("Failed to save rules: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save rules")
+		return Rule{}, false
+	}
+	return rule, true
+}
+
+// restartUpdatedRule 在规则的设置修改后重启它正在运行的转发以应用新配置，已建立的连接不受影响
+func restartUpdatedRule(w http.ResponseWriter, r *http.Request, rule Rule) {
+	if err := restartRuleForwards(rule, rule, requestSource(r)); err != nil {
+		writeError(w, startFailureStatus(err), err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// RuleStatus 规则及其正在运行的协议
+type RuleStatus struct {
+	Rule       Rule                                `json:"rule"`
+	Active     []string                            `json:"active"`               // 正在转发的协议
+	Recovering map[string]forward.ListenerRecovery `json:"recovering,omitempty"` // 按协议，监听意外退出、正在重新监听的转发
+}
+
+// ruleActionRequest /api/v2/rules/{id}/start 与 /stop 的请求体，可以省略
+type ruleActionRequest struct {
+	Protocols []string `json:"protocols"` // 为空时开启 TCP 与 UDP，停止时为所有正在运行的协议
+}
+
+// RuleActionResult 按ID开启或停止规则的结果，已在运行（或未运行）的协议不计入
+type RuleActionResult struct {
+	Success       bool             `json:"success"`
+	Error         string           `json:"error,omitempty"` // 第一个失败的协议的错误
+	RuleID        string           `json:"ruleId"`
+	Started       []string         `json:"started,omitempty"`
+	Stopped       []string         `json:"stopped,omitempty"`
+	Failed        []ForwardFailure `json:"failed"`
+	SuggestedPort string           `json:"suggestedPort,omitempty"` // 端口被占用时建议的可用端口
+}
+
+// newRuleStatus 返回规则及其正在运行的协议
+func newRuleStatus(rule Rule) RuleStatus {
+	active := runningProtocols(rule)
+	if active == nil {
+		active = []string{}
+	}
+	status := RuleStatus{Rule: rule, Active: active}
+	for _, protocol := range active {
+		if recovery, ok := forwarder.Recovery(protocol, rule.ListenAddr, rule.ListenPort); ok {
+			if status.Recovering == nil {
+				status.Recovering = map[string]forward.ListenerRecovery{}
+			}
+			status.Recovering[protocol] = recovery
+		}
+	}
+	return status
+}
+
+// apiV2Rules 列出所有规则及其正在运行的协议
+func apiV2Rules(w http.ResponseWriter, r *http.Request) {
+	list := []RuleStatus{}
+	for _, rule := range ruleStore.Rules() {
+		list = append(list, newRuleStatus(rule))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// apiV2Rule 获取单条规则及其正在运行的协议
+func apiV2Rule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := findRule(pathParam(r, "id"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRuleStatus(rule))
+}
+
+// decodeRuleAction 查找路径中的规则并解析要处理的协议，失败时已写出响应
+func decodeRuleAction(w http.ResponseWriter, r *http.Request) (Rule, []string, bool) {
+	rule, ok := findRule(pathParam(r, "id"))
+	if !ok {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return Rule{}, nil, false
+	}
+
+	var req ruleActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return Rule{}, nil, false
+	}
+	for _, protocol := range req.Protocols {
+		if _, err := bulkProtocols(protocol, nil); err != nil || protocol == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown protocol %q", protocol))
+			return Rule{}, nil, false
+		}
+	}
+	return rule, req.Protocols, true
+}
+
+// apiV2StartRule 按ID开启规则的转发，不需要知道规则的监听地址
+func apiV2StartRule(w http.ResponseWriter, r *http.Request) {
+	rule, protocols, ok := decodeRuleAction(w, r)
+	if !ok {
+		return
+	}
+
+	started, failed := startRuleProtocols(rule, protocols, requestSource(r))
+	result := RuleActionResult{RuleID: rule.ID, Started: started, Failed: []ForwardFailure{}}
+	status := http.StatusOK
+	for _, f := range failed {
+		log.Printf("Failed to start %s forward of rule %s: %v", f.Protocol, ruleDisplayName(rule), f.Err)
+		failure := startFailureResult(f.Err, f.Protocol, rule.ListenAddr, rule.ListenPort)
+		if len(result.Failed) == 0 {
+			result.Error = failure.Error
+			result.SuggestedPort = failure.SuggestedPort
+			status = startFailureStatus(f.Err)
+		}
+		result.Failed = append(result.Failed, ForwardFailure{RuleID: rule.ID, Protocol: f.Protocol, Error: failure.Error})
+	}
+
+	result.Success = len(result.Failed) == 0
+	writeJSON(w, status, result)
+}
+
+// apiV2StopRule 按ID停止规则的转发
+func apiV2StopRule(w http.ResponseWriter, r *http.Request) {
+	rule, protocols, ok := decodeRuleAction(w, r)
+	if !ok {
+		return
+	}
+
+	stopped, failed := stopRuleProtocols(rule, protocols, requestSource(r))
+	result := RuleActionResult{RuleID: rule.ID, Stopped: stopped, Failed: []ForwardFailure{}}
+	for _, f := range failed {
+		log.Printf("Failed to stop %s forward of rule %s: %v", f.Protocol, ruleDisplayName(rule), f.Err)
+		if len(result.Failed) == 0 {
+			result.Error = f.Err.Error()
+		}
+		result.Failed = append(result.Failed, ForwardFailure{RuleID: rule.ID, Protocol: f.Protocol, Error: f.Err.Error()})
+	}
+
+	result.Success = len(result.Failed) == 0
+	status := http.StatusOK
+	if !result.Success {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleInterval 定时规则的检查间隔
+const scheduleInterval = 15 * time.Second
+
+// scheduleState 各规则上次检查时是否在时间窗口内
+var scheduleState = struct {
+	sync.Mutex
+	inWindow map[string]bool
+}{inWindow: make(map[string]bool)}
+
+// resetScheduleState 清除规则的定时状态，下一次检查时按当前时间重新开关
+func resetScheduleState(ruleID string) {
+	scheduleState.Lock()
+	delete(scheduleState.inWindow, ruleID)
+	scheduleState.Unlock()
+}
+
+// startSchedules 启动定时开关循环，启动时立即检查一次
+func startSchedules() {
+	go func() {
+		runSchedules(time.Now())
+		ticker := time.NewTicker(scheduleInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runSchedules(now)
+		}
+	}()
+}
+
+// runSchedules 检查所有定时规则，进入或离开时间窗口时开启或停止转发
+func runSchedules(now time.Time) {
+	for _, rule := range ruleStore.Rules() {
+		if rule.Schedule == nil || !rule.Schedule.Enabled {
+			resetScheduleState(rule.ID)
+			continue
+		}
+		active := rule.Schedule.Active(now)
+
+		scheduleState.Lock()
+		last, seen := scheduleState.inWindow[rule.ID]
+		scheduleState.inWindow[rule.ID] = active
+		scheduleState.Unlock()
+
+		if !seen || last != active {
+			applySchedule(rule, active)
+		}
+	}
+}
+
+// applySchedule 按是否在时间窗口内开启或停止规则的定时协议
+func applySchedule(rule Rule, active bool) {
+	lg := newLogger("schedule").WithRule(rule.ID)
+	var changed []string
+	for _, protocol := range rule.Schedule.EffectiveProtocols() {
+		if isRuleForwardRunning(rule, protocol) == active {
+			continue
+		}
+		if active {
+			if err := startRuleForward(rule, protocol, sourceScheduler); err != nil {
+				lg.Errorf("Schedule: failed to start %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+				continue
+			}
+		} else if err := stopRuleForward(rule, protocol, sourceScheduler); err != nil {
+			lg.Errorf("Schedule: failed to stop %s forward of rule %s: %v", protocol, ruleDisplayName(rule), err)
+			continue
+		}
+		changed = append(changed, strings.ToUpper(protocol))
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	if active {
+		lg.Infof("Schedule: started %s forward of rule %s", strings.Join(changed, "/"), ruleDisplayName(rule))
+		notify(Notification{
+			Event:   "schedule.start",
+			RuleID:  rule.ID,
+			Title:   fmt.Sprintf("Scheduled start of %s", ruleDisplayName(rule)),
+			Message: fmt.Sprintf("started %s forward", strings.Join(changed, "/")),
+		})
+		return
+	}
+	lg.Infof("Schedule: stopped %s forward of rule %s", strings.Join(changed, "/"), ruleDisplayName(rule))
+	notify(Notification{
+		Event:   "schedule.stop",
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("Scheduled stop of %s", ruleDisplayName(rule)),
+		Message: fmt.Sprintf("stopped %s forward", strings.Join(changed, "/")),
+	})
+}
+
+// updateScheduleRequest apiUpdateSchedule 的请求体
+type updateScheduleRequest struct {
+	RuleID   string    `json:"ruleId"`
+	Schedule *Schedule `json:"schedule"`
+}
+
+// apiUpdateSchedule 设置规则的定时开关，schedule 为 null 时取消定时。
+// 保存后立即按当前时间开启或停止转发
+func apiUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "schedule", func(req *updateScheduleRequest, _ Rule) (func(rule *Rule), error) {
+		if req.Schedule != nil {
+			if err := req.Schedule.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.Schedule = req.Schedule }, nil
+	})
+	if !ok {
+		return
+	}
+
+	resetScheduleState(rule.ID)
+	if rule.Schedule != nil && rule.Schedule.Enabled {
+		runSchedules(time.Now())
+	}
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
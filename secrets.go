@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// secretKeyPath 加密保存在设置中的密码与私钥的密钥，首次使用时随机生成。
+// 复制 data.json 到其他机器时需要一并复制此文件，否则无法解密
+var secretKeyPath = filepath.Join(".", "db", "secret.key")
+
+// secretPrefix 加密后的值的前缀，后接 base64 编码的 nonce 与 AES-GCM 密文
+const secretPrefix = "enc:v1:"
+
+// secretKey 加载或生成的 AES-256 密钥
+var secretKey struct {
+	once sync.Once
+	key  []byte
+	err  error
+}
+
+// loadSecretKey 读取密钥文件，不存在时生成新密钥
+func loadSecretKey() ([]byte, error) {
+	secretKey.once.Do(func() {
+		key, err := os.ReadFile(secretKeyPath)
+		if errors.Is(err, os.ErrNotExist) {
+			key = make([]byte, 32)
+			if _, err = rand.Read(key); err == nil {
+				err = store.WriteFileAtomic(secretKeyPath, key, 0600)
+			}
+		}
+		if err == nil && len(key) != 32 {
+			err = fmt.Errorf("%s must be 32 bytes", secretKeyPath)
+		}
+		secretKey.key, secretKey.err = key, err
+	})
+	return secretKey.key, secretKey.err
+}
+
+// secretAEAD 以密钥创建 AES-GCM
+func secretAEAD() (cipher.AEAD, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, fmt.Errorf("secret key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret 加密要保存的密码或私钥，空字符串保持为空
+func encryptSecret(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密 encryptSecret 加密的值
+func decryptSecret(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	encoded, ok := strings.CutPrefix(value, secretPrefix)
+	if !ok {
+		return "", errors.New("value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt, %s may have changed", secretKeyPath)
+	}
+	return string(plain), nil
+}
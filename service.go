@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// serviceName 系统服务名称
+const serviceName = "port-forwarder"
+
+// serviceDisplayName 系统服务显示名称
+const serviceDisplayName = "Port Forwarder"
+
+// serviceCommands 管理系统服务的子命令
+var serviceCommands = map[string]func() error{
+	"install-service":   installService,
+	"uninstall-service": uninstallService,
+	"start-service":     startService,
+	"stop-service":      stopService,
+}
+
+// runServiceCommand 执行服务管理子命令，不是服务子命令时返回 false
+func runServiceCommand(args []string) (int, bool) {
+	fn, ok := serviceCommands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: %s takes no arguments, put flags for the service before the command\n", args[0])
+		return 2, true
+	}
+	if err := fn(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1, true
+	}
+	return 0, true
+}
+
+// serviceExecutable 当前可执行文件的绝对路径
+func serviceExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// serviceSecretFlags 值为密码或令牌的参数，不写入服务的命令行（单元文件与服务配置其他用户可读），
+// 而是保存在数据目录中只有所有者可读的 serviceEnvFile
+var serviceSecretFlags = map[string]bool{
+	"ui-password":          true,
+	"api-token":            true,
+	"api-basic-auth":       true,
+	"mqtt-password":        true,
+	"snmp-community":       true,
+	"relay-token":          true,
+	"agent-token":          true,
+	"controller-token":     true,
+	"notify-smtp-password": true,
+}
+
+// serviceEnvFile 服务的密钥参数文件（相对数据目录），格式与 systemd 的 EnvironmentFile 相同
+var serviceEnvFile = filepath.Join("db", "service.env")
+
+// serviceEnvName 密钥参数在 serviceEnvFile 中的变量名，如 ui-password 为 GOPORTS_UI_PASSWORD
+func serviceEnvName(name string) string {
+	return "GOPORTS_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// serviceArgs 服务启动时的参数：无界面模式、当前目录作为数据目录，以及执行安装命令时设置的其他参数。
+// 密钥参数不在其中，按参数名单独返回
+func serviceArgs() ([]string, map[string]string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	args := []string{"-headless", "-workdir=" + dir}
+	secrets := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "headless", "workdir", "service", "api", "totp":
+			return
+		}
+		if serviceSecretFlags[f.Name] {
+			secrets[f.Name] = f.Value.String()
+			return
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+	})
+	return args, secrets, nil
+}
+
+// sortedSecretFlags 按名称排序的密钥参数名
+func sortedSecretFlags(secrets map[string]string) []string {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeServiceEnv 把密钥参数写入 serviceEnvFile（权限 0600），值加双引号并转义；没有密钥参数时删除该文件
+func writeServiceEnv(secrets map[string]string) error {
+	if len(secrets) == 0 {
+		if err := os.Remove(serviceEnvFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`)
+	var b strings.Builder
+	for _, name := range sortedSecretFlags(secrets) {
+		value := secrets[name]
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("-%s must not contain line breaks", name)
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"\n", serviceEnvName(name), escape.Replace(value))
+	}
+	if err := os.WriteFile(serviceEnvFile, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	// 文件已存在时 WriteFile 不修改权限
+	return os.Chmod(serviceEnvFile, 0600)
+}
+
+// loadServiceEnv 读取 serviceEnvFile，设置命令行没有给出的密钥参数。Windows 服务启动时使用，
+// systemd 以 EnvironmentFile 读取该文件并在命令行中展开
+func loadServiceEnv() error {
+	file, err := os.Open(serviceEnvFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	byEnv := make(map[string]string, len(serviceSecretFlags))
+	for name := range serviceSecretFlags {
+		byEnv[serviceEnvName(name)] = name
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, quoted, ok := strings.Cut(scanner.Text(), "=")
+		name, known := byEnv[key]
+		if !ok || !known || given[name] {
+			continue
+		}
+		quoted = strings.TrimSuffix(strings.TrimPrefix(quoted, `"`), `"`)
+		var value strings.Builder
+		for i := 0; i < len(quoted); i++ {
+			if quoted[i] == '\\' && i+1 < len(quoted) {
+				i++
+			}
+			value.WriteByte(quoted[i])
+		}
+		if err := flag.Set(name, value.String()); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// systemdUnitPath systemd 单元文件路径
+var systemdUnitPath = filepath.Join("/etc/systemd/system", serviceName+".service")
+
+// systemdUnit 生成 systemd 单元文件，以当前目录作为数据目录。密钥参数在命令行中引用
+// EnvironmentFile（serviceEnvFile）中的变量，单元文件本身不含密钥
+func systemdUnit(secrets map[string]string) (string, error) {
+	exe, err := serviceExecutable()
+	if err != nil {
+		return "", err
+	}
+	args, _, err := serviceArgs()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	command := []string{systemdQuote(exe)}
+	for _, arg := range args {
+		command = append(command, systemdQuote(arg))
+	}
+	environment := ""
+	if len(secrets) > 0 {
+		environment = "EnvironmentFile=" + systemdPath(filepath.Join(dir, serviceEnvFile)) + "\n"
+		for _, name := range sortedSecretFlags(secrets) {
+			command = append(command, fmt.Sprintf("-%s=${%s}", name, serviceEnvName(name)))
+		}
+	}
+	// 停止时先优雅关闭，多留几秒再强制结束
+	stopTimeout := *shutdownTimeout + 5*time.Second
+
+	return fmt.Sprintf(`[Unit]
+Description=%s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+%sExecStart=%s
+WorkingDirectory=%s
+Restart=on-failure
+RestartSec=5
+KillSignal=SIGTERM
+TimeoutStopSec=%d
+
+[Install]
+WantedBy=multi-user.target
+`, serviceDisplayName, environment, strings.Join(command, " "), systemdPath(dir), int(stopTimeout.Seconds())), nil
+}
+
+// systemdQuote 转义命令行参数中 systemd 会展开的 %（说明符）与 $（环境变量），
+// 包含空白或引号的参数加上双引号
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// systemdPath 转义路径设置（WorkingDirectory、EnvironmentFile）中的 %，这些设置不去除引号、不展开环境变量
+func systemdPath(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// systemctl 执行 systemctl 命令，失败时附带其输出
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installService 写入 systemd 单元文件与密钥参数文件并设置开机启动
+func installService() error {
+	_, secrets, err := serviceArgs()
+	if err != nil {
+		return err
+	}
+	unit, err := systemdUnit(secrets)
+	if err != nil {
+		return err
+	}
+	if err := writeServiceEnv(secrets); err != nil {
+		return fmt.Errorf("write %s: %w", serviceEnvFile, err)
+	}
+	if err := os.WriteFile(systemdUnitPath, []byte(unit), 0644); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("writing %s requires root, run with sudo or install this unit manually:\n\n%s", systemdUnitPath, unit)
+		}
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", serviceName); err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s, data is kept in the current directory\nStart it with: port-forwarder start-service\n", systemdUnitPath)
+	return nil
+}
+
+// uninstallService 停止服务并删除单元文件
+func uninstallService() error {
+	if _, err := os.Stat(systemdUnitPath); os.IsNotExist(err) {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	if err := systemctl("disable", "--now", serviceName); err != nil {
+		return err
+	}
+	if err := os.Remove(systemdUnitPath); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s\n", systemdUnitPath)
+	return nil
+}
+
+// startService 启动服务
+func startService() error {
+	return systemctl("start", serviceName)
+}
+
+// stopService 停止服务，服务会优雅关闭转发
+func stopService() error {
+	return systemctl("stop", serviceName)
+}
+
+// runAsService 只在 Windows 上需要向服务管理器报告状态
+func runAsService() error {
+	return errors.New("-service is only used on Windows; systemd runs the program directly")
+}
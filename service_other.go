@@ -0,0 +1,20 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+)
+
+// errServiceUnsupported 当前平台不支持安装系统服务
+var errServiceUnsupported = errors.New("installing as a service is only supported on Windows and Linux (systemd)")
+
+func installService() error   { return errServiceUnsupported }
+func uninstallService() error { return errServiceUnsupported }
+func startService() error     { return errServiceUnsupported }
+func stopService() error      { return errServiceUnsupported }
+
+// runAsService 只在 Windows 上需要向服务管理器报告状态
+func runAsService() error {
+	return errors.New("-service is only supported on Windows")
+}
@@ -0,0 +1,182 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// 服务管理器常量
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped     = 1
+	serviceStopPending = 3
+	serviceRunning     = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop     = 1
+	serviceControlShutdown = 5
+)
+
+var (
+	advapi32                         = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW  = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+// serviceStatus 对应 SERVICE_STATUS
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry 对应 SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// serviceStatusHandle RegisterServiceCtrlHandlerExW 返回的句柄
+var serviceStatusHandle uintptr
+
+// setServiceState 向服务管理器报告状态
+func setServiceState(state uint32) {
+	status := serviceStatus{ServiceType: serviceWin32OwnProcess, CurrentState: state}
+	switch state {
+	case serviceRunning:
+		status.ControlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	case serviceStopPending:
+		status.WaitHint = uint32((*shutdownTimeout).Milliseconds()) + 5000
+	}
+	procSetServiceStatus.Call(serviceStatusHandle, uintptr(unsafe.Pointer(&status)))
+}
+
+// serviceHandler 处理服务管理器的控制请求，停止或关机时优雅关闭转发后退出
+func serviceHandler(control, eventType, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceState(serviceStopPending)
+		go func() {
+			log.Printf("Service stop requested, shutting down (timeout %s)", *shutdownTimeout)
+			shutdown(*shutdownTimeout)
+			log.Println("Shutdown complete")
+			setServiceState(serviceStopped)
+			os.Exit(0)
+		}()
+	}
+	return 0
+}
+
+// serviceMain 服务入口，注册控制处理函数并报告运行中，转发由主协程继续启动
+func serviceMain(argc, argv uintptr) uintptr {
+	name, _ := syscall.UTF16PtrFromString(serviceName)
+	h, _, err := procRegisterServiceCtrlHandlerEx.Call(uintptr(unsafe.Pointer(name)), syscall.NewCallback(serviceHandler), 0)
+	if h == 0 {
+		log.Printf("Failed to register service control handler: %v", err)
+		return 0
+	}
+	serviceStatusHandle = h
+	setServiceState(serviceRunning)
+	select {}
+}
+
+// runAsService 连接到服务管理器。服务分派器在单独的系统线程上运行直到进程退出
+func runAsService() error {
+	name, err := syscall.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		table := []serviceTableEntry{{name: name, proc: syscall.NewCallback(serviceMain)}, {}}
+		if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+			errc <- fmt.Errorf("not started by the service manager: %v", err)
+		}
+	}()
+	// 分派器成功时一直阻塞，稍等片刻以报告未被服务管理器启动的错误
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(2 * time.Second):
+		return nil
+	}
+}
+
+// sc 执行 sc.exe 命令，失败时附带其输出
+func sc(args ...string) error {
+	out, err := exec.Command("sc.exe", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sc %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installService 注册为开机自动启动的 Windows 服务，失败时自动重启（需要管理员权限）
+func installService() error {
+	exe, err := serviceExecutable()
+	if err != nil {
+		return err
+	}
+	args, secrets, err := serviceArgs()
+	if err != nil {
+		return err
+	}
+	// 密钥参数不放进服务配置，服务启动时从数据目录读取
+	if err := writeServiceEnv(secrets); err != nil {
+		return fmt.Errorf("write %s: %w", serviceEnvFile, err)
+	}
+	command := []string{syscall.EscapeArg(exe), "-service"}
+	for _, arg := range args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+
+	if err := sc("create", serviceName, "binPath=", strings.Join(command, " "), "start=", "auto", "DisplayName=", serviceDisplayName); err != nil {
+		return err
+	}
+	if err := sc("description", serviceName, "Forwards TCP/UDP ports according to the rules in db/data.json"); err != nil {
+		return err
+	}
+	if err := sc("failure", serviceName, "reset=", "86400", "actions=", "restart/5000/restart/5000/restart/30000"); err != nil {
+		return err
+	}
+	fmt.Printf("Installed service %s, data is kept in the current directory\nStart it with: port-forwarder start-service\n", serviceName)
+	return nil
+}
+
+// uninstallService 停止并删除服务
+func uninstallService() error {
+	sc("stop", serviceName)
+	if err := sc("delete", serviceName); err != nil {
+		return err
+	}
+	fmt.Printf("Removed service %s\n", serviceName)
+	return nil
+}
+
+// startService 启动服务
+func startService() error {
+	return sc("start", serviceName)
+}
+
+// stopService 停止服务，服务会优雅关闭转发
+func stopService() error {
+	return sc("stop", serviceName)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// serviceTable 内置的服务名到端口映射表（IANA 常用部分）
+var serviceTable = map[string]int{
+	"ftp-data":      20,
+	"ftp":           21,
+	"ssh":           22,
+	"telnet":        23,
+	"smtp":          25,
+	"dns":           53,
+	"domain":        53,
+	"tftp":          69,
+	"http":          80,
+	"pop3":          110,
+	"ntp":           123,
+	"imap":          143,
+	"snmp":          161,
+	"ldap":          389,
+	"https":         443,
+	"smb":           445,
+	"submission":    587,
+	"ldaps":         636,
+	"imaps":         993,
+	"pop3s":         995,
+	"mssql":         1433,
+	"openvpn":       1194,
+	"mqtt":          1883,
+	"nfs":           2049,
+	"mysql":         3306,
+	"rdp":           3389,
+	"ms-wbt-server": 3389,
+	"postgres":      5432,
+	"postgresql":    5432,
+	"vnc":           5900,
+	"redis":         6379,
+	"http-alt":      8080,
+	"mqtts":         8883,
+	"minecraft":     25565,
+	"mongodb":       27017,
+	"wireguard":     51820,
+}
+
+// errUnknownPort 端口既不是数字、端口范围，也不是已知的服务名
+var errUnknownPort = errors.New("unknown port or service name")
+
+// resolvePort 将端口字符串解析为数字端口，支持服务名（如 ssh、https、rdp）与端口范围（如 8000-8100）
+// 空字符串原样返回，便于规则在编辑过程中保存未填写的端口
+func resolvePort(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 65535 {
+			return "", fmt.Errorf("port %d out of range (1-65535)", n)
+		}
+		return strconv.Itoa(n), nil
+	}
+
+	if n, ok := serviceTable[strings.ToLower(s)]; ok {
+		return strconv.Itoa(n), nil
+	}
+
+	// 端口范围，如 8000-8100
+	if forward.IsPortRange(s) {
+		start, end, err := forward.ParsePortRange(s)
+		if err != nil {
+			return "", err
+		}
+		if start == end {
+			return strconv.Itoa(start), nil
+		}
+		return fmt.Sprintf("%d-%d", start, end), nil
+	}
+
+	return "", fmt.Errorf("%w %q", errUnknownPort, s)
+}
+
+// apiResolvePort 解析端口或服务名，返回数字端口。未知的服务名返回 404，超出范围等格式错误返回 400
+func apiResolvePort(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("port")
+
+	port, err := resolvePort(name)
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, errUnknownPort) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "port": port})
+}
+
+// resolvePorts 就地解析多个端口字段，遇到第一个错误即返回
+func resolvePorts(ports ...*string) error {
+	for _, p := range ports {
+		resolved, err := resolvePort(*p)
+		if err != nil {
+			return err
+		}
+		*p = resolved
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// 转发缓冲区的默认大小与允许范围（字节）
+const (
+	defaultTCPBufferSize = forward.DefaultTCPBufferSize
+	defaultUDPBufferSize = forward.DefaultUDPBufferSize
+	minBufferSize        = 1024
+	maxTCPBufferSize     = 1024 * 1024
+	maxUDPBufferSize     = forward.MaxDatagramSize
+	minSocketBufferSize  = 4096
+	maxSocketBufferSize  = 64 * 1024 * 1024
+)
+
+// supportedLanguages 界面支持的语言，为空时按浏览器语言
+var supportedLanguages = map[string]bool{"zh": true, "en": true}
+
+// settingFlags 设置项对应的命令行参数，参数显式指定时覆盖设置
+var settingFlags = map[string][]string{
+	"uiListen":       {"listen"},
+	"uiPort":         {"port"},
+	"uiAllow":        {"ui-allow"},
+	"logLevel":       {"log-level", "debug"},
+	"apiToken":       {"api-token"},
+	"restoreRunning": {"restore"},
+}
+
+// activeSettings 当前生效的设置，启动时加载、更新时替换
+var activeSettings atomic.Pointer[Settings]
+
+// currentSettings 返回当前设置，尚未加载时为零值
+func currentSettings() Settings {
+	if s := activeSettings.Load(); s != nil {
+		return *s
+	}
+	return Settings{}
+}
+
+// loadSettings 启动时从 data.json 加载设置
+func loadSettings() {
+	settings, err := storage.LoadSettings()
+	if err != nil {
+		log.Printf("Failed to load settings: %v", err)
+	}
+	activeSettings.Store(&settings)
+}
+
+// updateSettings 修改并保存设置，同时更新生效的设置
+func updateSettings(fn func(settings *Settings)) (Settings, error) {
+	var next Settings
+	err := storage.Update(func(appData *AppData) {
+		next = appData.EffectiveSettings()
+		fn(&next)
+		appData.Settings = &next
+		appData.UI = nil // 旧版本的界面设置已并入 settings
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	activeSettings.Store(&next)
+	return next, nil
+}
+
+// givenFlags 命令行上显式指定的参数，首次使用时（参数已解析）收集
+var givenFlags struct {
+	once  sync.Once
+	names map[string]bool
+}
+
+// flagGiven 判断命令行上是否显式指定了其中任一参数
+func flagGiven(names ...string) bool {
+	givenFlags.once.Do(func() {
+		givenFlags.names = make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			givenFlags.names[f.Name] = true
+		})
+	})
+	for _, name := range names {
+		if givenFlags.names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// overriddenSettings 被命令行参数覆盖的设置项
+func overriddenSettings() []string {
+	overridden := []string{}
+	for _, field := range []string{"uiListen", "uiPort", "uiAllow", "logLevel", "apiToken", "restoreRunning"} {
+		if flagGiven(settingFlags[field]...) {
+			overridden = append(overridden, field)
+		}
+	}
+	return overridden
+}
+
+// tcpBufferSize TCP 转发每个方向的缓冲区大小
+func tcpBufferSize() int {
+	if size := currentSettings().TCPBufferSize; size > 0 {
+		return size
+	}
+	return defaultTCPBufferSize
+}
+
+// udpBufferSize UDP 数据包缓冲区大小
+func udpBufferSize() int {
+	if size := currentSettings().UDPBufferSize; size > 0 {
+		return size
+	}
+	return defaultUDPBufferSize
+}
+
+// udpSocketBuffer UDP 套接字的收发缓冲区大小，0 表示使用系统默认值
+func udpSocketBuffer() int {
+	return currentSettings().UDPSocketBuffer
+}
+
+// autoStartRulesEnabled 启动时是否开启标记了 autoStart 的规则
+func autoStartRulesEnabled() bool {
+	s := currentSettings()
+	return s.AutoStartRules == nil || *s.AutoStartRules
+}
+
+// restoreRunningEnabled 启动时是否恢复上次运行的转发，-restore 显式指定时优先
+func restoreRunningEnabled() bool {
+	s := currentSettings()
+	if flagGiven("restore") || s.RestoreRunning == nil {
+		return *restoreRunning
+	}
+	return *s.RestoreRunning
+}
+
+// validateSettings 校验设置，错误按字段返回
+func validateSettings(s Settings) []FieldError {
+	var errs []FieldError
+	if s.UIListen != "" && net.ParseIP(s.UIListen) == nil && !isValidHostname(s.UIListen) {
+		errs = append(errs, FieldError{Field: "uiListen", Message: fmt.Sprintf("%q is not a valid IP address or hostname", s.UIListen)})
+	}
+	if s.UIPort < 0 || s.UIPort > 65535 {
+		errs = append(errs, FieldError{Field: "uiPort", Message: fmt.Sprintf("port %d out of range (0-65535)", s.UIPort)})
+	}
+	if _, err := parseAllowlist(s.UIAllow); err != nil {
+		errs = append(errs, FieldError{Field: "uiAllow", Message: err.Error()})
+	}
+	if _, ok := logLevelRank[s.LogLevel]; s.LogLevel != "" && !ok {
+		errs = append(errs, FieldError{Field: "logLevel", Message: fmt.Sprintf("unknown log level %q", s.LogLevel)})
+	}
+	if s.TCPBufferSize != 0 && (s.TCPBufferSize < minBufferSize || s.TCPBufferSize > maxTCPBufferSize) {
+		errs = append(errs, FieldError{Field: "tcpBufferSize", Message: fmt.Sprintf("must be between %d and %d bytes", minBufferSize, maxTCPBufferSize)})
+	}
+	if s.UDPBufferSize != 0 && (s.UDPBufferSize < minBufferSize || s.UDPBufferSize > maxUDPBufferSize) {
+		errs = append(errs, FieldError{Field: "udpBufferSize", Message: fmt.Sprintf("must be between %d and %d bytes", minBufferSize, maxUDPBufferSize)})
+	}
+	if s.UDPSocketBuffer != 0 && (s.UDPSocketBuffer < minSocketBufferSize || s.UDPSocketBuffer > maxSocketBufferSize) {
+		errs = append(errs, FieldError{Field: "udpSocketBuffer", Message: fmt.Sprintf("must be between %d and %d bytes", minSocketBufferSize, maxSocketBufferSize)})
+	}
+	if s.Language != "" && !supportedLanguages[s.Language] {
+		errs = append(errs, FieldError{Field: "language", Message: fmt.Sprintf("unsupported language %q", s.Language)})
+	}
+	if strings.ContainsAny(s.APIToken, " \t\r\n") {
+		errs = append(errs, FieldError{Field: "apiToken", Message: "token must not contain whitespace"})
+	}
+	if s.DefaultTemplate != "" {
+		if _, ok := ruleStore.Template(s.DefaultTemplate); !ok {
+			errs = append(errs, FieldError{Field: "defaultTemplate", Message: fmt.Sprintf("template %s not found", s.DefaultTemplate)})
+		}
+	}
+	return errs
+}
+
+// apiGetSettings 获取保存的设置，overridden 为被命令行参数覆盖的设置项
+func apiGetSettings(w http.ResponseWriter, r *http.Request) {
+	settings := currentSettings()
+	settings.SSHHosts = nil   // 含加密的密码与私钥，通过 /api/sshHosts 获取
+	settings.RelayNodes = nil // 含加密的令牌，通过 /api/relayNodes 获取
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings":   settings,
+		"overridden": overriddenSettings(),
+	})
+}
+
+// apiUpdateSettings 修改设置，请求中未提供的字段保持不变。
+// 界面监听地址、端口与 API 令牌在重启后生效，此时返回 restartRequired；来源白名单立即生效，
+// 不能把发出请求的地址排除在外
+func apiUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 在当前设置上解析请求体，只覆盖提供的字段
+	previous := currentSettings()
+	next := previous
+	if err := json.NewDecoder(r.Body).Decode(&next); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	next.UIListen = strings.TrimSpace(next.UIListen)
+	next.UIAllow = strings.TrimSpace(next.UIAllow)
+	next.APIToken = strings.TrimSpace(next.APIToken)
+	next.DefaultTemplate = strings.TrimSpace(next.DefaultTemplate)
+	next.SSHHosts = previous.SSHHosts     // 跳板机通过 /api/sshHosts 管理
+	next.RelayNodes = previous.RelayNodes // 中继节点通过 /api/relayNodes 管理
+	next.Profiles = previous.Profiles     // 环境通过 /api/profiles 管理
+	next.ActiveProfile = previous.ActiveProfile
+
+	w.Header().Set("Content-Type", "application/json")
+	errs := validateSettings(next)
+	if nets, err := parseAllowlist(next.UIAllow); err == nil && !flagGiven("ui-allow") && !allowlistContains(nets, requestIP(r)) {
+		errs = append(errs, FieldError{Field: "uiAllow", Message: fmt.Sprintf("must include your address %s", requestIP(r))})
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrorsResult(errs))
+		return
+	}
+
+	saved, err := updateSettings(func(settings *Settings) {
+		*settings = next
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	if err := loadManagementAllowlist(); err != nil {
+		log.Printf("Invalid management allowlist: %v", err)
+	}
+
+	restart := saved.UIListen != previous.UIListen || saved.UIPort != previous.UIPort || saved.APIToken != previous.APIToken
+	saved.SSHHosts = nil
+	saved.RelayNodes = nil
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "settings": saved, "restartRequired": restart})
+}
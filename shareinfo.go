@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// ShareURL 监听地址按某个 scheme 生成的访问 URL
+type ShareURL struct {
+	Scheme string `json:"scheme"`
+	URL    string `json:"url"`
+}
+
+// ShareInfo 规则监听地址的可分享形式，界面与外部脚本都从这里取，保证内容一致
+type ShareInfo struct {
+	RuleID   string     `json:"ruleId,omitempty"`
+	Endpoint string     `json:"endpoint"` // ip:port，监听所有地址时使用本机的局域网地址
+	URLs     []ShareURL `json:"urls"`     // 按规则的 shareSchemes 生成，未设置时按目标端口推测
+	QR       string     `json:"qr"`       // 二维码的内容，与 /api/getQRCode 一致
+}
+
+// defaultShareSchemes 未设置 shareSchemes 时按目标端口推测的 scheme
+func defaultShareSchemes(rule Rule) []string {
+	port, _ := strconv.Atoi(rule.TargetPort)
+	switch {
+	case port == 443 || port == 8443:
+		return []string{"https"}
+	case port == 3389:
+		return []string{"rdp"}
+	case port >= 5900 && port <= 5999:
+		return []string{"vnc"}
+	case port == 22:
+		return []string{"ssh"}
+	}
+	return []string{"http", "https"}
+}
+
+// shareURL 按 scheme 生成访问 addr 的 URL。RDP 使用 Windows 远程桌面客户端识别的 rdp://full%20address=s: 形式
+func shareURL(scheme, addr string) string {
+	switch scheme {
+	case "rdp":
+		return "rdp://full%20address=s:" + addr
+	case "http", "https":
+		return scheme + "://" + addr + "/"
+	}
+	return scheme + "://" + addr
+}
+
+// lanIP 本机第一个启用的非回环 IPv4 地址，分享监听所有地址的规则时使用
+func lanIP() (string, bool) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", false
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLinkLocalUnicast() {
+				return ipNet.IP.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// shareEndpoint 规则可分享的 ip:port：public 时使用公网地址，有端口映射时使用映射的外部地址，
+// 监听所有地址时使用本机的局域网地址
+func shareEndpoint(rule Rule, public bool) (string, error) {
+	if public {
+		return publicAddr(rule)
+	}
+	if external, ok := portMappingAddr(rule.ID); ok {
+		return external, nil
+	}
+	host := rule.ListenAddr
+	if host == "" || isUnspecifiedHost(host) {
+		if ip, ok := lanIP(); ok {
+			host = ip
+		} else {
+			host = "127.0.0.1"
+		}
+	}
+	return net.JoinHostPort(host, rule.ListenPort), nil
+}
+
+// newShareInfo 生成规则的可分享信息
+func newShareInfo(rule Rule, public bool) (ShareInfo, error) {
+	endpoint, err := shareEndpoint(rule, public)
+	if err != nil {
+		return ShareInfo{}, err
+	}
+	info := ShareInfo{RuleID: rule.ID, Endpoint: endpoint, URLs: []ShareURL{}, QR: endpoint}
+	schemes := rule.ShareSchemes
+	if len(schemes) == 0 {
+		schemes = defaultShareSchemes(rule)
+	}
+	for _, scheme := range schemes {
+		info.URLs = append(info.URLs, ShareURL{Scheme: scheme, URL: shareURL(scheme, endpoint)})
+	}
+	if rule.QRCode != nil {
+		info.QR = rule.QRCode.Content(endpoint)
+	}
+	return info, nil
+}
+
+// shareRule 按 ruleId 或 listenAddr 与 listenPort 查找要分享的规则，没有规则时按监听地址生成
+func shareRule(r *http.Request) (Rule, error) {
+	query := r.URL.Query()
+	if id := query.Get("ruleId"); id != "" {
+		rule, ok := findRule(id)
+		if !ok {
+			return Rule{}, store.ErrRuleNotFound
+		}
+		return rule, nil
+	}
+	listenAddr, listenPort := query.Get("listenAddr"), query.Get("listenPort")
+	if listenPort == "" {
+		return Rule{}, errors.New("ruleId or listenAddr and listenPort are required")
+	}
+	if rule, ok := findRuleByListen(listenAddr, listenPort); ok {
+		return rule, nil
+	}
+	return Rule{ListenAddr: listenAddr, ListenPort: listenPort}, nil
+}
+
+// apiGetShareInfo 获取规则监听地址的 ip:port、各 scheme 的 URL 与二维码内容，public=1 时使用公网地址
+func apiGetShareInfo(w http.ResponseWriter, r *http.Request) {
+	rule, err := shareRule(r)
+	if errors.Is(err, store.ErrRuleNotFound) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info, err := newShareInfo(rule, r.URL.Query().Get("public") == "1")
+	if err != nil {
+		log.Printf("Failed to detect public IP: %v", err)
+		http.Error(w, "Failed to detect public IP: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// updateShareSchemesRequest apiUpdateShareSchemes 的请求体
+type updateShareSchemesRequest struct {
+	RuleID  string   `json:"ruleId"`
+	Schemes []string `json:"schemes"`
+}
+
+// apiUpdateShareSchemes 设置 getShareInfo 为规则生成 URL 的 scheme（如 http、https、rdp、vnc），为空时按目标端口推测
+func apiUpdateShareSchemes(w http.ResponseWriter, r *http.Request) {
+	_, ok := updateRuleOption(w, r, "share schemes", func(req *updateShareSchemesRequest, _ Rule) (func(rule *Rule), error) {
+		var schemes []string
+		seen := make(map[string]bool)
+		for _, scheme := range req.Schemes {
+			scheme = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(scheme), "://"))
+			if scheme == "" || seen[scheme] {
+				continue
+			}
+			if err := (QRCodeConfig{Scheme: scheme}).Validate(); err != nil {
+				return nil, err
+			}
+			seen[scheme] = true
+			schemes = append(schemes, scheme)
+		}
+		if len(schemes) > 10 {
+			return nil, fmt.Errorf("at most 10 schemes, got %d", len(schemes))
+		}
+		return func(rule *Rule) { rule.ShareSchemes = schemes }, nil
+	})
+	if ok {
+		json.NewEncoder(w).Encode(Result{Success: true})
+	}
+}
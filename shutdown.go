@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// handleShutdownSignals 收到 SIGINT/SIGTERM 时优雅退出，再次收到信号则立即退出
+func handleShutdownSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, shutting down (timeout %s)", sig, *shutdownTimeout)
+		go func() {
+			<-signals
+			log.Printf("Received second signal, exiting immediately")
+			os.Exit(1)
+		}()
+
+		shutdown(*shutdownTimeout)
+		log.Println("Shutdown complete")
+		os.Exit(0)
+	}()
+}
+
+// shutdown 记录运行状态、停止所有监听并等待已有连接结束
+func shutdown(timeout time.Duration) {
+	// 先记录每条规则正在运行的协议并冻结，避免停止监听时被清空
+	freezeRunningState()
+
+	// 不再接受其他实例的中继连接
+	stopRelayNode()
+
+	forwarder.Shutdown(timeout)
+
+	// 删除路由器上的端口映射
+	releasePortMappings()
+}
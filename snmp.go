@@ -0,0 +1,508 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SNMP 代理只实现只读的 GET / GETNEXT / GETBULK，支持 v1 与 v2c
+//
+// 规则表位于 -snmp-oid 下的 .1.1.1，按 列.规则序号 组织：
+//
+//	.1  ruleIndex     INTEGER    规则序号 (Seq)
+//	.2  ruleId        STRING
+//	.3  ruleListen    STRING     监听地址
+//	.4  ruleTarget    STRING     目标地址
+//	.5  ruleTCP       INTEGER    1=运行 2=停止
+//	.6  ruleUDP       INTEGER    1=运行 2=停止
+//	.7  ruleSCTP      INTEGER    1=运行 2=停止
+//	.8  ruleBytesIn   Counter64  客户端 -> 目标字节数（各协议之和）
+//	.9  ruleBytesOut  Counter64  目标 -> 客户端字节数
+//	.10 ruleActive    Gauge32    当前活动连接数
+//	.11 ruleTotal     Counter32  累计连接数
+//
+// 默认发布在 NET-SNMP-MIB 中供本地试验使用的 netSnmpPlaypen 下，正式部署可改为自己的企业号
+const snmpDefaultBaseOID = "1.3.6.1.4.1.8072.9999.9999"
+
+// snmpMaxRepetitions GETBULK 每个变量最多返回的后继数，请求中更大的值按此处理
+const snmpMaxRepetitions = 64
+
+// snmpMaxResponseSize 响应报文的上限（字节），不超过以太网上不分片的UDP负载，也限制了反射放大。
+// GETBULK 超出时截断结果，其他请求返回 tooBig
+const snmpMaxResponseSize = 1472
+
+// snmpDropLogInterval 丢弃请求（如团体名错误）的日志间隔，期间其余的只计数
+const snmpDropLogInterval = time.Minute
+
+// BER / SNMP 标签
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	snmpCounter32  = 0x41
+	snmpGauge32    = 0x42
+	snmpTimeTicks  = 0x43
+	snmpCounter64  = 0x46
+
+	snmpNoSuchObject = 0x80
+	snmpEndOfMIBView = 0x82
+
+	pduGetRequest     = 0xA0
+	pduGetNextRequest = 0xA1
+	pduGetResponse    = 0xA2
+	pduGetBulkRequest = 0xA5
+
+	snmpErrTooBig     = 1
+	snmpErrNoSuchName = 2
+	snmpErrGenErr     = 5
+)
+
+// snmpStartTime 用于计算 sysUpTime
+var snmpStartTime = time.Now()
+
+// snmpOID 对象标识符
+type snmpOID []int
+
+// validateOID 检查点分形式的 OID
+func validateOID(s string) error {
+	parts := strings.Split(strings.Trim(s, "."), ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid OID %q", s)
+	}
+	for _, p := range parts {
+		if n, err := strconv.Atoi(p); err != nil || n < 0 {
+			return fmt.Errorf("invalid OID %q", s)
+		}
+	}
+	return nil
+}
+
+// parseOID 解析点分形式的 OID
+func parseOID(s string) snmpOID {
+	parts := strings.Split(strings.Trim(s, "."), ".")
+	oid := make(snmpOID, 0, len(parts))
+	for _, p := range parts {
+		n, _ := strconv.Atoi(p)
+		oid = append(oid, n)
+	}
+	return oid
+}
+
+// compare 按字典序比较两个 OID
+func (o snmpOID) compare(other snmpOID) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		if o[i] != other[i] {
+			if o[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(o) - len(other)
+}
+
+// child 返回追加子节点后的新 OID
+func (o snmpOID) child(ids ...int) snmpOID {
+	out := make(snmpOID, 0, len(o)+len(ids))
+	return append(append(out, o...), ids...)
+}
+
+// snmpVar 变量绑定
+type snmpVar struct {
+	oid   snmpOID
+	tag   byte
+	value []byte // 已编码的值内容（不含标签和长度）
+}
+
+// snmpMIB 根据当前规则与统计生成有序的 MIB 视图
+func snmpMIB() []snmpVar {
+	vars := []snmpVar{
+		{parseOID("1.3.6.1.2.1.1.1.0"), berOctetString, []byte("go-ports port forwarder")},
+		{parseOID("1.3.6.1.2.1.1.3.0"), snmpTimeTicks, berUint(uint64(time.Since(snmpStartTime) / (10 * time.Millisecond)))},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		vars = append(vars, snmpVar{parseOID("1.3.6.1.2.1.1.5.0"), berOctetString, []byte(hostname)})
+	}
+
+	snapshot := ruleStore.Rules()
+
+	table := parseOID(*snmpBaseOID).child(1, 1, 1)
+	for _, rule := range snapshot {
+		total, _ := ruleTotals(rule)
+
+		idx := rule.Seq
+		vars = append(vars,
+			snmpVar{table.child(1, idx), berInteger, berInt(int64(rule.Seq))},
+			snmpVar{table.child(2, idx), berOctetString, []byte(rule.ID)},
+			snmpVar{table.child(3, idx), berOctetString, []byte(net.JoinHostPort(rule.ListenAddr, rule.ListenPort))},
+			snmpVar{table.child(4, idx), berOctetString, []byte(net.JoinHostPort(rule.TargetAddr, rule.TargetPort))},
+			snmpVar{table.child(5, idx), berInteger, snmpTruthValue(isRuleForwardRunning(rule, "tcp"))},
+			snmpVar{table.child(6, idx), berInteger, snmpTruthValue(isRuleForwardRunning(rule, "udp"))},
+			snmpVar{table.child(7, idx), berInteger, snmpTruthValue(isRuleForwardRunning(rule, "sctp"))},
+			snmpVar{table.child(8, idx), snmpCounter64, berUint(uint64(total.BytesIn))},
+			snmpVar{table.child(9, idx), snmpCounter64, berUint(uint64(total.BytesOut))},
+			snmpVar{table.child(10, idx), snmpGauge32, berUint(uint64(total.ActiveConns))},
+			snmpVar{table.child(11, idx), snmpCounter32, berUint(uint64(uint32(total.TotalConns)))},
+		)
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].oid.compare(vars[j].oid) < 0
+	})
+	return vars
+}
+
+// snmpTruthValue SNMPv2 TruthValue：1=true 2=false
+func snmpTruthValue(b bool) []byte {
+	if b {
+		return berInt(1)
+	}
+	return berInt(2)
+}
+
+// startSNMPAgent 启动只读 SNMP 代理
+func startSNMPAgent() {
+	if *snmpListen == "" {
+		return
+	}
+	if *snmpCommunity == "" {
+		log.Printf("SNMP agent not started: -snmp-community is required")
+		return
+	}
+	if err := validateOID(*snmpBaseOID); err != nil {
+		log.Printf("SNMP agent not started: -snmp-oid: %v", err)
+		return
+	}
+
+	conn, err := net.ListenPacket("udp", *snmpListen)
+	if err != nil {
+		log.Printf("Failed to start SNMP agent on %s: %v", *snmpListen, err)
+		return
+	}
+	log.Printf("SNMP agent listening on %s", *snmpListen)
+
+	go func() {
+		buf := make([]byte, 65535)
+		var lastDropLog time.Time
+		suppressed := 0
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Printf("SNMP agent stopped: %v", err)
+				return
+			}
+			resp, err := handleSNMPRequest(buf[:n])
+			if err != nil {
+				// 错误的团体名等请求可能大量到来，限制日志频率
+				if time.Since(lastDropLog) < snmpDropLogInterval {
+					suppressed++
+					continue
+				}
+				if suppressed > 0 {
+					log.Printf("Dropped SNMP request from %s: %v (%d more dropped since last report)", addr, err, suppressed)
+				} else {
+					log.Printf("Dropped SNMP request from %s: %v", addr, err)
+				}
+				lastDropLog, suppressed = time.Now(), 0
+				continue
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+}
+
+// handleSNMPRequest 解析请求报文并生成响应
+func handleSNMPRequest(packet []byte) ([]byte, error) {
+	tag, msg, _, err := berRead(packet)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("malformed message")
+	}
+
+	// version
+	tag, v, msg, err := berRead(msg)
+	if err != nil || tag != berInteger {
+		return nil, errors.New("malformed version")
+	}
+	version := berParseInt(v)
+	if version != 0 && version != 1 {
+		return nil, fmt.Errorf("unsupported SNMP version %d", version)
+	}
+
+	// community
+	tag, community, msg, err := berRead(msg)
+	if err != nil || tag != berOctetString {
+		return nil, errors.New("malformed community")
+	}
+	if string(community) != *snmpCommunity {
+		return nil, errors.New("bad community")
+	}
+
+	// PDU
+	pduType, pdu, _, err := berRead(msg)
+	if err != nil {
+		return nil, errors.New("malformed PDU")
+	}
+	_, reqID, pdu, err := berRead(pdu)
+	if err != nil {
+		return nil, errors.New("malformed request-id")
+	}
+	_, field2, pdu, err := berRead(pdu) // error-status 或 non-repeaters
+	if err != nil {
+		return nil, errors.New("malformed PDU")
+	}
+	_, field3, pdu, err := berRead(pdu) // error-index 或 max-repetitions
+	if err != nil {
+		return nil, errors.New("malformed PDU")
+	}
+	_, varbinds, _, err := berRead(pdu)
+	if err != nil {
+		return nil, errors.New("malformed varbind list")
+	}
+
+	var oids []snmpOID
+	for len(varbinds) > 0 {
+		var vb []byte
+		if _, vb, varbinds, err = berRead(varbinds); err != nil {
+			return nil, errors.New("malformed varbind")
+		}
+		_, raw, _, err := berRead(vb)
+		if err != nil {
+			return nil, errors.New("malformed OID")
+		}
+		oids = append(oids, berParseOID(raw))
+	}
+
+	mib := snmpMIB()
+	var results []snmpVar
+	errStatus, errIndex := 0, 0
+
+	switch pduType {
+	case pduGetRequest:
+		for i, oid := range oids {
+			v, ok := snmpGet(mib, oid)
+			if !ok {
+				if version == 0 {
+					errStatus, errIndex = snmpErrNoSuchName, i+1
+				}
+				v = snmpVar{oid: oid, tag: snmpNoSuchObject}
+			}
+			results = append(results, v)
+		}
+	case pduGetNextRequest:
+		for i, oid := range oids {
+			v, ok := snmpGetNext(mib, oid)
+			if !ok {
+				if version == 0 {
+					errStatus, errIndex = snmpErrNoSuchName, i+1
+				}
+				v = snmpVar{oid: oid, tag: snmpEndOfMIBView}
+			}
+			results = append(results, v)
+		}
+	case pduGetBulkRequest:
+		if version == 0 {
+			return nil, errors.New("GETBULK is not valid in SNMPv1")
+		}
+		nonRepeaters := int(berParseInt(field2))
+		maxRepetitions := int(berParseInt(field3))
+		if maxRepetitions > snmpMaxRepetitions {
+			maxRepetitions = snmpMaxRepetitions
+		}
+		for i, oid := range oids {
+			if i < nonRepeaters {
+				v, ok := snmpGetNext(mib, oid)
+				if !ok {
+					v = snmpVar{oid: oid, tag: snmpEndOfMIBView}
+				}
+				results = append(results, v)
+				continue
+			}
+			cur := oid
+			for r := 0; r < maxRepetitions; r++ {
+				v, ok := snmpGetNext(mib, cur)
+				if !ok {
+					results = append(results, snmpVar{oid: cur, tag: snmpEndOfMIBView})
+					break
+				}
+				results = append(results, v)
+				cur = v.oid
+			}
+		}
+	default:
+		errStatus = snmpErrGenErr
+		for _, oid := range oids {
+			results = append(results, snmpVar{oid: oid, tag: berNull})
+		}
+	}
+
+	// v1 出错时按原样返回请求中的变量
+	if errStatus != 0 && version == 0 {
+		results = results[:0]
+		for _, oid := range oids {
+			results = append(results, snmpVar{oid: oid, tag: berNull})
+		}
+	}
+
+	// 响应超过上限时，GETBULK 截断结果，其他请求返回 tooBig。按变量绑定的长度粗略估算，
+	// 报文头（版本、团体名、请求ID等）另留空间
+	budget := snmpMaxResponseSize - 64 - len(community) - len(reqID)
+	var vbList []byte
+	for _, v := range results {
+		vb := berTLV(berSequence, append(berTLV(berOID, berEncodeOID(v.oid)), berTLV(v.tag, v.value)...))
+		if len(vbList)+len(vb) > budget {
+			if pduType != pduGetBulkRequest || len(vbList) == 0 {
+				errStatus, errIndex, vbList = snmpErrTooBig, 0, nil
+			}
+			break
+		}
+		vbList = append(vbList, vb...)
+	}
+
+	var respPDU []byte
+	respPDU = append(respPDU, berTLV(berInteger, reqID)...)
+	respPDU = append(respPDU, berTLV(berInteger, berInt(int64(errStatus)))...)
+	respPDU = append(respPDU, berTLV(berInteger, berInt(int64(errIndex)))...)
+	respPDU = append(respPDU, berTLV(berSequence, vbList)...)
+
+	var resp []byte
+	resp = append(resp, berTLV(berInteger, berInt(version))...)
+	resp = append(resp, berTLV(berOctetString, community)...)
+	resp = append(resp, berTLV(pduGetResponse, respPDU)...)
+	return berTLV(berSequence, resp), nil
+}
+
+// snmpGet 精确查找
+func snmpGet(mib []snmpVar, oid snmpOID) (snmpVar, bool) {
+	i := sort.Search(len(mib), func(i int) bool { return mib[i].oid.compare(oid) >= 0 })
+	if i < len(mib) && mib[i].oid.compare(oid) == 0 {
+		return mib[i], true
+	}
+	return snmpVar{}, false
+}
+
+// snmpGetNext 查找字典序上的下一个变量
+func snmpGetNext(mib []snmpVar, oid snmpOID) (snmpVar, bool) {
+	i := sort.Search(len(mib), func(i int) bool { return mib[i].oid.compare(oid) > 0 })
+	if i < len(mib) {
+		return mib[i], true
+	}
+	return snmpVar{}, false
+}
+
+// berRead 读取一个 TLV，返回标签、内容和剩余数据
+func berRead(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("short BER element")
+	}
+	tag := b[0]
+	length := int(b[1])
+	offset := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(b) < 2+n {
+			return 0, nil, nil, errors.New("invalid BER length")
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+	if len(b) < offset+length {
+		return 0, nil, nil, errors.New("truncated BER element")
+	}
+	return tag, b[offset : offset+length], b[offset+length:], nil
+}
+
+// berTLV 编码一个 TLV
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// berInt 编码有符号整数（最短补码）
+func berInt(v int64) []byte {
+	out := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		out = append([]byte{byte(v)}, out...)
+	}
+	return out
+}
+
+// berUint 编码无符号整数，最高位为1时补零
+func berUint(v uint64) []byte {
+	out := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		out = append([]byte{byte(v)}, out...)
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0}, out...)
+	}
+	return out
+}
+
+// berParseInt 解析有符号整数
+func berParseInt(b []byte) int64 {
+	var v int64
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// berEncodeOID 编码 OID
+func berEncodeOID(oid snmpOID) []byte {
+	if len(oid) < 2 {
+		return []byte{0}
+	}
+	out := []byte{byte(oid[0]*40 + oid[1])}
+	for _, id := range oid[2:] {
+		var chunk []byte
+		chunk = append(chunk, byte(id&0x7f))
+		for id >>= 7; id > 0; id >>= 7 {
+			chunk = append([]byte{byte(id&0x7f) | 0x80}, chunk...)
+		}
+		out = append(out, chunk...)
+	}
+	return out
+}
+
+// berParseOID 解析 OID
+func berParseOID(b []byte) snmpOID {
+	if len(b) == 0 {
+		return nil
+	}
+	oid := snmpOID{int(b[0]) / 40, int(b[0]) % 40}
+	id := 0
+	for _, c := range b[1:] {
+		id = id<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			oid = append(oid, id)
+			id = 0
+		}
+	}
+	return oid
+}
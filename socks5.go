@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// apiStartSOCKS5Forward 启动规则监听地址上的 SOCKS5 代理
+func apiStartSOCKS5Forward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析请求体
+	var req listenRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 启动SOCKS5代理
+	err := forwarder.StartSOCKS5Forward(req.ListenAddr, req.ListenPort)
+	recordListenEvent(r, RuleEventStart, "socks5", req.ListenAddr, req.ListenPort, "", err)
+	if err != nil {
+		log.Printf("Failed to start SOCKS5 proxy: %v", err)
+		writeJSON(w, startFailureStatus(err), startFailureResult(err, "tcp", req.ListenAddr, req.ListenPort))
+		return
+	}
+
+	// 返回成功
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true, ListenPort: req.ListenPort})
+}
+
+// apiStopSOCKS5Forward 停止 SOCKS5 代理
+func apiStopSOCKS5Forward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析请求体
+	var req listenRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// 解析端口（支持服务名）
+	if err := resolvePorts(&req.ListenPort); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 停止SOCKS5代理
+	err := forwarder.StopSOCKS5Forward(req.ListenAddr, req.ListenPort)
+	recordListenEvent(r, RuleEventStop, "socks5", req.ListenAddr, req.ListenPort, "", err)
+	if err != nil {
+		log.Printf("Failed to stop SOCKS5 proxy: %v", err)
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 返回成功
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// apiIsSOCKS5Running 检查 SOCKS5 代理是否运行
+func apiIsSOCKS5Running(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rule, err := runningQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := map[string]interface{}{"running": forwarder.IsSOCKS5Running(rule.ListenAddr, rule.ListenPort)}
+	if recovery, ok := forwarder.Recovery("socks5", rule.ListenAddr, rule.ListenPort); ok {
+		result["recovering"] = recovery
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// apiGetSOCKS5 获取规则的 SOCKS5 认证配置，不返回密码
+func apiGetSOCKS5(w http.ResponseWriter, r *http.Request) {
+	getRuleOption(w, r, func(rule Rule) map[string]interface{} {
+		username := ""
+		if rule.SOCKS5 != nil {
+			username = rule.SOCKS5.Username
+		}
+		return map[string]interface{}{"username": username, "requiresAuth": rule.SOCKS5.RequiresAuth()}
+	})
+}
+
+// updateSOCKS5Request apiUpdateSOCKS5 的请求体
+type updateSOCKS5Request struct {
+	RuleID string                `json:"ruleId"`
+	SOCKS5 *forward.SOCKS5Config `json:"socks5"`
+}
+
+// apiUpdateSOCKS5 设置规则的 SOCKS5 认证，socks5 为 null 或用户名为空时不需要认证
+// 正在运行的代理会重启以应用新配置，已建立的连接不受影响
+func apiUpdateSOCKS5(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "SOCKS5 settings", func(req *updateSOCKS5Request, _ Rule) (func(rule *Rule), error) {
+		// RFC 1929 的用户名与密码长度上限为 255 字节
+		if req.SOCKS5 != nil && (len(req.SOCKS5.Username) > 255 || len(req.SOCKS5.Password) > 255) {
+			return nil, errors.New("username and password must be at most 255 bytes")
+		}
+		if !req.SOCKS5.RequiresAuth() {
+			req.SOCKS5 = nil
+		}
+		return func(rule *Rule) { rule.SOCKS5 = req.SOCKS5 }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/google/uuid"
+)
+
+var sshLog = newLogger("ssh")
+
+// sshTunnels 每个跳板机一个 SSH 连接，使用它的规则的转发连接复用该连接。
+// 跳板机修改或删除时关闭，下次使用时按新配置重新创建
+var sshTunnels = struct {
+	sync.Mutex
+	tunnels map[string]*forward.SSHTunnel
+}{tunnels: make(map[string]*forward.SSHTunnel)}
+
+// sshHostJump 解密跳板机保存的密码与私钥
+func sshHostJump(host SSHHost) (forward.SSHJump, error) {
+	password, err := decryptSecret(host.Password)
+	if err != nil {
+		return forward.SSHJump{}, fmt.Errorf("password: %w", err)
+	}
+	key, err := decryptSecret(host.PrivateKey)
+	if err != nil {
+		return forward.SSHJump{}, fmt.Errorf("privateKey: %w", err)
+	}
+	return forward.SSHJump{
+		Addr:       host.Addr,
+		User:       host.User,
+		Password:   password,
+		PrivateKey: []byte(key),
+		HostKey:    host.HostKey,
+		TrustHostKey: func(fingerprint string) error {
+			return trustSSHHostKey(host.ID, fingerprint)
+		},
+	}, nil
+}
+
+// trustSSHHostKey 记下首次连接时跳板机的主机密钥指纹，之后连接时校验
+func trustSSHHostKey(id, fingerprint string) error {
+	_, err := updateSettings(func(settings *Settings) {
+		hosts := make([]SSHHost, len(settings.SSHHosts))
+		copy(hosts, settings.SSHHosts)
+		for i := range hosts {
+			if hosts[i].ID == id && hosts[i].HostKey == "" {
+				hosts[i].HostKey = fingerprint
+			}
+		}
+		settings.SSHHosts = hosts
+	})
+	return err
+}
+
+// sshTunnel 返回跳板机的 SSH 连接，尚未创建时按设置创建
+func sshTunnel(id string) (*forward.SSHTunnel, error) {
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	if tunnel, ok := sshTunnels.tunnels[id]; ok {
+		return tunnel, nil
+	}
+	host, ok := currentSettings().FindSSHHost(id)
+	if !ok {
+		return nil, fmt.Errorf("SSH host %s not found", id)
+	}
+	jump, err := sshHostJump(host)
+	if err != nil {
+		return nil, fmt.Errorf("SSH host %s: %w", sshHostLabel(host), err)
+	}
+	tunnel, err := forward.NewSSHTunnel(jump)
+	if err != nil {
+		return nil, fmt.Errorf("SSH host %s: %w", sshHostLabel(host), err)
+	}
+	tunnel.Log = sshLog
+	sshTunnels.tunnels[id] = tunnel
+	return tunnel, nil
+}
+
+// closeSSHTunnel 关闭跳板机的 SSH 连接，经它建立的转发连接随之断开
+func closeSSHTunnel(id string) {
+	sshTunnels.Lock()
+	tunnel, ok := sshTunnels.tunnels[id]
+	delete(sshTunnels.tunnels, id)
+	sshTunnels.Unlock()
+	if ok {
+		tunnel.Close()
+	}
+}
+
+// sshTunnelConnected 跳板机的 SSH 连接当前是否已建立
+func sshTunnelConnected(id string) bool {
+	sshTunnels.Lock()
+	tunnel, ok := sshTunnels.tunnels[id]
+	sshTunnels.Unlock()
+	return ok && tunnel.Connected()
+}
+
+// failedDialer 跳板机不可用时使用的拨号器，连接目标总是失败，不会绕过跳板机直接连接
+type failedDialer struct{ err error }
+
+func (d failedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return nil, d.err
+}
+
+// ruleSSHDialer 规则经跳板机连接目标时使用的拨号器，未设置跳板机时为 nil
+func ruleSSHDialer(rule Rule) forward.Dialer {
+	if rule.SSHHost == "" {
+		return nil
+	}
+	tunnel, err := sshTunnel(rule.SSHHost)
+	if err != nil {
+		return failedDialer{err}
+	}
+	return tunnel
+}
+
+// sshHostLabel 日志与错误中显示的跳板机名称
+func sshHostLabel(host SSHHost) string {
+	if host.Name != "" {
+		return host.Name
+	}
+	return host.User + "@" + host.Addr
+}
+
+// sshHostRules 使用跳板机的规则
+func sshHostRules(id string) []Rule {
+	var rules []Rule
+	for _, rule := range ruleStore.Rules() {
+		if rule.SSHHost == id {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// SSHHostStatus 跳板机的信息，不含密码与私钥
+type SSHHostStatus struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name,omitempty"`
+	Addr          string   `json:"addr"`
+	User          string   `json:"user"`
+	HostKey       string   `json:"hostKey,omitempty"`
+	HasPassword   bool     `json:"hasPassword"`
+	HasPrivateKey bool     `json:"hasPrivateKey"`
+	Connected     bool     `json:"connected"`
+	Rules         []string `json:"rules"` // 使用此跳板机的规则ID
+}
+
+// sshHostStatus 生成跳板机的信息
+func sshHostStatus(host SSHHost) SSHHostStatus {
+	status := SSHHostStatus{
+		ID:            host.ID,
+		Name:          host.Name,
+		Addr:          host.Addr,
+		User:          host.User,
+		HostKey:       host.HostKey,
+		HasPassword:   host.Password != "",
+		HasPrivateKey: host.PrivateKey != "",
+		Connected:     sshTunnelConnected(host.ID),
+		Rules:         []string{},
+	}
+	for _, rule := range sshHostRules(host.ID) {
+		status.Rules = append(status.Rules, rule.ID)
+	}
+	return status
+}
+
+// apiGetSSHHosts 获取 SSH 跳板机列表
+func apiGetSSHHosts(w http.ResponseWriter, r *http.Request) {
+	hosts := []SSHHostStatus{}
+	for _, host := range currentSettings().SSHHosts {
+		hosts = append(hosts, sshHostStatus(host))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hosts)
+}
+
+// updateSSHHostRequest apiUpdateSSHHost 的请求体。Password 与 PrivateKey 为明文，
+// 为 null 时保持原值，为空字符串时清除。HostKey 同样，清除后在下次连接时重新记下
+type updateSSHHostRequest struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Addr       string  `json:"addr"`
+	User       string  `json:"user"`
+	Password   *string `json:"password"`
+	PrivateKey *string `json:"privateKey"`
+	HostKey    *string `json:"hostKey"`
+}
+
+// apiUpdateSSHHost 新增或修改 SSH 跳板机（ID为空时新增），密码与私钥加密后保存在设置中。
+// 修改后关闭原有的 SSH 连接，使用它的规则正在运行的转发会重启
+func apiUpdateSSHHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req updateSSHHostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	host := SSHHost{ID: req.ID}
+	if req.ID != "" {
+		existing, ok := currentSettings().FindSSHHost(req.ID)
+		if !ok {
+			http.Error(w, "SSH host not found", http.StatusNotFound)
+			return
+		}
+		host = existing
+	} else {
+		host.ID = uuid.New().String()
+	}
+	host.Name = strings.TrimSpace(req.Name)
+	host.Addr = strings.TrimSpace(req.Addr)
+	host.User = strings.TrimSpace(req.User)
+	if req.HostKey != nil {
+		host.HostKey = strings.TrimSpace(*req.HostKey)
+	}
+
+	// 先以明文校验，通过后再加密新的密码与私钥
+	jump, err := sshHostJump(host)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.Password != nil {
+		jump.Password = *req.Password
+	}
+	if req.PrivateKey != nil {
+		jump.PrivateKey = []byte(strings.TrimSpace(*req.PrivateKey))
+	}
+	if err := jump.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if host.HostKey != "" && !strings.HasPrefix(host.HostKey, "SHA256:") {
+		writeError(w, http.StatusBadRequest, "hostKey must be a SHA256 fingerprint (SHA256:...)")
+		return
+	}
+	if req.Password != nil {
+		if host.Password, err = encryptSecret(jump.Password); err != nil {
+			log.Printf("Failed to encrypt SSH password: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to encrypt password")
+			return
+		}
+	}
+	if req.PrivateKey != nil {
+		if host.PrivateKey, err = encryptSecret(string(jump.PrivateKey)); err != nil {
+			log.Printf("Failed to encrypt SSH private key: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to encrypt private key")
+			return
+		}
+	}
+
+	_, err = updateSettings(func(settings *Settings) {
+		hosts := make([]SSHHost, 0, len(settings.SSHHosts)+1)
+		replaced := false
+		for _, h := range settings.SSHHosts {
+			if h.ID == host.ID {
+				h, replaced = host, true
+			}
+			hosts = append(hosts, h)
+		}
+		if !replaced {
+			hosts = append(hosts, host)
+		}
+		settings.SSHHosts = hosts
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+
+	// 关闭旧配置的连接，重启使用它的转发以取得新的连接
+	closeSSHTunnel(host.ID)
+	for _, rule := range sshHostRules(host.ID) {
+		if err := restartRuleForwards(rule, rule, requestSource(r)); err != nil {
+			sshLog.Errorf("Failed to restart rule %s after SSH host change: %v", ruleDisplayName(rule), err)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "sshHost": sshHostStatus(host)})
+}
+
+// apiDeleteSSHHost 删除 SSH 跳板机，仍有规则使用时拒绝
+func apiDeleteSSHHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req idRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if rules := sshHostRules(req.ID); len(rules) > 0 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("SSH host is used by %d rule(s)", len(rules)))
+		return
+	}
+	_, err := updateSettings(func(settings *Settings) {
+		var kept []SSHHost
+		for _, host := range settings.SSHHosts {
+			if host.ID != req.ID {
+				kept = append(kept, host)
+			}
+		}
+		settings.SSHHosts = kept
+	})
+	if err != nil {
+		log.Printf("Failed to save settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	closeSSHTunnel(req.ID)
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// validateRuleSSHHost 校验规则引用的跳板机：必须存在，且不能与透明代理或中继节点同时使用
+func validateRuleSSHHost(rule Rule) error {
+	if rule.SSHHost == "" {
+		return nil
+	}
+	if _, ok := currentSettings().FindSSHHost(rule.SSHHost); !ok {
+		return fmt.Errorf("SSH host %s not found", rule.SSHHost)
+	}
+	if rule.Transparent {
+		return errors.New("SSH host cannot be used with transparent proxy")
+	}
+	if len(rule.Via) > 0 {
+		return errors.New("SSH host cannot be used with relay nodes")
+	}
+	return nil
+}
+
+// updateRuleSSHHostRequest apiUpdateRuleSSHHost 的请求体
+type updateRuleSSHHostRequest struct {
+	RuleID  string `json:"ruleId"`
+	SSHHost string `json:"sshHost"`
+}
+
+// apiUpdateRuleSSHHost 设置规则经哪个 SSH 跳板机连接目标，sshHost 为空时直接连接。
+// 正在运行的转发会重启以应用新配置
+func apiUpdateRuleSSHHost(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "SSH host", func(req *updateRuleSSHHostRequest, current Rule) (func(rule *Rule), error) {
+		current.SSHHost = req.SSHHost
+		if err := validateRuleSSHHost(current); err != nil {
+			return nil, err
+		}
+		return func(rule *Rule) { rule.SSHHost = req.SSHHost }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// RuleStats 规则的流量统计，按协议分开并附带合计
+type RuleStats struct {
+	RuleID    string                           `json:"ruleId"`
+	Name      string                           `json:"name"`
+	Running   bool                             `json:"running"`
+	Protocols map[string]forward.StatsSnapshot `json:"protocols"` // 仅包含正在运行的协议
+	Total     forward.StatsSnapshot            `json:"total"`
+	MaxConns  int                              `json:"maxConns,omitempty"` // 同时连接数上限，当前连接数见 Total.ActiveConns
+}
+
+// ruleStats 汇总规则在各协议下的统计
+func ruleStats(rule Rule) RuleStats {
+	stats := RuleStats{
+		RuleID:    rule.ID,
+		Name:      ruleDisplayName(rule),
+		Protocols: make(map[string]forward.StatsSnapshot),
+		MaxConns:  rule.MaxConns,
+	}
+	for _, protocol := range forwardProtocols {
+		if s, ok := ruleForwardStats(rule, protocol); ok {
+			stats.Protocols[protocol] = s
+		}
+	}
+	stats.Total, stats.Running = ruleTotals(rule)
+	return stats
+}
+
+// apiGetStats 获取规则的流量统计，ruleId 为空时返回所有规则
+func apiGetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if id := r.URL.Query().Get("ruleId"); id != "" {
+		rule, ok := findRule(id)
+		if !ok {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(ruleStats(rule))
+		return
+	}
+
+	snapshot := ruleStore.Rules()
+	list := make([]RuleStats, 0, len(snapshot))
+	for _, rule := range snapshot {
+		list = append(list, ruleStats(rule))
+	}
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// statsdMaxPacket 单个 UDP 包的最大负载，避免在常见 MTU 下分片
+const statsdMaxPacket = 1432
+
+// statsdMetric 一条待发送的 StatsD 指标
+type statsdMetric struct {
+	name  string
+	value int64
+	kind  string // c = counter, g = gauge
+	tags  []string
+}
+
+// line 按 StatsD / DogStatsD 格式编码
+func (m statsdMetric) line(prefix string, dogstatsd bool) string {
+	if dogstatsd {
+		tags := make([]string, len(m.tags))
+		for i, tag := range m.tags {
+			key, value, _ := strings.Cut(tag, ":")
+			tags[i] = key + ":" + dogstatsdTagSanitize(value)
+		}
+		return fmt.Sprintf("%s.%s:%d|%s|#%s", prefix, m.name, m.value, m.kind, strings.Join(tags, ","))
+	}
+
+	// 纯 StatsD 不支持标签，把规则ID和协议拼进指标名
+	name := prefix
+	for _, tag := range m.tags {
+		key, value, _ := strings.Cut(tag, ":")
+		if key == "rule" || key == "protocol" {
+			name += "." + statsdSanitize(value)
+		}
+	}
+	return fmt.Sprintf("%s.%s:%d|%s", name, m.name, m.value, m.kind)
+}
+
+// statsdSanitize 替换指标名中不允许出现的字符
+func statsdSanitize(s string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", " ", "_").Replace(s)
+}
+
+// dogstatsdTagSanitize 替换标签值中的分隔符与换行，规则名称等用户输入不能拆出额外的标签或指标
+func dogstatsdTagSanitize(s string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", ":", "_", "\n", "_", "\r", "_").Replace(s)
+}
+
+// startStatsDEmitter 周期性向 StatsD 发送连接和字节计数
+func startStatsDEmitter() {
+	if *statsdAddr == "" {
+		return
+	}
+
+	conn, err := net.Dial("udp", *statsdAddr)
+	if err != nil {
+		log.Printf("Failed to set up StatsD client for %s: %v", *statsdAddr, err)
+		return
+	}
+	log.Printf("Emitting StatsD metrics to %s", *statsdAddr)
+
+	go func() {
+		// 上次发送时的计数，用于计算 counter 增量
+		last := make(map[string]forward.StatsSnapshot)
+		ticker := time.NewTicker(*statsdInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			metrics := collectStatsDMetrics(last)
+			if err := sendStatsD(conn, metrics); err != nil {
+				log.Printf("Failed to send StatsD metrics: %v", err)
+			}
+		}
+	}()
+}
+
+// collectStatsDMetrics 收集所有运行中转发的指标
+func collectStatsDMetrics(last map[string]forward.StatsSnapshot) []statsdMetric {
+	snapshot := ruleStore.Rules()
+
+	var metrics []statsdMetric
+	seen := make(map[string]bool)
+	for _, rule := range snapshot {
+		for _, protocol := range []string{"tcp", "udp", "sctp"} {
+			s, ok := ruleForwardStats(rule, protocol)
+			if !ok {
+				continue
+			}
+
+			key := rule.ID + "/" + protocol
+			prev, hadPrev := last[key]
+			// 转发重启后计数归零，此时整段计入增量
+			if !hadPrev || s.TotalConns < prev.TotalConns || s.BytesIn < prev.BytesIn || s.BytesOut < prev.BytesOut {
+				prev = forward.StatsSnapshot{}
+			}
+			last[key] = s
+			seen[key] = true
+
+			tags := ruleMetricLabels(rule, protocol).tags()
+			metrics = append(metrics,
+				statsdMetric{"bytes_in", s.BytesIn - prev.BytesIn, "c", tags},
+				statsdMetric{"bytes_out", s.BytesOut - prev.BytesOut, "c", tags},
+				statsdMetric{"connections", s.TotalConns - prev.TotalConns, "c", tags},
+				statsdMetric{"active_connections", s.ActiveConns, "g", tags},
+			)
+		}
+	}
+
+	// 清理已停止转发的历史值
+	for key := range last {
+		if !seen[key] {
+			delete(last, key)
+		}
+	}
+	return metrics
+}
+
+// sendStatsD 把指标按包大小分批发送
+func sendStatsD(conn net.Conn, metrics []statsdMetric) error {
+	var buf bytes.Buffer
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(buf.Bytes())
+		buf.Reset()
+		return err
+	}
+
+	for _, m := range metrics {
+		line := m.line(*statsdPrefix, *statsdTags)
+		if buf.Len() > 0 && buf.Len()+1+len(line) > statsdMaxPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	return flush()
+}
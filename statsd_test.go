@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 规则名称中的分隔符与换行不能破坏 DogStatsD 数据报或注入额外的指标
+func TestDogStatsDLineSanitizesTags(t *testing.T) {
+	rule := Rule{
+		ID:         "r1",
+		Seq:        1,
+		Name:       "evil,env:prod|c#x\ngoports.bytes_in:999|c\r",
+		ListenAddr: "127.0.0.1",
+		ListenPort: "8080",
+		TargetAddr: "10.0.0.1",
+		TargetPort: "80",
+	}
+	m := statsdMetric{"bytes_in", 42, "c", ruleMetricLabels(rule, "tcp").tags()}
+
+	got := m.line("goports", true)
+	want := "goports.bytes_in:42|c|#rule:r1,rule_name:_1 evil_env_prod_c_x_goports.bytes_in_999_c_," +
+		"protocol:tcp,listen:127.0.0.1_8080,target:10.0.0.1_80"
+	if got != want {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+	if strings.Count(got, "|") != 2 || strings.Count(got, "#") != 1 {
+		t.Fatalf("line %q has extra separators", got)
+	}
+}
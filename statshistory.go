@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+const (
+	statsHistoryInterval = 5 * time.Second
+	statsHistorySize     = 360 // 每条规则保留的采样点数（30分钟）
+)
+
+// StatsPoint 一个采样点：采样间隔内的平均速率与采样时的活动连接数
+type StatsPoint struct {
+	Time        time.Time `json:"time"`
+	InRate      float64   `json:"inRate"`  // 客户端 -> 目标，字节/秒
+	OutRate     float64   `json:"outRate"` // 目标 -> 客户端，字节/秒
+	ActiveConns int64     `json:"activeConns"`
+}
+
+// ruleHistory 单条规则的采样环形缓冲区
+type ruleHistory struct {
+	last   forward.StatsSnapshot
+	lastAt time.Time
+	points []StatsPoint
+	next   int // 缓冲区满后下一个覆盖的位置
+}
+
+// add 追加采样点，满时覆盖最旧的
+func (h *ruleHistory) add(p StatsPoint) {
+	if len(h.points) < statsHistorySize {
+		h.points = append(h.points, p)
+		return
+	}
+	h.points[h.next] = p
+	h.next = (h.next + 1) % statsHistorySize
+}
+
+// list 按时间顺序返回采样点
+func (h *ruleHistory) list() []StatsPoint {
+	list := make([]StatsPoint, 0, len(h.points))
+	list = append(list, h.points[h.next:]...)
+	return append(list, h.points[:h.next]...)
+}
+
+// statsHistory 所有规则的流量历史
+var statsHistory = struct {
+	sync.Mutex
+	rules map[string]*ruleHistory
+}{
+	rules: make(map[string]*ruleHistory),
+}
+
+// startStatsHistory 启动流量采样循环
+func startStatsHistory() {
+	go func() {
+		ticker := time.NewTicker(statsHistoryInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			sampleStatsHistory(now)
+		}
+	}()
+}
+
+// sampleStatsHistory 采样所有规则的速率。停止的规则记为0，删除的规则丢弃历史
+func sampleStatsHistory(now time.Time) {
+	snapshot := ruleStore.Rules()
+
+	statsHistory.Lock()
+	defer statsHistory.Unlock()
+
+	seen := make(map[string]bool, len(snapshot))
+	for _, rule := range snapshot {
+		seen[rule.ID] = true
+		total, running := ruleTotals(rule)
+
+		h, ok := statsHistory.rules[rule.ID]
+		if !ok {
+			if !running {
+				continue
+			}
+			h = &ruleHistory{}
+			statsHistory.rules[rule.ID] = h
+		}
+
+		point := StatsPoint{Time: now, ActiveConns: total.ActiveConns}
+		// 首次采样或计数回退（转发重启）时速率记为0
+		if secs := now.Sub(h.lastAt).Seconds(); !h.lastAt.IsZero() && secs > 0 &&
+			total.BytesIn >= h.last.BytesIn && total.BytesOut >= h.last.BytesOut {
+			point.InRate = float64(total.BytesIn-h.last.BytesIn) / secs
+			point.OutRate = float64(total.BytesOut-h.last.BytesOut) / secs
+		}
+		h.last, h.lastAt = total, now
+		h.add(point)
+	}
+
+	for id := range statsHistory.rules {
+		if !seen[id] {
+			delete(statsHistory.rules, id)
+		}
+	}
+}
+
+// apiGetStatsHistory 获取规则的流量历史，ruleId 为空时返回所有有历史的规则（按规则ID索引）
+func apiGetStatsHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ruleID := r.URL.Query().Get("ruleId")
+
+	statsHistory.Lock()
+	defer statsHistory.Unlock()
+
+	if ruleID != "" {
+		points := []StatsPoint{}
+		if h, ok := statsHistory.rules[ruleID]; ok {
+			points = h.list()
+		}
+		json.NewEncoder(w).Encode(points)
+		return
+	}
+
+	all := make(map[string][]StatsPoint, len(statsHistory.rules))
+	for id, h := range statsHistory.rules {
+		all[id] = h.list()
+	}
+	json.NewEncoder(w).Encode(all)
+}
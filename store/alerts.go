@@ -0,0 +1,45 @@
+package store
+
+import (
+	"fmt"
+)
+
+// 告警条件类型
+const (
+	AlertDialFailureRate = "dialFailureRate" // 连接目标失败率 >= Threshold（0-1）
+	AlertNoTraffic       = "noTraffic"       // 运行中但 Minutes 分钟内没有流量
+	AlertConnectionSpike = "connectionSpike" // Minutes 分钟内新连接数 >= Threshold
+)
+
+// AlertMaxMinutes 告警窗口上限（分钟）
+const AlertMaxMinutes = 60
+
+// AlertRule 规则上的告警定义
+type AlertRule struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	Threshold float64 `json:"threshold"`
+	Minutes   int     `json:"minutes"`
+	Enabled   bool    `json:"enabled"`
+}
+
+// Validate 校验告警定义
+func (a AlertRule) Validate() error {
+	switch a.Type {
+	case AlertDialFailureRate:
+		if a.Threshold <= 0 || a.Threshold > 1 {
+			return fmt.Errorf("dial failure rate threshold must be in (0, 1]")
+		}
+	case AlertNoTraffic:
+	case AlertConnectionSpike:
+		if a.Threshold < 1 {
+			return fmt.Errorf("connection spike threshold must be at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown alert type %q", a.Type)
+	}
+	if a.Minutes < 1 || a.Minutes > AlertMaxMinutes {
+		return fmt.Errorf("alert window must be between 1 and %d minutes", AlertMaxMinutes)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import "fmt"
+
+// 抓包文件的格式
+const (
+	CaptureFormatPcap = "pcap" // libpcap 文件，可用 Wireshark 打开，也可用于流量回放
+	CaptureFormatHex  = "hex"  // 文本的十六进制转储
+)
+
+// 抓包文件大小上限（MB）
+const (
+	DefaultCaptureMaxMB = 10
+	maxCaptureMaxMB     = 1024
+)
+
+// CaptureConfig 规则的抓包（tap）设置：把经过转发的客户端一侧数据写入 db/captures 下的文件，
+// 文件达到大小上限后不再写入
+type CaptureConfig struct {
+	Enabled bool   `json:"enabled"`
+	Format  string `json:"format,omitempty"` // pcap（默认）或 hex
+	MaxMB   int    `json:"maxMB,omitempty"`  // 文件大小上限（MB），0 为默认 10MB
+}
+
+// Validate 校验抓包配置
+func (c CaptureConfig) Validate() error {
+	if c.Format != "" && c.Format != CaptureFormatPcap && c.Format != CaptureFormatHex {
+		return fmt.Errorf("unknown capture format %q (expected pcap or hex)", c.Format)
+	}
+	if c.MaxMB < 0 || c.MaxMB > maxCaptureMaxMB {
+		return fmt.Errorf("maxMB must be between 0 and %d", maxCaptureMaxMB)
+	}
+	return nil
+}
+
+// FileFormat 抓包文件的格式，未设置时为 pcap
+func (c CaptureConfig) FileFormat() string {
+	if c.Format == "" {
+		return CaptureFormatPcap
+	}
+	return c.Format
+}
+
+// MaxBytes 抓包文件的大小上限（字节）
+func (c CaptureConfig) MaxBytes() int64 {
+	if c.MaxMB <= 0 {
+		return DefaultCaptureMaxMB << 20
+	}
+	return int64(c.MaxMB) << 20
+}
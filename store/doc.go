@@ -0,0 +1,14 @@
+// Package store 定义 go-ports 的转发规则、模板与程序设置，并保存在一个 JSON 文件中：
+//
+//	s := store.NewStorage("db/data.json")
+//	rules := store.NewRuleStore(s)
+//	if err := rules.Load(); err != nil {
+//		log.Fatal(err)
+//	}
+//	for _, rule := range rules.Rules() {
+//		fmt.Println(rule.ListenPort, "->", net.JoinHostPort(rule.TargetAddr, rule.TargetPort))
+//	}
+//
+// Storage 的每次修改都在锁内读取、修改并原子地替换文件；RuleStore 在内存中保存规则与模板，
+// 读取方法返回副本，修改方法同步保存到 Storage。
+package store
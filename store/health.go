@@ -0,0 +1,79 @@
+package store
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 健康检查方式
+const (
+	HealthCheckTCP   = "tcp"   // 能建立 TCP 连接即为健康
+	HealthCheckHTTP  = "http"  // HTTP 请求返回期望的状态码
+	HealthCheckHTTPS = "https" // 同 http，以 TLS 连接（不校验证书）
+)
+
+// HealthCheck 规则目标的健康检查配置。目标池中不健康的目标不再分配新的 TCP 连接，
+// 所有目标都不健康时切换到备用目标（UDP/SCTP 转发不受影响）
+type HealthCheck struct {
+	Enabled         bool   `json:"enabled"`
+	Type            string `json:"type,omitempty"`            // tcp（默认）/http/https
+	IntervalSeconds int    `json:"intervalSeconds,omitempty"` // 检查间隔，默认10秒
+	TimeoutSeconds  int    `json:"timeoutSeconds,omitempty"`  // 单次检查超时，默认3秒
+	HTTPPath        string `json:"httpPath,omitempty"`        // HTTP 检查的路径，默认 /
+	ExpectStatus    int    `json:"expectStatus,omitempty"`    // 期望的 HTTP 状态码，为 0 时接受 200-399
+	Rise            int    `json:"rise,omitempty"`            // 连续成功多少次后标记为健康，默认2次
+	Fall            int    `json:"fall,omitempty"`            // 连续失败多少次后标记为不健康，默认3次
+	BackupAddr      string `json:"backupAddr,omitempty"`      // 所有目标都不健康时使用的备用目标
+	BackupPort      string `json:"backupPort,omitempty"`
+}
+
+// WithDefaults 填充默认值
+func (c HealthCheck) WithDefaults() HealthCheck {
+	if c.Type == "" {
+		c.Type = HealthCheckTCP
+	}
+	if c.IntervalSeconds <= 0 {
+		c.IntervalSeconds = 10
+	}
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = 3
+	}
+	if c.HTTPPath == "" {
+		c.HTTPPath = "/"
+	}
+	if c.Rise <= 0 {
+		c.Rise = 2
+	}
+	if c.Fall <= 0 {
+		c.Fall = 3
+	}
+	return c
+}
+
+// Validate 校验健康检查配置
+func (c HealthCheck) Validate() error {
+	switch c.Type {
+	case "", HealthCheckTCP, HealthCheckHTTP, HealthCheckHTTPS:
+	default:
+		return fmt.Errorf("unknown health check type %q", c.Type)
+	}
+	if c.HTTPPath != "" && !strings.HasPrefix(c.HTTPPath, "/") {
+		return fmt.Errorf("http path must start with /")
+	}
+	if c.ExpectStatus != 0 && (c.ExpectStatus < 100 || c.ExpectStatus > 599) {
+		return fmt.Errorf("invalid expected status %d", c.ExpectStatus)
+	}
+	if (c.BackupAddr == "") != (c.BackupPort == "") {
+		return fmt.Errorf("backup target address and port must be set together")
+	}
+	return nil
+}
+
+// BackupTarget 备用目标 addr:port，未配置时为空
+func (c *HealthCheck) BackupTarget() string {
+	if c == nil || c.BackupAddr == "" {
+		return ""
+	}
+	return net.JoinHostPort(c.BackupAddr, c.BackupPort)
+}
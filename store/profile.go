@@ -0,0 +1,110 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Profile 保存在设置中的一组变量（如 dev、staging、prod），规则的目标地址与端口
+// 可以引用其中的变量 ${NAME}，开启转发时按当前环境展开
+type Profile struct {
+	Name string            `json:"name"`
+	Vars map[string]string `json:"vars"`
+}
+
+// varPattern 目标中的变量引用 ${NAME}
+var varPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// varName 变量名：字母或下划线开头，由字母、数字与下划线组成
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FindProfile 按名称查找环境
+func (s Settings) FindProfile(name string) (Profile, bool) {
+	for _, profile := range s.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ProfileVars 当前环境的变量，未选择环境时为 nil
+func (s Settings) ProfileVars() map[string]string {
+	profile, _ := s.FindProfile(s.ActiveProfile)
+	return profile.Vars
+}
+
+// ValidVarName 判断是否为合法的变量名
+func ValidVarName(name string) bool {
+	return varName.MatchString(name)
+}
+
+// HasVars 判断字符串中是否引用了变量
+func HasVars(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// VarNames 字符串中引用的合法变量名，按出现顺序
+func VarNames(s string) []string {
+	var names []string
+	for _, m := range varPattern.FindAllStringSubmatch(s, -1) {
+		if ValidVarName(m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// CheckVars 检查变量引用的语法：必须闭合且变量名合法
+func CheckVars(s string) error {
+	for _, m := range varPattern.FindAllStringSubmatch(s, -1) {
+		if !ValidVarName(m[1]) {
+			return fmt.Errorf("invalid variable name %q", m[1])
+		}
+	}
+	if strings.Contains(varPattern.ReplaceAllString(s, ""), "${") {
+		return fmt.Errorf("unterminated variable in %q", s)
+	}
+	return nil
+}
+
+// ExpandVars 以 vars 展开字符串中的 ${NAME}，引用了未定义的变量时返回错误
+func ExpandVars(s string, vars map[string]string) (string, error) {
+	if !HasVars(s) {
+		return s, nil
+	}
+	if err := CheckVars(s); err != nil {
+		return "", err
+	}
+	var missing []string
+	expanded := varPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, "${"+name+"}")
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// ExpandRule 以 vars 展开规则目标地址与端口中的变量，返回展开后的副本
+func ExpandRule(rule Rule, vars map[string]string) (Rule, error) {
+	if !HasVars(rule.TargetAddr) && !HasVars(rule.TargetPort) {
+		return rule, nil
+	}
+	addr, err := ExpandVars(rule.TargetAddr, vars)
+	if err != nil {
+		return rule, fmt.Errorf("target address: %w", err)
+	}
+	port, err := ExpandVars(rule.TargetPort, vars)
+	if err != nil {
+		return rule, fmt.Errorf("target port: %w", err)
+	}
+	rule.TargetAddr, rule.TargetPort = addr, port
+	return rule, nil
+}
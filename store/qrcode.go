@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// qrSchemePattern URL scheme 的格式（RFC 3986）
+var qrSchemePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// QRCodeConfig 规则二维码的内容，为空时二维码只包含 "ip:port"
+type QRCodeConfig struct {
+	Scheme string `json:"scheme,omitempty"` // 如 http、https、rtsp 或自定义 scheme
+	Path   string `json:"path,omitempty"`   // 附加在地址后的路径与查询，如 /live?channel=1
+}
+
+// Validate 校验二维码配置
+func (c QRCodeConfig) Validate() error {
+	if c.Scheme != "" && !qrSchemePattern.MatchString(c.Scheme) {
+		return fmt.Errorf("invalid URL scheme %q", c.Scheme)
+	}
+	if strings.ContainsAny(c.Path, " \t\r\n") {
+		return errors.New("path must not contain whitespace")
+	}
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") && !strings.HasPrefix(c.Path, "?") && !strings.HasPrefix(c.Path, "#") {
+		return errors.New("path must start with /, ? or #")
+	}
+	if len(c.Path) > 1024 {
+		return errors.New("path must be at most 1024 characters")
+	}
+	return nil
+}
+
+// Content 生成二维码内容：scheme://addr/path，没有 scheme 时为 addr/path
+func (c QRCodeConfig) Content(addr string) string {
+	if c.Scheme == "" {
+		return addr + c.Path
+	}
+	return strings.ToLower(c.Scheme) + "://" + addr + c.Path
+}
@@ -0,0 +1,20 @@
+package store
+
+// RelayNode 保存在设置中的远程 go-ports 中继节点。Token 为加密后的密文，
+// 规则通过 via 按顺序引用 ID，经这些节点连接目标
+type RelayNode struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Addr  string `json:"addr"`            // 节点的中继监听地址 host:port（对方的 -relay-listen）
+	Token string `json:"token,omitempty"` // 加密的节点令牌（对方的 -relay-token）
+}
+
+// FindRelayNode 按 ID 查找中继节点
+func (s Settings) FindRelayNode(id string) (RelayNode, bool) {
+	for _, node := range s.RelayNodes {
+		if node.ID == id {
+			return node, true
+		}
+	}
+	return RelayNode{}, false
+}
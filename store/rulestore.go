@@ -0,0 +1,544 @@
+package store
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRuleNotFound     = errors.New("rule not found")
+	ErrTemplateNotFound = errors.New("template not found")
+)
+
+// RuleStore 规则与模板的内存状态，读写均加锁，修改后同步保存到 data.json。
+// 读取方法返回副本，调用方可以自由修改而不影响共享状态
+type RuleStore struct {
+	mu        sync.RWMutex
+	storage   *Storage
+	rules     []Rule
+	templates []Template
+
+	// Resolve 按目标查找规则时先展开规则目标中的变量，为 nil 时按原样比较
+	Resolve func(rule Rule) Rule
+}
+
+// NewRuleStore 创建规则存储
+func NewRuleStore(storage *Storage) *RuleStore {
+	return &RuleStore{storage: storage, rules: []Rule{}, templates: []Template{}}
+}
+
+// Load 从 data.json 加载规则与模板，加载失败的部分置为空
+func (s *RuleStore) Load() error {
+	rules, rulesErr := s.storage.LoadRules()
+	if rulesErr != nil {
+		rules = []Rule{}
+	}
+	templates, templatesErr := s.storage.LoadTemplates()
+	if templatesErr != nil {
+		templates = []Template{}
+	}
+
+	s.mu.Lock()
+	s.rules, s.templates = rules, templates
+	s.mu.Unlock()
+
+	if rulesErr != nil {
+		return rulesErr
+	}
+	return templatesErr
+}
+
+// ReplaceAll 保存完整的应用程序数据并替换内存中的规则与模板（用于导入配置）
+func (s *RuleStore) ReplaceAll(appData AppData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.storage.Update(func(current *AppData) { *current = appData }); err != nil {
+		return err
+	}
+	s.rules = cloneRules(appData.Rules)
+	s.templates = cloneTemplates(appData.Templates)
+	return nil
+}
+
+// Rules 返回所有规则的副本
+func (s *RuleStore) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneRules(s.rules)
+}
+
+// Rule 按ID查找规则
+func (s *RuleStore) Rule(id string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rule := range s.rules {
+		if rule.ID == id {
+			return CloneRule(rule), true
+		}
+	}
+	return Rule{}, false
+}
+
+// EditableRule 按ID查找 UpdateRule 能修改的规则：全局规则或模板私有的规则副本
+func (s *RuleStore) EditableRule(id string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rule := range s.rules {
+		if rule.ID == id {
+			return CloneRule(rule), true
+		}
+	}
+	for _, t := range s.templates {
+		for _, rule := range t.Snapshots {
+			if rule.ID == id {
+				return CloneRule(rule), true
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// RuleByListen 按监听地址查找规则，端口在规则的端口范围内也算匹配
+func (s *RuleStore) RuleByListen(listenAddr, listenPort string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rule := range s.rules {
+		if rule.ListenAddr == listenAddr && forward.PortInRange(rule.ListenPort, listenPort) {
+			return CloneRule(rule), true
+		}
+	}
+	return Rule{}, false
+}
+
+// RuleByTarget 按监听地址与目标查找规则，用于区分监听同一地址的多条规则。
+// 没有规则的目标与 target 一致时返回第一条监听该地址的规则
+func (s *RuleStore) RuleByTarget(listenAddr, listenPort, target string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var first *Rule
+	for i, rule := range s.rules {
+		if rule.ListenAddr != listenAddr || !forward.PortInRange(rule.ListenPort, listenPort) {
+			continue
+		}
+		if ForwardTarget(s.resolve(rule), listenPort) == target {
+			return CloneRule(rule), true
+		}
+		if first == nil {
+			first = &s.rules[i]
+		}
+	}
+	if first == nil {
+		return Rule{}, false
+	}
+	return CloneRule(*first), true
+}
+
+// resolve 以 Resolve 展开规则目标中的变量
+func (s *RuleStore) resolve(rule Rule) Rule {
+	if s.Resolve == nil {
+		return rule
+	}
+	return s.Resolve(rule)
+}
+
+// ForwardTarget 规则在监听端口 listenPort 上转发的目标 addr:port。端口范围按偏移对应到目标端口，
+// 未设置目标（SOCKS5）时为空
+func ForwardTarget(rule Rule, listenPort string) string {
+	if rule.TargetAddr == "" || rule.TargetPort == "" {
+		return ""
+	}
+	targetPort := rule.TargetPort
+	if forward.IsPortRange(rule.ListenPort) {
+		pairs, err := forward.ExpandPortRange(rule.ListenPort, rule.TargetPort)
+		if err != nil {
+			return ""
+		}
+		targetPort = ""
+		for _, pair := range pairs {
+			if pair.Listen == listenPort {
+				targetPort = pair.Target
+			}
+		}
+		if targetPort == "" {
+			return ""
+		}
+	}
+	return net.JoinHostPort(rule.TargetAddr, targetPort)
+}
+
+// Templates 返回所有模板的副本
+func (s *RuleStore) Templates() []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneTemplates(s.templates)
+}
+
+// Template 按名称查找模板
+func (s *RuleStore) Template(name string) (Template, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.templates {
+		if t.Name == name {
+			return CloneTemplate(t), true
+		}
+	}
+	return Template{}, false
+}
+
+// TemplateRules 按模板中的顺序返回模板包含的规则（私有副本或引用的全局规则），找不到模板时返回 false
+func (s *RuleStore) TemplateRules(name string) ([]Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.templates {
+		if t.Name != name {
+			continue
+		}
+		var list []Rule
+		for _, id := range t.Rules {
+			if rule, ok := s.templateRuleLocked(t, id); ok {
+				list = append(list, CloneRule(rule))
+			}
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// templateRuleLocked 查找模板中的规则，私有副本优先于全局规则，调用方需持有锁
+func (s *RuleStore) templateRuleLocked(t Template, id string) (Rule, bool) {
+	for _, rule := range t.Snapshots {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	for _, rule := range s.rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// DetachTemplateRule 把模板引用的全局规则复制为模板私有的副本（新ID），之后修改或删除全局规则不影响模板。
+// 返回副本的ID
+func (s *RuleStore) DetachTemplateRule(name, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.templates {
+		if t.Name != name {
+			continue
+		}
+		for _, snapshot := range t.Snapshots {
+			if snapshot.ID == id {
+				return id, nil
+			}
+		}
+		member := false
+		for _, ruleID := range t.Rules {
+			member = member || ruleID == id
+		}
+		var source *Rule
+		for j := range s.rules {
+			if s.rules[j].ID == id {
+				source = &s.rules[j]
+			}
+		}
+		if !member || source == nil {
+			return "", ErrRuleNotFound
+		}
+
+		snapshot := CloneRule(*source)
+		snapshot.ID = uuid.New().String()
+		snapshot.Running = nil
+		t = CloneTemplate(t)
+		for j, ruleID := range t.Rules {
+			if ruleID == id {
+				t.Rules[j] = snapshot.ID
+			}
+		}
+		for j := range t.Startup {
+			if t.Startup[j].RuleID == id {
+				t.Startup[j].RuleID = snapshot.ID
+			}
+			if t.Startup[j].After == id {
+				t.Startup[j].After = snapshot.ID
+			}
+		}
+		t.Snapshots = append(t.Snapshots, snapshot)
+		s.templates[i] = t
+		return snapshot.ID, s.storage.SaveTemplates(s.templates)
+	}
+	return "", ErrTemplateNotFound
+}
+
+// LinkTemplateRule 把模板私有的规则副本加入全局规则列表（新序号），模板改为引用该全局规则
+func (s *RuleStore) LinkTemplateRule(name, id string) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.templates {
+		if t.Name != name {
+			continue
+		}
+		for j, snapshot := range t.Snapshots {
+			if snapshot.ID != id {
+				continue
+			}
+			snapshot.Seq = s.nextSeqLocked()
+			s.rules = append(s.rules, snapshot)
+			s.templates[i].Snapshots = append(append([]Rule(nil), t.Snapshots[:j]...), t.Snapshots[j+1:]...)
+			if err := s.storage.SaveRules(s.rules); err != nil {
+				return Rule{}, err
+			}
+			return CloneRule(snapshot), s.storage.SaveTemplates(s.templates)
+		}
+		return Rule{}, ErrRuleNotFound
+	}
+	return Rule{}, ErrTemplateNotFound
+}
+
+// AddRule 添加规则，序号为当前最大序号+1，返回添加后的规则
+func (s *RuleStore) AddRule(rule Rule) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule.Seq = s.nextSeqLocked()
+	s.rules = append(s.rules, rule)
+	return CloneRule(rule), s.storage.SaveRules(s.rules)
+}
+
+// AddRules 依次添加多条规则并分配序号，只保存一次
+func (s *RuleStore) AddRules(list []Rule) ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := make([]Rule, 0, len(list))
+	for _, rule := range list {
+		rule.Seq = s.nextSeqLocked()
+		s.rules = append(s.rules, rule)
+		added = append(added, CloneRule(rule))
+	}
+	return added, s.storage.SaveRules(s.rules)
+}
+
+// nextSeqLocked 下一个规则序号，调用方需持有写锁
+func (s *RuleStore) nextSeqLocked() int {
+	maxSeq := 0
+	for _, rule := range s.rules {
+		if rule.Seq > maxSeq {
+			maxSeq = rule.Seq
+		}
+	}
+	return maxSeq + 1
+}
+
+// UpdateRule 在写锁内修改指定规则并保存，返回修改后的规则。
+// 规则不存在时返回 ErrRuleNotFound，其他错误为保存失败，此时内存中的规则恢复原样并返回修改前的规则
+func (s *RuleStore) UpdateRule(id string, fn func(rule *Rule)) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.rules {
+		if s.rules[i].ID == id {
+			previous := CloneRule(s.rules[i])
+			fn(&s.rules[i])
+			if err := s.storage.SaveRules(s.rules); err != nil {
+				s.rules[i] = previous
+				return CloneRule(previous), err
+			}
+			return CloneRule(s.rules[i]), nil
+		}
+	}
+	// 模板私有的规则副本
+	for i := range s.templates {
+		for j := range s.templates[i].Snapshots {
+			if s.templates[i].Snapshots[j].ID == id {
+				previous := CloneRule(s.templates[i].Snapshots[j])
+				fn(&s.templates[i].Snapshots[j])
+				if err := s.storage.SaveTemplates(s.templates); err != nil {
+					s.templates[i].Snapshots[j] = previous
+					return CloneRule(previous), err
+				}
+				return CloneRule(s.templates[i].Snapshots[j]), nil
+			}
+		}
+	}
+	return Rule{}, ErrRuleNotFound
+}
+
+// UpdateRules 在写锁内修改所有规则，fn 返回 true 时保存
+func (s *RuleStore) UpdateRules(fn func(rules []Rule) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !fn(s.rules) {
+		return nil
+	}
+	return s.storage.SaveRules(s.rules)
+}
+
+// DeleteRules 删除规则，序号不重新计算。引用被删除全局规则的模板保留一份私有副本，
+// 模板私有的副本则从模板中移除
+func (s *RuleStore) DeleteRules(ids []string) error {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newRules := []Rule{}
+	deleted := make(map[string]Rule)
+	for _, rule := range s.rules {
+		if remove[rule.ID] {
+			deleted[rule.ID] = rule
+			continue
+		}
+		newRules = append(newRules, rule)
+	}
+	s.rules = newRules
+	if err := s.storage.SaveRules(s.rules); err != nil {
+		return err
+	}
+
+	for i, template := range s.templates {
+		snapshots := []Rule{}
+		private := make(map[string]bool)
+		for _, snapshot := range template.Snapshots {
+			if remove[snapshot.ID] {
+				continue
+			}
+			snapshots = append(snapshots, snapshot)
+			private[snapshot.ID] = true
+		}
+
+		var newTemplateRules []string
+		for _, ruleID := range template.Rules {
+			if rule, ok := deleted[ruleID]; ok && !private[ruleID] {
+				snapshot := CloneRule(rule)
+				snapshot.Running = nil
+				snapshots = append(snapshots, snapshot)
+				private[ruleID] = true
+			}
+			if remove[ruleID] && !private[ruleID] {
+				continue
+			}
+			newTemplateRules = append(newTemplateRules, ruleID)
+		}
+		s.templates[i].Rules = newTemplateRules
+		s.templates[i].Snapshots = nil
+		if len(snapshots) > 0 {
+			s.templates[i].Snapshots = snapshots
+		}
+	}
+	return s.storage.SaveTemplates(s.templates)
+}
+
+// UpdateTemplates 在写锁内修改模板列表，fn 返回新的列表与是否保存
+func (s *RuleStore) UpdateTemplates(fn func(templates []Template) ([]Template, bool)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	templates, save := fn(s.templates)
+	if !save {
+		return nil
+	}
+	if templates == nil {
+		templates = []Template{}
+	}
+	s.templates = templates
+	return s.storage.SaveTemplates(s.templates)
+}
+
+// CloneRule 复制规则，切片与指针字段不与原规则共享
+func CloneRule(rule Rule) Rule {
+	rule.RecentTargets = append([]string(nil), rule.RecentTargets...)
+	rule.Targets = append([]string(nil), rule.Targets...)
+	rule.Routes = append([]forward.Route(nil), rule.Routes...)
+	rule.Via = append([]string(nil), rule.Via...)
+	rule.ShareSchemes = append([]string(nil), rule.ShareSchemes...)
+	rule.Running = append([]string(nil), rule.Running...)
+	rule.AllowCIDRs = append([]string(nil), rule.AllowCIDRs...)
+	rule.DenyCIDRs = append([]string(nil), rule.DenyCIDRs...)
+	rule.Alerts = append([]AlertRule(nil), rule.Alerts...)
+	if rule.Watchdog != nil {
+		wd := *rule.Watchdog
+		rule.Watchdog = &wd
+	}
+	if rule.Health != nil {
+		health := *rule.Health
+		rule.Health = &health
+	}
+	if rule.Retry != nil {
+		retry := *rule.Retry
+		rule.Retry = &retry
+	}
+	if rule.TCPTuning != nil {
+		tuning := *rule.TCPTuning
+		if tuning.NoDelay != nil {
+			noDelay := *tuning.NoDelay
+			tuning.NoDelay = &noDelay
+		}
+		rule.TCPTuning = &tuning
+	}
+	if rule.Schedule != nil {
+		schedule := *rule.Schedule
+		schedule.Windows = append([]ScheduleWindow(nil), schedule.Windows...)
+		schedule.Protocols = append([]string(nil), schedule.Protocols...)
+		rule.Schedule = &schedule
+	}
+	if rule.Emulation != nil {
+		emu := *rule.Emulation
+		rule.Emulation = &emu
+	}
+	if rule.TLSTarget != nil {
+		tlsTarget := *rule.TLSTarget
+		rule.TLSTarget = &tlsTarget
+	}
+	if rule.SOCKS5 != nil {
+		socks := *rule.SOCKS5
+		rule.SOCKS5 = &socks
+	}
+	if rule.UDPRelay != nil {
+		relay := *rule.UDPRelay
+		rule.UDPRelay = &relay
+	}
+	if rule.Bind != nil {
+		bind := *rule.Bind
+		rule.Bind = &bind
+	}
+	if rule.QRCode != nil {
+		qr := *rule.QRCode
+		rule.QRCode = &qr
+	}
+	if rule.Capture != nil {
+		capture := *rule.Capture
+		rule.Capture = &capture
+	}
+	return rule
+}
+
+func cloneRules(rules []Rule) []Rule {
+	list := make([]Rule, len(rules))
+	for i, rule := range rules {
+		list[i] = CloneRule(rule)
+	}
+	return list
+}
+
+// CloneTemplate 复制模板，规则ID、启动步骤与私有副本不与原模板共享
+func CloneTemplate(t Template) Template {
+	t.Rules = append([]string(nil), t.Rules...)
+	t.Startup = append([]StartupStep(nil), t.Startup...)
+	if t.Snapshots != nil {
+		t.Snapshots = cloneRules(t.Snapshots)
+	}
+	return t
+}
+
+func cloneTemplates(templates []Template) []Template {
+	list := make([]Template, len(templates))
+	for i, t := range templates {
+		list[i] = CloneTemplate(t)
+	}
+	return list
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// maxScheduleWindows 一条规则最多的时间窗口数
+const maxScheduleWindows = 32
+
+// weekdayNames 星期的缩写，下标与 time.Weekday 一致
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule 规则的定时开关：在时间窗口内自动开启转发，窗口外自动停止。
+// 时间按本机时区计算。只在进入或离开窗口时动作，期间手动开关的状态会保持到下一次切换
+type Schedule struct {
+	Enabled   bool             `json:"enabled"`
+	Windows   []ScheduleWindow `json:"windows"`
+	Protocols []string         `json:"protocols,omitempty"` // 定时开关的协议，默认 tcp
+}
+
+// ScheduleWindow 时间窗口，如 days "mon-fri"、start "09:00"、end "18:00"。
+// end 不晚于 start 时窗口跨过午夜，属于开始的那一天
+type ScheduleWindow struct {
+	Days  string `json:"days,omitempty"` // 如 "mon-fri"、"sat,sun"，"*" 或为空表示每天
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// EffectiveProtocols 定时开关的协议，未指定时为 tcp
+func (s Schedule) EffectiveProtocols() []string {
+	if len(s.Protocols) == 0 {
+		return []string{"tcp"}
+	}
+	return s.Protocols
+}
+
+// Validate 校验定时配置
+func (s Schedule) Validate() error {
+	if s.Enabled && len(s.Windows) == 0 {
+		return errors.New("at least one time window is required")
+	}
+	if len(s.Windows) > maxScheduleWindows {
+		return fmt.Errorf("at most %d time windows are allowed", maxScheduleWindows)
+	}
+	for _, w := range s.Windows {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, protocol := range s.Protocols {
+		known := false
+		for _, p := range forward.Protocols {
+			known = known || p == protocol
+		}
+		if !known {
+			return fmt.Errorf("unknown protocol %q", protocol)
+		}
+	}
+	return nil
+}
+
+// Validate 校验时间窗口
+func (w ScheduleWindow) Validate() error {
+	if _, err := parseWeekdays(w.Days); err != nil {
+		return err
+	}
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("window %s-%s is empty", w.Start, w.End)
+	}
+	return nil
+}
+
+// Contains 判断 t 是否在窗口内
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	days, err := parseWeekdays(w.Days)
+	if err != nil {
+		return false
+	}
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	if start < end {
+		return days[today] && minute >= start && minute < end
+	}
+	// 跨午夜的窗口：开始当天的 start 之后，或前一天开始、今天 end 之前
+	yesterday := (today + 6) % 7
+	return (days[today] && minute >= start) || (days[yesterday] && minute < end)
+}
+
+// Active 判断 t 是否在任一窗口内
+func (s Schedule) Active(t time.Time) bool {
+	for _, w := range s.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 解析 "HH:MM"，返回从零点开始的分钟数，"24:00" 表示当天结束
+func parseClock(s string) (int, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, err1 := strconv.Atoi(hour)
+	m, err2 := strconv.Atoi(minute)
+	if !ok || err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// parseWeekdays 解析星期列表，如 "mon-fri"、"sat,sun"、"fri-mon"，"*" 或为空表示每天
+func parseWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := parseWeekday(from)
+		if err != nil {
+			return days, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseWeekday(to); err != nil {
+				return days, err
+			}
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseWeekday 解析星期缩写（mon、tue 等，也接受完整英文名）
+func parseWeekday(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 3 {
+		for i, name := range weekdayNames {
+			if strings.HasPrefix(s, name) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q, use sun/mon/tue/wed/thu/fri/sat", s)
+}
@@ -0,0 +1,37 @@
+package store
+
+// Settings 程序设置，保存在 data.json 的 settings 部分。零值表示使用默认值，
+// 在命令行上显式指定的参数优先于这里的设置
+type Settings struct {
+	UIListen        string `json:"uiListen,omitempty"`        // 管理界面监听地址，为空时监听所有地址
+	UIPort          int    `json:"uiPort,omitempty"`          // 管理界面端口，为 0 时从 defaultUIPort 起自动选择
+	UIAllow         string `json:"uiAllow,omitempty"`         // 允许访问管理界面/API的来源 IP/CIDR，逗号分隔，为空时不限制
+	LogLevel        string `json:"logLevel,omitempty"`        // 写入日志的最低级别
+	TCPBufferSize   int    `json:"tcpBufferSize,omitempty"`   // TCP 每个转发方向的缓冲区大小
+	UDPBufferSize   int    `json:"udpBufferSize,omitempty"`   // UDP 数据包缓冲区大小，超过的数据报被丢弃
+	UDPSocketBuffer int    `json:"udpSocketBuffer,omitempty"` // UDP 套接字收发缓冲区大小，为 0 时使用系统默认值
+	Language        string `json:"language,omitempty"`        // 界面语言：zh、en，为空时按浏览器语言
+	APIToken        string `json:"apiToken,omitempty"`        // REST API 令牌，-api-token 与环境变量优先
+	AutoStartRules  *bool  `json:"autoStartRules,omitempty"`  // 启动时开启标记了 autoStart 的规则，默认开启
+	RestoreRunning  *bool  `json:"restoreRunning,omitempty"`  // 启动时恢复上次运行的转发，默认开启
+	DefaultTemplate string `json:"defaultTemplate,omitempty"` // 程序启动时自动开启的模板
+	RebindForwards  bool   `json:"rebindForwards,omitempty"`  // 监听地址消失后恢复时重新监听其上的转发
+
+	SSHHosts   []SSHHost   `json:"sshHosts,omitempty"`   // SSH 跳板机，通过 /api/sshHosts 管理
+	RelayNodes []RelayNode `json:"relayNodes,omitempty"` // 远程中继节点，通过 /api/relayNodes 管理
+
+	Profiles      []Profile `json:"profiles,omitempty"`      // 目标中 ${NAME} 变量的环境，通过 /api/profiles 管理
+	ActiveProfile string    `json:"activeProfile,omitempty"` // 当前环境，开启转发时按它展开变量
+}
+
+// UISettings 旧版本保存的管理界面监听设置，现已并入 Settings 的 uiListen 与 uiPort
+type UISettings struct {
+	Listen string `json:"listen,omitempty"` // 监听地址，为空时监听所有地址
+	Port   int    `json:"port,omitempty"`   // 固定端口，为 0 时从 defaultUIPort 起自动选择
+}
+
+// AuthSettings 持久化的登录设置
+type AuthSettings struct {
+	TOTPEnabled bool   `json:"totpEnabled"`
+	TOTPSecret  string `json:"totpSecret,omitempty"`
+}
@@ -0,0 +1,23 @@
+package store
+
+// SSHHost 保存在设置中的 SSH 跳板机。Password 与 PrivateKey 为加密后的密文，
+// 规则通过 sshHost 引用 ID，经跳板机连接目标
+type SSHHost struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Addr       string `json:"addr"`                 // 跳板机 host:port
+	User       string `json:"user"`                 // 登录用户名
+	Password   string `json:"password,omitempty"`   // 加密的登录密码
+	PrivateKey string `json:"privateKey,omitempty"` // 加密的 PEM 私钥
+	HostKey    string `json:"hostKey,omitempty"`    // 主机密钥的 SHA256 指纹，为空时在首次连接时记下
+}
+
+// FindSSHHost 按 ID 查找跳板机
+func (s Settings) FindSSHHost(id string) (SSHHost, bool) {
+	for _, host := range s.SSHHosts {
+		if host.ID == id {
+			return host, true
+		}
+	}
+	return SSHHost{}, false
+}
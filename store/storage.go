@@ -0,0 +1,313 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// Rule 端口转发规则
+type Rule struct {
+	ID         string `json:"id"`
+	Seq        int    `json:"seq"`            // 序号，从1叠加
+	Name       string `json:"name,omitempty"` // 规则名称，如 "Dev MySQL"
+	Note       string `json:"note,omitempty"` // 备注
+	ListenAddr string `json:"listenAddr"`
+	ListenPort string `json:"listenPort"`
+	TargetAddr string `json:"targetAddr"`
+	TargetPort string `json:"targetPort"`
+	LogJA3     bool   `json:"logJA3,omitempty"`    // 记录TLS客户端JA3指纹
+	Pinned     bool   `json:"pinned,omitempty"`    // 置顶/收藏
+	AutoStart  bool   `json:"autoStart,omitempty"` // 程序启动时自动开启 TCP/UDP 转发
+	Priority   string `json:"priority,omitempty"`  // 共享带宽优先级：high/normal/low，空为 normal
+
+	Transparent bool `json:"transparent,omitempty"` // 透明代理：以客户端IP连接目标（仅Linux TCP）
+	PortMapping bool `json:"portMapping,omitempty"` // 转发运行时通过 UPnP/NAT-PMP 在路由器上映射同一端口
+
+	IdleTimeout int `json:"idleTimeout,omitempty"` // 连接空闲超时秒数，0 为不限制（TCP/SCTP/SOCKS5）
+	MaxLifetime int `json:"maxLifetime,omitempty"` // 连接最长存活秒数，0 为不限制（TCP/SCTP/SOCKS5）
+	UDPTimeout  int `json:"udpTimeout,omitempty"`  // UDP 会话空闲超时秒数，0 为默认 120 秒（仅UDP）
+	MaxConns    int `json:"maxConns,omitempty"`    // 同时连接数上限，所有协议与端口合计，0 为不限制（TCP/SCTP/SOCKS5）
+
+	AutoStopMinutes int `json:"autoStopMinutes,omitempty"` // 连续多少分钟无流量后自动停止转发，0 为不自动停止
+
+	RecentTargets []string `json:"recentTargets,omitempty"` // 最近使用过的目标 addr:port，最新的在前
+
+	Targets []string `json:"targets,omitempty"` // 额外的目标 addr:port，与主目标一起负载均衡（仅TCP）
+	Balance string   `json:"balance,omitempty"` // 负载均衡方式：roundrobin（默认）/leastconn
+
+	Routes  []forward.Route `json:"routes,omitempty"`  // 路由表：按 TLS SNI、HTTP Host 或开头的字节选择目标（仅TCP）
+	SSHHost string          `json:"sshHost,omitempty"` // 经此 ID 的 SSH 跳板机连接目标（TCP/SOCKS5）
+	Via     []string        `json:"via,omitempty"`     // 依次经过这些 ID 的中继节点连接目标（TCP/SOCKS5）
+
+	Running []string `json:"running,omitempty"` // 上次退出时正在运行的协议
+
+	AllowCIDRs []string `json:"allowCidrs,omitempty"` // 仅允许这些来源，为空时不限制
+	DenyCIDRs  []string `json:"denyCidrs,omitempty"`  // 拒绝这些来源，优先于允许列表
+
+	Alerts   []AlertRule        `json:"alerts,omitempty"`   // 告警规则
+	Watchdog *WatchdogConfig    `json:"watchdog,omitempty"` // 目标看门狗
+	Health   *HealthCheck       `json:"health,omitempty"`   // 目标健康检查与故障转移
+	Retry    *forward.DialRetry `json:"retry,omitempty"`    // 连接目标失败时重试（仅TCP）
+	Schedule *Schedule          `json:"schedule,omitempty"` // 按时间窗口自动开启/停止转发
+
+	Emulation *forward.NetEmulation `json:"emulation,omitempty"` // 弱网模拟（测试用）
+	TLSTarget *forward.TLSTarget    `json:"tlsTarget,omitempty"` // 以 TLS 连接目标（仅TCP）
+	SOCKS5    *forward.SOCKS5Config `json:"socks5,omitempty"`    // SOCKS5 代理模式的认证
+	UDPRelay  *forward.UDPRelay     `json:"udpRelay,omitempty"`  // 组播/广播中继模式（仅UDP）
+	TCPTuning *forward.TCPTuning    `json:"tcpTuning,omitempty"` // 保活、TCP_NODELAY 与连接目标的超时（TCP/SOCKS5）
+	Bind      *forward.OutboundBind `json:"bind,omitempty"`      // 连接目标的出接口与源地址（TCP/UDP/SOCKS5）
+	QRCode    *QRCodeConfig         `json:"qrCode,omitempty"`    // 二维码内容的 scheme 与路径
+	// ShareSchemes /api/getShareInfo 生成访问 URL 的 scheme，如 http、rdp、vnc，为空时按目标端口推测
+	ShareSchemes []string       `json:"shareSchemes,omitempty"`
+	Capture      *CaptureConfig `json:"capture,omitempty"` // 抓包：把转发的数据写入文件，用于调试
+}
+
+// Template 规则模板
+type Template struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Rules       []string `json:"rules"` // 存储规则ID列表
+	CreatedAt   string   `json:"createdAt"`
+
+	Startup []StartupStep `json:"startup,omitempty"` // 启动顺序、延迟与依赖，为空时同时启动
+	Profile string        `json:"profile,omitempty"` // 开启模板前切换到的环境，为空时使用当前环境
+
+	// Snapshots 模板私有的规则副本，ID 同样列在 Rules 中。不在此列表中的ID引用全局规则
+	Snapshots []Rule `json:"snapshots,omitempty"`
+}
+
+// AppData 应用程序数据
+type AppData struct {
+	Rules      []Rule        `json:"rules"`
+	Templates  []Template    `json:"templates"`
+	Blocklists []Blocklist   `json:"blocklists,omitempty"`
+	Auth       *AuthSettings `json:"auth,omitempty"`
+	UI         *UISettings   `json:"ui,omitempty"` // 旧版本的界面设置，读取时并入 Settings
+	Settings   *Settings     `json:"settings,omitempty"`
+}
+
+// Storage 存储管理。数据文件的读改写加锁，避免同时保存不同部分时互相覆盖
+type Storage struct {
+	mu       sync.Mutex
+	dataFile string
+
+	// BeforeSave 每次保存前以数据文件路径调用，可用于备份旧文件。返回的错误只记录日志，为 nil 时忽略
+	BeforeSave func(path string) error
+}
+
+// NewStorage 创建保存在 path（JSON 文件）的存储管理，文件不存在时按空数据处理
+func NewStorage(path string) *Storage {
+	return &Storage{dataFile: path}
+}
+
+// Path 数据文件的路径
+func (s *Storage) Path() string {
+	return s.dataFile
+}
+
+// Load 加载应用程序数据
+func (s *Storage) Load() (AppData, error) {
+	// 检查文件是否存在
+	if _, err := os.Stat(s.dataFile); os.IsNotExist(err) {
+		return AppData{
+			Rules:     []Rule{},
+			Templates: []Template{},
+		}, nil
+	}
+
+	data, err := os.ReadFile(s.dataFile)
+	if err != nil {
+		return AppData{}, fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	var appData AppData
+	if err := json.Unmarshal(data, &appData); err != nil {
+		return AppData{}, fmt.Errorf("failed to unmarshal app data: %w", err)
+	}
+
+	return appData, nil
+}
+
+// saveAppData 保存应用程序数据：先调用 BeforeSave，再原子地替换，写入中途崩溃不会损坏配置
+func (s *Storage) saveAppData(appData AppData) error {
+	data, err := json.MarshalIndent(appData, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal app data: %w", err)
+	}
+
+	if s.BeforeSave != nil {
+		if err := s.BeforeSave(s.dataFile); err != nil {
+			log.Printf("Failed to back up data file: %v", err)
+		}
+	}
+	if err := WriteFileAtomic(s.dataFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write data file: %w", err)
+	}
+
+	log.Printf("Saved app data: %d rules, %d templates", len(appData.Rules), len(appData.Templates))
+	return nil
+}
+
+// Update 在锁内读取、修改并保存应用程序数据
+func (s *Storage) Update(fn func(appData *AppData)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appData, err := s.Load()
+	if err != nil {
+		return err
+	}
+	fn(&appData)
+	return s.saveAppData(appData)
+}
+
+// SaveRules 保存规则
+func (s *Storage) SaveRules(rules []Rule) error {
+	return s.Update(func(appData *AppData) {
+		appData.Rules = rules
+	})
+}
+
+// LoadRules 加载规则
+func (s *Storage) LoadRules() ([]Rule, error) {
+	appData, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded %d rules", len(appData.Rules))
+	return appData.Rules, nil
+}
+
+// SaveTemplates 保存模板
+func (s *Storage) SaveTemplates(templates []Template) error {
+	return s.Update(func(appData *AppData) {
+		appData.Templates = templates
+	})
+}
+
+// LoadTemplates 加载模板
+func (s *Storage) LoadTemplates() ([]Template, error) {
+	appData, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded %d templates", len(appData.Templates))
+	return appData.Templates, nil
+}
+
+// SaveBlocklists 保存IP黑名单订阅
+func (s *Storage) SaveBlocklists(blocklists []Blocklist) error {
+	return s.Update(func(appData *AppData) {
+		appData.Blocklists = blocklists
+	})
+}
+
+// LoadBlocklists 加载IP黑名单订阅
+func (s *Storage) LoadBlocklists() ([]Blocklist, error) {
+	appData, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded %d blocklists", len(appData.Blocklists))
+	return appData.Blocklists, nil
+}
+
+// SaveAuth 保存登录设置
+func (s *Storage) SaveAuth(settings AuthSettings) error {
+	return s.Update(func(appData *AppData) {
+		appData.Auth = &settings
+	})
+}
+
+// LoadAuth 加载登录设置
+func (s *Storage) LoadAuth() (AuthSettings, error) {
+	appData, err := s.Load()
+	if err != nil {
+		return AuthSettings{}, err
+	}
+
+	if appData.Auth == nil {
+		return AuthSettings{}, nil
+	}
+	return *appData.Auth, nil
+}
+
+// LoadSettings 加载程序设置
+func (s *Storage) LoadSettings() (Settings, error) {
+	appData, err := s.Load()
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return appData.EffectiveSettings(), nil
+}
+
+// EffectiveSettings 返回程序设置，旧版本保存在 ui 部分的界面监听设置并入其中
+func (appData AppData) EffectiveSettings() Settings {
+	var settings Settings
+	if appData.Settings != nil {
+		settings = *appData.Settings
+	}
+	if appData.UI != nil && settings.UIListen == "" && settings.UIPort == 0 {
+		settings.UIListen, settings.UIPort = appData.UI.Listen, appData.UI.Port
+	}
+	return settings
+}
+
+// WriteFileAtomic 先写入同目录下的临时文件再重命名，写入中途崩溃时原文件保持完整
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后文件已不存在，删除失败可忽略
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// StartupStep 模板中单条规则的启动配置
+type StartupStep struct {
+	RuleID        string `json:"ruleId"`
+	DelaySeconds  int    `json:"delaySeconds,omitempty"`  // 依赖满足（或上一步完成）后再等待的秒数
+	After         string `json:"after,omitempty"`         // 依赖的规则ID，必须排在本步骤之前
+	WaitHealthy   bool   `json:"waitHealthy,omitempty"`   // 等依赖规则的目标可连接后再启动
+	HealthTimeout int    `json:"healthTimeout,omitempty"` // 等待健康的超时秒数，默认60
+}
+
+// Blocklist 订阅的公共IP黑名单
+type Blocklist struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	URL            string   `json:"url"`
+	RefreshMinutes int      `json:"refreshMinutes"` // 刷新间隔，默认 1440（每天）
+	RuleIDs        []string `json:"ruleIds"`        // 应用到的规则，为空表示全部规则
+	Enabled        bool     `json:"enabled"`
+
+	LastUpdated string `json:"lastUpdated,omitempty"`
+	Entries     int    `json:"entries"`
+	LastError   string `json:"lastError,omitempty"`
+}
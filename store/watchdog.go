@@ -0,0 +1,60 @@
+package store
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 看门狗恢复动作
+const (
+	WatchdogActionWOL    = "wol"    // 发送网络唤醒包
+	WatchdogActionBackup = "backup" // 切换到备用目标
+	WatchdogActionStop   = "stop"   // 停止转发
+	WatchdogActionHook   = "hook"   // 执行钩子命令
+)
+
+// WatchdogConfig 规则的目标看门狗配置
+type WatchdogConfig struct {
+	Enabled          bool   `json:"enabled"`
+	IntervalSeconds  int    `json:"intervalSeconds"`  // 检查间隔，默认10秒
+	FailureThreshold int    `json:"failureThreshold"` // 连续失败多少次后执行动作，默认3次
+	Action           string `json:"action"`
+	WOLMac           string `json:"wolMac,omitempty"`
+	BackupAddr       string `json:"backupAddr,omitempty"`
+	BackupPort       string `json:"backupPort,omitempty"`
+	HookCommand      string `json:"hookCommand,omitempty"`
+}
+
+// WithDefaults 填充默认值
+func (c WatchdogConfig) WithDefaults() WatchdogConfig {
+	if c.IntervalSeconds <= 0 {
+		c.IntervalSeconds = 10
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 3
+	}
+	return c
+}
+
+// Validate 校验看门狗配置
+func (c WatchdogConfig) Validate() error {
+	switch c.Action {
+	case WatchdogActionWOL:
+		if _, err := net.ParseMAC(c.WOLMac); err != nil {
+			return fmt.Errorf("invalid WoL MAC address: %w", err)
+		}
+	case WatchdogActionBackup:
+		if c.BackupAddr == "" || c.BackupPort == "" {
+			return fmt.Errorf("backup target address and port are required")
+		}
+	case WatchdogActionStop:
+	case WatchdogActionHook:
+		if strings.TrimSpace(c.HookCommand) == "" {
+			return fmt.Errorf("hook command is required")
+		}
+	default:
+		return fmt.Errorf("unknown watchdog action %q", c.Action)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// updateTCPTuningRequest apiUpdateTCPTuning 的请求体
+type updateTCPTuningRequest struct {
+	RuleID string             `json:"ruleId"`
+	TCP    *forward.TCPTuning `json:"tcp"`
+}
+
+// apiUpdateTCPTuning 设置规则两侧TCP连接的保活、TCP_NODELAY 与连接目标的超时，tcp 为 null 时使用默认值。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateTCPTuning(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "TCP options", func(req *updateTCPTuningRequest, _ Rule) (func(rule *Rule), error) {
+		if req.TCP != nil {
+			if err := req.TCP.Validate(); err != nil {
+				return nil, err
+			}
+			if !req.TCP.Enabled() {
+				req.TCP = nil
+			}
+		}
+		return func(rule *Rule) { rule.TCPTuning = req.TCP }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
+)
+
+// templateProtocols 一键开启模板时启动的协议
+var templateProtocols = []string{"tcp", "udp"}
+
+// resolveTimeout 校验时解析目标主机名的超时时间
+const resolveTimeout = 3 * time.Second
+
+// RuleCheck 单条规则的启动前检查结果
+type RuleCheck struct {
+	RuleID   string          `json:"ruleId"`
+	Name     string          `json:"name,omitempty"`
+	OK       bool            `json:"ok"`
+	Problems []string        `json:"problems,omitempty"`
+	Ports    []PortCheckItem `json:"ports,omitempty"` // 每个协议的监听端口检查
+}
+
+// PortCheckItem 某协议下监听端口的检查结果
+type PortCheckItem struct {
+	Protocol      string `json:"protocol"`
+	OK            bool   `json:"ok"`
+	Running       bool   `json:"running,omitempty"` // 已由本程序转发，启动时会跳过
+	Error         string `json:"error,omitempty"`
+	SuggestedPort string `json:"suggestedPort,omitempty"`
+}
+
+// TemplateCheck 模板的启动前检查报告
+type TemplateCheck struct {
+	Name  string      `json:"name"`
+	OK    bool        `json:"ok"`
+	Rules []RuleCheck `json:"rules"`
+}
+
+// findTemplate 按名称查找模板
+func findTemplate(name string) (Template, bool) {
+	return ruleStore.Template(name)
+}
+
+// validateTemplate 检查模板中每条规则能否启动，不启动任何转发
+func validateTemplate(template Template) TemplateCheck {
+	report := TemplateCheck{Name: template.Name, OK: true, Rules: []RuleCheck{}}
+
+	// 记录模板内已占用的监听端口，用于发现规则之间的冲突
+	claimed := make(map[string]string)
+
+	// 目标中的变量按开启模板时使用的环境展开
+	settings := currentSettings()
+	if template.Profile != "" {
+		settings.ActiveProfile = template.Profile
+	}
+	vars := settings.ProfileVars()
+
+	for _, ruleID := range template.Rules {
+		check := RuleCheck{RuleID: ruleID}
+		rule, ok := templateRule(template, ruleID)
+		if !ok {
+			check.Problems = append(check.Problems, "rule not found")
+			report.Rules = append(report.Rules, check)
+			report.OK = false
+			continue
+		}
+		check.Name = ruleDisplayName(rule)
+		if resolved, err := store.ExpandRule(rule, vars); err != nil {
+			check.Problems = append(check.Problems, err.Error())
+		} else {
+			check.Problems = checkRuleFields(resolved)
+		}
+
+		// 监听地址与端口有效时检查端口占用，目标无法解析不影响这一步
+		listenPort, err := resolvePort(rule.ListenPort)
+		if err == nil && listenPort != "" && (rule.ListenAddr == "" || net.ParseIP(rule.ListenAddr) != nil) {
+			for _, protocol := range templateProtocols {
+				key := fmt.Sprintf("%s:%s:%s", protocol, rule.ListenAddr, listenPort)
+				if other, dup := claimed[key]; dup {
+					check.Problems = append(check.Problems, fmt.Sprintf("%s %s also used by rule %s", protocol, net.JoinHostPort(rule.ListenAddr, listenPort), other))
+					continue
+				}
+				claimed[key] = rule.ID
+				check.Ports = append(check.Ports, checkListenPort(rule, protocol, listenPort))
+			}
+		}
+
+		check.OK = len(check.Problems) == 0
+		for _, port := range check.Ports {
+			if !port.OK {
+				check.OK = false
+			}
+		}
+		if !check.OK {
+			report.OK = false
+		}
+		report.Rules = append(report.Rules, check)
+	}
+	return report
+}
+
+// checkRuleFields 检查规则的地址与端口是否有效，目标主机名是否可解析
+func checkRuleFields(rule Rule) []string {
+	var problems []string
+
+	if rule.ListenAddr != "" && net.ParseIP(rule.ListenAddr) == nil {
+		problems = append(problems, fmt.Sprintf("invalid listen address %q", rule.ListenAddr))
+	}
+	if rule.ListenPort == "" {
+		problems = append(problems, "listen port is empty")
+	} else if _, err := resolvePort(rule.ListenPort); err != nil {
+		problems = append(problems, "listen port: "+err.Error())
+	}
+	if rule.TargetPort == "" {
+		problems = append(problems, "target port is empty")
+	} else if _, err := resolvePort(rule.TargetPort); err != nil {
+		problems = append(problems, "target port: "+err.Error())
+	} else if err := forward.CheckPortRange(rule.ListenPort, rule.TargetPort); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	switch {
+	case rule.TargetAddr == "":
+		problems = append(problems, "target address is empty")
+	case net.ParseIP(rule.TargetAddr) == nil:
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+		if _, err := net.DefaultResolver.LookupHost(ctx, rule.TargetAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("cannot resolve target %q: %v", rule.TargetAddr, err))
+		}
+	}
+	return problems
+}
+
+// checkListenPort 检查规则在某协议下的监听端口能否绑定
+func checkListenPort(rule Rule, protocol, listenPort string) PortCheckItem {
+	item := PortCheckItem{Protocol: protocol}
+	if isRuleForwardRunning(Rule{ListenAddr: rule.ListenAddr, ListenPort: listenPort}, protocol) {
+		item.OK = true
+		item.Running = true
+		return item
+	}
+
+	port, _ := strconv.Atoi(listenPort)
+	if isPortFree(protocol, rule.ListenAddr, port) {
+		item.OK = true
+		return item
+	}
+
+	item.Error = fmt.Sprintf("%s port %s is in use or cannot be bound", protocol, net.JoinHostPort(rule.ListenAddr, listenPort))
+	if owner := describePortConflict(protocol, rule.ListenAddr, listenPort); owner != "" {
+		item.Error += " (" + owner + ")"
+	}
+	if suggested, ok := suggestFreePort(protocol, rule.ListenAddr, port); ok {
+		item.SuggestedPort = strconv.Itoa(suggested)
+	}
+	return item
+}
+
+// apiValidateTemplate 模板启动前检查（不启动任何转发）
+func apiValidateTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if r.Method == http.MethodPost {
+		var req nameRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Failed to decode request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		name = req.Name
+	}
+
+	template, ok := findTemplate(name)
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(validateTemplate(template))
+}
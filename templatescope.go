@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// maxTemplateDescriptionLen 模板描述的最大字符数
+const maxTemplateDescriptionLen = 500
+
+// templateRule 查找模板中的规则，私有副本优先于全局规则
+func templateRule(template Template, id string) (Rule, bool) {
+	for _, rule := range template.Snapshots {
+		if rule.ID == id {
+			return store.CloneRule(rule), true
+		}
+	}
+	return findRule(id)
+}
+
+// privateRuleIDs 模板私有副本的ID列表
+func privateRuleIDs(template Template) []string {
+	ids := make([]string, 0, len(template.Snapshots))
+	for _, rule := range template.Snapshots {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+// updateTemplateRuleScopeRequest apiUpdateTemplateRuleScope 的请求体
+type updateTemplateRuleScopeRequest struct {
+	Name    string `json:"name"`
+	RuleID  string `json:"ruleId"`
+	Private bool   `json:"private"`
+}
+
+// apiUpdateTemplateRuleScope 切换模板中规则的归属：private=true 时把引用的全局规则复制为模板私有的副本，
+// private=false 时把私有副本加入全局规则列表并改为引用
+func apiUpdateTemplateRuleScope(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析请求体
+	var req updateTemplateRuleScopeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ruleID := req.RuleID
+	var err error
+	if req.Private {
+		ruleID, err = ruleStore.DetachTemplateRule(req.Name, req.RuleID)
+	} else {
+		_, err = ruleStore.LinkTemplateRule(req.Name, req.RuleID)
+	}
+	if errors.Is(err, store.ErrTemplateNotFound) {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrRuleNotFound) {
+		http.Error(w, "Rule not found in template", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save templates: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "ruleId": ruleID})
+}
+
+// setTemplateRules 按给定顺序设置模板的规则。规则必须是全局规则（global 为全局规则ID集合）或模板的私有副本；
+// 移除的私有副本一并删除，启动顺序中引用移除规则的步骤也被删除
+func setTemplateRules(t *Template, ids []string, global map[string]bool) error {
+	private := make(map[string]bool, len(t.Snapshots))
+	for _, snapshot := range t.Snapshots {
+		private[snapshot.ID] = true
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("rule %s listed twice", id)
+		}
+		seen[id] = true
+		if !global[id] && !private[id] {
+			return fmt.Errorf("rule %s not found", id)
+		}
+	}
+
+	snapshots := []Rule{}
+	for _, snapshot := range t.Snapshots {
+		if seen[snapshot.ID] {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	t.Snapshots = nil
+	if len(snapshots) > 0 {
+		t.Snapshots = snapshots
+	}
+
+	var steps []StartupStep
+	for _, step := range t.Startup {
+		if !seen[step.RuleID] {
+			continue
+		}
+		if step.After != "" && !seen[step.After] {
+			step.After, step.WaitHealthy = "", false
+		}
+		steps = append(steps, step)
+	}
+	t.Startup = steps
+	t.Rules = append([]string{}, ids...)
+	return nil
+}
+
+// validateTemplateDescription 校验模板描述的长度
+func validateTemplateDescription(description string) error {
+	if utf8.RuneCountInString(description) > maxTemplateDescriptionLen {
+		return fmt.Errorf("description must be at most %d characters", maxTemplateDescriptionLen)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// templateBundleVersion 模板分享文件的格式版本
+const templateBundleVersion = 1
+
+// TemplateBundle 可分享的模板：模板本身与其中规则的完整定义，导入时重新分配规则ID
+type TemplateBundle struct {
+	Version    int      `json:"version"`
+	ExportedAt string   `json:"exportedAt"`
+	Template   Template `json:"template"`
+	Rules      []Rule   `json:"rules"`
+}
+
+// apiExportTemplate 导出模板及其规则的完整定义，下载为 JSON 文件
+func apiExportTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	template, ok := ruleStore.Template(name)
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	templateRules, _ := ruleStore.TemplateRules(name)
+
+	bundle := TemplateBundle{
+		Version:    templateBundleVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Template:   template,
+		Rules:      []Rule{},
+	}
+	// 模板中只保留存在的规则；私有副本随模板导出，其余为引用的全局规则。运行状态只对本机有意义
+	private := make(map[string]bool)
+	for _, id := range privateRuleIDs(template) {
+		private[id] = true
+	}
+	bundle.Template.Rules = make([]string, 0, len(templateRules))
+	for _, rule := range templateRules {
+		bundle.Template.Rules = append(bundle.Template.Rules, rule.ID)
+		if !private[rule.ID] {
+			rule.Running = nil
+			bundle.Rules = append(bundle.Rules, rule)
+		}
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode template: %v", err)
+		http.Error(w, "Failed to encode template", http.StatusInternalServerError)
+		return
+	}
+
+	// 文件名中去掉路径分隔符等不安全的字符
+	safeName := strings.Map(func(c rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, c) || c < ' ' {
+			return '_'
+		}
+		return c
+	}, name)
+	filename := fmt.Sprintf("goports-template-%s.json", safeName)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
+}
+
+// apiImportTemplate 导入 apiExportTemplate 导出的模板：规则全部分配新ID与序号后加入规则列表，
+// 模板重名时自动改名。name 参数可指定导入后的模板名称，dryRun=1 只校验并返回将要进行的变更
+func apiImportTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	result := ConfigImportResult{Mode: ImportMerge, DryRun: query.Get("dryRun") == "1", Stopped: []string{}, Warnings: []string{}}
+	fail := func(status int, err error) {
+		result.Error = err.Error()
+		writeJSON(w, status, result)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize+1))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxConfigSize {
+		fail(http.StatusRequestEntityTooLarge, fmt.Errorf("template larger than %d bytes", maxConfigSize))
+		return
+	}
+
+	var bundle TemplateBundle
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		fail(http.StatusBadRequest, fmt.Errorf("invalid JSON: %w", err))
+		return
+	}
+	if bundle.Version > templateBundleVersion {
+		fail(http.StatusBadRequest, fmt.Errorf("template file version %d is newer than supported version %d", bundle.Version, templateBundleVersion))
+		return
+	}
+	if name := strings.TrimSpace(query.Get("name")); name != "" {
+		bundle.Template.Name = name
+	}
+
+	// 规则ID只在导出的机器上有意义，全部重新分配并更新模板中的引用
+	idMap := make(map[string]string)
+	for _, list := range [][]Rule{bundle.Rules, bundle.Template.Snapshots} {
+		for i := range list {
+			newID := uuid.New().String()
+			if list[i].ID != "" {
+				idMap[list[i].ID] = newID
+			}
+			list[i].ID = newID
+		}
+	}
+	remap := func(id string) string {
+		if mapped, ok := idMap[id]; ok {
+			return mapped
+		}
+		return id
+	}
+	for i, id := range bundle.Template.Rules {
+		bundle.Template.Rules[i] = remap(id)
+	}
+	for i := range bundle.Template.Startup {
+		bundle.Template.Startup[i].RuleID = remap(bundle.Template.Startup[i].RuleID)
+		if bundle.Template.Startup[i].After != "" {
+			bundle.Template.Startup[i].After = remap(bundle.Template.Startup[i].After)
+		}
+	}
+	bundle.Template.CreatedAt = time.Now().Format(time.RFC3339)
+
+	imported := AppData{Rules: bundle.Rules, Templates: []Template{bundle.Template}}
+	if err := normalizeImportedConfig(&imported, &result); err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+
+	// 与本机规则监听地址重复或形成环路时只提示，导入后可再修改
+	for i, rule := range imported.Rules {
+		for _, e := range validateRuleFields(rule) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("rule %d: %s: %s", i+1, e.Field, e.Message))
+		}
+	}
+
+	current, err := storage.Load()
+	if err != nil {
+		log.Printf("Failed to load app data: %v", err)
+		fail(http.StatusInternalServerError, fmt.Errorf("failed to load current configuration"))
+		return
+	}
+	next, _ := mergeConfig(current, imported, ConflictRename, &result)
+
+	if !result.DryRun {
+		if err := applyConfig(next); err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		log.Printf("Imported template %s with %d rules", next.Templates[len(next.Templates)-1].Name, result.Rules.Added)
+	}
+
+	result.Success = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ConfigImportResult
+		Template string `json:"template"`
+	}{result, next.Templates[len(next.Templates)-1].Name})
+}
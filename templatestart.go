@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 顺序启动中单条规则的状态
+const (
+	StepPending = "pending" // 等待前面的步骤
+	StepWaiting = "waiting" // 等待依赖或延迟
+	StepStarted = "started"
+	StepFailed  = "failed"
+	StepSkipped = "skipped" // 依赖未满足或启动被取消
+)
+
+// defaultHealthTimeout 等待依赖目标健康的默认超时
+const defaultHealthTimeout = 60 * time.Second
+
+// StepStatus 顺序启动中单条规则的进度
+type StepStatus struct {
+	RuleID string `json:"ruleId"`
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TemplateStartup 模板顺序启动的进度
+type TemplateStartup struct {
+	Name       string       `json:"name"`
+	Running    bool         `json:"running"`
+	StartedAt  time.Time    `json:"startedAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+	Steps      []StepStatus `json:"steps"`
+
+	cancel   chan struct{}
+	template Template
+	source   string // 事件历史中记录的来源
+}
+
+// templateStartups 各模板最近一次顺序启动的进度
+var templateStartups = struct {
+	sync.Mutex
+	byName map[string]*TemplateStartup
+}{byName: make(map[string]*TemplateStartup)}
+
+// startupPlan 按启动配置排列模板中的规则，未配置的规则按原顺序排在最后
+func startupPlan(template Template) []StartupStep {
+	plan := make([]StartupStep, 0, len(template.Rules))
+	listed := make(map[string]bool)
+	for _, step := range template.Startup {
+		plan = append(plan, step)
+		listed[step.RuleID] = true
+	}
+	for _, ruleID := range template.Rules {
+		if !listed[ruleID] {
+			plan = append(plan, StartupStep{RuleID: ruleID})
+		}
+	}
+	return plan
+}
+
+// validateStartup 校验模板的启动配置
+func validateStartup(template Template, steps []StartupStep) error {
+	inTemplate := make(map[string]bool)
+	for _, ruleID := range template.Rules {
+		inTemplate[ruleID] = true
+	}
+	seen := make(map[string]bool)
+	for i, step := range steps {
+		if !inTemplate[step.RuleID] {
+			return fmt.Errorf("step %d: rule %s is not in template %s", i+1, step.RuleID, template.Name)
+		}
+		if seen[step.RuleID] {
+			return fmt.Errorf("step %d: rule %s listed twice", i+1, step.RuleID)
+		}
+		if step.DelaySeconds < 0 || step.HealthTimeout < 0 {
+			return fmt.Errorf("step %d: delay and timeout must not be negative", i+1)
+		}
+		if step.After != "" && !seen[step.After] {
+			return fmt.Errorf("step %d: dependency %s must be started earlier in the order", i+1, step.After)
+		}
+		if step.WaitHealthy && step.After == "" {
+			return fmt.Errorf("step %d: waitHealthy requires a dependency", i+1)
+		}
+		seen[step.RuleID] = true
+	}
+	return nil
+}
+
+// startTemplateSequence 在后台按顺序启动模板中的规则，已有进行中的启动时返回错误
+func startTemplateSequence(template Template, source string) (*TemplateStartup, error) {
+	plan := startupPlan(template)
+	progress := &TemplateStartup{
+		Name:      template.Name,
+		Running:   true,
+		StartedAt: time.Now(),
+		cancel:    make(chan struct{}),
+		template:  template,
+		source:    source,
+	}
+	for _, step := range plan {
+		progress.Steps = append(progress.Steps, StepStatus{RuleID: step.RuleID, State: StepPending})
+	}
+
+	templateStartups.Lock()
+	if current, ok := templateStartups.byName[template.Name]; ok && current.Running {
+		templateStartups.Unlock()
+		return nil, fmt.Errorf("template %s is already starting", template.Name)
+	}
+	templateStartups.byName[template.Name] = progress
+	templateStartups.Unlock()
+
+	go runTemplateSequence(progress, plan)
+	return progress, nil
+}
+
+// runTemplateSequence 依次等待依赖、延迟并启动每条规则
+func runTemplateSequence(progress *TemplateStartup, plan []StartupStep) {
+	started := make(map[string]bool)
+	setState := func(i int, state string, err error) {
+		templateStartups.Lock()
+		progress.Steps[i].State = state
+		if err != nil {
+			progress.Steps[i].Error = err.Error()
+		}
+		templateStartups.Unlock()
+	}
+
+	for i, step := range plan {
+		rule, ok := templateRule(progress.template, step.RuleID)
+		if !ok {
+			setState(i, StepSkipped, fmt.Errorf("rule not found"))
+			continue
+		}
+		if step.After != "" && !started[step.After] {
+			setState(i, StepSkipped, fmt.Errorf("dependency %s did not start", step.After))
+			continue
+		}
+
+		setState(i, StepWaiting, nil)
+		if err := waitStartupStep(progress.template, step, progress.cancel); err != nil {
+			setState(i, StepSkipped, err)
+			continue
+		}
+
+		var failed error
+		for _, protocol := range templateProtocols {
+			if isRuleForwardRunning(rule, protocol) {
+				continue
+			}
+			if err := startRuleForward(rule, protocol, progress.source); err != nil {
+				log.Printf("Template %s: failed to start %s forward of rule %s: %v", progress.Name, protocol, rule.ID, err)
+				failed = err
+			}
+		}
+		if failed != nil && len(runningProtocols(rule)) == 0 {
+			setState(i, StepFailed, failed)
+			continue
+		}
+		setState(i, StepStarted, failed)
+		started[rule.ID] = true
+	}
+
+	templateStartups.Lock()
+	finished := time.Now()
+	progress.Running = false
+	progress.FinishedAt = &finished
+	templateStartups.Unlock()
+	log.Printf("Template %s startup sequence finished", progress.Name)
+}
+
+// waitStartupStep 等待依赖目标健康及延迟，取消时返回错误
+func waitStartupStep(template Template, step StartupStep, cancel <-chan struct{}) error {
+	if step.WaitHealthy {
+		dep, ok := templateRule(template, step.After)
+		if !ok {
+			return fmt.Errorf("dependency %s not found", step.After)
+		}
+		timeout := defaultHealthTimeout
+		if step.HealthTimeout > 0 {
+			timeout = time.Duration(step.HealthTimeout) * time.Second
+		}
+		if err := waitTargetHealthy(dep, timeout, cancel); err != nil {
+			return err
+		}
+	}
+
+	if step.DelaySeconds > 0 {
+		select {
+		case <-time.After(time.Duration(step.DelaySeconds) * time.Second):
+		case <-cancel:
+			return fmt.Errorf("startup cancelled")
+		}
+	}
+	return nil
+}
+
+// waitTargetHealthy 每秒探测一次规则目标，直到可连接或超时
+func waitTargetHealthy(rule Rule, timeout time.Duration, cancel <-chan struct{}) error {
+	rule, err := resolveRule(rule)
+	if err != nil {
+		return err
+	}
+	target := net.JoinHostPort(rule.TargetAddr, rule.TargetPort)
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", target, 3*time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("target %s of %s not healthy after %s: %v", target, rule.ID, timeout, err)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-cancel:
+			return fmt.Errorf("startup cancelled")
+		}
+	}
+}
+
+// startTemplateForwards 启动模板中所有规则的 TCP/UDP 转发，source 为事件历史中记录的来源。
+// 模板指定了环境时先切换到该环境；配置了启动顺序时在后台按顺序启动，返回 sequenced 为 true
+func startTemplateForwards(template Template, source string) (sequenced bool, err error) {
+	if template.Profile != "" {
+		if err := switchProfile(template.Profile, source); err != nil {
+			return false, err
+		}
+	}
+
+	if len(template.Startup) > 0 {
+		_, err := startTemplateSequence(template, source)
+		return err == nil, err
+	}
+
+	// 根据模板中的规则ID列表获取对应的规则详情并启动转发，已在运行的跳过
+	templateRules, _ := ruleStore.TemplateRules(template.Name)
+	for _, rule := range templateRules {
+		for _, protocol := range templateProtocols {
+			if !isRuleForwardRunning(rule, protocol) {
+				startRuleForward(rule, protocol, source)
+			}
+		}
+	}
+	return false, nil
+}
+
+// stopTemplateForwards 停止模板中所有规则的转发，并取消进行中的顺序启动
+func stopTemplateForwards(template Template, source string) {
+	// 取消进行中的顺序启动，避免停止后又被启动
+	cancelTemplateSequence(template.Name)
+
+	// 根据模板中的规则ID列表获取对应的规则详情并停止转发
+	templateRules, _ := ruleStore.TemplateRules(template.Name)
+	for _, rule := range templateRules {
+		// 只停止属于该规则的转发，同一监听地址上其他规则的转发保持运行
+		for _, protocol := range runningProtocols(rule) {
+			stopRuleForward(rule, protocol, source)
+		}
+	}
+}
+
+// cancelTemplateSequence 取消模板进行中的顺序启动
+func cancelTemplateSequence(name string) {
+	templateStartups.Lock()
+	defer templateStartups.Unlock()
+	if progress, ok := templateStartups.byName[name]; ok && progress.Running {
+		select {
+		case <-progress.cancel:
+		default:
+			close(progress.cancel)
+		}
+	}
+}
+
+// apiGetTemplateStartup 获取模板的启动配置与最近一次顺序启动的进度
+func apiGetTemplateStartup(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	template, ok := findTemplate(name)
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	templateStartups.Lock()
+	var progress *TemplateStartup
+	if p, ok := templateStartups.byName[name]; ok {
+		copied := *p
+		copied.Steps = append([]StepStatus(nil), p.Steps...)
+		progress = &copied
+	}
+	templateStartups.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"startup":  template.Startup,
+		"plan":     startupPlan(template),
+		"progress": progress,
+	})
+}
+
+// updateTemplateStartupRequest apiUpdateTemplateStartup 的请求体
+type updateTemplateStartupRequest struct {
+	Name    string        `json:"name"`
+	Startup []StartupStep `json:"startup"`
+}
+
+// apiUpdateTemplateStartup 更新模板的启动顺序、延迟与依赖
+func apiUpdateTemplateStartup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req updateTemplateStartupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	template, ok := findTemplate(req.Name)
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err := validateStartup(template, req.Startup); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := ruleStore.UpdateTemplates(func(templates []Template) ([]Template, bool) {
+		for i := range templates {
+			if templates[i].Name == req.Name {
+				templates[i].Startup = req.Startup
+				return templates, true
+			}
+		}
+		return templates, false
+	})
+	if err != nil {
+		log.Printf("Failed to save templates: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
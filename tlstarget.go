@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// apiGetTLSTarget 获取规则的 TLS 目标配置
+func apiGetTLSTarget(w http.ResponseWriter, r *http.Request) {
+	getRuleOption(w, r, func(rule Rule) map[string]interface{} {
+		return map[string]interface{}{"tlsTarget": rule.TLSTarget}
+	})
+}
+
+// updateTLSTargetRequest apiUpdateTLSTarget 的请求体
+type updateTLSTargetRequest struct {
+	RuleID    string             `json:"ruleId"`
+	TLSTarget *forward.TLSTarget `json:"tlsTarget"`
+}
+
+// apiUpdateTLSTarget 设置规则的 TLS 目标配置，tlsTarget 为 null 时移除
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateTLSTarget(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "TLS target", func(req *updateTLSTargetRequest, _ Rule) (func(rule *Rule), error) {
+		if req.TLSTarget != nil {
+			if err := req.TLSTarget.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.TLSTarget = req.TLSTarget }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
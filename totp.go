@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// TOTP 参数（RFC 6238，兼容常见验证器应用）
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // 允许前后各一个周期的时钟偏差
+	totpIssuer = "go-ports"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret 生成随机的 Base32 密钥
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpCode 计算某个时间步的验证码
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+// verifyTOTP 校验验证码，返回匹配的时间步
+// 时间步不大于 lastCounter 的验证码视为重放，不予通过
+func verifyTOTP(secret, code string, lastCounter uint64) (uint64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := uint64(time.Now().Unix() / totpPeriod)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		counter := uint64(int64(now) + int64(i))
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI 生成验证器应用使用的 otpauth 链接
+func totpURI(secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("period", fmt.Sprint(totpPeriod))
+	v.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":admin") + "?" + v.Encode()
+}
+
+// apiGetTOTP 获取两步验证状态
+func apiGetTOTP(w http.ResponseWriter, r *http.Request) {
+	authState.Lock()
+	enabled := authState.settings.TOTPEnabled
+	authState.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"loginEnabled": loginEnabled(),
+		"enabled":      enabled,
+	})
+}
+
+// apiSetupTOTP 生成待确认的密钥及二维码
+func apiSetupTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !loginEnabled() {
+		writeError(w, http.StatusConflict, "请先通过 -ui-password 启用登录")
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	uri := totpURI(secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 200)
+	if err != nil {
+		log.Printf("Failed to create QR code: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	authState.Lock()
+	authState.pendingSecret = secret
+	authState.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"secret":  secret,
+		"uri":     uri,
+		"qrCode":  "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// totpCodeRequest 提交两步验证码的请求体
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// apiEnableTOTP 用验证码确认并启用两步验证
+func apiEnableTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	authState.Lock()
+	defer authState.Unlock()
+
+	if authState.pendingSecret == "" {
+		writeError(w, http.StatusConflict, "请先生成密钥")
+		return
+	}
+	counter, ok := verifyTOTP(authState.pendingSecret, req.Code, 0)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "验证码错误")
+		return
+	}
+
+	// 保存成功后才启用，失败时保留待确认的密钥以便重试
+	next := authState.settings
+	next.TOTPSecret = authState.pendingSecret
+	next.TOTPEnabled = true
+	if err := storage.SaveAuth(next); err != nil {
+		log.Printf("Failed to save auth settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save auth settings")
+		return
+	}
+	authState.settings = next
+	authState.lastCounter = counter
+	authState.pendingSecret = ""
+
+	log.Printf("TOTP two-factor authentication enabled")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
+
+// apiDisableTOTP 用当前验证码确认并关闭两步验证
+func apiDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	authState.Lock()
+	defer authState.Unlock()
+
+	if !authState.settings.TOTPEnabled {
+		json.NewEncoder(w).Encode(Result{Success: true})
+		return
+	}
+	counter, ok := verifyTOTP(authState.settings.TOTPSecret, req.Code, authState.lastCounter)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "验证码错误")
+		return
+	}
+
+	// 保存成功后才关闭，失败时两步验证保持开启
+	if err := storage.SaveAuth(AuthSettings{}); err != nil {
+		log.Printf("Failed to save auth settings: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save auth settings")
+		return
+	}
+	authState.lastCounter = counter
+	authState.settings = AuthSettings{}
+
+	log.Printf("TOTP two-factor authentication disabled")
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
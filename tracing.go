@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP span 类型与状态码
+const (
+	otlpSpanKindServer = 2
+	otlpSpanKindClient = 3
+	otlpStatusOK       = 1
+	otlpStatusError    = 2
+)
+
+// otlpBatchSize 达到此数量立即导出
+const otlpBatchSize = 256
+
+// spanQueue 待导出的 span，未启用追踪时为 nil
+var spanQueue chan otlpSpan
+
+// otlpSpan OTLP/JSON 格式的 span
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // OTLP/JSON 中 int64 编码为字符串
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpAnyValue{IntValue: &s}}
+}
+
+// connSpan 记录一次转发连接的生命周期：accept -> dial -> close
+type connSpan struct {
+	traceID   string
+	spanID    string
+	protocol  string
+	client    string
+	listen    string
+	target    string
+	start     time.Time
+	dialStart time.Time
+	dialEnd   time.Time
+	dialErr   error
+}
+
+// startConnSpan 在接受连接时开始追踪，未启用追踪时返回 nil
+func startConnSpan(protocol string, conn net.Conn, target string) *connSpan {
+	if spanQueue == nil {
+		return nil
+	}
+	return &connSpan{
+		traceID:  randomHex(16),
+		spanID:   randomHex(8),
+		protocol: protocol,
+		client:   conn.RemoteAddr().String(),
+		listen:   conn.LocalAddr().String(),
+		target:   target,
+		start:    time.Now(),
+	}
+}
+
+// dialStarted 记录开始连接目标
+func (s *connSpan) dialStarted() {
+	if s == nil {
+		return
+	}
+	s.dialStart = time.Now()
+}
+
+// dialDone 记录目标连接结果
+func (s *connSpan) dialDone(err error) {
+	if s == nil {
+		return
+	}
+	s.dialEnd = time.Now()
+	s.dialErr = err
+}
+
+// end 结束追踪并提交导出
+func (s *connSpan) end(bytesIn, bytesOut int64) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+
+	root := otlpSpan{
+		TraceID:           s.traceID,
+		SpanID:            s.spanID,
+		Name:              s.protocol + " forward",
+		Kind:              otlpSpanKindServer,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(now),
+		Attributes: []otlpAttribute{
+			otlpString("network.transport", s.protocol),
+			otlpString("client.address", s.client),
+			otlpString("server.address", s.listen),
+			otlpString("goports.target", s.target),
+			otlpInt("goports.bytes_in", bytesIn),
+			otlpInt("goports.bytes_out", bytesOut),
+		},
+		Status: otlpStatus{Code: otlpStatusOK},
+	}
+
+	dial := otlpSpan{
+		TraceID:           s.traceID,
+		SpanID:            randomHex(8),
+		ParentSpanID:      s.spanID,
+		Name:              "dial " + s.target,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: unixNano(s.dialStart),
+		EndTimeUnixNano:   unixNano(s.dialEnd),
+		Attributes: []otlpAttribute{
+			otlpString("network.transport", s.protocol),
+			otlpString("server.address", s.target),
+		},
+		Status: otlpStatus{Code: otlpStatusOK},
+	}
+	if s.dialErr != nil {
+		root.Status = otlpStatus{Code: otlpStatusError, Message: s.dialErr.Error()}
+		dial.Status = otlpStatus{Code: otlpStatusError, Message: s.dialErr.Error()}
+	}
+
+	for _, span := range []otlpSpan{root, dial} {
+		select {
+		case spanQueue <- span:
+		default:
+			// 队列已满时丢弃，追踪不能影响转发
+		}
+	}
+}
+
+// startTraceExporter 启动 OTLP/HTTP 导出协程
+func startTraceExporter() {
+	if *otlpEndpoint == "" {
+		return
+	}
+
+	url := strings.TrimSuffix(*otlpEndpoint, "/") + "/v1/traces"
+	spanQueue = make(chan otlpSpan, 4*otlpBatchSize)
+	log.Printf("Exporting connection traces to %s", url)
+
+	go func() {
+		client := &http.Client{Timeout: 10 * time.Second}
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		var batch []otlpSpan
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := exportSpans(client, url, batch); err != nil {
+				log.Printf("Failed to export %d spans: %v", len(batch), err)
+			}
+			batch = batch[:0]
+		}
+
+		for {
+			select {
+			case span := <-spanQueue:
+				batch = append(batch, span)
+				if len(batch) >= otlpBatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+// exportSpans 以 OTLP/JSON 发送一批 span
+func exportSpans(client *http.Client, url string, spans []otlpSpan) error {
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{otlpString("service.name", *otlpServiceName)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "go-ports/forwarder"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// randomHex 生成 n 字节的随机十六进制 ID
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// unixNano OTLP/JSON 时间戳
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// apiGetTransparentSupport 检查当前环境能否使用透明代理模式
+func apiGetTransparentSupport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]interface{}{"supported": forward.TransparentSupported}
+	if err := forward.CheckTransparentSupport(); err != nil {
+		resp["supported"] = false
+		resp["error"] = err.Error()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// apiUpdateTransparent 开启或关闭规则的透明代理模式（仅TCP），开启前检查当前环境是否支持。
+// 正在运行的转发会重启以应用新配置，已建立的连接不受影响
+func apiUpdateTransparent(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "transparent proxy", func(req *ruleToggleRequest, current Rule) (func(rule *Rule), error) {
+		if req.Enabled {
+			if err := forward.CheckTransparentSupport(); err != nil {
+				return nil, err
+			}
+			switch {
+			case current.SSHHost != "":
+				return nil, errors.New("transparent proxy cannot be used with an SSH host")
+			case current.Bind.Enabled():
+				return nil, errors.New("transparent proxy cannot be used with an outbound interface")
+			case len(current.Via) > 0:
+				return nil, errors.New("transparent proxy cannot be used with relay nodes")
+			}
+		}
+		return func(rule *Rule) { rule.Transparent = req.Enabled }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// trayURL 托盘菜单“打开管理界面”使用的地址
+var trayURL string
+
+// openBrowser 用系统默认浏览器打开地址
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// trayOpenUI 打开管理界面
+func trayOpenUI() {
+	if err := openBrowser(trayURL); err != nil {
+		log.Printf("Tray: failed to open %s: %v", trayURL, err)
+	}
+}
+
+// trayStartAll 启动所有规则的 TCP/UDP 转发
+func trayStartAll() {
+	started, failures := startAllForwards([]string{"tcp", "udp"}, sourceTray)
+	for _, f := range failures {
+		log.Printf("Tray: failed to start %s forward of rule %s: %s", f.Protocol, f.RuleID, f.Error)
+	}
+	log.Printf("Tray: started %d forwards", started)
+}
+
+// trayStopAll 停止所有正在运行的转发
+func trayStopAll() {
+	stopped, failures := stopAllForwards([]string{"tcp", "udp", "sctp", "socks5"}, sourceTray)
+	for _, f := range failures {
+		log.Printf("Tray: failed to stop %s forward of rule %s: %s", f.Protocol, f.RuleID, f.Error)
+	}
+	log.Printf("Tray: stopped %d forwards", stopped)
+}
+
+// traySwitchTemplate 停止所有转发后启动模板
+func traySwitchTemplate(name string) {
+	template, ok := ruleStore.Template(name)
+	if !ok {
+		log.Printf("Tray: template %s not found", name)
+		return
+	}
+	trayStopAll()
+	if _, err := startTemplateForwards(template, sourceTray); err != nil {
+		log.Printf("Tray: failed to start template %s: %v", name, err)
+		return
+	}
+	log.Printf("Tray: switched to template %s", name)
+}
+
+// trayQuit 优雅关闭转发后退出
+func trayQuit() {
+	log.Printf("Tray: quit requested, shutting down (timeout %s)", *shutdownTimeout)
+	shutdown(*shutdownTimeout)
+	log.Println("Shutdown complete")
+	os.Exit(0)
+}
+
+// trayTooltip 托盘图标的提示文字
+func trayTooltip() string {
+	running := 0
+	for _, rule := range ruleStore.Rules() {
+		running += len(runningProtocols(rule))
+	}
+	return fmt.Sprintf("%s - %d forwards running", serviceDisplayName, running)
+}
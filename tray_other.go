@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// startTray 托盘图标只支持 Windows：macOS/Linux 的托盘需要 cgo（AppKit/GTK）或 D-Bus StatusNotifier 依赖，
+// 为保持纯 Go 静态编译不引入这些依赖，这些平台上 -tray 只记录警告，管理界面仍可通过浏览器访问
+func startTray() {
+	newLogger("tray").Warnf("Tray: -tray is only supported on Windows and is ignored on this platform, use the web UI at %s", trayURL)
+}
@@ -0,0 +1,245 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// 托盘使用的 Win32 常量
+const (
+	wmMouseMove   = 0x0200
+	wmLButtonDbl  = 0x0203
+	wmRButtonUp   = 0x0205
+	wmApp         = 0x8000
+	wmTrayNotify  = wmApp + 1
+	nimAdd        = 0
+	nimModify     = 1
+	nimDelete     = 2
+	nifMessage    = 0x1
+	nifIcon       = 0x2
+	nifTip        = 0x4
+	mfString      = 0x0
+	mfPopup       = 0x10
+	mfSeparator   = 0x800
+	mfGrayed      = 0x1
+	tpmReturnCmd  = 0x100
+	tpmNoNotify   = 0x80
+	tpmRightAlign = 0x8
+	idiApp        = 32512
+	hwndMessage   = ^uintptr(2) // HWND_MESSAGE (-3)
+)
+
+// 托盘菜单项ID，模板从 trayMenuTemplate 开始编号
+const (
+	trayMenuOpen = iota + 1
+	trayMenuStartAll
+	trayMenuStopAll
+	trayMenuQuit
+	trayMenuTemplate = 100
+)
+
+var (
+	user32               = syscall.NewLazyDLL("user32.dll")
+	shell32              = syscall.NewLazyDLL("shell32.dll")
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procRegisterClassExW = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW  = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW   = user32.NewProc("DefWindowProcW")
+	procGetMessageW      = user32.NewProc("GetMessageW")
+	procTranslateMessage = user32.NewProc("TranslateMessage")
+	procDispatchMessageW = user32.NewProc("DispatchMessageW")
+	procLoadIconW        = user32.NewProc("LoadIconW")
+	procCreatePopupMenu  = user32.NewProc("CreatePopupMenu")
+	procAppendMenuW      = user32.NewProc("AppendMenuW")
+	procTrackPopupMenu   = user32.NewProc("TrackPopupMenu")
+	procDestroyMenu      = user32.NewProc("DestroyMenu")
+	procGetCursorPos     = user32.NewProc("GetCursorPos")
+	procSetForegroundWin = user32.NewProc("SetForegroundWindow")
+	procShellNotifyIconW = shell32.NewProc("Shell_NotifyIconW")
+	procGetModuleHandleW = kernel32.NewProc("GetModuleHandleW")
+)
+
+// wndClassEx 对应 WNDCLASSEXW
+type wndClassEx struct {
+	size       uint32
+	style      uint32
+	wndProc    uintptr
+	clsExtra   int32
+	wndExtra   int32
+	instance   uintptr
+	icon       uintptr
+	cursor     uintptr
+	background uintptr
+	menuName   *uint16
+	className  *uint16
+	iconSm     uintptr
+}
+
+// notifyIconData 对应 NOTIFYICONDATAW
+type notifyIconData struct {
+	size            uint32
+	wnd             uintptr
+	id              uint32
+	flags           uint32
+	callbackMessage uint32
+	icon            uintptr
+	tip             [128]uint16
+	state           uint32
+	stateMask       uint32
+	info            [256]uint16
+	version         uint32
+	infoTitle       [64]uint16
+	infoFlags       uint32
+	guidItem        [16]byte
+	balloonIcon     uintptr
+}
+
+// winMsg 对应 MSG
+type winMsg struct {
+	wnd     uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	x, y    int32
+	private uint32
+}
+
+// trayIcon 当前的托盘图标数据，仅在托盘线程中访问
+var trayIcon notifyIconData
+
+// startTray 在单独的系统线程上创建托盘图标并运行消息循环
+func startTray() {
+	go func() {
+		runtime.LockOSThread()
+		if err := runTray(); err != nil {
+			log.Printf("Tray: %v", err)
+		}
+	}()
+}
+
+// runTray 创建隐藏的消息窗口与托盘图标，直到窗口销毁
+func runTray() error {
+	instance, _, _ := procGetModuleHandleW.Call(0)
+	className, _ := syscall.UTF16PtrFromString("PortForwarderTray")
+	wc := wndClassEx{
+		wndProc:   syscall.NewCallback(trayWndProc),
+		instance:  instance,
+		className: className,
+	}
+	wc.size = uint32(unsafe.Sizeof(wc))
+	if r, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+		return err
+	}
+	wnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), 0, 0, 0, 0, 0, 0, hwndMessage, 0, instance, 0)
+	if wnd == 0 {
+		return err
+	}
+
+	icon, _, _ := procLoadIconW.Call(0, idiApp)
+	trayIcon = notifyIconData{
+		wnd:             wnd,
+		id:              1,
+		flags:           nifMessage | nifIcon | nifTip,
+		callbackMessage: wmTrayNotify,
+		icon:            icon,
+	}
+	trayIcon.size = uint32(unsafe.Sizeof(trayIcon))
+	setTrayTip(trayTooltip())
+	if r, _, err := procShellNotifyIconW.Call(nimAdd, uintptr(unsafe.Pointer(&trayIcon))); r == 0 {
+		return err
+	}
+	defer procShellNotifyIconW.Call(nimDelete, uintptr(unsafe.Pointer(&trayIcon)))
+	log.Println("Tray icon added")
+
+	var msg winMsg
+	for {
+		r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+		if int32(r) <= 0 {
+			return nil
+		}
+		procTranslateMessage.Call(uintptr(unsafe.Pointer(&msg)))
+		procDispatchMessageW.Call(uintptr(unsafe.Pointer(&msg)))
+	}
+}
+
+// setTrayTip 设置托盘提示文字（最多127个字符）
+func setTrayTip(tip string) {
+	utf16, _ := syscall.UTF16FromString(tip)
+	if len(utf16) > len(trayIcon.tip) {
+		utf16 = append(utf16[:len(trayIcon.tip)-1], 0)
+	}
+	trayIcon.tip = [128]uint16{}
+	copy(trayIcon.tip[:], utf16)
+}
+
+// trayWndProc 处理托盘图标的鼠标事件：悬停时刷新提示，双击打开管理界面，右键弹出菜单
+func trayWndProc(wnd, msg, wParam, lParam uintptr) uintptr {
+	if msg != wmTrayNotify {
+		r, _, _ := procDefWindowProcW.Call(wnd, msg, wParam, lParam)
+		return r
+	}
+	switch lParam & 0xffff {
+	case wmMouseMove:
+		setTrayTip(trayTooltip())
+		procShellNotifyIconW.Call(nimModify, uintptr(unsafe.Pointer(&trayIcon)))
+	case wmLButtonDbl:
+		go trayOpenUI()
+	case wmRButtonUp:
+		showTrayMenu(wnd)
+	}
+	return 0
+}
+
+// showTrayMenu 在鼠标位置弹出托盘菜单并执行选中的操作
+func showTrayMenu(wnd uintptr) {
+	menu, _, _ := procCreatePopupMenu.Call()
+	if menu == 0 {
+		return
+	}
+	defer procDestroyMenu.Call(menu)
+
+	appendMenu := func(menu, flags, id uintptr, text string) {
+		ptr, _ := syscall.UTF16PtrFromString(text)
+		procAppendMenuW.Call(menu, flags, id, uintptr(unsafe.Pointer(ptr)))
+	}
+	appendMenu(menu, mfString, trayMenuOpen, "打开管理界面")
+	appendMenu(menu, mfSeparator, 0, "")
+	appendMenu(menu, mfString, trayMenuStartAll, "启动所有转发")
+	appendMenu(menu, mfString, trayMenuStopAll, "停止所有转发")
+
+	templates := ruleStore.Templates()
+	submenu, _, _ := procCreatePopupMenu.Call()
+	for i, t := range templates {
+		appendMenu(submenu, mfString, uintptr(trayMenuTemplate+i), t.Name)
+	}
+	if len(templates) == 0 {
+		appendMenu(submenu, mfString|mfGrayed, 0, "（没有模板）")
+	}
+	appendMenu(menu, mfPopup, submenu, "切换模板")
+	appendMenu(menu, mfSeparator, 0, "")
+	appendMenu(menu, mfString, trayMenuQuit, "退出")
+
+	var pt struct{ x, y int32 }
+	procGetCursorPos.Call(uintptr(unsafe.Pointer(&pt)))
+	// 先把窗口置于前台，否则点击菜单外部时菜单不会关闭
+	procSetForegroundWin.Call(wnd)
+	cmd, _, _ := procTrackPopupMenu.Call(menu, tpmReturnCmd|tpmNoNotify|tpmRightAlign, uintptr(pt.x), uintptr(pt.y), 0, wnd, 0)
+
+	switch {
+	case cmd == trayMenuOpen:
+		go trayOpenUI()
+	case cmd == trayMenuStartAll:
+		go trayStartAll()
+	case cmd == trayMenuStopAll:
+		go trayStopAll()
+	case cmd == trayMenuQuit:
+		go trayQuit()
+	case cmd >= trayMenuTemplate && int(cmd-trayMenuTemplate) < len(templates):
+		go traySwitchTemplate(templates[cmd-trayMenuTemplate].Name)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/byXewl/go-ports/forward"
+)
+
+// apiGetUDPRelay 获取规则的组播/广播中继配置
+func apiGetUDPRelay(w http.ResponseWriter, r *http.Request) {
+	getRuleOption(w, r, func(rule Rule) map[string]interface{} {
+		return map[string]interface{}{"udpRelay": rule.UDPRelay}
+	})
+}
+
+// updateUDPRelayRequest apiUpdateUDPRelay 的请求体
+type updateUDPRelayRequest struct {
+	RuleID   string            `json:"ruleId"`
+	UDPRelay *forward.UDPRelay `json:"udpRelay"`
+}
+
+// apiUpdateUDPRelay 设置规则的组播/广播中继配置，udpRelay 为 null 时恢复普通UDP转发
+// 正在运行的UDP转发会重启以应用新配置
+func apiUpdateUDPRelay(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "UDP relay", func(req *updateUDPRelayRequest, _ Rule) (func(rule *Rule), error) {
+		if req.UDPRelay != nil {
+			if err := req.UDPRelay.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.UDPRelay = req.UDPRelay }, nil
+	})
+	if ok {
+		restartUpdatedRule(w, r, rule)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+)
+
+const (
+	defaultUIPort  = 8080
+	uiPortAttempts = 100 // 自动选择端口时最多尝试的个数
+)
+
+// listenUI 按参数与配置文件监听管理界面端口。
+// 指定了端口时只尝试该端口，失败即返回错误，便于自动化脚本固定地址
+func listenUI() (net.Listener, error) {
+	settings := currentSettings()
+	listen, port := settings.UIListen, settings.UIPort
+	if *uiListen != "" {
+		listen = *uiListen
+	}
+	if *uiPort != 0 {
+		port = *uiPort
+	}
+	if port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+
+	if port != 0 {
+		return net.Listen("tcp", net.JoinHostPort(listen, strconv.Itoa(port)))
+	}
+
+	for port := defaultUIPort; port < defaultUIPort+uiPortAttempts; port++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort(listen, strconv.Itoa(port)))
+		if err == nil {
+			return listener, nil
+		}
+		// 端口被占用，尝试下一个端口
+		log.Printf("Failed to listen on port %d: %v", port, err)
+		fmt.Printf("Failed to listen on port %d: %v\n", port, err)
+	}
+	return nil, fmt.Errorf("no free port in %d-%d", defaultUIPort, defaultUIPort+uiPortAttempts-1)
+}
+
+// uiURL 返回可在本机浏览器打开的地址，监听所有地址时使用 localhost
+func uiURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
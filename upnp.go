@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ssdpAddr SSDP 组播地址
+const ssdpAddr = "239.255.255.250:1900"
+
+// igdDeviceTypes 搜索的互联网网关设备类型
+var igdDeviceTypes = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+}
+
+// igdClient 路由器上的 WANIPConnection/WANPPPConnection 服务
+type igdClient struct {
+	controlURL  string
+	serviceType string
+	localIP     string // 本机连接路由器使用的地址，作为映射的内部地址
+	http        *http.Client
+}
+
+// upnpDevice 设备描述中的设备，服务可能在任意层级的子设备中
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// findService 查找 WAN 连接服务，返回服务类型与控制地址
+func (d upnpDevice) findService() (string, string, bool) {
+	for _, s := range d.Services {
+		if strings.HasPrefix(s.ServiceType, "urn:schemas-upnp-org:service:WANIPConnection:") ||
+			strings.HasPrefix(s.ServiceType, "urn:schemas-upnp-org:service:WANPPPConnection:") {
+			return s.ServiceType, s.ControlURL, true
+		}
+	}
+	for _, child := range d.Devices {
+		if serviceType, controlURL, ok := child.findService(); ok {
+			return serviceType, controlURL, true
+		}
+	}
+	return "", "", false
+}
+
+// discoverIGD 通过 SSDP 搜索本地网络上的 UPnP 网关，返回第一个可用的
+func discoverIGD(timeout time.Duration) (*igdClient, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range igdDeviceTypes {
+		msg := "M-SEARCH * HTTP/1.1\r\nHOST: " + ssdpAddr + "\r\nST: " + st + "\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\n\r\n"
+		if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+			return nil, err
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	tried := make(map[string]bool)
+	lastErr := errors.New("no UPnP gateway found")
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, lastErr
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" || tried[location] {
+			continue
+		}
+		tried[location] = true
+		client, err := newIGDClient(location)
+		if err != nil {
+			lastErr = fmt.Errorf("UPnP gateway %s: %w", location, err)
+			continue
+		}
+		return client, nil
+	}
+}
+
+// newIGDClient 读取设备描述并找到 WAN 连接服务的控制地址
+func newIGDClient(location string) (*igdClient, error) {
+	hc := &http.Client{Timeout: 5 * time.Second}
+	resp, err := hc.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid device description: %w", err)
+	}
+	serviceType, controlURL, ok := root.Device.findService()
+	if !ok {
+		return nil, errors.New("no WANIPConnection service")
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if root.URLBase != "" {
+		if u, err := url.Parse(root.URLBase); err == nil {
+			base = u
+		}
+	}
+	control, err := base.Parse(controlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// 本机连接路由器使用的地址（UDP 连接不发送数据）
+	port := control.Port()
+	if port == "" {
+		port = "80"
+	}
+	probe, err := net.Dial("udp4", net.JoinHostPort(control.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	localIP := probe.LocalAddr().(*net.UDPAddr).IP.String()
+	probe.Close()
+
+	return &igdClient{controlURL: control.String(), serviceType: serviceType, localIP: localIP, http: hc}, nil
+}
+
+// soapArg SOAP 请求参数，按顺序发送
+type soapArg struct {
+	name, value string
+}
+
+// call 调用 SOAP 动作，返回响应中各元素的文本（按元素名索引）
+func (c *igdClient) call(action string, args ...soapArg) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, c.serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg.name)
+		xml.EscapeText(&body, []byte(arg.value))
+		fmt.Fprintf(&body, "</%s>", arg.name)
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequest(http.MethodPost, c.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+c.serviceType+"#"+action+`"`)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	values := make(map[string]string)
+	dec := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	var current string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+		case xml.CharData:
+			if current != "" {
+				values[current] += string(t)
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		if desc := values["errorDescription"]; desc != "" {
+			return nil, fmt.Errorf("UPnP %s: %s (%s)", action, desc, values["errorCode"])
+		}
+		return nil, fmt.Errorf("UPnP %s: %s", action, resp.Status)
+	}
+	return values, nil
+}
+
+// externalIP 查询路由器的公网地址
+func (c *igdClient) externalIP() (string, error) {
+	values, err := c.call("GetExternalIPAddress")
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(values["NewExternalIPAddress"])
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("router returned invalid external address %q", ip)
+	}
+	return ip, nil
+}
+
+// addPortMapping 把路由器的外部端口映射到本机端口。路由器只支持永久映射（错误 725）时改为永久映射
+func (c *igdClient) addPortMapping(protocol string, externalPort, internalPort int, description string, lease time.Duration) (time.Duration, error) {
+	add := func(lease time.Duration) error {
+		_, err := c.call("AddPortMapping",
+			soapArg{"NewRemoteHost", ""},
+			soapArg{"NewExternalPort", strconv.Itoa(externalPort)},
+			soapArg{"NewProtocol", strings.ToUpper(protocol)},
+			soapArg{"NewInternalPort", strconv.Itoa(internalPort)},
+			soapArg{"NewInternalClient", c.localIP},
+			soapArg{"NewEnabled", "1"},
+			soapArg{"NewPortMappingDescription", description},
+			soapArg{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+		)
+		return err
+	}
+	err := add(lease)
+	if err != nil && strings.Contains(err.Error(), "(725)") {
+		return 0, add(0)
+	}
+	return lease, err
+}
+
+// deletePortMapping 删除路由器上的端口映射
+func (c *igdClient) deletePortMapping(protocol string, externalPort int) error {
+	_, err := c.call("DeletePortMapping",
+		soapArg{"NewRemoteHost", ""},
+		soapArg{"NewExternalPort", strconv.Itoa(externalPort)},
+		soapArg{"NewProtocol", strings.ToUpper(protocol)},
+	)
+	return err
+}
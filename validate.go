@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/byXewl/go-ports/forward"
+	"github.com/byXewl/go-ports/store"
+)
+
+// FieldError 规则某个字段的校验错误，Field 为 JSON 字段名（如 listenPort），供界面标出对应输入框
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrorsResult 把字段错误合并为失败的 Result
+func fieldErrorsResult(errs []FieldError) Result {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Field+": "+e.Message)
+	}
+	return Result{Success: false, Error: strings.Join(msgs, "; "), Fields: errs}
+}
+
+// isValidHostname 判断是否为合法的主机名（RFC 1123）
+func isValidHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateHost 地址可以为空（尚未填写）、IP 地址或主机名
+func validateHost(host string) string {
+	if host == "" || net.ParseIP(host) != nil || isValidHostname(host) {
+		return ""
+	}
+	return fmt.Sprintf("%q is not a valid IP address or hostname", host)
+}
+
+// validatePort 端口可以为空（尚未填写）、单个端口或端口范围，需要在 1-65535 内
+func validatePort(port string) string {
+	if port == "" {
+		return ""
+	}
+	if _, _, err := forward.ParsePortRange(port); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// portsOverlap 判断两个端口或端口范围是否有重叠
+func portsOverlap(a, b string) bool {
+	aStart, aEnd, err := forward.ParsePortRange(a)
+	if err != nil {
+		return false
+	}
+	bStart, bEnd, err := forward.ParsePortRange(b)
+	if err != nil {
+		return false
+	}
+	return aStart <= bEnd && bStart <= aEnd
+}
+
+// isUnspecifiedHost 判断是否为监听所有网卡的地址
+func isUnspecifiedHost(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// listenAddrsOverlap 两个监听地址会绑定到同一个套接字：地址相同，或其中一个监听所有网卡
+func listenAddrsOverlap(a, b string) bool {
+	return a == b || isUnspecifiedHost(a) || isUnspecifiedHost(b)
+}
+
+// isLocalHost 判断目标地址是否指向本机：回环地址、localhost 或本机网卡地址
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetIsListen 判断目标是否就是规则自己的监听地址，转发会连回自己形成环路。
+// 组播组与受限广播地址不算：中继模式从另一个网卡发出，并丢弃自己发出的数据包
+func targetIsListen(rule Rule) bool {
+	if !portsOverlap(rule.ListenPort, rule.TargetPort) {
+		return false
+	}
+	if ip := net.ParseIP(rule.ListenAddr); ip != nil && (ip.IsMulticast() || ip.Equal(net.IPv4bcast)) {
+		return false
+	}
+	if rule.TargetAddr == rule.ListenAddr {
+		return true
+	}
+	if isUnspecifiedHost(rule.ListenAddr) {
+		return isLocalHost(rule.TargetAddr)
+	}
+	// 监听回环地址时 localhost 也指向自己
+	ip := net.ParseIP(rule.ListenAddr)
+	return ip != nil && ip.IsLoopback() && strings.EqualFold(rule.TargetAddr, "localhost")
+}
+
+// validateRuleFields 校验规则的地址与端口：语法、端口范围、与其他规则的监听地址与目标都重复、目标指向自己。
+// 监听地址相同而目标不同的规则可以共存（同时只能运行其中一条），按目标区分。
+// 未填写的字段不校验，新建的空白规则可以逐项填写
+func validateRuleFields(rule Rule) []FieldError {
+	var errs []FieldError
+	if msg := validateHost(rule.ListenAddr); msg != "" {
+		errs = append(errs, FieldError{Field: "listenAddr", Message: msg})
+	}
+	if msg := validatePort(rule.ListenPort); msg != "" {
+		errs = append(errs, FieldError{Field: "listenPort", Message: msg})
+	}
+	if msg := validateTargetHost(rule.TargetAddr); msg != "" {
+		errs = append(errs, FieldError{Field: "targetAddr", Message: msg})
+	}
+	if msg := validateTargetPort(rule.TargetPort); msg != "" {
+		errs = append(errs, FieldError{Field: "targetPort", Message: msg})
+	}
+	if len(errs) > 0 || rule.ListenAddr == "" || rule.ListenPort == "" {
+		return errs
+	}
+
+	for _, other := range ruleStore.Rules() {
+		if other.ID == rule.ID || other.ListenAddr == "" || other.ListenPort == "" {
+			continue
+		}
+		if other.TargetAddr != rule.TargetAddr || other.TargetPort != rule.TargetPort {
+			continue
+		}
+		if listenAddrsOverlap(rule.ListenAddr, other.ListenAddr) && portsOverlap(rule.ListenPort, other.ListenPort) {
+			errs = append(errs, FieldError{
+				Field:   "listenPort",
+				Message: fmt.Sprintf("%s is already used by rule #%d (%s) with the same target", net.JoinHostPort(rule.ListenAddr, rule.ListenPort), other.Seq, net.JoinHostPort(other.ListenAddr, other.ListenPort)),
+			})
+			break
+		}
+	}
+
+	if rule.TargetAddr != "" && rule.TargetPort != "" && targetIsListen(rule) {
+		errs = append(errs, FieldError{Field: "targetAddr", Message: "target points back at the rule's own listen address"})
+	}
+	return errs
+}
+
+// resolveRulePorts 把服务名解析为数字端口并检查端口范围能否一一对应，错误按字段返回。
+// 引用变量的目标端口在开启转发时才展开，这里不检查
+func resolveRulePorts(listenPort, targetPort *string) []FieldError {
+	var errs []FieldError
+	if err := resolvePorts(listenPort); err != nil {
+		errs = append(errs, FieldError{Field: "listenPort", Message: err.Error()})
+	}
+	if store.HasVars(*targetPort) {
+		return errs
+	}
+	if err := resolvePorts(targetPort); err != nil {
+		errs = append(errs, FieldError{Field: "targetPort", Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if err := forward.CheckPortRange(*listenPort, *targetPort); err != nil {
+		errs = append(errs, FieldError{Field: "targetPort", Message: err.Error()})
+	}
+	return errs
+}
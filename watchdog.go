@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byXewl/go-ports/store"
+)
+
+// WatchdogStatus 看门狗运行状态
+type WatchdogStatus struct {
+	LastCheck   time.Time `json:"lastCheck,omitempty"`
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastAction  string    `json:"lastAction,omitempty"`
+	LastActedAt time.Time `json:"lastActedAt,omitempty"`
+}
+
+// watchdogState 所有规则的看门狗状态
+var watchdogState = struct {
+	sync.Mutex
+	status map[string]*WatchdogStatus
+	next   map[string]time.Time
+	fired  map[string]bool // 本轮连续失败是否已执行过动作
+}{
+	status: make(map[string]*WatchdogStatus),
+	next:   make(map[string]time.Time),
+	fired:  make(map[string]bool),
+}
+
+// startWatchdog 启动看门狗循环
+func startWatchdog() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runWatchdogChecks(now)
+		}
+	}()
+}
+
+// runWatchdogChecks 检查到期的规则
+func runWatchdogChecks(now time.Time) {
+	snapshot := ruleStore.Rules()
+
+	for _, rule := range snapshot {
+		if rule.Watchdog == nil || !rule.Watchdog.Enabled || len(runningProtocols(rule)) == 0 {
+			continue
+		}
+		cfg := rule.Watchdog.WithDefaults()
+
+		watchdogState.Lock()
+		due := !now.Before(watchdogState.next[rule.ID])
+		if due {
+			watchdogState.next[rule.ID] = now.Add(time.Duration(cfg.IntervalSeconds) * time.Second)
+		}
+		watchdogState.Unlock()
+
+		if due {
+			go checkTarget(rule, cfg)
+		}
+	}
+}
+
+// checkTarget 探测目标并在连续失败时执行恢复动作
+func checkTarget(rule Rule, cfg WatchdogConfig) {
+	resolved := resolvedRule(rule)
+	target := net.JoinHostPort(resolved.TargetAddr, resolved.TargetPort)
+	conn, err := net.DialTimeout("tcp", target, 3*time.Second)
+	if err == nil {
+		conn.Close()
+	}
+
+	watchdogState.Lock()
+	status, ok := watchdogState.status[rule.ID]
+	if !ok {
+		status = &WatchdogStatus{}
+		watchdogState.status[rule.ID] = status
+	}
+	status.LastCheck = time.Now()
+	if err == nil {
+		status.Healthy = true
+		status.Failures = 0
+		status.LastError = ""
+		watchdogState.fired[rule.ID] = false
+		watchdogState.Unlock()
+		return
+	}
+	status.Healthy = false
+	status.Failures++
+	status.LastError = err.Error()
+	act := status.Failures >= cfg.FailureThreshold && !watchdogState.fired[rule.ID]
+	if act {
+		watchdogState.fired[rule.ID] = true
+		status.LastAction = cfg.Action
+		status.LastActedAt = time.Now()
+	}
+	failures := status.Failures
+	watchdogState.Unlock()
+
+	if !act {
+		return
+	}
+
+	lg := newLogger("watchdog").WithRule(rule.ID)
+	lg.Warnf("Watchdog: target %s of rule %s failed %d times, running action %s", target, rule.ID, failures, cfg.Action)
+	if err := runWatchdogAction(rule, cfg); err != nil {
+		lg.Errorf("Watchdog action %s for rule %s failed: %v", cfg.Action, rule.ID, err)
+	}
+	notify(Notification{
+		Event:   "watchdog.action",
+		RuleID:  rule.ID,
+		Title:   fmt.Sprintf("Watchdog %s on %s", cfg.Action, ruleDisplayName(rule)),
+		Message: fmt.Sprintf("target %s unreachable %d times: %v", target, failures, err),
+	})
+}
+
+// runWatchdogAction 执行恢复动作
+func runWatchdogAction(rule Rule, cfg WatchdogConfig) error {
+	switch cfg.Action {
+	case store.WatchdogActionWOL:
+		return sendWakeOnLAN(cfg.WOLMac)
+	case store.WatchdogActionBackup:
+		return switchToBackup(rule)
+	case store.WatchdogActionStop:
+		for _, protocol := range runningProtocols(rule) {
+			stopRuleForward(rule, protocol, sourceWatchdog)
+		}
+		return nil
+	case store.WatchdogActionHook:
+		return runHook(rule, cfg.HookCommand)
+	}
+	return fmt.Errorf("unknown watchdog action %q", cfg.Action)
+}
+
+// sendWakeOnLAN 广播网络唤醒魔术包
+func sendWakeOnLAN(mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+
+	packet := make([]byte, 0, 102)
+	for i := 0; i < 6; i++ {
+		packet = append(packet, 0xFF)
+	}
+	for i := 0; i < 16; i++ {
+		packet = append(packet, hw...)
+	}
+
+	conn, err := net.Dial("udp", "255.255.255.255:9")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
+
+// switchToBackup 互换主备目标并用新目标重启正在运行的转发
+func switchToBackup(rule Rule) error {
+	switched := false
+	updated, err := ruleStore.UpdateRule(rule.ID, func(r *Rule) {
+		if r.Watchdog == nil {
+			return
+		}
+		// 复制一份再修改，不影响之前取得的规则副本
+		wd := *r.Watchdog
+		r.TargetAddr, wd.BackupAddr = wd.BackupAddr, r.TargetAddr
+		r.TargetPort, wd.BackupPort = wd.BackupPort, r.TargetPort
+		r.Watchdog = &wd
+		switched = true
+	})
+	if errors.Is(err, store.ErrRuleNotFound) || (err == nil && !switched) {
+		return fmt.Errorf("rule %s not found", rule.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("save rules: %w", err)
+	}
+	recordConfigEvent(rule.ID, sourceWatchdog, "Switched to backup target "+net.JoinHostPort(updated.TargetAddr, updated.TargetPort))
+
+	return restartRuleForwards(rule, updated, sourceWatchdog)
+}
+
+// runHook 执行钩子命令，规则信息通过环境变量传入
+func runHook(rule Rule, command string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	resolved := resolvedRule(rule)
+	cmd.Env = append(os.Environ(),
+		"GOPORTS_RULE_ID="+rule.ID,
+		"GOPORTS_LISTEN="+net.JoinHostPort(rule.ListenAddr, rule.ListenPort),
+		"GOPORTS_TARGET="+net.JoinHostPort(resolved.TargetAddr, resolved.TargetPort),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		log.Printf("Watchdog hook output: %s", strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+// apiGetWatchdog 获取规则的看门狗配置和状态
+func apiGetWatchdog(w http.ResponseWriter, r *http.Request) {
+	getRuleOption(w, r, func(rule Rule) map[string]interface{} {
+		watchdogState.Lock()
+		status := WatchdogStatus{}
+		if s, ok := watchdogState.status[rule.ID]; ok {
+			status = *s
+		}
+		watchdogState.Unlock()
+		return map[string]interface{}{"watchdog": rule.Watchdog, "status": status}
+	})
+}
+
+// updateWatchdogRequest apiUpdateWatchdog 的请求体
+type updateWatchdogRequest struct {
+	RuleID   string          `json:"ruleId"`
+	Watchdog *WatchdogConfig `json:"watchdog"`
+}
+
+// apiUpdateWatchdog 设置规则的看门狗配置，watchdog 为 null 时移除
+func apiUpdateWatchdog(w http.ResponseWriter, r *http.Request) {
+	rule, ok := updateRuleOption(w, r, "watchdog", func(req *updateWatchdogRequest, _ Rule) (func(rule *Rule), error) {
+		if req.Watchdog != nil {
+			if err := req.Watchdog.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return func(rule *Rule) { rule.Watchdog = req.Watchdog }, nil
+	})
+	if !ok {
+		return
+	}
+
+	watchdogState.Lock()
+	delete(watchdogState.status, rule.ID)
+	delete(watchdogState.next, rule.ID)
+	delete(watchdogState.fired, rule.ID)
+	watchdogState.Unlock()
+
+	json.NewEncoder(w).Encode(Result{Success: true})
+}
@@ -0,0 +1,4323 @@
+// 初始化数据
+let rules = [];
+let templates = [];
+let defaultTemplate = ''; // 程序启动时自动开启的模板
+let portMappings = {}; // 规则ID -> 路由器端口映射列表
+
+// 界面发出的 API 请求附带来源标记，规则的事件历史据此区分界面操作与 API 调用
+(function() {
+    const originalFetch = window.fetch;
+    window.fetch = function(url, options) {
+        options = options || {};
+        if (typeof url === 'string' && (url.startsWith('api/') || url.startsWith('/api/'))) {
+            const headers = new Headers(options.headers || {});
+            headers.set('X-Go-Ports-Client', 'ui');
+            options.headers = headers;
+        }
+        return originalFetch(url, options);
+    };
+})();
+
+// 页面加载完成后初始化
+// window.onload = function() {
+//     initApp();
+// };
+
+// 初始化应用
+function initApp() {
+    // 获取本地网卡IP地址
+    getLocalIPs();
+    
+    // 加载规则
+    loadRules();
+    
+    // 加载模板
+    loadTemplates();
+
+    // 加载规则预设
+    loadPresets();
+
+    // 提示启动时未能恢复的转发
+    loadRestoreReport();
+
+    // 定时刷新流量曲线与端口映射
+    setInterval(renderSparklines, 5000);
+    setInterval(renderPortMappings, 5000);
+}
+
+// 绘制每条规则最近的流量曲线（上行绿色、下行蓝色）
+function renderSparklines() {
+    fetch('api/getStatsHistory')
+        .then(response => response.json())
+        .then(history => {
+            document.querySelectorAll('svg.sparkline').forEach(function(svg) {
+                const points = history[svg.dataset.id] || [];
+                if (points.length < 2) {
+                    svg.innerHTML = '';
+                    svg.removeAttribute('title');
+                    return;
+                }
+                const width = svg.width.baseVal.value;
+                const height = svg.height.baseVal.value;
+                const peak = Math.max(1, ...points.map(p => Math.max(p.inRate, p.outRate)));
+                const line = function(key, color) {
+                    const coords = points.map(function(p, i) {
+                        const x = i * width / (points.length - 1);
+                        const y = height - 1 - p[key] / peak * (height - 2);
+                        return x.toFixed(1) + ',' + y.toFixed(1);
+                    });
+                    return '<polyline fill="none" stroke="' + color + '" stroke-width="1" points="' + coords.join(' ') + '"/>';
+                };
+                const last = points[points.length - 1];
+                svg.innerHTML = '<title>上行 ' + formatBytes(Math.round(last.inRate)) + '/s，下行 ' + formatBytes(Math.round(last.outRate)) +
+                    '/s，连接 ' + last.activeConns + '（峰值 ' + formatBytes(Math.round(peak)) + '/s）</title>' +
+                    line('inRate', '#28a745') + line('outRate', '#007bff');
+            });
+        })
+        .catch(error => {
+            console.error('Failed to load stats history:', error);
+        });
+}
+
+// 显示规则在路由器上映射的公网地址
+function renderPortMappings() {
+    fetch('api/getPortMappings')
+        .then(response => response.json())
+        .then(list => {
+            portMappings = {};
+            list.forEach(m => (portMappings[m.ruleId] = portMappings[m.ruleId] || []).push(m));
+            document.querySelectorAll('.port-mapping').forEach(function(span) {
+                const mappings = portMappings[span.dataset.id] || [];
+                span.innerHTML = mappings.map(m => m.error
+                    ? '<span style="color:#e74c3c" title="' + escapeHTML(m.error) + '">' + m.protocol.toUpperCase() + ' 映射失败</span>'
+                    : m.protocol.toUpperCase() + ' 公网 ' + escapeHTML(hostPort(m.externalIp || '?', m.externalPort))).join(' ');
+            });
+        })
+        .catch(error => {
+            console.error('Failed to load port mappings:', error);
+        });
+}
+
+// 按规则的二维码配置把地址拼成完整的 URL，与 /api/getQRCode 的内容一致
+function qrContent(listenAddr, listenPort, addr) {
+    const rule = rules.find(r => r.listenAddr === listenAddr && r.listenPort === listenPort);
+    const qr = (rule && rule.qrCode) || {};
+    return (qr.scheme ? qr.scheme.toLowerCase() + '://' : '') + addr + (qr.path || '');
+}
+
+// 编辑规则二维码的 scheme 与路径，如 http:// 加 /index.html，两项都留空时二维码只包含 ip:port
+function editQRCode(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.qrCode || {};
+    const scheme = prompt('二维码的 URL scheme（如 http、https、rtsp 或自定义，留空则不加前缀）：', current.scheme || '');
+    if (scheme === null) {
+        return;
+    }
+    const path = prompt('附加在地址后的路径与查询（以 / 或 ? 开头，如 /live?channel=1，可留空）：', current.path || '');
+    if (path === null) {
+        return;
+    }
+
+    fetch('api/updateQRCode', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, qr: { scheme: scheme.trim(), path: path.trim() } })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('二维码内容已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新二维码内容失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 提示启动时未能恢复的转发，显示一次后清除
+function loadRestoreReport() {
+    fetch('api/getRestoreReport')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.failures || data.failures.length === 0) {
+                return;
+            }
+            const lines = data.failures.map(f => {
+                let line = f.name + ' (' + f.protocol + '): ' + f.error;
+                if (f.suggestedPort) {
+                    line += '，可改用端口 ' + f.suggestedPort;
+                }
+                return line;
+            });
+            showMessage('以下转发未能恢复: ' + lines.join('; '), 'error');
+            fetch('api/dismissRestoreReport', { method: 'POST' });
+        })
+        .catch(error => {
+            console.error('Failed to load restore report:', error);
+        });
+}
+
+// 加载规则预设
+function loadPresets() {
+    fetch('api/getPresets')
+        .then(response => response.json())
+        .then(presets => {
+            const presetSelect = document.getElementById('presetSelect');
+            presets.forEach(preset => {
+                const option = document.createElement('option');
+                option.value = preset.key;
+                option.textContent = preset.name + ' (' + preset.port + '/' + preset.protocol + ')';
+                presetSelect.appendChild(option);
+            });
+        })
+        .catch(error => {
+            console.error('Failed to load presets:', error);
+        });
+}
+
+// 从预设新增规则
+function addRuleFromPreset(select) {
+    const key = select.value;
+    if (!key) {
+        return;
+    }
+    select.value = '';
+    fetch('api/addRule', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ preset: key })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            loadRules();
+            showMessage('已从预设添加规则 (' + data.protocol + ')', 'success');
+        } else {
+            showMessage('添加规则失败: ' + data.error, 'error');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to add rule from preset:', error);
+    });
+}
+
+// 获取本地网卡IP地址
+function getLocalIPs() {
+    fetch('api/getLocalIPs')
+        .then(response => response.json())
+        .then(ips => {
+            console.log('Local IPs:', ips);
+            // 存储IP地址供后续使用
+            window.localIPs = ips;
+        })
+        .catch(error => {
+            console.error('Failed to get local IPs:', error);
+        });
+}
+
+// 加载规则
+function loadRules() {
+    fetch('api/getRules')
+        .then(response => response.json())
+.then(data => {
+            // 倒序显示规则列表
+            rules = data.slice().reverse();
+            renderRules();
+            renderLogRuleOptions();
+        })
+        .catch(error => {
+            console.error('Failed to load rules:', error);
+        });
+}
+
+// 加载模板
+function loadTemplates() {
+    fetch('api/getTemplates')
+        .then(response => response.json())
+        .then(data => {
+            templates = data;
+            return fetch('api/getDefaultTemplate').then(response => response.json());
+        })
+        .then(data => {
+            defaultTemplate = data.name || '';
+            renderTemplates();
+        })
+        .catch(error => {
+            console.error('Failed to load templates:', error);
+        });
+}
+
+// 设置或取消程序启动时自动开启的模板
+function setDefaultTemplate(templateName) {
+    fetch('api/setDefaultTemplate', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ name: templateName })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            loadTemplates();
+            showMessage(templateName ? '已设为启动时自动开启的模板' : '已取消自动开启', 'success');
+        } else {
+            showMessage('设置失败: ' + data.error, 'error');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to set default template:', error);
+        showMessage('设置失败', 'error');
+    });
+}
+
+       // 渲染规则列表（倒序）
+function renderRules(){
+    const list = document.getElementById('rulesList');
+    list.innerHTML = '';
+
+    if(rules.length === 0){
+list.innerHTML = '<p style="text-align:center;color:#999;padding:20px">暂无规则，请点击“新增规则”按钮添加</p>';
+return;
+    }
+
+    /* 倒序遍历，同步插壳保证顺序 */
+    for(let i = rules.length - 1; i >= 0; i--){
+const r = rules[i];
+
+const item = document.createElement('div');
+item.className = 'rule-item';
+item.dataset.id = r.id;
+
+/* 用字符串拼接代替 ${}，避开 Go 模板冲突 */
+item.innerHTML =
+    '<input type="checkbox" class="rule-checkbox" data-id="'+ r.id +'">'+
+    '<div style="display:flex;align-items:center">'+
+      '<div class="rule-seq">'+ r.seq +'</div>'+
+      '<div class="rule-config">'+
+        '<select class="listen-addr" data-id="'+ r.id +'">'+ renderIPOptions(r.listenAddr) +'</select>'+
+        '<input type="text" class="listen-port" data-id="'+ r.id +'" value="'+ r.listenPort +'" placeholder="端口、服务名或范围">'+
+        '<select class="target-addr" data-id="'+ r.id +'">'+ renderTargetIPOptions(r.targetAddr) +'</select>'+
+        '<input type="text" class="target-port" data-id="'+ r.id +'" value="'+ r.targetPort +'" placeholder="端口、服务名或范围">'+
+        renderRecentTargets(r)+
+        '<select class="rule-priority" data-id="'+ r.id +'" title="全局限速时的带宽优先级（重启转发后生效）">'+
+          '<option value="high"'+ (r.priority === 'high' ? ' selected' : '') +'>高优先级</option>'+
+          '<option value=""'+ (!r.priority || r.priority === 'normal' ? ' selected' : '') +'>普通</option>'+
+          '<option value="low"'+ (r.priority === 'low' ? ' selected' : '') +'>低优先级</option>'+
+        '</select>'+
+        '<label title="记录TLS客户端JA3指纹到日志（仅TCP，重启转发后生效）"><input type="checkbox" class="log-ja3" data-id="'+ r.id +'"'+ (r.logJA3 ? ' checked' : '') +'>JA3</label>'+
+        '<label title="程序启动时自动开启TCP/UDP转发"><input type="checkbox" class="auto-start" data-id="'+ r.id +'"'+ (r.autoStart ? ' checked' : '') +'>自启</label>'+
+        '<input type="text" class="rule-name" data-id="'+ r.id +'" value="'+ escapeHTML(r.name || '') +'" placeholder="名称，如 Dev MySQL" maxlength="64">'+
+        '<input type="text" class="rule-note" data-id="'+ r.id +'" value="'+ escapeHTML(r.note || '') +'" placeholder="备注" maxlength="500" title="'+ escapeHTML(r.note || '') +'">'+
+        '<svg class="sparkline" data-id="'+ r.id +'" width="120" height="28"></svg>'+
+        '<span class="port-mapping" data-id="'+ r.id +'"></span>'+
+      '</div>'+
+    '</div>'+
+    '<div class="rule-actions">'+
+      '<button class="btn btn-default" data-role="tcpBtn">检测中…</button>'+
+      '<button class="btn btn-default" data-role="udpBtn">检测中…</button>'+
+      '<button class="btn btn-default" data-role="sctpBtn">检测中…</button>'+
+      '<button class="btn btn-default" data-role="socksBtn" title="在监听地址上运行SOCKS5代理，目标由客户端指定">检测中…</button>'+
+      '<button class="btn btn-default" title="'+ (r.pinned ? '取消置顶' : '置顶') +'" onclick="togglePin(\''+ r.id +'\','+ !r.pinned +')">'+ (r.pinned ? '★' : '☆') +'</button>'+
+      '<button class="btn btn-default" title="'+ aclTitle(r) +'" onclick="editACL(\''+ r.id +'\')">访问控制'+ ((r.allowCidrs || r.denyCidrs) ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ targetsTitle(r) +'" onclick="editTargets(\''+ r.id +'\')">负载均衡'+ (r.targets ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ (r.routes ? '路由: ' + routesText(r.routes) : '按 TLS SNI、HTTP Host 或开头的字节把连接转发到不同目标') +'" onclick="editRoutes(\''+ r.id +'\')">路由'+ (r.routes ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="经 SSH 跳板机连接目标，转发的连接复用同一个 SSH 连接" onclick="editSSHHost(\''+ r.id +'\')">SSH跳板'+ (r.sshHost ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="依次经过其他 go-ports 实例（中继节点）连接目标" onclick="editRuleVia(\''+ r.id +'\')">中继'+ (r.via ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="检查目标是否可用，不可用时切换到其他目标或备用目标" onclick="editHealth(\''+ r.id +'\')">健康检查'+ (r.health && r.health.enabled ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="连接目标失败时重试，后端重启期间保持客户端连接" onclick="editDialRetry(\''+ r.id +'\')">重试'+ (r.retry ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ tcpTuningTitle(r) +'" onclick="editTCPTuning(\''+ r.id +'\')">TCP选项'+ (r.tcpTuning ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ (r.bind ? '出接口: ' + [r.bind.interface, r.bind.sourceIp].filter(Boolean).join(' ') : '指定连接目标的出接口或源地址，如经 WireGuard 网卡连接后端') +'" onclick="editOutboundBind(\''+ r.id +'\')">出接口'+ (r.bind ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="把转发的数据写入 pcap 抓包文件，用于调试协议问题" onclick="toggleCapture(\''+ r.id +'\')">'+ (r.capture && r.capture.enabled ? '停止抓包' : '抓包') +'</button>'+
+      (r.capture ? '<button class="btn btn-default" title="下载抓包文件，可用 Wireshark 打开" onclick="downloadCapture(\''+ r.id +'\')">下载抓包</button>' : '')+
+      '<button class="btn btn-default" title="目标看到客户端的真实IP（需要Linux、root权限与策略路由）" onclick="toggleTransparent(\''+ r.id +'\')">'+ (r.transparent ? '关闭透明代理' : '透明代理') +'</button>'+
+      '<button class="btn btn-default" title="转发运行时通过 UPnP/NAT-PMP 在路由器上映射同一端口" onclick="togglePortMapping(\''+ r.id +'\')">'+ (r.portMapping ? '关闭端口映射' : '端口映射') +'</button>'+
+      '<button class="btn btn-default" title="'+ connLimitsTitle(r) +'" onclick="editConnLimits(\''+ r.id +'\')">超时'+ (r.idleTimeout || r.maxLifetime || r.udpTimeout ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ (r.schedule && r.schedule.enabled ? '定时: ' + scheduleText(r.schedule) : '按时间窗口自动开启/停止转发') +'" onclick="editSchedule(\''+ r.id +'\')">定时'+ (r.schedule && r.schedule.enabled ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ (r.autoStopMinutes ? r.autoStopMinutes + ' 分钟无流量后自动停止' : '无流量一段时间后自动停止，适合临时演示') +'" onclick="editAutoStop(\''+ r.id +'\')">自动停止'+ (r.autoStopMinutes ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="'+ (r.maxConns ? '最多 ' + r.maxConns + ' 个同时连接' : '限制同时连接数，保护小型后端') +'" onclick="editMaxConns(\''+ r.id +'\')">连接上限'+ (r.maxConns ? '*' : '') +'</button>'+
+      '<button class="btn btn-danger"  onclick="deleteRule(\''+ r.id +'\')">删除</button>'+
+      '<button class="btn btn-primary" onclick="copyRule('+ i +')">复制</button>'+
+      '<button class="btn btn-default" title="ip:port、各 scheme 的访问 URL 与二维码内容，可直接选中复制" onclick="showShareInfo(\''+ r.id +'\')">分享'+ (r.shareSchemes ? '*' : '') +'</button>'+
+      '<button class="btn btn-default" title="在服务端创建这条规则的副本，可平移端口" onclick="duplicateRule(\''+ r.id +'\')">创建副本</button>'+
+      '<button class="btn btn-warning" onclick="showQRCode(\''+ r.listenAddr +'\',\''+ r.listenPort +'\')">二维码</button>'+
+      '<button class="btn btn-default" title="'+ (r.qrCode ? '二维码内容: ' + escapeHTML(qrContent(r.listenAddr, r.listenPort, 'ip:port')) : '把二维码内容设为完整的 URL，如 http://ip:port/') +'" onclick="editQRCode(\''+ r.id +'\')">二维码设置'+ (r.qrCode ? '*' : '') +'</button>'+
+    '</div>';
+
+list.appendChild(item);          // 顺序固定
+addRuleEventListeners(item, r.id); // 你原来的绑定函数
+
+/* 异步只改按钮 */
+Promise.all([
+    fetch('api/isTCPRunning?listenAddr=' + encodeURIComponent(r.listenAddr) + '&listenPort=' + encodeURIComponent(r.listenPort) + '&targetAddr=' + encodeURIComponent(r.targetAddr) + '&targetPort=' + encodeURIComponent(r.targetPort)).then(res=>res.json()),
+    fetch('api/isUDPRunning?listenAddr=' + encodeURIComponent(r.listenAddr) + '&listenPort=' + encodeURIComponent(r.listenPort) + '&targetAddr=' + encodeURIComponent(r.targetAddr) + '&targetPort=' + encodeURIComponent(r.targetPort)).then(res=>res.json()),
+    fetch('api/isSCTPRunning?listenAddr=' + encodeURIComponent(r.listenAddr) + '&listenPort=' + encodeURIComponent(r.listenPort) + '&targetAddr=' + encodeURIComponent(r.targetAddr) + '&targetPort=' + encodeURIComponent(r.targetPort)).then(res=>res.json()),
+    fetch('api/isSOCKS5Running?listenAddr=' + encodeURIComponent(r.listenAddr) + '&listenPort=' + encodeURIComponent(r.listenPort)).then(res=>res.json())
+]).then(function(res){
+    const tcpBtn = item.querySelector('[data-role=tcpBtn]');
+    const udpBtn = item.querySelector('[data-role=udpBtn]');
+    const sctpBtn = item.querySelector('[data-role=sctpBtn]');
+    const socksBtn = item.querySelector('[data-role=socksBtn]');
+
+    socksBtn.className   = res[3].running ? 'btn btn-danger' : 'btn btn-success';
+    socksBtn.textContent = res[3].running ? '停止SOCKS5代理' : '开启SOCKS5代理';
+    socksBtn.onclick     = function(){ toggleSOCKS5Forward(i); };
+
+    tcpBtn.className   = res[0].running ? 'btn btn-danger' : 'btn btn-success';
+    tcpBtn.textContent = res[0].running ? '停止TCP转发' : '开启TCP转发';
+    tcpBtn.onclick     = function(){ toggleTCPForward(i); };
+    if (!res[0].running && res[0].drain) {
+        tcpBtn.textContent = '开启TCP转发（排空中 ' + res[0].drain.remaining + '）';
+    }
+    markRecovering(tcpBtn, res[0]);
+    markRecovering(socksBtn, res[3]);
+
+    udpBtn.className   = res[1].running ? 'btn btn-danger' : 'btn btn-success';
+    udpBtn.textContent = res[1].running ? '停止UDP转发' : '开启UDP转发';
+    udpBtn.onclick     = function(){ toggleUDPForward(i); };
+    markRecovering(udpBtn, res[1]);
+
+    /* 不支持SCTP的平台隐藏按钮 */
+    if (!res[2].supported) {
+        sctpBtn.style.display = 'none';
+        return;
+    }
+    sctpBtn.className   = res[2].running ? 'btn btn-danger' : 'btn btn-success';
+    sctpBtn.textContent = res[2].running ? '停止SCTP转发' : '开启SCTP转发';
+    sctpBtn.onclick     = function(){ toggleSCTPForward(i); };
+    markRecovering(sctpBtn, res[2]);
+});
+    }
+
+    /* 标记被其他进程占用的端口 */
+    flagOccupiedPorts();
+
+    /* 流量曲线 */
+    renderSparklines();
+
+    /* 端口映射 */
+    renderPortMappings();
+}
+// 监听意外退出、正在重新监听的转发在按钮上显示重试状态
+function markRecovering(btn, status) {
+    if (!status.running || !status.recovering) {
+        return;
+    }
+    const rec = status.recovering;
+    btn.textContent += '（重新监听中，已失败 ' + rec.attempts + ' 次）';
+    btn.title = rec.lastError + '\n下次重试：' + new Date(rec.nextRetry).toLocaleTimeString();
+}
+// 标记已被其他进程占用的监听端口
+function flagOccupiedPorts() {
+    fetch('api/getSystemPorts')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                return;
+            }
+            document.querySelectorAll('.rule-item').forEach(function(item) {
+                const addrSelect = item.querySelector('.listen-addr');
+                const portInput = item.querySelector('.listen-port');
+                if (!addrSelect || !portInput || !portInput.value) {
+                    return;
+                }
+                const owner = data.ports.find(function(p) {
+                    return String(p.port) === portInput.value &&
+                        (p.addr === addrSelect.value || p.addr === '0.0.0.0' || p.addr === '::');
+                });
+                if (owner) {
+                    portInput.style.borderColor = '#e74c3c';
+                    portInput.title = '端口已被占用: ' + owner.protocol.toUpperCase() + ' ' + (owner.process || '未知进程') + (owner.pid ? ' (PID ' + owner.pid + ')' : '');
+                } else {
+                    portInput.style.borderColor = '';
+                    portInput.title = '';
+                }
+            });
+        })
+        .catch(error => {
+            console.error('Failed to get system ports:', error);
+        });
+}
+
+// 渲染IP选项
+function renderIPOptions(selectedAddr) {
+    let options = '<option value="">选择监听地址</option>';
+    if (window.localIPs) {
+        window.localIPs.forEach(function(ipInfo) {
+            const selected = ipInfo.ip === selectedAddr ? 'selected' : '';
+            options += '<option value="' + ipInfo.ip + '" ' + selected + '>' + ipInfo.ip + ' (' + ipInfo.name + ')</option>';
+        });
+    } else {
+        options += '<option value="">正在加载网卡信息...</option>';
+        // 尝试获取本地网卡IP地址
+        if (!window.isGettingIPs) {
+            window.isGettingIPs = true;
+            fetch('api/getLocalIPs')
+                .then(response => response.json())
+                .then(ips => {
+                    console.log('Local IPs:', ips);
+                    // 存储IP地址供后续使用
+                    window.localIPs = ips;
+                    // 重新渲染规则
+                    loadRules();
+                })
+                .catch(error => {
+                    console.error('Failed to get local IPs:', error);
+                })
+                .finally(() => {
+                    window.isGettingIPs = false;
+                });
+        }
+    }
+    // 局域网扫描发现的设备
+    if (window.lanHosts) {
+        window.lanHosts.forEach(function(host) {
+            const selected = host.ip === selectedAddr ? 'selected' : '';
+            const label = host.hostname || host.vendor || host.mac || '局域网设备';
+            options += '<option value="' + host.ip + '" ' + selected + '>' + host.ip + ' (' + label + ')</option>';
+        });
+    }
+    // 检查是否是自定义IP
+    const isCustom = selectedAddr && (!window.localIPs || !window.localIPs.some(function(ipInfo) { return ipInfo.ip === selectedAddr; })) &&
+        (!window.lanHosts || !window.lanHosts.some(function(host) { return host.ip === selectedAddr; }));
+    if (isCustom) {
+        options += '<option value="' + selectedAddr + '" selected>' + selectedAddr + '</option>';
+    }
+    return options;
+}
+
+// 添加规则事件监听器
+function addRuleEventListeners(ruleItem, ruleId) {
+    // 监听地址变化
+    const listenAddrSelect = ruleItem.querySelector('.listen-addr[data-id="' + ruleId + '"]');
+    if (listenAddrSelect) {
+        listenAddrSelect.addEventListener('change', function() {
+            updateRule(ruleId);
+        });
+    }
+
+    // 优先级变化
+    const prioritySelect = ruleItem.querySelector('.rule-priority[data-id="' + ruleId + '"]');
+    if (prioritySelect) {
+        prioritySelect.addEventListener('change', function() {
+            updateRule(ruleId);
+        });
+    }
+
+    // JA3 记录开关
+    const ja3Checkbox = ruleItem.querySelector('.log-ja3[data-id="' + ruleId + '"]');
+    if (ja3Checkbox) {
+        ja3Checkbox.addEventListener('change', function() {
+            updateRule(ruleId);
+        });
+    }
+
+    // 名称与备注变化
+    ['.rule-name', '.rule-note'].forEach(function(selector) {
+        const input = ruleItem.querySelector(selector + '[data-id="' + ruleId + '"]');
+        if (input) {
+            input.addEventListener('change', function() {
+                updateRule(ruleId);
+            });
+        }
+    });
+
+    // 自动开启开关
+    const autoStartCheckbox = ruleItem.querySelector('.auto-start[data-id="' + ruleId + '"]');
+    if (autoStartCheckbox) {
+        autoStartCheckbox.addEventListener('change', function() {
+            updateRule(ruleId);
+        });
+    }
+
+    // 监听端口变化
+    const listenPortInput = ruleItem.querySelector('.listen-port[data-id="' + ruleId + '"]');
+    if (listenPortInput) {
+        listenPortInput.addEventListener('change', function() {
+            updateRule(ruleId);
+        });
+    }
+
+    // 目标地址变化
+    const targetAddrSelect = ruleItem.querySelector('.target-addr[data-id="' + ruleId + '"]');
+    if (targetAddrSelect) {
+        targetAddrSelect.addEventListener('change', function() {
+            if (this.value === 'custom') {
+                // 创建自定义输入框
+                const customInput = document.createElement('input');
+                customInput.type = 'text';
+                customInput.className = 'target-addr-custom';
+                customInput.placeholder = '请输入自定义IP地址';
+                customInput.style.padding = '6px 10px';
+                customInput.style.border = '1px solid #ddd';
+                customInput.style.borderRadius = '4px';
+                customInput.style.fontSize = '14px';
+
+                // 替换选择框为输入框
+                const parent = this.parentElement;
+                parent.replaceChild(customInput, this);
+
+                // 聚焦到输入框
+                customInput.focus();
+
+                // 监听输入框变化
+                customInput.addEventListener('change', function() {
+                    if (this.value) {
+                        // 更新规则
+                        const ruleItem = this.closest('.rule-item');
+                        const listenAddr = ruleItem.querySelector('.listen-addr').value;
+                        const listenPort = ruleItem.querySelector('.listen-port').value;
+                        const targetPort = ruleItem.querySelector('.target-port').value;
+
+                        fetch('api/updateRule', {
+                            method: 'POST',
+                            headers: {
+                                'Content-Type': 'application/json'
+                            },
+                            body: JSON.stringify({
+                                id: ruleId,
+                                listenAddr: listenAddr,
+                                listenPort: listenPort,
+                                targetAddr: this.value,
+                                targetPort: targetPort
+                            })
+                        })
+                        .then(response => response.json())
+                        .then(data => {
+                            if (data.success) {
+                                loadRules();
+                            }
+                        });
+                    } else {
+                        // 如果输入框为空，恢复选择框
+                        parent.replaceChild(targetAddrSelect, this);
+                    }
+                });
+            } else {
+                updateRule(ruleId);
+            }
+        });
+    }
+
+    // 目标端口变化
+    const targetPortInput = ruleItem.querySelector('.target-port[data-id="' + ruleId + '"]');
+    if (targetPortInput) {
+        targetPortInput.addEventListener('change', function() {
+            updateRule(ruleId);
+        });
+    }
+}
+
+// 更新规则
+function updateRule(ruleId) {
+    const ruleItem = document.querySelector('.rule-item[data-id="' + ruleId + '"]');
+    if (!ruleItem) {
+        console.error('Rule item not found for id:', ruleId);
+        return;
+    }
+    const listenAddr = ruleItem.querySelector('.listen-addr').value;
+    const listenPort = ruleItem.querySelector('.listen-port').value;
+    const targetAddr = ruleItem.querySelector('.target-addr') ? ruleItem.querySelector('.target-addr').value : ruleItem.querySelector('.target-addr-custom').value;
+    const targetPort = ruleItem.querySelector('.target-port').value;
+    const logJA3 = ruleItem.querySelector('.log-ja3').checked;
+    const priority = ruleItem.querySelector('.rule-priority').value;
+    const autoStart = ruleItem.querySelector('.auto-start').checked;
+    const name = ruleItem.querySelector('.rule-name').value;
+    const note = ruleItem.querySelector('.rule-note').value;
+
+    fetch('api/updateRule', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            id: ruleId,
+            listenAddr: listenAddr,
+            listenPort: listenPort,
+            targetAddr: targetAddr,
+            targetPort: targetPort,
+            logJA3: logJA3,
+            priority: priority,
+            autoStart: autoStart,
+            name: name,
+            note: note
+        })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            loadRules();
+        } else {
+            markFieldErrors(ruleItem, data.fields);
+            showMessage('更新规则失败: ' + data.error, 'error');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to update rule:', error);
+    });
+}
+
+// 标出校验失败的输入框，鼠标悬停显示原因
+function markFieldErrors(ruleItem, fields) {
+    const selectors = {
+        listenAddr: '.listen-addr',
+        listenPort: '.listen-port',
+        targetAddr: '.target-addr, .target-addr-custom',
+        targetPort: '.target-port'
+    };
+    ruleItem.querySelectorAll('.field-invalid').forEach(el => {
+        el.classList.remove('field-invalid');
+        el.removeAttribute('title');
+    });
+    (fields || []).forEach(f => {
+        if (!selectors[f.field]) {
+            return;
+        }
+        ruleItem.querySelectorAll(selectors[f.field]).forEach(el => {
+            el.classList.add('field-invalid');
+            el.title = f.message;
+        });
+    });
+}
+
+// 渲染模板列表
+function renderTemplates() {
+    const templateSelect = document.getElementById('templateSelect');
+    templateSelect.innerHTML = '';
+
+    // 添加默认选择项
+    const defaultOption = document.createElement('option');
+    defaultOption.value = '';
+    defaultOption.textContent = '选择模板';
+    templateSelect.appendChild(defaultOption);
+
+    // 添加模板选项
+    templates.forEach(template => {
+        const option = document.createElement('option');
+        option.value = template.name;
+        option.textContent = template.name;
+        option.title = template.description || '';
+        templateSelect.appendChild(option);
+    });
+
+    // 渲染模板列表
+    renderTemplatesList();
+}
+
+// 渲染模板列表
+function renderTemplatesList() {
+    const templateList = document.getElementById('templateList');
+    templateList.innerHTML = '';
+
+    if (templates.length === 0) {
+        templateList.innerHTML = '<p style="text-align: center; color: #999; padding: 20px;">暂无模板，请点击"保存为模板"按钮创建</p>';
+        return;
+    }
+
+    templates.forEach(template => {
+        const templateItem = document.createElement('div');
+        templateItem.className = 'template-item';
+        templateItem.innerHTML = '<div class="template-info">' +
+            '<div class="template-name">' + template.name + (template.name === defaultTemplate ? ' <span style="font-size:12px; color:#27ae60;">（启动时自动开启）</span>' : '') + '</div>' +
+            (template.description ? '<div class="template-description" style="font-size:12px; color:#666;">' + escapeHTML(template.description) + '</div>' : '') +
+            '<div class="template-rules-count">规则数量: ' + template.rules.length + '</div>' +
+            '<div class="template-sign" style="font-size:12px; color:#666; margin-top:4px;">创建时间: ' + (template.CreatedAt || '') + '</div>' +
+            '</div>' +
+            '<div class="template-actions">' +
+            '<button class="btn btn-primary" onclick="applyTemplateByName(\'' + template.name + '\')">切到模板</button>' +
+            '<button class="btn btn-success" onclick="startTemplateForwardByName(\'' + template.name + '\')">开启转发</button>' +
+            '<button class="btn btn-danger" onclick="stopTemplateForwardByName(\'' + template.name + '\')">关闭转发</button>' +
+            (template.name === defaultTemplate
+                ? '<button class="btn btn-default" onclick="setDefaultTemplate(\'\')">取消自启</button>'
+                : '<button class="btn btn-default" onclick="setDefaultTemplate(\'' + template.name + '\')">启动时开启</button>') +
+            '<button class="btn btn-info" onclick="editTemplateByName(\'' + template.name + '\')">编辑</button>' +
+            '<button class="btn btn-danger" onclick="deleteTemplateByName(\'' + template.name + '\')">删除</button>' +
+            '</div>';
+        templateList.appendChild(templateItem);
+    });
+}
+
+// 按名称应用模板
+function applyTemplateByName(templateName) {
+    const templateSelect = document.getElementById('templateSelect');
+    templateSelect.value = templateName;
+    applyTemplate();
+}
+
+// 按名称开启模板转发
+function startTemplateForwardByName(templateName) {
+    const templateSelect = document.getElementById('templateSelect');
+    templateSelect.value = templateName;
+    startTemplateForward();
+}
+
+// 按名称关闭模板转发
+function stopTemplateForwardByName(templateName) {
+    const templateSelect = document.getElementById('templateSelect');
+    templateSelect.value = templateName;
+    stopTemplateForward();
+}
+
+// 按名称编辑模板
+function editTemplateByName(templateName) {
+    const templateSelect = document.getElementById('templateSelect');
+    templateSelect.value = templateName;
+    editTemplate();
+}
+
+// 按名称删除模板
+function deleteTemplateByName(templateName) {
+    const templateSelect = document.getElementById('templateSelect');
+    templateSelect.value = templateName;
+    deleteTemplate();
+}
+
+// 编辑模板
+function editTemplate() {
+    const templateSelect = document.getElementById('templateSelect');
+    const templateName = templateSelect.value;
+    if (!templateName) {
+        showMessage('请先选择要编辑的模板', 'info');
+        return;
+    }
+
+    // 创建编辑模板的对话框
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '300px';
+
+    const template = templates.find(t => t.name === templateName) || { rules: [] };
+    const snapshots = template.snapshots || [];
+    const findMember = id => snapshots.find(r => r.id === id) || rules.find(r => r.id === id);
+    const ruleLabel = r => (r.name ? r.name + ' ' : '') + hostPort(r.listenAddr, r.listenPort) + ' → ' + hostPort(r.targetAddr, r.targetPort);
+    // 模板中的规则（按顺序），去掉已不存在的规则
+    let members = template.rules.filter(id => findMember(id));
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">编辑模板</h3>' +
+        '<p>模板名称：</p>' +
+        '<div style="padding: 10px; margin: 15px 0;">' +
+        '<input type="text" id="newTemplateName" value="' + escapeHTML(templateName) + '" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
+        '<p>描述：</p>' +
+        '<textarea id="templateDescription" rows="2" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' + escapeHTML(template.description || '') + '</textarea>' +
+        '<p>开启前切换到的环境：</p>' +
+        '<select id="templateProfile" style="width: 100%; padding: 6px;"><option value="">使用当前环境</option></select>' +
+        '<p>规则（按启动顺序）：</p>' +
+        '<div id="templateMembers"></div>' +
+        '<select id="templateAddRule" style="width: 100%; margin-top: 8px; padding: 6px;"></select>' +
+        '</div>' +
+        '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
+        '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
+        '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
+        '</div>';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    // 渲染规则列表与可加入的全局规则
+    const renderMembers = () => {
+        const list = dialog.querySelector('#templateMembers');
+        list.innerHTML = members.length === 0 ? '<p style="color: #999;">模板中暂无规则</p>' : '';
+        members.forEach((id, i) => {
+            const row = document.createElement('div');
+            row.style.display = 'flex';
+            row.style.alignItems = 'center';
+            row.style.gap = '6px';
+            row.style.marginBottom = '4px';
+            const isPrivate = snapshots.some(r => r.id === id);
+            row.innerHTML = '<span style="flex: 1;">' + escapeHTML(ruleLabel(findMember(id))) + (isPrivate ? '（私有）' : '') + '</span>' +
+                '<button class="btn btn-default" data-move="-1"' + (i === 0 ? ' disabled' : '') + '>↑</button>' +
+                '<button class="btn btn-default" data-move="1"' + (i === members.length - 1 ? ' disabled' : '') + '>↓</button>' +
+                '<button class="btn btn-danger" data-remove="1">移除</button>';
+            row.querySelectorAll('[data-move]').forEach(btn => btn.addEventListener('click', () => {
+                const j = i + parseInt(btn.dataset.move, 10);
+                [members[i], members[j]] = [members[j], members[i]];
+                renderMembers();
+            }));
+            row.querySelector('[data-remove]').addEventListener('click', () => {
+                members.splice(i, 1);
+                renderMembers();
+            });
+            list.appendChild(row);
+        });
+
+        const addSelect = dialog.querySelector('#templateAddRule');
+        addSelect.innerHTML = '<option value="">加入规则…</option>' + rules
+            .filter(r => !members.includes(r.id))
+            .map(r => '<option value="' + r.id + '">' + escapeHTML(r.seq + '. ' + ruleLabel(r)) + '</option>')
+            .join('');
+    };
+    dialog.querySelector('#templateAddRule').addEventListener('change', function() {
+        if (this.value) {
+            members.push(this.value);
+            renderMembers();
+        }
+    });
+    renderMembers();
+
+    fetch('api/profiles')
+        .then(response => response.json())
+        .then(data => {
+            const select = dialog.querySelector('#templateProfile');
+            data.profiles.forEach(p => {
+                select.insertAdjacentHTML('beforeend', '<option value="' + escapeHTML(p.name) + '">' + escapeHTML(p.name) + '</option>');
+            });
+            select.value = template.profile || '';
+        });
+
+    document.getElementById('cancelBtn').addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    document.getElementById('confirmBtn').addEventListener('click', function() {
+        const newTemplateName = document.getElementById('newTemplateName').value.trim();
+        if (newTemplateName !== '') {
+            // 调用API更新模板名称、描述与规则
+            fetch('api/updateTemplate', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    oldName: templateName,
+                    newName: newTemplateName,
+                    description: document.getElementById('templateDescription').value,
+                    profile: document.getElementById('templateProfile').value,
+                    rules: members
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    loadTemplates();
+                    showMessage('模板编辑成功', 'success');
+                } else {
+                    showMessage('模板编辑失败: ' + data.error, 'error');
+                }
+            })
+            .catch(error => {
+                console.error('Failed to edit template:', error);
+                showMessage('模板编辑失败', 'error');
+            });
+        }
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    overlay.addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+}
+
+// 加入已有模板
+function addToExistingTemplate() {
+    const selectedCheckboxes = document.querySelectorAll('.rule-checkbox:checked');
+    if (selectedCheckboxes.length === 0) {
+        showMessage('请先选择要加入模板的规则', 'info');
+        return;
+    }
+
+    if (templates.length === 0) {
+        showMessage('暂无模板，请先创建模板', 'info');
+        return;
+    }
+
+    // 生成模板选择选项
+    let templateList = '';
+    templates.forEach((template, index) => {
+        templateList += (index + 1) + '. ' + template.name + '\n';
+    });
+
+    // 让用户输入模板编号
+    const templateIndex = prompt('请选择要加入的模板编号：\n' + templateList);
+    if (templateIndex) {
+        const index = parseInt(templateIndex) - 1;
+        if (index >= 0 && index < templates.length) {
+            const templateName = templates[index].name;
+            const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
+            
+            // 调用API将规则加入已有模板
+            fetch('api/saveAsTemplate', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    name: templateName,
+                    ids: selectedIds
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    loadTemplates();
+                    showMessage('规则已成功加入模板', 'success');
+                }
+            })
+            .catch(error => {
+                console.error('Failed to add to existing template:', error);
+                showMessage('加入模板失败', 'error');
+            });
+        } else {
+            showMessage('无效的模板编号', 'error');
+        }
+    }
+}
+
+// 创建模板选择对话框
+function createTemplateSelectDialog(selectedCheckboxes) {
+    // 创建遮罩层
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    // 创建对话框
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '300px';
+
+    // 创建对话框内容
+    let templateOptions = '';
+    templates.forEach(template => {
+        templateOptions += '<option value="' + template.name + '">' + template.name + '</option>';
+    });
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">加入已有模板</h3>' +
+        '<p>确定要将选中的规则加入模板吗？</p>' +
+        '<div style="padding: 10px; margin: 15px 0;">' +
+        '<label style="display: block; margin-bottom: 5px;">选择模板：</label>' +
+        '<select id="existingTemplateSelect" style="width: 100%; padding: 8px;">' +
+        templateOptions +
+        '</select>' +
+        '</div>' +
+        '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
+        '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
+        '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
+        '</div>';
+
+    // 添加到页面
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    // 绑定事件
+    document.getElementById('cancelBtn').addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    document.getElementById('confirmBtn').addEventListener('click', function() {
+        const templateSelect = document.getElementById('existingTemplateSelect');
+        if (templateSelect) {
+            const templateName = templateSelect.value;
+            if (templateName) {
+                const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
+                // 调用API将规则加入已有模板
+                fetch('api/saveAsTemplate', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        name: templateName,
+                        ids: selectedIds
+                    })
+                })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.success) {
+                        loadTemplates();
+                        showMessage('规则已成功加入模板', 'success');
+                    }
+                })
+                .catch(error => {
+                    console.error('Failed to add to existing template:', error);
+                    showMessage('加入模板失败', 'error');
+                });
+            }
+        }
+        // 关闭对话框
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    // 点击遮罩层关闭对话框
+    overlay.addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+}
+
+// 新建模板
+function createNewTemplate() {
+
+    // 创建新建模板的对话框
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '300px';
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">新建模板</h3>' +
+        '<p>请输入模板名称：</p>' +
+        '<div style="padding: 10px; margin: 15px 0;">' +
+        '<input type="text" id="templateName" placeholder="请输入模板名称" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
+        '</div>' +
+        '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
+        '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
+        '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
+        '</div>';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    document.getElementById('cancelBtn').addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    document.getElementById('confirmBtn').addEventListener('click', function() {
+        const templateName = document.getElementById('templateName').value.trim();
+        if (templateName !== '') {
+            // 直接创建模板，不强制要求必须选择规则
+            const selectedIds = Array.from(document.querySelectorAll('.rule-checkbox:checked')).map(cb => cb.dataset.id);
+            fetch('api/saveAsTemplate', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    name: templateName,
+                    ids: selectedIds
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    loadTemplates();
+                    showMessage('模板创建成功', 'success');
+                }
+            })
+            .catch(error => {
+                console.error('Failed to create template:', error);
+                showMessage('模板创建失败', 'error');
+            });
+        }
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    overlay.addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+}
+
+// 新增规则
+function addRule() {
+    fetch('api/addRule', {
+        method: 'POST'
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            loadRules();
+            showMessage('规则添加成功', 'success');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to add rule:', error);
+    });
+}
+
+// 开启或停止所有规则的转发，未选协议时开启 TCP+UDP、停止所有协议
+function bulkForwards(action) {
+    const protocol = document.getElementById('bulkProtocol').value;
+    fetch(action === 'start' ? 'api/startAllForwards' : 'api/stopAllForwards', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ protocol: protocol })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (!result.success) {
+            showMessage('操作失败: ' + result.error, 'error');
+            return;
+        }
+        const count = action === 'start' ? '已开启 ' + result.started + ' 个转发' : '已停止 ' + result.stopped + ' 个转发';
+        if (result.failed.length > 0) {
+            const details = result.failed.map(f => {
+                const rule = rules.find(r => r.id === f.ruleId);
+                return (rule ? hostPort(rule.listenAddr, rule.listenPort) : f.ruleId) + ' ' + f.protocol.toUpperCase() + ': ' + f.error;
+            });
+            showMessage(count + '，' + result.failed.length + ' 个失败：' + details.join('；'), 'error');
+        } else {
+            showMessage(count, 'success');
+        }
+        loadRules();
+    })
+    .catch(error => {
+        console.error('Failed to ' + action + ' all forwards:', error);
+    });
+}
+
+// 发现本机正在监听的服务
+function discoverServices() {
+    fetch('api/discoverServices')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                showMessage('发现服务失败: ' + data.error, 'error');
+                return;
+            }
+            showServicesDialog(data.services);
+        })
+        .catch(error => {
+            console.error('Failed to discover services:', error);
+        });
+}
+
+// 显示发现的服务列表，一键创建转发规则
+function showServicesDialog(services) {
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '500px';
+    dialog.style.maxHeight = '80%';
+    dialog.style.overflowY = 'auto';
+
+    let rows = '';
+    services.forEach(function(svc, index) {
+        rows += '<tr>' +
+            '<td>' + hostPort(svc.addr, svc.port) + '</td>' +
+            '<td>' + (svc.service || '-') + '</td>' +
+            '<td>' + (svc.process || '-') + (svc.pid ? ' (' + svc.pid + ')' : '') + '</td>' +
+            '<td><button class="btn btn-success" data-index="' + index + '">创建转发</button></td>' +
+            '</tr>';
+    });
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">本机监听的服务</h3>' +
+        '<div style="margin: 10px 0;">暴露到：<select id="exposeAddrSelect" class="template-select">' + renderIPOptions('') + '</select></div>' +
+        (services.length === 0 ? '<p>未发现监听中的服务</p>' :
+        '<table style="width: 100%; border-collapse: collapse;"><tr><th align="left">地址</th><th align="left">服务</th><th align="left">进程</th><th></th></tr>' + rows + '</table>') +
+        '<div style="display: flex; justify-content: flex-end; margin-top: 15px;">' +
+        '<button id="closeBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">关闭</button>' +
+        '</div>';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    function close() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    dialog.querySelectorAll('button[data-index]').forEach(function(btn) {
+        btn.addEventListener('click', function() {
+            const svc = services[parseInt(this.dataset.index)];
+            const listenAddr = document.getElementById('exposeAddrSelect').value;
+            if (!listenAddr) {
+                showMessage('请先选择要暴露到的地址', 'info');
+                return;
+            }
+            fetch('api/addRule', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    listenAddr: listenAddr,
+                    listenPort: svc.targetPort,
+                    targetAddr: svc.targetAddr,
+                    targetPort: svc.targetPort
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    loadRules();
+                    showMessage('已创建转发规则', 'success');
+                    close();
+                } else {
+                    showMessage('创建规则失败: ' + data.error, 'error');
+                }
+            });
+        });
+    });
+    document.getElementById('closeBtn').addEventListener('click', close);
+    overlay.addEventListener('click', close);
+}
+
+// 字节数转为易读的单位
+function formatBytes(n) {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let i = 0;
+    while (n >= 1024 && i < units.length - 1) {
+        n /= 1024;
+        i++;
+    }
+    return (i === 0 ? n : n.toFixed(1)) + ' ' + units[i];
+}
+
+// 显示所有 TCP/SOCKS5 活动连接，可逐个断开
+function showConnections() {
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '700px';
+    dialog.style.maxHeight = '80%';
+    dialog.style.overflowY = 'auto';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    function close() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    function render() {
+        fetch('api/getConnections')
+            .then(response => response.json())
+            .then(conns => {
+                let rows = '';
+                conns.forEach(function(c) {
+                    const rule = rules.find(r => r.id === c.ruleId);
+                    const seconds = Math.floor((Date.now() - new Date(c.started).getTime()) / 1000);
+                    rows += '<tr>' +
+                        '<td>' + escapeHTML(rule ? '#' + rule.seq + ' ' + (rule.name || hostPort(rule.listenAddr, rule.listenPort)) : hostPort(c.listenAddr, c.listenPort)) + '</td>' +
+                        '<td>' + c.protocol.toUpperCase() + (c.draining ? ' (排空中)' : '') + '</td>' +
+                        '<td>' + escapeHTML(c.client) + '</td>' +
+                        '<td>' + escapeHTML(c.target || '-') + '</td>' +
+                        '<td>' + seconds + '秒</td>' +
+                        '<td>' + formatBytes(c.bytesIn) + ' / ' + formatBytes(c.bytesOut) + '</td>' +
+                        '<td><button class="btn btn-danger" data-id="' + c.id + '">断开</button></td>' +
+                        '</tr>';
+                });
+
+                dialog.innerHTML = '<h3 style="margin-top: 0;">活动连接 (' + conns.length + ')</h3>' +
+                    (conns.length === 0 ? '<p>当前没有活动连接</p>' :
+                    '<table style="width: 100%; border-collapse: collapse;"><tr><th align="left">规则</th><th align="left">协议</th><th align="left">客户端</th><th align="left">目标</th><th align="left">时长</th><th align="left">上行 / 下行</th><th></th></tr>' + rows + '</table>') +
+                    '<div style="display: flex; justify-content: flex-end; gap: 10px; margin-top: 15px;">' +
+                    '<button id="refreshConnsBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">刷新</button>' +
+                    '<button id="closeConnsBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">关闭</button>' +
+                    '</div>';
+
+                dialog.querySelectorAll('button[data-id]').forEach(function(btn) {
+                    btn.addEventListener('click', function() {
+                        fetch('api/killConnection', {
+                            method: 'POST',
+                            headers: {
+                                'Content-Type': 'application/json'
+                            },
+                            body: JSON.stringify({ id: parseInt(this.dataset.id) })
+                        })
+                        .then(response => response.json())
+                        .then(result => {
+                            if (result.success) {
+                                showMessage('连接已断开', 'success');
+                            } else {
+                                showMessage('断开连接失败: ' + result.error, 'error');
+                            }
+                            render();
+                        });
+                    });
+                });
+                document.getElementById('refreshConnsBtn').addEventListener('click', render);
+                document.getElementById('closeConnsBtn').addEventListener('click', close);
+            })
+            .catch(error => {
+                console.error('Failed to load connections:', error);
+            });
+    }
+
+    overlay.addEventListener('click', close);
+    render();
+}
+
+// 显示向本实例报告的代理（其他 go-ports 实例）及其规则，命令在代理下次报告时执行
+function showAgents() {
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '760px';
+    dialog.style.maxHeight = '80%';
+    dialog.style.overflowY = 'auto';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    let timer = null;
+    function close() {
+        clearInterval(timer);
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    // 为代理排队一条命令
+    function send(agent, command) {
+        command.agent = agent;
+        fetch('api/agentCommand', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(command)
+        })
+        .then(response => response.json())
+        .then(result => {
+            if (result.success) {
+                showMessage('命令已排队，代理下次报告时执行', 'success');
+            } else {
+                showMessage('发送命令失败: ' + result.error, 'error');
+            }
+            render();
+        });
+    }
+
+    // 输入新增或修改的规则地址，取消时返回 null
+    function promptRule(current) {
+        const name = prompt('规则名称：', current.name || '');
+        if (name === null) {
+            return null;
+        }
+        const listen = prompt('代理上的监听地址（addr:port）：', current.listenPort ? hostPort(current.listenAddr, current.listenPort) : '0.0.0.0:');
+        if (listen === null) {
+            return null;
+        }
+        const target = prompt('目标地址（addr:port）：', current.targetPort ? hostPort(current.targetAddr, current.targetPort) : '');
+        if (target === null) {
+            return null;
+        }
+        const split = s => {
+            const i = s.trim().lastIndexOf(':');
+            return i < 0 ? ['', s.trim()] : [s.trim().slice(0, i), s.trim().slice(i + 1)];
+        };
+        const [listenAddr, listenPort] = split(listen);
+        const [targetAddr, targetPort] = split(target);
+        return { name: name.trim(), listenAddr, listenPort, targetAddr, targetPort };
+    }
+
+    function render() {
+        fetch('api/agents')
+            .then(response => response.json())
+            .then(agents => {
+                let html = '<h3 style="margin-top: 0;">代理 (' + agents.length + ')</h3>';
+                if (agents.length === 0) {
+                    html += '<p>还没有代理报告。在其他实例上以 -agent-controller 指向本实例、-agent-token 为本实例的 -controller-token 启动</p>';
+                }
+                agents.forEach(function(a, ai) {
+                    const name = escapeHTML(a.name);
+                    html += '<div style="border-top: 1px solid #eee; padding-top: 10px; margin-top: 10px;">' +
+                        '<strong>' + name + '</strong> ' + escapeHTML(a.addr) + ' ' +
+                        (a.online ? '<span style="color: green;">在线</span>' : '<span style="color: #999;">离线</span>') +
+                        (a.pending.length ? ' · ' + a.pending.length + ' 条命令待执行' : '') +
+                        ' <button class="btn btn-primary" data-agent="' + ai + '" data-action="add">新增规则</button>' +
+                        ' <button class="btn btn-default" data-agent="' + ai + '" data-action="forget">移除</button>';
+                    if (a.rules.length) {
+                        html += '<table style="width: 100%; border-collapse: collapse; margin-top: 8px;"><tr><th align="left">规则</th><th align="left">监听</th><th align="left">目标</th><th align="left">运行中</th><th></th></tr>';
+                        a.rules.forEach(function(s, ri) {
+                            const r = s.rule;
+                            const attrs = 'data-agent="' + ai + '" data-rule="' + ri + '"';
+                            html += '<tr>' +
+                                '<td>' + escapeHTML('#' + r.seq + ' ' + (r.name || '')) + '</td>' +
+                                '<td>' + escapeHTML(hostPort(r.listenAddr, r.listenPort)) + '</td>' +
+                                '<td>' + escapeHTML(r.targetPort ? hostPort(r.targetAddr, r.targetPort) : '-') + '</td>' +
+                                '<td>' + (s.active.length ? s.active.map(p => p.toUpperCase()).join(', ') : '-') + '</td>' +
+                                '<td>' +
+                                (s.active.length ? '<button class="btn btn-danger" ' + attrs + ' data-action="stop">停止</button>' : '<button class="btn btn-success" ' + attrs + ' data-action="start">开启</button>') +
+                                ' <button class="btn btn-default" ' + attrs + ' data-action="update">编辑</button>' +
+                                ' <button class="btn btn-danger" ' + attrs + ' data-action="delete">删除</button>' +
+                                '</td></tr>';
+                        });
+                        html += '</table>';
+                    }
+                    const failed = a.results.filter(r => !r.success).slice(0, 3);
+                    failed.forEach(function(r) {
+                        html += '<div style="color: #c00; font-size: 12px;">' + escapeHTML(r.action + ' ' + (r.ruleId || '') + ': ' + r.error) + '</div>';
+                    });
+                    html += '</div>';
+                });
+                html += '<div style="display: flex; justify-content: flex-end; gap: 10px; margin-top: 15px;">' +
+                    '<button id="refreshAgentsBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">刷新</button>' +
+                    '<button id="closeAgentsBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">关闭</button>' +
+                    '</div>';
+                dialog.innerHTML = html;
+
+                dialog.querySelectorAll('button[data-action]').forEach(function(btn) {
+                    btn.addEventListener('click', function() {
+                        const agent = agents[parseInt(this.dataset.agent)];
+                        const status = this.dataset.rule !== undefined ? agent.rules[parseInt(this.dataset.rule)] : null;
+                        switch (this.dataset.action) {
+                        case 'start':
+                        case 'stop':
+                            send(agent.name, { action: this.dataset.action, ruleId: status.rule.id });
+                            break;
+                        case 'update': {
+                            const spec = promptRule(status.rule);
+                            if (spec) {
+                                send(agent.name, { action: 'update', ruleId: status.rule.id, rule: spec });
+                            }
+                            break;
+                        }
+                        case 'delete':
+                            if (confirm('确定要删除代理 ' + agent.name + ' 上的这条规则吗？')) {
+                                send(agent.name, { action: 'delete', ruleId: status.rule.id });
+                            }
+                            break;
+                        case 'add': {
+                            const spec = promptRule({});
+                            if (spec) {
+                                send(agent.name, { action: 'add', rule: spec });
+                            }
+                            break;
+                        }
+                        case 'forget':
+                            fetch('api/deleteAgent', {
+                                method: 'POST',
+                                headers: {
+                                    'Content-Type': 'application/json'
+                                },
+                                body: JSON.stringify({ name: agent.name })
+                            }).then(render);
+                            break;
+                        }
+                    });
+                });
+                document.getElementById('refreshAgentsBtn').addEventListener('click', render);
+                document.getElementById('closeAgentsBtn').addEventListener('click', close);
+            })
+            .catch(error => {
+                console.error('Failed to load agents:', error);
+            });
+    }
+
+    overlay.addEventListener('click', close);
+    render();
+    timer = setInterval(render, 5000);
+}
+
+// 管理环境：每个环境一组变量，规则目标中的 ${NAME} 按当前环境展开
+function showProfiles() {
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '520px';
+    dialog.style.maxHeight = '80%';
+    dialog.style.overflowY = 'auto';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    function close() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    function post(url, body, done) {
+        fetch(url, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(body)
+        })
+        .then(response => response.json())
+        .then(result => {
+            if (result.success) {
+                showMessage(done, 'success');
+                loadRules();
+            } else {
+                showMessage('操作失败: ' + result.error, 'error');
+            }
+            render();
+        });
+    }
+
+    // 每行一个 NAME=value
+    const formatVars = vars => Object.keys(vars || {}).sort().map(k => k + '=' + vars[k]).join('\n');
+    const parseVars = text => {
+        const vars = {};
+        text.split('\n').map(s => s.trim()).filter(Boolean).forEach(line => {
+            const i = line.indexOf('=');
+            vars[(i < 0 ? line : line.slice(0, i)).trim()] = i < 0 ? '' : line.slice(i + 1).trim();
+        });
+        return vars;
+    };
+
+    function render() {
+        fetch('api/profiles')
+            .then(response => response.json())
+            .then(data => {
+                let html = '<h3 style="margin-top: 0;">环境 (' + data.profiles.length + ')</h3>' +
+                    '<p>规则的目标地址与端口可以写成 ${NAME}，开启转发时按当前环境展开。切换环境时正在运行的转发会重启。</p>' +
+                    '<p>规则引用的变量：' + (data.variables.length ? escapeHTML(data.variables.join(', ')) : '无') + '</p>' +
+                    '<p>当前环境：<strong>' + (data.active ? escapeHTML(data.active) : '无') + '</strong>' +
+                    (data.active ? ' <button class="btn btn-default" data-action="clear">不使用环境</button>' : '') + '</p>';
+                data.profiles.forEach(function(p, i) {
+                    const missing = data.variables.filter(v => !(v in (p.vars || {})));
+                    html += '<div style="border-top: 1px solid #eee; padding-top: 10px; margin-top: 10px;">' +
+                        '<strong>' + escapeHTML(p.name) + '</strong>' +
+                        (p.name === data.active ? ' <span style="color: green;">当前</span>' : ' <button class="btn btn-success" data-profile="' + i + '" data-action="use">使用</button>') +
+                        ' <button class="btn btn-primary" data-profile="' + i + '" data-action="save">保存</button>' +
+                        ' <button class="btn btn-default" data-profile="' + i + '" data-action="rename">重命名</button>' +
+                        ' <button class="btn btn-danger" data-profile="' + i + '" data-action="delete">删除</button>' +
+                        '<textarea data-vars="' + i + '" rows="4" placeholder="NAME=value" style="width: 100%; margin-top: 6px; padding: 6px; border: 1px solid #ddd; border-radius: 4px; font-family: monospace;">' + escapeHTML(formatVars(p.vars)) + '</textarea>' +
+                        (missing.length ? '<div style="color: #c00; font-size: 12px;">未定义：' + escapeHTML(missing.join(', ')) + '</div>' : '') +
+                        '</div>';
+                });
+                html += '<div style="display: flex; justify-content: flex-end; gap: 10px; margin-top: 15px;">' +
+                    '<button id="addProfileBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">新增环境</button>' +
+                    '<button id="closeProfilesBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">关闭</button>' +
+                    '</div>';
+                dialog.innerHTML = html;
+
+                dialog.querySelectorAll('button[data-action]').forEach(function(btn) {
+                    btn.addEventListener('click', function() {
+                        const profile = data.profiles[parseInt(this.dataset.profile)];
+                        switch (this.dataset.action) {
+                        case 'clear':
+                            post('api/setActiveProfile', { name: '' }, '已不使用环境');
+                            break;
+                        case 'use':
+                            post('api/setActiveProfile', { name: profile.name }, '已切换到环境 ' + profile.name);
+                            break;
+                        case 'save': {
+                            const text = dialog.querySelector('textarea[data-vars="' + this.dataset.profile + '"]').value;
+                            post('api/updateProfile', { oldName: profile.name, name: profile.name, vars: parseVars(text) }, '环境已保存');
+                            break;
+                        }
+                        case 'rename': {
+                            const name = prompt('环境名称：', profile.name);
+                            if (name && name.trim() !== profile.name) {
+                                post('api/updateProfile', { oldName: profile.name, name: name.trim(), vars: profile.vars }, '环境已保存');
+                            }
+                            break;
+                        }
+                        case 'delete':
+                            if (confirm('确定要删除环境 ' + profile.name + ' 吗？')) {
+                                post('api/deleteProfile', { name: profile.name }, '环境已删除');
+                            }
+                            break;
+                        }
+                    });
+                });
+                document.getElementById('addProfileBtn').addEventListener('click', function() {
+                    const name = prompt('环境名称（如 dev、staging、prod）：', '');
+                    if (name && name.trim()) {
+                        // 预先列出规则引用的变量，填写取值即可
+                        const vars = {};
+                        data.variables.forEach(v => { vars[v] = ''; });
+                        post('api/updateProfile', { name: name.trim(), vars: vars }, '环境已保存');
+                    }
+                });
+                document.getElementById('closeProfilesBtn').addEventListener('click', close);
+            })
+            .catch(error => {
+                console.error('Failed to load profiles:', error);
+            });
+    }
+
+    overlay.addEventListener('click', close);
+    render();
+}
+
+// 删除选中规则
+function deleteSelectedRules() {
+    const selectedCheckboxes = document.querySelectorAll('.rule-checkbox:checked');
+    if (selectedCheckboxes.length === 0) {
+        showMessage('请先选择要删除的规则', 'info');
+        return;
+    }
+
+    const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
+    fetch('api/deleteRules', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ids: selectedIds })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            loadRules();
+            showMessage('规则删除成功', 'success');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to delete rules:', error);
+    });
+}
+
+// 删除单个规则
+function deleteRule(id) {
+    if (confirm('确定要删除此规则吗？')) {
+        fetch('api/deleteRules', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ ids: [id] })
+        })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                const templateSelect = document.getElementById('templateSelect');
+                const templateName = templateSelect.value;
+                if (templateName && templateName !== 'default') {
+                    // 当前在模板视图中，重新加载模板规则
+                    fetch('api/getTemplates')
+                        .then(response => response.json())
+                        .then(data => {
+                            const template = data.find(t => t.name === templateName);
+                            if (template) {
+                                renderTemplateRules(template);
+                            }
+                        });
+                } else {
+                    // 当前在所有记录视图中，加载所有规则
+                    loadRules();
+                }
+                showMessage('规则删除成功', 'success');
+            }
+        })
+        .catch(error => {
+            console.error('Failed to delete rule:', error);
+        });
+    }
+}
+
+// 在服务端复制规则，可按偏移平移监听端口与目标端口
+function duplicateRule(ruleId) {
+    const offset = prompt('监听端口偏移（如 1 表示 8080 变为 8081，0 为不变）：', '1');
+    if (offset === null) {
+        return;
+    }
+    const targetOffset = prompt('目标端口偏移（0 为不变）：', '0');
+    if (targetOffset === null) {
+        return;
+    }
+    const portOffset = parseInt(offset || '0', 10);
+    const targetPortOffset = parseInt(targetOffset || '0', 10);
+    if (isNaN(portOffset) || isNaN(targetPortOffset)) {
+        showMessage('端口偏移必须是整数', 'error');
+        return;
+    }
+
+    fetch('api/duplicateRule', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, portOffset: portOffset, targetPortOffset: targetPortOffset })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('已创建副本，监听端口 ' + result.rule.listenPort, 'success');
+            loadRules();
+        } else {
+            showMessage('复制规则失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 复制规则的访问地址，与 /api/getShareInfo 一致。浏览器不允许写剪贴板时（如通过 http 访问局域网地址）
+// 改为显示可选中的分享信息
+function copyRule(index) {
+    const rule = rules[index];
+    fetch('api/getShareInfo?ruleId=' + encodeURIComponent(rule.id))
+        .then(response => response.json())
+        .then(share => {
+            if (!navigator.clipboard) {
+                showShareInfo(rule.id);
+                return;
+            }
+            navigator.clipboard.writeText(share.endpoint)
+                .then(() => {
+                    showMessage('已复制: ' + share.endpoint, 'success');
+                })
+                .catch(err => {
+                    console.error('复制失败:', err);
+                    showShareInfo(rule.id);
+                });
+        });
+}
+
+// 读取分享信息，失败时以服务端返回的文本作为错误
+function fetchShareInfo(query) {
+    return fetch('api/getShareInfo?' + query)
+        .then(response => response.ok ? response.json() : response.text().then(text => { throw new Error(text.trim()); }));
+}
+
+// 显示规则的 ip:port、各 scheme 的 URL 与二维码内容，点击输入框即全选，不依赖剪贴板权限
+function showShareInfo(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '460px';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    function close() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    const field = (label, value) => '<p style="margin: 8px 0 4px;">' + escapeHTML(label) + '</p>' +
+        '<input type="text" readonly value="' + escapeHTML(value) + '" style="width: 100%; padding: 6px; border: 1px solid #ddd; border-radius: 4px; font-family: monospace;">';
+
+    function render(isPublic) {
+        fetchShareInfo('ruleId=' + encodeURIComponent(ruleId) + (isPublic ? '&public=1' : ''))
+            .then(share => {
+                let html = '<h3 style="margin-top: 0;">分享</h3>' +
+                    '<label style="font-size: 12px;"><input type="checkbox" id="sharePublic"' + (isPublic ? ' checked' : '') + '> 使用公网IP</label>' +
+                    field('地址', share.endpoint);
+                share.urls.forEach(u => {
+                    html += field(u.scheme.toUpperCase(), u.url);
+                });
+                html += field('二维码内容', share.qr) +
+                    '<p style="margin: 12px 0 4px;">URL scheme（逗号分隔，如 http,https,rdp,vnc；留空按目标端口推测）：</p>' +
+                    '<div style="display: flex; gap: 6px;"><input type="text" id="shareSchemes" value="' + escapeHTML((rule.shareSchemes || []).join(',')) + '" style="flex: 1; padding: 6px; border: 1px solid #ddd; border-radius: 4px;">' +
+                    '<button class="btn btn-primary" id="saveShareSchemesBtn">保存</button></div>' +
+                    '<div style="display: flex; justify-content: flex-end; margin-top: 15px;">' +
+                    '<button id="closeShareBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">关闭</button>' +
+                    '</div>';
+                dialog.innerHTML = html;
+
+                dialog.querySelectorAll('input[readonly]').forEach(input => {
+                    input.addEventListener('focus', () => input.select());
+                });
+                dialog.querySelector('#sharePublic').addEventListener('change', function() {
+                    render(this.checked);
+                });
+                dialog.querySelector('#saveShareSchemesBtn').addEventListener('click', function() {
+                    const schemes = dialog.querySelector('#shareSchemes').value.split(',').map(s => s.trim()).filter(Boolean);
+                    fetch('api/updateShareSchemes', {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json'
+                        },
+                        body: JSON.stringify({ ruleId: ruleId, schemes: schemes })
+                    })
+                    .then(response => response.json())
+                    .then(result => {
+                        if (result.success) {
+                            rule.shareSchemes = schemes.length ? schemes : undefined;
+                            showMessage('URL scheme 已更新', 'success');
+                            render(isPublic);
+                        } else {
+                            showMessage('更新 URL scheme 失败: ' + result.error, 'error');
+                        }
+                    });
+                });
+                dialog.querySelector('#closeShareBtn').addEventListener('click', close);
+            })
+            .catch(error => {
+                showMessage('获取分享信息失败: ' + error.message, 'error');
+                if (isPublic) {
+                    render(false);
+                }
+            });
+    }
+
+    overlay.addEventListener('click', close);
+    render(false);
+}
+
+// 从模板复制规则信息
+function copyRuleFromTemplate(index, templateName) {
+    fetch('api/getTemplates')
+        .then(response => response.json())
+        .then(data => {
+            const template = data.find(t => t.name === templateName);
+            if (template) {
+                const rule = template.rules[index];
+                const info = hostPort(rule.listenAddr, rule.listenPort);
+                navigator.clipboard.writeText(info)
+                    .then(() => {
+                        showMessage('已复制: ' + info, 'success');
+                    })
+                    .catch(err => {
+                        console.error('复制失败:', err);
+                        showMessage('复制失败', 'error');
+                    });
+            }
+        });
+}
+
+// 显示二维码
+function showQRCode(listenAddr, listenPort) {
+    // 文字与二维码的内容都来自服务端，与 /api/getShareInfo 一致
+    const shareQuery = 'listenAddr=' + encodeURIComponent(listenAddr) + '&listenPort=' + encodeURIComponent(listenPort);
+    let qrCodeUrl = 'api/getQRCode?listenAddr=' + encodeURIComponent(listenAddr) + '&listenPort=' + encodeURIComponent(listenPort);
+    if (window.apiToken) {
+        // 图片请求无法附带请求头，通过参数传递令牌
+        qrCodeUrl += '&token=' + encodeURIComponent(window.apiToken);
+    }
+    
+    // 创建弹窗
+    const popupDiv = document.createElement('div');
+    popupDiv.style.position = 'fixed';
+    popupDiv.style.top = '50%';
+    popupDiv.style.left = '50%';
+    popupDiv.style.transform = 'translate(-50%, -50%)';
+    popupDiv.style.backgroundColor = 'white';
+    popupDiv.style.padding = '20px';
+    popupDiv.style.borderRadius = '8px';
+    popupDiv.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    popupDiv.style.zIndex = '1000';
+    popupDiv.style.textAlign = 'center';
+    
+    // 创建关闭按钮
+    const closeBtn = document.createElement('button');
+    closeBtn.textContent = '关闭';
+    closeBtn.style.position = 'absolute';
+    closeBtn.style.top = '10px';
+    closeBtn.style.right = '10px';
+    closeBtn.style.padding = '5px 10px';
+    closeBtn.style.border = 'none';
+    closeBtn.style.borderRadius = '4px';
+    closeBtn.style.backgroundColor = '#666';
+    closeBtn.style.color = 'white';
+    closeBtn.style.cursor = 'pointer';
+    closeBtn.onclick = function() {
+        document.body.removeChild(popupDiv);
+        document.body.removeChild(overlay);
+    };
+    
+    // 创建内容
+    const content = document.createElement('div');
+    content.innerHTML = '<h3>访问地址</h3><p class="qr-info"></p><img src="' + qrCodeUrl + '" alt="二维码"><p style="margin-top: 10px; font-size: 12px; color: #666;">扫码访问源IP:源端口</p>' +
+        '<label style="font-size: 12px;" title="外网用户扫码时使用本机的公网IP（通过 STUN 或 -public-ip-url 检测）"><input type="checkbox" class="qr-public"> 使用公网IP</label>';
+    const infoEl = content.querySelector('.qr-info');
+    fetchShareInfo(shareQuery).then(share => {
+        infoEl.textContent = share.qr;
+    });
+    content.querySelector('.qr-public').onchange = function() {
+        const img = content.querySelector('img');
+        const isPublic = this.checked;
+        fetchShareInfo(shareQuery + (isPublic ? '&public=1' : ''))
+            .then(share => {
+                img.src = qrCodeUrl + (isPublic ? '&public=1' : '');
+                infoEl.textContent = share.qr;
+            })
+            .catch(error => {
+                showMessage('检测公网IP失败: ' + error.message, 'error');
+                this.checked = false;
+            });
+    };
+    
+    // 组装弹窗
+    popupDiv.appendChild(closeBtn);
+    popupDiv.appendChild(content);
+    
+    // 创建遮罩层
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+    overlay.onclick = function() {
+        document.body.removeChild(popupDiv);
+        document.body.removeChild(overlay);
+    };
+    
+    // 添加到页面
+    document.body.appendChild(overlay);
+    document.body.appendChild(popupDiv);
+}
+
+// 保存为模板
+function saveAsTemplate() {
+    const selectedCheckboxes = document.querySelectorAll('.rule-checkbox:checked');
+    if (selectedCheckboxes.length === 0) {
+        showMessage('请先选择要保存为模板的规则', 'info');
+        return;
+    }
+
+    // 创建保存模板的对话框
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.minWidth = '300px';
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">保存为模板</h3>' +
+        '<p>请输入模板名称：</p>' +
+        '<div style="padding: 10px; margin: 15px 0;">' +
+        '<input type="text" id="templateName" placeholder="请输入模板名称" style="width: 100%; padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
+        '<label style="display: block; margin-top: 10px;"><input type="checkbox" id="templateSnapshot"> 保存规则的私有副本（之后修改或删除规则不影响模板）</label>' +
+        '</div>' +
+        '<div style="display: flex; justify-content: flex-end; gap: 10px;">' +
+        '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
+        '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #3498db; color: white; cursor: pointer;">确定</button>' +
+        '</div>';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    document.getElementById('cancelBtn').addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    document.getElementById('confirmBtn').addEventListener('click', function() {
+        const templateName = document.getElementById('templateName').value.trim();
+        const snapshot = document.getElementById('templateSnapshot').checked;
+        if (templateName !== '') {
+            const selectedIds = Array.from(selectedCheckboxes).map(cb => cb.dataset.id);
+            fetch('api/saveAsTemplate', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    name: templateName,
+                    ids: selectedIds,
+                    snapshot: snapshot
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    loadTemplates();
+                    showMessage('模板保存成功', 'success');
+                }
+            })
+            .catch(error => {
+                console.error('Failed to save template:', error);
+                showMessage('模板保存失败', 'error');
+            });
+        }
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+
+    overlay.addEventListener('click', function() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    });
+}
+
+// 应用模板
+function applyTemplate() {
+    const templateSelect = document.getElementById('templateSelect');
+    const templateName = templateSelect.value;
+    if (!templateName) {
+        showMessage('请先选择要应用的模板', 'info');
+        return;
+    }
+
+    // 切换到模板记录
+    fetch('api/applyTemplate', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ name: templateName })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            // 显示模板中的规则
+            renderTemplateRules({ name: templateName, rules: data.rules, private: data.private });
+            showMessage('已切换到模板：' + templateName, 'success');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to get template:', error);
+    });
+}
+
+// 把模板中的规则转为私有副本，或把私有副本加入全局规则列表
+function setTemplateRuleScope(templateName, ruleId, isPrivate) {
+    fetch('api/updateTemplateRuleScope', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ name: templateName, ruleId: ruleId, private: isPrivate })
+    })
+    .then(response => {
+        if (!response.ok) {
+            return response.json().then(data => { throw new Error(data.error || response.statusText); });
+        }
+        return response.json();
+    })
+    .then(() => {
+        showMessage(isPrivate ? '已转为模板私有副本' : '已加入全局规则列表', 'success');
+        applyTemplateByName(templateName);
+    })
+    .catch(error => {
+        showMessage('操作失败: ' + error.message, 'error');
+    });
+}
+
+// 渲染模板规则
+function renderTemplateRules(template) {
+    const rulesList = document.getElementById('rulesList');
+    rulesList.innerHTML = '';
+
+    if (template.rules.length === 0) {
+        rulesList.innerHTML = '<p style="text-align: center; color: #999; padding: 20px;">模板中暂无规则</p>';
+        return;
+    }
+
+    // 模板私有副本的ID（/api/applyTemplate 返回 private，/api/getTemplates 返回 snapshots）
+    const privateIds = template.private || (template.snapshots || []).map(r => r.id);
+
+    // 按照规则的seq字段倒序排序
+    const sortedRules = template.rules.sort((a, b) => {
+        return (b.seq || 0) - (a.seq || 0);
+    });
+
+    sortedRules.forEach((rule, index) => {
+        const ruleItem = document.createElement('div');
+        ruleItem.className = 'rule-item';
+        ruleItem.dataset.id = rule.id;
+
+        // 检查TCP和UDP状态
+        Promise.all([
+            fetch('api/isTCPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort)).then(r => r.json()),
+            fetch('api/isUDPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort)).then(r => r.json())
+        ]).then(function(results) {
+            const tcpResult = results[0];
+            const udpResult = results[1];
+            const tcpRunning = tcpResult.running;
+            const udpRunning = udpResult.running;
+
+            // 确保seq字段存在
+            const seq = rule.seq || 0;
+            ruleItem.innerHTML = '<input type="checkbox" class="rule-checkbox" data-id="' + rule.id + '"><div style="display: flex; align-items: center;"><div class="rule-seq">' + seq + '</div><div class="rule-config"><select class="listen-addr" data-id="' + rule.id + '">' + renderIPOptions(rule.listenAddr) + '</select><input type="text" class="listen-port" data-id="' + rule.id + '" value="' + rule.listenPort + '" placeholder="端口、服务名或范围"><select class="target-addr" data-id="' + rule.id + '">' + renderTargetIPOptions(rule.targetAddr) + '</select><input type="text" class="target-port" data-id="' + rule.id + '" value="' + rule.targetPort + '" placeholder="端口、服务名或范围"></div></div><div class="rule-actions"><button class="btn ' + (tcpRunning ? 'btn-danger' : 'btn-success') + '" onclick="toggleTCPForwardFromTemplate(' + index + ', \'' + template.name + '\')">' + (tcpRunning ? '停止TCP转发' : '开启TCP转发') + '</button><button class="btn ' + (udpRunning ? 'btn-danger' : 'btn-success') + '" onclick="toggleUDPForwardFromTemplate(' + index + ', \'' + template.name + '\')">' + (udpRunning ? '停止UDP转发' : '开启UDP转发') + '</button><button class="btn btn-danger" onclick="deleteRule(\'' + rule.id + '\')">删除</button><button class="btn btn-primary" onclick="copyRuleFromTemplate(' + index + ', \'' + template.name + '\')">复制</button><button class="btn btn-warning" onclick="showQRCode(\'' + rule.listenAddr + '\', \'' + rule.listenPort + '\')">二维码</button>' +
+                (privateIds.includes(rule.id)
+                    ? '<button class="btn btn-default" title="模板私有副本，修改或删除全局规则不影响它" onclick="setTemplateRuleScope(\'' + template.name + '\', \'' + rule.id + '\', false)">私有 · 加入全局规则</button>'
+                    : '<button class="btn btn-default" title="引用全局规则，复制为模板私有副本后不再随全局规则变化" onclick="setTemplateRuleScope(\'' + template.name + '\', \'' + rule.id + '\', true)">转为私有副本</button>') +
+                '</div>';
+
+
+            rulesList.appendChild(ruleItem);
+
+            // 添加事件监听器
+            addTemplateRuleEventListeners(ruleItem, rule.id);
+        });
+    });
+}
+
+// 添加模板规则事件监听器
+function addTemplateRuleEventListeners(ruleItem, ruleId) {
+    // 监听地址变化
+    const listenAddrSelect = ruleItem.querySelector('.listen-addr[data-id="' + ruleId + '"]');
+    if (listenAddrSelect) {
+        listenAddrSelect.addEventListener('change', function() {
+            // 监听地址没有自定义选项
+        });
+    }
+
+    // 目标地址变化
+    const targetAddrSelect = ruleItem.querySelector('.target-addr[data-id="' + ruleId + '"]');
+    if (targetAddrSelect) {
+        targetAddrSelect.addEventListener('change', function() {
+            if (this.value === 'custom') {
+                // 创建自定义输入框
+                const customInput = document.createElement('input');
+                customInput.type = 'text';
+                customInput.className = 'target-addr-custom';
+                customInput.placeholder = '请输入自定义IP地址';
+                customInput.style.marginLeft = '10px';
+                customInput.style.padding = '6px 10px';
+                customInput.style.border = '1px solid #ddd';
+                customInput.style.borderRadius = '4px';
+                customInput.style.fontSize = '14px';
+
+                // 替换选择框为输入框
+                const parent = this.parentElement;
+                parent.replaceChild(customInput, this);
+
+                // 聚焦到输入框
+                customInput.focus();
+
+                // 监听输入框变化
+                customInput.addEventListener('change', function() {
+                    if (this.value) {
+                        // 更新规则
+                        const ruleItem = this.closest('.rule-item');
+                        const listenAddr = ruleItem.querySelector('.listen-addr').value;
+                        const listenPort = ruleItem.querySelector('.listen-port').value;
+                        const targetPort = ruleItem.querySelector('.target-port').value;
+
+                        fetch('api/updateRule', {
+                            method: 'POST',
+                            headers: {
+                                'Content-Type': 'application/json'
+                            },
+                            body: JSON.stringify({
+                                id: ruleId,
+                                listenAddr: listenAddr,
+                                listenPort: listenPort,
+                                targetAddr: this.value,
+                                targetPort: targetPort
+                            })
+                        })
+                        .then(response => response.json())
+                        .then(data => {
+                            if (data.success) {
+                                // 重新加载模板规则
+                                const templateSelect = document.getElementById('templateSelect');
+                                const templateName = templateSelect.value;
+                                if (templateName !== 'default') {
+                                    fetch('api/getTemplates')
+                                        .then(response => response.json())
+                                        .then(data => {
+                                            const template = data.find(t => t.name === templateName);
+                                            if (template) {
+                                                renderTemplateRules(template);
+                                            }
+                                        });
+                                }
+                            }
+                        });
+                    } else {
+                        // 如果输入框为空，恢复选择框
+                        parent.replaceChild(targetAddrSelect, this);
+                    }
+                });
+            }
+        });
+    }
+}
+
+// 从模板切换TCP转发
+function toggleTCPForwardFromTemplate(index, templateName) {
+    // 通过模板名称获取模板对象
+    fetch('api/getTemplates')
+        .then(response => response.json())
+        .then(data => {
+            const template = data.find(t => t.name === templateName);
+            if (template) {
+                const rule = template.rules[index];
+
+                // 检查当前状态
+                fetch('api/isTCPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort))
+                    .then(function(response) { return response.json(); })
+                    .then(function(data) {
+                        if (data.running) {
+                            // 停止TCP转发
+                            fetch('api/stopTCPForward', {
+                                method: 'POST',
+                                headers: {
+                                    'Content-Type': 'application/json'
+                                },
+                                body: JSON.stringify({
+                                    listenAddr: rule.listenAddr,
+                                    listenPort: rule.listenPort
+                                })
+                            })
+                            .then(function(response) { return response.json(); })
+                            .then(function(result) {
+                                if (result.success) {
+                                    showMessage('TCP转发已停止', 'success');
+                                    const templateSelect = document.getElementById('templateSelect');
+                                    const templateName = templateSelect.value;
+                                    if (templateName !== 'default') {
+                                        fetch('api/getTemplates')
+                                            .then(response => response.json())
+                                            .then(data => {
+                                                const template = data.find(t => t.name === templateName);
+                                                if (template) {
+                                                    renderTemplateRules(template);
+                                                }
+                                            });
+                                    }
+                                } else {
+                                    showMessage('停止TCP转发失败: ' + result.error, 'error');
+                                }
+                            });
+                        } else {
+                            // 启动TCP转发
+                            fetch('api/startTCPForward', {
+                                method: 'POST',
+                                headers: {
+                                    'Content-Type': 'application/json'
+                                },
+                                body: JSON.stringify({
+                                    listenAddr: rule.listenAddr,
+                                    listenPort: rule.listenPort,
+                                    targetAddr: rule.targetAddr,
+                                    targetPort: rule.targetPort
+                                })
+                            })
+                            .then(function(response) { return response.json(); })
+                            .then(function(result) {
+                                if (result.success) {
+                                    showMessage('TCP转发已启动', 'success');
+                                    const templateSelect = document.getElementById('templateSelect');
+                                    const templateName = templateSelect.value;
+                                    if (templateName !== 'default') {
+                                        fetch('api/getTemplates')
+                                            .then(response => response.json())
+                                            .then(data => {
+                                                const template = data.find(t => t.name === templateName);
+                                                if (template) {
+                                                    renderTemplateRules(template);
+                                                }
+                                            });
+                                    }
+                                } else {
+                                    showMessage('启动TCP转发失败: ' + result.error, 'error');
+                                }
+                            });
+                        }
+                    });
+            }
+        });
+}
+
+// 从模板切换UDP转发
+function toggleUDPForwardFromTemplate(index, templateName) {
+    // 通过模板名称获取模板对象
+    fetch('api/getTemplates')
+        .then(response => response.json())
+        .then(data => {
+            const template = data.find(t => t.name === templateName);
+            if (template) {
+                const rule = template.rules[index];
+
+                // 检查当前状态
+                fetch('api/isUDPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort))
+                    .then(function(response) { return response.json(); })
+                    .then(function(data) {
+                        if (data.running) {
+                            // 停止UDP转发
+                            fetch('api/stopUDPForward', {
+                                method: 'POST',
+                                headers: {
+                                    'Content-Type': 'application/json'
+                                },
+                                body: JSON.stringify({
+                                    listenAddr: rule.listenAddr,
+                                    listenPort: rule.listenPort
+                                })
+                            })
+                            .then(function(response) { return response.json(); })
+                            .then(function(result) {
+                                if (result.success) {
+                                    showMessage('UDP转发已停止', 'success');
+                                    const templateSelect = document.getElementById('templateSelect');
+                                    const templateName = templateSelect.value;
+                                    if (templateName !== 'default') {
+                                        fetch('api/getTemplates')
+                                            .then(response => response.json())
+                                            .then(data => {
+                                                const template = data.find(t => t.name === templateName);
+                                                if (template) {
+                                                    renderTemplateRules(template);
+                                                }
+                                            });
+                                    }
+                                } else {
+                                    showMessage('停止UDP转发失败: ' + result.error, 'error');
+                                }
+                            });
+                        } else {
+                            // 启动UDP转发
+                            fetch('api/startUDPForward', {
+                                method: 'POST',
+                                headers: {
+                                    'Content-Type': 'application/json'
+                                },
+                                body: JSON.stringify({
+                                    listenAddr: rule.listenAddr,
+                                    listenPort: rule.listenPort,
+                                    targetAddr: rule.targetAddr,
+                                    targetPort: rule.targetPort
+                                })
+                            })
+                            .then(function(response) { return response.json(); })
+                            .then(function(result) {
+                                if (result.success) {
+                                    showMessage('UDP转发已启动', 'success');
+                                    const templateSelect = document.getElementById('templateSelect');
+                                    const templateName = templateSelect.value;
+                                    if (templateName !== 'default') {
+                                        fetch('api/getTemplates')
+                                            .then(response => response.json())
+                                            .then(data => {
+                                                const template = data.find(t => t.name === templateName);
+                                                if (template) {
+                                                    renderTemplateRules(template);
+                                                }
+                                            });
+                                    }
+                                } else {
+                                    showMessage('启动UDP转发失败: ' + result.error, 'error');
+                                }
+                            });
+                        }
+                    });
+            }
+        });
+}
+
+// 渲染目标IP选项
+function renderTargetIPOptions(selectedAddr) {
+    let options = '<option value="">选择目标IP</option>';
+    if (window.localIPs) {
+        window.localIPs.forEach(function(ipInfo) {
+            const selected = ipInfo.ip === selectedAddr ? 'selected' : '';
+            options += '<option value="' + ipInfo.ip + '" ' + selected + '>' + ipInfo.ip + ' (' + ipInfo.name + ')</option>';
+        });
+    }
+    // 局域网扫描发现的设备
+    if (window.lanHosts) {
+        window.lanHosts.forEach(function(host) {
+            const selected = host.ip === selectedAddr ? 'selected' : '';
+            const label = host.hostname || host.vendor || host.mac || '局域网设备';
+            options += '<option value="' + host.ip + '" ' + selected + '>' + host.ip + ' (' + label + ')</option>';
+        });
+    }
+    // 检查是否是自定义IP
+    const isCustom = selectedAddr && (!window.localIPs || !window.localIPs.some(function(ipInfo) { return ipInfo.ip === selectedAddr; })) &&
+        (!window.lanHosts || !window.lanHosts.some(function(host) { return host.ip === selectedAddr; }));
+    if (isCustom) {
+        options += '<option value="' + selectedAddr + '" selected>' + selectedAddr + '</option>';
+    } else {
+        options += '<option value="custom">自定义</option>';
+    }
+    return options;
+}
+
+// 一键开启此模板所有转发
+function startTemplateForward() {
+    const templateSelect = document.getElementById('templateSelect');
+    const templateName = templateSelect.value;
+    if (!templateName) {
+        showMessage('请先选择要开启的模板', 'info');
+        return;
+    }
+
+    // 先检查模板中每条规则能否启动，有问题时让用户确认
+    fetch('api/validateTemplate?name=' + encodeURIComponent(templateName))
+        .then(response => response.ok ? response.json() : null)
+        .then(report => {
+            if (report && !report.ok) {
+                const lines = [];
+                report.rules.filter(rule => !rule.ok).forEach(rule => {
+                    const problems = (rule.problems || []).slice();
+                    (rule.ports || []).filter(port => !port.ok).forEach(port => {
+                        problems.push(port.error + (port.suggestedPort ? '（建议端口 ' + port.suggestedPort + '）' : ''));
+                    });
+                    lines.push((rule.name || rule.ruleId) + ': ' + problems.join('; '));
+                });
+                if (!confirm('以下规则可能无法启动：\n\n' + lines.join('\n') + '\n\n仍然继续开启？')) {
+                    return;
+                }
+            }
+            doStartTemplateForward(templateName);
+        });
+}
+
+function doStartTemplateForward(templateName) {
+    fetch('api/startTemplateForward', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ name: templateName })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            if (templateName && templateName !== 'default') {
+                // 当前在模板视图中，重新渲染模板规则以更新状态
+                fetch('api/getTemplates')
+                    .then(response => response.json())
+                    .then(data => {
+                        const template = data.find(t => t.name === templateName);
+                        if (template) {
+                            renderTemplateRules(template);
+                        }
+                    });
+            } else {
+                // 当前在所有记录视图中，加载所有规则
+                loadRules();
+            }
+            showMessage(data.sequenced ? '模板转发正在按启动顺序开启' : '模板转发已开启', 'success');
+        } else if (data.error) {
+            showMessage(data.error, 'error');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to start template forward:', error);
+    });
+}
+
+// 一键关闭此模板所有转发
+function stopTemplateForward() {
+    const templateSelect = document.getElementById('templateSelect');
+    const templateName = templateSelect.value;
+    if (!templateName) {
+        showMessage('请先选择要关闭的模板', 'info');
+        return;
+    }
+
+    fetch('api/stopTemplateForward', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ name: templateName })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            if (templateName && templateName !== 'default') {
+                // 当前在模板视图中，重新渲染模板规则以更新状态
+                fetch('api/getTemplates')
+                    .then(response => response.json())
+                    .then(data => {
+                        const template = data.find(t => t.name === templateName);
+                        if (template) {
+                            renderTemplateRules(template);
+                        }
+                    });
+            } else {
+                // 当前在所有记录视图中，加载所有规则
+                loadRules();
+            }
+            showMessage('模板转发已关闭', 'success');
+        }
+    })
+    .catch(error => {
+        console.error('Failed to stop template forward:', error);
+    });
+}
+
+// 删除此模板
+function deleteTemplate() {
+    const templateSelect = document.getElementById('templateSelect');
+    const templateName = templateSelect.value;
+    if (!templateName) {
+        showMessage('请先选择要删除的模板', 'info');
+        return;
+    }
+
+    if (confirm('确定要删除此模板吗？删除后将无法恢复。')) {
+        fetch('api/deleteTemplate', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ name: templateName })
+        })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                // 重新加载模板列表
+                loadTemplates();
+                // 显示所有规则
+                loadRules();
+                showMessage('模板删除成功', 'success');
+            }
+        })
+        .catch(error => {
+            console.error('Failed to delete template:', error);
+            showMessage('模板删除失败', 'error');
+        });
+    }
+}
+
+// 切换TCP转发
+function toggleTCPForward(index) {
+    const rule = rules[index];
+    
+    // 检查当前状态
+    fetch('api/isTCPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort))
+        .then(function(response) { return response.json(); })
+        .then(function(data) {
+            if (data.running) {
+                // 停止TCP转发
+                fetch('api/stopTCPForward', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        listenAddr: rule.listenAddr,
+                        listenPort: rule.listenPort
+                    })
+                })
+                .then(function(response) { return response.json(); })
+                .then(function(result) {
+                    if (result.success) {
+                        showMessage('TCP转发已停止', 'success');
+                        loadRules();
+                    } else {
+                        showMessage('停止TCP转发失败: ' + result.error, 'error');
+                    }
+                });
+            } else {
+                // 启动TCP转发
+                fetch('api/startTCPForward', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        listenAddr: rule.listenAddr,
+                        listenPort: rule.listenPort,
+                        targetAddr: rule.targetAddr,
+                        targetPort: rule.targetPort
+                    })
+                })
+                .then(function(response) { return response.json(); })
+                .then(function(result) {
+                    if (result.success) {
+                        showMessage('TCP转发已启动', 'success');
+                        loadRules();
+                    } else {
+                        showMessage('启动TCP转发失败: ' + result.error, 'error');
+                        offerSuggestedPort(rule, result);
+                    }
+                });
+            }
+        });
+}
+
+// 切换UDP转发
+function toggleUDPForward(index) {
+    const rule = rules[index];
+    
+    // 检查当前状态
+    fetch('api/isUDPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort))
+        .then(function(response) { return response.json(); })
+        .then(function(data) {
+            if (data.running) {
+                // 停止UDP转发
+                fetch('api/stopUDPForward', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        listenAddr: rule.listenAddr,
+                        listenPort: rule.listenPort
+                    })
+                })
+                .then(function(response) { return response.json(); })
+                .then(function(result) {
+                    if (result.success) {
+                        showMessage('UDP转发已停止', 'success');
+                        loadRules();
+                    } else {
+                        showMessage('停止UDP转发失败: ' + result.error, 'error');
+                    }
+                });
+            } else {
+                // 启动UDP转发
+                fetch('api/startUDPForward', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        listenAddr: rule.listenAddr,
+                        listenPort: rule.listenPort,
+                        targetAddr: rule.targetAddr,
+                        targetPort: rule.targetPort
+                    })
+                })
+                .then(function(response) { return response.json(); })
+                .then(function(result) {
+                    if (result.success) {
+                        showMessage('UDP转发已启动', 'success');
+                        loadRules();
+                    } else {
+                        showMessage('启动UDP转发失败: ' + result.error, 'error');
+                        offerSuggestedPort(rule, result);
+                    }
+                });
+            }
+        });
+}
+
+// 切换SCTP转发
+function toggleSCTPForward(index) {
+    const rule = rules[index];
+    
+    // 检查当前状态
+    fetch('api/isSCTPRunning?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort) + '&targetAddr=' + encodeURIComponent(rule.targetAddr) + '&targetPort=' + encodeURIComponent(rule.targetPort))
+        .then(function(response) { return response.json(); })
+        .then(function(data) {
+            if (data.running) {
+                // 停止SCTP转发
+                fetch('api/stopSCTPForward', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        listenAddr: rule.listenAddr,
+                        listenPort: rule.listenPort
+                    })
+                })
+                .then(function(response) { return response.json(); })
+                .then(function(result) {
+                    if (result.success) {
+                        showMessage('SCTP转发已停止', 'success');
+                        loadRules();
+                    } else {
+                        showMessage('停止SCTP转发失败: ' + result.error, 'error');
+                    }
+                });
+            } else {
+                // 启动SCTP转发
+                fetch('api/startSCTPForward', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({
+                        listenAddr: rule.listenAddr,
+                        listenPort: rule.listenPort,
+                        targetAddr: rule.targetAddr,
+                        targetPort: rule.targetPort
+                    })
+                })
+                .then(function(response) { return response.json(); })
+                .then(function(result) {
+                    if (result.success) {
+                        showMessage('SCTP转发已启动', 'success');
+                        loadRules();
+                    } else {
+                        showMessage('启动SCTP转发失败: ' + result.error, 'error');
+                        offerSuggestedPort(rule, result);
+                    }
+                });
+            }
+        });
+}
+
+// 转义 HTML 特殊字符
+function escapeHTML(text) {
+    return String(text).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;').replace(/'/g, '&#39;');
+}
+
+// 拼接 addr:port，IPv6 地址加方括号
+function hostPort(addr, port) {
+    return (String(addr).indexOf(':') >= 0 ? '[' + addr + ']' : addr) + ':' + port;
+}
+
+// 访问控制按钮的提示文字
+function aclTitle(rule) {
+    const parts = [];
+    if (rule.allowCidrs) {
+        parts.push('允许: ' + rule.allowCidrs.join(', '));
+    }
+    if (rule.denyCidrs) {
+        parts.push('拒绝: ' + rule.denyCidrs.join(', '));
+    }
+    return parts.length ? parts.join('；') : '按来源IP/CIDR允许或拒绝连接';
+}
+
+// 编辑规则的访问控制列表
+function editACL(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const allow = prompt('仅允许以下来源（IP或CIDR，逗号分隔，留空不限制）：', (rule.allowCidrs || []).join(', '));
+    if (allow === null) {
+        return;
+    }
+    const deny = prompt('拒绝以下来源（IP或CIDR，逗号分隔，优先于允许列表）：', (rule.denyCidrs || []).join(', '));
+    if (deny === null) {
+        return;
+    }
+    const split = s => s.split(',').map(x => x.trim()).filter(x => x);
+
+    fetch('api/updateACL', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, allow: split(allow), deny: split(deny) })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('访问控制已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新访问控制失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 负载均衡按钮的提示文字
+function targetsTitle(rule) {
+    if (!rule.targets) {
+        return '添加更多目标，新的TCP连接在各目标之间分配';
+    }
+    const method = rule.balance === 'leastconn' ? '最少连接' : '轮询';
+    return method + ': ' + [hostPort(rule.targetAddr, rule.targetPort)].concat(rule.targets).join(', ');
+}
+
+// 编辑规则的额外目标与负载均衡方式（仅TCP）
+function editTargets(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const targets = prompt('除主目标外的其他目标（addr:port，逗号分隔，留空只使用主目标）：', (rule.targets || []).join(', '));
+    if (targets === null) {
+        return;
+    }
+    const leastConn = confirm('按最少连接分配新连接？\n确定：最少连接；取消：轮询');
+
+    fetch('api/updateTargets', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            targets: targets.split(',').map(x => x.trim()).filter(x => x),
+            balance: leastConn ? 'leastconn' : 'roundrobin'
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('负载均衡已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新负载均衡失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 路由表的文字形式：主机名=目标，字节匹配写作 hex:十六进制=目标，逗号分隔
+function routesText(routes) {
+    return (routes || []).map(r => (r.prefix ? 'hex:' + r.prefix : r.host) + '=' + r.target).join(', ');
+}
+
+// 编辑规则的路由表（仅TCP），把一个监听端口按 SNI/Host 分发到不同目标
+function editRoutes(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const text = prompt('路由表（主机名=addr:port，逗号分隔，按顺序匹配 TLS SNI 或 HTTP Host，支持 *.example.com；hex:5353482d=addr:port 按开头的字节匹配；都不匹配时使用规则的目标，留空关闭）：', routesText(rule.routes));
+    if (text === null) {
+        return;
+    }
+    const routes = text.split(',').map(x => x.trim()).filter(x => x).map(item => {
+        const i = item.lastIndexOf('=');
+        const match = i < 0 ? item : item.slice(0, i).trim();
+        const target = i < 0 ? '' : item.slice(i + 1).trim();
+        return match.startsWith('hex:') ? { prefix: match.slice(4), target: target } : { host: match, target: target };
+    });
+
+    fetch('api/updateRoutes', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            routes: routes
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('路由表已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新路由表失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 选择规则经哪个 SSH 跳板机连接目标，也可在这里新增跳板机
+function editSSHHost(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    fetch('api/sshHosts')
+    .then(response => response.json())
+    .then(hosts => {
+        const list = hosts.map((h, i) => (i + 1) + '. ' + (h.name ? h.name + ' ' : '') + h.user + '@' + h.addr + (h.connected ? '（已连接）' : '')).join('\n');
+        const current = hosts.findIndex(h => h.id === rule.sshHost);
+        const choice = prompt((list ? list + '\n\n' : '') + 'SSH 跳板机（输入编号选择，new 新增，留空直接连接目标）：', current >= 0 ? String(current + 1) : '');
+        if (choice === null) {
+            return;
+        }
+        if (choice.trim().toLowerCase() === 'new') {
+            addSSHHost(ruleId);
+            return;
+        }
+        let sshHost = '';
+        if (choice.trim() !== '') {
+            const host = hosts[parseInt(choice, 10) - 1];
+            if (!host) {
+                showMessage('没有编号为 ' + choice + ' 的跳板机', 'error');
+                return;
+            }
+            sshHost = host.id;
+        }
+        setRuleSSHHost(ruleId, sshHost);
+    });
+}
+
+// 新增 SSH 跳板机并让规则使用它。私钥是多行文本，需要通过 API 设置
+function addSSHHost(ruleId) {
+    const addr = prompt('跳板机地址（host:port）：', ':22');
+    if (addr === null) {
+        return;
+    }
+    const user = prompt('SSH 用户名：', 'root');
+    if (user === null) {
+        return;
+    }
+    const password = prompt('SSH 密码（加密保存）：', '');
+    if (password === null) {
+        return;
+    }
+    const hostKey = prompt('主机密钥指纹（SHA256:...，留空则信任首次连接时的密钥）：', '');
+    if (hostKey === null) {
+        return;
+    }
+
+    fetch('api/updateSSHHost', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            addr: addr.trim(),
+            user: user.trim(),
+            password: password,
+            hostKey: hostKey.trim()
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            setRuleSSHHost(ruleId, result.sshHost.id);
+        } else {
+            showMessage('添加跳板机失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 保存规则使用的 SSH 跳板机，为空时直接连接目标
+function setRuleSSHHost(ruleId, sshHost) {
+    fetch('api/updateRuleSSHHost', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            sshHost: sshHost
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage(sshHost ? '已设置 SSH 跳板机' : '已改为直接连接目标', 'success');
+            loadRules();
+        } else {
+            showMessage('设置 SSH 跳板机失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 选择规则依次经过的中继节点（客户端 -> 节点 A -> 节点 B -> 目标），也可在这里新增节点
+function editRuleVia(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    fetch('api/relayNodes')
+    .then(response => response.json())
+    .then(nodes => {
+        const list = nodes.map((n, i) => (i + 1) + '. ' + (n.name ? n.name + ' ' : '') + n.addr).join('\n');
+        const current = (rule.via || []).map(id => nodes.findIndex(n => n.id === id) + 1).filter(i => i > 0).join(',');
+        const choice = prompt((list ? list + '\n\n' : '') + '中继节点（按经过的顺序输入编号，逗号分隔；new 新增，留空直接连接目标）：', current);
+        if (choice === null) {
+            return;
+        }
+        if (choice.trim().toLowerCase() === 'new') {
+            addRelayNode(ruleId);
+            return;
+        }
+        const via = [];
+        for (const part of choice.split(',').map(s => s.trim()).filter(Boolean)) {
+            const node = nodes[parseInt(part, 10) - 1];
+            if (!node) {
+                showMessage('没有编号为 ' + part + ' 的中继节点', 'error');
+                return;
+            }
+            via.push(node.id);
+        }
+        setRuleVia(ruleId, via);
+    });
+}
+
+// 新增中继节点（对方以 -relay-listen 与 -relay-token 启动）并让规则经过它
+function addRelayNode(ruleId) {
+    const addr = prompt('中继节点地址（对方的 -relay-listen，host:port）：', '');
+    if (addr === null) {
+        return;
+    }
+    const token = prompt('中继节点令牌（对方的 -relay-token，加密保存）：', '');
+    if (token === null) {
+        return;
+    }
+    const rule = rules.find(r => r.id === ruleId);
+
+    fetch('api/updateRelayNode', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            addr: addr.trim(),
+            token: token
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            setRuleVia(ruleId, (rule.via || []).concat(result.relayNode.id));
+        } else {
+            showMessage('添加中继节点失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 保存规则经过的中继节点，为空时直接连接目标
+function setRuleVia(ruleId, via) {
+    fetch('api/updateRuleVia', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            via: via
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage(via.length ? '已设置中继节点' : '已改为直接连接目标', 'success');
+            loadRules();
+        } else {
+            showMessage('设置中继节点失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 编辑规则的健康检查，先显示各目标当前的健康状态
+function editHealth(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.health || {};
+    fetch('api/getHealth?ruleId=' + encodeURIComponent(ruleId))
+    .then(response => response.json())
+    .then(report => {
+        let status = '';
+        if (current.enabled) {
+            status = report.targets.map(t =>
+                (t.backup ? '[备用] ' : '') + t.target + ': ' +
+                (!t.checked ? '未检查' : (t.up ? '正常 ' + t.latencyMs + 'ms' : '不可用 ' + (t.lastError || '')))
+            ).join('\n') + '\n\n';
+        }
+        const type = prompt(status + '检查方式（tcp/http/https，留空关闭健康检查）：', current.enabled ? (current.type || 'tcp') : '');
+        if (type === null) {
+            return;
+        }
+        let health = null;
+        if (type.trim()) {
+            health = Object.assign({}, current, { enabled: true, type: type.trim() });
+            if (health.type !== 'tcp') {
+                const path = prompt('HTTP 检查路径：', current.httpPath || '/');
+                if (path === null) {
+                    return;
+                }
+                health.httpPath = path.trim();
+            }
+            const backup = prompt('所有目标都不可用时的备用目标（addr:port，留空不使用）：',
+                current.backupAddr ? hostPort(current.backupAddr, current.backupPort) : '');
+            if (backup === null) {
+                return;
+            }
+            const sep = backup.trim().lastIndexOf(':');
+            health.backupAddr = sep > 0 ? backup.trim().slice(0, sep) : '';
+            health.backupPort = sep > 0 ? backup.trim().slice(sep + 1) : '';
+        }
+
+        return fetch('api/updateHealthCheck', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ ruleId: ruleId, health: health })
+        })
+        .then(response => response.json())
+        .then(result => {
+            if (result.success) {
+                showMessage(health ? '健康检查已更新' : '健康检查已关闭', 'success');
+                loadRules();
+            } else {
+                showMessage('更新健康检查失败: ' + result.error, 'error');
+            }
+        });
+    });
+}
+
+// 编辑规则连接目标失败时的重试（仅TCP）
+function editDialRetry(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.retry || {};
+    const attempts = prompt('连接目标失败后的重试次数（0 为不重试）：', current.attempts || 0);
+    if (attempts === null) {
+        return;
+    }
+    const hold = prompt('保持客户端连接等待目标恢复的最长秒数（大于0时一直重试到超时，0 为不等待）：', current.holdSeconds || 0);
+    if (hold === null) {
+        return;
+    }
+    const backoff = prompt('首次重试前等待的毫秒数（之后每次翻倍）：', current.backoffMs || 200);
+    if (backoff === null) {
+        return;
+    }
+
+    fetch('api/updateDialRetry', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            retry: {
+                attempts: parseInt(attempts) || 0,
+                holdSeconds: parseInt(hold) || 0,
+                backoffMs: parseInt(backoff) || 0,
+                maxBackoffMs: current.maxBackoffMs || 0
+            }
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('重试设置已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新重试设置失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// TCP选项按钮的提示文字
+function tcpTuningTitle(rule) {
+    const t = rule.tcpTuning;
+    if (!t) {
+        return '设置两侧连接的保活、TCP_NODELAY 与连接目标的超时';
+    }
+    const parts = [];
+    if (t.keepAlive < 0) {
+        parts.push('不保活');
+    } else if (t.keepAlive) {
+        parts.push('保活间隔 ' + t.keepAlive + '秒');
+    }
+    if (t.noDelay === false) {
+        parts.push('关闭 TCP_NODELAY');
+    }
+    if (t.dialTimeout) {
+        parts.push('连接超时 ' + t.dialTimeout + '秒');
+    }
+    return parts.join(', ');
+}
+
+// 编辑规则两侧TCP连接的保活、TCP_NODELAY 与连接目标的超时（TCP/SOCKS5）
+function editTCPTuning(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.tcpTuning || {};
+    const keepAlive = prompt('TCP 保活探测间隔秒数（0 为系统默认，-1 为关闭保活）：', current.keepAlive || 0);
+    if (keepAlive === null) {
+        return;
+    }
+    const noDelay = prompt('TCP_NODELAY（1 为开启，立即发送小包；0 为关闭，启用 Nagle 算法合并小包）：', current.noDelay === false ? 0 : 1);
+    if (noDelay === null) {
+        return;
+    }
+    const dialTimeout = prompt('连接目标的超时秒数（0 为默认）：', current.dialTimeout || 0);
+    if (dialTimeout === null) {
+        return;
+    }
+
+    fetch('api/updateTCPTuning', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            tcp: {
+                keepAlive: parseInt(keepAlive) || 0,
+                noDelay: noDelay.trim() === '0' ? false : null,
+                dialTimeout: parseInt(dialTimeout) || 0
+            }
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('TCP选项已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新TCP选项失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 编辑规则连接目标时使用的出接口与源地址（TCP/UDP/SOCKS5），先列出本机网卡供参考
+function editOutboundBind(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.bind || {};
+    fetch('api/getLocalIPs')
+    .then(response => response.json())
+    .then(ips => {
+        const list = ips.filter(ip => ip.name).map(ip => ip.name + ': ' + ip.ip).join('\n');
+        const iface = prompt((list ? list + '\n\n' : '') + '出接口名（如 wg0，留空按系统路由）：', current.interface || '');
+        if (iface === null) {
+            return;
+        }
+        const sourceIp = prompt('源地址（留空由系统选择）：', current.sourceIp || '');
+        if (sourceIp === null) {
+            return;
+        }
+
+        fetch('api/updateOutboundBind', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({
+                ruleId: ruleId,
+                bind: {
+                    interface: iface.trim(),
+                    sourceIp: sourceIp.trim()
+                }
+            })
+        })
+        .then(response => response.json())
+        .then(result => {
+            if (result.success) {
+                showMessage('出接口已更新', 'success');
+                loadRules();
+            } else {
+                showMessage('更新出接口失败: ' + result.error, 'error');
+            }
+        });
+    });
+}
+
+// 开启或停止规则的抓包，开启时覆盖之前的抓包文件
+function toggleCapture(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.capture || {};
+    const enabled = !current.enabled;
+    if (enabled && rule.capture && !confirm('重新开始抓包会覆盖之前的抓包文件，确定吗？')) {
+        return;
+    }
+
+    fetch('api/updateCapture', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            capture: {
+                enabled: enabled,
+                format: current.format || '',
+                maxMB: current.maxMB || 0
+            }
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage(enabled ? '已开启抓包，转发的数据写入 db/captures 目录' : '已停止抓包，可以下载抓包文件', 'success');
+            loadRules();
+        } else {
+            showMessage('更新抓包设置失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 下载规则的抓包文件
+function downloadCapture(ruleId) {
+    fetch('api/downloadCapture?ruleId=' + encodeURIComponent(ruleId))
+        .then(response => {
+            if (!response.ok) {
+                return response.json().then(data => { throw new Error(data.error || response.statusText); });
+            }
+            const disposition = response.headers.get('Content-Disposition') || '';
+            const match = disposition.match(/filename="([^"]+)"/);
+            return response.blob().then(blob => ({ blob: blob, name: match ? match[1] : 'goports-capture.pcap' }));
+        })
+        .then(file => {
+            const link = document.createElement('a');
+            link.href = URL.createObjectURL(file.blob);
+            link.download = file.name;
+            link.click();
+            URL.revokeObjectURL(link.href);
+        })
+        .catch(error => {
+            showMessage('下载抓包文件失败: ' + error.message, 'error');
+        });
+}
+
+// 超时按钮的提示文字
+function connLimitsTitle(rule) {
+    if (!rule.idleTimeout && !rule.maxLifetime && !rule.udpTimeout) {
+        return '关闭空闲或存活过久的连接';
+    }
+    return '空闲超时: ' + (rule.idleTimeout ? rule.idleTimeout + '秒' : '不限') +
+        ', 最长存活: ' + (rule.maxLifetime ? rule.maxLifetime + '秒' : '不限') +
+        ', UDP 会话: ' + (rule.udpTimeout || 120) + '秒';
+}
+
+// 编辑规则的连接空闲超时与最长存活时间
+function editConnLimits(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const idle = prompt('连接空闲超时秒数（两个方向都没有数据超过该时间时关闭，0 为不限制）：', rule.idleTimeout || 0);
+    if (idle === null) {
+        return;
+    }
+    const lifetime = prompt('连接最长存活秒数（0 为不限制）：', rule.maxLifetime || 0);
+    if (lifetime === null) {
+        return;
+    }
+    const udpTimeout = prompt('UDP 会话空闲超时秒数（QUIC 等长连接应大于其保活间隔，0 为默认 120 秒）：', rule.udpTimeout || 0);
+    if (udpTimeout === null) {
+        return;
+    }
+
+    fetch('api/updateConnLimits', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            ruleId: ruleId,
+            idleTimeout: parseInt(idle) || 0,
+            maxLifetime: parseInt(lifetime) || 0,
+            udpTimeout: parseInt(udpTimeout) || 0
+        })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('超时设置已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新超时设置失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 编辑规则的同时连接数上限
+function editMaxConns(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const value = prompt('同时连接数上限（所有协议与端口合计，超出的新连接会被立即关闭，0 为不限制）：', rule.maxConns || 0);
+    if (value === null) {
+        return;
+    }
+
+    fetch('api/updateMaxConns', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, maxConns: parseInt(value) || 0 })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('连接上限已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新连接上限失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 编辑规则无流量自动停止的分钟数
+function editAutoStop(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const value = prompt('连续多少分钟没有流量与新连接后自动停止转发（0 为不自动停止）：', rule.autoStopMinutes || 0);
+    if (value === null) {
+        return;
+    }
+
+    fetch('api/updateAutoStop', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, minutes: parseInt(value) || 0 })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage('自动停止已更新', 'success');
+            loadRules();
+        } else {
+            showMessage('更新自动停止失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// scheduleText 把定时配置格式化为 "mon-fri 09:00-18:00; sat 10:00-14:00"
+function scheduleText(schedule) {
+    return (schedule.windows || []).map(w => (w.days && w.days !== '*' ? w.days + ' ' : '') + w.start + '-' + w.end).join('; ');
+}
+
+// 编辑规则的定时开关，时间窗口以分号分隔，留空取消定时
+function editSchedule(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const current = rule.schedule || {};
+    const text = prompt('时间窗口（本机时间，多个以分号分隔，如 "mon-fri 09:00-18:00; sat 10:00-14:00"，省略星期表示每天，留空取消定时）：', current.windows ? scheduleText(current) : '');
+    if (text === null) {
+        return;
+    }
+
+    let schedule = null;
+    if (text.trim() !== '') {
+        const windows = [];
+        for (const part of text.split(';')) {
+            const fields = part.trim().split(/\s+/).filter(f => f);
+            if (fields.length === 0) {
+                continue;
+            }
+            const range = fields.pop().split('-');
+            if (range.length !== 2) {
+                showMessage('时间窗口格式错误: ' + part.trim(), 'error');
+                return;
+            }
+            windows.push({ days: fields.join(','), start: range[0], end: range[1] });
+        }
+        const protocols = prompt('定时开关的协议（以逗号分隔，可选 tcp/udp/sctp/socks5）：', (current.protocols || ['tcp']).join(','));
+        if (protocols === null) {
+            return;
+        }
+        schedule = {
+            enabled: true,
+            windows: windows,
+            protocols: protocols.split(',').map(p => p.trim().toLowerCase()).filter(p => p)
+        };
+    }
+
+    fetch('api/updateSchedule', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, schedule: schedule })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage(schedule ? '定时已更新' : '已取消定时', 'success');
+            loadRules();
+        } else {
+            showMessage('更新定时失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 开启或关闭规则的路由器端口映射
+function togglePortMapping(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const enabled = !rule.portMapping;
+    fetch('api/updatePortMapping', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ ruleId: ruleId, enabled: enabled })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.success) {
+            showMessage(enabled ? '已开启端口映射，转发运行时会在路由器上映射端口' : '已关闭端口映射', 'success');
+            loadRules();
+        } else {
+            showMessage('更新端口映射失败: ' + result.error, 'error');
+        }
+    });
+}
+
+// 开启或关闭透明代理，开启前先检查当前环境是否支持
+function toggleTransparent(ruleId) {
+    const rule = rules.find(r => r.id === ruleId);
+    const enabled = !rule.transparent;
+    const check = enabled
+        ? fetch('api/getTransparentSupport').then(response => response.json())
+        : Promise.resolve({ supported: true });
+    check.then(support => {
+        if (!support.supported) {
+            showMessage('无法开启透明代理: ' + support.error, 'error');
+            return;
+        }
+        if (enabled && !confirm('透明代理以客户端IP连接目标，目标的回程流量必须经过本机（需配置策略路由），否则连接会失败。\n确定开启？')) {
+            return;
+        }
+        return fetch('api/updateTransparent', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ ruleId: ruleId, enabled: enabled })
+        })
+        .then(response => response.json())
+        .then(result => {
+            if (result.success) {
+                showMessage(enabled ? '透明代理已开启' : '透明代理已关闭', 'success');
+                loadRules();
+            } else {
+                showMessage('更新透明代理失败: ' + result.error, 'error');
+            }
+        });
+    });
+}
+
+// 切换SOCKS5代理
+function toggleSOCKS5Forward(index) {
+    const rule = rules[index];
+
+    fetch('api/isSOCKS5Running?listenAddr=' + encodeURIComponent(rule.listenAddr) + '&listenPort=' + encodeURIComponent(rule.listenPort))
+        .then(function(response) { return response.json(); })
+        .then(function(data) {
+            const action = data.running ? 'stop' : 'start';
+            fetch('api/' + action + 'SOCKS5Forward', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    listenAddr: rule.listenAddr,
+                    listenPort: rule.listenPort
+                })
+            })
+            .then(function(response) { return response.json(); })
+            .then(function(result) {
+                if (result.success) {
+                    showMessage(data.running ? 'SOCKS5代理已停止' : 'SOCKS5代理已启动', 'success');
+                    loadRules();
+                } else {
+                    showMessage((data.running ? '停止' : '启动') + 'SOCKS5代理失败: ' + result.error, 'error');
+                    if (!data.running) {
+                        offerSuggestedPort(rule, result);
+                    }
+                }
+            });
+        });
+}
+
+// 端口冲突时提示改用建议端口
+function offerSuggestedPort(rule, result) {
+    if (!result.suggestedPort) {
+        return;
+    }
+    if (confirm('端口 ' + rule.listenPort + ' 已被占用，是否改用可用端口 ' + result.suggestedPort + '？')) {
+        fetch('api/updateRule', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({
+                id: rule.id,
+                listenAddr: rule.listenAddr,
+                listenPort: result.suggestedPort,
+                targetAddr: rule.targetAddr,
+                targetPort: rule.targetPort
+            })
+        })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                loadRules();
+                showMessage('监听端口已改为 ' + result.suggestedPort, 'success');
+            }
+        });
+    }
+}
+
+// 显示消息
+function showMessage(message, type) {
+    const statusMessage = document.getElementById('statusMessage');
+    statusMessage.textContent = message;
+    statusMessage.className = 'status-message status-' + type;
+    statusMessage.style.display = 'block';
+
+    // 3秒后自动隐藏
+    setTimeout(() => {
+        statusMessage.style.display = 'none';
+    }, 3000);
+}
+
+// 日志区最多保留的行数
+const maxLogLines = 1000;
+let logSource = null;
+let logShown = 0; // 当前筛选条件下已显示的条数，用于向前翻页
+
+// 当前日志筛选条件的查询参数
+function logQuery() {
+    const params = new URLSearchParams();
+    const level = document.getElementById('logLevel').value;
+    const rule = document.getElementById('logRule').value;
+    if (level) params.set('level', level);
+    if (rule) params.set('rule', rule);
+    if (window.apiToken) {
+        // EventSource 无法附带请求头，通过参数传递令牌
+        params.set('token', window.apiToken);
+    }
+    return params;
+}
+
+// 规则筛选下拉框
+function renderLogRuleOptions() {
+    const select = document.getElementById('logRule');
+    const current = select.value;
+    select.innerHTML = '<option value="">全部规则</option>';
+    rules.slice().sort((a, b) => a.seq - b.seq).forEach(r => {
+        const option = document.createElement('option');
+        option.value = r.id;
+        option.textContent = '#' + r.seq + ' ' + (r.name || hostPort(r.listenAddr, r.listenPort));
+        select.appendChild(option);
+    });
+    select.value = current;
+}
+
+// 生成一行日志元素
+function logLineElement(entry) {
+    const p = document.createElement('p');
+    p.className = 'log-' + entry.level;
+    const time = new Date(entry.time).toLocaleString();
+    p.textContent = time + ' ' + entry.level.toUpperCase() + ' [' + entry.module + '] ' + entry.msg;
+    return p;
+}
+
+// 追加一条日志，超出上限时删除最旧的行
+function appendLogEntry(entry) {
+    const logContent = document.getElementById('logContent');
+    const atBottom = logContent.scrollTop + logContent.clientHeight >= logContent.scrollHeight - 5;
+    logContent.appendChild(logLineElement(entry));
+    logShown++;
+    while (logContent.childElementCount > maxLogLines) {
+        logContent.removeChild(logContent.firstElementChild);
+    }
+    // 用户向上翻看时不自动滚动
+    if (atBottom) {
+        logContent.scrollTop = logContent.scrollHeight;
+    }
+}
+
+// 按筛选条件订阅实时日志，连接（或重连）时服务端会先发送最近的日志
+function loadLog() {
+    if (logSource) {
+        logSource.close();
+    }
+    logSource = new EventSource('api/logStream?' + logQuery().toString());
+    logSource.onopen = function() {
+        document.getElementById('logContent').innerHTML = '';
+        document.getElementById('logOlderBtn').disabled = false;
+        logShown = 0;
+    };
+    logSource.onmessage = function(event) {
+        appendLogEntry(JSON.parse(event.data));
+    };
+    logSource.onerror = function() {
+        console.error('Log stream disconnected, reconnecting...');
+    };
+}
+
+// 加载更早的一页日志，插入到最前面
+function loadOlderLog() {
+    const params = logQuery();
+    params.set('offset', logShown);
+    params.set('limit', 200);
+    fetch('api/getLog?' + params.toString())
+        .then(response => response.json())
+        .then(data => {
+            const logContent = document.getElementById('logContent');
+            const height = logContent.scrollHeight;
+            const fragment = document.createDocumentFragment();
+            data.entries.forEach(entry => fragment.appendChild(logLineElement(entry)));
+            logContent.insertBefore(fragment, logContent.firstChild);
+            logShown += data.entries.length;
+            // 保持当前阅读位置
+            logContent.scrollTop += logContent.scrollHeight - height;
+            if (!data.hasMore) {
+                document.getElementById('logOlderBtn').disabled = true;
+            }
+        })
+        .catch(error => {
+            console.error('Failed to load log:', error);
+        });
+}
+
+// 导出全部规则、模板与黑名单为 JSON 文件
+function exportConfig() {
+    fetch('api/exportConfig?format=json')
+        .then(response => {
+            if (!response.ok) {
+                return response.json().then(data => { throw new Error(data.error || response.statusText); });
+            }
+            const disposition = response.headers.get('Content-Disposition') || '';
+            const match = disposition.match(/filename="([^"]+)"/);
+            return response.blob().then(blob => ({ blob: blob, name: match ? match[1] : 'goports-config.json' }));
+        })
+        .then(file => {
+            const link = document.createElement('a');
+            link.href = URL.createObjectURL(file.blob);
+            link.download = file.name;
+            link.click();
+            URL.revokeObjectURL(link.href);
+        })
+        .catch(error => {
+            showMessage('导出配置失败: ' + error.message, 'error');
+        });
+}
+
+// 导入配置：先预览变更，确认后合并到现有配置（ID 冲突时分配新ID）
+function importConfig(input) {
+    const file = input.files[0];
+    input.value = '';
+    if (!file) {
+        return;
+    }
+    file.text().then(text => {
+        const post = dryRun => fetch('api/importConfig?mode=merge' + (dryRun ? '&dryRun=1' : ''), {
+            method: 'POST',
+            body: text
+        }).then(response => response.json());
+
+        post(true).then(preview => {
+            if (!preview.success) {
+                showMessage('导入配置失败: ' + preview.error, 'error');
+                return;
+            }
+            let summary = '将新增 ' + preview.rules.added + ' 条规则（其中 ' + preview.rules.renamed + ' 条ID冲突，将分配新ID）、' +
+                preview.templates.added + ' 个模板、' + preview.blocklists.added + ' 个黑名单。';
+            if (preview.warnings.length) {
+                summary += '\n\n' + preview.warnings.join('\n');
+            }
+            if (!confirm(summary + '\n\n确定导入？')) {
+                return;
+            }
+            post(false).then(data => {
+                if (data.success) {
+                    showMessage('配置已导入', 'success');
+                    loadRules();
+                    loadTemplates();
+                } else {
+                    showMessage('导入配置失败: ' + data.error, 'error');
+                }
+            });
+        });
+    });
+}
+
+// 导出选中的模板及其规则的完整定义，可在其他机器上导入
+function exportTemplate() {
+    const templateName = document.getElementById('templateSelect').value;
+    if (!templateName) {
+        showMessage('请先选择模板', 'error');
+        return;
+    }
+    fetch('api/exportTemplate?name=' + encodeURIComponent(templateName))
+        .then(response => {
+            if (!response.ok) {
+                return response.json().then(data => { throw new Error(data.error || response.statusText); });
+            }
+            return response.blob();
+        })
+        .then(blob => {
+            const link = document.createElement('a');
+            link.href = URL.createObjectURL(blob);
+            link.download = 'goports-template-' + templateName + '.json';
+            link.click();
+            URL.revokeObjectURL(link.href);
+        })
+        .catch(error => {
+            showMessage('导出模板失败: ' + error.message, 'error');
+        });
+}
+
+// 导入模板：规则分配新ID后加入规则列表，先预览再确认
+function importTemplate(input) {
+    const file = input.files[0];
+    input.value = '';
+    if (!file) {
+        return;
+    }
+    file.text().then(text => {
+        const post = dryRun => fetch('api/importTemplate' + (dryRun ? '?dryRun=1' : ''), {
+            method: 'POST',
+            body: text
+        }).then(response => response.json());
+
+        post(true).then(preview => {
+            if (!preview.success) {
+                showMessage('导入模板失败: ' + preview.error, 'error');
+                return;
+            }
+            let summary = '将导入模板 ' + preview.template + '，新增 ' + preview.rules.added + ' 条规则。';
+            if (preview.warnings.length) {
+                summary += '\n\n' + preview.warnings.join('\n');
+            }
+            if (!confirm(summary + '\n\n确定导入？')) {
+                return;
+            }
+            post(false).then(data => {
+                if (data.success) {
+                    showMessage('模板 ' + data.template + ' 已导入', 'success');
+                    loadRules();
+                    loadTemplates();
+                } else {
+                    showMessage('导入模板失败: ' + data.error, 'error');
+                }
+            });
+        });
+    });
+}
+
+// 从 db/backups 中选择一个备份恢复配置，恢复前会停止所有转发
+function restoreBackup() {
+    fetch('api/getBackups')
+        .then(response => response.json())
+        .then(backups => {
+            if (backups.length === 0) {
+                showMessage('暂无备份', 'info');
+                return;
+            }
+            const list = backups.map((b, i) => (i + 1) + '. ' + new Date(b.time).toLocaleString() + ' (' + b.size + ' 字节)').join('\n');
+            const input = prompt('选择要恢复的备份（当前配置会先备份，所有转发将停止）：\n' + list, '1');
+            if (input === null) {
+                return;
+            }
+            const backup = backups[parseInt(input) - 1];
+            if (!backup) {
+                showMessage('无效的备份编号', 'error');
+                return;
+            }
+            fetch('api/restoreBackup', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ name: backup.name })
+            })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.success) {
+                        showMessage('已恢复备份 ' + backup.name, 'success');
+                        loadRules();
+                        loadTemplates();
+                    } else {
+                        showMessage('恢复备份失败: ' + data.error, 'error');
+                    }
+                });
+        })
+        .catch(error => {
+            showMessage('获取备份失败: ' + error, 'error');
+        });
+}
+
+// 扫描局域网设备，结果加入目标地址下拉框
+function scanLAN() {
+    const btn = document.getElementById('scanLANBtn');
+    btn.disabled = true;
+    btn.textContent = '扫描中…';
+    fetch('api/scanLAN')
+        .then(response => response.json())
+        .then(hosts => {
+            window.lanHosts = hosts;
+            showMessage('发现 ' + hosts.length + ' 台局域网设备，可在目标地址中选择', 'success');
+            renderRules();
+        })
+        .catch(error => {
+            showMessage('扫描失败: ' + error, 'error');
+        })
+        .finally(() => {
+            btn.disabled = false;
+            btn.textContent = '扫描局域网设备';
+        });
+}
+
+// 置顶/取消置顶规则
+function togglePin(ruleId, pinned) {
+    fetch('api/pinRule', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id: ruleId, pinned: pinned })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            loadRules();
+        } else {
+            showMessage('置顶失败: ' + data.error, 'error');
+        }
+    });
+}
+
+// 最近使用过的目标，选择后直接切换
+function renderRecentTargets(rule) {
+    if (!rule.recentTargets || rule.recentTargets.length === 0) {
+        return '';
+    }
+    let options = '<option value="">历史目标</option>';
+    rule.recentTargets.forEach(function(t) {
+        options += '<option value="' + t + '">' + t + '</option>';
+    });
+    return '<select class="recent-targets" onchange="useRecentTarget(\'' + rule.id + '\', this.value)">' + options + '</select>';
+}
+
+function useRecentTarget(ruleId, target) {
+    if (!target) return;
+    const ruleItem = document.querySelector('.rule-item[data-id="' + ruleId + '"]');
+    const sep = target.lastIndexOf(':');
+    let addr = target.substring(0, sep);
+    if (addr.charAt(0) === '[') {
+        addr = addr.substring(1, addr.length - 1);
+    }
+
+    fetch('api/updateRule', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            id: ruleId,
+            listenAddr: ruleItem.querySelector('.listen-addr').value,
+            listenPort: ruleItem.querySelector('.listen-port').value,
+            targetAddr: addr,
+            targetPort: target.substring(sep + 1)
+        })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showMessage('已切换目标为 ' + target + '，重新开启转发后生效', 'success');
+            loadRules();
+        } else {
+            showMessage('更新规则失败: ' + data.error, 'error');
+        }
+    });
+}
+
+// 启用登录时显示两步验证及退出按钮
+function loadAuthStatus() {
+    fetch('api/getTOTP')
+        .then(response => response.json())
+        .then(data => {
+            const display = data.loginEnabled ? 'inline-block' : 'none';
+            document.getElementById('totpBtn').style.display = display;
+            document.getElementById('logoutBtn').style.display = display;
+            document.getElementById('totpBtn').textContent = data.enabled ? '两步验证（已启用）' : '两步验证';
+        });
+}
+
+function logout() {
+    fetch('api/logout', { method: 'POST' }).then(function() {
+        location.href = 'login';
+    });
+}
+
+// 两步验证设置对话框：未启用时生成二维码并确认，已启用时输入验证码关闭
+function showTOTPDialog() {
+    fetch('api/getTOTP')
+        .then(response => response.json())
+        .then(status => {
+            if (status.enabled) {
+                const code = prompt('两步验证已启用。输入当前验证码以关闭：');
+                if (!code) return;
+                postTOTP('api/disableTOTP', code, '两步验证已关闭');
+                return;
+            }
+            fetch('api/setupTOTP', { method: 'POST' })
+                .then(response => response.json())
+                .then(data => {
+                    if (!data.success) {
+                        showMessage('生成密钥失败: ' + data.error, 'error');
+                        return;
+                    }
+                    showTOTPSetup(data);
+                });
+        });
+}
+
+function showTOTPSetup(data) {
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.textAlign = 'center';
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">启用两步验证</h3>' +
+        '<p>使用验证器应用扫描二维码，然后输入显示的验证码</p>' +
+        '<img src="' + data.qrCode + '" alt="TOTP QR Code">' +
+        '<p style="font-family: monospace;">' + data.secret + '</p>' +
+        '<input type="text" id="totpCode" maxlength="6" placeholder="6位验证码" style="padding: 8px; border: 1px solid #ddd; border-radius: 4px;">' +
+        '<div style="display: flex; justify-content: flex-end; gap: 10px; margin-top: 15px;">' +
+        '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
+        '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #1890ff; color: white; cursor: pointer;">启用</button>' +
+        '</div>';
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    function close() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    dialog.querySelector('#cancelBtn').onclick = close;
+    dialog.querySelector('#confirmBtn').onclick = function() {
+        postTOTP('api/enableTOTP', dialog.querySelector('#totpCode').value, '两步验证已启用').then(function(ok) {
+            if (ok) close();
+        });
+    };
+}
+
+function postTOTP(url, code, successText) {
+    return fetch(url, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ code: code })
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.success) {
+            showMessage(successText, 'success');
+            loadAuthStatus();
+        } else {
+            showMessage(data.error, 'error');
+        }
+        return data.success;
+    });
+}
+
+// 程序设置对话框，被命令行参数覆盖的设置项不可编辑
+function showSettingsDialog() {
+    fetch('api/getSettings')
+        .then(response => response.json())
+        .then(data => showSettings(data.settings, data.overridden || []))
+        .catch(error => {
+            console.error('Failed to load settings:', error);
+            showMessage('加载设置失败', 'error');
+        });
+}
+
+function showSettings(settings, overridden) {
+    const overlay = document.createElement('div');
+    overlay.style.position = 'fixed';
+    overlay.style.top = '0';
+    overlay.style.left = '0';
+    overlay.style.width = '100%';
+    overlay.style.height = '100%';
+    overlay.style.backgroundColor = 'rgba(0, 0, 0, 0.5)';
+    overlay.style.zIndex = '999';
+
+    const dialog = document.createElement('div');
+    dialog.style.position = 'fixed';
+    dialog.style.top = '50%';
+    dialog.style.left = '50%';
+    dialog.style.transform = 'translate(-50%, -50%)';
+    dialog.style.backgroundColor = 'white';
+    dialog.style.padding = '20px';
+    dialog.style.borderRadius = '8px';
+    dialog.style.boxShadow = '0 0 20px rgba(0, 0, 0, 0.3)';
+    dialog.style.zIndex = '1000';
+    dialog.style.width = '420px';
+    dialog.style.maxHeight = '90vh';
+    dialog.style.overflowY = 'auto';
+
+    const field = (name, label, input) => '<label style="display: block; margin: 8px 0;">' + label +
+        (overridden.includes(name) ? ' <span style="font-size: 12px; color: #e67e22;">（已由命令行参数指定）</span>' : '') +
+        '<br>' + input + '</label>';
+    const text = (name, value, placeholder) => '<input type="text" data-field="' + name + '" value="' + escapeHTML(String(value || '')) + '" placeholder="' + placeholder + '" style="width: 100%; padding: 6px; border: 1px solid #ddd; border-radius: 4px;">';
+    const select = (name, value, options) => '<select data-field="' + name + '" style="width: 100%; padding: 6px;">' +
+        options.map(o => '<option value="' + o[0] + '"' + ((value || '') === o[0] ? ' selected' : '') + '>' + o[1] + '</option>').join('') + '</select>';
+    const check = (name, value, label) => '<label style="display: block; margin: 8px 0;"><input type="checkbox" data-field="' + name + '"' + (value !== false ? ' checked' : '') + '> ' + label +
+        (overridden.includes(name) ? ' <span style="font-size: 12px; color: #e67e22;">（已由命令行参数指定）</span>' : '') + '</label>';
+
+    dialog.innerHTML = '<h3 style="margin-top: 0;">设置</h3>' +
+        field('uiListen', '管理界面监听地址（重启后生效）', text('uiListen', settings.uiListen, '所有地址')) +
+        field('uiPort', '管理界面端口（重启后生效）', text('uiPort', settings.uiPort, '自动，从 8080 起')) +
+        field('uiAllow', '允许访问管理界面的来源 IP/CIDR（逗号分隔，本机始终允许）', text('uiAllow', settings.uiAllow, '所有来源')) +
+        field('logLevel', '日志级别', select('logLevel', settings.logLevel, [['', '默认 (info)'], ['debug', 'debug'], ['info', 'info'], ['warn', 'warn'], ['error', 'error']])) +
+        field('tcpBufferSize', 'TCP 缓冲区大小（字节）', text('tcpBufferSize', settings.tcpBufferSize, '32768')) +
+        field('udpBufferSize', 'UDP 缓冲区大小（字节）', text('udpBufferSize', settings.udpBufferSize, '65535')) +
+        field('udpSocketBuffer', 'UDP 套接字缓冲区（字节）', text('udpSocketBuffer', settings.udpSocketBuffer, '系统默认')) +
+        field('language', '界面语言', select('language', settings.language, [['', '跟随浏览器'], ['zh', '中文'], ['en', 'English']])) +
+        field('apiToken', 'API 令牌（重启后生效）', text('apiToken', settings.apiToken, '不校验')) +
+        field('defaultTemplate', '启动时开启的模板', select('defaultTemplate', settings.defaultTemplate, [['', '无']].concat(templates.map(t => [escapeHTML(t.name), escapeHTML(t.name)])))) +
+        check('autoStartRules', settings.autoStartRules, '启动时开启标记了"自启"的规则') +
+        check('restoreRunning', settings.restoreRunning, '启动时恢复上次运行的转发') +
+        check('rebindForwards', settings.rebindForwards === true, '监听地址消失后恢复时重新监听（如 Wi-Fi 重连、VPN 重连）') +
+        '<div style="display: flex; justify-content: flex-end; gap: 10px; margin-top: 15px;">' +
+        '<button id="cancelBtn" style="padding: 8px 16px; border: 1px solid #ddd; border-radius: 4px; background-color: #f5f5f5; cursor: pointer;">取消</button>' +
+        '<button id="confirmBtn" style="padding: 8px 16px; border: none; border-radius: 4px; background-color: #1890ff; color: white; cursor: pointer;">保存</button>' +
+        '</div>';
+
+    overridden.forEach(name => {
+        const input = dialog.querySelector('[data-field="' + name + '"]');
+        if (input) input.disabled = true;
+    });
+
+    document.body.appendChild(overlay);
+    document.body.appendChild(dialog);
+
+    function close() {
+        document.body.removeChild(overlay);
+        document.body.removeChild(dialog);
+    }
+
+    dialog.querySelector('#cancelBtn').onclick = close;
+    dialog.querySelector('#confirmBtn').onclick = function() {
+        const next = {};
+        dialog.querySelectorAll('[data-field]').forEach(input => {
+            const name = input.dataset.field;
+            if (input.type === 'checkbox') {
+                next[name] = input.checked;
+            } else if (['uiPort', 'tcpBufferSize', 'udpBufferSize', 'udpSocketBuffer'].includes(name)) {
+                next[name] = parseInt(input.value, 10) || 0;
+            } else {
+                next[name] = input.value.trim();
+            }
+        });
+        dialog.querySelectorAll('.field-invalid').forEach(el => el.classList.remove('field-invalid'));
+
+        fetch('api/updateSettings', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(next)
+        })
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) {
+                (data.fields || []).forEach(f => {
+                    const input = dialog.querySelector('[data-field="' + f.field + '"]');
+                    if (input) input.classList.add('field-invalid');
+                });
+                showMessage('保存设置失败: ' + data.error, 'error');
+                return;
+            }
+            close();
+            loadTemplates();
+            showMessage(data.restartRequired ? '设置已保存，部分设置重启后生效' : '设置已保存', 'success');
+        })
+        .catch(error => {
+            console.error('Failed to save settings:', error);
+            showMessage('保存设置失败', 'error');
+        });
+    };
+}
+
+// 以错误样式显示的推送通知
+const errorNotifyEvents = ['alert.firing', 'health.down', 'forward.stale', 'forward.listener_failed', 'forward.rebind_failed'];
+
+// 订阅服务端推送的通知：网卡地址变化时刷新本地地址，转发可能变化，同时刷新规则列表
+let notifySource = null;
+function subscribeNotifications() {
+    if (notifySource) {
+        notifySource.close();
+    }
+    const params = new URLSearchParams();
+    if (window.apiToken) {
+        // EventSource 无法附带请求头，通过参数传递令牌
+        params.set('token', window.apiToken);
+    }
+    notifySource = new EventSource('api/notifyStream?' + params.toString());
+    notifySource.onmessage = function(event) {
+        const n = JSON.parse(event.data);
+        if (n.event.startsWith('network.')) {
+            getLocalIPs();
+        }
+        loadRules();
+        const failed = errorNotifyEvents.includes(n.event) || n.event.startsWith('anomaly.');
+        showMessage(n.title, failed ? 'error' : 'info');
+    };
+    notifySource.onerror = function() {
+        console.error('Notification stream disconnected, reconnecting...');
+    };
+}
+
+// 页面加载时加载日志
+window.onload = function() {
+    document.getElementById('uiLanguageSelect').value = window.uiLanguageChoice || '';
+    initApp();
+    loadLog();
+    loadAuthStatus();
+    subscribeNotifications();
+};
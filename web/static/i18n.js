@@ -0,0 +1,637 @@
+// 界面多语言：界面以中文编写，选择英文时在显示前把中文替换为对应的译文。
+// 语言由服务端根据 ?lang=、界面上的选择（Cookie）、设置与 Accept-Language 决定，写入 window.uiLanguage
+(function() {
+    const dictionaries = {
+        en: {
+            // 页面与按钮
+            '端口转发工具': 'Port Forwarder',
+            '首页': 'Home',
+            '新增规则': 'Add rule',
+            '发现本机服务': 'Discover local services',
+            '活动连接': 'Active connections',
+            '代理': 'Agents',
+            '管理以 -agent-controller 向本实例报告的其他实例上的转发': 'Manage forwards on other instances that report here with -agent-controller',
+            '环境': 'Profiles',
+            '目标中 ${NAME} 变量的取值，按环境（如 dev、staging、prod）切换': 'Values of ${NAME} variables in targets, switched per environment (e.g. dev, staging, prod)',
+            '扫描局域网设备': 'Scan LAN devices',
+            '从预设新增': 'Add from preset',
+            '删除选中规则': 'Delete selected rules',
+            'TCP+UDP / 全部协议': 'TCP+UDP / all protocols',
+            '全部开启/停止时处理的协议': 'Protocols affected by start all / stop all',
+            '全部开启': 'Start all',
+            '全部停止': 'Stop all',
+            '保存为模板': 'Save as template',
+            '加入已有模板': 'Add to template',
+            '新建模板': 'New template',
+            '导出配置': 'Export config',
+            '导入配置': 'Import config',
+            '恢复备份': 'Restore backup',
+            '两步验证（已启用）': 'Two-factor auth (enabled)',
+            '两步验证': 'Two-factor auth',
+            '退出登录': 'Sign out',
+            '选择模板': 'Select template',
+            '切换到模板': 'Switch to template',
+            '一键开启此模板所有转发': 'Start all forwards in this template',
+            '一键关闭此模板所有转发': 'Stop all forwards in this template',
+            '删除此模板': 'Delete template',
+            '编辑模板': 'Edit template',
+            '导出此模板': 'Export template',
+            '导入模板': 'Import template',
+            '序号': 'No.',
+            '监听IP': 'Listen IP',
+            '监听端口': 'Listen port',
+            '目标IP': 'Target IP',
+            '目标端口': 'Target port',
+            '运行日志': 'Log',
+            '全部级别': 'All levels',
+            'debug 及以上': 'debug and above',
+            'info 及以上': 'info and above',
+            'warn 及以上': 'warn and above',
+            '仅 error': 'error only',
+            '全部规则': 'All rules',
+            '加载更早': 'Load older',
+            '加载日志中...': 'Loading log...',
+            '设置': 'Settings',
+
+            // 规则列表
+            '暂无规则，请点击“新增规则”按钮添加': 'No rules yet. Click "Add rule" to create one',
+            '选择监听地址': 'Select listen address',
+            '选择目标IP': 'Select target IP',
+            '所有地址': 'All addresses',
+            '请输入自定义IP地址': 'Enter a custom IP address',
+            '自定义': 'Custom',
+            '正在加载网卡信息...': 'Loading network interfaces...',
+            '端口、服务名或范围': 'Port, service name or range',
+            '名称，如 Dev MySQL': 'Name, e.g. Dev MySQL',
+            '备注': 'Note',
+            '程序启动时自动开启TCP/UDP转发': 'Start TCP/UDP forwarding when the program launches',
+            '自启': 'Auto-start',
+            '开启TCP转发（排空中': 'Start TCP forward (draining',
+            '开启TCP转发': 'Start TCP forward',
+            '停止TCP转发': 'Stop TCP forward',
+            '开启UDP转发': 'Start UDP forward',
+            '停止UDP转发': 'Stop UDP forward',
+            '开启SCTP转发': 'Start SCTP forward',
+            '停止SCTP转发': 'Stop SCTP forward',
+            '开启SOCKS5代理': 'Start SOCKS5 proxy',
+            '停止SOCKS5代理': 'Stop SOCKS5 proxy',
+            '在监听地址上运行SOCKS5代理，目标由客户端指定': 'Run a SOCKS5 proxy on the listen address; clients choose the target',
+            '(排空中)': '(draining)',
+            '已开启': 'Running',
+            '已停止': 'Stopped',
+            '置顶': 'Pin',
+            '取消置顶': 'Unpin',
+            '创建副本': 'Duplicate',
+            '在服务端创建这条规则的副本，可平移端口': 'Create a copy of this rule on the server, optionally shifting ports',
+            '二维码': 'QR code',
+            '二维码内容': 'QR code content',
+            '把二维码内容设为完整的 URL，如 ': 'Make the QR code a full URL, e.g. ',
+            '使用公网IP': 'Use public IP',
+            '外网用户扫码时使用本机的公网IP（通过 STUN 或 -public-ip-url 检测）': 'Use this machine\'s public IP for users scanning from outside (detected via STUN or -public-ip-url)',
+            '访问地址': 'Address',
+            '扫码访问源IP:源端口': 'Scan to open listen IP:port',
+            '访问控制': 'Access control',
+            '按来源IP/CIDR允许或拒绝连接': 'Allow or deny connections by source IP/CIDR',
+            '允许': 'Allow',
+            '拒绝': 'Deny',
+            '连接上限': 'Connection limit',
+            '限制同时连接数，保护小型后端': 'Limit concurrent connections to protect small backends',
+            '最多 ': 'At most ',
+            ' 个同时连接': ' concurrent connections',
+            '超时': 'Timeouts',
+            '关闭空闲或存活过久的连接': 'Close idle or long-lived connections',
+            '空闲超时': 'Idle timeout',
+            '最长存活': 'max lifetime',
+            'UDP 会话': 'UDP session',
+            '重试': 'Retry',
+            'TCP选项': 'TCP options',
+            '路由': 'Routes',
+            '路由: ': 'Routes: ',
+            '按 TLS SNI、HTTP Host 或开头的字节把连接转发到不同目标': 'Send connections to different targets by TLS SNI, HTTP Host or leading bytes',
+            'SSH跳板': 'SSH jump',
+            '中继': 'Relay',
+            '依次经过其他 go-ports 实例（中继节点）连接目标': 'Reach the target through other go-ports instances (relay nodes) in order',
+            '出接口': 'Interface',
+            '出接口: ': 'Interface: ',
+            '指定连接目标的出接口或源地址，如经 WireGuard 网卡连接后端': 'Choose the interface or source IP used to reach the target, e.g. a WireGuard interface',
+            '经 SSH 跳板机连接目标，转发的连接复用同一个 SSH 连接': 'Reach the target through an SSH jump host; forwarded connections share one SSH connection',
+            '抓包': 'Capture',
+            '停止抓包': 'Stop capture',
+            '下载抓包': 'Download capture',
+            '把转发的数据写入 pcap 抓包文件，用于调试协议问题': 'Write forwarded traffic to a pcap file for debugging protocol issues',
+            '下载抓包文件，可用 Wireshark 打开': 'Download the capture file, which can be opened in Wireshark',
+            '设置两侧连接的保活、TCP_NODELAY 与连接目标的超时': 'Set keepalive, TCP_NODELAY and the dial timeout for both sides of the connection',
+            '不保活': 'no keepalive',
+            '保活间隔 ': 'keepalive every ',
+            '关闭 TCP_NODELAY': 'TCP_NODELAY off',
+            '连接超时 ': 'dial timeout ',
+            '连接目标失败时重试，后端重启期间保持客户端连接': 'Retry when the target cannot be reached, keeping clients connected while the backend restarts',
+            '负载均衡': 'Load balancing',
+            '添加更多目标，新的TCP连接在各目标之间分配': 'Add more targets; new TCP connections are distributed among them',
+            '最少连接': 'least connections',
+            '轮询': 'round robin',
+            '[备用]': '[fallback]',
+            '健康检查': 'Health check',
+            '检查目标是否可用，不可用时切换到其他目标或备用目标': 'Check whether targets are up and fail over to other or fallback targets',
+            '正常': 'up',
+            '不可用': 'down',
+            '未检查': 'not checked',
+            '定时': 'Schedule',
+            '按时间窗口自动开启/停止转发': 'Start and stop forwards automatically by time window',
+            '自动停止': 'Auto-stop',
+            '无流量一段时间后自动停止，适合临时演示': 'Stop automatically after a period without traffic, handy for temporary demos',
+            ' 分钟无流量后自动停止': ' minutes without traffic stops the forward',
+            '端口映射': 'Port mapping',
+            '转发运行时通过 UPnP/NAT-PMP 在路由器上映射同一端口': 'Map the same port on the router via UPnP/NAT-PMP while the forward runs',
+            '关闭端口映射': 'Disable port mapping',
+            '映射失败': 'mapping failed',
+            '透明代理': 'Transparent proxy',
+            '目标看到客户端的真实IP（需要Linux、root权限与策略路由）': 'Targets see the real client IP (requires Linux, root and policy routing)',
+            '关闭透明代理': 'Disable transparent proxy',
+            '高优先级': 'High priority',
+            '普通': 'Normal',
+            '低优先级': 'Low priority',
+            '全局限速时的带宽优先级（重启转发后生效）': 'Bandwidth priority under the global limit (applies after restarting the forward)',
+            '记录TLS客户端JA3指纹到日志（仅TCP，重启转发后生效）': 'Log TLS client JA3 fingerprints (TCP only, applies after restarting the forward)',
+            '历史目标': 'Recent targets',
+            '删除': 'Delete',
+            '复制': 'Copy',
+            '编辑': 'Edit',
+            '上行': 'up',
+            '下行': 'down',
+            '上行 / 下行': 'Up / Down',
+            '连接': 'connections',
+            '峰值': 'peak',
+            '公网': 'Public',
+            '不限': 'unlimited',
+            '无': 'None',
+            '秒': 's',
+
+            // 模板
+            '暂无模板，请点击"保存为模板"按钮创建': 'No templates yet. Click "Save as template" to create one',
+            '暂无模板，请先创建模板': 'No templates yet. Create one first',
+            '规则数量': 'Rules',
+            '创建时间': 'Created',
+            '切到模板': 'Switch to',
+            '开启转发': 'Start forwards',
+            '关闭转发': 'Stop forwards',
+            '启动时开启': 'Start on launch',
+            '取消自启': 'Don\'t start on launch',
+            '（启动时自动开启）': ' (starts on launch)',
+            '模板名称': 'Template name',
+            '描述': 'Description',
+            '规则（按启动顺序）': 'Rules (in startup order)',
+            '模板中暂无规则': 'This template has no rules',
+            '加入规则…': 'Add a rule…',
+            '移除': 'Remove',
+            '（私有）': ' (private)',
+            '私有 · 加入全局规则': 'Private · add to global rules',
+            '转为私有副本': 'Make private copy',
+            '模板私有副本，修改或删除全局规则不影响它': 'Private copy owned by the template; editing or deleting global rules does not affect it',
+            '引用全局规则，复制为模板私有副本后不再随全局规则变化': 'References a global rule; make a private copy to stop following global changes',
+            '保存规则的私有副本（之后修改或删除规则不影响模板）': 'Save private copies of the rules (later edits or deletions do not affect the template)',
+            '请输入模板名称': 'Enter a template name',
+            '请选择要加入的模板编号': 'Choose the number of the template to add to',
+            '确定要将选中的规则加入模板吗？': 'Add the selected rules to the template?',
+            '确定要删除此模板吗？删除后将无法恢复。': 'Delete this template? This cannot be undone.',
+            '模板转发正在按启动顺序开启': 'Template forwards are starting in order',
+            '模板转发已开启': 'Template forwards started',
+            '模板转发已关闭': 'Template forwards stopped',
+            '已切换到模板': 'Switched to template',
+            '模板创建成功': 'Template created',
+            '模板创建失败': 'Failed to create template',
+            '模板保存成功': 'Template saved',
+            '模板保存失败': 'Failed to save template',
+            '模板删除成功': 'Template deleted',
+            '模板删除失败': 'Failed to delete template',
+            '模板编辑成功': 'Template updated',
+            '模板编辑失败': 'Failed to update template',
+            '规则已成功加入模板': 'Rules added to the template',
+            '加入模板失败': 'Failed to add to template',
+            '已加入全局规则列表': 'Added to the global rules',
+            '已转为模板私有副本': 'Converted to a private copy',
+            '已设为启动时自动开启的模板': 'This template will start on launch',
+            '已取消自动开启': 'Auto-start cancelled',
+            '设置失败': 'Failed to save',
+            '请先选择模板': 'Select a template first',
+            '请先选择要应用的模板': 'Select a template to apply first',
+            '请先选择要开启的模板': 'Select a template to start first',
+            '请先选择要关闭的模板': 'Select a template to stop first',
+            '请先选择要编辑的模板': 'Select a template to edit first',
+            '请先选择要删除的模板': 'Select a template to delete first',
+            '请先选择要保存为模板的规则': 'Select the rules to save as a template first',
+            '请先选择要加入模板的规则': 'Select the rules to add to the template first',
+            '无效的模板编号': 'Invalid template number',
+            '以下规则可能无法启动：': 'These rules may fail to start:',
+            '仍然继续开启？': 'Start anyway?',
+            '（建议端口 ': ' (suggested port ',
+            '将导入模板 ': 'Will import template ',
+            '导出模板失败': 'Failed to export template',
+            '导入模板失败': 'Failed to import template',
+
+            // 规则操作提示
+            '规则添加成功': 'Rule added',
+            '添加规则失败': 'Failed to add rule',
+            '已从预设添加规则 (': 'Added rule from preset (',
+            '规则删除成功': 'Rules deleted',
+            '请先选择要删除的规则': 'Select the rules to delete first',
+            '确定要删除此规则吗？': 'Delete this rule?',
+            '更新规则失败': 'Failed to update rule',
+            '复制规则失败': 'Failed to duplicate rule',
+            '已创建副本，监听端口 ': 'Duplicate created, listen port ',
+            '端口偏移必须是整数': 'Port offsets must be integers',
+            '监听端口偏移（如 1 表示 8080 变为 8081，0 为不变）': 'Listen port offset (1 turns 8080 into 8081, 0 keeps it)',
+            '目标端口偏移（0 为不变）': 'Target port offset (0 keeps it)',
+            'TCP转发已启动': 'TCP forward started',
+            'TCP转发已停止': 'TCP forward stopped',
+            'UDP转发已启动': 'UDP forward started',
+            'UDP转发已停止': 'UDP forward stopped',
+            'SCTP转发已启动': 'SCTP forward started',
+            'SCTP转发已停止': 'SCTP forward stopped',
+            'SOCKS5代理已启动': 'SOCKS5 proxy started',
+            'SOCKS5代理已停止': 'SOCKS5 proxy stopped',
+            'SOCKS5代理失败': 'SOCKS5 proxy failed',
+            '启动TCP转发失败': 'Failed to start TCP forward',
+            '停止TCP转发失败': 'Failed to stop TCP forward',
+            '启动UDP转发失败': 'Failed to start UDP forward',
+            '停止UDP转发失败': 'Failed to stop UDP forward',
+            '启动SCTP转发失败': 'Failed to start SCTP forward',
+            '停止SCTP转发失败': 'Failed to stop SCTP forward',
+            '端口已被占用': 'Port already in use',
+            '，可改用端口 ': ', try port ',
+            '已被占用，是否改用可用端口 ': ' is in use. Switch to free port ',
+            '监听端口已改为 ': 'Listen port changed to ',
+            '个转发': 'forwards',
+            '已开启 ': 'Started ',
+            '已停止 ': 'Stopped ',
+            ' 个失败：': ' failed: ',
+            '操作失败': 'Operation failed',
+            '以下转发未能恢复': 'These forwards could not be restored',
+            '已切换目标为 ': 'Target switched to ',
+            '，重新开启转发后生效': '; restart the forward to apply',
+
+            // 规则设置对话框
+            '仅允许以下来源（IP或CIDR，逗号分隔，留空不限制）': 'Only allow these sources (IPs or CIDRs, comma-separated, empty for no restriction)',
+            '拒绝以下来源（IP或CIDR，逗号分隔，优先于允许列表）': 'Deny these sources (IPs or CIDRs, comma-separated, takes precedence over the allow list)',
+            '访问控制已更新': 'Access control updated',
+            '更新访问控制失败': 'Failed to update access control',
+            '同时连接数上限（所有协议与端口合计，超出的新连接会被立即关闭，0 为不限制）': 'Concurrent connection limit (all protocols and ports combined; extra connections are closed immediately, 0 for no limit)',
+            '连接上限已更新': 'Connection limit updated',
+            '更新连接上限失败': 'Failed to update connection limit',
+            '连接空闲超时秒数（两个方向都没有数据超过该时间时关闭，0 为不限制）': 'Idle timeout in seconds (close when neither direction has data for this long, 0 for no limit)',
+            '连接最长存活秒数（0 为不限制）': 'Maximum connection lifetime in seconds (0 for no limit)',
+            'UDP 会话空闲超时秒数（QUIC 等长连接应大于其保活间隔，0 为默认 120 秒）': 'UDP session idle timeout in seconds (should exceed the keepalive interval of long-lived protocols such as QUIC, 0 for the default 120s)',
+            '超时设置已更新': 'Timeouts updated',
+            '更新超时设置失败': 'Failed to update timeouts',
+            '连接目标失败后的重试次数（0 为不重试）': 'Retries after failing to reach the target (0 for none)',
+            '首次重试前等待的毫秒数（之后每次翻倍）': 'Milliseconds before the first retry (doubled each time)',
+            '保持客户端连接等待目标恢复的最长秒数（大于0时一直重试到超时，0 为不等待）': 'Longest time in seconds to hold clients while waiting for the target (above 0 retries until the timeout, 0 does not wait)',
+            '重试设置已更新': 'Retry settings updated',
+            '更新重试设置失败': 'Failed to update retry settings',
+            'TCP 保活探测间隔秒数（0 为系统默认，-1 为关闭保活）': 'TCP keepalive interval in seconds (0 for the system default, -1 to disable keepalive)',
+            'TCP_NODELAY（1 为开启，立即发送小包；0 为关闭，启用 Nagle 算法合并小包）': 'TCP_NODELAY (1 to enable and send small packets immediately; 0 to disable and let Nagle\'s algorithm coalesce them)',
+            '连接目标的超时秒数（0 为默认）': 'Dial timeout for the target in seconds (0 for the default)',
+            'TCP选项已更新': 'TCP options updated',
+            '路由表（主机名=addr:port，逗号分隔，按顺序匹配 TLS SNI 或 HTTP Host，支持 *.example.com；hex:5353482d=addr:port 按开头的字节匹配；都不匹配时使用规则的目标，留空关闭）': 'Routing table (hostname=addr:port, comma-separated, matched in order against the TLS SNI or HTTP Host, *.example.com allowed; hex:5353482d=addr:port matches leading bytes; unmatched connections use the rule\'s target; leave empty to disable)',
+            '路由表已更新': 'Routes updated',
+            '（已连接）': ' (connected)',
+            'SSH 跳板机（输入编号选择，new 新增，留空直接连接目标）': 'SSH jump host (enter a number to choose, new to add one, leave empty to connect directly)',
+            '没有编号为 ': 'There is no number ',
+            ' 的跳板机': '',
+            '跳板机地址（host:port）': 'Jump host address (host:port)',
+            'SSH 用户名': 'SSH user',
+            'SSH 密码（加密保存）': 'SSH password (stored encrypted)',
+            '主机密钥指纹（SHA256:...，留空则信任首次连接时的密钥）': 'Host key fingerprint (SHA256:..., leave empty to trust the key seen on first connect)',
+            '添加跳板机失败': 'Failed to add jump host',
+            '已设置 SSH 跳板机': 'SSH jump host set',
+            '已改为直接连接目标': 'Now connecting to the target directly',
+            '设置 SSH 跳板机失败': 'Failed to set SSH jump host',
+            '中继节点（按经过的顺序输入编号，逗号分隔；new 新增，留空直接连接目标）': 'Relay nodes (enter numbers in the order traffic passes them, comma-separated; new to add one, leave empty to connect directly)',
+            ' 的中继节点': '',
+            '中继节点地址（对方的 -relay-listen，host:port）': 'Relay node address (its -relay-listen, host:port)',
+            '中继节点令牌（对方的 -relay-token，加密保存）': 'Relay node token (its -relay-token, stored encrypted)',
+            '添加中继节点失败': 'Failed to add relay node',
+            '已设置中继节点': 'Relay nodes set',
+            '设置中继节点失败': 'Failed to set relay nodes',
+            '出接口名（如 wg0，留空按系统路由）': 'Outbound interface (e.g. wg0, leave empty to use the default route)',
+            '源地址（留空由系统选择）': 'Source IP (leave empty to let the system choose)',
+            '出接口已更新': 'Outbound interface updated',
+            '更新出接口失败': 'Failed to update outbound interface',
+            '更新路由表失败': 'Failed to update routes',
+            '重新开始抓包会覆盖之前的抓包文件，确定吗？': 'Starting a new capture overwrites the previous capture file. Continue?',
+            '已开启抓包，转发的数据写入 db/captures 目录': 'Capture started; forwarded traffic is written to the db/captures directory',
+            '已停止抓包，可以下载抓包文件': 'Capture stopped; the capture file can be downloaded',
+            '更新抓包设置失败': 'Failed to update capture settings',
+            '下载抓包文件失败': 'Failed to download the capture file',
+            '更新TCP选项失败': 'Failed to update TCP options',
+            '除主目标外的其他目标（addr:port，逗号分隔，留空只使用主目标）': 'Additional targets besides the main one (addr:port, comma-separated, empty for the main target only)',
+            '所有目标都不可用时的备用目标（addr:port，留空不使用）': 'Fallback target when all targets are down (addr:port, empty for none)',
+            '按最少连接分配新连接？\n确定：最少连接；取消：轮询': 'Assign new connections by least connections?\nOK: least connections; Cancel: round robin',
+            '负载均衡已更新': 'Load balancing updated',
+            '更新负载均衡失败': 'Failed to update load balancing',
+            '检查方式（tcp/http/https，留空关闭健康检查）': 'Check type (tcp/http/https, empty to disable health checks)',
+            'HTTP 检查路径': 'HTTP check path',
+            '健康检查已更新': 'Health check updated',
+            '健康检查已关闭': 'Health check disabled',
+            '更新健康检查失败': 'Failed to update health check',
+            '时间窗口（本机时间，多个以分号分隔，如 ': 'Time windows (local time, separated by semicolons, e.g. ',
+            '，省略星期表示每天，留空取消定时）': '; omit days for every day, empty to remove the schedule)',
+            '定时开关的协议（以逗号分隔，可选 tcp/udp/sctp/socks5）': 'Scheduled protocols (comma-separated: tcp/udp/sctp/socks5)',
+            '时间窗口格式错误': 'Invalid time window',
+            '定时已更新': 'Schedule updated',
+            '已取消定时': 'Schedule removed',
+            '更新定时失败': 'Failed to update schedule',
+            '连续多少分钟没有流量与新连接后自动停止转发（0 为不自动停止）': 'Minutes without traffic or new connections before stopping the forward (0 to never stop)',
+            '自动停止已更新': 'Auto-stop updated',
+            '更新自动停止失败': 'Failed to update auto-stop',
+            '已开启端口映射，转发运行时会在路由器上映射端口': 'Port mapping enabled; the port is mapped on the router while the forward runs',
+            '已关闭端口映射': 'Port mapping disabled',
+            '更新端口映射失败': 'Failed to update port mapping',
+            '透明代理以客户端IP连接目标，目标的回程流量必须经过本机（需配置策略路由），否则连接会失败。': 'The transparent proxy connects to targets using the client IP; return traffic must route through this machine (policy routing required) or connections fail.',
+            '确定开启？': 'Enable it?',
+            '透明代理已开启': 'Transparent proxy enabled',
+            '透明代理已关闭': 'Transparent proxy disabled',
+            '无法开启透明代理': 'Cannot enable transparent proxy',
+            '更新透明代理失败': 'Failed to update transparent proxy',
+            '二维码的 URL scheme（如 http、https、rtsp 或自定义，留空则不加前缀）': 'QR code URL scheme (e.g. http, https, rtsp or custom; empty for no prefix)',
+            '附加在地址后的路径与查询（以 / 或 ? 开头，如 /live?channel=1，可留空）': 'Path and query appended to the address (starting with / or ?, e.g. /live?channel=1; may be empty)',
+            '二维码内容已更新': 'QR code content updated',
+            '更新二维码内容失败': 'Failed to update QR code content',
+            '分享': 'Share',
+            'ip:port、各 scheme 的访问 URL 与二维码内容，可直接选中复制': 'ip:port, URLs for each scheme and the QR code content, ready to select and copy',
+            'URL scheme（逗号分隔，如 http,https,rdp,vnc；留空按目标端口推测）：': 'URL schemes (comma-separated, e.g. http,https,rdp,vnc; empty to guess from the target port):',
+            'URL scheme 已更新': 'URL schemes updated',
+            '更新 URL scheme 失败': 'Failed to update URL schemes',
+            '获取分享信息失败': 'Failed to get share info',
+            '检测公网IP失败': 'Failed to detect public IP',
+            '检测中…': 'Detecting…',
+
+            // 服务发现、局域网、连接
+            '本机监听的服务': 'Services listening on this machine',
+            '未发现监听中的服务': 'No listening services found',
+            '发现服务失败': 'Failed to discover services',
+            '进程': 'Process',
+            '未知进程': 'unknown process',
+            '协议': 'Protocol',
+            '地址': 'Address',
+            '端口': 'Port',
+            '服务': 'Service',
+            '暴露到': 'Expose on',
+            '请先选择要暴露到的地址': 'Select an address to expose on first',
+            '创建转发': 'Create forward',
+            '已创建转发规则': 'Forward rule created',
+            '创建规则失败': 'Failed to create rule',
+            '扫描中…': 'Scanning…',
+            '扫描失败': 'Scan failed',
+            '局域网设备': 'LAN devices',
+            '台局域网设备，可在目标地址中选择': 'LAN devices found; choose one as a target address',
+            '发现 ': 'Found ',
+            '当前没有活动连接': 'No active connections',
+            '活动连接 (': 'Active connections (',
+            '客户端': 'Client',
+            '目标': 'Target',
+            '时长': 'Duration',
+            '断开': 'Disconnect',
+            '连接已断开': 'Connection closed',
+            '断开连接失败': 'Failed to close connection',
+            '刷新': 'Refresh',
+            '代理 (': 'Agents (',
+            '还没有代理报告。在其他实例上以 -agent-controller 指向本实例、-agent-token 为本实例的 -controller-token 启动': 'No agent has reported yet. Start other instances with -agent-controller pointing here and -agent-token set to this instance\'s -controller-token',
+            '在线': 'online',
+            '离线': 'offline',
+            ' 条命令待执行': ' commands pending',
+            '监听': 'Listen',
+            '运行中': 'Running',
+            '命令已排队，代理下次报告时执行': 'Command queued; the agent runs it on its next report',
+            '发送命令失败': 'Failed to send command',
+            '规则名称': 'Rule name',
+            '代理上的监听地址（addr:port）': 'Listen address on the agent (addr:port)',
+            '目标地址（addr:port）': 'Target address (addr:port)',
+            '确定要删除代理 ': 'Delete this rule on agent ',
+            ' 上的这条规则吗？': '?',
+            '环境 (': 'Profiles (',
+            '规则的目标地址与端口可以写成 ${NAME}，开启转发时按当前环境展开。切换环境时正在运行的转发会重启。': 'Rule target addresses and ports may contain ${NAME}, resolved from the active profile when a forward starts. Running forwards restart when the profile changes.',
+            '规则引用的变量：': 'Variables used by rules: ',
+            '当前环境：': 'Active profile: ',
+            '不使用环境': 'No profile',
+            '已不使用环境': 'No profile in use',
+            '当前': 'active',
+            '使用': 'Use',
+            '重命名': 'Rename',
+            '未定义：': 'Undefined: ',
+            '新增环境': 'Add profile',
+            '已切换到环境 ': 'Switched to profile ',
+            '环境已保存': 'Profile saved',
+            '环境已删除': 'Profile deleted',
+            '环境名称': 'Profile name',
+            '环境名称（如 dev、staging、prod）': 'Profile name (e.g. dev, staging, prod)',
+            '确定要删除环境 ': 'Delete profile ',
+            ' 吗？': '?',
+            '开启前切换到的环境：': 'Switch to profile before starting:',
+            '使用当前环境': 'Use the active profile',
+            '已复制': 'Copied',
+            '复制失败': 'Copy failed',
+
+            // 配置、备份
+            '将新增 ': 'Will add ',
+            ' 条规则（其中 ': ' rules (',
+            '条规则（其中': ' rules (',
+            ' 条ID冲突，将分配新ID）、': ' with conflicting IDs get new IDs), ',
+            '条ID冲突，将分配新ID）、': ' with conflicting IDs get new IDs), ',
+            '个模板、': 'templates, ',
+            '个黑名单。': 'blocklists.',
+            '，新增 ': ', adding ',
+            '条规则。': 'rules.',
+            '确定导入？': 'Import?',
+            '配置已导入': 'Configuration imported',
+            '已导入': 'Imported',
+            '导入配置失败': 'Failed to import configuration',
+            '导出配置失败': 'Failed to export configuration',
+            '暂无备份': 'No backups',
+            '选择要恢复的备份（当前配置会先备份，所有转发将停止）：': 'Choose a backup to restore (the current configuration is backed up first and all forwards stop):',
+            '无效的备份编号': 'Invalid backup number',
+            '已恢复备份': 'Backup restored',
+            '获取备份失败': 'Failed to list backups',
+            '恢复备份失败': 'Failed to restore backup',
+            '字节)': 'bytes)',
+
+            // 设置
+            '管理界面监听地址（重启后生效）': 'Web UI listen address (applies after restart)',
+            '管理界面端口（重启后生效）': 'Web UI port (applies after restart)',
+            '自动，从 8080 起': 'Automatic, from 8080',
+            '允许访问管理界面的来源 IP/CIDR（逗号分隔，本机始终允许）': 'IPs/CIDRs allowed to reach the web UI (comma-separated, this machine is always allowed)',
+            '所有来源': 'All sources',
+            '系统默认': 'System default',
+            '日志级别': 'Log level',
+            '默认 (info)': 'Default (info)',
+            'TCP 缓冲区大小（字节）': 'TCP buffer size (bytes)',
+            'UDP 缓冲区大小（字节）': 'UDP buffer size (bytes)',
+            'UDP 套接字缓冲区（字节）': 'UDP socket buffer (bytes)',
+            '界面语言': 'Language',
+            '界面语言（本浏览器）': 'Language (this browser)',
+            '自动': 'Auto',
+            '跟随浏览器': 'Follow browser',
+            '中文': '中文',
+            'API 令牌（重启后生效）': 'API token (applies after restart)',
+            '不校验': 'Not required',
+            '启动时开启的模板': 'Template started on launch',
+            '启动时开启标记了': 'On launch, start rules marked ',
+            '的规则': '',
+            '启动时恢复上次运行的转发': 'On launch, restore forwards that were running',
+            '请输入 API 令牌：': 'Enter the API token:',
+            '监听地址消失后恢复时重新监听（如 Wi-Fi 重连、VPN 重连）': 'Rebind forwards when their listen address disappears and comes back (e.g. Wi-Fi or VPN reconnect)',
+            '（已由命令行参数指定）': ' (set on the command line)',
+            '设置已保存，部分设置重启后生效': 'Settings saved; some take effect after restart',
+            '设置已保存': 'Settings saved',
+            '加载设置失败': 'Failed to load settings',
+            '保存设置失败': 'Failed to save settings',
+            '保存': 'Save',
+
+            // 登录
+            '登录': 'Sign in',
+            '密码': 'Password',
+            '两步验证码': 'Two-factor code',
+
+            // 两步验证
+            '启用两步验证': 'Enable two-factor authentication',
+            '使用验证器应用扫描二维码，然后输入显示的验证码': 'Scan the QR code with an authenticator app, then enter the code it shows',
+            '6位验证码': '6-digit code',
+            '两步验证已启用。输入当前验证码以关闭：': 'Two-factor authentication is enabled. Enter a current code to disable it:',
+            '两步验证已启用': 'Two-factor authentication enabled',
+            '两步验证已关闭': 'Two-factor authentication disabled',
+            '生成密钥失败': 'Failed to generate secret',
+            '启用': 'Enable',
+
+            // 通用
+            '确定': 'OK',
+            '取消': 'Cancel',
+            '关闭': 'Close',
+            '停止': 'Stop',
+            '启动': 'Start',
+            '模板': 'Template',
+            '规则': 'Rule',
+            '发现': 'Found',
+
+            // 标点
+            '：': ': ',
+            '，': ', ',
+            '；': '; ',
+            '。': '. ',
+            '、': ', ',
+            '（': ' (',
+            '）': ')',
+            '？': '?',
+            '“': '"',
+            '”': '"',
+            '／': '/'
+        }
+    };
+
+    const cjk = /[　-〿一-鿿＀-￯]/;
+    const cookieLang = (document.cookie.match(/(?:^|; )lang=([^;]*)/) || [])[1] || '';
+    const lang = window.uiLanguage || '';
+    const dictionary = dictionaries[lang];
+
+    // 按长度从长到短匹配，长句优先于其中的短词
+    let pattern = null;
+    if (dictionary) {
+        const keys = Object.keys(dictionary).sort((a, b) => b.length - a.length);
+        pattern = new RegExp(keys.map(k => k.replace(/[.*+?^${}()|[\]\\]/g, '\\$&')).join('|'), 'g');
+        document.documentElement.lang = lang;
+    }
+
+    // t 翻译一段界面文字。whole 为 true 时只有全部中文都能翻译才替换，
+    // 避免把用户输入的中文名称翻译成一半
+    function t(text, whole) {
+        if (!pattern || typeof text !== 'string' || !cjk.test(text)) {
+            return text;
+        }
+        const translated = text.replace(pattern, m => dictionary[m]);
+        if (whole && cjk.test(translated)) {
+            return text;
+        }
+        return translated;
+    }
+
+    // 翻译节点及其子节点中的文字与提示属性
+    function translateTree(root) {
+        if (!pattern || !root) return;
+        if (root.nodeType === Node.TEXT_NODE) {
+            translateText(root);
+            return;
+        }
+        if (root.nodeType !== Node.ELEMENT_NODE) return;
+        translateAttributes(root);
+        root.querySelectorAll('[title], [placeholder], [alt]').forEach(translateAttributes);
+        const walker = document.createTreeWalker(root, NodeFilter.SHOW_TEXT);
+        while (walker.nextNode()) {
+            translateText(walker.currentNode);
+        }
+    }
+
+    function translateText(node) {
+        const parent = node.parentNode;
+        if (parent && (parent.nodeName === 'SCRIPT' || parent.nodeName === 'STYLE' || parent.nodeName === 'TEXTAREA')) {
+            return;
+        }
+        const translated = t(node.data, true);
+        if (translated !== node.data) {
+            node.data = translated;
+        }
+    }
+
+    function translateAttributes(el) {
+        ['title', 'placeholder', 'alt'].forEach(name => {
+            const value = el.getAttribute(name);
+            if (value) {
+                const translated = t(value, true);
+                if (translated !== value) el.setAttribute(name, translated);
+            }
+        });
+    }
+
+    // 选择界面语言，空字符串表示跟随设置与浏览器
+    function setUILanguage(value) {
+        if (value) {
+            document.cookie = 'lang=' + value + '; path=/; max-age=31536000; SameSite=Lax';
+        } else {
+            document.cookie = 'lang=; path=/; max-age=0; SameSite=Lax';
+        }
+        location.reload();
+    }
+
+    window.t = t;
+    window.setUILanguage = setUILanguage;
+    window.uiLanguageChoice = cookieLang;
+
+    if (!pattern) return;
+
+    // 对话框中的提示也翻译
+    const originalAlert = window.alert, originalConfirm = window.confirm, originalPrompt = window.prompt;
+    window.alert = message => originalAlert(t(String(message)));
+    window.confirm = message => originalConfirm(t(String(message)));
+    window.prompt = (message, value) => originalPrompt(t(String(message)), value);
+
+    // 页面加载后翻译静态内容，之后翻译脚本动态生成的内容
+    document.addEventListener('DOMContentLoaded', function() {
+        document.title = t(document.title);
+        translateTree(document.body);
+        new MutationObserver(mutations => {
+            mutations.forEach(m => {
+                if (m.type === 'characterData') {
+                    translateText(m.target);
+                } else if (m.type === 'attributes') {
+                    translateAttributes(m.target);
+                } else {
+                    m.addedNodes.forEach(translateTree);
+                }
+            });
+        }).observe(document.body, {
+            childList: true,
+            subtree: true,
+            characterData: true,
+            attributes: true,
+            attributeFilter: ['title', 'placeholder', 'alt']
+        });
+    });
+})();
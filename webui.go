@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webAssets 内置的管理界面：web/index.html 与 web/static 下的样式和脚本
+//
+//go:embed web
+var webAssets embed.FS
+
+// webETags 内置文件的 ETag 缓存，内置文件不会改变，只计算一次
+var webETags sync.Map
+
+// uiFiles 管理界面文件，指定了 -ui-dir 时从该目录读取，便于修改界面或使用自定义前端
+func uiFiles() fs.FS {
+	if *uiDir != "" {
+		return os.DirFS(*uiDir)
+	}
+	sub, _ := fs.Sub(webAssets, "web")
+	return sub
+}
+
+// readUIFile 读取界面文件并计算 ETag
+func readUIFile(name string) ([]byte, string, error) {
+	data, err := fs.ReadFile(uiFiles(), name)
+	if err != nil {
+		return nil, "", err
+	}
+	if *uiDir == "" {
+		if etag, ok := webETags.Load(name); ok {
+			return data, etag.(string), nil
+		}
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	if *uiDir == "" {
+		webETags.Store(name, etag)
+	}
+	return data, etag, nil
+}
+
+// serveHTML 提供管理界面：/ 返回嵌入了 API 令牌的 index.html，其他路径返回对应的界面文件，
+// 文件不存在时同样返回 index.html。文件带 ETag，浏览器每次校验、未修改时返回 304
+func serveHTML(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || name == "index.html" {
+		serveIndex(w, r)
+		return
+	}
+
+	data, etag, err := readUIFile(name)
+	if err != nil {
+		serveIndex(w, r)
+		return
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+// serveIndex 提供 index.html。已登录时页面中嵌入了 API 令牌，另有界面语言，不缓存
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	data, _, err := readUIFile("index.html")
+	if err != nil {
+		log.Printf("Failed to read index.html: %v", err)
+		http.Error(w, "Web UI not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(injectLanguage(injectAPIToken(string(data), r), requestLanguage(r))))
+}
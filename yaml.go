@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 导入 gost v3 / frp 配置所需的最小 YAML 解析器，以及导入导出配置用的编码器
+// 解析器只支持块映射、块序列、引号与普通标量以及简单的流式列表，足以读取这些工具的配置文件
+
+// yamlLine 去掉注释后的一行及其缩进
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+// yamlParser 按缩进递归解析
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML 解析 YAML 文档，映射为 map[string]interface{}，序列为 []interface{}，标量为 string
+func parseYAML(data []byte) (interface{}, error) {
+	var lines []yamlLine
+	for _, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.TrimLeft(raw, " \t") != strings.TrimLeft(raw, " ") {
+			return nil, fmt.Errorf("yaml: tabs are not allowed for indentation")
+		}
+		text := strings.TrimRight(stripYAMLComment(raw), " ")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		lines = append(lines, yamlLine{indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	value, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml: unexpected indentation at %q", p.lines[p.pos].text)
+	}
+	return value, nil
+}
+
+// stripYAMLComment 去掉引号外以 # 开头的注释
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // 跳过转义字符，如 \"
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// isSeqItem 判断是否为序列项
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock 根据首行判断解析映射还是序列
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+// parseSeq 解析同一缩进下的序列项
+func (p *yamlParser) parseSeq(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSeqItem(line.text) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+
+		switch {
+		case rest == "":
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				value, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			} else {
+				list = append(list, nil)
+			}
+		case isSeqItem(rest) || yamlKeyEnd(rest) >= 0:
+			// "- key: value" 视为从 rest 所在列开始的映射或嵌套序列
+			p.lines[p.pos] = yamlLine{indent: indent + len(line.text) - len(rest), text: rest}
+			value, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		default:
+			list = append(list, parseYAMLScalar(rest))
+			p.pos++
+		}
+	}
+	return list, nil
+}
+
+// parseMap 解析同一缩进下的键值对
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || isSeqItem(line.text) && line.indent == indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: unexpected indentation at %q", line.text)
+		}
+
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, fmt.Errorf("yaml: expected key at %q", line.text)
+		}
+		key := parseYAMLScalar(line.text[:end]).(string)
+		rest := strings.TrimSpace(line.text[end+1:])
+		p.pos++
+
+		if rest != "" {
+			m[key] = parseYAMLScalar(rest)
+			continue
+		}
+		// 值在下一行：更深的缩进，或与键同列的序列
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || next.indent == indent && isSeqItem(next.text) {
+				value, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = value
+				continue
+			}
+		}
+		m[key] = nil
+	}
+	return m, nil
+}
+
+// yamlKeyEnd 返回引号外第一个作为键分隔符的冒号位置，没有时返回 -1
+func yamlKeyEnd(text string) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '[' || c == '{':
+			if i == 0 {
+				return -1
+			}
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLScalar 解析标量或简单的流式列表
+func parseYAMLScalar(s string) interface{} {
+	s = strings.TrimSpace(s)
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted
+		}
+		return s[1 : len(s)-1]
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	case s == "{}":
+		return map[string]interface{}{}
+	case len(s) >= 2 && s[0] == '[' && s[len(s)-1] == ']':
+		list := []interface{}{}
+		for _, item := range strings.Split(s[1:len(s)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, parseYAMLScalar(item))
+			}
+		}
+		return list
+	}
+	return s
+}
+
+// marshalYAML 把 v 按其 JSON 形式编码为 YAML：键按字母排序，字符串一律加双引号，
+// 输出可由 parseYAML 读回
+func marshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var node interface{}
+	if err := dec.Decode(&node); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch node.(type) {
+	case map[string]interface{}, []interface{}:
+		if !isEmptyYAMLCollection(node) {
+			writeYAMLNode(&buf, node, 0)
+			return buf.Bytes(), nil
+		}
+	}
+	buf.WriteString(yamlScalar(node) + "\n")
+	return buf.Bytes(), nil
+}
+
+// writeYAMLNode 以块格式写出映射或序列
+func writeYAMLNode(buf *bytes.Buffer, node interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeYAMLEntry(buf, pad+yamlKey(k)+":", n[k], indent, indent+2)
+		}
+	case []interface{}:
+		for _, item := range n {
+			if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+				// "- " 后接映射的第一个键
+				var sub bytes.Buffer
+				writeYAMLNode(&sub, m, indent+2)
+				buf.WriteString(pad + "- " + strings.TrimPrefix(sub.String(), pad+"  "))
+				continue
+			}
+			writeYAMLEntry(buf, pad+"-", item, indent+2, indent+2)
+		}
+	}
+}
+
+// writeYAMLEntry 写出键或序列项：标量与空集合写在同一行，否则换行缩进；
+// 映射中的序列与键同列
+func writeYAMLEntry(buf *bytes.Buffer, prefix string, value interface{}, seqIndent, mapIndent int) {
+	switch value.(type) {
+	case map[string]interface{}:
+		if !isEmptyYAMLCollection(value) {
+			buf.WriteString(prefix + "\n")
+			writeYAMLNode(buf, value, mapIndent)
+			return
+		}
+	case []interface{}:
+		if !isEmptyYAMLCollection(value) {
+			buf.WriteString(prefix + "\n")
+			writeYAMLNode(buf, value, seqIndent)
+			return
+		}
+	}
+	buf.WriteString(prefix + " " + yamlScalar(value) + "\n")
+}
+
+// isEmptyYAMLCollection 判断是否为空映射或空序列
+func isEmptyYAMLCollection(node interface{}) bool {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		return len(n) == 0
+	case []interface{}:
+		return len(n) == 0
+	}
+	return false
+}
+
+// yamlKey 简单键原样输出，其余加引号
+func yamlKey(k string) string {
+	for _, c := range k {
+		if !(c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return strconv.Quote(k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+	return k
+}
+
+// yamlScalar 输出标量或空集合
+func yamlScalar(node interface{}) string {
+	switch n := node.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(n)
+	case json.Number:
+		return n.String()
+	case string:
+		return strconv.Quote(n)
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return strconv.Quote(fmt.Sprint(node))
+}
+
+// unmarshalYAML 解析 YAML 并按 out 的类型转换标量（数字、布尔、null），再以 JSON 规则解码到 out
+func unmarshalYAML(data []byte, out interface{}) error {
+	node, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	typed, err := yamlTyped(node, reflect.TypeOf(out).Elem())
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(typed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, out)
+}
+
+// yamlTyped 按目标类型把解析出的字符串标量转换为 JSON 对应的类型
+func yamlTyped(node interface{}, t reflect.Type) (interface{}, error) {
+	if s, ok := node.(string); ok && (s == "null" || s == "~") {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return nil, nil
+		}
+	}
+	if node == nil || t.Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return node, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return yamlTyped(node, t.Elem())
+	case reflect.Struct:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("yaml: expected mapping for %s", t)
+		}
+		out := make(map[string]interface{}, len(m))
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if value, ok := m[name]; ok {
+				converted, err := yamlTyped(value, field.Type)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				out[name] = converted
+			}
+		}
+		return out, nil
+	case reflect.Slice, reflect.Array:
+		list, ok := node.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("yaml: expected sequence for %s", t)
+		}
+		out := make([]interface{}, len(list))
+		for i, item := range list {
+			converted, err := yamlTyped(item, t.Elem())
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = converted
+		}
+		return out, nil
+	case reflect.Map:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("yaml: expected mapping for %s", t)
+		}
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			converted, err := yamlTyped(v, t.Elem())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = converted
+		}
+		return out, nil
+	case reflect.Bool:
+		s, _ := node.(string)
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: invalid boolean %q", s)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		s, _ := node.(string)
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("yaml: invalid number %q", s)
+		}
+		return json.Number(s), nil
+	}
+	return node, nil
+}
+
+// jsonUnmarshalerType 自定义 JSON 解码的类型（如 time.Time）按原样传递
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()